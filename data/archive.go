@@ -0,0 +1,116 @@
+package data
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// archiveExtension The extension of the archived sessions (compressed using gzip).
+const archiveExtension = ".gz"
+
+// Archive A directory that contains compressed sessions. The sessions are archived as stored: protected sessions stay
+// encrypted.
+type Archive struct {
+	Dir string
+}
+
+// NewArchive Creates an archive. The directory is created if it does not exist.
+func NewArchive(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf(`cannot create the archive directory "%s": %s`, dir, err.Error())
+	}
+	return &Archive{Dir: dir}, nil
+}
+
+// Path Returns the path to the file that contains an archived session.
+func (a *Archive) Path(name string) string {
+	return filepath.Join(a.Dir, name+archiveExtension)
+}
+
+// Put Compresses the serialized representation of a session into the archive. An archived session cannot be replaced.
+func (a *Archive) Put(name string, content []byte) error {
+	var err error
+	var buffer bytes.Buffer
+	var writer *gzip.Writer
+
+	if _, err = os.Stat(a.Path(name)); err == nil {
+		return fmt.Errorf(`the session "%s" is already archived ("%s")`, name, a.Path(name))
+	}
+	if writer, err = gzip.NewWriterLevel(&buffer, gzip.BestCompression); err != nil {
+		return err
+	}
+	writer.Name = name
+	if _, err = writer.Write(content); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return writeAtomically(a.Path(name), buffer.Bytes())
+}
+
+// Get Returns the serialized representation of an archived session, or an error that wraps `ErrNotFound`.
+func (a *Archive) Get(name string) ([]byte, error) {
+	var err error
+	var file *os.File
+	var reader *gzip.Reader
+
+	if file, err = os.Open(a.Path(name)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf(`archived session "%s": %w`, name, ErrNotFound)
+		}
+		return nil, err
+	}
+	defer file.Close()
+	if reader, err = gzip.NewReader(file); err != nil {
+		return nil, fmt.Errorf(`invalid archive "%s": %s`, a.Path(name), err.Error())
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// List Returns the names of the archived sessions (sorted).
+func (a *Archive) List() ([]string, error) {
+	var err error
+	var entries []os.DirEntry
+	var names []string
+
+	if entries, err = os.ReadDir(a.Dir); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != archiveExtension {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), archiveExtension))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ArchiveSession Moves a session from a store into the archive. If the session cannot be removed from the store, it
+// is removed from the archive: a session is never both archived and live.
+func ArchiveSession(store Store, archive *Archive, name string) error {
+	var err error
+	var content []byte
+
+	if content, err = store.ReadSession(name); err != nil {
+		return err
+	}
+	if err = archive.Put(name, content); err != nil {
+		return err
+	}
+	if err = store.DeleteSession(name); err != nil {
+		if removeErr := os.Remove(archive.Path(name)); removeErr != nil {
+			return fmt.Errorf(`cannot remove the session "%s" from the store (%s), nor from the archive (%s)`, name, err.Error(), removeErr.Error())
+		}
+		return err
+	}
+	return nil
+}
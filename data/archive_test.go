@@ -0,0 +1,101 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveSession(t *testing.T) {
+	var err error
+	var dir = t.TempDir()
+	var store = NewFileStore(dir, filepath.Join(dir, "keys.json"))
+	var archive *Archive
+	var session Session
+	var loaded Session
+	var content []byte
+	var names []string
+
+	archive, err = NewArchive(filepath.Join(dir, "archive"))
+	assert.Nil(t, err)
+	session.Init("key", 10)
+	session.AddBoundary([]byte{1, 2})
+	err = SaveSession(store, "first", &session)
+	assert.Nil(t, err)
+
+	// The session is moved into the archive.
+	err = ArchiveSession(store, archive, "first")
+	assert.Nil(t, err)
+	_, err = store.ReadSession("first")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	names, err = archive.List()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first"}, names)
+	content, err = archive.Get("first")
+	assert.Nil(t, err)
+	err = loaded.Deserialize("first", content)
+	assert.Nil(t, err)
+	assert.Equal(t, session.Boundaries, loaded.Boundaries)
+
+	// An archived session cannot be replaced.
+	err = SaveSession(store, "first", &session)
+	assert.Nil(t, err)
+	err = ArchiveSession(store, archive, "first")
+	assert.NotNil(t, err)
+	_, err = store.ReadSession("first")
+	assert.Nil(t, err)
+
+	_, err = archive.Get("second")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestArchiveSessionBolt(t *testing.T) {
+	var err error
+	var dir = t.TempDir()
+	var files = NewFileStore(t.TempDir(), filepath.Join(dir, "keys.json"))
+	var store *BoltStore
+	var archive *Archive
+	var session Session
+	var names []string
+
+	archive, err = NewArchive(filepath.Join(dir, "archive"))
+	assert.Nil(t, err)
+	session.Init("key", 10)
+	session.AddBoundary([]byte{1, 2})
+	assert.Nil(t, SaveSession(files, "legacy", &session))
+	store, err = BoltOpen(filepath.Join(dir, "umail.db"), files)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	// The session only stored as a file is moved into the archive.
+	assert.Nil(t, ArchiveSession(store, archive, "legacy"))
+	_, err = store.ReadSession("legacy")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	names, err = store.ListSessions()
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+	names, err = archive.List()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"legacy"}, names)
+	err = store.DeleteSession("legacy")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// The session that cannot be removed from the store is not archived.
+	assert.Nil(t, SaveSession(store, "first", &session))
+	err = ArchiveSession(undeletableStore{store}, archive, "first")
+	assert.NotNil(t, err)
+	_, err = archive.Get("first")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Nil(t, LoadSession(store, "first", &session))
+}
+
+// undeletableStore A store whose sessions cannot be removed.
+type undeletableStore struct {
+	Store
+}
+
+func (u undeletableStore) DeleteSession(name string) error {
+	return fmt.Errorf(`session "%s" cannot be removed`, name)
+}
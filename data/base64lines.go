@@ -0,0 +1,105 @@
+package data
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// base64LinesCarrierLength The number of bytes hidden by the lengths of the lines of the base64 encoded parts of an
+// email, by default: a body of a few lines can hide them.
+const base64LinesCarrierLength = 2
+
+// base64LinesCarrierMaxLength The maximum number of bytes hidden by the lengths of the lines of the base64 encoded
+// parts (the body must be long enough, see `base64Lines`).
+const base64LinesCarrierMaxLength = 32
+
+// base64LineBits The number of bits hidden by the length of a line: the line contains 76, 72, 68 or 64 characters.
+const base64LineBits = 2
+
+// base64LineStep The difference between two lengths of a line (the length of a base64 quantum).
+const base64LineStep = 4
+
+// base64Lines The lengths of the lines of the base64 encoded parts of an email, that hide bytes of a chunk of the
+// message (see `CarrierBase64Lines`). Each line hides 2 bits, except the last line of each part (whose length is given
+// by the content). The lines that follow the hidden bytes have random lengths.
+type base64Lines struct {
+	payload []byte
+	// position The number of bits hidden so far.
+	position int
+}
+
+// newBase64Lines Returns the lengths of the lines that hide a given payload, or nil if the payload is empty (the lines
+// then have the maximum length).
+func newBase64Lines(payload []byte) *base64Lines {
+	if len(payload) == 0 {
+		return nil
+	}
+	return &base64Lines{payload: payload}
+}
+
+// next Returns the length of the next line, given the number of characters that remain to be written in the part.
+func (l *base64Lines) next(remaining int) (int, error) {
+	var value [1]byte
+	var length int
+
+	if l.position >= 8*len(l.payload) {
+		if _, err := rand.Read(value[:]); err != nil {
+			return 0, err
+		}
+		return base64LineLength - base64LineStep*int(value[0]&(1<<base64LineBits-1)), nil
+	}
+	value[0] = l.payload[l.position/8] >> (8 - base64LineBits - l.position%8) & (1<<base64LineBits - 1)
+	length = base64LineLength - base64LineStep*int(value[0])
+	// The last line of the part hides nothing: the bits go to the next part.
+	if remaining > length {
+		l.position += base64LineBits
+	}
+	return length, nil
+}
+
+// check Checks that all the bytes are hidden, once the parts are written.
+func (l *base64Lines) check() error {
+	if l != nil && l.position < 8*len(l.payload) {
+		return fmt.Errorf(`the base64 encoded parts of the email are too short to hide %d bytes (%d bits hidden)`, len(l.payload), l.position)
+	}
+	return nil
+}
+
+// Base64LinesPayload Extracts the bytes hidden by the lengths of the lines of the base64 encoded parts of an email
+// (RFC 5322): `length` bytes.
+func Base64LinesPayload(content []byte, length int) ([]byte, error) {
+	var err error
+	var parts []leafPart
+	var payload = make([]byte, length)
+	var position int
+
+	if parts, err = leafParts(content); err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		var lines []string
+
+		if !strings.EqualFold(strings.TrimSpace(part.header.Get("Content-Transfer-Encoding")), TextEncodingBase64) {
+			continue
+		}
+		for _, line := range strings.Split(string(part.body), "\n") {
+			if line = strings.TrimRight(line, "\r"); len(line) > 0 {
+				lines = append(lines, line)
+			}
+		}
+		// The last line of the part hides nothing.
+		for i := 0; i < len(lines)-1 && position < 8*length; i++ {
+			var value = (base64LineLength - len(lines[i])) / base64LineStep
+			if len(lines[i]) > base64LineLength || (base64LineLength-len(lines[i]))%base64LineStep != 0 || value >= 1<<base64LineBits {
+				return nil, fmt.Errorf(`the base64 encoded parts of the email hide no bytes (unexpected line of %d characters)`, len(lines[i]))
+			}
+			payload[position/8] |= byte(value) << (8 - base64LineBits - position%8)
+			position += base64LineBits
+		}
+	}
+	if position < 8*length {
+		return nil, fmt.Errorf(`the base64 encoded parts of the email hide less than %d bytes`, length)
+	}
+	return payload, nil
+}
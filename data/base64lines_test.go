@@ -0,0 +1,67 @@
+package data
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+func TestBase64Lines(t *testing.T) {
+	var text = []byte(strings.Repeat("Hello John, how are you? Ça va ?\n", 20))
+	var html = []byte("<p>" + strings.Repeat("Hello John, how are you?<br>", 40) + "</p>")
+	var payload = []byte{0x00, 0xFF, 0xA5, 0x3C}
+	var boundaries = []string{strings.Repeat("0a", 35), strings.Repeat("1b", 35), strings.Repeat("2c", 35)}
+
+	for _, nested := range []bool{false, true} {
+		for _, encoding := range []string{TextEncodingBase64, TextEncodingQuotedPrintable} {
+			var err error
+			var content []byte
+			var email []byte
+			var extracted []byte
+			var reader *multipart.Reader
+			var part *multipart.Part
+			var decoded []byte
+			var contentType = `multipart/alternative; boundary="` + boundaries[0] + `"`
+
+			if nested {
+				content, err = BuildNested(boundaries, text, html, encoding, "", BodyPayloads{Base64Lines: payload})
+				contentType = `multipart/mixed; boundary="` + boundaries[0] + `"`
+			} else {
+				content, err = BuildAlternative(boundaries[0], text, html, encoding, "", BodyPayloads{Base64Lines: payload})
+			}
+			assert.Nil(t, err)
+			// The lines of the parts are not too long (the headers of the nested parts are longer).
+			for _, line := range strings.Split(string(content), "\r\n") {
+				if !strings.HasPrefix(line, "Content-Type:") {
+					assert.LessOrEqual(t, len(line), 76)
+				}
+			}
+			email = append([]byte("From: a@example.com\r\nContent-Type: "+contentType+"\r\n\r\n"), content...)
+			extracted, err = Base64LinesPayload(email, len(payload))
+			assert.Nil(t, err)
+			assert.Equal(t, payload, extracted)
+
+			// The parts are still decoded.
+			if !nested {
+				reader = multipart.NewReader(bytes.NewReader(content), boundaries[0])
+				_, err = reader.NextPart()
+				assert.Nil(t, err)
+				part, err = reader.NextPart()
+				assert.Nil(t, err)
+				decoded, _ = io.ReadAll(part)
+				assert.Equal(t, html, decodeBase64(t, decoded))
+			}
+		}
+	}
+
+	// We'll get errors...
+	_, err := BuildAlternative(boundaries[0], []byte("Hello"), []byte("<p>Hello</p>"), "", "", BodyPayloads{Base64Lines: payload})
+	assert.NotNil(t, err)
+	_, err = Base64LinesPayload([]byte("Content-Transfer-Encoding: base64\r\n\r\nSGVsbG8=\r\n"), 1)
+	assert.NotNil(t, err)
+	_, err = Base64LinesPayload([]byte("Content-Transfer-Encoding: base64\r\n\r\nSGVsbG8g\r\nSGVsbG8=\r\n"), 1)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,74 @@
+package data
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Batching How the emails of a mailbox are fetched (see "rcv"): by batches of sequence numbers (one request per batch,
+// instead of one per email), the emails of a batch being processed by a bounded pool of workers.
+type Batching struct {
+	// Size The maximum number of emails fetched by a single request.
+	Size int
+	// Workers The maximum number of emails processed at the same time.
+	Workers int
+}
+
+// DefaultBatching The default batching.
+var DefaultBatching = Batching{Size: 100, Workers: 4}
+
+// Validate Checks the batching.
+func (b Batching) Validate() error {
+	if b.Size < 1 {
+		return fmt.Errorf(`invalid batch size (%d): at least one email must be fetched at once`, b.Size)
+	}
+	if b.Workers < 1 {
+		return fmt.Errorf(`invalid number of workers (%d): at least one is needed`, b.Workers)
+	}
+	return nil
+}
+
+// Split Splits a list of sequence numbers into batches (in the same order).
+func (b Batching) Split(nums []uint32) [][]uint32 {
+	var batches [][]uint32
+
+	for len(nums) > b.Size {
+		batches = append(batches, nums[:b.Size])
+		nums = nums[b.Size:]
+	}
+	if len(nums) > 0 {
+		batches = append(batches, nums)
+	}
+	return batches
+}
+
+// Run Calls `process` for each index from 0 to `count` - 1, from (at most) `Workers` goroutines, and waits for all the
+// calls to return. The results are expected to be stored by index, so that their order does not depend on the
+// scheduling. If calls fail, then the error of the lowest index is returned.
+func (b Batching) Run(count int, process func(index int) error) error {
+	var wg sync.WaitGroup
+	var indexes = make(chan int)
+	var errs = make([]error, count)
+
+	for w := 0; w < b.Workers && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				errs[index] = process(index)
+			}
+		}()
+	}
+	for index := 0; index < count; index++ {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBatchingSplit(t *testing.T) {
+	var batching = Batching{Size: 2, Workers: 1}
+
+	assert.Nil(t, batching.Validate())
+	assert.NotNil(t, Batching{Size: 0, Workers: 1}.Validate())
+	assert.NotNil(t, Batching{Size: 1, Workers: 0}.Validate())
+
+	assert.Nil(t, batching.Split(nil))
+	assert.Equal(t, [][]uint32{{1, 2}}, batching.Split([]uint32{1, 2}))
+	assert.Equal(t, [][]uint32{{1, 2}, {5, 7}, {9}}, batching.Split([]uint32{1, 2, 5, 7, 9}))
+}
+
+func TestBatchingRun(t *testing.T) {
+	var err error
+	var batching = Batching{Size: 10, Workers: 3}
+	var results = make([]int, 50)
+	var running, highest atomic.Int64
+
+	err = batching.Run(len(results), func(index int) error {
+		var current = running.Add(1)
+		defer running.Add(-1)
+		for {
+			var seen = highest.Load()
+			if current <= seen || highest.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		results[index] = index * index
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, highest.Load(), int64(3))
+	for index, result := range results {
+		assert.Equal(t, index*index, result)
+	}
+
+	// The error of the lowest index is returned, whatever the order of the calls.
+	err = batching.Run(10, func(index int) error {
+		if index == 4 || index == 7 {
+			return fmt.Errorf("error %d", index)
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "error 4")
+
+	assert.Nil(t, batching.Run(0, func(index int) error { return fmt.Errorf("unexpected") }))
+}
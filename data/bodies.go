@@ -0,0 +1,88 @@
+package data
+
+// BodyRotation How the bodies attached to a session are assigned to the emails.
+type BodyRotation string
+
+const (
+	// RotationSequence The bodies are used in turn (the first email has the first body...).
+	RotationSequence BodyRotation = "sequence"
+	// RotationRandom The bodies are picked at random, without replacement: all the bodies are used before a body is
+	// used again, and two consecutive emails never have the same body.
+	RotationRandom BodyRotation = "random"
+)
+
+// bodyRotations The known rotations. The empty value stands for `RotationSequence` (sessions created before the
+// rotations were introduced).
+var bodyRotations = map[BodyRotation]bool{
+	"":               true,
+	RotationSequence: true,
+	RotationRandom:   true,
+}
+
+// ParseBodyRotation Returns the rotation of the bodies identified by a given name.
+func ParseBodyRotation(name string) (BodyRotation, bool) {
+	var rotation = BodyRotation(name)
+
+	if len(name) == 0 || !bodyRotations[rotation] {
+		return "", false
+	}
+	return rotation, true
+}
+
+// BodyFor Returns the path to the file that contains the body of the email that carries the boundary at a given index,
+// or an empty string if no body is attached to the session. The bodies are assigned in turn.
+func (s *Session) BodyFor(index int) string {
+	if len(s.Bodies) == 0 {
+		return ""
+	}
+	return s.Bodies[index%len(s.Bodies)]
+}
+
+// NextBody Returns the path to the file that contains the body of the next email to send (which carries the boundary
+// at a given index), or an empty string if no body is attached to the session.
+// For a random rotation, the bodies already used are given by the journal, and `random` returns a random integer in
+// [0, n).
+func (s *Session) NextBody(index int, random func(n int) int) string {
+	var used = make(map[string]bool)
+	var last string
+	var candidates []string
+
+	if s.Rotation != RotationRandom || len(s.Bodies) == 0 {
+		return s.BodyFor(index)
+	}
+
+	// Replay the journal to find the bodies used since the beginning of the current cycle.
+	for _, entry := range s.Journal {
+		if !s.hasBody(entry.Body) {
+			continue
+		}
+		if len(used) == len(s.Bodies) {
+			used = make(map[string]bool)
+		}
+		used[entry.Body] = true
+		last = entry.Body
+	}
+	if len(used) == len(s.Bodies) {
+		// A new cycle starts: the last body used must not be used again immediately.
+		used = make(map[string]bool)
+		if len(s.Bodies) > 1 {
+			used[last] = true
+		}
+	}
+	for _, body := range s.Bodies {
+		if !used[body] {
+			candidates = append(candidates, body)
+		}
+	}
+	return candidates[random(len(candidates))]
+}
+
+// hasBody Tells whether a body is attached to the session.
+func (s *Session) hasBody(body string) bool {
+	for _, b := range s.Bodies {
+		if b == body {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestSessionBodies(t *testing.T) {
+	var err error
+	var session Session
+	var loaded Session
+	var ok bool
+
+	session.Init("key", 0)
+	assert.Equal(t, "", session.BodyFor(0))
+	assert.Equal(t, "", session.NextBody(0, rand.Intn))
+	session.Bodies = []string{"body1.txt", "body2.txt"}
+	assert.Equal(t, "body1.txt", session.BodyFor(0))
+	assert.Equal(t, "body2.txt", session.BodyFor(1))
+	assert.Equal(t, "body1.txt", session.BodyFor(2))
+	assert.Equal(t, "body2.txt", session.NextBody(1, rand.Intn))
+
+	session.Rotation = RotationRandom
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, session.Bodies, loaded.Bodies)
+	assert.Equal(t, RotationRandom, loaded.Rotation)
+
+	_, ok = ParseBodyRotation("random")
+	assert.True(t, ok)
+	_, ok = ParseBodyRotation("shuffle")
+	assert.False(t, ok)
+}
+
+func TestSessionNextBodyRandom(t *testing.T) {
+	var session Session
+	var bodies = []string{"a", "b", "c"}
+	var previous string
+	var random = rand.New(rand.NewSource(1))
+
+	session.Init("key", 0)
+	session.Bodies = bodies
+	session.Rotation = RotationRandom
+	for cycle := 0; cycle < 20; cycle++ {
+		var used = make(map[string]bool)
+		for i := 0; i < len(bodies); i++ {
+			var body = session.NextBody(i, random.Intn)
+			// No repetition within a cycle, and never twice in a row.
+			assert.False(t, used[body])
+			assert.NotEqual(t, previous, body)
+			used[body] = true
+			previous = body
+			session.RecordSend("alice@example.com", Copies{}, 0, "<1@example.com>", body, 0)
+		}
+	}
+
+	// A single body.
+	session.Journal = nil
+	session.Bodies = []string{"a"}
+	assert.Equal(t, "a", session.NextBody(0, random.Intn))
+	session.RecordSend("alice@example.com", Copies{}, 0, "<1@example.com>", "a", 0)
+	assert.Equal(t, "a", session.NextBody(1, random.Intn))
+}
@@ -0,0 +1,271 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"sort"
+	"time"
+)
+
+var boltSessionBucket = []byte("sessions")
+var boltKeyBucket = []byte("keys")
+
+// boltTimeout The maximum duration to wait for the database, if it is used by another process.
+const boltTimeout = 5 * time.Second
+
+// BoltStore A store backed by an embedded database (bbolt). All updates are atomic, and the database cannot be modified
+// by two processes at the same time.
+// The database is opened for each operation, and closed right after it: a long-running process (the daemon, for
+// example) does not prevent the other processes from using it. Reads only open the database in read-only mode, which
+// can be shared by several processes.
+// The sessions that are not found into the database are looked for into a fallback store (if any), so that the
+// sessions created before the database are still available (see `Import`).
+type BoltStore struct {
+	Path     string
+	fallback Store
+}
+
+// BoltOpen Opens (or creates) a database. `fallback` may be nil.
+func BoltOpen(path string, fallback Store) (*BoltStore, error) {
+	var store = &BoltStore{Path: path, fallback: fallback}
+
+	err := store.update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltSessionBucket, boltKeyBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// open Opens the database. The database must be closed by the caller as soon as possible.
+func (b *BoltStore) open(readOnly bool) (*bolt.DB, error) {
+	var err error
+	var db *bolt.DB
+
+	if db, err = bolt.Open(b.Path, 0600, &bolt.Options{Timeout: boltTimeout, ReadOnly: readOnly}); err != nil {
+		return nil, fmt.Errorf(`cannot open the database "%s": %s`, b.Path, err.Error())
+	}
+	return db, nil
+}
+
+// view Executes a read-only transaction, and closes the database.
+func (b *BoltStore) view(fn func(*bolt.Tx) error) error {
+	var err error
+	var db *bolt.DB
+
+	if db, err = b.open(true); err != nil {
+		return err
+	}
+	if err = db.View(fn); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+// update Executes a read-write transaction, and closes the database.
+func (b *BoltStore) update(fn func(*bolt.Tx) error) error {
+	var err error
+	var db *bolt.DB
+
+	if db, err = b.open(false); err != nil {
+		return err
+	}
+	if err = db.Update(fn); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+func (b *BoltStore) ReadSession(name string) ([]byte, error) {
+	var content []byte
+
+	err := b.view(func(tx *bolt.Tx) error {
+		if value := tx.Bucket(boltSessionBucket).Get([]byte(name)); value != nil {
+			// The value is only valid during the transaction.
+			content = append([]byte{}, value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if content != nil {
+		return content, nil
+	}
+	if b.fallback != nil {
+		return b.fallback.ReadSession(name)
+	}
+	return nil, fmt.Errorf(`session "%s": %w`, name, ErrNotFound)
+}
+
+func (b *BoltStore) WriteSession(name string, content []byte) error {
+	return b.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSessionBucket).Put([]byte(name), content)
+	})
+}
+
+// DeleteSession Removes a session from the database, and from the fallback store (a session created before the
+// database is only found into the fallback store). It returns an error that wraps `ErrNotFound` if the session is found
+// nowhere.
+func (b *BoltStore) DeleteSession(name string) error {
+	var err error
+	var found bool
+
+	err = b.update(func(tx *bolt.Tx) error {
+		var bucket = tx.Bucket(boltSessionBucket)
+		if bucket.Get([]byte(name)) == nil {
+			return nil
+		}
+		found = true
+		return bucket.Delete([]byte(name))
+	})
+	if err != nil {
+		return err
+	}
+	if b.fallback != nil {
+		if err = b.fallback.DeleteSession(name); err == nil {
+			found = true
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf(`session "%s": %w`, name, ErrNotFound)
+	}
+	return nil
+}
+
+// ListSessions Returns the names of the sessions stored into the database or into the fallback store.
+func (b *BoltStore) ListSessions() ([]string, error) {
+	var err error
+	var names []string
+	var found = make(map[string]bool)
+
+	err = b.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSessionBucket).ForEach(func(k, v []byte) error {
+			found[string(k)] = true
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if b.fallback != nil {
+		var fallbackNames []string
+		if fallbackNames, err = b.fallback.ListSessions(); err != nil {
+			return nil, err
+		}
+		for _, name := range fallbackNames {
+			found[name] = true
+		}
+	}
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (b *BoltStore) ReadKeyInfo(name string) (*KeyInfo, error) {
+	var err error
+	var info *KeyInfo
+
+	err = b.view(func(tx *bolt.Tx) error {
+		var value = tx.Bucket(boltKeyBucket).Get([]byte(name))
+		if value == nil {
+			return nil
+		}
+		info = &KeyInfo{}
+		return json.Unmarshal(value, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if info != nil {
+		return info, nil
+	}
+	if b.fallback != nil {
+		return b.fallback.ReadKeyInfo(name)
+	}
+	return nil, fmt.Errorf(`key "%s": %w`, name, ErrNotFound)
+}
+
+func (b *BoltStore) WriteKeyInfo(info *KeyInfo) error {
+	var err error
+	var value []byte
+
+	if value, err = json.Marshal(info); err != nil {
+		return err
+	}
+	return b.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltKeyBucket).Put([]byte(info.Name), value)
+	})
+}
+
+func (b *BoltStore) DeleteKeyInfo(name string) error {
+	var err error
+
+	err = b.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltKeyBucket).Delete([]byte(name))
+	})
+	if err != nil {
+		return err
+	}
+	if b.fallback != nil {
+		if err = b.fallback.DeleteKeyInfo(name); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import Copies the sessions from a store into the database. The sessions that already exist into the database are not
+// modified. It returns the names of the imported sessions.
+// Please note that the sessions are copied as is: protected sessions are not decrypted.
+func (b *BoltStore) Import(from Store) ([]string, error) {
+	var err error
+	var names []string
+	var imported []string
+
+	if names, err = from.ListSessions(); err != nil {
+		return nil, err
+	}
+	var contents = make([][]byte, len(names))
+	for i, name := range names {
+		if contents[i], err = from.ReadSession(name); err != nil {
+			return nil, err
+		}
+	}
+	err = b.update(func(tx *bolt.Tx) error {
+		var bucket = tx.Bucket(boltSessionBucket)
+		for i, name := range names {
+			if bucket.Get([]byte(name)) != nil {
+				continue
+			}
+			if err := bucket.Put([]byte(name), contents[i]); err != nil {
+				return err
+			}
+			imported = append(imported, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+// Close Does nothing: the database is closed after each operation.
+func (b *BoltStore) Close() error {
+	return nil
+}
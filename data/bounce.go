@@ -0,0 +1,241 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// Bounce A delivery status notification (RFC 3464) that reports that an email could not be delivered.
+type Bounce struct {
+	// MessageID The message ID of the email that bounced ("<...>").
+	MessageID string
+	// Recipients The addresses of the recipients the email could not be delivered to (empty if the notification does
+	// not give them).
+	Recipients []string
+	// Reason The reason of the failure (the diagnostic code given by the notification, or its status).
+	Reason string
+}
+
+// BouncedEmail The email of a session a bounce refers to.
+type BouncedEmail struct {
+	// Recipient The recipient of the email, as recorded by the journal.
+	Recipient string
+	// Index The index of the boundary carried by the email.
+	Index int
+	// Copy Tells whether the bounce only concerns the copies of the email ("Cc" or "Bcc" recipients): the email
+	// reached its recipient.
+	Copy bool
+}
+
+var bounceMessageIdRegex = regexp.MustCompile(`(?im)^Message-I[Dd]:\s*(<[^>\s]+>)`)
+
+// ParseBounce Parses an email, and returns the failure it reports, or nil if the email is not a delivery status
+// notification that reports a failure. Besides the standard notifications ("multipart/report"), the notifications
+// sent by the mailer daemons in plain text are recognized if they quote the headers of the original email.
+func ParseBounce(message []byte) (*Bounce, error) {
+	var err error
+	var email *mail.Message
+	var mediaType string
+	var params map[string]string
+	var bounce Bounce
+	var body []byte
+	var match [][]byte
+
+	if email, err = mail.ReadMessage(bytes.NewReader(message)); err != nil {
+		return nil, fmt.Errorf(`invalid email: %s`, err.Error())
+	}
+	if mediaType, params, err = mime.ParseMediaType(email.Header.Get("Content-Type")); err == nil &&
+		mediaType == "multipart/report" && strings.EqualFold(params["report-type"], "delivery-status") {
+		var reader = multipart.NewReader(email.Body, params["boundary"])
+		var failed bool
+		for {
+			var part *multipart.Part
+			var partType string
+			if part, err = reader.NextPart(); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf(`invalid delivery status notification: %s`, err.Error())
+			}
+			if body, err = io.ReadAll(decodeTransfer(part, part.Header.Get("Content-Transfer-Encoding"))); err != nil {
+				return nil, fmt.Errorf(`invalid delivery status notification: %s`, err.Error())
+			}
+			partType, _, _ = mime.ParseMediaType(part.Header.Get("Content-Type"))
+			switch strings.ToLower(partType) {
+			case "message/delivery-status", "message/global-delivery-status":
+				failed = parseDeliveryStatus(body, &bounce)
+			case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+				if match = bounceMessageIdRegex.FindSubmatch(body); match != nil {
+					bounce.MessageID = string(match[1])
+				}
+			}
+		}
+		if !failed || len(bounce.MessageID) == 0 {
+			return nil, nil
+		}
+		return &bounce, nil
+	}
+
+	// A notification in plain text: the failed recipients may be given by a header (Exim, Gmail).
+	if !isMailerDaemon(email.Header.Get("From")) && len(email.Header.Get("X-Failed-Recipients")) == 0 {
+		return nil, nil
+	}
+	if body, err = io.ReadAll(decodeTransfer(email.Body, email.Header.Get("Content-Transfer-Encoding"))); err != nil {
+		return nil, fmt.Errorf(`invalid email: %s`, err.Error())
+	}
+	if match = bounceMessageIdRegex.FindSubmatch(body); match == nil {
+		return nil, nil
+	}
+	bounce.MessageID = string(match[1])
+	for _, address := range strings.Split(email.Header.Get("X-Failed-Recipients"), ",") {
+		if address = strings.TrimSpace(address); len(address) > 0 {
+			bounce.Recipients = append(bounce.Recipients, address)
+		}
+	}
+	bounce.Reason = strings.TrimSpace(email.Header.Get("Subject"))
+	return &bounce, nil
+}
+
+// parseDeliveryStatus Parses the body of a "message/delivery-status" part: the fields of the message, followed by the
+// fields of each recipient. The recipients whose action is "failed" are added to the bounce. Returns true if the
+// delivery failed for (at least) one recipient.
+func parseDeliveryStatus(body []byte, bounce *Bounce) bool {
+	var reader = textproto.NewReader(bufio.NewReader(bytes.NewReader(body)))
+	var failed bool
+
+	for {
+		var fields, err = reader.ReadMIMEHeader()
+		if len(fields) > 0 && strings.EqualFold(strings.TrimSpace(fields.Get("Action")), "failed") {
+			var reason = fields.Get("Diagnostic-Code")
+			failed = true
+			if recipient := fields.Get("Final-Recipient"); len(recipient) > 0 {
+				// The address is preceded by its type ("rfc822; john@example.com").
+				if i := strings.Index(recipient, ";"); i >= 0 {
+					recipient = recipient[i+1:]
+				}
+				bounce.Recipients = append(bounce.Recipients, strings.TrimSpace(recipient))
+			}
+			if len(reason) == 0 {
+				reason = "status " + fields.Get("Status")
+			} else if i := strings.Index(reason, ";"); i >= 0 {
+				reason = reason[i+1:]
+			}
+			if len(bounce.Reason) == 0 {
+				bounce.Reason = strings.TrimSpace(reason)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return failed
+}
+
+// decodeTransfer Returns a reader that decodes the content of a part, given its transfer encoding.
+func decodeTransfer(reader io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case TextEncodingBase64:
+		return base64.NewDecoder(base64.StdEncoding, reader)
+	case TextEncodingQuotedPrintable:
+		return quotedprintable.NewReader(reader)
+	}
+	return reader
+}
+
+// isMailerDaemon Tells whether an address is the one of a mailer daemon (which sends the notifications).
+func isMailerDaemon(address string) bool {
+	address = strings.ToLower(address)
+	return strings.Contains(address, "mailer-daemon") || strings.Contains(address, "postmaster")
+}
+
+// SentMessageIDs Returns the message IDs of the emails of the session that are marked as sent (and not confirmed):
+// these emails may have bounced.
+func (s *Session) SentMessageIDs() []string {
+	var result []string
+
+	for _, deliveries := range s.allDeliveries() {
+		for _, delivery := range deliveries {
+			if delivery.Status == DeliverySent && len(delivery.MessageID) > 0 {
+				result = append(result, delivery.MessageID)
+			}
+		}
+	}
+	return result
+}
+
+// FindBounced Returns the email of the session a bounce refers to, or nil if the bounce does not refer to an email of
+// the session that is marked as sent (for example, if the email has been sent again since).
+func (s *Session) FindBounced(bounce *Bounce) *BouncedEmail {
+	for i := len(s.Journal) - 1; i >= 0; i-- {
+		var entry = s.Journal[i]
+		var deliveries = s.recipientDeliveries(entry.Recipient)
+		var email = BouncedEmail{Recipient: entry.Recipient, Index: entry.Boundary}
+		var addresses []string
+
+		if entry.MessageID != bounce.MessageID {
+			continue
+		}
+		if entry.Boundary < 0 || entry.Boundary >= len(deliveries) ||
+			deliveries[entry.Boundary].Status != DeliverySent || deliveries[entry.Boundary].MessageID != bounce.MessageID {
+			return nil
+		}
+		// If the notification gives the recipients, then the email may have reached its recipient.
+		if addresses, _ = EnvelopeAddresses(entry.Recipient); len(bounce.Recipients) > 0 && len(addresses) > 0 {
+			email.Copy = true
+			for _, address := range addresses {
+				for _, failed := range bounce.Recipients {
+					if strings.EqualFold(address, failed) {
+						email.Copy = false
+					}
+				}
+			}
+		}
+		return &email
+	}
+	return nil
+}
+
+// SetBounced Records that an email bounced: its boundary is marked as failed, so that the email can be sent again
+// (see "resume-session").
+func (s *Session) SetBounced(email *BouncedEmail, reason string) error {
+	var deliveries = s.recipientDeliveries(email.Recipient)
+
+	if deliveries == nil {
+		return fmt.Errorf(`"%s" is not a recipient of the session`, email.Recipient)
+	}
+	return deliveries.SetFailed(email.Index, fmt.Errorf(`bounced: %s`, reason))
+}
+
+// recipientDeliveries Returns the delivery states of a recipient, as recorded by the journal (nil if the session has
+// several recipients, and if the address is not one of them).
+func (s *Session) recipientDeliveries(recipient string) Deliveries {
+	if len(s.Recipients) == 0 {
+		return s.Deliveries
+	}
+	if r := s.Recipient(recipient); r != nil {
+		return r.Deliveries
+	}
+	return nil
+}
+
+// allDeliveries Returns the delivery states of all the recipients of the session.
+func (s *Session) allDeliveries() []Deliveries {
+	var result []Deliveries
+
+	if len(s.Recipients) == 0 {
+		return []Deliveries{s.Deliveries}
+	}
+	for _, recipient := range s.Recipients {
+		result = append(result, recipient.Deliveries)
+	}
+	return result
+}
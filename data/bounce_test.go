@@ -0,0 +1,107 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const reportBounce = `From: Mail Delivery System <MAILER-DAEMON@mx.example.com>
+To: sender@example.com
+Subject: Undelivered Mail Returned to Sender
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+The email could not be delivered.
+
+--b1
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.com
+
+Final-Recipient: rfc822; john@example.com
+Action: failed
+Status: 5.1.1
+Diagnostic-Code: smtp; 550 5.1.1 <john@example.com>: Recipient address rejected
+
+--b1
+Content-Type: text/rfc822-headers
+
+From: sender@example.com
+To: john@example.com
+Message-ID: <1234@example.com>
+Subject: Hello
+
+--b1--
+`
+
+func TestParseBounce(t *testing.T) {
+	var err error
+	var bounce *Bounce
+	var crlf = func(text string) []byte { return []byte(strings.ReplaceAll(text, "\n", "\r\n")) }
+
+	bounce, err = ParseBounce(crlf(reportBounce))
+	assert.Nil(t, err)
+	assert.Equal(t, &Bounce{MessageID: "<1234@example.com>", Recipients: []string{"john@example.com"}, Reason: "550 5.1.1 <john@example.com>: Recipient address rejected"}, bounce)
+
+	// The delivery is only delayed.
+	bounce, err = ParseBounce(crlf(strings.Replace(reportBounce, "Action: failed", "Action: delayed", 1)))
+	assert.Nil(t, err)
+	assert.Nil(t, bounce)
+
+	// A notification in plain text.
+	bounce, err = ParseBounce(crlf(`From: Mail Delivery Subsystem <mailer-daemon@googlemail.com>
+X-Failed-Recipients: john@example.com
+Subject: Delivery Status Notification (Failure)
+
+Address not found.
+
+----- Original message -----
+Message-Id: <5678@example.com>
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, &Bounce{MessageID: "<5678@example.com>", Recipients: []string{"john@example.com"}, Reason: "Delivery Status Notification (Failure)"}, bounce)
+
+	// An email that is not a notification.
+	bounce, err = ParseBounce(crlf("From: jane@example.com\nSubject: Hi\n\nMessage-ID: <1234@example.com>\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, bounce)
+	_, err = ParseBounce([]byte("not an email"))
+	assert.NotNil(t, err)
+}
+
+func TestFindBounced(t *testing.T) {
+	var session Session
+	var email *BouncedEmail
+
+	session.Init("key", 0)
+	session.AddBoundary([]byte{1})
+	session.AddBoundary([]byte{2})
+	assert.Nil(t, session.AddRecipient("john@example.com"))
+	assert.Nil(t, session.AddRecipient("jane@example.com"))
+	assert.Nil(t, session.Recipient("john@example.com").Deliveries.SetSent(0, "<1@example.com>"))
+	session.RecordSend("john@example.com", Copies{Cc: "paul@example.com"}, 0, "<1@example.com>", "", 0)
+	assert.Nil(t, session.Recipient("jane@example.com").Deliveries.SetSent(0, "<2@example.com>"))
+	session.RecordSend("jane@example.com", Copies{}, 0, "<2@example.com>", "", 0)
+	assert.Equal(t, []string{"<1@example.com>", "<2@example.com>"}, session.SentMessageIDs())
+
+	// The email sent to Jane bounced.
+	email = session.FindBounced(&Bounce{MessageID: "<2@example.com>"})
+	assert.Equal(t, &BouncedEmail{Recipient: "jane@example.com", Index: 0}, email)
+	assert.Nil(t, session.SetBounced(email, "550 unknown user"))
+	assert.Equal(t, DeliveryFailed, session.Recipient("jane@example.com").Deliveries[0].Status)
+	assert.Equal(t, "bounced: 550 unknown user", session.Recipient("jane@example.com").Deliveries[0].Error)
+	assert.Equal(t, 0, session.Recipient("jane@example.com").Deliveries.Next())
+	// The email is no longer marked as sent.
+	assert.Nil(t, session.FindBounced(&Bounce{MessageID: "<2@example.com>"}))
+	assert.Nil(t, session.FindBounced(&Bounce{MessageID: "<3@example.com>"}))
+
+	// Only the copy of the email sent to John bounced.
+	email = session.FindBounced(&Bounce{MessageID: "<1@example.com>", Recipients: []string{"paul@example.com"}})
+	assert.True(t, email.Copy)
+	email = session.FindBounced(&Bounce{MessageID: "<1@example.com>", Recipients: []string{"JOHN@example.com"}})
+	assert.False(t, email.Copy)
+}
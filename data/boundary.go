@@ -0,0 +1,170 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// BoundaryStyle How the bytes of a boundary are written into the email. Each style mimics the boundaries generated by
+// a common mail client.
+type BoundaryStyle string
+
+// The styles of boundaries.
+const (
+	// BoundaryHex The bytes, in hexadecimal (the default style).
+	BoundaryHex BoundaryStyle = ""
+	// BoundaryThunderbird "------------" followed by alphanumeric characters (Thunderbird).
+	BoundaryThunderbird BoundaryStyle = "thunderbird"
+	// BoundaryOutlook "_000_" followed by uppercase alphanumeric characters, and "_" (Outlook / Exchange).
+	BoundaryOutlook BoundaryStyle = "outlook"
+	// BoundaryPhpMailer "b1=_" followed by alphanumeric characters (PHPMailer, used by many web applications).
+	BoundaryPhpMailer BoundaryStyle = "phpmailer"
+)
+
+// maxBoundaryLength The maximum length of a boundary (RFC 2046).
+const maxBoundaryLength = 70
+
+const alphabet62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+const alphabet36 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// boundaryLayout The layout of a style of boundaries: the bytes are written as a number, in a given alphabet, between
+// a prefix and a suffix.
+type boundaryLayout struct {
+	prefix   string
+	suffix   string
+	alphabet string
+}
+
+var boundaryLayouts = map[BoundaryStyle]boundaryLayout{
+	BoundaryThunderbird: {prefix: "------------", alphabet: alphabet62},
+	BoundaryOutlook:     {prefix: "_000_", suffix: "_", alphabet: alphabet36},
+	BoundaryPhpMailer:   {prefix: "b1=_", alphabet: alphabet62},
+}
+
+// ParseBoundaryStyle Checks the name of a style of boundaries ("hex" is the default style).
+func ParseBoundaryStyle(name string) (BoundaryStyle, error) {
+	var style = BoundaryStyle(strings.ToLower(name))
+
+	if style == "hex" || style == BoundaryHex {
+		return BoundaryHex, nil
+	}
+	if _, ok := boundaryLayouts[style]; !ok {
+		return style, fmt.Errorf(`unknown boundary style "%s" (expected "hex", "%s", "%s" or "%s")`, name, BoundaryThunderbird, BoundaryOutlook, BoundaryPhpMailer)
+	}
+	return style, nil
+}
+
+// Name Returns the name of the style, for the user.
+func (s BoundaryStyle) Name() string {
+	if s == BoundaryHex {
+		return "hex"
+	}
+	return string(s)
+}
+
+// FormatBoundary Writes the bytes of a boundary using a given style. The number of characters depends only on the
+// number of bytes. Since a number of characters can represent more values than the bytes, a random multiple of
+// 2^(8 x number of bytes) is added to the value, so that all the characters (including the first one) look random.
+func FormatBoundary(style BoundaryStyle, boundary []byte) (string, error) {
+	var err error
+	var layout boundaryLayout
+	var ok bool
+	var value *big.Int
+	var modulus *big.Int
+	var capacity *big.Int
+	var offset *big.Int
+	var length int
+	var result string
+
+	if style == BoundaryHex {
+		return hex.EncodeToString(boundary), nil
+	}
+	if layout, ok = boundaryLayouts[style]; !ok {
+		return "", fmt.Errorf(`unknown boundary style "%s"`, style)
+	}
+	length = digitCount(len(boundary), len(layout.alphabet))
+	modulus = new(big.Int).Lsh(big.NewInt(1), uint(8*len(boundary)))
+	capacity = new(big.Int).Exp(big.NewInt(int64(len(layout.alphabet))), big.NewInt(int64(length)), nil)
+	if offset, err = rand.Int(rand.Reader, new(big.Int).Div(capacity, modulus)); err != nil {
+		return "", err
+	}
+	value = new(big.Int).SetBytes(boundary)
+	value.Add(value, offset.Mul(offset, modulus))
+	result = layout.prefix + toDigits(value, layout.alphabet, length) + layout.suffix
+	if len(result) > maxBoundaryLength {
+		return "", fmt.Errorf(`the boundary is too long for the style "%s" (%d bytes)`, style, len(boundary))
+	}
+	return result, nil
+}
+
+// ParseBoundary Extracts the bytes of a boundary found in an email. The style of the boundary is detected.
+func ParseBoundary(boundary string) ([]byte, error) {
+	for _, style := range []BoundaryStyle{BoundaryThunderbird, BoundaryOutlook, BoundaryPhpMailer} {
+		var layout = boundaryLayouts[style]
+		var digits string
+
+		if !strings.HasPrefix(boundary, layout.prefix) || !strings.HasSuffix(boundary, layout.suffix) {
+			continue
+		}
+		digits = strings.TrimSuffix(strings.TrimPrefix(boundary, layout.prefix), layout.suffix)
+		return parseDigits(digits, layout.alphabet)
+	}
+	return hex.DecodeString(boundary)
+}
+
+// parseDigits Extracts the bytes represented by a number written in a given alphabet (see `FormatBoundary`).
+func parseDigits(digits string, alphabet string) ([]byte, error) {
+	var value = new(big.Int)
+	var base = big.NewInt(int64(len(alphabet)))
+	var size int
+
+	for _, c := range digits {
+		var digit = strings.IndexRune(alphabet, c)
+		if digit < 0 {
+			return nil, fmt.Errorf(`invalid character "%c" in the boundary`, c)
+		}
+		value.Mul(value, base).Add(value, big.NewInt(int64(digit)))
+	}
+	// The number of bytes is the one that gives this number of characters.
+	size = 1
+	for digitCount(size, len(alphabet)) < len(digits) {
+		size++
+	}
+	if digitCount(size, len(alphabet)) != len(digits) {
+		return nil, fmt.Errorf(`invalid boundary length (%d characters)`, len(digits))
+	}
+	// Removes the random offset.
+	value.Mod(value, new(big.Int).Lsh(big.NewInt(1), uint(8*size)))
+	return value.FillBytes(make([]byte, size)), nil
+}
+
+// digitCount Returns the number of characters needed to represent any sequence of a given number of bytes, in a given
+// base.
+func digitCount(size int, base int) int {
+	var count int
+	var limit = new(big.Int).Lsh(big.NewInt(1), uint(8*size))
+	var capacity = big.NewInt(1)
+
+	for capacity.Cmp(limit) < 0 {
+		capacity.Mul(capacity, big.NewInt(int64(base)))
+		count++
+	}
+	return count
+}
+
+// toDigits Writes a number in a given alphabet, using a given number of characters.
+func toDigits(value *big.Int, alphabet string, length int) string {
+	var result = make([]byte, length)
+	var base = big.NewInt(int64(len(alphabet)))
+	var digit = new(big.Int)
+	var rest = new(big.Int).Set(value)
+
+	for i := length - 1; i >= 0; i-- {
+		rest.DivMod(rest, base, digit)
+		result[i] = alphabet[digit.Int64()]
+	}
+	return string(result)
+}
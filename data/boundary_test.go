@@ -0,0 +1,95 @@
+package data
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"mime/multipart"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseBoundaryStyle(t *testing.T) {
+	var err error
+	var style BoundaryStyle
+
+	for _, name := range []string{"", "hex", "HEX"} {
+		style, err = ParseBoundaryStyle(name)
+		assert.Nil(t, err)
+		assert.Equal(t, BoundaryHex, style)
+	}
+	style, err = ParseBoundaryStyle("Thunderbird")
+	assert.Nil(t, err)
+	assert.Equal(t, BoundaryThunderbird, style)
+	_, err = ParseBoundaryStyle("mutt")
+	assert.NotNil(t, err)
+	assert.Equal(t, "hex", BoundaryHex.Name())
+	assert.Equal(t, "outlook", BoundaryOutlook.Name())
+}
+
+func TestFormatBoundary(t *testing.T) {
+	var formats = map[BoundaryStyle]*regexp.Regexp{
+		BoundaryHex:         regexp.MustCompile(`^[0-9a-f]{70}$`),
+		BoundaryThunderbird: regexp.MustCompile(`^-{12}[0-9A-Za-z]{48}$`),
+		BoundaryOutlook:     regexp.MustCompile(`^_000_[0-9A-Z]{55}_$`),
+		BoundaryPhpMailer:   regexp.MustCompile(`^b1=_[0-9A-Za-z]{48}$`),
+	}
+	var first = make(map[byte]bool)
+
+	for style, format := range formats {
+		for _, boundary := range [][]byte{make([]byte, 35), bytes.Repeat([]byte{0xff}, 35), []byte("0123456789abcdefghijklmnopqrstuvwxy")} {
+			var err error
+			var formatted string
+			var parsed []byte
+			var writer = multipart.NewWriter(&bytes.Buffer{})
+
+			if formatted, err = FormatBoundary(style, boundary); err != nil {
+				assert.FailNow(t, err.Error())
+			}
+			assert.Regexp(t, format, formatted, style)
+			// The boundary is accepted by the standard library.
+			assert.Nil(t, writer.SetBoundary(formatted), style)
+			parsed, err = ParseBoundary(formatted)
+			assert.Nil(t, err, style)
+			assert.Equal(t, boundary, parsed, style)
+			if style == BoundaryThunderbird {
+				first[formatted[12]] = true
+			}
+		}
+	}
+
+	// The same bytes give different boundaries (with the same length), whose first character varies.
+	for i := 0; i < 50; i++ {
+		var formatted, _ = FormatBoundary(BoundaryThunderbird, make([]byte, 35))
+		first[formatted[12]] = true
+	}
+	assert.Greater(t, len(first), 5)
+
+	// Other lengths (such as the lazy sessions' ones).
+	for size := 1; size <= 40; size++ {
+		var boundary = bytes.Repeat([]byte{byte(size)}, size)
+		var formatted, err = FormatBoundary(BoundaryPhpMailer, boundary)
+		if err != nil {
+			assert.True(t, size > 35, size)
+			continue
+		}
+		parsed, err := ParseBoundary(formatted)
+		assert.Nil(t, err, size)
+		assert.Equal(t, boundary, parsed, size)
+	}
+}
+
+func TestParseBoundary(t *testing.T) {
+	var err error
+
+	_, err = ParseBoundary("------------" + strings.Repeat("-", 48))
+	assert.NotNil(t, err)
+	_, err = ParseBoundary("b1=_" + strings.Repeat("A", 47))
+	assert.NotNil(t, err)
+	_, err = ParseBoundary("zz")
+	assert.NotNil(t, err)
+	parsed, err := ParseBoundary("0a1b")
+	assert.Nil(t, err)
+	assert.Equal(t, "0a1b", hex.EncodeToString(parsed))
+}
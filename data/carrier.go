@@ -0,0 +1,469 @@
+package data
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// CarrierName The name of a part of an email that hides bytes of the chunks of a hidden message (a carrier).
+type CarrierName string
+
+// The carriers.
+const (
+	// CarrierBoundary The boundary of the multipart email (the boundaries of its levels, if it is nested).
+	CarrierBoundary CarrierName = "boundary"
+	// CarrierMessageID The local part of the "Message-ID" header (see `MessageIDPayload`).
+	CarrierMessageID CarrierName = "message-id"
+	// CarrierDate The seconds and the time zone of the "Date" header (see `CarryingDate`).
+	CarrierDate CarrierName = "date"
+	// CarrierSubject The fragments of the "Subject" header, chosen from a keyed codebook (see `Codebook`).
+	CarrierSubject CarrierName = "subject"
+	// CarrierXHeader The custom headers ("X-") added by a persona (see `HeaderPersona`).
+	CarrierXHeader CarrierName = "x-header"
+	// CarrierHeaderOrder The order of the headers (see `OrderHeaders`).
+	CarrierHeaderOrder CarrierName = "header-order"
+	// CarrierBase64Lines The lengths of the lines of the base64 encoded parts (see `base64Lines`).
+	CarrierBase64Lines CarrierName = "base64-lines"
+	// CarrierSoftBreaks The soft line breaks of the quoted-printable encoded part (see `softBreaks`).
+	CarrierSoftBreaks CarrierName = "soft-breaks"
+	// CarrierWhitespace The whitespaces at the end of the lines of the plain text part (see `trailingWhitespace`).
+	CarrierWhitespace CarrierName = "whitespace"
+	// CarrierHtmlAttributes The attributes of the elements of the HTML part (see `HideInHtml`).
+	CarrierHtmlAttributes CarrierName = "html-attributes"
+	// CarrierImage The pixels of the cover image attached to the email (see `HideInImage`).
+	CarrierImage CarrierName = "image"
+)
+
+// BoundaryCarrierLength The number of bytes hidden by the boundary of an email that is not nested.
+const BoundaryCarrierLength = 35
+
+// carrierLimits The number of bytes a carrier hides per email, by default, and at most.
+type carrierLimits struct {
+	length    int
+	maxLength int
+}
+
+var carrierSizes = map[CarrierName]carrierLimits{
+	CarrierMessageID:      {length: messageIDCarrierLength, maxLength: messageIDCarrierMaxLength},
+	CarrierDate:           {length: dateCarrierLength, maxLength: dateCarrierLength},
+	CarrierSubject:        {length: subjectCarrierLength, maxLength: subjectCarrierLength},
+	CarrierXHeader:        {length: xHeaderCarrierLength, maxLength: xHeaderCarrierMaxLength},
+	CarrierHeaderOrder:    {length: headerOrderCarrierLength, maxLength: headerOrderCarrierLength},
+	CarrierBase64Lines:    {length: base64LinesCarrierLength, maxLength: base64LinesCarrierMaxLength},
+	CarrierSoftBreaks:     {length: softBreaksCarrierLength, maxLength: softBreaksCarrierMaxLength},
+	CarrierWhitespace:     {length: whitespaceCarrierLength, maxLength: whitespaceCarrierMaxLength},
+	CarrierHtmlAttributes: {length: htmlAttributesCarrierLength, maxLength: htmlAttributesCarrierMaxLength},
+	CarrierImage:          {length: imageCarrierLength, maxLength: imageCarrierMaxLength},
+}
+
+// Carrier A carrier used by the emails of a session, and the number of bytes it hides per email.
+type Carrier struct {
+	Name   CarrierName `json:"name"`
+	Length int         `json:"length"`
+	// Key The key used by the carrier, if it is keyed (see `NewCodebookKey` for the subject).
+	Key string `json:"key,omitempty"`
+	// Persona The persona whose headers are written, for the custom headers (see `HeaderPersona`).
+	Persona HeaderPersona `json:"persona,omitempty"`
+	// Cover The path to the cover image attached to the emails, for the image (see `CarrierImage`).
+	Cover string `json:"cover,omitempty"`
+}
+
+// String Returns the carrier as given on the command line ("name:length").
+func (c Carrier) String() string {
+	return fmt.Sprintf("%s:%d", c.Name, c.Length)
+}
+
+// Carriers The carriers used by the emails of a session. The chunk of the message hidden by an email is split across
+// the carriers, in their order: the first bytes go to the first carrier, and so on. The receiver extracts the bytes
+// from the carriers in the same order, and joins them.
+type Carriers []Carrier
+
+// DefaultCarriers Returns the carriers used by the emails, unless others are given: the boundary only.
+func DefaultCarriers(nested bool) Carriers {
+	return Carriers{{Name: CarrierBoundary, Length: boundaryCarrierLength(nested)}}
+}
+
+// ParseCarriers Parses a list of carriers, separated by commas ("boundary,message-id:6"): each carrier is given by its
+// name, optionally followed by the number of bytes it hides per email (its default length otherwise). The length of
+// the boundary depends on the nesting of the emails (see `BuildNested`): it cannot be given.
+func ParseCarriers(spec string, nested bool) (Carriers, error) {
+	var err error
+	var carriers Carriers
+
+	for _, item := range strings.Split(spec, ",") {
+		var carrier Carrier
+		var name, length string
+		var limits carrierLimits
+		var ok bool
+
+		name, length, _ = strings.Cut(strings.TrimSpace(item), ":")
+		carrier.Name = CarrierName(strings.ToLower(name))
+		if carrier.Name == CarrierBoundary {
+			carrier.Length = boundaryCarrierLength(nested)
+			if len(length) > 0 && length != strconv.Itoa(carrier.Length) {
+				return nil, fmt.Errorf(`invalid carrier "%s": the boundary hides %d bytes per email`, item, carrier.Length)
+			}
+			carriers = append(carriers, carrier)
+			continue
+		}
+		if limits, ok = carrierSizes[carrier.Name]; !ok {
+			return nil, fmt.Errorf(`unknown carrier "%s" (expected one of: %s)`, name, strings.Join(CarrierNames(), ", "))
+		}
+		carrier.Length = limits.length
+		if len(length) > 0 {
+			if carrier.Length, err = strconv.Atoi(length); err != nil {
+				return nil, fmt.Errorf(`invalid carrier "%s": invalid number of bytes`, item)
+			}
+		}
+		carriers = append(carriers, carrier)
+	}
+	if err = carriers.Validate(); err != nil {
+		return nil, err
+	}
+	return carriers, nil
+}
+
+// CarrierNames Returns the names of the carriers.
+func CarrierNames() []string {
+	return []string{string(CarrierBoundary), string(CarrierMessageID), string(CarrierDate), string(CarrierSubject), string(CarrierXHeader),
+		string(CarrierHeaderOrder), string(CarrierBase64Lines),
+		string(CarrierSoftBreaks), string(CarrierWhitespace),
+		string(CarrierHtmlAttributes), string(CarrierImage)}
+}
+
+// String Returns the carriers as given on the command line (see `ParseCarriers`).
+func (c Carriers) String() string {
+	var items []string
+
+	for _, carrier := range c {
+		items = append(items, carrier.String())
+	}
+	return strings.Join(items, ",")
+}
+
+// Validate Checks the carriers: each carrier is used once, and hides a number of bytes within its limits.
+func (c Carriers) Validate() error {
+	var seen = map[CarrierName]bool{}
+
+	if len(c) == 0 {
+		return fmt.Errorf(`no carrier is given`)
+	}
+	for _, carrier := range c {
+		if seen[carrier.Name] {
+			return fmt.Errorf(`the carrier "%s" is given more than once`, carrier.Name)
+		}
+		seen[carrier.Name] = true
+		if carrier.Name == CarrierBoundary {
+			if carrier.Length != boundaryCarrierLength(false) && carrier.Length != boundaryCarrierLength(true) {
+				return fmt.Errorf(`invalid carrier "%s": the boundary hides %d or %d bytes per email`, carrier, boundaryCarrierLength(false), boundaryCarrierLength(true))
+			}
+			continue
+		}
+		if limits, ok := carrierSizes[carrier.Name]; !ok {
+			return fmt.Errorf(`unknown carrier "%s"`, carrier.Name)
+		} else if carrier.Length < 1 || carrier.Length > limits.maxLength {
+			return fmt.Errorf(`invalid carrier "%s": it hides from 1 to %d bytes per email`, carrier, limits.maxLength)
+		}
+	}
+	return nil
+}
+
+// Length Returns the number of bytes hidden per email: the length of the chunks of the message.
+func (c Carriers) Length() int {
+	var length int
+
+	for _, carrier := range c {
+		length += carrier.Length
+	}
+	return length
+}
+
+// IsKeyed Tells whether the carrier needs a key (see `Carrier.Key`).
+func (c Carrier) IsKeyed() bool {
+	return c.Name == CarrierSubject
+}
+
+// SetKey Sets the key of the keyed carriers (see `Carrier.IsKeyed`).
+func (c Carriers) SetKey(key string) {
+	for i := range c {
+		if c[i].IsKeyed() {
+			c[i].Key = key
+		}
+	}
+}
+
+// SetPersona Sets the persona of the custom headers (see `CarrierXHeader`), if they are used.
+func (c Carriers) SetPersona(persona HeaderPersona) {
+	for i := range c {
+		if c[i].Name == CarrierXHeader {
+			c[i].Persona = persona
+		}
+	}
+}
+
+// SetCover Sets the path to the cover image attached to the emails (see `CarrierImage`), if it is used.
+func (c Carriers) SetCover(path string) {
+	for i := range c {
+		if c[i].Name == CarrierImage {
+			c[i].Cover = path
+		}
+	}
+}
+
+// CheckCover Checks that the cover image (if used) can hide the bytes of its carrier, given the content of its file
+// (see `ImageCapacity`).
+func (c Carriers) CheckCover(content []byte) error {
+	var err error
+	var capacity int
+
+	if carrier, ok := c.Get(CarrierImage); ok {
+		if _, capacity, err = ImageCapacity(content); err != nil {
+			return fmt.Errorf(`invalid cover image "%s": %s`, carrier.Cover, err.Error())
+		}
+		if carrier.Length > capacity {
+			return fmt.Errorf(`the cover image "%s" hides up to %d bytes (the carrier "%s" hides %d bytes)`, carrier.Cover, capacity, carrier.Name, carrier.Length)
+		}
+	}
+	return nil
+}
+
+// CheckNesting Checks that the emails, nested or not (see `BuildNested`), can hide the bytes of the carriers: the cover
+// image is only attached to the nested emails.
+func (c Carriers) CheckNesting(nested bool) error {
+	if carrier, ok := c.Get(CarrierImage); ok {
+		if !nested {
+			return fmt.Errorf(`the carrier "%s" needs nested emails (the image is attached to the "multipart/mixed" level)`, carrier.Name)
+		}
+		if len(carrier.Cover) == 0 {
+			return fmt.Errorf(`the carrier "%s" has no cover image`, carrier.Name)
+		}
+	}
+	return nil
+}
+
+// CheckPersona Checks that the custom headers (if used) can hide their bytes (see `HeaderPersona.Capacity`).
+func (c Carriers) CheckPersona() error {
+	var err error
+
+	if carrier, ok := c.Get(CarrierXHeader); ok {
+		if _, err = ParseHeaderPersona(string(carrier.Persona)); err != nil || len(carrier.Persona) == 0 {
+			return fmt.Errorf(`the carrier "%s" has no valid persona`, carrier.Name)
+		}
+		if carrier.Length > carrier.Persona.Capacity() {
+			return fmt.Errorf(`the headers of the persona "%s" hide up to %d bytes (the carrier "%s" hides %d bytes)`, carrier.Persona, carrier.Persona.Capacity(), carrier.Name, carrier.Length)
+		}
+	}
+	return nil
+}
+
+// IsKeyed Tells whether one of the carriers needs a key (see `Carrier.IsKeyed`).
+func (c Carriers) IsKeyed() bool {
+	for _, carrier := range c {
+		if carrier.IsKeyed() {
+			return true
+		}
+	}
+	return false
+}
+
+// Get Returns a carrier, and false if it is not used.
+func (c Carriers) Get(name CarrierName) (Carrier, bool) {
+	for _, carrier := range c {
+		if carrier.Name == name {
+			return carrier, true
+		}
+	}
+	return Carrier{}, false
+}
+
+// KeepsDates Tells whether the "Date" headers of the emails are the dates they were sent, so that the emails can be
+// ordered by them (see `SentOrder`). The date carrier rewrites the seconds of the dates: their order is the one of the
+// bytes they hide.
+func (c Carriers) KeepsDates() bool {
+	var ok bool
+
+	_, ok = c.Get(CarrierDate)
+	return !ok
+}
+
+// Split Splits a chunk of the message into the bytes hidden by each carrier.
+func (c Carriers) Split(chunk []byte) (map[CarrierName][]byte, error) {
+	var parts = map[CarrierName][]byte{}
+	var offset int
+
+	if len(chunk) != c.Length() {
+		return nil, fmt.Errorf(`the chunk contains %d bytes, but the carriers (%s) hide %d bytes`, len(chunk), c.String(), c.Length())
+	}
+	for _, carrier := range c {
+		parts[carrier.Name] = chunk[offset : offset+carrier.Length]
+		offset += carrier.Length
+	}
+	return parts, nil
+}
+
+// CheckClient Checks that the emails written as by a mail client can hide the bytes of the carriers (see
+// `MailClient.MessageIDCapacity`).
+func (c Carriers) CheckClient(client MailClient) error {
+	if carrier, ok := c.Get(CarrierMessageID); ok && carrier.Length > client.MessageIDCapacity() {
+		return fmt.Errorf(`the message IDs of the mail client "%s" hide up to %d bytes (the carrier "%s" hides %d bytes)`, client.Name(), client.MessageIDCapacity(), carrier.Name, carrier.Length)
+	}
+	return nil
+}
+
+// CheckTextEncoding Checks that the plain text part of the emails, written in a given encoding (see
+// `CheckTextEncoding`), can hide the bytes of the carriers: the soft line breaks need quoted-printable.
+func (c Carriers) CheckTextEncoding(encoding string) error {
+	if carrier, ok := c.Get(CarrierSoftBreaks); ok && encoding != TextEncodingQuotedPrintable {
+		return fmt.Errorf(`the carrier "%s" needs the plain text part of the emails to be encoded in %s`, carrier.Name, TextEncodingQuotedPrintable)
+	}
+	return nil
+}
+
+// ForNesting Returns a copy of the carriers used by emails nested or not (see `BuildNested`): the number of bytes hidden
+// by the boundary is adapted.
+func (c Carriers) ForNesting(nested bool) Carriers {
+	var carriers = make(Carriers, len(c))
+
+	copy(carriers, c)
+	for i := range carriers {
+		if carriers[i].Name == CarrierBoundary {
+			carriers[i].Length = boundaryCarrierLength(nested)
+		}
+	}
+	return carriers
+}
+
+// Extract Extracts the bytes hidden by a carrier of an email (RFC 5322), other than the boundary (see
+// `NestedBoundaries`).
+func (c Carrier) Extract(content []byte) ([]byte, error) {
+	var err error
+	var message *mail.Message
+	var header mail.Header
+
+	if message, err = mail.ReadMessage(bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	header = message.Header
+	switch c.Name {
+	case CarrierMessageID:
+		return MessageIDPayload(header.Get("Message-ID"), c.Length)
+	case CarrierDate:
+		return DatePayload(header.Get("Date"), c.Length)
+	case CarrierSubject:
+		var codebook Codebook
+		if codebook, err = NewCodebook(c.Key); err != nil {
+			return nil, err
+		}
+		return codebook.Payload(header.Get("Subject"), c.Length)
+	case CarrierXHeader:
+		return XHeaderPayload(header, c.Length)
+	case CarrierHeaderOrder:
+		return HeaderOrderPayload(content, c.Length)
+	case CarrierBase64Lines:
+		return Base64LinesPayload(content, c.Length)
+	case CarrierSoftBreaks:
+		return SoftBreaksPayload(content, c.Length)
+	case CarrierWhitespace:
+		return WhitespacePayload(content, c.Length)
+	case CarrierHtmlAttributes:
+		return HtmlAttributesPayload(content, c.Length)
+	case CarrierImage:
+		return ImagePayload(content, c.Length)
+	}
+	return nil, fmt.Errorf(`the bytes hidden by the carrier "%s" cannot be extracted from the email`, c.Name)
+}
+
+// EmailBoundaries Returns the boundaries of an email (RFC 5322), from the outermost to the innermost (see
+// `NestedBoundaries`), or nil if the email has no boundary. If the body cannot be parsed, then only the boundary given
+// by the "Content-Type" header is returned.
+// If the carriers are given, then the bytes they hide are returned as hexadecimal boundaries, in the order of the
+// carriers (the boundaries of the email are omitted if the boundary is not a carrier), and nil if the email does not
+// hide them.
+func (c Carriers) EmailBoundaries(content []byte) ([]string, error) {
+	var err error
+	var message *mail.Message
+	var boundary *string
+	var levels []string
+	var boundaries []string
+
+	if message, err = mail.ReadMessage(bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	if boundary, err = HeaderBoundary(message.Header); err != nil || boundary == nil {
+		return nil, err
+	}
+	if levels, err = NestedBoundaries(message.Header.Get("Content-Type"), message.Body); err != nil || len(levels) == 0 {
+		levels = []string{*boundary}
+	}
+	if len(c) == 0 {
+		return levels, nil
+	}
+	for _, carrier := range c {
+		var payload []byte
+		if carrier.Name == CarrierBoundary {
+			boundaries = append(boundaries, levels...)
+			continue
+		}
+		if payload, err = carrier.Extract(content); err != nil {
+			return nil, nil
+		}
+		boundaries = append(boundaries, hex.EncodeToString(payload))
+	}
+	return boundaries, nil
+}
+
+// boundaryCarrierLength Returns the number of bytes hidden by the boundaries of an email.
+func boundaryCarrierLength(nested bool) int {
+	if nested {
+		return BoundaryCarrierLength * NestingDepth
+	}
+	return BoundaryCarrierLength
+}
+
+// validateCarriers Checks the carriers of a session: they hide the chunks of the message (the boundaries), and the
+// boundary (if used) hides the bytes of the levels of the emails.
+func (s *Session) validateCarriers() error {
+	var err error
+
+	if err = s.Carriers.Validate(); err != nil {
+		return fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	if length := s.chunkLength(); length > 0 && length != s.Carriers.Length() {
+		return fmt.Errorf(`invalid session: the boundaries contain %d bytes, but the carriers (%s) hide %d bytes`, length, s.Carriers.String(), s.Carriers.Length())
+	}
+	if carrier, ok := s.Carriers.Get(CarrierBoundary); ok && carrier.Length != boundaryCarrierLength(s.Nested) {
+		return fmt.Errorf(`invalid session: the boundary hides %d bytes per email (expected %d)`, carrier.Length, boundaryCarrierLength(s.Nested))
+	}
+	if err = s.Carriers.CheckClient(s.Client); err != nil {
+		return fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	if err = s.Carriers.CheckPersona(); err != nil {
+		return fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	if err = s.Carriers.CheckTextEncoding(s.TextEncoding); err != nil {
+		return fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	if err = s.Carriers.CheckNesting(s.Nested); err != nil {
+		return fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	for _, carrier := range s.Carriers {
+		if carrier.IsKeyed() {
+			if _, err = NewCodebook(carrier.Key); err != nil {
+				return fmt.Errorf(`invalid session: the carrier "%s" has an %s`, carrier.Name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// chunkLength Returns the length of the chunks of the message (the boundaries), or 0 if it is not known yet.
+func (s *Session) chunkLength() int {
+	if !s.Lazy && len(s.Boundaries) > 0 {
+		return len(s.Boundaries[0])
+	}
+	return s.BoundaryLength
+}
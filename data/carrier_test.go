@@ -0,0 +1,140 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseCarriers(t *testing.T) {
+	var err error
+	var carriers Carriers
+
+	carriers, err = ParseCarriers("boundary, Message-ID", false)
+	assert.Nil(t, err)
+	assert.Equal(t, Carriers{{Name: CarrierBoundary, Length: 35}, {Name: CarrierMessageID, Length: 6}}, carriers)
+	assert.Equal(t, "boundary:35,message-id:6", carriers.String())
+	assert.Equal(t, 41, carriers.Length())
+
+	carriers, err = ParseCarriers("message-id:10,boundary", true)
+	assert.Nil(t, err)
+	assert.Equal(t, Carriers{{Name: CarrierMessageID, Length: 10}, {Name: CarrierBoundary, Length: 105}}, carriers)
+	assert.Equal(t, Carriers{{Name: CarrierMessageID, Length: 10}, {Name: CarrierBoundary, Length: 35}}, carriers.ForNesting(false))
+	assert.Equal(t, 105, carriers[1].Length)
+	assert.Equal(t, DefaultCarriers(true), Carriers{{Name: CarrierBoundary, Length: 105}})
+
+	carriers, err = ParseCarriers("message-id:4", false)
+	assert.Nil(t, err)
+	_, ok := carriers.Get(CarrierBoundary)
+	assert.False(t, ok)
+
+	// We'll get errors...
+	for _, spec := range []string{"", "boundary,boundary", "signature", "message-id:0", "message-id:11", "message-id:x", "boundary:12"} {
+		_, err = ParseCarriers(spec, false)
+		assert.NotNil(t, err, spec)
+	}
+	assert.NotNil(t, Carriers{{Name: CarrierMessageID, Length: 10}}.CheckClient(ClientOutlook))
+	assert.Nil(t, Carriers{{Name: CarrierMessageID, Length: 6}}.CheckClient(ClientOutlook))
+}
+
+func TestCarriersSplit(t *testing.T) {
+	var err error
+	var parts map[CarrierName][]byte
+	var carriers = Carriers{{Name: CarrierMessageID, Length: 2}, {Name: CarrierBoundary, Length: 35}}
+	var chunk = make([]byte, 37)
+	var id string
+	var extracted []byte
+
+	for i := range chunk {
+		chunk[i] = byte(i)
+	}
+	parts, err = carriers.Split(chunk)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1}, parts[CarrierMessageID])
+	assert.Equal(t, chunk[2:], parts[CarrierBoundary])
+	_, err = carriers.Split(chunk[1:])
+	assert.NotNil(t, err)
+
+	// The receiver extracts the bytes from the email.
+	id, err = ClientThunderbird.NewCarryingMessageID("john@example.com", "", parts[CarrierMessageID])
+	assert.Nil(t, err)
+	extracted, err = carriers[0].Extract([]byte("Message-ID: " + id + "\r\n\r\nHello"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1}, extracted)
+	_, err = carriers[1].Extract([]byte("Message-ID: " + id + "\r\n\r\nHello"))
+	assert.NotNil(t, err)
+}
+
+func TestSessionCarriers(t *testing.T) {
+	var session Session
+
+	session.Init("key", 0)
+	session.AddBoundary(make([]byte, 41))
+	session.Carriers = Carriers{{Name: CarrierBoundary, Length: 35}, {Name: CarrierMessageID, Length: 6}}
+	assert.Nil(t, session.validate())
+
+	// We'll get errors...
+	session.Nested = true
+	assert.NotNil(t, session.validate())
+	session.Nested = false
+	session.Client = ClientOutlook
+	session.Carriers[1].Length = 7
+	session.Boundaries[0] = make([]byte, 42)
+	assert.NotNil(t, session.validate())
+	session.Client = ClientDefault
+	assert.Nil(t, session.validate())
+	session.Boundaries[0] = make([]byte, 41)
+	assert.NotNil(t, session.validate())
+
+	// The subject is keyed.
+	session.Carriers = Carriers{{Name: CarrierBoundary, Length: 35}, {Name: CarrierSubject, Length: 2}}
+	session.Boundaries[0] = make([]byte, 37)
+	assert.True(t, session.Carriers.IsKeyed())
+	assert.NotNil(t, session.validate())
+	session.Carriers.SetKey(strings.Repeat("ab", CodebookKeyLength))
+	assert.Equal(t, "", session.Carriers[0].Key)
+	assert.Nil(t, session.validate())
+}
+
+func TestCarriersEmailBoundaries(t *testing.T) {
+	var err error
+	var levels = []string{strings.Repeat("0a", 35), strings.Repeat("0b", 35), strings.Repeat("0c", 35)}
+	var content []byte
+	var id string
+	var nested []byte
+	var plain []byte
+	var found []string
+
+	content, err = BuildNested(levels, []byte("Hello"), []byte("<p>Hello</p>"), "", "", BodyPayloads{})
+	assert.Nil(t, err)
+	id, err = ClientThunderbird.NewCarryingMessageID("john@example.com", "", []byte{0x01, 0x02})
+	assert.Nil(t, err)
+	nested = append([]byte("Message-ID: "+id+"\r\nContent-Type: multipart/mixed; boundary=\""+levels[0]+"\"\r\n\r\n"), content...)
+	plain = []byte("Message-ID: " + id + "\r\nContent-Type: text/plain\r\n\r\nHello")
+
+	for _, test := range []struct {
+		carriers Carriers
+		content  []byte
+		expected []string
+	}{
+		// The boundaries of all the levels of a nested email.
+		{carriers: nil, content: nested, expected: levels},
+		{carriers: Carriers{{Name: CarrierMessageID, Length: 2}, {Name: CarrierBoundary, Length: 105}}, content: nested, expected: append([]string{"0102"}, levels...)},
+		{carriers: Carriers{{Name: CarrierMessageID, Length: 2}}, content: nested, expected: []string{"0102"}},
+		// The body cannot be parsed: the boundary of the header only.
+		{carriers: nil, content: []byte("Content-Type: multipart/mixed; boundary=\"" + levels[0] + "\"\r\n\r\nHello"), expected: levels[:1]},
+		// No boundary: the email does not hide anything.
+		{carriers: nil, content: plain, expected: nil},
+		{carriers: Carriers{{Name: CarrierMessageID, Length: 2}}, content: plain, expected: nil},
+		// The carrier is missing.
+		{carriers: Carriers{{Name: CarrierDate, Length: 2}}, content: nested, expected: nil},
+	} {
+		found, err = test.carriers.EmailBoundaries(test.content)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, found, test.carriers.String())
+	}
+
+	// We'll get an error...
+	_, err = Carriers(nil).EmailBoundaries([]byte("not an email"))
+	assert.NotNil(t, err)
+}
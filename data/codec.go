@@ -0,0 +1,165 @@
+package data
+
+import (
+	"fmt"
+	"umail/resource"
+)
+
+// messageLengthTypeLength The size, in bytes, of the length that prefixes the hidden message ("uint16").
+const messageLengthTypeLength = 2
+
+// Cypher XORs two lists of bytes of the same length.
+func Cypher(b1 []byte, b2 []byte) ([]byte, error) {
+	var result []byte
+	if len(b1) != len(b2) {
+		return nil, fmt.Errorf(`cannot cypher a list of %d bytes with a list of %d bytes: different lengths`, len(b1), len(b2))
+	}
+	for i, v := range b1 {
+		result = append(result, v^b2[i])
+	}
+	return result, nil
+}
+
+// Encode Encrypts the chunks of the message using key material extracted from a given key source.
+// Each returned (encrypted) chunk is a boundary.
+func (m *Message) Encode(key resource.KeySource) ([][]byte, error) {
+	var err error
+	var boundaries [][]byte
+
+	// `message XOR key` for each `message`
+	// c: a chunk of the message (to hide)
+	// k: a chunk of the key (extracted lazily, one chunk at a time)
+	for _, c := range *m {
+		var k []byte
+		var boundary []byte
+		if k, err = key.Read(int64(len(c))); err != nil {
+			return nil, err
+		}
+		if boundary, err = Cypher(c, k); err != nil {
+			return nil, err
+		}
+		boundaries = append(boundaries, boundary)
+	}
+	return boundaries, nil
+}
+
+// Decode Decrypts a list of boundaries using key material read from a given key source, and returns the hidden
+// message. If the message is authenticated (format 3), then its MAC is checked: `ErrNotAuthentic` is returned if it
+// does not match.
+// Please note that the key material is *NOT* consumed: the position pointer is not moved. Thus, the same boundaries
+// can be decoded several times.
+func Decode(boundaries [][]byte, key resource.KeySource) ([]byte, error) {
+	var message []byte
+	var err error
+
+	message, _, err = DecodeAuthenticated(boundaries, key)
+	return message, err
+}
+
+// DecodeAuthenticated Same as `Decode`, but it also tells whether the message is authenticated (format 3, the MAC
+// matches), or not (the message has no MAC).
+func DecodeAuthenticated(boundaries [][]byte, key resource.KeySource) ([]byte, bool, error) {
+	var err error
+	var clearMessage []byte
+	var authenticated bool
+
+	clearMessage, authenticated, _, err = DecodeExtent(boundaries, key)
+	return clearMessage, authenticated, err
+}
+
+// CheckAuthenticated Checks that a decoded message is authenticated (see `DecodeAuthenticated`) if the MAC is required.
+// The format of the envelope is not covered by the MAC: anyone can turn an authenticated message into a message
+// without MAC, by flipping the bits of its format. Thus, a message without MAC must be rejected (`ErrMissingMac`) if
+// the sender is known to authenticate its messages.
+func CheckAuthenticated(authenticated bool, required bool) error {
+	if required && !authenticated {
+		return ErrMissingMac
+	}
+	return nil
+}
+
+// DecodeExtent Same as `DecodeAuthenticated`, but it also returns the position of the key material that follows the
+// message (the key material used by the MAC included): the position of the key material of the next message.
+func DecodeExtent(boundaries [][]byte, key resource.KeySource) ([]byte, bool, int64, error) {
+	var err error
+	var clearMessage []byte
+	var macKey []byte
+	var format MessageFormat
+	var position int64
+
+	// The boundaries of a sequenced message may be given in any order.
+	if clearMessage, position, err = decodeSequenced(boundaries, key); err != nil {
+		return nil, false, 0, err
+	}
+	if clearMessage == nil {
+		if clearMessage, position, err = decodeSequential(boundaries, key); err != nil {
+			return nil, false, 0, err
+		}
+		if len(boundaries) > 0 {
+			if err = checkComplete(clearMessage, len(boundaries), len(boundaries[0])); err != nil {
+				return nil, false, 0, err
+			}
+		}
+	}
+
+	// The key material used by the MAC (if any) follows the one used by the boundaries. It may not be available.
+	macKey, _ = key.ReadAt(position, MacKeyLength)
+	if clearMessage, format, err = openEnvelope(clearMessage, macKey); err != nil {
+		return nil, false, 0, err
+	}
+	if format == MessageFormatV3 {
+		position += MacKeyLength
+	}
+	return clearMessage, format == MessageFormatV3, position, nil
+}
+
+// decodeSequential Decrypts a list of boundaries (given in the order of the chunks) using key material read from a
+// given key source (from its current position). It returns the decoded chunks (as a single list of bytes), and the
+// position of the key material that follows the message.
+func decodeSequential(boundaries [][]byte, key resource.KeySource) ([]byte, int64, error) {
+	var err error
+	var chunk []byte
+	var clearMessage []byte
+	var position = key.Position()
+
+	for _, boundary := range boundaries {
+		var clearChunk []byte
+		if chunk, err = key.ReadAt(position, int64(len(boundary))); err != nil {
+			return nil, 0, err
+		}
+		if clearChunk, err = Cypher(chunk, boundary); err != nil {
+			return nil, 0, err
+		}
+		clearMessage = append(clearMessage, clearChunk...)
+		position += int64(len(boundary))
+	}
+	return clearMessage, position, nil
+}
+
+// EncodeMessage Organizes a message into chunks of `chunkSize` bytes (using a given encoding), and encrypts the chunks
+// using key material extracted from a given key source. For an authenticated message, the key material used by the MAC
+// (`MacKeyLength` bytes) follows the one used by the boundaries: it is also consumed.
+func EncodeMessage(raw []byte, chunkSize int, key resource.KeySource, encoding Encoding) ([][]byte, error) {
+	var err error
+	var message Message
+	var macKey []byte
+	var boundaries [][]byte
+
+	if encoding.Authenticated {
+		if macKey, err = key.ReadAt(key.Position()+encoding.MaterialLength(len(raw), chunkSize), MacKeyLength); err != nil {
+			return nil, err
+		}
+	}
+	if err = message.Build(raw, chunkSize, encoding, macKey); err != nil {
+		return nil, err
+	}
+	if boundaries, err = message.Encode(key); err != nil {
+		return nil, err
+	}
+	if encoding.Authenticated {
+		if err = key.Consume(MacKeyLength); err != nil {
+			return nil, err
+		}
+	}
+	return boundaries, nil
+}
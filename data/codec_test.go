@@ -0,0 +1,161 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"umail/resource"
+)
+
+func TestCypher(t *testing.T) {
+	var err error
+	var result []byte
+
+	result, err = Cypher([]byte{0x01, 0x0F, 0xF0}, []byte{0x02, 0x0F, 0x0F})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x03, 0x00, 0xFF}, result)
+
+	// We'll get an error...
+	_, err = Cypher([]byte{0x01, 0x0F}, []byte{0x02})
+	assert.NotNil(t, err)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	var err error
+	var m Message
+	var pad []byte
+	var key *resource.MemoryPool
+	var boundaries [][]byte
+	var message []byte
+	var secret = []byte("This is the secret message!\nYou cannot detect it.\nYou cannot read it!")
+
+	for i := 0; i < 256; i++ {
+		pad = append(pad, byte(i))
+	}
+
+	err = m.FromBytes(secret, chunkSize)
+	assert.Nil(t, err)
+
+	// Encode the message.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	boundaries, err = m.Encode(key)
+	assert.Nil(t, err)
+	assert.Len(t, boundaries, m.BoundariesCount())
+	assert.Equal(t, int64(10+chunkSize*m.BoundariesCount()), key.Position())
+	for _, b := range boundaries {
+		assert.Len(t, b, chunkSize)
+	}
+
+	// Decode the message (using a copy of the key).
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	message, err = Decode(boundaries, key)
+	assert.Nil(t, err)
+	assert.Equal(t, secret, message)
+
+	// The key has not been consumed: the message can be decoded again.
+	assert.Equal(t, int64(10), key.Position())
+	message, err = Decode(boundaries, key)
+	assert.Nil(t, err)
+	assert.Equal(t, secret, message)
+
+	// A boundary has been truncated.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	_, err = Decode([][]byte{{0x01}}, key)
+	assert.NotNil(t, err)
+
+	// Not enough key material left.
+	key, err = resource.NewMemoryPool(pad, 250)
+	assert.Nil(t, err)
+	_, err = m.Encode(key)
+	assert.NotNil(t, err)
+}
+
+func TestEncodeDecodeAuthenticated(t *testing.T) {
+	var err error
+	var pad []byte
+	var key *resource.MemoryPool
+	var boundaries [][]byte
+	var message []byte
+	var authenticated bool
+	var end int64
+	var m Message
+	var secret = []byte("This is the secret message!\nYou cannot detect it.\nYou cannot read it!")
+
+	for i := 0; i < 256; i++ {
+		pad = append(pad, byte(i))
+	}
+
+	// Encode the message: the key material used by the MAC is consumed.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	boundaries, err = EncodeMessage(secret, chunkSize, key, Encoding{Authenticated: true})
+	assert.Nil(t, err)
+	assert.Equal(t, Encoding{Authenticated: true}.MaterialLength(len(secret), chunkSize), int64(len(boundaries)*chunkSize))
+	assert.Equal(t, int64(10+len(boundaries)*chunkSize+MacKeyLength), key.Position())
+
+	// Decode the message.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	message, authenticated, err = DecodeAuthenticated(boundaries, key)
+	assert.Nil(t, err)
+	assert.True(t, authenticated)
+	assert.Equal(t, secret, message)
+
+	// The key material of the next message follows the one used by the MAC.
+	message, authenticated, end, err = DecodeExtent(boundaries, key)
+	assert.Nil(t, err)
+	assert.True(t, authenticated)
+	assert.Equal(t, secret, message)
+	assert.Equal(t, int64(10+len(boundaries)*chunkSize+MacKeyLength), end)
+	assert.Equal(t, int64(10), key.Position())
+
+	// A message without MAC.
+	err = m.FromBytes(secret, chunkSize)
+	assert.Nil(t, err)
+	key, err = resource.NewMemoryPool(make([]byte, 256), 0)
+	assert.Nil(t, err)
+	message, authenticated, err = DecodeAuthenticated(m, key)
+	assert.Nil(t, err)
+	assert.False(t, authenticated)
+	assert.Equal(t, secret, message)
+	_, _, end, err = DecodeExtent(m, key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(m)*chunkSize), end)
+
+	// A flipped bit is detected.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	boundaries[1][3] ^= 0x01
+	_, err = Decode(boundaries, key)
+	assert.ErrorIs(t, err, ErrNotAuthentic)
+	boundaries[1][3] ^= 0x01
+
+	// The key material used by the MAC is missing.
+	key, err = resource.NewMemoryPool(pad[:10+len(boundaries)*chunkSize], 10)
+	assert.Nil(t, err)
+	_, err = Decode(boundaries, key)
+	assert.ErrorIs(t, err, ErrNotAuthentic)
+
+	// The format is flipped: the message is decoded as a message without MAC, which is rejected if the MAC is required.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	boundaries[0][0] ^= 7
+	message, authenticated, err = DecodeAuthenticated(boundaries, key)
+	assert.Nil(t, err)
+	assert.False(t, authenticated)
+	assert.NotEqual(t, secret, message)
+	assert.ErrorIs(t, CheckAuthenticated(authenticated, true), ErrMissingMac)
+	assert.ErrorIs(t, CheckAuthenticated(authenticated, true), ErrNotAuthentic)
+	assert.Nil(t, CheckAuthenticated(authenticated, false))
+	assert.Nil(t, CheckAuthenticated(true, true))
+	boundaries[0][0] ^= 7
+
+	// Not enough key material left.
+	key, err = resource.NewMemoryPool(pad, 200)
+	assert.Nil(t, err)
+	_, err = EncodeMessage(secret, chunkSize, key, Encoding{Authenticated: true})
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(200), key.Position())
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"fmt"
+	"umail/resource"
+)
+
+// Inconsistencies Cross-checks a session against its key, and returns the list of everything that is inconsistent
+// (the list is empty if the session is consistent):
+// - the key material used by the session (boundaries and MAC) is within the key.
+// - the position of the key is beyond the key material used by the session (otherwise, the key material may be
+// used again).
+// - all the boundaries have the expected length.
+// If the original message is given, then the boundaries must be the chunks of the message XORed with the key material
+// (and the hash of the message must match). Otherwise, the boundaries are decoded and checked against the hash of the
+// message (see `Verify`).
+// Please note that the key material is *NOT* consumed.
+func (s *Session) Inconsistencies(key resource.KeySource, plainMessage []byte) []string {
+	var err error
+	var issues []string
+	var keyLength int64
+	var chunks Message
+	var macKey []byte
+	var expectedLength = s.BoundaryLength
+	var end = s.PoolPointerPosition
+
+	if keyLength, err = key.Length(); err != nil {
+		return []string{fmt.Sprintf(`cannot get the length of the key: %s`, err.Error())}
+	}
+	if !s.Lazy && len(s.Boundaries) > 0 {
+		expectedLength = len(s.Boundaries[0])
+	}
+
+	// The key material used by the boundaries.
+	for i, boundary := range s.Boundaries {
+		var position = s.boundaryPosition(i)
+		if s.Lazy && !s.IsAllocated(i) {
+			continue
+		}
+		if len(boundary) != expectedLength {
+			issues = append(issues, fmt.Sprintf(`boundary %d contains %d bytes (expected %d)`, i, len(boundary), expectedLength))
+		}
+		if position+int64(len(boundary)) > keyLength {
+			issues = append(issues, fmt.Sprintf(`boundary %d uses the key material from position %d to %d, beyond the end of the key (%d bytes)`, i, position, position+int64(len(boundary)), keyLength))
+		}
+		if position+int64(len(boundary)) > end {
+			end = position + int64(len(boundary))
+		}
+	}
+	if s.Authenticated {
+		// The key material used by the MAC follows the one used by the boundaries.
+		end += MacKeyLength
+		if end > keyLength {
+			issues = append(issues, fmt.Sprintf(`the key material used by the MAC (from position %d to %d) is beyond the end of the key (%d bytes)`, end-MacKeyLength, end, keyLength))
+		}
+	}
+	if s.PoolPointerPosition > keyLength {
+		issues = append(issues, fmt.Sprintf(`the position of the session (%d) is beyond the end of the key (%d bytes)`, s.PoolPointerPosition, keyLength))
+	}
+	if key.Position() < end {
+		issues = append(issues, fmt.Sprintf(`the position of the key (%d) is before the end of the key material used by the session (%d): this key material may be used again`, key.Position(), end))
+	}
+
+	// The content of the boundaries.
+	if plainMessage == nil {
+		if err = s.Verify(key); err != nil && err != ErrNoMessageHash {
+			issues = append(issues, err.Error())
+		}
+		return issues
+	}
+	if len(s.MessageHash) > 0 && MessageHash(plainMessage) != s.MessageHash {
+		issues = append(issues, `the given message does not match the hash of the message of the session`)
+	}
+	if s.Authenticated {
+		if macKey, err = key.ReadAt(end-MacKeyLength, MacKeyLength); err != nil {
+			// Already reported (beyond the end of the key).
+			return issues
+		}
+	}
+	err = chunks.Build(plainMessage, expectedLength, s.Encoding(), macKey)
+	if err != nil {
+		return append(issues, err.Error())
+	}
+	if len(chunks) != len(s.Boundaries) {
+		return append(issues, fmt.Sprintf(`the given message contains %d chunks, but the session contains %d boundaries`, len(chunks), len(s.Boundaries)))
+	}
+	for i, boundary := range s.Boundaries {
+		var material []byte
+		var expected []byte
+		if (s.Lazy && !s.IsAllocated(i)) || len(boundary) != expectedLength {
+			continue
+		}
+		if material, err = key.ReadAt(s.boundaryPosition(i), int64(len(boundary))); err != nil {
+			// Already reported (beyond the end of the key).
+			continue
+		}
+		if expected, err = Cypher(chunks[i], material); err != nil {
+			return append(issues, err.Error())
+		}
+		if string(expected) != string(boundary) {
+			issues = append(issues, fmt.Sprintf(`boundary %d is not the chunk %d of the message XORed with the key material from position %d`, i, i, s.boundaryPosition(i)))
+		}
+	}
+	return issues
+}
+
+// boundaryPosition Returns the position of the key material used by the boundary at a given index.
+func (s *Session) boundaryPosition(index int) int64 {
+	var position = s.PoolPointerPosition
+
+	if s.Lazy {
+		return s.Positions[index]
+	}
+	for i := 0; i < index; i++ {
+		position += int64(len(s.Boundaries[i]))
+	}
+	return position
+}
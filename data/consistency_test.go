@@ -0,0 +1,101 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"umail/resource"
+)
+
+func TestSessionInconsistencies(t *testing.T) {
+	var err error
+	var session Session
+	var message Message
+	var key *resource.MemoryPool
+	var boundaries [][]byte
+	var issues []string
+	var plain = []byte("the message to hide, which is longer than a boundary")
+	var material = make([]byte, 100)
+
+	for i := range material {
+		material[i] = byte(i * 7)
+	}
+	key, err = resource.NewMemoryPool(material, 10)
+	assert.Nil(t, err)
+	err = message.FromBytes(plain, 35)
+	assert.Nil(t, err)
+	boundaries, err = message.Encode(key)
+	assert.Nil(t, err)
+	session.Init("key", 10)
+	for _, boundary := range boundaries {
+		session.AddBoundary(boundary)
+	}
+	session.MessageHash = MessageHash(plain)
+
+	// Consistent session.
+	issues = session.Inconsistencies(key, nil)
+	assert.Empty(t, issues)
+	issues = session.Inconsistencies(key, plain)
+	assert.Empty(t, issues)
+
+	// Wrong message.
+	issues = session.Inconsistencies(key, []byte("another message to hide, which is longer than a boundary"))
+	assert.Len(t, issues, 3)
+
+	// The position of the key is before the end of the key material used by the session.
+	key, err = resource.NewMemoryPool(material, 20)
+	assert.Nil(t, err)
+	issues = session.Inconsistencies(key, plain)
+	assert.Len(t, issues, 1)
+
+	// The key is too short.
+	key, err = resource.NewMemoryPool(material[:50], 50)
+	assert.Nil(t, err)
+	issues = session.Inconsistencies(key, plain)
+	assert.Len(t, issues, 2)
+	assert.Contains(t, issues[0], "boundary 1")
+
+	// A corrupted boundary.
+	key, err = resource.NewMemoryPool(material, 80)
+	assert.Nil(t, err)
+	session.Boundaries[1][0] ^= 0xff
+	issues = session.Inconsistencies(key, plain)
+	assert.Len(t, issues, 1)
+	assert.Contains(t, issues[0], "boundary 1")
+	issues = session.Inconsistencies(key, nil)
+	assert.Len(t, issues, 1)
+}
+
+func TestSessionInconsistenciesAuthenticated(t *testing.T) {
+	var err error
+	var session Session
+	var key *resource.MemoryPool
+	var boundaries [][]byte
+	var issues []string
+	var plain = []byte("the message to hide, which is longer than a boundary")
+	var material = make([]byte, 200)
+
+	for i := range material {
+		material[i] = byte(i * 7)
+	}
+	key, err = resource.NewMemoryPool(material, 10)
+	assert.Nil(t, err)
+	boundaries, err = EncodeMessage(plain, 35, key, Encoding{Authenticated: true})
+	assert.Nil(t, err)
+	session.Init("key", 10)
+	for _, boundary := range boundaries {
+		session.AddBoundary(boundary)
+	}
+	session.MessageHash = MessageHash(plain)
+	session.Authenticated = true
+
+	issues = session.Inconsistencies(key, nil)
+	assert.Empty(t, issues)
+	issues = session.Inconsistencies(key, plain)
+	assert.Empty(t, issues)
+
+	// The key material used by the MAC may be used again.
+	key, err = resource.NewMemoryPool(material, 10+int64(len(boundaries)*35))
+	assert.Nil(t, err)
+	issues = session.Inconsistencies(key, plain)
+	assert.Len(t, issues, 1)
+}
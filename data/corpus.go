@@ -0,0 +1,107 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// corpusOrder The number of words that determine the next word of a generated text.
+const corpusOrder = 2
+
+// The shape of the generated bodies: a number of paragraphs, made of a number of sentences (each number is picked in
+// the given range).
+const (
+	minParagraphs       = 1
+	maxParagraphs       = 3
+	minSentences        = 2
+	maxSentences        = 4
+	maxWordsPerSentence = 40
+	// maxSentenceAttempts The number of attempts made to generate a sentence that is not already in the body.
+	maxSentenceAttempts = 5
+)
+
+// Corpus A Markov chain built from a text (the corpus), used to generate plausible cover bodies: each generated body is
+// different, but it reads like the corpus.
+type Corpus struct {
+	// chain The words that follow a sequence of `corpusOrder` words (joined by a space) in the corpus.
+	chain map[string][]string
+	// starts The sequences of `corpusOrder` words that start a sentence.
+	starts [][]string
+}
+
+// NewCorpus Builds the Markov chain of a text. The text must contain at least one sentence of more than `corpusOrder`
+// words.
+func NewCorpus(text []byte) (*Corpus, error) {
+	var corpus = Corpus{chain: make(map[string][]string)}
+	var words = strings.Fields(string(text))
+
+	for i := 0; i+corpusOrder < len(words); i++ {
+		var prefix = words[i : i+corpusOrder]
+		if (i == 0 || endsSentence(words[i-1])) && startsSentence(prefix[0]) && !endsSentence(prefix[corpusOrder-1]) {
+			corpus.starts = append(corpus.starts, prefix)
+		}
+		corpus.chain[strings.Join(prefix, " ")] = append(corpus.chain[strings.Join(prefix, " ")], words[i+corpusOrder])
+	}
+	if len(corpus.starts) == 0 {
+		return nil, fmt.Errorf(`the corpus is too small (it must contain at least one sentence of more than %d words)`, corpusOrder)
+	}
+	return &corpus, nil
+}
+
+// Generate Returns a body made of paragraphs separated by an empty line (the lines are terminated by LF, as the
+// bodies loaded from files). `random` returns a random integer in [0, n).
+func (c *Corpus) Generate(random func(n int) int) string {
+	var paragraphs []string
+	var used = make(map[string]bool)
+	var count = minParagraphs + random(maxParagraphs-minParagraphs+1)
+
+	for i := 0; i < count; i++ {
+		var sentences []string
+		var length = minSentences + random(maxSentences-minSentences+1)
+		for j := 0; j < length; j++ {
+			var sentence = c.sentence(random)
+			// A small corpus may not give enough different sentences.
+			for attempt := 1; attempt < maxSentenceAttempts && used[sentence]; attempt++ {
+				sentence = c.sentence(random)
+			}
+			used[sentence] = true
+			sentences = append(sentences, sentence)
+		}
+		paragraphs = append(paragraphs, strings.Join(sentences, " "))
+	}
+	return strings.Join(paragraphs, "\n\n") + "\n"
+}
+
+// sentence Returns a sentence: a random walk through the chain, from a start of sentence to an end of sentence (or
+// until the sentence is too long, or the walk reaches the end of the corpus).
+func (c *Corpus) sentence(random func(n int) int) string {
+	var words = append([]string{}, c.starts[random(len(c.starts))]...)
+
+	for len(words) < maxWordsPerSentence && !endsSentence(words[len(words)-1]) {
+		var next = c.chain[strings.Join(words[len(words)-corpusOrder:], " ")]
+		if len(next) == 0 {
+			break
+		}
+		words = append(words, next[random(len(next))])
+	}
+	if !endsSentence(words[len(words)-1]) {
+		words[len(words)-1] = strings.TrimRightFunc(words[len(words)-1], unicode.IsPunct) + "."
+	}
+	return strings.Join(words, " ")
+}
+
+// startsSentence Tells whether a word can start a sentence (it starts with an uppercase letter).
+func startsSentence(word string) bool {
+	for _, r := range word {
+		return unicode.IsUpper(r)
+	}
+	return false
+}
+
+// endsSentence Tells whether a word ends a sentence (it ends with ".", "!" or "?", possibly followed by a quote or a
+// parenthesis).
+func endsSentence(word string) bool {
+	word = strings.TrimRight(word, `"')`)
+	return strings.HasSuffix(word, ".") || strings.HasSuffix(word, "!") || strings.HasSuffix(word, "?")
+}
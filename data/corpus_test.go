@@ -0,0 +1,57 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const corpusText = `Thank you for your message. I hope you are doing well and that the weather is nice over there.
+We had a lovely weekend at the lake with the kids. The water was still cold, but the kids did not care!
+I will send you the photos of the weekend as soon as I can. Do you still plan to visit us in June?
+Let me know when you are available, and we will plan something nice. Take care of yourself.`
+
+func TestCorpusGenerate(t *testing.T) {
+	var err error
+	var corpus *Corpus
+	var random = rand.New(rand.NewSource(1))
+	var bodies = make(map[string]bool)
+
+	if corpus, err = NewCorpus([]byte(corpusText)); err != nil {
+		assert.FailNow(t, err.Error())
+	}
+	for i := 0; i < 20; i++ {
+		var body = corpus.Generate(random.Intn)
+		var paragraphs = strings.Split(strings.TrimSuffix(body, "\n"), "\n\n")
+
+		assert.True(t, strings.HasSuffix(body, "\n"))
+		assert.NotContains(t, body, "\r")
+		assert.GreaterOrEqual(t, len(paragraphs), minParagraphs)
+		assert.LessOrEqual(t, len(paragraphs), maxParagraphs)
+		for _, paragraph := range paragraphs {
+			// Each paragraph is made of sentences that start with an uppercase letter, and end with a punctuation mark.
+			assert.True(t, startsSentence(paragraph), paragraph)
+			assert.True(t, endsSentence(paragraph), paragraph)
+			assert.LessOrEqual(t, len(strings.Fields(paragraph)), maxSentences*maxWordsPerSentence)
+			// All the words come from the corpus.
+			for _, word := range strings.Fields(paragraph) {
+				assert.Contains(t, corpusText, strings.TrimSuffix(word, "."), word)
+			}
+		}
+		bodies[body] = true
+	}
+	// The bodies are different.
+	assert.Greater(t, len(bodies), 15)
+}
+
+func TestCorpusTooSmall(t *testing.T) {
+	var err error
+
+	for _, text := range []string{"", "Hello.", "Hello John.", "hello john and jane"} {
+		_, err = NewCorpus([]byte(text))
+		assert.NotNil(t, err, text)
+	}
+	_, err = NewCorpus([]byte("Hello John and Jane."))
+	assert.Nil(t, err)
+}
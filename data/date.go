@@ -0,0 +1,59 @@
+package data
+
+import (
+	"fmt"
+	"net/mail"
+	"time"
+)
+
+// dateCarrierLength The number of bytes hidden by the "Date" header: 5 bits in the seconds, and 3 bits in the offset of
+// the time zone.
+const dateCarrierLength = 1
+
+// dateSecondBits The number of bits hidden by the seconds of the date: the seconds, modulo 32.
+const dateSecondBits = 5
+
+// dateZoneOffsets The offsets of the time zones (in minutes) hidden by the date (3 bits): the time zones of the main
+// regions the emails are sent from.
+var dateZoneOffsets = []int{-480, -300, -240, 0, 60, 120, 330, 540}
+
+// CarryingDate Returns the date of an email that hides bytes of a chunk of the message (see `CarrierDate`): the same
+// instant, within the same minute, written in one of the time zones of `dateZoneOffsets`. The seconds (modulo 32) hide
+// the 5 high bits of the byte, the time zone its 3 low bits.
+func CarryingDate(date time.Time, payload []byte) (time.Time, error) {
+	var second int
+	var offset int
+
+	if len(payload) != dateCarrierLength {
+		return date, fmt.Errorf(`a date hides %d byte (%d given)`, dateCarrierLength, len(payload))
+	}
+	// The seconds are the ones of the date, or the closest ones that hide the bits.
+	second = int(payload[0] >> (8 - dateSecondBits))
+	if second+32 < 60 && date.Second()-second > second+32-date.Second() {
+		second += 32
+	}
+	offset = dateZoneOffsets[payload[0]&(1<<(8-dateSecondBits)-1)]
+	date = date.Truncate(time.Minute).Add(time.Duration(second) * time.Second)
+	return date.In(time.FixedZone("", offset*60)), nil
+}
+
+// DatePayload Extracts the bytes hidden by the "Date" header of an email (see `CarryingDate`): `length` bytes.
+func DatePayload(header string, length int) ([]byte, error) {
+	var err error
+	var date time.Time
+	var offset int
+
+	if length != dateCarrierLength {
+		return nil, fmt.Errorf(`a date hides %d byte (%d expected)`, dateCarrierLength, length)
+	}
+	if date, err = mail.ParseDate(header); err != nil {
+		return nil, fmt.Errorf(`invalid date "%s": %s`, header, err.Error())
+	}
+	_, offset = date.Zone()
+	for i, value := range dateZoneOffsets {
+		if value*60 == offset {
+			return []byte{byte(date.Second()%32)<<(8-dateSecondBits) | byte(i)}, nil
+		}
+	}
+	return nil, fmt.Errorf(`the date "%s" hides no byte (unexpected time zone)`, header)
+}
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCarryingDate(t *testing.T) {
+	var err error
+	var now = time.Date(2024, 3, 12, 10, 15, 50, 0, time.UTC)
+
+	for value := 0; value < 256; value++ {
+		var date time.Time
+		var payload []byte
+
+		date, err = CarryingDate(now, []byte{byte(value)})
+		assert.Nil(t, err)
+		// Same minute.
+		assert.Equal(t, now.Truncate(time.Minute), date.Truncate(time.Minute).UTC())
+		payload, err = DatePayload(date.Format(dateFormat), 1)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{byte(value)}, payload)
+	}
+	// The seconds closest to the date are used.
+	date, _ := CarryingDate(now, []byte{20 << 3})
+	assert.Equal(t, 52, date.Second())
+	date, _ = CarryingDate(now.Add(-40*time.Second), []byte{20 << 3})
+	assert.Equal(t, 20, date.Second())
+
+	// We'll get errors...
+	_, err = CarryingDate(now, []byte{1, 2})
+	assert.NotNil(t, err)
+	_, err = DatePayload("Tue, 12 Mar 2024 10:15:30 +0100", 2)
+	assert.NotNil(t, err)
+	_, err = DatePayload("Tue, 12 Mar 2024 10:15:30 +0700", 1)
+	assert.NotNil(t, err)
+	_, err = DatePayload("yesterday", 1)
+	assert.NotNil(t, err)
+}
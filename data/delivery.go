@@ -0,0 +1,195 @@
+package data
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeliveryStatus The status of the delivery of a boundary (that is, of an email) to a recipient.
+type DeliveryStatus string
+
+const (
+	// DeliveryPending The email has not been sent yet.
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliverySent The email has been accepted by the SMTP server.
+	DeliverySent DeliveryStatus = "sent"
+	// DeliveryFailed The email could not be sent. It can be sent again.
+	DeliveryFailed DeliveryStatus = "failed"
+	// DeliveryConfirmed The recipient confirmed the reception of the email.
+	DeliveryConfirmed DeliveryStatus = "confirmed"
+	// DeliveryQueued The email has been rendered and queued: it will be sent by the daemon.
+	DeliveryQueued DeliveryStatus = "queued"
+)
+
+// deliveryTransitions The allowed transitions between statuses.
+var deliveryTransitions = map[DeliveryStatus][]DeliveryStatus{
+	DeliveryPending:   {DeliverySent, DeliveryFailed, DeliveryQueued},
+	DeliveryFailed:    {DeliverySent, DeliveryFailed, DeliveryQueued},
+	DeliveryQueued:    {DeliverySent, DeliveryFailed},
+	DeliverySent:      {DeliveryConfirmed, DeliveryFailed},
+	DeliveryConfirmed: {},
+}
+
+// Delivery The delivery state of a boundary.
+type Delivery struct {
+	Status DeliveryStatus `json:"status"`
+	// Updated The date of the last change of status.
+	Updated *time.Time `json:"updated,omitempty"`
+	// MessageID The value of the "Message-ID" header of the email (once sent).
+	MessageID string `json:"message-id,omitempty"`
+	// Error The reason of the last failure.
+	Error string `json:"error,omitempty"`
+}
+
+// Deliveries The delivery states of all the boundaries of a session (one delivery per boundary), for one recipient.
+type Deliveries []Delivery
+
+// NewDeliveries Creates the delivery states of `count` boundaries that have not been sent yet.
+func NewDeliveries(count int) Deliveries {
+	var result = make(Deliveries, count)
+
+	for i := range result {
+		result[i] = Delivery{Status: DeliveryPending}
+	}
+	return result
+}
+
+// Next Returns the index of the next boundary to send (the first one that is pending or failed), or -1 if all the
+// boundaries have been sent.
+func (d Deliveries) Next() int {
+	for i, delivery := range d {
+		if delivery.Status == DeliveryPending || delivery.Status == DeliveryFailed {
+			return i
+		}
+	}
+	return -1
+}
+
+// Done Tells whether all the boundaries have been sent (or confirmed).
+func (d Deliveries) Done() bool {
+	for _, delivery := range d {
+		if delivery.Status != DeliverySent && delivery.Status != DeliveryConfirmed {
+			return false
+		}
+	}
+	return true
+}
+
+// Thread Returns the message IDs of the emails that precede the boundary at a given index (sent, confirmed or queued),
+// from the oldest to the most recent.
+func (d Deliveries) Thread(index int) []string {
+	var result []string
+
+	for i := 0; i < index && i < len(d); i++ {
+		switch d[i].Status {
+		case DeliverySent, DeliveryConfirmed, DeliveryQueued:
+			if len(d[i].MessageID) > 0 {
+				result = append(result, d[i].MessageID)
+			}
+		}
+	}
+	return result
+}
+
+// Count Returns the number of boundaries that have a given status.
+func (d Deliveries) Count(status DeliveryStatus) int {
+	var count int
+
+	for _, delivery := range d {
+		if delivery.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Indexes Returns the indexes of the boundaries that have a given status.
+func (d Deliveries) Indexes(status DeliveryStatus) []int {
+	var result []int
+
+	for i, delivery := range d {
+		if delivery.Status == status {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// Remaining Returns the indexes of the boundaries that remain to be sent (pending or failed), in their order.
+func (d Deliveries) Remaining() []int {
+	var result []int
+
+	for i, delivery := range d {
+		if delivery.Status == DeliveryPending || delivery.Status == DeliveryFailed {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// SetSent Records that the boundary at a given index has been sent.
+func (d Deliveries) SetSent(index int, messageID string) error {
+	if err := d.set(index, DeliverySent); err != nil {
+		return err
+	}
+	d[index].MessageID = messageID
+	d[index].Error = ""
+	return nil
+}
+
+// SetQueued Records that the boundary at a given index has been queued (see `Queue`).
+func (d Deliveries) SetQueued(index int, messageID string) error {
+	if err := d.set(index, DeliveryQueued); err != nil {
+		return err
+	}
+	d[index].MessageID = messageID
+	d[index].Error = ""
+	return nil
+}
+
+// SetFailed Records that the boundary at a given index could not be sent.
+func (d Deliveries) SetFailed(index int, reason error) error {
+	if err := d.set(index, DeliveryFailed); err != nil {
+		return err
+	}
+	d[index].Error = reason.Error()
+	return nil
+}
+
+// SetConfirmed Records that the recipient confirmed the reception of the boundary at a given index.
+func (d Deliveries) SetConfirmed(index int) error {
+	return d.set(index, DeliveryConfirmed)
+}
+
+// Reset Sets all the boundaries as not sent.
+func (d Deliveries) Reset() {
+	for i := range d {
+		d[i] = Delivery{Status: DeliveryPending}
+	}
+}
+
+// set Changes the status of the boundary at a given index, if the transition is allowed.
+func (d Deliveries) set(index int, status DeliveryStatus) error {
+	if index < 0 || index >= len(d) {
+		return fmt.Errorf(`invalid boundary index (%d): the session contains %d boundaries`, index, len(d))
+	}
+	for _, allowed := range deliveryTransitions[d[index].Status] {
+		if allowed == status {
+			var now = time.Now().UTC().Truncate(time.Second)
+			d[index].Status = status
+			d[index].Updated = &now
+			return nil
+		}
+	}
+	return fmt.Errorf(`invalid change of status for boundary %d: from "%s" to "%s"`, index, d[index].Status, status)
+}
+
+// validate Checks that all the statuses are known.
+func (d Deliveries) validate() error {
+	for i, delivery := range d {
+		if _, ok := deliveryTransitions[delivery.Status]; !ok {
+			return fmt.Errorf(`invalid status "%s" for boundary %d`, delivery.Status, i)
+		}
+	}
+	return nil
+}
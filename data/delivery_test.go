@@ -0,0 +1,109 @@
+package data
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDeliveries(t *testing.T) {
+	var deliveries = NewDeliveries(3)
+
+	assert.Equal(t, 0, deliveries.Next())
+	assert.Equal(t, 3, deliveries.Count(DeliveryPending))
+
+	// The first email is sent, the second fails.
+	assert.Nil(t, deliveries.SetSent(0, "<1@example.com>"))
+	assert.Nil(t, deliveries.SetFailed(1, errors.New("connection reset")))
+	assert.Equal(t, "<1@example.com>", deliveries[0].MessageID)
+	assert.NotNil(t, deliveries[0].Updated)
+	assert.Equal(t, "connection reset", deliveries[1].Error)
+
+	// The failed email is the next one to send.
+	assert.Equal(t, []int{1}, deliveries.Indexes(DeliveryFailed))
+	assert.Equal(t, []int{2}, deliveries.Indexes(DeliveryPending))
+	assert.Equal(t, 1, deliveries.Next())
+	assert.Nil(t, deliveries.SetSent(1, "<2@example.com>"))
+	assert.Equal(t, "", deliveries[1].Error)
+	assert.Equal(t, 2, deliveries.Next())
+	assert.Nil(t, deliveries.SetSent(2, "<3@example.com>"))
+	assert.Equal(t, -1, deliveries.Next())
+	assert.Equal(t, 3, deliveries.Count(DeliverySent))
+
+	// Confirmation.
+	assert.Nil(t, deliveries.SetConfirmed(0))
+	assert.Equal(t, 1, deliveries.Count(DeliveryConfirmed))
+
+	// Reset.
+	deliveries.Reset()
+	assert.Equal(t, 3, deliveries.Count(DeliveryPending))
+	assert.Equal(t, "", deliveries[0].MessageID)
+}
+
+func TestDeliveriesInvalidTransition(t *testing.T) {
+	var deliveries = NewDeliveries(2)
+
+	// A pending email cannot be confirmed.
+	assert.NotNil(t, deliveries.SetConfirmed(0))
+	assert.Equal(t, DeliveryPending, deliveries[0].Status)
+
+	// A confirmed email cannot be sent again.
+	assert.Nil(t, deliveries.SetSent(0, "<1@example.com>"))
+	assert.Nil(t, deliveries.SetConfirmed(0))
+	assert.NotNil(t, deliveries.SetSent(0, "<2@example.com>"))
+	assert.NotNil(t, deliveries.SetFailed(0, errors.New("error")))
+
+	// Invalid index.
+	assert.NotNil(t, deliveries.SetSent(2, "<3@example.com>"))
+	assert.NotNil(t, deliveries.SetSent(-1, "<3@example.com>"))
+}
+
+func TestDeliveriesQueued(t *testing.T) {
+	var deliveries = NewDeliveries(2)
+
+	// A queued email is not the next one to send, but it has not been sent yet.
+	assert.Nil(t, deliveries.SetQueued(0, "<1@example.com>"))
+	assert.Equal(t, "<1@example.com>", deliveries[0].MessageID)
+	assert.Equal(t, 1, deliveries.Next())
+	assert.Nil(t, deliveries.SetSent(1, "<2@example.com>"))
+	assert.Equal(t, -1, deliveries.Next())
+	assert.False(t, deliveries.Done())
+
+	// A queued email cannot be confirmed, or queued again.
+	assert.NotNil(t, deliveries.SetConfirmed(0))
+	assert.NotNil(t, deliveries.SetQueued(0, "<1@example.com>"))
+	assert.Nil(t, deliveries.SetSent(0, "<1@example.com>"))
+	assert.True(t, deliveries.Done())
+}
+
+func TestDeliveriesThread(t *testing.T) {
+	var deliveries = NewDeliveries(5)
+
+	assert.Empty(t, deliveries.Thread(0))
+	assert.Nil(t, deliveries.SetSent(0, "<1@example.com>"))
+	assert.Nil(t, deliveries.SetFailed(1, errors.New("550 no such user")))
+	assert.Nil(t, deliveries.SetQueued(2, "<3@example.com>"))
+	assert.Nil(t, deliveries.SetSent(3, "<4@example.com>"))
+	assert.Nil(t, deliveries.SetConfirmed(3))
+
+	// The emails that failed are not part of the thread.
+	assert.Equal(t, []string{"<1@example.com>"}, deliveries.Thread(1))
+	assert.Equal(t, []string{"<1@example.com>", "<3@example.com>"}, deliveries.Thread(3))
+	assert.Equal(t, []string{"<1@example.com>", "<3@example.com>", "<4@example.com>"}, deliveries.Thread(4))
+	assert.Equal(t, []string{"<1@example.com>", "<3@example.com>", "<4@example.com>"}, deliveries.Thread(10))
+}
+
+func TestDeliveriesRemaining(t *testing.T) {
+	var deliveries = NewDeliveries(5)
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, deliveries.Remaining())
+	assert.Nil(t, deliveries.SetSent(0, "<1@example.com>"))
+	assert.Nil(t, deliveries.SetFailed(1, errors.New("error")))
+	assert.Nil(t, deliveries.SetQueued(3, "<2@example.com>"))
+	assert.Nil(t, deliveries.SetSent(4, "<3@example.com>"))
+	assert.Nil(t, deliveries.SetConfirmed(4))
+
+	// The failed emails keep their order among the pending ones.
+	assert.Equal(t, []int{1, 2}, deliveries.Remaining())
+	assert.Nil(t, Deliveries{}.Remaining())
+}
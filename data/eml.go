@@ -0,0 +1,53 @@
+package data
+
+import (
+	"fmt"
+	"os"
+)
+
+// EmlOutput The file an email is written into (RFC 5322, ".eml"), instead of being sent (see "send --out").
+type EmlOutput struct {
+	// Path The path to the file, or an empty string if the email is sent.
+	Path string
+	// Advance Tells whether the email written into the file is marked as sent.
+	Advance bool
+}
+
+// Validate Checks the output: the file must not exist, and the email can only be left pending (see `Advance`) if it is
+// written into a file.
+func (o EmlOutput) Validate() error {
+	if len(o.Path) == 0 {
+		if !o.Advance {
+			return fmt.Errorf(`the option "--advance" can only be used with "--out"`)
+		}
+		return nil
+	}
+	if _, err := os.Stat(o.Path); err == nil {
+		return fmt.Errorf(`the file "%s" already exists`, o.Path)
+	}
+	return nil
+}
+
+// CheckRecipients Checks that a single email is written into the file, given the number of recipients the emails of a
+// session are sent to.
+func (o EmlOutput) CheckRecipients(sessionName string, count int) error {
+	if len(o.Path) > 0 && count > 1 {
+		return fmt.Errorf(`the session "%s" has several recipients: only one email can be written into "%s" (give the recipient)`, sessionName, o.Path)
+	}
+	return nil
+}
+
+// WriteNewFile Writes data into a new file. It fails if the file already exists.
+func WriteNewFile(path string, data []byte) error {
+	var err error
+	var file *os.File
+
+	if file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); err != nil {
+		return fmt.Errorf(`cannot create the file "%s": %s`, path, err.Error())
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf(`cannot write the file "%s": %s`, path, err.Error())
+	}
+	return file.Close()
+}
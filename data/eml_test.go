@@ -0,0 +1,53 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmlOutputValidate(t *testing.T) {
+	var dir = t.TempDir()
+	var existing = filepath.Join(dir, "existing.eml")
+
+	assert.Nil(t, os.WriteFile(existing, []byte("Subject: Hello\r\n\r\n"), 0644))
+	for _, test := range []struct {
+		output EmlOutput
+		valid  bool
+	}{
+		{output: EmlOutput{Advance: true}, valid: true},
+		{output: EmlOutput{Path: filepath.Join(dir, "new.eml"), Advance: true}, valid: true},
+		{output: EmlOutput{Path: filepath.Join(dir, "new.eml"), Advance: false}, valid: true},
+		// The email is sent: it is always marked as sent.
+		{output: EmlOutput{Advance: false}, valid: false},
+		{output: EmlOutput{Path: existing, Advance: true}, valid: false},
+	} {
+		assert.Equal(t, test.valid, test.output.Validate() == nil, test.output)
+	}
+}
+
+func TestEmlOutputCheckRecipients(t *testing.T) {
+	var output = EmlOutput{Path: "email.eml", Advance: true}
+
+	assert.Nil(t, output.CheckRecipients("holidays", 1))
+	assert.NotNil(t, output.CheckRecipients("holidays", 2))
+	assert.Nil(t, EmlOutput{Advance: true}.CheckRecipients("holidays", 2))
+}
+
+func TestWriteNewFile(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "email.eml")
+	var content []byte
+	var err error
+
+	assert.Nil(t, WriteNewFile(path, []byte("first")))
+	content, err = os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(content))
+
+	// The file is not overwritten.
+	assert.NotNil(t, WriteNewFile(path, []byte("second")))
+	content, err = os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", string(content))
+}
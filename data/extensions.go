@@ -0,0 +1,118 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// SmtpLimits The limits an SMTP server announces in its reply to the "EHLO" command (RFC 1870 and RFC 6152).
+type SmtpLimits struct {
+	// MaxSize The maximum size of an email, in bytes (0 if the server does not announce it).
+	MaxSize int
+	// EightBit Tells whether the server accepts the emails that contain 8-bit data ("8BITMIME").
+	EightBit bool
+}
+
+// unstructuredHeaders The headers whose value is free text: if they contain 8-bit data, then they can be encoded (RFC
+// 2047). The other headers are structured (addresses, message IDs...).
+var unstructuredHeaders = map[string]bool{
+	"subject":      true,
+	"thread-topic": true,
+}
+
+// ParseSizeExtension Parses the parameter of the "SIZE" extension of an SMTP server: the maximum size of an email, in
+// bytes. The value 0 (or no value) means that the server does not announce a limit.
+func ParseSizeExtension(param string) (int, error) {
+	var size int
+	var err error
+
+	if param = strings.TrimSpace(param); len(param) == 0 {
+		return 0, nil
+	}
+	if size, err = strconv.Atoi(param); err != nil || size < 0 {
+		return 0, fmt.Errorf(`invalid "SIZE" extension "%s"`, param)
+	}
+	return size, nil
+}
+
+// Fit Returns an email (RFC 5322) that the server accepts. If the server does not accept 8-bit data, then the free
+// text headers (such as "Subject") are encoded (RFC 2047): other 8-bit data cannot be adapted (the parts of the body
+// are always encoded). The email is refused if it exceeds the maximum size: the error gives the number of bytes added
+// by the carriers (see `CarriedBytes`). Please note that the hidden payload is not split across more emails.
+func (l SmtpLimits) Fit(message string) (string, error) {
+	var end = strings.Index(message, "\r\n\r\n")
+	var lines []string
+
+	if !l.EightBit && !isSevenBit(message) {
+		if end < 0 || !isSevenBit(message[end:]) {
+			return "", fmt.Errorf(`the body of the email contains 8-bit data, and the server does not accept it ("8BITMIME")`)
+		}
+		lines = strings.Split(message[:end], "\r\n")
+		for i, line := range lines {
+			var name, value, _ = strings.Cut(line, ":")
+			if isSevenBit(line) {
+				continue
+			}
+			if !unstructuredHeaders[strings.ToLower(name)] {
+				return "", fmt.Errorf(`the header "%s" contains 8-bit data, and the server does not accept it ("8BITMIME")`, name)
+			}
+			lines[i] = name + ": " + mime.QEncoding.Encode("utf-8", strings.TrimSpace(value))
+		}
+		message = strings.Join(lines, "\r\n") + message[end:]
+	}
+	if l.MaxSize > 0 && len(message) > l.MaxSize {
+		if carried := CarriedBytes([]byte(message)); carried > 0 {
+			return "", fmt.Errorf(`the email (%d bytes, including %d bytes added by the carriers) exceeds the maximum size accepted by the server (%d bytes): use a shorter body, or carriers that hide fewer bytes per email`, len(message), carried, l.MaxSize)
+		}
+		return "", fmt.Errorf(`the email (%d bytes) exceeds the maximum size accepted by the server (%d bytes): use a shorter body`, len(message), l.MaxSize)
+	}
+	return message, nil
+}
+
+// CarriedBytes Returns the number of bytes of an email (RFC 5322) added by the carriers whose size depends on the
+// hidden payload: the cover image attached to the email (see `CarrierImage`), as it is encoded, and the whitespaces at
+// the end of the lines of the plain text part (see `CarrierWhitespace`), once decoded. The other carriers replace
+// bytes that the email contains anyway. The result is 0 if the email cannot be parsed.
+func CarriedBytes(content []byte) int {
+	var err error
+	var parts []leafPart
+	var carried int
+
+	if parts, err = leafParts(content); err != nil {
+		return 0
+	}
+	for _, part := range parts {
+		var mediaType string
+		var text []byte
+
+		if mediaType, _, err = mime.ParseMediaType(part.header.Get("Content-Type")); err != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(mediaType, "image/"):
+			carried += len(part.body)
+		case mediaType == "text/plain":
+			if text, err = part.decode(); err != nil {
+				continue
+			}
+			for _, line := range bytes.Split(text, []byte("\n")) {
+				line = bytes.TrimSuffix(line, []byte("\r"))
+				carried += len(line) - len(bytes.TrimRight(line, " \t"))
+			}
+		}
+	}
+	return carried
+}
+
+// isSevenBit Tells whether a text only contains 7-bit data (US-ASCII).
+func isSevenBit(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
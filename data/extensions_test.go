@@ -0,0 +1,81 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseSizeExtension(t *testing.T) {
+	var err error
+	var size int
+
+	size, err = ParseSizeExtension("35882577")
+	assert.Nil(t, err)
+	assert.Equal(t, 35882577, size)
+	size, err = ParseSizeExtension("")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, size)
+	_, err = ParseSizeExtension("big")
+	assert.NotNil(t, err)
+	_, err = ParseSizeExtension("-1")
+	assert.NotNil(t, err)
+}
+
+func TestSmtpLimitsFit(t *testing.T) {
+	var err error
+	var fitted string
+	var message = "From: Jérôme <j@example.com>\r\nSubject: Café\r\n\r\nSGVsbG8=\r\n"
+
+	// The server accepts 8-bit data: the email is unchanged.
+	fitted, err = SmtpLimits{EightBit: true}.Fit(message)
+	assert.Nil(t, err)
+	assert.Equal(t, message, fitted)
+
+	// The subject is encoded, but the display name cannot be.
+	_, err = SmtpLimits{}.Fit(message)
+	assert.NotNil(t, err)
+	fitted, err = SmtpLimits{}.Fit("From: j@example.com\r\nSubject: Café\r\n\r\nSGVsbG8=\r\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "From: j@example.com\r\nSubject: =?utf-8?q?Caf=C3=A9?=\r\n\r\nSGVsbG8=\r\n", fitted)
+	_, err = SmtpLimits{}.Fit("Subject: Hello\r\n\r\nCafé\r\n")
+	assert.NotNil(t, err)
+
+	// The maximum size.
+	_, err = SmtpLimits{MaxSize: 20, EightBit: true}.Fit(message)
+	assert.NotNil(t, err)
+	_, err = SmtpLimits{MaxSize: len(message), EightBit: true}.Fit(message)
+	assert.Nil(t, err)
+}
+
+func TestCarriedBytes(t *testing.T) {
+	var err error
+	var boundaries = []string{strings.Repeat("0a", 35), strings.Repeat("0b", 35), strings.Repeat("0c", 35)}
+	var content []byte
+	var email []byte
+	var text = []byte(strings.Repeat("Hello\n", 40))
+
+	for _, test := range []struct {
+		payloads BodyPayloads
+		empty    bool
+	}{
+		{payloads: BodyPayloads{}, empty: true},
+		{payloads: BodyPayloads{Whitespace: []byte("0123456789")}},
+		{payloads: BodyPayloads{Image: []byte("0123456789"), Cover: newTestPng(t, 20, 10), CoverPath: "cover.png"}},
+	} {
+		content, err = BuildNested(boundaries, text, []byte("<p>Hello</p>"), "", "", test.payloads)
+		assert.Nil(t, err)
+		email = append([]byte("Subject: Hello\r\nContent-Type: multipart/mixed; boundary=\""+boundaries[0]+"\"\r\n\r\n"), content...)
+		if test.empty {
+			assert.Equal(t, 0, CarriedBytes(email))
+			continue
+		}
+		assert.Greater(t, CarriedBytes(email), 0)
+		assert.Less(t, CarriedBytes(email), len(email))
+
+		// The error gives the bytes added by the carriers.
+		_, err = SmtpLimits{MaxSize: 100, EightBit: true}.Fit(string(email))
+		assert.ErrorContains(t, err, "added by the carriers")
+	}
+	assert.Equal(t, 0, CarriedBytes([]byte("not an email")))
+}
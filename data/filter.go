@@ -0,0 +1,202 @@
+package data
+
+import (
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// EmailFilter The criteria the received emails must match (see "rcv"). The criteria that are not given match all the
+// emails. The IMAP servers evaluate the criteria (SEARCH): only the emails that match them are fetched.
+type EmailFilter struct {
+	// From The address of the sender (the whole address).
+	From string
+	// Since The day (local time) from which the emails were received.
+	Since time.Time
+	// Before The day (local time) before which the emails were received (this day is excluded).
+	Before time.Time
+	// Subject A text the subject contains (case-insensitive).
+	Subject string
+	// HeaderName and HeaderValue A header of the email, and a text its value contains (case-insensitive). An empty
+	// value matches the emails that have the header.
+	HeaderName  string
+	HeaderValue string
+	// Marker The marker of a hidden message (see `NewMarker`): a text the message ID of the email contains.
+	Marker string
+	// SkipKeyword The emails marked with this keyword (IMAP) are skipped (see `ProcessedAction`).
+	SkipKeyword string
+}
+
+// ParseDay Parses a day ("YYYY-MM-DD", local time).
+func ParseDay(day string) (time.Time, error) {
+	var err error
+	var date time.Time
+
+	if date, err = time.ParseInLocation("2006-01-02", day, time.Local); err != nil {
+		return date, fmt.Errorf(`invalid day "%s" (expected "YYYY-MM-DD")`, day)
+	}
+	return date, nil
+}
+
+// ParseDayRange Parses a range of days: "YYYY-MM-DD..YYYY-MM-DD", from the first day (included) to the second one
+// (excluded). One of the bounds may be omitted ("YYYY-MM-DD.." or "..YYYY-MM-DD"). It returns the bounds (a zero time
+// if omitted).
+func ParseDayRange(spec string) (time.Time, time.Time, error) {
+	var err error
+	var since, before time.Time
+	var first, second, found = strings.Cut(spec, "..")
+
+	if !found || (len(first) == 0 && len(second) == 0) {
+		return since, before, fmt.Errorf(`invalid range of days "%s" (expected "YYYY-MM-DD..YYYY-MM-DD")`, spec)
+	}
+	if len(first) > 0 {
+		if since, err = ParseDay(first); err != nil {
+			return since, before, err
+		}
+	}
+	if len(second) > 0 {
+		if before, err = ParseDay(second); err != nil {
+			return since, before, err
+		}
+	}
+	if !since.IsZero() && !before.IsZero() && !since.Before(before) {
+		return since, before, fmt.Errorf(`invalid range of days "%s": the first day must precede the second one`, spec)
+	}
+	return since, before, nil
+}
+
+// ParseHeaderCriterion Parses a criterion on a header: "Name: text" (or "Name" for the emails that have the header).
+func ParseHeaderCriterion(spec string) (string, string, error) {
+	var name, value, _ = strings.Cut(spec, ":")
+
+	if name = strings.TrimSpace(name); len(name) == 0 || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf(`invalid header criterion "%s" (expected "Name: text")`, spec)
+	}
+	return textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value), nil
+}
+
+// IsEmpty Tells whether no criterion is given (all the emails match).
+func (f EmailFilter) IsEmpty() bool {
+	return len(f.From) == 0 && f.Since.IsZero() && f.Before.IsZero() && len(f.Subject) == 0 && len(f.HeaderName) == 0 &&
+		len(f.Marker) == 0 && len(f.SkipKeyword) == 0
+}
+
+// String Returns the criteria, as a query ("from=...&subject=..."), or an empty text if no criterion is given.
+func (f EmailFilter) String() string {
+	var values = url.Values{}
+
+	for name, value := range map[string]string{"from": f.From, "subject": f.Subject, "marker": f.Marker, "skip": f.SkipKeyword} {
+		if len(value) > 0 {
+			values.Set(name, value)
+		}
+	}
+	if !f.Since.IsZero() {
+		values.Set("since", f.Since.Format("2006-01-02"))
+	}
+	if !f.Before.IsZero() {
+		values.Set("before", f.Before.Format("2006-01-02"))
+	}
+	if len(f.HeaderName) > 0 {
+		values.Set("header", f.HeaderName+": "+f.HeaderValue)
+	}
+	return values.Encode()
+}
+
+// MatchEnvelope Tells whether an email matches the criteria on its envelope: its sender, its subject and the date it
+// was received.
+func (f EmailFilter) MatchEnvelope(from string, subject string, received time.Time) bool {
+	if len(f.From) > 0 && !strings.EqualFold(f.From, from) {
+		return false
+	}
+	if !f.Since.IsZero() && received.Before(f.Since) {
+		return false
+	}
+	if !f.Before.IsZero() && !received.Before(f.Before) {
+		return false
+	}
+	return len(f.Subject) == 0 || containsFold(subject, f.Subject)
+}
+
+// MatchHeader Tells whether the headers of an email match the criterion on a header, and the marker.
+func (f EmailFilter) MatchHeader(header textproto.MIMEHeader) bool {
+	if len(f.Marker) > 0 && !matchHeaderValue(header, "Message-Id", f.Marker) {
+		return false
+	}
+	return len(f.HeaderName) == 0 || matchHeaderValue(header, f.HeaderName, f.HeaderValue)
+}
+
+// matchHeaderValue Tells whether one of the values of a header contains a given text (case-insensitive).
+func matchHeaderValue(header textproto.MIMEHeader, name string, text string) bool {
+	for _, value := range header.Values(name) {
+		if containsFold(value, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold Tells whether a text contains another text (case-insensitive).
+func containsFold(text string, part string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(part))
+}
+
+// EmailWindow Bounds the number of emails examined (see "rcv"), among the ones that match the criteria: the most
+// recent ones (`Last`), or a page of them (`Page`, from 1, the first page holding the most recent emails). The zero
+// window examines all the emails.
+type EmailWindow struct {
+	Last     int
+	Page     int
+	PageSize int
+}
+
+// IsEmpty Tells whether the window examines all the emails.
+func (w EmailWindow) IsEmpty() bool {
+	return w.Last == 0 && w.Page == 0
+}
+
+// Validate Checks the window.
+func (w EmailWindow) Validate() error {
+	if w.Last < 0 || w.Page < 0 {
+		return fmt.Errorf(`invalid number of emails (%d) or page (%d): expected a positive number`, w.Last, w.Page)
+	}
+	if w.Last > 0 && w.Page > 0 {
+		return fmt.Errorf(`either the most recent emails or a page of emails can be examined, not both`)
+	}
+	if w.Page > 0 && w.PageSize < 1 {
+		return fmt.Errorf(`invalid page size (%d): a page holds at least one email`, w.PageSize)
+	}
+	return nil
+}
+
+// Pages Returns the number of pages, given the number of emails that match the criteria.
+func (w EmailWindow) Pages(count int) int {
+	if w.PageSize < 1 {
+		return 0
+	}
+	return (count + w.PageSize - 1) / w.PageSize
+}
+
+// Apply Returns the emails examined, given the ones that match the criteria (from the oldest to the most recent). The
+// order is kept.
+func (w EmailWindow) Apply(nums []uint32) []uint32 {
+	var end, start int
+
+	switch {
+	case w.Last > 0:
+		if w.Last < len(nums) {
+			return nums[len(nums)-w.Last:]
+		}
+		return nums
+	case w.Page > 0:
+		if end = len(nums) - (w.Page-1)*w.PageSize; end <= 0 {
+			return nil
+		}
+		if start = end - w.PageSize; start < 0 {
+			start = 0
+		}
+		return nums[start:end]
+	}
+	return nums
+}
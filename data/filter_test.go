@@ -0,0 +1,116 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+func TestParseHeaderCriterion(t *testing.T) {
+	var err error
+	var name, value string
+
+	name, value, err = ParseHeaderCriterion("x-mailer: Thunderbird")
+	assert.Nil(t, err)
+	assert.Equal(t, "X-Mailer", name)
+	assert.Equal(t, "Thunderbird", value)
+	name, value, err = ParseHeaderCriterion("In-Reply-To")
+	assert.Nil(t, err)
+	assert.Equal(t, "In-Reply-To", name)
+	assert.Equal(t, "", value)
+	for _, spec := range []string{"", ": value", "X Mailer: value"} {
+		_, _, err = ParseHeaderCriterion(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
+
+func TestEmailFilter(t *testing.T) {
+	var since = time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+	var received = time.Date(2024, 3, 9, 10, 0, 0, 0, time.UTC)
+	var filter = EmailFilter{From: "john@example.com", Since: since, Subject: "news", HeaderName: "X-Mailer", HeaderValue: "thunderbird"}
+	var header = textproto.MIMEHeader{"X-Mailer": {"Mozilla Thunderbird"}}
+
+	assert.True(t, EmailFilter{}.IsEmpty())
+	assert.True(t, EmailFilter{}.MatchEnvelope("jane@example.com", "Hello", received))
+	assert.True(t, EmailFilter{}.MatchHeader(textproto.MIMEHeader{}))
+
+	assert.Equal(t, "", EmailFilter{}.String())
+	assert.Equal(t, "from=john%40example.com&header=X-Mailer%3A+thunderbird&since=2024-03-08&subject=news", filter.String())
+
+	assert.False(t, filter.IsEmpty())
+	assert.True(t, filter.MatchEnvelope("John@Example.com", "Latest News", received))
+	assert.False(t, filter.MatchEnvelope("jane@example.com", "Latest News", received))
+	assert.False(t, filter.MatchEnvelope("john@example.com", "Hello", received))
+	assert.False(t, filter.MatchEnvelope("john@example.com", "Latest News", since.Add(-time.Hour)))
+	assert.True(t, filter.MatchHeader(header))
+	assert.False(t, filter.MatchHeader(textproto.MIMEHeader{"X-Mailer": {"Outlook"}}))
+	assert.False(t, filter.MatchHeader(textproto.MIMEHeader{}))
+}
+
+func TestEmailFilterMarker(t *testing.T) {
+	var filter = EmailFilter{Marker: "1a2b3c4d"}
+
+	assert.False(t, filter.IsEmpty())
+	assert.Equal(t, "marker=1a2b3c4d", filter.String())
+	assert.True(t, filter.MatchHeader(textproto.MIMEHeader{"Message-Id": {"<1A2B3C4D-0000-4000-8000-000000000000@example.com>"}}))
+	assert.False(t, filter.MatchHeader(textproto.MIMEHeader{"Message-Id": {"<0000ffff@example.com>"}}))
+	assert.False(t, filter.MatchHeader(textproto.MIMEHeader{}))
+	filter.HeaderName = "X-Mailer"
+	assert.False(t, filter.MatchHeader(textproto.MIMEHeader{"Message-Id": {"<1a2b3c4d@example.com>"}}))
+}
+
+func TestParseDayRange(t *testing.T) {
+	var err error
+	var since, before time.Time
+
+	since, before, err = ParseDayRange("2024-01-01..2024-02-01")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), since)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local), before)
+	since, before, err = ParseDayRange("2024-01-01..")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), since)
+	assert.True(t, before.IsZero())
+	since, before, err = ParseDayRange("..2024-02-01")
+	assert.Nil(t, err)
+	assert.True(t, since.IsZero())
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local), before)
+	for _, spec := range []string{"", "..", "2024-01-01", "2024-01-01..2024-13-01", "2024-02-01..2024-01-01", "2024-01-01..2024-01-01"} {
+		_, _, err = ParseDayRange(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
+
+func TestEmailFilterBefore(t *testing.T) {
+	var filter = EmailFilter{Before: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}
+
+	assert.False(t, filter.IsEmpty())
+	assert.Equal(t, "before=2024-02-01", filter.String())
+	assert.True(t, filter.MatchEnvelope("john@example.com", "Hello", time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC)))
+	assert.False(t, filter.MatchEnvelope("john@example.com", "Hello", filter.Before))
+
+	assert.False(t, EmailFilter{SkipKeyword: "$Decoded"}.IsEmpty())
+	assert.Equal(t, "skip=%24Decoded", EmailFilter{SkipKeyword: "$Decoded"}.String())
+}
+
+func TestEmailWindow(t *testing.T) {
+	var nums = []uint32{1, 2, 3, 4, 5, 6, 7}
+
+	assert.True(t, EmailWindow{PageSize: 50}.IsEmpty())
+	assert.Equal(t, nums, EmailWindow{}.Apply(nums))
+	assert.Equal(t, []uint32{5, 6, 7}, EmailWindow{Last: 3}.Apply(nums))
+	assert.Equal(t, nums, EmailWindow{Last: 10}.Apply(nums))
+
+	// The first page holds the most recent emails.
+	assert.Equal(t, []uint32{5, 6, 7}, EmailWindow{Page: 1, PageSize: 3}.Apply(nums))
+	assert.Equal(t, []uint32{2, 3, 4}, EmailWindow{Page: 2, PageSize: 3}.Apply(nums))
+	assert.Equal(t, []uint32{1}, EmailWindow{Page: 3, PageSize: 3}.Apply(nums))
+	assert.Nil(t, EmailWindow{Page: 4, PageSize: 3}.Apply(nums))
+	assert.Equal(t, 3, EmailWindow{Page: 1, PageSize: 3}.Pages(len(nums)))
+
+	assert.Nil(t, EmailWindow{Page: 1, PageSize: 3}.Validate())
+	assert.NotNil(t, EmailWindow{Last: -1}.Validate())
+	assert.NotNil(t, EmailWindow{Last: 3, Page: 1, PageSize: 3}.Validate())
+	assert.NotNil(t, EmailWindow{Page: 1}.Validate())
+}
@@ -0,0 +1,277 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GmailSendURL The endpoint of the Gmail API used to send an email (users.messages.send).
+const GmailSendURL = "https://gmail.googleapis.com/gmail/v1/users/me/messages/send"
+
+// GmailURL The base URL of the Gmail API, for the mailbox of the user whose OAuth2 token is used (see "rcv").
+const GmailURL = "https://gmail.googleapis.com/gmail/v1/users/me"
+
+// gmailMaxResponse The maximum length of a response of the Gmail API (including a downloaded email, encoded in
+// base64).
+const gmailMaxResponse = 100 << 20
+
+// gmailPageSize The number of messages requested per page when the messages of a label are listed.
+const gmailPageSize = 500
+
+// gmailResponse The response of the Gmail API (only the relevant fields).
+type gmailResponse struct {
+	Id    string `json:"id"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// GmailSend Submits an email (RFC 5322) through the Gmail API, using an OAuth2 access token. The email is sent as is:
+// its headers (including the boundary of the MIME parts) are kept. Returns the identifier of the email given by Gmail.
+func GmailSend(client *http.Client, endpoint string, accessToken string, message []byte) (string, error) {
+	var err error
+	var payload []byte
+	var request *http.Request
+	var response *http.Response
+	var body []byte
+	var result gmailResponse
+
+	if payload, err = json.Marshal(map[string]string{"raw": base64.URLEncoding.EncodeToString(message)}); err != nil {
+		return "", err
+	}
+	if request, err = http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload)); err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	request.Header.Set("Content-Type", "application/json")
+	if response, err = client.Do(request); err != nil {
+		return "", fmt.Errorf(`cannot submit the email to the Gmail API: %w`, err)
+	}
+	defer response.Body.Close()
+	if body, err = io.ReadAll(io.LimitReader(response.Body, 1<<20)); err != nil {
+		return "", fmt.Errorf(`cannot read the response of the Gmail API: %s`, err.Error())
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf(`invalid response from the Gmail API (status %d)`, response.StatusCode)
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf(`the Gmail API rejected the email: %s (%d)`, result.Error.Message, result.Error.Code)
+	}
+	if response.StatusCode != http.StatusOK || len(result.Id) == 0 {
+		return "", fmt.Errorf(`unexpected response from the Gmail API (status %d)`, response.StatusCode)
+	}
+	return result.Id, nil
+}
+
+// GmailMessage The description of a message, as returned by the Gmail API (users.messages.get, format "metadata").
+type GmailMessage struct {
+	Id string
+	// Received The date the message was received by Gmail.
+	Received time.Time
+	// Header The headers of the message (as received).
+	Header mail.Header
+}
+
+// GmailClient A client of the Gmail API, limited to the retrieval of the messages of the mailbox of the user whose
+// OAuth2 access token is used.
+type GmailClient struct {
+	client      *http.Client
+	baseURL     string
+	accessToken string
+}
+
+// gmailError An error returned by the Gmail API.
+type gmailError struct {
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewGmailClient Creates a client of the Gmail API (`baseURL` is `GmailURL`, unless testing).
+func NewGmailClient(client *http.Client, baseURL string, accessToken string) *GmailClient {
+	return &GmailClient{client: client, baseURL: baseURL, accessToken: accessToken}
+}
+
+// LabelId Returns the ID of a label (the Gmail equivalent of a mailbox), given its name. The names of the system labels
+// (such as "INBOX") are their IDs.
+func (c *GmailClient) LabelId(name string) (string, error) {
+	var err error
+	var body []byte
+	var result struct {
+		Labels []struct {
+			Id   string `json:"id"`
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"labels"`
+	}
+
+	if strings.EqualFold(name, "INBOX") {
+		return "INBOX", nil
+	}
+	if body, err = c.request(c.baseURL + "/labels"); err != nil {
+		return "", err
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf(`invalid response from the Gmail API: %s`, err.Error())
+	}
+	for _, label := range result.Labels {
+		if strings.EqualFold(label.Name, name) || label.Id == name {
+			return label.Id, nil
+		}
+	}
+	return "", fmt.Errorf(`unknown label "%s"`, name)
+}
+
+// QueryMessages Returns the IDs of the messages of a label that match a filter, the oldest first. The server evaluates
+// the sender and the days; the other criteria are left to the caller.
+func (c *GmailClient) QueryMessages(labelId string, filter EmailFilter) ([]string, error) {
+	var err error
+	var ids []string
+	var query = url.Values{
+		"labelIds":   {labelId},
+		"maxResults": {strconv.Itoa(gmailPageSize)},
+	}
+
+	if q := GmailQuery(filter); len(q) > 0 {
+		query.Set("q", q)
+	}
+	for {
+		var body []byte
+		var page struct {
+			Messages []struct {
+				Id string `json:"id"`
+			} `json:"messages"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+
+		if body, err = c.request(c.baseURL + "/messages?" + query.Encode()); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf(`invalid response from the Gmail API: %s`, err.Error())
+		}
+		for _, message := range page.Messages {
+			ids = append(ids, message.Id)
+		}
+		if len(page.NextPageToken) == 0 {
+			break
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+	// The messages are listed the most recent first.
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids, nil
+}
+
+// GmailQuery Returns the search query (in the syntax of the search box of Gmail) that selects the emails sent by the
+// sender of a filter, during its days. It returns an empty text if the filter gives none of these criteria.
+func GmailQuery(filter EmailFilter) string {
+	var terms []string
+
+	if len(filter.From) > 0 {
+		terms = append(terms, "from:"+filter.From)
+	}
+	// The dates are given in seconds (instead of days), so that the days are the local ones.
+	if !filter.Since.IsZero() {
+		terms = append(terms, fmt.Sprintf("after:%d", filter.Since.Unix()-1))
+	}
+	if !filter.Before.IsZero() {
+		terms = append(terms, fmt.Sprintf("before:%d", filter.Before.Unix()))
+	}
+	return strings.Join(terms, " ")
+}
+
+// GetMessage Returns the description of a message: the date it was received and its headers.
+func (c *GmailClient) GetMessage(id string) (GmailMessage, error) {
+	var err error
+	var body []byte
+	var message = GmailMessage{Id: id, Header: mail.Header{}}
+	var result struct {
+		InternalDate string `json:"internalDate"`
+		Payload      struct {
+			Headers []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"headers"`
+		} `json:"payload"`
+	}
+
+	if body, err = c.request(fmt.Sprintf("%s/messages/%s?format=metadata", c.baseURL, url.PathEscape(id))); err != nil {
+		return message, err
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return message, fmt.Errorf(`invalid response from the Gmail API: %s`, err.Error())
+	}
+	if milliseconds, err := strconv.ParseInt(result.InternalDate, 10, 64); err == nil {
+		message.Received = time.UnixMilli(milliseconds)
+	}
+	for _, header := range result.Payload.Headers {
+		var name = textproto.CanonicalMIMEHeaderKey(header.Name)
+		message.Header[name] = append(message.Header[name], header.Value)
+	}
+	return message, nil
+}
+
+// Download Returns the content of a message (RFC 5322), as received.
+func (c *GmailClient) Download(id string) ([]byte, error) {
+	var err error
+	var body []byte
+	var content []byte
+	var result struct {
+		Raw string `json:"raw"`
+	}
+
+	if body, err = c.request(fmt.Sprintf("%s/messages/%s?format=raw", c.baseURL, url.PathEscape(id))); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf(`invalid response from the Gmail API: %s`, err.Error())
+	}
+	// The content is encoded in base64 ("URL and filename safe" alphabet), with or without padding.
+	if content, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(result.Raw, "=")); err != nil {
+		return nil, fmt.Errorf(`invalid content returned by the Gmail API: %s`, err.Error())
+	}
+	return content, nil
+}
+
+// request Sends a GET request to the Gmail API, and returns the body of the response.
+func (c *GmailClient) request(endpoint string) ([]byte, error) {
+	var err error
+	var request *http.Request
+	var response *http.Response
+	var body []byte
+	var apiError gmailError
+
+	if request, err = http.NewRequest(http.MethodGet, endpoint, nil); err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.accessToken)
+	if response, err = c.client.Do(request); err != nil {
+		return nil, fmt.Errorf(`cannot send the request to the Gmail API: %w`, err)
+	}
+	defer response.Body.Close()
+	if body, err = io.ReadAll(io.LimitReader(response.Body, gmailMaxResponse)); err != nil {
+		return nil, fmt.Errorf(`cannot read the response of the Gmail API: %s`, err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		if json.Unmarshal(body, &apiError) == nil && apiError.Error != nil {
+			return nil, fmt.Errorf(`the Gmail API rejected the request: %s (%d)`, apiError.Error.Message, apiError.Error.Code)
+		}
+		return nil, fmt.Errorf(`unexpected response from the Gmail API (status %d)`, response.StatusCode)
+	}
+	return body, nil
+}
@@ -0,0 +1,129 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGmailSend(t *testing.T) {
+	var err error
+	var server *httptest.Server
+	var id string
+	var received []byte
+	var message = []byte("Content-Type: multipart/alternative;  boundary=\"0a1b\"\r\nTo: john@example.com\r\n\r\n--0a1b--\r\n")
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"error":{"code":401,"message":"Invalid Credentials"}}`)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		received, _ = base64.URLEncoding.DecodeString(payload["raw"])
+		_, _ = fmt.Fprint(w, `{"id":"18c2","threadId":"18c2","labelIds":["SENT"]}`)
+	}))
+	defer server.Close()
+
+	id, err = GmailSend(server.Client(), server.URL, "good", message)
+	assert.Nil(t, err)
+	assert.Equal(t, "18c2", id)
+	// The email is sent as is.
+	assert.Equal(t, message, received)
+
+	_, err = GmailSend(server.Client(), server.URL, "bad", message)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Invalid Credentials")
+}
+
+func TestGmailClient(t *testing.T) {
+	var err error
+	var server *httptest.Server
+	var client *GmailClient
+	var labelId string
+	var ids []string
+	var message GmailMessage
+	var content []byte
+	var queries []string
+	var email = "Subject: Hi\r\nContent-Type: multipart/alternative; boundary=\"0a1b\"\r\n\r\n--0a1b--\r\n"
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"error":{"code":401,"message":"Invalid Credentials"}}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/labels":
+			_, _ = fmt.Fprint(w, `{"labels":[{"id":"INBOX","name":"INBOX","type":"system"},{"id":"Label_7","name":"Stegano","type":"user"}]}`)
+		case "/messages":
+			assert.Equal(t, "Label_7", r.URL.Query().Get("labelIds"))
+			queries = append(queries, r.URL.Query().Get("q"))
+			// Two pages, the most recent messages first.
+			if len(r.URL.Query().Get("pageToken")) == 0 {
+				_, _ = fmt.Fprint(w, `{"messages":[{"id":"m3","threadId":"t1"},{"id":"m2","threadId":"t1"}],"nextPageToken":"p2"}`)
+			} else {
+				_, _ = fmt.Fprint(w, `{"messages":[{"id":"m1","threadId":"t1"}]}`)
+			}
+		case "/messages/m1":
+			if r.URL.Query().Get("format") == "raw" {
+				_, _ = fmt.Fprintf(w, `{"id":"m1","raw":"%s"}`, base64.URLEncoding.EncodeToString([]byte(email)))
+				return
+			}
+			assert.Equal(t, "metadata", r.URL.Query().Get("format"))
+			_, _ = fmt.Fprint(w, `{"id":"m1","internalDate":"1704103200000","payload":{"headers":[`+
+				`{"name":"Subject","value":"Hi"},{"name":"To","value":"john@example.com"},{"name":"To","value":"jane@example.com"},`+
+				`{"name":"Message-ID","value":"<1a2b@example.com>"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"error":{"code":404,"message":"Requested entity was not found."}}`)
+		}
+	}))
+	defer server.Close()
+
+	client = NewGmailClient(server.Client(), server.URL, "good")
+	labelId, err = client.LabelId("inbox")
+	assert.Nil(t, err)
+	assert.Equal(t, "INBOX", labelId)
+	labelId, err = client.LabelId("stegano")
+	assert.Nil(t, err)
+	assert.Equal(t, "Label_7", labelId)
+	_, err = client.LabelId("Archive")
+	assert.NotNil(t, err)
+
+	ids, err = client.QueryMessages(labelId, EmailFilter{From: "bill@posteo.net", Subject: "Hi"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"m1", "m2", "m3"}, ids)
+	assert.Equal(t, []string{"from:bill@posteo.net", "from:bill@posteo.net"}, queries)
+
+	message, err = client.GetMessage("m1")
+	assert.Nil(t, err)
+	assert.True(t, message.Received.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "Hi", message.Header.Get("Subject"))
+	assert.Equal(t, []string{"john@example.com", "jane@example.com"}, message.Header["To"])
+	assert.Equal(t, "<1a2b@example.com>", message.Header.Get("Message-Id"))
+
+	content, err = client.Download("m1")
+	assert.Nil(t, err)
+	assert.Equal(t, email, string(content))
+
+	_, err = client.GetMessage("m9")
+	assert.ErrorContains(t, err, "Requested entity was not found.")
+	_, err = NewGmailClient(server.Client(), server.URL, "bad").LabelId("Stegano")
+	assert.ErrorContains(t, err, "Invalid Credentials")
+}
+
+func TestGmailQuery(t *testing.T) {
+	var since = time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+	var before = time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "", GmailQuery(EmailFilter{Subject: "news", Marker: "1a2b3c4d"}))
+	assert.Equal(t, "from:john@example.com after:1709855999 before:1709942400", GmailQuery(EmailFilter{From: "john@example.com", Since: since, Before: before}))
+}
@@ -0,0 +1,152 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// GraphURL The base URL of the Microsoft Graph API.
+const GraphURL = "https://graph.microsoft.com/v1.0"
+
+// graphMaxResponse The maximum length of a response of the Microsoft Graph API (the size of an email is limited to
+// 150 MB).
+const graphMaxResponse = 150 << 20
+
+// graphPageSize The number of messages requested per page when the messages of a folder are listed.
+const graphPageSize = 50
+
+// GraphMessage The description of a message, as listed by the Microsoft Graph API.
+type GraphMessage struct {
+	Id       string
+	Subject  string
+	From     string
+	To       []string
+	Cc       []string
+	Received time.Time
+	// Sent The date the message was sent, zero if unknown (a draft).
+	Sent time.Time
+}
+
+// graphRecipient A recipient, as represented by the Microsoft Graph API.
+type graphRecipient struct {
+	EmailAddress struct {
+		Address string `json:"address"`
+	} `json:"emailAddress"`
+}
+
+// graphMessages A page of messages, as returned by the Microsoft Graph API.
+type graphMessages struct {
+	Value []struct {
+		Id               string           `json:"id"`
+		Subject          string           `json:"subject"`
+		From             *graphRecipient  `json:"from"`
+		ToRecipients     []graphRecipient `json:"toRecipients"`
+		CcRecipients     []graphRecipient `json:"ccRecipients"`
+		ReceivedDateTime time.Time        `json:"receivedDateTime"`
+		SentDateTime     *time.Time       `json:"sentDateTime"`
+	} `json:"value"`
+	NextLink string `json:"@odata.nextLink"`
+}
+
+// graphError An error returned by the Microsoft Graph API.
+type graphError struct {
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// GraphSend Submits an email (RFC 5322) through the Microsoft Graph API (sendMail, with MIME content), using an OAuth2
+// access token. The email is sent as is: its headers (including the boundary of the MIME parts) are kept.
+func GraphSend(client *http.Client, baseURL string, accessToken string, message []byte) error {
+	var err error
+	var payload = []byte(base64.StdEncoding.EncodeToString(message))
+
+	_, err = graphRequest(client, http.MethodPost, baseURL+"/me/sendMail", accessToken, "text/plain", payload, http.StatusAccepted)
+	return err
+}
+
+// GraphListMessages Returns the messages of a folder (for example, "inbox"), the oldest first.
+func GraphListMessages(client *http.Client, baseURL string, accessToken string, folder string) ([]GraphMessage, error) {
+	var err error
+	var result []GraphMessage
+	var query = url.Values{
+		"$select":  {"id,subject,from,toRecipients,ccRecipients,receivedDateTime,sentDateTime"},
+		"$orderby": {"receivedDateTime asc"},
+		"$top":     {fmt.Sprintf("%d", graphPageSize)},
+	}
+	var next = fmt.Sprintf("%s/me/mailFolders/%s/messages?%s", baseURL, url.PathEscape(folder), query.Encode())
+
+	for len(next) > 0 {
+		var body []byte
+		var page graphMessages
+
+		if body, err = graphRequest(client, http.MethodGet, next, accessToken, "", nil, http.StatusOK); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf(`invalid response from the Microsoft Graph API: %s`, err.Error())
+		}
+		for _, value := range page.Value {
+			var message = GraphMessage{Id: value.Id, Subject: value.Subject, Received: value.ReceivedDateTime}
+			if value.SentDateTime != nil {
+				message.Sent = *value.SentDateTime
+			}
+			if value.From != nil {
+				message.From = value.From.EmailAddress.Address
+			}
+			for _, recipient := range value.ToRecipients {
+				message.To = append(message.To, recipient.EmailAddress.Address)
+			}
+			for _, recipient := range value.CcRecipients {
+				message.Cc = append(message.Cc, recipient.EmailAddress.Address)
+			}
+			result = append(result, message)
+		}
+		next = page.NextLink
+	}
+	return result, nil
+}
+
+// GraphMessageContent Returns the content of a message (RFC 5322), as received.
+func GraphMessageContent(client *http.Client, baseURL string, accessToken string, id string) ([]byte, error) {
+	return graphRequest(client, http.MethodGet, fmt.Sprintf("%s/me/messages/%s/$value", baseURL, url.PathEscape(id)), accessToken, "", nil, http.StatusOK)
+}
+
+// graphRequest Sends a request to the Microsoft Graph API, and returns the body of the response. The status of the
+// response must be `expected`.
+func graphRequest(client *http.Client, method string, endpoint string, accessToken string, contentType string, payload []byte, expected int) ([]byte, error) {
+	var err error
+	var request *http.Request
+	var response *http.Response
+	var body []byte
+	var apiError graphError
+
+	if request, err = http.NewRequest(method, endpoint, bytes.NewReader(payload)); err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	if len(contentType) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if response, err = client.Do(request); err != nil {
+		return nil, fmt.Errorf(`cannot send the request to the Microsoft Graph API: %w`, err)
+	}
+	defer response.Body.Close()
+	if body, err = io.ReadAll(io.LimitReader(response.Body, graphMaxResponse)); err != nil {
+		return nil, fmt.Errorf(`cannot read the response of the Microsoft Graph API: %s`, err.Error())
+	}
+	if response.StatusCode != expected {
+		if json.Unmarshal(body, &apiError) == nil && apiError.Error != nil {
+			return nil, fmt.Errorf(`the Microsoft Graph API rejected the request: %s (%s)`, apiError.Error.Message, apiError.Error.Code)
+		}
+		return nil, fmt.Errorf(`unexpected response from the Microsoft Graph API (status %d)`, response.StatusCode)
+	}
+	return body, nil
+}
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGraphSend(t *testing.T) {
+	var err error
+	var server *httptest.Server
+	var received []byte
+	var message = []byte("Content-Type: multipart/alternative;  boundary=\"0a1b\"\r\nTo: john@example.com\r\n\r\n--0a1b--\r\n")
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"error":{"code":"InvalidAuthenticationToken","message":"Access token has expired."}}`)
+			return
+		}
+		assert.Equal(t, "/me/sendMail", r.URL.Path)
+		assert.Equal(t, "text/plain", r.Header.Get("Content-Type"))
+		body, _ = io.ReadAll(r.Body)
+		received, _ = base64.StdEncoding.DecodeString(string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	err = GraphSend(server.Client(), server.URL, "good", message)
+	assert.Nil(t, err)
+	// The email is sent as is.
+	assert.Equal(t, message, received)
+
+	err = GraphSend(server.Client(), server.URL, "bad", message)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "InvalidAuthenticationToken")
+}
+
+func TestGraphListMessages(t *testing.T) {
+	var err error
+	var server *httptest.Server
+	var messages []GraphMessage
+	var content []byte
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/me/mailFolders/inbox/messages" && r.URL.Query().Get("page") == "":
+			_, _ = fmt.Fprintf(w, `{"value":[{"id":"A","subject":"Hi","from":{"emailAddress":{"address":"jane@example.com"}},"toRecipients":[{"emailAddress":{"address":"john@example.com"}}],"receivedDateTime":"2024-01-02T03:04:05Z","sentDateTime":"2024-01-02T03:04:01Z"}],"@odata.nextLink":"%s/me/mailFolders/inbox/messages?page=2"}`, "http://"+r.Host)
+		case r.URL.Path == "/me/mailFolders/inbox/messages":
+			_, _ = fmt.Fprint(w, `{"value":[{"id":"B","subject":"Re: Hi","ccRecipients":[{"emailAddress":{"address":"joe@example.com"}}]}]}`)
+		case r.URL.Path == "/me/messages/A/$value":
+			_, _ = fmt.Fprint(w, "Subject: Hi\r\n\r\nHello\r\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"error":{"code":"ErrorItemNotFound","message":"Not found."}}`)
+		}
+	}))
+	defer server.Close()
+
+	messages, err = GraphListMessages(server.Client(), server.URL, "token", "inbox")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, "A", messages[0].Id)
+	assert.Equal(t, "jane@example.com", messages[0].From)
+	assert.Equal(t, []string{"john@example.com"}, messages[0].To)
+	assert.Equal(t, 2024, messages[0].Received.Year())
+	assert.Equal(t, 1, messages[0].Sent.Second())
+	assert.True(t, messages[1].Sent.IsZero())
+	assert.Equal(t, "", messages[1].From)
+	assert.Equal(t, []string{"joe@example.com"}, messages[1].Cc)
+
+	content, err = GraphMessageContent(server.Client(), server.URL, "token", "A")
+	assert.Nil(t, err)
+	assert.Equal(t, "Subject: Hi\r\n\r\nHello\r\n", string(content))
+	_, err = GraphMessageContent(server.Client(), server.URL, "token", "C")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "ErrorItemNotFound")
+}
@@ -0,0 +1,182 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// headerOrderCarrierLength The number of bytes hidden by the order of the headers of an email: the headers written
+// by all the mail clients (with the optional headers, see `optionalHeaders`) can be ordered in more than 2^16 ways.
+const headerOrderCarrierLength = 2
+
+// orderedHeaderNames The headers whose order hides bytes, in their reference order: the headers written by the mail
+// clients (see `MailClient.Headers`), and the optional headers. The "Bcc" header is not ordered, since it is removed
+// before the email is sent.
+var orderedHeaderNames = []string{"From", "To", "Cc", "Subject", "Date", "Message-ID", "In-Reply-To", "References",
+	"MIME-Version", "Content-Type", "User-Agent", "Content-Language", "X-Mailer", "Thread-Topic", "X-Priority",
+	"Importance", "X-MSMail-Priority"}
+
+// optionalHeaders The headers added to the emails whose headers are ordered (unless already written), so that more
+// headers are ordered. They do not change how the emails are shown.
+var optionalHeaders = Headers{
+	{Name: "X-Priority", Value: "3"},
+	{Name: "Importance", Value: "normal"},
+	{Name: "X-MSMail-Priority", Value: "Normal"},
+}
+
+// OrderHeaders Returns the headers of an email, ordered so that they hide bytes of a chunk of the message (see
+// `CarrierHeaderOrder`): the optional headers are added, and the permutation of the ordered headers (relative to their
+// reference order) gives the bytes. The other headers keep their positions.
+func OrderHeaders(headers Headers, payload []byte) (Headers, error) {
+	var value uint64
+	var ordered Headers
+	var result Headers
+	var slots []int
+
+	for _, optional := range optionalHeaders {
+		if len(headers.Get(optional.Name)) == 0 {
+			headers = append(headers, optional)
+		}
+	}
+	for i, header := range headers {
+		if orderedHeaderIndex(header.Name) >= 0 {
+			ordered = append(ordered, header)
+			slots = append(slots, i)
+		}
+	}
+	if capacity := orderCapacity(len(ordered)); len(payload) > capacity {
+		return nil, fmt.Errorf(`the order of the headers of the email hides up to %d bytes (%d given)`, capacity, len(payload))
+	}
+	for _, b := range payload {
+		value = value<<8 | uint64(b)
+	}
+	// The ordered headers are sorted in the reference order, and the value selects their permutation (factorial
+	// number system).
+	sortHeaders(ordered)
+	result = make(Headers, len(headers))
+	copy(result, headers)
+	for _, slot := range slots {
+		var remaining = uint64(len(ordered))
+		var index = value / factorial(remaining-1)
+
+		value %= factorial(remaining - 1)
+		result[slot] = ordered[index]
+		ordered = append(ordered[:index:index], ordered[index+1:]...)
+	}
+	return result, nil
+}
+
+// HeaderOrderPayload Extracts the bytes hidden by the order of the headers of an email (see `OrderHeaders`): `length`
+// bytes. The headers added to the email on its way (such as "Received") are ignored.
+func HeaderOrderPayload(content []byte, length int) ([]byte, error) {
+	var err error
+	var names []string
+	var seen = map[int]bool{}
+	var ordered []int
+	var value uint64
+	var payload = make([]byte, length)
+
+	if names, err = HeaderNames(content); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		var index = orderedHeaderIndex(name)
+		if index < 0 {
+			continue
+		}
+		if seen[index] {
+			return nil, fmt.Errorf(`the header "%s" is written more than once: its order hides no bytes`, name)
+		}
+		seen[index] = true
+		ordered = append(ordered, index)
+	}
+	if capacity := orderCapacity(len(ordered)); length > capacity {
+		return nil, fmt.Errorf(`the order of the headers of the email hides up to %d bytes (%d expected)`, capacity, length)
+	}
+	// The rank of the permutation, relative to the reference order.
+	for i, index := range ordered {
+		var smaller uint64
+		for _, next := range ordered[i+1:] {
+			if next < index {
+				smaller++
+			}
+		}
+		value += smaller * factorial(uint64(len(ordered)-i-1))
+	}
+	if value>>(8*uint(length)) != 0 {
+		return nil, fmt.Errorf(`the order of the headers of the email hides no bytes`)
+	}
+	for i := length - 1; i >= 0; i-- {
+		payload[i] = byte(value)
+		value >>= 8
+	}
+	return payload, nil
+}
+
+// HeaderNames Returns the names of the headers of an email (RFC 5322), in the order they are written.
+func HeaderNames(content []byte) ([]string, error) {
+	var err error
+	var names []string
+	var reader = bufio.NewReader(bytes.NewReader(content))
+
+	for {
+		var line string
+		if line, err = reader.ReadString('\n'); err != nil && len(line) == 0 {
+			return nil, fmt.Errorf(`the email has no body`)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			break
+		}
+		// The continuation lines of the folded headers start with a space.
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if name, _, found := strings.Cut(line, ":"); found {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	return names, nil
+}
+
+// orderedHeaderIndex Returns the position of a header in the reference order (see `orderedHeaderNames`), or -1 if its
+// order hides no bytes.
+func orderedHeaderIndex(name string) int {
+	for i, ordered := range orderedHeaderNames {
+		if strings.EqualFold(name, ordered) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortHeaders Sorts headers in the reference order (see `orderedHeaderNames`).
+func sortHeaders(headers Headers) {
+	for i := 1; i < len(headers); i++ {
+		for j := i; j > 0 && orderedHeaderIndex(headers[j].Name) < orderedHeaderIndex(headers[j-1].Name); j-- {
+			headers[j], headers[j-1] = headers[j-1], headers[j]
+		}
+	}
+}
+
+// orderCapacity Returns the number of bytes hidden by the order of `count` headers: count! >= 2^(8 x bytes).
+func orderCapacity(count int) int {
+	var capacity int
+
+	for capacity < 8 && factorial(uint64(count))>>(8*uint(capacity+1)) > 0 {
+		capacity++
+	}
+	return capacity
+}
+
+// factorial Returns n! (n <= 20).
+func factorial(n uint64) uint64 {
+	var result uint64 = 1
+
+	for i := uint64(2); i <= n; i++ {
+		result *= i
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrderHeaders(t *testing.T) {
+	var err error
+
+	for _, client := range []MailClient{ClientDefault, ClientThunderbird, ClientOutlook} {
+		var headers = client.Headers(EmailFields{
+			From:        "a@example.com",
+			To:          "b@example.com",
+			Bcc:         "c@example.com",
+			Subject:     "Hello",
+			MessageID:   "<0123@example.com>",
+			Date:        time.Now(),
+			ContentType: "multipart/alternative",
+		})
+
+		for _, payload := range [][]byte{{0, 0}, {0, 1}, {0xA5, 0x3C}, {0xFF, 0xFF}} {
+			var ordered Headers
+			var extracted []byte
+			var content string
+
+			ordered, err = OrderHeaders(headers, payload)
+			assert.Nil(t, err)
+			assert.Equal(t, len(headers)+len(optionalHeaders), len(ordered))
+			assert.Equal(t, "3", ordered.Get("X-Priority"))
+			// The headers that are not ordered keep their positions.
+			for i, header := range headers {
+				if orderedHeaderIndex(header.Name) < 0 {
+					assert.Equal(t, header, ordered[i])
+				}
+			}
+			// The headers added on the way are ignored.
+			content = "Received: from relay\r\n" + StripBcc(ordered.String()+"\r\nHello")
+			extracted, err = HeaderOrderPayload([]byte(content), len(payload))
+			assert.Nil(t, err)
+			assert.Equal(t, payload, extracted, client.Name())
+		}
+	}
+
+	// We'll get errors...
+	_, err = OrderHeaders(Headers{{Name: "From", Value: "a@example.com"}}, []byte{1, 2})
+	assert.NotNil(t, err)
+	_, err = HeaderOrderPayload([]byte("From: a\r\nTo: b\r\n\r\nHello"), 2)
+	assert.NotNil(t, err)
+	_, err = HeaderOrderPayload([]byte("From: a\r\nFrom: b\r\nTo: c\r\n\r\nHello"), 1)
+	assert.NotNil(t, err)
+}
+
+func TestHeaderNames(t *testing.T) {
+	var err error
+	var names []string
+
+	names, err = HeaderNames([]byte("From: a@example.com\r\nSubject: a\r\n long subject\r\nX-Priority:3\r\n\r\nTo: body"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"From", "Subject", "X-Priority"}, names)
+	names, err = HeaderNames([]byte(strings.Repeat("To: b\n", 2) + "\nHello"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"To", "To"}, names)
+
+	// We'll get errors...
+	_, err = HeaderNames([]byte("From: a@example.com\r\n"))
+	assert.NotNil(t, err)
+}
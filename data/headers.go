@@ -0,0 +1,403 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// MailClient A mail client whose headers are mimicked by the emails (see `MailClient.Headers`).
+type MailClient string
+
+// The mail clients that can be mimicked. The default client produces a minimal, but complete, set of headers.
+const (
+	ClientDefault     MailClient = ""
+	ClientThunderbird MailClient = "thunderbird"
+	ClientOutlook     MailClient = "outlook"
+	ClientAppleMail   MailClient = "apple-mail"
+)
+
+// maxReferences The maximum number of message IDs in the "References" header of an email.
+const maxReferences = 10
+
+// dateFormat The format of the "Date" header (RFC 5322).
+const dateFormat = "Mon, 2 Jan 2006 15:04:05 -0700"
+
+// clientProfile The headers written by a mail client.
+type clientProfile struct {
+	// order The names of the headers, in the order they are written. The headers without value are omitted.
+	order []string
+	// fixed The headers that have a fixed value (such as "User-Agent").
+	fixed map[string]string
+	// replyPrefix The prefix of the subject of a reply.
+	replyPrefix string
+	// messageID Returns a message ID, given random bytes (16) and the domain of the sender.
+	messageID func(random []byte, domain string) string
+	// messageIDBytes The number of random bytes written into the message ID (the first ones).
+	messageIDBytes int
+}
+
+var clientProfiles = map[MailClient]clientProfile{
+	ClientDefault: {
+		order: []string{"From", "To", "Cc", "Bcc", "Subject", "Date", "Message-ID", "In-Reply-To", "References",
+			"MIME-Version", "Content-Type"},
+		fixed:       map[string]string{"MIME-Version": "1.0"},
+		replyPrefix: "Re: ",
+		messageID: func(random []byte, domain string) string {
+			return fmt.Sprintf("<%s@%s>", hex.EncodeToString(random), domain)
+		},
+		messageIDBytes: 16,
+	},
+	ClientThunderbird: {
+		order: []string{"Message-ID", "Date", "MIME-Version", "User-Agent", "Subject", "Content-Language", "To",
+			"Cc", "Bcc", "References", "From", "In-Reply-To", "Content-Type"},
+		fixed: map[string]string{
+			"MIME-Version":     "1.0",
+			"User-Agent":       "Mozilla Thunderbird",
+			"Content-Language": "en-US",
+		},
+		replyPrefix: "Re: ",
+		messageID: func(random []byte, domain string) string {
+			return fmt.Sprintf("<%s@%s>", uuid(random), domain)
+		},
+		messageIDBytes: 16,
+	},
+	ClientOutlook: {
+		order: []string{"From", "To", "Cc", "Bcc", "References", "In-Reply-To", "Subject", "Date", "Message-ID",
+			"MIME-Version", "Content-Type", "X-Mailer", "Thread-Topic", "Content-Language"},
+		fixed: map[string]string{
+			"MIME-Version":     "1.0",
+			"X-Mailer":         "Microsoft Outlook 16.0",
+			"Content-Language": "en-us",
+		},
+		replyPrefix: "RE: ",
+		messageID: func(random []byte, domain string) string {
+			return fmt.Sprintf("<0000%s$%s$%s$@%s>", hex.EncodeToString(random[:4]), hex.EncodeToString(random[4:8]),
+				hex.EncodeToString(random[8:12]), domain)
+		},
+		messageIDBytes: 12,
+	},
+	ClientAppleMail: {
+		order: []string{"Content-Type", "Mime-Version", "Subject", "From", "In-Reply-To", "Date", "References", "To",
+			"Cc", "Bcc", "Message-Id", "X-Mailer"},
+		fixed: map[string]string{
+			"Mime-Version": `1.0 (Mac OS X Mail 16.0 \(3774.500.171.1.1\))`,
+			"X-Mailer":     "Apple Mail (2.3774.500.171.1.1)",
+		},
+		replyPrefix: "Re: ",
+		messageID: func(random []byte, domain string) string {
+			return fmt.Sprintf("<%s@%s>", strings.ToUpper(uuid(random)), domain)
+		},
+		messageIDBytes: 16,
+	},
+}
+
+// ParseMailClient Checks the name of a mail client.
+func ParseMailClient(name string) (MailClient, error) {
+	var client = MailClient(strings.ToLower(name))
+
+	if _, ok := clientProfiles[client]; !ok {
+		return client, fmt.Errorf(`unknown mail client "%s" (expected "%s", "%s" or "%s")`, name, ClientThunderbird, ClientOutlook, ClientAppleMail)
+	}
+	return client, nil
+}
+
+// Name Returns the name of the mail client, for the user.
+func (c MailClient) Name() string {
+	if c == ClientDefault {
+		return "default"
+	}
+	return string(c)
+}
+
+// Header A header of an email.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Headers The headers of an email, in the order they are written.
+type Headers []Header
+
+// Get Returns the value of a header (the name is not case-sensitive), or an empty string.
+func (h Headers) Get(name string) string {
+	for _, header := range h {
+		if strings.EqualFold(header.Name, name) {
+			return header.Value
+		}
+	}
+	return ""
+}
+
+// String Returns the headers, as written into the email (each header is terminated by CRLF).
+func (h Headers) String() string {
+	var builder strings.Builder
+
+	for _, header := range h {
+		builder.WriteString(header.Name + ": " + header.Value + "\r\n")
+	}
+	return builder.String()
+}
+
+// EmailFields The values used to generate the headers of an email.
+type EmailFields struct {
+	From string
+	To   string
+	// Cc and Bcc The recipients of the copies (see `Copies`), if any. The "Bcc" header must be removed before the email
+	// is given to an SMTP server (see `StripBcc`).
+	Cc      string
+	Bcc     string
+	Subject string
+	// MessageID The message ID of the email (see `MailClient.NewMessageID`).
+	MessageID string
+	// Thread The message IDs of the previous emails of the conversation, from the oldest to the most recent. If not
+	// empty, then the email replies to the most recent one.
+	Thread []string
+	Date   time.Time
+	// ContentType The value of the "Content-Type" header (that gives the boundary).
+	ContentType string
+}
+
+// FormatAddress Returns an address as written into the "From" and "To" headers, given an address with or without a
+// display name ("Jérôme Dupont <jerome@example.com>" or "jerome@example.com"). A display name that contains non-ASCII
+// characters is encoded (RFC 2047), and a display name that contains special characters is quoted.
+func FormatAddress(address string) (string, error) {
+	var err error
+	var parsed *mail.Address
+
+	if parsed, err = mail.ParseAddress(address); err != nil {
+		return "", fmt.Errorf(`invalid address "%s": %s`, address, err.Error())
+	}
+	return formatAddress(parsed), nil
+}
+
+// FormatAddressList Returns a list of addresses separated by commas, as written into the "To", "Cc" and "Bcc" headers
+// (see `FormatAddress`).
+func FormatAddressList(list string) (string, error) {
+	var err error
+	var parsed []*mail.Address
+	var result []string
+
+	if parsed, err = mail.ParseAddressList(list); err != nil {
+		return "", fmt.Errorf(`invalid list of addresses "%s": %s`, list, err.Error())
+	}
+	for _, address := range parsed {
+		result = append(result, formatAddress(address))
+	}
+	return strings.Join(result, ", "), nil
+}
+
+// EnvelopeAddresses Returns the addresses of the mailboxes of a list of addresses separated by commas (see
+// `EnvelopeAddress`).
+func EnvelopeAddresses(list string) ([]string, error) {
+	var err error
+	var parsed []*mail.Address
+	var result []string
+
+	if parsed, err = mail.ParseAddressList(list); err != nil {
+		return nil, fmt.Errorf(`invalid list of addresses "%s": %s`, list, err.Error())
+	}
+	for _, address := range parsed {
+		result = append(result, address.Address)
+	}
+	return result, nil
+}
+
+// formatAddress Returns an address as written into the headers (the display name is omitted if empty).
+func formatAddress(address *mail.Address) string {
+	if len(address.Name) == 0 {
+		return address.Address
+	}
+	return address.String()
+}
+
+// EnvelopeAddress Returns the address of the mailbox, without display name, given an address with or without a display
+// name (see `FormatAddress`). This is the address given to the SMTP server.
+func EnvelopeAddress(address string) (string, error) {
+	var err error
+	var parsed *mail.Address
+
+	if parsed, err = mail.ParseAddress(address); err != nil {
+		return "", fmt.Errorf(`invalid address "%s": %s`, address, err.Error())
+	}
+	return parsed.Address, nil
+}
+
+// NewMessageID Creates a unique message ID for an email sent by `from`, in the format used by the mail client.
+func (c MailClient) NewMessageID(from string) (string, error) {
+	return c.NewMarkedMessageID(from, "")
+}
+
+// NewMarkedMessageID Creates a unique message ID for an email sent by `from`, in the format used by the mail client,
+// that contains a marker (see `NewMarker`). The marker replaces the first random bytes: it appears as hexadecimal
+// digits in all the formats. No marker is written if `marker` is empty.
+func (c MailClient) NewMarkedMessageID(from string, marker string) (string, error) {
+	return c.NewCarryingMessageID(from, marker, nil)
+}
+
+// NewCarryingMessageID Same as `NewMarkedMessageID`, but the message ID also hides bytes of a chunk of the message
+// (see `CarrierMessageID`), which replace random bytes that follow the marker. No bytes are hidden if `payload` is
+// empty.
+func (c MailClient) NewCarryingMessageID(from string, marker string, payload []byte) (string, error) {
+	var err error
+	var random = make([]byte, 16)
+	var domain = "localhost"
+	var value []byte
+
+	if _, err = rand.Read(random); err != nil {
+		return "", err
+	}
+	if len(marker) > 0 {
+		if value, err = ParseMarker(marker); err != nil {
+			return "", err
+		}
+		copy(random, value)
+	}
+	if len(payload) > c.MessageIDCapacity() {
+		return "", fmt.Errorf(`the message IDs of the mail client "%s" hide up to %d bytes (%d given)`, c.Name(), c.MessageIDCapacity(), len(payload))
+	}
+	for i, b := range payload {
+		random[messageIDPayloadPositions[i]] = b
+	}
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = strings.Trim(from[i+1:], "<> ")
+	}
+	return c.profile().messageID(random, domain), nil
+}
+
+// Headers Returns the headers of an email, as written by the mail client: the same headers, in the same order.
+func (c MailClient) Headers(fields EmailFields) Headers {
+	var result Headers
+	var profile = c.profile()
+	var values = map[string]string{
+		"From":         fields.From,
+		"To":           fields.To,
+		"Cc":           fields.Cc,
+		"Bcc":          fields.Bcc,
+		"Subject":      fields.Subject,
+		"Date":         fields.Date.Format(dateFormat),
+		"Message-ID":   fields.MessageID,
+		"Message-Id":   fields.MessageID,
+		"Content-Type": fields.ContentType,
+		"Thread-Topic": stripReplyPrefix(fields.Subject),
+	}
+
+	if len(fields.Thread) > 0 {
+		values["Subject"] = replySubject(profile.replyPrefix, fields.Subject)
+		values["In-Reply-To"] = fields.Thread[len(fields.Thread)-1]
+		values["References"] = threadReferences(fields.Thread)
+	}
+	for name, value := range profile.fixed {
+		values[name] = value
+	}
+	for _, name := range profile.order {
+		if len(values[name]) > 0 {
+			result = append(result, Header{Name: name, Value: values[name]})
+		}
+	}
+	return result
+}
+
+// profile Returns the profile of the mail client (the default one if the client is unknown).
+func (c MailClient) profile() clientProfile {
+	if profile, ok := clientProfiles[c]; ok {
+		return profile
+	}
+	return clientProfiles[ClientDefault]
+}
+
+// RefreshDate Sets the "Date" header of an email (RFC 5322) to a given date. It is used when an email is sent later
+// than it has been composed.
+func RefreshDate(message string, date time.Time) string {
+	var end = strings.Index(message, "\r\n\r\n")
+	var lines []string
+
+	if end < 0 {
+		return message
+	}
+	lines = strings.Split(message[:end], "\r\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.ToLower(line), "date:") {
+			lines[i] = line[:len("date:")] + " " + date.Format(dateFormat)
+			break
+		}
+	}
+	return strings.Join(lines, "\r\n") + message[end:]
+}
+
+// StripBcc Removes the "Bcc" header from an email (RFC 5322), so that the "Bcc" recipients are hidden from the other
+// recipients. It is used when the email is given to an SMTP server (the recipients are given by the envelope).
+func StripBcc(message string) string {
+	var end = strings.Index(message, "\r\n\r\n")
+	var lines []string
+	var kept []string
+	var skip = false
+
+	if end < 0 {
+		return message
+	}
+	lines = strings.Split(message[:end], "\r\n")
+	for _, line := range lines {
+		// A header may be folded over several lines (the continuation lines start with a space).
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			if !skip {
+				kept = append(kept, line)
+			}
+			continue
+		}
+		if skip = strings.HasPrefix(strings.ToLower(line), "bcc:"); !skip {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\r\n") + message[end:]
+}
+
+// replySubject Returns the subject of a reply: the prefix followed by the subject, unless the subject is already the
+// subject of a reply.
+func replySubject(prefix string, subject string) string {
+	if stripReplyPrefix(subject) != subject {
+		return subject
+	}
+	return prefix + subject
+}
+
+// stripReplyPrefix Returns the subject without its reply prefix ("Re:"), if any. The subject may be encoded (RFC
+// 2047).
+func stripReplyPrefix(subject string) string {
+	var err error
+	var decoded string
+
+	if decoded, err = new(mime.WordDecoder).DecodeHeader(subject); err != nil {
+		decoded = subject
+	}
+	if len(decoded) >= 3 && strings.EqualFold(decoded[:3], "re:") {
+		if decoded == subject {
+			return strings.TrimSpace(subject[3:])
+		}
+		return mime.QEncoding.Encode("utf-8", strings.TrimSpace(decoded[3:]))
+	}
+	return subject
+}
+
+// threadReferences Returns the value of the "References" header of a reply, given the message IDs of the thread. Like
+// the mail clients, only the first message ID and the most recent ones are kept when the thread is long.
+func threadReferences(thread []string) string {
+	if len(thread) > maxReferences {
+		thread = append([]string{thread[0]}, thread[len(thread)-maxReferences+1:]...)
+	}
+	return strings.Join(thread, "\r\n ")
+}
+
+// uuid Returns a (version 4) UUID, given 16 random bytes.
+func uuid(random []byte) string {
+	var id = make([]byte, 16)
+
+	copy(id, random)
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
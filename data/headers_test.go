@@ -0,0 +1,200 @@
+package data
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/mail"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMailClient(t *testing.T) {
+	var err error
+	var client MailClient
+
+	for _, name := range []string{"", "thunderbird", "Outlook", "apple-mail"} {
+		client, err = ParseMailClient(name)
+		assert.Nil(t, err)
+		assert.Equal(t, MailClient(strings.ToLower(name)), client)
+	}
+	_, err = ParseMailClient("mutt")
+	assert.NotNil(t, err)
+	assert.Equal(t, "default", ClientDefault.Name())
+	assert.Equal(t, "outlook", ClientOutlook.Name())
+}
+
+func TestMailClientMessageID(t *testing.T) {
+	var expected = map[MailClient]*regexp.Regexp{
+		ClientDefault:     regexp.MustCompile(`^<[0-9a-f]{32}@example\.com>$`),
+		ClientThunderbird: regexp.MustCompile(`^<[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}@example\.com>$`),
+		ClientOutlook:     regexp.MustCompile(`^<0000[0-9a-f]{8}\$[0-9a-f]{8}\$[0-9a-f]{8}\$@example\.com>$`),
+		ClientAppleMail:   regexp.MustCompile(`^<[0-9A-F]{8}-[0-9A-F]{4}-4[0-9A-F]{3}-[89AB][0-9A-F]{3}-[0-9A-F]{12}@example\.com>$`),
+	}
+
+	for client, format := range expected {
+		var id, err = client.NewMessageID("John <john@example.com>")
+		assert.Nil(t, err)
+		assert.Regexp(t, format, id, client)
+	}
+	id, _ := ClientDefault.NewMessageID("john")
+	assert.True(t, strings.HasSuffix(id, "@localhost>"))
+}
+
+func TestMailClientMarkedMessageID(t *testing.T) {
+	var err error
+
+	for client, format := range map[MailClient]string{
+		ClientDefault:     "<1a2b3c4d",
+		ClientThunderbird: "<1a2b3c4d-",
+		ClientOutlook:     "<00001a2b3c4d$",
+		ClientAppleMail:   "<1A2B3C4D-",
+	} {
+		var id string
+		id, err = client.NewMarkedMessageID("john@example.com", "1a2b3c4d")
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(id, format), id)
+	}
+	_, err = ClientDefault.NewMarkedMessageID("john@example.com", "1a2b")
+	assert.NotNil(t, err)
+}
+
+func TestMailClientHeaders(t *testing.T) {
+	var date = time.Date(2024, 3, 12, 10, 15, 30, 0, time.FixedZone("CET", 3600))
+	var fields = EmailFields{
+		From:        "john@example.com",
+		To:          "jane@example.com",
+		Subject:     "Hello",
+		MessageID:   "<3@example.com>",
+		Date:        date,
+		ContentType: `multipart/alternative; boundary="0a1b"`,
+	}
+	var names = func(headers Headers) []string {
+		var result []string
+		for _, header := range headers {
+			result = append(result, header.Name)
+		}
+		return result
+	}
+	var headers Headers
+
+	// The headers are complete, and the email can be parsed.
+	for client := range clientProfiles {
+		var message *mail.Message
+		var err error
+
+		headers = client.Headers(fields)
+		message, err = mail.ReadMessage(strings.NewReader(headers.String() + "\r\nbody"))
+		if !assert.Nil(t, err, client) {
+			continue
+		}
+		assert.Equal(t, "Tue, 12 Mar 2024 10:15:30 +0100", message.Header.Get("Date"), client)
+		assert.Equal(t, "<3@example.com>", message.Header.Get("Message-Id"), client)
+		assert.True(t, strings.HasPrefix(message.Header.Get("Mime-Version"), "1.0"), client)
+		assert.Equal(t, "Hello", message.Header.Get("Subject"), client)
+		assert.Empty(t, message.Header.Get("In-Reply-To"), client)
+	}
+
+	// The order of the headers is the one of the client.
+	assert.Equal(t, []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"}, names(ClientDefault.Headers(fields)))
+	assert.Equal(t, []string{"Message-ID", "Date", "MIME-Version", "User-Agent", "Subject", "Content-Language", "To", "From", "Content-Type"}, names(ClientThunderbird.Headers(fields)))
+	assert.Equal(t, "Mozilla Thunderbird", ClientThunderbird.Headers(fields).Get("user-agent"))
+	assert.Equal(t, "Apple Mail (2.3774.500.171.1.1)", ClientAppleMail.Headers(fields).Get("X-Mailer"))
+	assert.Equal(t, "Hello", ClientOutlook.Headers(fields).Get("Thread-Topic"))
+
+	// A reply.
+	fields.Thread = []string{"<1@example.com>", "<2@example.com>"}
+	headers = ClientThunderbird.Headers(fields)
+	assert.Equal(t, "Re: Hello", headers.Get("Subject"))
+	assert.Equal(t, "<2@example.com>", headers.Get("In-Reply-To"))
+	assert.Equal(t, "<1@example.com>\r\n <2@example.com>", headers.Get("References"))
+	headers = ClientOutlook.Headers(fields)
+	assert.Equal(t, "RE: Hello", headers.Get("Subject"))
+	assert.Equal(t, "Hello", headers.Get("Thread-Topic"))
+
+	// The subject of a reply is not prefixed twice.
+	fields.Subject = "Re: Hello"
+	assert.Equal(t, "Re: Hello", ClientDefault.Headers(fields).Get("Subject"))
+	fields.Subject = "=?utf-8?q?RE:_H=C3=A9llo?="
+	assert.Equal(t, fields.Subject, ClientDefault.Headers(fields).Get("Subject"))
+	fields.Subject = "=?utf-8?q?H=C3=A9llo?="
+	assert.Equal(t, "Re: =?utf-8?q?H=C3=A9llo?=", ClientDefault.Headers(fields).Get("Subject"))
+}
+
+func TestThreadReferences(t *testing.T) {
+	var thread []string
+
+	for i := 0; i < 15; i++ {
+		thread = append(thread, fmt.Sprintf("<%d@example.com>", i))
+	}
+	// The first message ID and the most recent ones are kept.
+	assert.Equal(t, strings.Join(append([]string{"<0@example.com>"}, thread[6:]...), "\r\n "), threadReferences(thread))
+	assert.Equal(t, "<0@example.com>", threadReferences(thread[:1]))
+}
+
+func TestRefreshDate(t *testing.T) {
+	var date = time.Date(2024, 3, 12, 10, 15, 30, 0, time.UTC)
+	var message = "From: john@example.com\r\nDate: Mon, 1 Jan 2024 00:00:00 +0000\r\n\r\nDate: in the body\r\n"
+
+	assert.Equal(t, "From: john@example.com\r\nDate: Tue, 12 Mar 2024 10:15:30 +0000\r\n\r\nDate: in the body\r\n", RefreshDate(message, date))
+	assert.Equal(t, "no headers", RefreshDate("no headers", date))
+}
+
+func TestFormatAddress(t *testing.T) {
+	var err error
+	var formatted string
+	var decoded *mail.Address
+
+	formatted, err = FormatAddress("john@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "john@example.com", formatted)
+	formatted, err = FormatAddress("John Smith <john@example.com>")
+	assert.Nil(t, err)
+	assert.Equal(t, `"John Smith" <john@example.com>`, formatted)
+
+	// The display name is encoded, and the standard library decodes it.
+	formatted, err = FormatAddress("Jérôme Dupont <jerome@example.com>")
+	assert.Nil(t, err)
+	assert.Equal(t, "=?utf-8?q?J=C3=A9r=C3=B4me_Dupont?= <jerome@example.com>", formatted)
+	decoded, err = mail.ParseAddress(formatted)
+	assert.Nil(t, err)
+	assert.Equal(t, "Jérôme Dupont", decoded.Name)
+
+	formatted, err = EnvelopeAddress("Jérôme Dupont <jerome@example.com>")
+	assert.Nil(t, err)
+	assert.Equal(t, "jerome@example.com", formatted)
+	_, err = FormatAddress("Jérôme <jerome>")
+	assert.NotNil(t, err)
+	_, err = EnvelopeAddress("")
+	assert.NotNil(t, err)
+}
+
+func TestFormatAddressList(t *testing.T) {
+	var err error
+	var formatted string
+	var addresses []string
+
+	formatted, err = FormatAddressList(`jane@example.com, "Smith, John" <john@example.com>,Jérôme <jerome@example.com>`)
+	assert.Nil(t, err)
+	assert.Equal(t, `jane@example.com, "Smith, John" <john@example.com>, =?utf-8?q?J=C3=A9r=C3=B4me?= <jerome@example.com>`, formatted)
+	addresses, err = EnvelopeAddresses(`jane@example.com, "Smith, John" <john@example.com>`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"jane@example.com", "john@example.com"}, addresses)
+	_, err = FormatAddressList("jane@example.com, john")
+	assert.NotNil(t, err)
+	_, err = EnvelopeAddresses("")
+	assert.NotNil(t, err)
+
+	// The copies are written after the recipients, and the "Bcc" header is removed before sending.
+	var headers = ClientOutlook.Headers(EmailFields{From: "a@example.com", To: "b@example.com", Cc: "c@example.com", Bcc: "d@example.com"})
+	assert.True(t, strings.HasPrefix(headers.String(), "From: a@example.com\r\nTo: b@example.com\r\nCc: c@example.com\r\nBcc: d@example.com\r\n"))
+}
+
+func TestStripBcc(t *testing.T) {
+	var message = "From: a@example.com\r\nBcc: b@example.com,\r\n c@example.com\r\nSubject: Hi\r\n\r\nBcc: in the body\r\n"
+
+	assert.Equal(t, "From: a@example.com\r\nSubject: Hi\r\n\r\nBcc: in the body\r\n", StripBcc(message))
+	assert.Equal(t, "From: a@example.com\r\n\r\nbody", StripBcc("From: a@example.com\r\n\r\nbody"))
+	assert.Equal(t, "no headers", StripBcc("no headers"))
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DecodeHooks What is done once a hidden message has been fully decoded (see "rcv"), so that other tools (notification
+// systems, for example) are told: a local command is executed, and/or a webhook is notified.
+type DecodeHooks struct {
+	// Command The command executed, given with its arguments (separated by spaces, no quoting): the path of the file
+	// that contains the message is added as its last argument.
+	Command string
+	// Webhook The URL the event is posted to (JSON, see `DecodeEvent`). The message itself is not posted.
+	Webhook string
+}
+
+// DecodeEvent The description of a hidden message decoded, given to the hooks.
+type DecodeEvent struct {
+	// Path The file that contains the message, if it is kept (see "rcv --output").
+	Path          string    `json:"path,omitempty"`
+	Length        int       `json:"length"`
+	Sha256        string    `json:"sha256"`
+	Authenticated bool      `json:"authenticated"`
+	Decoded       time.Time `json:"decoded"`
+}
+
+// IsEmpty Tells whether no hook is configured.
+func (h DecodeHooks) IsEmpty() bool {
+	return len(strings.TrimSpace(h.Command)) == 0 && len(h.Webhook) == 0
+}
+
+// Validate Checks the hooks: the webhook is an HTTP(S) URL.
+func (h DecodeHooks) Validate() error {
+	var err error
+	var webhook *url.URL
+
+	if len(h.Webhook) == 0 {
+		return nil
+	}
+	if webhook, err = url.Parse(h.Webhook); err != nil || (webhook.Scheme != "http" && webhook.Scheme != "https") || len(webhook.Host) == 0 {
+		return fmt.Errorf(`invalid webhook "%s": an HTTP(S) URL is expected`, h.Webhook)
+	}
+	return nil
+}
+
+// RunCommand Executes the command (if any) for a message stored in a file (`path`). The output of the command is
+// printed. It returns an error if the command fails.
+func (h DecodeHooks) RunCommand(path string) error {
+	var err error
+	var arguments = strings.Fields(h.Command)
+	var command *exec.Cmd
+
+	if len(arguments) == 0 {
+		return nil
+	}
+	command = exec.Command(arguments[0], append(arguments[1:], path)...)
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	if err = command.Run(); err != nil {
+		return fmt.Errorf(`the command "%s" failed: %s`, h.Command, err.Error())
+	}
+	return nil
+}
+
+// Notify Posts an event to the webhook (if any). It returns an error if the webhook does not accept it (status 2xx).
+func (h DecodeHooks) Notify(client *http.Client, event DecodeEvent) error {
+	var err error
+	var payload []byte
+	var response *http.Response
+
+	if len(h.Webhook) == 0 {
+		return nil
+	}
+	if payload, err = json.Marshal(event); err != nil {
+		return err
+	}
+	if response, err = client.Post(h.Webhook, "application/json", bytes.NewReader(payload)); err != nil {
+		return fmt.Errorf(`cannot notify the webhook "%s": %s`, h.Webhook, err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf(`the webhook "%s" rejected the event (status %d)`, h.Webhook, response.StatusCode)
+	}
+	return nil
+}
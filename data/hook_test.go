@@ -0,0 +1,55 @@
+package data
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestDecodeHooks(t *testing.T) {
+	var received []DecodeEvent
+	var status = http.StatusNoContent
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event DecodeEvent
+		var body, _ = io.ReadAll(r.Body)
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Nil(t, json.Unmarshal(body, &event))
+		received = append(received, event)
+		w.WriteHeader(status)
+	}))
+	var event = DecodeEvent{Length: 12, Sha256: MessageHash([]byte("Hello world!")), Authenticated: true, Decoded: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	defer server.Close()
+
+	assert.True(t, DecodeHooks{}.IsEmpty())
+	assert.True(t, DecodeHooks{Command: "  "}.IsEmpty())
+	assert.False(t, DecodeHooks{Webhook: server.URL}.IsEmpty())
+	assert.Nil(t, DecodeHooks{}.Validate())
+	assert.Nil(t, DecodeHooks{Webhook: "https://hooks.example.com/umail?token=x"}.Validate())
+
+	// Nothing to do.
+	assert.Nil(t, DecodeHooks{}.RunCommand("message.txt"))
+	assert.Nil(t, DecodeHooks{}.Notify(server.Client(), event))
+	assert.Empty(t, received)
+
+	assert.Nil(t, DecodeHooks{Webhook: server.URL}.Notify(server.Client(), event))
+	assert.Equal(t, []DecodeEvent{event}, received)
+	if runtime.GOOS != "windows" {
+		assert.Nil(t, DecodeHooks{Command: "true --ignored"}.RunCommand("message.txt"))
+		assert.NotNil(t, DecodeHooks{Command: "false"}.RunCommand("message.txt"))
+	}
+
+	// We'll get errors...
+	for _, webhook := range []string{"hooks.example.com", "ftp://hooks.example.com", "https://", ":"} {
+		assert.NotNil(t, DecodeHooks{Webhook: webhook}.Validate(), webhook)
+	}
+	assert.NotNil(t, DecodeHooks{Command: "umail-no-such-command"}.RunCommand("message.txt"))
+	status = http.StatusInternalServerError
+	assert.NotNil(t, DecodeHooks{Webhook: server.URL}.Notify(server.Client(), event))
+}
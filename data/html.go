@@ -0,0 +1,240 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultHtmlLayout The default layout of the HTML part of the emails (see `BuildHtml`).
+const DefaultHtmlLayout = `<div style="font-family: Arial, sans-serif; font-size: 14px;">
+{{range .Paragraphs}}<p>{{range $i, $line := .}}{{if $i}}<br>
+{{end}}{{$line}}{{end}}</p>
+{{end}}</div>`
+
+// HtmlData The values available to the layout of the HTML part of the emails (see `html/template`). The values are
+// escaped by the template.
+type HtmlData struct {
+	// Paragraphs The paragraphs of the body (separated by empty lines): the lines of each paragraph.
+	Paragraphs [][]string
+	// Text The body.
+	Text string
+}
+
+var styleBlockRegex = regexp.MustCompile(`(?is)<style[^>]*>(.*?)</style>`)
+var cssCommentRegex = regexp.MustCompile(`(?s)/\*.*?\*/`)
+var startTagRegex = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9]*)((?:\s+[^<>]*?)?)(\s*/?)>`)
+var classAttributeRegex = regexp.MustCompile(`(?i)\sclass\s*=\s*"([^"]*)"`)
+var styleAttributeRegex = regexp.MustCompile(`(?i)\sstyle\s*=\s*"([^"]*)"`)
+var simpleSelectorRegex = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9]*|\*)?((?:\.[a-zA-Z_-][a-zA-Z0-9_-]*)*)$`)
+
+// ParseHtmlLayout Checks the syntax of a layout of the HTML part of the emails.
+func ParseHtmlLayout(layout string) error {
+	_, err := template.New("html").Parse(layout)
+	return err
+}
+
+// BuildHtml Returns the HTML part of an email, given its body (plain text) and a layout (see `HtmlData`). If `inline`
+// is true, then the CSS rules of the "style" elements of the layout are moved to the "style" attributes of the elements
+// (see `InlineCss`), as many mail clients ignore the "style" elements.
+func BuildHtml(layout string, body []byte, inline bool) ([]byte, error) {
+	var err error
+	var tmpl *template.Template
+	var buffer bytes.Buffer
+	var data = HtmlData{Text: string(body)}
+	var paragraph []string
+	var html string
+
+	for _, line := range strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			if len(paragraph) > 0 {
+				data.Paragraphs = append(data.Paragraphs, paragraph)
+			}
+			paragraph = nil
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	if len(paragraph) > 0 {
+		data.Paragraphs = append(data.Paragraphs, paragraph)
+	}
+	if tmpl, err = template.New("html").Parse(layout); err != nil {
+		return nil, err
+	}
+	if err = tmpl.Execute(&buffer, data); err != nil {
+		return nil, err
+	}
+	if html = buffer.String(); inline {
+		html = InlineCss(html)
+	}
+	return []byte(html), nil
+}
+
+// cssRule A CSS rule whose selector is simple: an element name ("p"), classes (".quote"), or both ("p.quote").
+type cssRule struct {
+	element string
+	classes []string
+	// declarations The declarations of the rule ("color: red").
+	declarations []string
+}
+
+// InlineCss Moves the CSS rules of the "style" elements of an HTML document to the "style" attributes of the elements
+// they apply to. Only the rules whose selectors are simple (see `cssRule`) are moved: the other rules (such as "@media"
+// rules, or rules that use combinators) are kept into a "style" element. The declarations of the "style" attributes
+// take precedence over the rules, and the rules are applied in the order of their specificity.
+func InlineCss(html string) string {
+	var rules []cssRule
+	var kept []string
+	var blocks = styleBlockRegex.FindAllStringSubmatch(html, -1)
+	var count int
+
+	if len(blocks) == 0 {
+		return html
+	}
+	for _, block := range blocks {
+		var remaining []string
+		rules, remaining = parseCss(block[1], rules)
+		kept = append(kept, remaining...)
+	}
+	// The rules that are not moved are kept into the first "style" element.
+	html = styleBlockRegex.ReplaceAllStringFunc(html, func(string) string {
+		if count++; count == 1 && len(kept) > 0 {
+			return "<style>\n" + strings.Join(kept, "\n") + "\n</style>"
+		}
+		return ""
+	})
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].specificity() < rules[j].specificity()
+	})
+	return startTagRegex.ReplaceAllStringFunc(html, func(tag string) string {
+		var parts = startTagRegex.FindStringSubmatch(tag)
+		var element = strings.ToLower(parts[1])
+		var attributes = parts[2]
+		var classes []string
+		var declarations []string
+
+		if element == "style" {
+			return tag
+		}
+		if match := classAttributeRegex.FindStringSubmatch(attributes); match != nil {
+			classes = strings.Fields(match[1])
+		}
+		for _, rule := range rules {
+			if rule.matches(element, classes) {
+				declarations = append(declarations, rule.declarations...)
+			}
+		}
+		if len(declarations) == 0 {
+			return tag
+		}
+		if match := styleAttributeRegex.FindStringSubmatch(attributes); match != nil {
+			declarations = append(declarations, strings.TrimSuffix(strings.TrimSpace(match[1]), ";"))
+			attributes = styleAttributeRegex.ReplaceAllString(attributes, "")
+		}
+		return fmt.Sprintf(`<%s%s style="%s"%s>`, parts[1], attributes, strings.Join(declarations, "; ")+";", parts[3])
+	})
+}
+
+// parseCss Parses a style sheet: the rules whose selectors are simple are appended to `rules`, and the other rules are
+// returned (as written).
+func parseCss(sheet string, rules []cssRule) ([]cssRule, []string) {
+	var kept []string
+
+	sheet = cssCommentRegex.ReplaceAllString(sheet, "")
+	for len(strings.TrimSpace(sheet)) > 0 {
+		var open = strings.Index(sheet, "{")
+		var end int
+		var selectors string
+		var body string
+		var simple = true
+		var parsed []cssRule
+
+		if open < 0 {
+			break
+		}
+		// Find the end of the rule (the "@" rules contain nested blocks).
+		end = open
+		for depth := 0; end < len(sheet); end++ {
+			if sheet[end] == '{' {
+				depth++
+			} else if sheet[end] == '}' {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		if end == len(sheet) {
+			end--
+		}
+		selectors = strings.TrimSpace(sheet[:open])
+		body = sheet[open+1 : end]
+		if strings.HasPrefix(selectors, "@") || strings.Contains(body, "{") {
+			simple = false
+		}
+		for _, selector := range strings.Split(selectors, ",") {
+			var match = simpleSelectorRegex.FindStringSubmatch(strings.TrimSpace(selector))
+			if !simple || match == nil || len(strings.TrimSpace(selector)) == 0 {
+				simple = false
+				break
+			}
+			parsed = append(parsed, cssRule{
+				element:      strings.ToLower(strings.TrimPrefix(match[1], "*")),
+				classes:      strings.FieldsFunc(match[2], func(r rune) bool { return r == '.' }),
+				declarations: cssDeclarations(body),
+			})
+		}
+		if simple {
+			rules = append(rules, parsed...)
+		} else {
+			kept = append(kept, strings.TrimSpace(sheet[:end+1]))
+		}
+		sheet = sheet[end+1:]
+	}
+	return rules, kept
+}
+
+// cssDeclarations Returns the declarations of the body of a CSS rule. The double quotes are replaced by single quotes,
+// so that the declarations can be written into an attribute.
+func cssDeclarations(body string) []string {
+	var result []string
+
+	for _, declaration := range strings.Split(body, ";") {
+		if declaration = strings.TrimSpace(declaration); len(declaration) > 0 {
+			result = append(result, strings.ReplaceAll(declaration, `"`, `'`))
+		}
+	}
+	return result
+}
+
+// matches Tells whether the rule applies to an element, given its name and its classes.
+func (r cssRule) matches(element string, classes []string) bool {
+	if len(r.element) > 0 && r.element != element {
+		return false
+	}
+	for _, class := range r.classes {
+		var found = false
+		for _, c := range classes {
+			if c == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// specificity Returns the specificity of the selector of the rule (the classes count more than the element name).
+func (r cssRule) specificity() int {
+	var result = len(r.classes) * 10
+
+	if len(r.element) > 0 {
+		result++
+	}
+	return result
+}
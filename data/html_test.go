@@ -0,0 +1,59 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestBuildHtml(t *testing.T) {
+	var err error
+	var html []byte
+
+	// The text is escaped, and the paragraphs are separated by empty lines.
+	html, err = BuildHtml(DefaultHtmlLayout, []byte("Hello <John> & Jane,\r\nhow are you?\n\n\nBye"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, `<div style="font-family: Arial, sans-serif; font-size: 14px;">
+<p>Hello &lt;John&gt; &amp; Jane,<br>
+how are you?</p>
+<p>Bye</p>
+</div>`, string(html))
+
+	// A layout given by the user.
+	html, err = BuildHtml(`<html><body>{{range .Paragraphs}}<p>{{index . 0}}</p>{{end}}<pre>{{.Text}}</pre></body></html>`, []byte("a<b\n\nc"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, `<html><body><p>a&lt;b</p><p>c</p><pre>a&lt;b
+
+c</pre></body></html>`, string(html))
+
+	_, err = BuildHtml(`{{range .Paragraphs}}`, nil, false)
+	assert.NotNil(t, err)
+	assert.NotNil(t, ParseHtmlLayout(`{{.Missing`))
+	assert.Nil(t, ParseHtmlLayout(DefaultHtmlLayout))
+}
+
+func TestInlineCss(t *testing.T) {
+	var html = `<html><head><style type="text/css">
+/* The paragraphs. */
+p { margin: 0; color: black }
+.quote, blockquote { color: gray; font-family: "Times New Roman" }
+p.quote { font-style: italic; }
+div p { color: red }
+@media (max-width: 600px) { p { font-size: 12px } }
+</style></head><body><p>Hello</p><p class="big quote" style="color: blue">Quote</p><br><img src="a.png" /></body></html>`
+	var inlined = InlineCss(html)
+
+	// The simple rules are moved to the attributes (the attribute takes precedence over the rules).
+	assert.Contains(t, inlined, `<p style="margin: 0; color: black;">Hello</p>`)
+	assert.Contains(t, inlined, `<p class="big quote" style="margin: 0; color: black; color: gray; font-family: 'Times New Roman'; font-style: italic; color: blue;">Quote</p>`)
+	assert.Contains(t, inlined, `<br>`)
+	assert.Contains(t, inlined, `<img src="a.png" />`)
+	// The other rules are kept into a "style" element.
+	assert.Contains(t, inlined, "<style>\ndiv p { color: red }\n@media (max-width: 600px) { p { font-size: 12px } }\n</style>")
+	assert.Equal(t, 1, strings.Count(inlined, "<style"))
+
+	// A document without "style" element is unchanged.
+	assert.Equal(t, "<p>Hello</p>", InlineCss("<p>Hello</p>"))
+	// The "style" elements are removed once all their rules are moved.
+	assert.Equal(t, `<p style="color:red;">Hello</p>`, InlineCss("<style>p{color:red}</style><p>Hello</p>"))
+}
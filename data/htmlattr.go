@@ -0,0 +1,172 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+)
+
+// htmlAttributesCarrierLength The number of bytes hidden by the attributes of the HTML part of an email, by default:
+// the HTML part of any body (with the default layout) can hide them.
+const htmlAttributesCarrierLength = 8
+
+// htmlAttributesCarrierMaxLength The maximum number of bytes hidden by the attributes of the HTML part (the HTML part
+// must have enough elements, see `htmlAttributeKinds`).
+const htmlAttributesCarrierMaxLength = 64
+
+// htmlAttributeKind An attribute added to the elements of the HTML part, whose value looks like the ones generated by
+// the web mail clients and the email builders (a tracker, or an artifact of the editor).
+type htmlAttributeKind struct {
+	// size The number of bytes hidden by the attribute.
+	size int
+	// add Adds the attribute (that hides the given bytes) to the attributes of an element. It returns false if the
+	// element cannot have the attribute.
+	add func(attributes string, value []byte) (string, bool)
+}
+
+var idAttributeRegex = regexp.MustCompile(`(?i)\sid\s*=\s*"([^"]*)"`)
+var dataBlockAttributeRegex = regexp.MustCompile(`(?i)\sdata-block-id\s*=\s*"([^"]*)"`)
+var htmlIdRegex = regexp.MustCompile(`^m_([0-9a-f]{16})$`)
+var htmlClassRegex = regexp.MustCompile(`^ydp([0-9a-f]{8})$`)
+var htmlDataBlockRegex = regexp.MustCompile(`^([0-9a-f]{12})$`)
+
+// htmlAttributeKinds The attributes added to the elements of the HTML part, in turn: an identifier ("m_" and 16
+// hexadecimal digits, as written by Gmail), a class ("ydp" and 8 hexadecimal digits, as written by Yahoo Mail) and a
+// "data-block-id" attribute (as written by the email builders).
+var htmlAttributeKinds = []htmlAttributeKind{
+	{size: 8, add: func(attributes string, value []byte) (string, bool) {
+		if idAttributeRegex.MatchString(attributes) {
+			return attributes, false
+		}
+		return fmt.Sprintf(`%s id="m_%x"`, attributes, value), true
+	}},
+	{size: 4, add: func(attributes string, value []byte) (string, bool) {
+		if match := classAttributeRegex.FindStringSubmatchIndex(attributes); match != nil {
+			return fmt.Sprintf(`%s ydp%x%s`, strings.TrimRight(attributes[:match[3]], " "), value, attributes[match[3]:]), true
+		}
+		return fmt.Sprintf(`%s class="ydp%x"`, attributes, value), true
+	}},
+	{size: 6, add: func(attributes string, value []byte) (string, bool) {
+		if dataBlockAttributeRegex.MatchString(attributes) {
+			return attributes, false
+		}
+		return fmt.Sprintf(`%s data-block-id="%x"`, attributes, value), true
+	}},
+}
+
+// htmlCarryingElements The elements of the HTML part that can have the attributes (see `htmlAttributeKinds`).
+var htmlCarryingElements = map[string]bool{"div": true, "p": true, "span": true, "table": true, "tr": true,
+	"td": true, "th": true, "a": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "blockquote": true, "section": true, "center": true, "font": true, "b": true,
+	"i": true, "strong": true, "em": true}
+
+// HideInHtml Returns the HTML part of an email, whose elements have attributes that hide bytes of a chunk of the
+// message (see `CarrierHtmlAttributes`). The elements have the attributes of `htmlAttributeKinds` in turn: the bytes
+// are hidden by the attributes in the order of the elements. The attributes that follow the hidden bytes are random.
+func HideInHtml(html []byte, payload []byte) ([]byte, error) {
+	var err error
+	var kind int
+	var hidden int
+
+	if len(payload) == 0 {
+		return html, nil
+	}
+	html = []byte(startTagRegex.ReplaceAllStringFunc(string(html), func(tag string) string {
+		var parts = startTagRegex.FindStringSubmatch(tag)
+
+		if !htmlCarryingElements[strings.ToLower(parts[1])] || err != nil {
+			return tag
+		}
+		for tries := 0; tries < len(htmlAttributeKinds); tries++ {
+			var value = make([]byte, htmlAttributeKinds[kind].size)
+			var attributes string
+			var ok bool
+
+			if _, err = rand.Read(value); err != nil {
+				return tag
+			}
+			if hidden < len(payload) {
+				copy(value, payload[hidden:])
+			}
+			attributes, ok = htmlAttributeKinds[kind].add(parts[2], value)
+			kind = (kind + 1) % len(htmlAttributeKinds)
+			if ok {
+				hidden += len(value)
+				return fmt.Sprintf(`<%s%s%s>`, parts[1], attributes, parts[3])
+			}
+		}
+		return tag
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if hidden < len(payload) {
+		return nil, fmt.Errorf(`the HTML part of the email has too few elements to hide %d bytes in their attributes (%d bytes hidden)`, len(payload), hidden)
+	}
+	return html, nil
+}
+
+// HtmlAttributesPayload Extracts the bytes hidden by the attributes of the elements of the HTML part of an email (RFC
+// 5322): `length` bytes (see `HideInHtml`).
+func HtmlAttributesPayload(content []byte, length int) ([]byte, error) {
+	var err error
+	var parts []leafPart
+	var payload []byte
+
+	if parts, err = leafParts(content); err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		var mediaType string
+		var html []byte
+
+		if mediaType, _, err = mime.ParseMediaType(part.header.Get("Content-Type")); err != nil || mediaType != "text/html" {
+			continue
+		}
+		if html, err = part.decode(); err != nil {
+			return nil, err
+		}
+		for _, tag := range startTagRegex.FindAllStringSubmatch(string(html), -1) {
+			var values []string
+
+			if !htmlCarryingElements[strings.ToLower(tag[1])] {
+				continue
+			}
+			if match := idAttributeRegex.FindStringSubmatch(tag[2]); match != nil {
+				values = append(values, htmlAttributeValue(htmlIdRegex, match[1]))
+			}
+			if match := classAttributeRegex.FindStringSubmatch(tag[2]); match != nil {
+				for _, class := range strings.Fields(match[1]) {
+					values = append(values, htmlAttributeValue(htmlClassRegex, class))
+				}
+			}
+			if match := dataBlockAttributeRegex.FindStringSubmatch(tag[2]); match != nil {
+				values = append(values, htmlAttributeValue(htmlDataBlockRegex, match[1]))
+			}
+			for _, text := range values {
+				var value []byte
+				if value, err = hex.DecodeString(text); err != nil {
+					return nil, err
+				}
+				payload = append(payload, value...)
+			}
+		}
+		break
+	}
+	if len(payload) < length {
+		return nil, fmt.Errorf(`the attributes of the HTML part of the email hide less than %d bytes`, length)
+	}
+	return payload[:length], nil
+}
+
+// htmlAttributeValue Returns the hexadecimal digits of the value of an attribute that hides bytes (see
+// `htmlAttributeKinds`), or an empty string if the value hides nothing.
+func htmlAttributeValue(regex *regexp.Regexp, value string) string {
+	if match := regex.FindStringSubmatch(value); match != nil {
+		return match[1]
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHideInHtml(t *testing.T) {
+	var err error
+	var html []byte
+	var hidden []byte
+	var content []byte
+	var email []byte
+	var extracted []byte
+	var boundary = strings.Repeat("0a", 35)
+	var layout = `<style>p.quote { color: grey; }</style><div id="main" class="wrapper"><p class="quote">{{.Text}}</p><br><span>Paul</span></div>`
+	var payload = []byte("0123456789abcdefghijklmnopqrstuv")
+
+	html, err = BuildHtml(layout, []byte("Hello"), false)
+	assert.Nil(t, err)
+	for _, length := range []int{1, 8, 18} {
+		hidden, err = HideInHtml(html, payload[:length])
+		assert.Nil(t, err)
+		// The existing attributes are kept.
+		assert.Regexp(t, regexp.MustCompile(`<div id="main" class="wrapper ydp[0-9a-f]{8}">`), string(hidden))
+		assert.Regexp(t, regexp.MustCompile(`<p class="quote" data-block-id="[0-9a-f]{12}">`), string(hidden))
+		assert.Contains(t, string(hidden), `<br>`)
+		content, err = BuildAlternative(boundary, []byte("Hello"), hidden, "", "", BodyPayloads{})
+		assert.Nil(t, err)
+		email = append([]byte("From: a@example.com\r\nContent-Type: multipart/alternative; boundary=\""+boundary+"\"\r\n\r\n"), content...)
+		extracted, err = HtmlAttributesPayload(email, length)
+		assert.Nil(t, err)
+		assert.Equal(t, payload[:length], extracted)
+	}
+
+	// The elements have an identifier, a class and a "data-block-id" attribute in turn.
+	html, err = BuildHtml(DefaultHtmlLayout, []byte("Hello\n\nJohn\n\nBye"), false)
+	assert.Nil(t, err)
+	hidden, err = HideInHtml(html, payload[:8])
+	assert.Nil(t, err)
+	assert.Regexp(t, regexp.MustCompile(`<div style="[^"]*" id="m_3031323334353637">`), string(hidden))
+	assert.Regexp(t, regexp.MustCompile(`<p class="ydp[0-9a-f]{8}">Hello</p>`), string(hidden))
+	assert.Regexp(t, regexp.MustCompile(`<p data-block-id="[0-9a-f]{12}">John</p>`), string(hidden))
+	assert.Regexp(t, regexp.MustCompile(`<p id="m_[0-9a-f]{16}">Bye</p>`), string(hidden))
+	hidden, err = HideInHtml(html, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, html, hidden)
+
+	// We'll get errors...
+	_, err = HideInHtml(html, payload)
+	assert.NotNil(t, err)
+	_, err = HtmlAttributesPayload([]byte("Content-Type: text/html\r\n\r\n<p id=\"m_0123\">Hello</p>"), 1)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,236 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// imageCarrierLength The number of bytes hidden by the cover image attached to an email, by default: a cover of
+// 200x200 pixels can hide them.
+const imageCarrierLength = 1024
+
+// imageCarrierMaxLength The maximum number of bytes hidden by the cover image (the image must have enough pixels, see
+// `ImageCapacity`).
+const imageCarrierMaxLength = 65536
+
+// The formats of the cover images.
+const (
+	ImageFormatPng = "png"
+	ImageFormatBmp = "bmp"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+var bmpSignature = []byte("BM")
+
+// coverImage A cover image, whose pixels hide bytes of a chunk of the message (see `CarrierImage`): the least
+// significant bit of each color component (red, green and blue) of each pixel hides a bit, in the order of the pixels
+// (row by row). The alpha channel is left as is.
+type coverImage struct {
+	format string
+	width  int
+	height int
+	// data The bytes whose least significant bits hide the payload: the pixels of the image (PNG), or the file (BMP).
+	data []byte
+	// offset Returns the position, within `data`, of the color component that hides a given bit.
+	offset func(bit int) int
+	// encode Returns the file of the image, once its pixels are modified.
+	encode func() ([]byte, error)
+}
+
+// parseCoverImage Parses a cover image: a PNG image, or an uncompressed BMP image with 24 or 32 bits per pixel.
+func parseCoverImage(content []byte) (*coverImage, error) {
+	if bytes.HasPrefix(content, pngSignature) {
+		return parsePng(content)
+	}
+	if bytes.HasPrefix(content, bmpSignature) {
+		return parseBmp(content)
+	}
+	return nil, fmt.Errorf(`the cover image is neither a PNG image nor a BMP image`)
+}
+
+// parsePng Parses a PNG image. Its pixels are converted into 8-bit non-premultiplied RGBA (the image is written back in
+// this format).
+func parsePng(content []byte) (*coverImage, error) {
+	var err error
+	var source image.Image
+	var pixels *image.NRGBA
+
+	if source, err = png.Decode(bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf(`invalid PNG image: %s`, err.Error())
+	}
+	pixels = image.NewNRGBA(image.Rect(0, 0, source.Bounds().Dx(), source.Bounds().Dy()))
+	draw.Draw(pixels, pixels.Bounds(), source, source.Bounds().Min, draw.Src)
+	return &coverImage{
+		format: ImageFormatPng,
+		width:  pixels.Rect.Dx(),
+		height: pixels.Rect.Dy(),
+		data:   pixels.Pix,
+		offset: func(bit int) int {
+			return bit/3*4 + bit%3
+		},
+		encode: func() ([]byte, error) {
+			var buffer bytes.Buffer
+			if err := png.Encode(&buffer, pixels); err != nil {
+				return nil, err
+			}
+			return buffer.Bytes(), nil
+		},
+	}, nil
+}
+
+// parseBmp Parses an uncompressed BMP image with 24 or 32 bits per pixel. The file is kept as is, apart from the pixels.
+func parseBmp(content []byte) (*coverImage, error) {
+	var pixelsOffset, headerSize, compression int
+	var width, height int
+	var bitCount int
+	var rowSize int
+
+	if len(content) < 34 {
+		return nil, fmt.Errorf(`invalid BMP image: the header is truncated`)
+	}
+	pixelsOffset = int(binary.LittleEndian.Uint32(content[10:14]))
+	headerSize = int(binary.LittleEndian.Uint32(content[14:18]))
+	width = int(int32(binary.LittleEndian.Uint32(content[18:22])))
+	height = int(int32(binary.LittleEndian.Uint32(content[22:26])))
+	bitCount = int(binary.LittleEndian.Uint16(content[28:30]))
+	compression = int(binary.LittleEndian.Uint32(content[30:34]))
+	if headerSize < 40 {
+		return nil, fmt.Errorf(`unsupported BMP image: the header of %d bytes is too old`, headerSize)
+	}
+	if (bitCount != 24 && bitCount != 32) || compression != 0 {
+		return nil, fmt.Errorf(`unsupported BMP image: only the uncompressed images with 24 or 32 bits per pixel are supported`)
+	}
+	if height < 0 {
+		// The rows are written from the top to the bottom.
+		height = -height
+	}
+	if width <= 0 || height == 0 {
+		return nil, fmt.Errorf(`invalid BMP image: invalid size (%dx%d)`, width, height)
+	}
+	rowSize = (bitCount*width + 31) / 32 * 4
+	if pixelsOffset < 14+headerSize || pixelsOffset+rowSize*height > len(content) {
+		return nil, fmt.Errorf(`invalid BMP image: the pixels are truncated`)
+	}
+	content = append([]byte{}, content...)
+	return &coverImage{
+		format: ImageFormatBmp,
+		width:  width,
+		height: height,
+		data:   content,
+		offset: func(bit int) int {
+			var pixel = bit / 3
+			return pixelsOffset + pixel/width*rowSize + pixel%width*(bitCount/8) + bit%3
+		},
+		encode: func() ([]byte, error) {
+			return content, nil
+		},
+	}, nil
+}
+
+// capacity Returns the number of bytes hidden by the pixels of the image.
+func (c *coverImage) capacity() int {
+	return c.width * c.height * 3 / 8
+}
+
+// ImageCapacity Returns the format of a cover image (`ImageFormatPng` or `ImageFormatBmp`), and the number of bytes
+// that its pixels can hide (see `CarrierImage`).
+func ImageCapacity(content []byte) (string, int, error) {
+	var err error
+	var cover *coverImage
+
+	if cover, err = parseCoverImage(content); err != nil {
+		return "", 0, err
+	}
+	return cover.format, cover.capacity(), nil
+}
+
+// ImageContentType Returns the media type of a cover image (see `ImageCapacity`).
+func ImageContentType(format string) string {
+	if format == ImageFormatBmp {
+		return "image/bmp"
+	}
+	return "image/png"
+}
+
+// HideInImage Returns a cover image (PNG or BMP), whose pixels hide bytes of a chunk of the message (see
+// `coverImage`), and its format. The least significant bits that follow the hidden bytes are random: all the pixels
+// look alike.
+func HideInImage(content []byte, payload []byte) ([]byte, string, error) {
+	var err error
+	var cover *coverImage
+	var random []byte
+
+	if cover, err = parseCoverImage(content); err != nil {
+		return nil, "", err
+	}
+	if cover.capacity() < len(payload) {
+		return nil, "", fmt.Errorf(`the cover image (%dx%d) is too small to hide %d bytes in its pixels (%d bytes hidden)`, cover.width, cover.height, len(payload), cover.capacity())
+	}
+	random = make([]byte, cover.capacity())
+	if _, err = rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	copy(random, payload)
+	for bit := 0; bit < 8*len(random); bit++ {
+		var offset = cover.offset(bit)
+		cover.data[offset] = cover.data[offset]&^1 | random[bit/8]>>(7-bit%8)&1
+	}
+	if content, err = cover.encode(); err != nil {
+		return nil, "", err
+	}
+	return content, cover.format, nil
+}
+
+// ImagePayload Extracts the bytes hidden by the cover image attached to an email (RFC 5322): `length` bytes (see
+// `HideInImage`). The cover image is the first image attached to the email.
+func ImagePayload(content []byte, length int) ([]byte, error) {
+	var err error
+	var parts []leafPart
+
+	if parts, err = leafParts(content); err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		var mediaType string
+		var data []byte
+		var cover *coverImage
+		var payload = make([]byte, length)
+
+		if mediaType, _, err = mime.ParseMediaType(part.header.Get("Content-Type")); err != nil || !strings.HasPrefix(mediaType, "image/") {
+			continue
+		}
+		if data, err = part.decode(); err != nil {
+			return nil, err
+		}
+		if cover, err = parseCoverImage(data); err != nil {
+			return nil, err
+		}
+		if cover.capacity() < length {
+			return nil, fmt.Errorf(`the image attached to the email hides less than %d bytes`, length)
+		}
+		for bit := 0; bit < 8*length; bit++ {
+			payload[bit/8] |= cover.data[cover.offset(bit)] & 1 << (7 - bit%8)
+		}
+		return payload, nil
+	}
+	return nil, fmt.Errorf(`the email has no image attached`)
+}
+
+// coverImageName Returns the name of the file of the cover image attached to the emails, given the path to the cover:
+// its extension matches the format of the image.
+func coverImageName(path string, format string) string {
+	var name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	if len(name) == 0 || name == "." || name == string(filepath.Separator) {
+		name = "image"
+	}
+	return name + "." + format
+}
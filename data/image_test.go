@@ -0,0 +1,133 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestHideInImage(t *testing.T) {
+	var payload = []byte("0123456789abcdefghijklmnopqrstuv")
+
+	for _, cover := range [][]byte{newTestPng(t, 20, 10), newTestBmp(5, 20, 24), newTestBmp(7, -13, 32)} {
+		var err error
+		var format string
+		var capacity int
+		var hidden []byte
+		var hiddenFormat string
+		var boundaries = []string{strings.Repeat("0a", 35), strings.Repeat("0b", 35), strings.Repeat("0c", 35)}
+		var content []byte
+		var email []byte
+		var extracted []byte
+		var found []string
+
+		format, capacity, err = ImageCapacity(cover)
+		assert.Nil(t, err)
+		assert.GreaterOrEqual(t, capacity, len(payload))
+		hidden, hiddenFormat, err = HideInImage(cover, payload)
+		assert.Nil(t, err)
+		assert.Equal(t, format, hiddenFormat)
+		if format == ImageFormatBmp {
+			// The file is kept as is, apart from the pixels.
+			assert.Len(t, hidden, len(cover))
+			assert.Equal(t, cover[:54], hidden[:54])
+		}
+
+		// The image is attached to the nested email, which keeps its boundaries.
+		content, err = BuildNested(boundaries, []byte("Hello"), []byte("<p>Hello</p>"), "", "", BodyPayloads{Image: payload, Cover: cover, CoverPath: "/tmp/holidays.jpeg"})
+		assert.Nil(t, err)
+		assert.Contains(t, string(content), `Content-Disposition: attachment; filename=holidays.`+format)
+		assert.Contains(t, string(content), `Content-Type: `+ImageContentType(format)+`; name=holidays.`+format)
+		email = append([]byte("From: a@example.com\r\nContent-Type: multipart/mixed; boundary=\""+boundaries[0]+"\"\r\n\r\n"), content...)
+		found, err = NestedBoundaries("multipart/mixed; boundary=\""+boundaries[0]+"\"", bytes.NewReader(content))
+		assert.Nil(t, err)
+		assert.Equal(t, boundaries, found)
+		for _, length := range []int{1, len(payload)} {
+			extracted, err = ImagePayload(email, length)
+			assert.Nil(t, err)
+			assert.Equal(t, payload[:length], extracted, format)
+		}
+		_, err = ImagePayload(email, capacity+1)
+		assert.NotNil(t, err)
+	}
+
+	// Only the least significant bits change.
+	cover := newTestBmp(5, 20, 24)
+	hidden, _, err := HideInImage(cover, payload)
+	assert.Nil(t, err)
+	for i := range cover {
+		assert.LessOrEqual(t, int(cover[i]^hidden[i]), 1)
+	}
+
+	// We'll get errors...
+	_, _, err = HideInImage(newTestPng(t, 4, 4), payload)
+	assert.NotNil(t, err)
+	_, _, err = ImageCapacity([]byte("GIF89a"))
+	assert.NotNil(t, err)
+	_, _, err = ImageCapacity(newTestBmp(5, 20, 8))
+	assert.NotNil(t, err)
+	_, _, err = ImageCapacity(newTestBmp(5, 20, 24)[:100])
+	assert.NotNil(t, err)
+	_, err = BuildAlternative(strings.Repeat("0a", 35), []byte("Hello"), nil, "", "", BodyPayloads{Image: payload, Cover: cover})
+	assert.NotNil(t, err)
+	_, err = ImagePayload([]byte("Content-Type: text/plain\r\n\r\nHello"), 1)
+	assert.NotNil(t, err)
+}
+
+func TestCarriersCheckCover(t *testing.T) {
+	var carriers = Carriers{{Name: CarrierBoundary, Length: 105}, {Name: CarrierImage, Length: 32}}
+
+	assert.NotNil(t, carriers.CheckNesting(true))
+	carriers.SetCover("/tmp/cover.png")
+	assert.Nil(t, carriers.CheckNesting(true))
+	assert.NotNil(t, carriers.CheckNesting(false))
+	assert.Nil(t, carriers.CheckCover(newTestPng(t, 20, 10)))
+	assert.NotNil(t, carriers.CheckCover(newTestPng(t, 4, 4)))
+	assert.NotNil(t, carriers.CheckCover([]byte("not an image")))
+	assert.Nil(t, carriers[:1].CheckNesting(false))
+	assert.Nil(t, carriers[:1].CheckCover(nil))
+}
+
+// newTestPng Returns a PNG image of a given size.
+func newTestPng(t *testing.T, width int, height int) []byte {
+	var buffer bytes.Buffer
+	var picture = image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			picture.Set(x, y, color.RGBA{R: uint8(10 * x), G: uint8(10 * y), B: 128, A: 255})
+		}
+	}
+	assert.Nil(t, png.Encode(&buffer, picture))
+	return buffer.Bytes()
+}
+
+// newTestBmp Returns an uncompressed BMP image of a given size (a negative height means that the rows are written from
+// the top to the bottom).
+func newTestBmp(width int, height int, bitCount int) []byte {
+	var rows = height
+	var rowSize = (bitCount*width + 31) / 32 * 4
+	var content []byte
+
+	if rows < 0 {
+		rows = -rows
+	}
+	content = make([]byte, 54+rowSize*rows)
+	copy(content, "BM")
+	binary.LittleEndian.PutUint32(content[2:], uint32(len(content)))
+	binary.LittleEndian.PutUint32(content[10:], 54)
+	binary.LittleEndian.PutUint32(content[14:], 40)
+	binary.LittleEndian.PutUint32(content[18:], uint32(int32(width)))
+	binary.LittleEndian.PutUint32(content[22:], uint32(int32(height)))
+	binary.LittleEndian.PutUint16(content[26:], 1)
+	binary.LittleEndian.PutUint16(content[28:], uint16(bitCount))
+	for i := 54; i < len(content); i++ {
+		content[i] = byte(i * 7)
+	}
+	return content
+}
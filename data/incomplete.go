@@ -0,0 +1,116 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxMissingRatio and maxMissingExtra For a message that is not sequenced, at most `maxMissingRatio` chunks per chunk
+// given (plus `maxMissingExtra`) may be reported missing: beyond, the length declared by the header is considered as
+// garbage (wrong key material, or emails given in the wrong order). The bound must be tight: with the wrong key
+// material, the length of a message (V1) is a random 16-bit number.
+const maxMissingRatio = 2
+const maxMissingExtra = 2
+
+// maxListedRanges The maximum number of ranges of missing chunks listed by an `IncompleteError`.
+const maxListedRanges = 8
+
+// IncompleteError Returned when the boundaries given do not contain the whole message: some emails are missing (they
+// have not arrived yet, for example). The part of the message that precedes the first missing chunk is decoded.
+type IncompleteError struct {
+	// Sequenced Tells whether the message is sequenced: the missing chunks are known. Otherwise, the boundaries are
+	// assumed to be the first ones: the missing chunks are the last ones (or the key material is not the right one).
+	Sequenced bool
+	// Chunks The number of chunks of the message.
+	Chunks int
+	// Missing The indexes of the missing chunks (starting at 0), in increasing order.
+	Missing []int
+	// Partial The part of the message (its content, without its envelope) that precedes the first missing chunk.
+	// Please note that it is not authenticated.
+	Partial []byte
+}
+
+func (e *IncompleteError) Error() string {
+	var missing = formatIndexRanges(e.Missing, maxListedRanges)
+
+	if e.Sequenced {
+		return fmt.Sprintf(`%d email(s) missing: the message contains %d chunks, the chunks %s have not been given`, len(e.Missing), e.Chunks, missing)
+	}
+	return fmt.Sprintf(`%d email(s) missing (or wrong key material): the message contains %d chunks, only %d have been given (the chunks %s are missing)`, len(e.Missing), e.Chunks, e.Chunks-len(e.Missing), missing)
+}
+
+// formatIndexRanges Formats indexes (in increasing order) as ranges of consecutive indexes ("3-40, 42"). At most
+// `maxRanges` ranges are given: the number of indexes left out is given after them ("3-40, 42 (and 5 more)").
+func formatIndexRanges(indexes []int, maxRanges int) string {
+	var ranges []string
+	var listed int
+
+	for start := 0; start < len(indexes); {
+		var end = start
+		for end+1 < len(indexes) && indexes[end+1] == indexes[end]+1 {
+			end++
+		}
+		if len(ranges) == maxRanges {
+			break
+		}
+		if end > start {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", indexes[start], indexes[end]))
+		} else {
+			ranges = append(ranges, strconv.Itoa(indexes[start]))
+		}
+		listed = end + 1
+		start = end + 1
+	}
+	if listed < len(indexes) {
+		return fmt.Sprintf("%s (and %d more)", strings.Join(ranges, ", "), len(indexes)-listed)
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// checkComplete Checks that decoded data (`clearMessage`, decoded from `count` boundaries of `chunkSize` bytes) contains
+// the whole envelope declared by its header. If not, then an `IncompleteError` is returned.
+func checkComplete(clearMessage []byte, count int, chunkSize int) error {
+	var err error
+	var end int64
+	var chunks int64
+	var incomplete = IncompleteError{}
+
+	if _, _, end, err = envelopeExtent(clearMessage); err != nil || end <= int64(len(clearMessage)) || chunkSize <= 0 {
+		return nil
+	}
+	chunks = (end + int64(chunkSize) - 1) / int64(chunkSize)
+	if chunks-int64(count) > maxMissingRatio*int64(count)+maxMissingExtra {
+		// The header is garbage: the key material is not the right one.
+		return nil
+	}
+	incomplete.Chunks = int(chunks)
+	for i := count; i < incomplete.Chunks; i++ {
+		incomplete.Missing = append(incomplete.Missing, i)
+	}
+	incomplete.Partial = partialContent(clearMessage)
+	return &incomplete
+}
+
+// partialContent Returns the content of a truncated envelope (see `openEnvelope`): the bytes of the message that are
+// available, without the header and without the MAC. It returns nil if the header is truncated.
+func partialContent(clearMessage []byte) []byte {
+	var err error
+	var format MessageFormat
+	var headerLength int
+	var end int64
+
+	if format, headerLength, end, err = envelopeExtent(clearMessage); err != nil || headerLength > len(clearMessage) {
+		return nil
+	}
+	if format == MessageFormatV3 {
+		end -= macLength
+	}
+	if end > int64(len(clearMessage)) {
+		end = int64(len(clearMessage))
+	}
+	if end < int64(headerLength) {
+		return nil
+	}
+	return clearMessage[headerLength:end]
+}
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"umail/resource"
+)
+
+func TestIncompleteMessage(t *testing.T) {
+	var err error
+	var pad = make([]byte, 1024)
+	var key *resource.MemoryPool
+	var boundaries [][]byte
+	var incomplete *IncompleteError
+	var secret = []byte("This is the secret message!\nYou cannot detect it.\nYou cannot read it!")
+
+	for i := range pad {
+		pad[i] = byte(i * 7)
+	}
+
+	// The last email of a message that is not sequenced is missing.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	boundaries, err = EncodeMessage(secret, chunkSize, key, Encoding{})
+	assert.Nil(t, err)
+	assert.Len(t, boundaries, 3)
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	_, err = Decode(boundaries[:2], key)
+	assert.True(t, errors.As(err, &incomplete))
+	assert.False(t, incomplete.Sequenced)
+	assert.Equal(t, 3, incomplete.Chunks)
+	assert.Equal(t, []int{2}, incomplete.Missing)
+	assert.Equal(t, secret[:2*chunkSize-messageLengthTypeLength], incomplete.Partial)
+	assert.ErrorContains(t, err, "the chunks 2 are missing")
+
+	// The second email of a sequenced (and authenticated) message is missing.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	boundaries, err = EncodeMessage(secret, chunkSize, key, Encoding{Authenticated: true, Sequenced: true})
+	assert.Nil(t, err)
+	assert.Len(t, boundaries, 4)
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	_, err = Decode([][]byte{boundaries[3], boundaries[0], boundaries[2]}, key)
+	assert.True(t, errors.As(err, &incomplete))
+	assert.True(t, incomplete.Sequenced)
+	assert.Equal(t, 4, incomplete.Chunks)
+	assert.Equal(t, []int{1}, incomplete.Missing)
+	assert.Equal(t, secret[:chunkSize-sequenceHeaderLength-messageV2HeaderLength], incomplete.Partial)
+
+	// The first email is missing: nothing can be decoded.
+	_, err = Decode([][]byte{boundaries[1], boundaries[2]}, key)
+	assert.True(t, errors.As(err, &incomplete))
+	assert.Equal(t, []int{0, 3}, incomplete.Missing)
+	assert.Nil(t, incomplete.Partial)
+
+	// A header that declares a huge message is garbage (wrong key material), not a missing email.
+	assert.Nil(t, checkComplete([]byte{0, 0, 2, 0, 0, 0, 1}, 1, chunkSize))
+	assert.NotNil(t, checkComplete([]byte{0, 0, 2, 100, 0, 0, 0}, 1, chunkSize))
+	// The length of a message (V1) declares at most 65535 bytes: beyond the emails given, a few emails only may be
+	// reported missing.
+	assert.NotNil(t, checkComplete([]byte{byte(5*chunkSize - 2), 0}, 1, chunkSize))
+	assert.Nil(t, checkComplete([]byte{byte(5*chunkSize - 1), 0}, 1, chunkSize))
+	assert.Nil(t, checkComplete([]byte{0xff, 0xff}, 10, chunkSize))
+}
+
+// TestIncompleteWrongKey Checks that a message decoded with the wrong key material is rarely reported as incomplete.
+func TestIncompleteWrongKey(t *testing.T) {
+	var reported int
+
+	for length := 1; length <= 0xffff; length++ {
+		if checkComplete([]byte{byte(length), byte(length >> 8)}, 3, chunkSize) != nil {
+			reported++
+		}
+	}
+	assert.Less(t, reported, 0xffff/100)
+}
+
+func TestFormatIndexRanges(t *testing.T) {
+	var tests = []struct {
+		indexes  []int
+		expected string
+	}{
+		{nil, ""},
+		{[]int{2}, "2"},
+		{[]int{3, 4, 5, 7}, "3-5, 7"},
+		{[]int{0, 2, 4, 6}, "0, 2 (and 2 more)"},
+		{[]int{0, 1, 2, 4, 6, 7}, "0-2, 4 (and 2 more)"},
+		{[]int{1, 2, 3}, "1-3"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, formatIndexRanges(test.indexes, 2), test.indexes)
+	}
+	assert.ErrorContains(t, &IncompleteError{Chunks: 700, Missing: makeRange(10, 700)}, "the chunks 10-699 are missing")
+}
+
+// makeRange Returns the integers from `start` (included) to `end` (excluded).
+func makeRange(start int, end int) []int {
+	var result []int
+
+	for i := start; i < end; i++ {
+		result = append(result, i)
+	}
+	return result
+}
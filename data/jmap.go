@@ -0,0 +1,318 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TransportJmap The transport that retrieves the emails through JMAP (RFC 8620 and RFC 8621, see "rcv").
+const TransportJmap = "jmap"
+
+// DefaultJmapSessionURL The URL of the JMAP session resource of Fastmail.
+const DefaultJmapSessionURL = "https://api.fastmail.com/jmap/session"
+
+// jmapMaxResponse The maximum length of a response of a JMAP server (including a downloaded email).
+const jmapMaxResponse = 150 << 20
+
+// jmapPageSize The number of emails requested per Email/query or Email/get call.
+const jmapPageSize = 100
+
+// The capabilities used by the client.
+const (
+	jmapCapabilityCore = "urn:ietf:params:jmap:core"
+	jmapCapabilityMail = "urn:ietf:params:jmap:mail"
+)
+
+// JmapEmail The description of an email, as returned by Email/get.
+type JmapEmail struct {
+	Id       string
+	BlobId   string
+	Subject  string
+	From     string
+	To       []string
+	Cc       []string
+	Received time.Time
+	// Sent The date the email was sent (its "Date" header), zero if unknown.
+	Sent time.Time
+	// ContentType The value of the header "Content-Type" (as received).
+	ContentType string
+}
+
+// JmapClient A client of a JMAP server, limited to the retrieval of the emails of an account (its primary mail
+// account).
+type JmapClient struct {
+	client      *http.Client
+	token       string
+	apiURL      string
+	downloadURL string
+	accountId   string
+}
+
+// jmapSession The session resource of a JMAP server (the parts used by the client).
+type jmapSession struct {
+	ApiUrl          string            `json:"apiUrl"`
+	DownloadUrl     string            `json:"downloadUrl"`
+	PrimaryAccounts map[string]string `json:"primaryAccounts"`
+}
+
+// jmapAddress An address, as represented by JMAP.
+type jmapAddress struct {
+	Email string `json:"email"`
+}
+
+// jmapError An error returned by a method call (or by the server, for the whole request).
+type jmapError struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Detail      string `json:"detail"`
+}
+
+// NewJmapClient Creates a client: the session resource (`sessionURL`) gives the URLs of the API and the account the
+// emails are retrieved from. The token is sent as a bearer token (for example, a Fastmail API token).
+func NewJmapClient(client *http.Client, sessionURL string, token string) (*JmapClient, error) {
+	var err error
+	var body []byte
+	var session jmapSession
+
+	if body, err = jmapRequest(client, http.MethodGet, sessionURL, token, nil); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(body, &session); err != nil {
+		return nil, fmt.Errorf(`invalid JMAP session: %s`, err.Error())
+	}
+	if len(session.ApiUrl) == 0 || len(session.DownloadUrl) == 0 || len(session.PrimaryAccounts[jmapCapabilityMail]) == 0 {
+		return nil, fmt.Errorf(`invalid JMAP session: no API URL, no download URL, or no mail account`)
+	}
+	return &JmapClient{
+		client:      client,
+		token:       token,
+		apiURL:      session.ApiUrl,
+		downloadURL: session.DownloadUrl,
+		accountId:   session.PrimaryAccounts[jmapCapabilityMail],
+	}, nil
+}
+
+// MailboxId Returns the ID of a mailbox, given its name. The name "INBOX" (whatever its case) designates the mailbox
+// whose role is "inbox".
+func (c *JmapClient) MailboxId(name string) (string, error) {
+	var err error
+	var filter = map[string]interface{}{"name": name}
+	var result struct {
+		Ids []string `json:"ids"`
+	}
+
+	if strings.EqualFold(name, "INBOX") {
+		filter = map[string]interface{}{"role": "inbox"}
+	}
+	if err = c.call("Mailbox/query", map[string]interface{}{"accountId": c.accountId, "filter": filter}, &result); err != nil {
+		return "", err
+	}
+	if len(result.Ids) == 0 {
+		return "", fmt.Errorf(`unknown mailbox "%s"`, name)
+	}
+	return result.Ids[0], nil
+}
+
+// QueryEmails Returns the IDs of the emails of a mailbox that match a filter, the oldest first. The server evaluates
+// the sender, the subject, the days and the marker; the other criteria are left to the caller.
+func (c *JmapClient) QueryEmails(mailboxId string, filter EmailFilter) ([]string, error) {
+	var err error
+	var ids []string
+	var condition = map[string]interface{}{"inMailbox": mailboxId}
+
+	if len(filter.From) > 0 {
+		condition["from"] = filter.From
+	}
+	if len(filter.Subject) > 0 {
+		condition["subject"] = filter.Subject
+	}
+	if len(filter.Marker) > 0 {
+		condition["header"] = []string{"Message-ID", filter.Marker}
+	}
+	if !filter.Since.IsZero() {
+		condition["after"] = filter.Since.UTC().Format(time.RFC3339)
+	}
+	if !filter.Before.IsZero() {
+		condition["before"] = filter.Before.UTC().Format(time.RFC3339)
+	}
+	for {
+		var result struct {
+			Ids []string `json:"ids"`
+		}
+		var arguments = map[string]interface{}{
+			"accountId": c.accountId,
+			"filter":    condition,
+			"sort":      []map[string]interface{}{{"property": "receivedAt", "isAscending": true}},
+			"position":  len(ids),
+			"limit":     jmapPageSize,
+		}
+
+		if err = c.call("Email/query", arguments, &result); err != nil {
+			return nil, err
+		}
+		ids = append(ids, result.Ids...)
+		if len(result.Ids) < jmapPageSize {
+			return ids, nil
+		}
+	}
+}
+
+// GetEmails Returns the descriptions of emails, in the order of their IDs. The emails that no longer exist are
+// omitted.
+func (c *JmapClient) GetEmails(ids []string) ([]JmapEmail, error) {
+	var err error
+	var emails []JmapEmail
+
+	for start := 0; start < len(ids); start += jmapPageSize {
+		var page = ids[start:]
+		var found = map[string]JmapEmail{}
+		var result struct {
+			List []struct {
+				Id          string        `json:"id"`
+				BlobId      string        `json:"blobId"`
+				Subject     string        `json:"subject"`
+				From        []jmapAddress `json:"from"`
+				To          []jmapAddress `json:"to"`
+				Cc          []jmapAddress `json:"cc"`
+				ReceivedAt  time.Time     `json:"receivedAt"`
+				SentAt      *time.Time    `json:"sentAt"`
+				ContentType *string       `json:"header:Content-Type"`
+			} `json:"list"`
+		}
+		var arguments = map[string]interface{}{
+			"accountId":  c.accountId,
+			"properties": []string{"id", "blobId", "subject", "from", "to", "cc", "receivedAt", "sentAt", "header:Content-Type"},
+		}
+
+		if len(page) > jmapPageSize {
+			page = page[:jmapPageSize]
+		}
+		arguments["ids"] = page
+		if err = c.call("Email/get", arguments, &result); err != nil {
+			return nil, err
+		}
+		for _, value := range result.List {
+			var email = JmapEmail{Id: value.Id, BlobId: value.BlobId, Subject: value.Subject, Received: value.ReceivedAt}
+			if len(value.From) > 0 {
+				email.From = value.From[0].Email
+			}
+			for _, address := range value.To {
+				email.To = append(email.To, address.Email)
+			}
+			for _, address := range value.Cc {
+				email.Cc = append(email.Cc, address.Email)
+			}
+			if value.SentAt != nil {
+				email.Sent = *value.SentAt
+			}
+			if value.ContentType != nil {
+				// The header is in its raw form: it may be folded.
+				email.ContentType = strings.TrimSpace(strings.NewReplacer("\r\n", "", "\n", "").Replace(*value.ContentType))
+			}
+			found[value.Id] = email
+		}
+		for _, id := range page {
+			if email, ok := found[id]; ok {
+				emails = append(emails, email)
+			}
+		}
+	}
+	return emails, nil
+}
+
+// Download Returns the content of an email (RFC 5322), as received, given its blob ID.
+func (c *JmapClient) Download(blobId string) ([]byte, error) {
+	var endpoint = strings.NewReplacer(
+		"{accountId}", url.PathEscape(c.accountId),
+		"{blobId}", url.PathEscape(blobId),
+		"{type}", url.QueryEscape("message/rfc822"),
+		"{name}", "email.eml",
+	).Replace(c.downloadURL)
+
+	return jmapRequest(c.client, http.MethodGet, endpoint, c.token, nil)
+}
+
+// call Calls a method of the API, and decodes its response into `result`.
+func (c *JmapClient) call(method string, arguments interface{}, result interface{}) error {
+	var err error
+	var payload []byte
+	var body []byte
+	var response struct {
+		MethodResponses [][]json.RawMessage `json:"methodResponses"`
+	}
+	var name string
+	var callError jmapError
+
+	if payload, err = json.Marshal(map[string]interface{}{
+		"using":       []string{jmapCapabilityCore, jmapCapabilityMail},
+		"methodCalls": []interface{}{[]interface{}{method, arguments, "0"}},
+	}); err != nil {
+		return err
+	}
+	if body, err = jmapRequest(c.client, http.MethodPost, c.apiURL, c.token, payload); err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, &response); err != nil || len(response.MethodResponses) == 0 || len(response.MethodResponses[0]) < 2 {
+		return fmt.Errorf(`invalid response from the JMAP server to %s`, method)
+	}
+	if err = json.Unmarshal(response.MethodResponses[0][0], &name); err != nil {
+		return fmt.Errorf(`invalid response from the JMAP server to %s`, method)
+	}
+	if name == "error" {
+		_ = json.Unmarshal(response.MethodResponses[0][1], &callError)
+		return fmt.Errorf(`the JMAP server rejected %s: %s`, method, callError.message())
+	}
+	if err = json.Unmarshal(response.MethodResponses[0][1], result); err != nil {
+		return fmt.Errorf(`invalid response from the JMAP server to %s: %s`, method, err.Error())
+	}
+	return nil
+}
+
+// message Returns the description of the error, or its type if it has no description.
+func (e jmapError) message() string {
+	switch {
+	case len(e.Description) > 0:
+		return fmt.Sprintf("%s (%s)", e.Description, e.Type)
+	case len(e.Detail) > 0:
+		return fmt.Sprintf("%s (%s)", e.Detail, e.Type)
+	}
+	return e.Type
+}
+
+// jmapRequest Sends a request to a JMAP server (a JSON payload, if any), and returns the body of the response.
+func jmapRequest(client *http.Client, method string, endpoint string, token string, payload []byte) ([]byte, error) {
+	var err error
+	var request *http.Request
+	var response *http.Response
+	var body []byte
+	var requestError jmapError
+
+	if request, err = http.NewRequest(method, endpoint, bytes.NewReader(payload)); err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if response, err = client.Do(request); err != nil {
+		return nil, fmt.Errorf(`cannot send the request to the JMAP server: %w`, err)
+	}
+	defer response.Body.Close()
+	if body, err = io.ReadAll(io.LimitReader(response.Body, jmapMaxResponse)); err != nil {
+		return nil, fmt.Errorf(`cannot read the response of the JMAP server: %s`, err.Error())
+	}
+	if response.StatusCode != http.StatusOK {
+		// The errors of the requests are "problem details" (RFC 7807).
+		if json.Unmarshal(body, &requestError) == nil && len(requestError.Type) > 0 {
+			return nil, fmt.Errorf(`the JMAP server rejected the request: %s`, requestError.message())
+		}
+		return nil, fmt.Errorf(`unexpected response from the JMAP server (status %d)`, response.StatusCode)
+	}
+	return body, nil
+}
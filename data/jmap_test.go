@@ -0,0 +1,111 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJmapClient(t *testing.T) {
+	var err error
+	var server *httptest.Server
+	var client *JmapClient
+	var mailboxId string
+	var ids []string
+	var emails []JmapEmail
+	var content []byte
+	var queried map[string]interface{}
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			MethodCalls [][]json.RawMessage `json:"methodCalls"`
+		}
+		var method string
+		var arguments map[string]interface{}
+
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = fmt.Fprint(w, `{"type":"about:blank","detail":"Invalid token"}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/session":
+			_, _ = fmt.Fprintf(w, `{"apiUrl":"http://%s/api","downloadUrl":"http://%s/download/{accountId}/{blobId}/{name}?type={type}","primaryAccounts":{"urn:ietf:params:jmap:mail":"u1"}}`, r.Host, r.Host)
+			return
+		case "/download/u1/B2/email.eml":
+			assert.Equal(t, "message/rfc822", r.URL.Query().Get("type"))
+			_, _ = fmt.Fprint(w, "Subject: Hi\r\n\r\nHello\r\n")
+			return
+		case "/api":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		_ = json.Unmarshal(request.MethodCalls[0][0], &method)
+		_ = json.Unmarshal(request.MethodCalls[0][1], &arguments)
+		assert.Equal(t, "u1", arguments["accountId"])
+		switch method {
+		case "Mailbox/query":
+			if arguments["filter"].(map[string]interface{})["role"] == "inbox" {
+				_, _ = fmt.Fprint(w, `{"methodResponses":[["Mailbox/query",{"ids":["M1"]},"0"]]}`)
+			} else {
+				_, _ = fmt.Fprint(w, `{"methodResponses":[["Mailbox/query",{"ids":[]},"0"]]}`)
+			}
+		case "Email/query":
+			queried = arguments["filter"].(map[string]interface{})
+			_, _ = fmt.Fprint(w, `{"methodResponses":[["Email/query",{"ids":["E1","E2","E3"]},"0"]]}`)
+		case "Email/get":
+			// The list is not in the order of the IDs, and E3 no longer exists.
+			_, _ = fmt.Fprint(w, `{"methodResponses":[["Email/get",{"list":[`+
+				`{"id":"E2","blobId":"B2","subject":"Re: Hi","from":[{"email":"jane@example.com"}],"cc":[{"email":"joe@example.com"}],"receivedAt":"2024-01-03T00:00:00Z","sentAt":"2024-01-02T23:59:58+01:00","header:Content-Type":" multipart/alternative;\r\n boundary=\"0a1b\""},`+
+				`{"id":"E1","blobId":"B1","subject":"Hi","to":[{"email":"john@example.com"}],"receivedAt":"2024-01-02T03:04:05Z"}`+
+				`],"notFound":["E3"]},"0"]]}`)
+		default:
+			_, _ = fmt.Fprint(w, `{"methodResponses":[["error",{"type":"unknownMethod"},"0"]]}`)
+		}
+	}))
+	defer server.Close()
+
+	_, err = NewJmapClient(server.Client(), server.URL+"/session", "bad")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Invalid token")
+
+	client, err = NewJmapClient(server.Client(), server.URL+"/session", "good")
+	assert.Nil(t, err)
+
+	mailboxId, err = client.MailboxId("inbox")
+	assert.Nil(t, err)
+	assert.Equal(t, "M1", mailboxId)
+	_, err = client.MailboxId("Archive")
+	assert.NotNil(t, err)
+
+	ids, err = client.QueryEmails(mailboxId, EmailFilter{From: "jane@example.com", Since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"E1", "E2", "E3"}, ids)
+	assert.Equal(t, map[string]interface{}{"inMailbox": "M1", "from": "jane@example.com", "after": "2024-01-01T00:00:00Z"}, queried)
+	_, err = client.QueryEmails(mailboxId, EmailFilter{Marker: "1a2b3c4d"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"inMailbox": "M1", "header": []interface{}{"Message-ID", "1a2b3c4d"}}, queried)
+
+	emails, err = client.GetEmails(ids)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(emails))
+	assert.Equal(t, JmapEmail{Id: "E1", BlobId: "B1", Subject: "Hi", To: []string{"john@example.com"}, Received: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, emails[0])
+	assert.Equal(t, "jane@example.com", emails[1].From)
+	assert.Equal(t, []string{"joe@example.com"}, emails[1].Cc)
+	assert.True(t, emails[1].Sent.Equal(time.Date(2024, 1, 2, 22, 59, 58, 0, time.UTC)))
+	assert.Equal(t, `multipart/alternative; boundary="0a1b"`, emails[1].ContentType)
+
+	content, err = client.Download("B2")
+	assert.Nil(t, err)
+	assert.Equal(t, "Subject: Hi\r\n\r\nHello\r\n", string(content))
+
+	err = client.call("Thread/get", map[string]interface{}{"accountId": "u1"}, &struct{}{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknownMethod")
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"time"
+)
+
+// Copies The recipients of the copies of an email, as lists of addresses separated by commas (see
+// `FormatAddressList`). The "Cc" recipients are visible to all the recipients, the "Bcc" recipients are not.
+type Copies struct {
+	Cc  string `json:"cc,omitempty"`
+	Bcc string `json:"bcc,omitempty"`
+}
+
+// Recipients Returns the addresses of the mailboxes of the recipients of the copies ("Cc", then "Bcc"). It is an error
+// if a list is invalid.
+func (c Copies) Recipients() ([]string, error) {
+	var result []string
+
+	for _, list := range []string{c.Cc, c.Bcc} {
+		var err error
+		var addresses []string
+		if len(list) == 0 {
+			continue
+		}
+		if addresses, err = EnvelopeAddresses(list); err != nil {
+			return nil, err
+		}
+		result = append(result, addresses...)
+	}
+	return result, nil
+}
+
+// JournalEntry The record of an email successfully sent.
+type JournalEntry struct {
+	// Date The date of the sending.
+	Date time.Time `json:"date"`
+	// Recipient The address of the recipient (or the addresses of the "To" recipients, separated by commas).
+	Recipient string `json:"recipient"`
+	// Copies The recipients of the copies of the email, if any.
+	Copies
+	// Boundary The index of the boundary sent.
+	Boundary int `json:"boundary"`
+	// MessageID The value of the "Message-ID" header of the email.
+	MessageID string `json:"message-id"`
+	// Body The path to the file that contains the body of the email.
+	Body string `json:"body,omitempty"`
+	// Gap The random time waited before sending the email (see "send-all --min-interval" and the daemon). Zero if the
+	// email was sent without waiting.
+	Gap time.Duration `json:"gap,omitempty"`
+}
+
+// RecordSend Appends the record of an email successfully sent to the journal of the session, with the recipients of
+// its copies and the time waited before sending it (if any).
+// Please note that the journal is kept when the session is rewound: it gives all the emails that have been sent.
+func (s *Session) RecordSend(recipient string, copies Copies, boundary int, messageID string, body string, gap time.Duration) {
+	s.Journal = append(s.Journal, JournalEntry{
+		Date:      time.Now().UTC().Truncate(time.Second),
+		Recipient: recipient,
+		Copies:    copies,
+		Boundary:  boundary,
+		MessageID: messageID,
+		Body:      body,
+		Gap:       gap.Truncate(time.Millisecond),
+	})
+}
+
+// JournalOf Returns the records of the emails sent to a given recipient.
+func (s *Session) JournalOf(recipient string) []JournalEntry {
+	var result []JournalEntry
+
+	for _, entry := range s.Journal {
+		if entry.Recipient == recipient {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// AverageInterval Returns the average time between two emails sent, as recorded by the journal. The average cannot be
+// computed if the journal contains less than two entries.
+func (s *Session) AverageInterval() (time.Duration, bool) {
+	var count = len(s.Journal)
+
+	if count < 2 {
+		return 0, false
+	}
+	return s.Journal[count-1].Date.Sub(s.Journal[0].Date) / time.Duration(count-1), true
+}
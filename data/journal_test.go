@@ -0,0 +1,66 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSessionJournal(t *testing.T) {
+	var err error
+	var session Session
+	var loaded Session
+
+	session.Init("key", 0)
+	session.AddBoundary([]byte{1, 2})
+	session.AddBoundary([]byte{3, 4})
+	session.RecordSend("alice@example.com", Copies{}, 0, "<1@example.com>", "body1.txt", 0)
+	session.RecordSend("bob@example.com", Copies{Cc: "carol@example.com", Bcc: "dave@example.com"}, 0, "<2@example.com>", "body2.txt", 0)
+	session.RecordSend("alice@example.com", Copies{}, 1, "<3@example.com>", "body1.txt", 4*time.Minute+12*time.Second+300*time.Millisecond+42*time.Microsecond)
+	assert.Len(t, session.JournalOf("alice@example.com"), 2)
+	assert.Len(t, session.JournalOf("carol@example.com"), 0)
+
+	// The journal is saved, and kept when the session is rewound.
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Reset(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, session.Journal, loaded.Journal)
+	assert.Equal(t, 1, loaded.Journal[2].Boundary)
+	assert.Equal(t, "<3@example.com>", loaded.Journal[2].MessageID)
+	assert.Equal(t, "body1.txt", loaded.Journal[2].Body)
+	assert.Equal(t, Copies{Cc: "carol@example.com", Bcc: "dave@example.com"}, loaded.Journal[1].Copies)
+	assert.Equal(t, Copies{}, loaded.Journal[0].Copies)
+	assert.Equal(t, time.Duration(0), loaded.Journal[0].Gap)
+	assert.Equal(t, 4*time.Minute+12*time.Second+300*time.Millisecond, loaded.Journal[2].Gap)
+}
+
+func TestCopiesRecipients(t *testing.T) {
+	var recipients, err = Copies{Cc: "Carol <carol@example.com>, dave@example.com", Bcc: "erin@example.com"}.Recipients()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"carol@example.com", "dave@example.com", "erin@example.com"}, recipients)
+	recipients, err = Copies{}.Recipients()
+	assert.Nil(t, err)
+	assert.Empty(t, recipients)
+	_, err = Copies{Bcc: "erin@"}.Recipients()
+	assert.NotNil(t, err)
+}
+
+func TestSessionAverageInterval(t *testing.T) {
+	var session Session
+	var average time.Duration
+	var ok bool
+	var start = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	_, ok = session.AverageInterval()
+	assert.False(t, ok)
+	session.Journal = []JournalEntry{
+		{Date: start},
+		{Date: start.Add(time.Minute)},
+		{Date: start.Add(4 * time.Minute)},
+	}
+	average, ok = session.AverageInterval()
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, average)
+}
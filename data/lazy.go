@@ -0,0 +1,156 @@
+package data
+
+import (
+	"fmt"
+	"umail/resource"
+)
+
+// InitLazy Initializes a lazy session: the key material is not consumed when the session is created, but when each
+// email is sent (see `PrepareBoundary` and `CommitBoundary`). Thus, the key material of the emails that are never sent
+// is not lost.
+// Please note that a lazy session contains the (plain) message: it should be protected.
+func (s *Session) InitLazy(poolName string, poolPointerPosition int64, plainMessage []byte, boundaryLength int) error {
+	var err error
+	var message Message
+
+	if boundaryLength <= 0 {
+		return fmt.Errorf(`invalid boundary length (%d)`, boundaryLength)
+	}
+	if err = message.FromBytes(plainMessage, boundaryLength); err != nil {
+		return err
+	}
+	s.Init(poolName, poolPointerPosition)
+	s.Lazy = true
+	s.Message = plainMessage
+	s.BoundaryLength = boundaryLength
+	s.MessageHash = MessageHash(plainMessage)
+	for i := 0; i < message.BoundariesCount(); i++ {
+		s.AddBoundary(nil)
+		s.Positions = append(s.Positions, -1)
+	}
+	return nil
+}
+
+// IsAllocated Tells whether the boundary at a given index has been computed (that is, whether the key material it uses
+// has been consumed). The boundaries of a session that is not lazy are always allocated.
+func (s *Session) IsAllocated(index int) bool {
+	return len(s.Boundaries[index]) > 0
+}
+
+// PrepareBoundary Returns the boundary at a given index.
+// For a lazy session, if the boundary has not been allocated yet, then it is computed using the key material at the
+// current position of the key, which is *NOT* consumed: the boundary must be committed (see `CommitBoundary`) before it
+// leaves the process, otherwise its key material may be used again by another email. `key` may be nil if the session
+// is not lazy.
+func (s *Session) PrepareBoundary(index int, key resource.KeySource) ([]byte, error) {
+	var err error
+	var chunks Message
+	var material []byte
+
+	if index < 0 || index >= len(s.Boundaries) {
+		return nil, fmt.Errorf(`invalid boundary index (%d): the session contains %d boundaries`, index, len(s.Boundaries))
+	}
+	if s.IsAllocated(index) {
+		return s.Boundaries[index], nil
+	}
+	if err = chunks.FromBytes(s.Message, s.BoundaryLength); err != nil {
+		return nil, err
+	}
+	if material, err = key.Peek(int64(len(chunks[index]))); err != nil {
+		return nil, fmt.Errorf(`not enough bytes left into the key (needed %d bytes): %s`, len(chunks[index]), err.Error())
+	}
+	return Cypher(chunks[index], material)
+}
+
+// AllocateBoundary Returns the boundary at a given index. For a lazy session, the boundary is committed (see
+// `CommitBoundary`) if it has not been allocated yet: the boundary must be allocated before the email leaves the process
+// (sent, written into a file, or partially transmitted before an error), so that its key material is never used by
+// another email. An email sent again uses the same boundary. `key` may be nil if the session is not lazy.
+func (s *Session) AllocateBoundary(index int, key resource.KeySource) ([]byte, error) {
+	var err error
+	var boundary []byte
+
+	if boundary, err = s.PrepareBoundary(index, key); err != nil {
+		return nil, err
+	}
+	if err = s.CommitBoundary(index, boundary, key); err != nil {
+		return nil, err
+	}
+	return boundary, nil
+}
+
+// CommitBoundary Records a boundary returned by `PrepareBoundary` (once the email has been sent), and consumes the key
+// material it uses. Nothing is done if the boundary was already allocated.
+// Please note that the boundary is recorded even if the key material cannot be consumed.
+func (s *Session) CommitBoundary(index int, boundary []byte, key resource.KeySource) error {
+	var err error
+
+	if s.IsAllocated(index) {
+		return nil
+	}
+	s.Boundaries[index] = boundary
+	s.Positions[index] = key.Position()
+	if err = key.Consume(int64(len(boundary))); err != nil {
+		return fmt.Errorf(`cannot consume the key material used by boundary %d (position %d): %s`, index, s.Positions[index], err.Error())
+	}
+	return nil
+}
+
+// verifyLazy Checks that the boundaries allocated so far match the message, given the key material they use.
+func (s *Session) verifyLazy(key resource.KeySource) error {
+	var err error
+	var chunks Message
+
+	if err = chunks.FromBytes(s.Message, s.BoundaryLength); err != nil {
+		return err
+	}
+	if len(chunks) != len(s.Boundaries) {
+		return fmt.Errorf(`the message contains %d chunks, but the session contains %d boundaries`, len(chunks), len(s.Boundaries))
+	}
+	for i, boundary := range s.Boundaries {
+		var material []byte
+		var expected []byte
+		if !s.IsAllocated(i) {
+			continue
+		}
+		if material, err = key.ReadAt(s.Positions[i], int64(len(boundary))); err != nil {
+			return fmt.Errorf(`cannot read the key material used by boundary %d (%d bytes from position %d): %s`, i, len(boundary), s.Positions[i], err.Error())
+		}
+		if expected, err = Cypher(chunks[i], material); err != nil {
+			return err
+		}
+		if string(expected) != string(boundary) {
+			return fmt.Errorf(`boundary %d does not match the message (wrong key or corrupted session)`, i)
+		}
+	}
+	if MessageHash(s.Message) != s.MessageHash {
+		return fmt.Errorf(`the message does not match the hash of the message (corrupted session)`)
+	}
+	return nil
+}
+
+// validateLazy Checks the consistency of a lazy session: the allocated boundaries have the expected length, and their
+// positions are known.
+func (s *Session) validateLazy() error {
+	if s.BoundaryLength <= 0 {
+		return fmt.Errorf(`invalid session: invalid boundary length (%d)`, s.BoundaryLength)
+	}
+	if len(s.Message) == 0 && len(s.Boundaries) > 0 {
+		return fmt.Errorf(`invalid session: the message is missing`)
+	}
+	if len(s.Positions) != len(s.Boundaries) {
+		return fmt.Errorf(`invalid session: %d positions for %d boundaries`, len(s.Positions), len(s.Boundaries))
+	}
+	for i, boundary := range s.Boundaries {
+		if len(boundary) == 0 {
+			continue
+		}
+		if len(boundary) != s.BoundaryLength {
+			return fmt.Errorf(`invalid session: boundary %d contains %d bytes (expected %d)`, i, len(boundary), s.BoundaryLength)
+		}
+		if s.Positions[i] < 0 {
+			return fmt.Errorf(`invalid session: invalid position (%d) for boundary %d`, s.Positions[i], i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"umail/resource"
+)
+
+func TestSessionLazy(t *testing.T) {
+	var err error
+	var session Session
+	var loaded Session
+	var key *resource.MemoryPool
+	var boundary []byte
+	var decoded []byte
+	var plain = []byte("the message to hide, which is longer than a boundary")
+	var material = make([]byte, 256)
+
+	for i := range material {
+		material[i] = byte(i * 7)
+	}
+	key, err = resource.NewMemoryPool(material, 10)
+	assert.Nil(t, err)
+
+	// No key material is consumed when the session is created.
+	err = session.InitLazy("key", key.Position(), plain, 35)
+	assert.Nil(t, err)
+	assert.Len(t, session.Boundaries, 2)
+	assert.False(t, session.IsAllocated(0))
+	assert.Equal(t, int64(10), key.Position())
+
+	// The boundary is computed, but the key material is consumed only once committed.
+	boundary, err = session.PrepareBoundary(0, key)
+	assert.Nil(t, err)
+	assert.Len(t, boundary, 35)
+	assert.Equal(t, int64(10), key.Position())
+	err = session.CommitBoundary(0, boundary, key)
+	assert.Nil(t, err)
+	assert.True(t, session.IsAllocated(0))
+	assert.Equal(t, int64(45), key.Position())
+	assert.Equal(t, int64(10), session.Positions[0])
+
+	// An allocated boundary does not change.
+	boundary, err = session.PrepareBoundary(0, key)
+	assert.Nil(t, err)
+	assert.Equal(t, session.Boundaries[0], boundary)
+
+	// Save and load (the second boundary is not allocated).
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.True(t, loaded.Lazy)
+	assert.True(t, loaded.IsAllocated(0))
+	assert.False(t, loaded.IsAllocated(1))
+	assert.Equal(t, []int64{10, -1}, loaded.Positions)
+
+	// Verification.
+	err = loaded.Verify(key)
+	assert.Nil(t, err)
+	loaded.Boundaries[0][0] ^= 0xff
+	err = loaded.Verify(key)
+	assert.NotNil(t, err)
+	decoded, err = loaded.DecodeMessage(key)
+	assert.Nil(t, err)
+	assert.Equal(t, plain, decoded)
+}
+
+func TestSessionAllocateBoundary(t *testing.T) {
+	var err error
+	var key *resource.MemoryPool
+	var sessions = make([]Session, 2)
+	var material = make([]byte, 512)
+	var used = map[int64]int{}
+
+	key, err = resource.NewMemoryPool(material, 0)
+	assert.Nil(t, err)
+	for i := range sessions {
+		assert.Nil(t, sessions[i].InitLazy("key", key.Position(), []byte("the message to hide, which is longer than a boundary"), 35))
+	}
+
+	// The sessions send their emails in turn, and each email is sent twice (as if the first try failed, or the email was
+	// only written into a file): the key material of each boundary is used by this boundary only.
+	for index := 0; index < 2; index++ {
+		for i := range sessions {
+			var first, second []byte
+			first, err = sessions[i].AllocateBoundary(index, key)
+			assert.Nil(t, err)
+			second, err = sessions[i].AllocateBoundary(index, key)
+			assert.Nil(t, err)
+			assert.Equal(t, first, second)
+			for position := sessions[i].Positions[index]; position < sessions[i].Positions[index]+35; position++ {
+				used[position]++
+			}
+		}
+	}
+	assert.Len(t, used, 4*35)
+	for position, count := range used {
+		assert.Equal(t, 1, count, position)
+	}
+	assert.Equal(t, int64(4*35), key.Position())
+}
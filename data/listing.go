@@ -0,0 +1,71 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EmailListing How the emails that have a boundary are listed, or selected, instead of being asked for (see "rcv
+// --list" and "rcv --select").
+type EmailListing struct {
+	// List The emails are only listed: none is processed.
+	List bool
+	// Json The emails listed are printed as JSON (see `WriteListedEmails`).
+	Json bool
+	// Selection The emails to process (see `ParseEmailSelection`), or an empty string if they are asked for.
+	Selection string
+}
+
+// Validate Checks the listing, given whether the emails are waited for (see "rcv --watch").
+func (l EmailListing) Validate(watch bool) error {
+	if l.Json && !l.List {
+		return fmt.Errorf(`only the emails listed can be printed as JSON (--list)`)
+	}
+	if l.List && len(l.Selection) > 0 {
+		return fmt.Errorf(`the emails listed (--list) are not processed: no email can be selected (--select)`)
+	}
+	if (l.List || len(l.Selection) > 0) && watch {
+		return fmt.Errorf(`the emails waited for (--watch) cannot be listed (--list), nor selected (--select)`)
+	}
+	return nil
+}
+
+// ListedEmail An email listed by "rcv --list --json".
+type ListedEmail struct {
+	Index uint32 `json:"index"`
+	// Account The user of the account that received the email, if the emails of several accounts are listed.
+	Account string `json:"account,omitempty"`
+	// Uid The UID of the email (IMAP).
+	Uid        uint32   `json:"uid,omitempty"`
+	Sent       string   `json:"sent,omitempty"`
+	From       string   `json:"from"`
+	Subject    string   `json:"subject"`
+	Boundaries []string `json:"boundaries"`
+	// Pending Tells whether the body of the email is only fetched once the email is selected (IMAP): its boundaries are
+	// unknown.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// SetSent Sets the date the email was sent (RFC 3339), unless it is unknown (zero).
+func (e *ListedEmail) SetSent(sent time.Time) {
+	if !sent.IsZero() {
+		e.Sent = sent.Format(time.RFC3339)
+	}
+}
+
+// WriteListedEmails Writes the emails listed as a JSON array (an empty array if no email is listed).
+func WriteListedEmails(w io.Writer, emails []ListedEmail) error {
+	var err error
+	var content []byte
+
+	if emails == nil {
+		emails = []ListedEmail{}
+	}
+	if content, err = json.MarshalIndent(emails, "", "  "); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", content)
+	return err
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEmailListingValidate(t *testing.T) {
+	for _, test := range []struct {
+		listing EmailListing
+		watch   bool
+		valid   bool
+	}{
+		{listing: EmailListing{}, valid: true},
+		{listing: EmailListing{}, watch: true, valid: true},
+		{listing: EmailListing{List: true}, valid: true},
+		{listing: EmailListing{List: true, Json: true}, valid: true},
+		{listing: EmailListing{Selection: "1,3,7-9"}, valid: true},
+		{listing: EmailListing{Json: true}, valid: false},
+		{listing: EmailListing{Json: true, Selection: "all"}, valid: false},
+		{listing: EmailListing{List: true, Selection: "all"}, valid: false},
+		{listing: EmailListing{List: true}, watch: true, valid: false},
+		{listing: EmailListing{Selection: "all"}, watch: true, valid: false},
+	} {
+		assert.Equal(t, test.valid, test.listing.Validate(test.watch) == nil, "%+v (watch: %t)", test.listing, test.watch)
+	}
+}
+
+func TestWriteListedEmails(t *testing.T) {
+	var buffer bytes.Buffer
+	var email = ListedEmail{Index: 3, Uid: 42, From: "bill@posteo.net", Subject: "Holidays", Boundaries: []string{"0a0b"}}
+	var unknown = ListedEmail{Index: 7, Account: "john", From: "joe@posteo.net", Boundaries: []string{"0c0d", "0e0f"}}
+
+	email.SetSent(time.Date(2024, 5, 17, 9, 30, 0, 0, time.UTC))
+	unknown.SetSent(time.Time{})
+	assert.Nil(t, WriteListedEmails(&buffer, []ListedEmail{email, unknown}))
+	assert.JSONEq(t, `[
+		{"index": 3, "uid": 42, "sent": "2024-05-17T09:30:00Z", "from": "bill@posteo.net", "subject": "Holidays", "boundaries": ["0a0b"]},
+		{"index": 7, "account": "john", "from": "joe@posteo.net", "subject": "", "boundaries": ["0c0d", "0e0f"]}
+	]`, buffer.String())
+
+	// No email is listed.
+	buffer.Reset()
+	assert.Nil(t, WriteListedEmails(&buffer, nil))
+	assert.Equal(t, "[]\n", buffer.String())
+
+	// The body of the email has not been fetched.
+	buffer.Reset()
+	assert.Nil(t, WriteListedEmails(&buffer, []ListedEmail{{Index: 2, Uid: 40, From: "bill@posteo.net", Pending: true}}))
+	assert.JSONEq(t, `[{"index": 2, "uid": 40, "from": "bill@posteo.net", "subject": "", "boundaries": null, "pending": true}]`, buffer.String())
+}
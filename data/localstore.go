@@ -0,0 +1,103 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// mboxSeparator The beginning of the line that separates the emails of a mbox file.
+var mboxSeparator = []byte("From ")
+
+// MaildirEmails Returns the paths to the emails of a Maildir (the ones in "cur" and in "new"), the oldest first (the
+// names of the files begin with the time of the delivery). The emails being delivered ("tmp") are ignored.
+func MaildirEmails(dir string) ([]string, error) {
+	var err error
+	var paths []string
+	var found bool
+
+	for _, sub := range []string{"cur", "new"} {
+		var entries []os.DirEntry
+
+		if entries, err = os.ReadDir(filepath.Join(dir, sub)); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && entry.Name()[0] != '.' {
+				paths = append(paths, filepath.Join(dir, sub, entry.Name()))
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf(`"%s" is not a Maildir (it has neither "cur" nor "new" directory)`, dir)
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return filepath.Base(paths[i]) < filepath.Base(paths[j])
+	})
+	return paths, nil
+}
+
+// ScanMbox Reads the emails of a mbox file, in the order of the file, and calls `handle` for each of them (the
+// content of the email, without its "From " line). An email begins with a line that starts with "From ", at the
+// beginning of the file or after an empty line. The lines escaped by the mbox format (">From ", ">>From "...) are
+// restored.
+func ScanMbox(r io.Reader, handle func(email []byte) error) error {
+	var err error
+	var reader = bufio.NewReader(r)
+	var email []byte
+	var started bool
+	var blank = true
+
+	for {
+		var line []byte
+
+		if line, err = reader.ReadBytes('\n'); err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) == 0 && err == io.EOF {
+			break
+		}
+		if blank && bytes.HasPrefix(line, mboxSeparator) {
+			if started {
+				if err = handle(trimMboxEmail(email)); err != nil {
+					return err
+				}
+			}
+			started = true
+			email = nil
+			blank = false
+			continue
+		}
+		if !started {
+			return fmt.Errorf(`invalid mbox file: it does not begin with a "From " line`)
+		}
+		if trimmed := bytes.TrimLeft(line, ">"); len(trimmed) < len(line) && bytes.HasPrefix(trimmed, mboxSeparator) {
+			line = line[1:]
+		}
+		email = append(email, line...)
+		blank = len(bytes.TrimRight(line, "\r\n")) == 0
+	}
+	if started {
+		return handle(trimMboxEmail(email))
+	}
+	return nil
+}
+
+// trimMboxEmail Removes the empty line that separates an email from the next one.
+func trimMboxEmail(email []byte) []byte {
+	switch {
+	case bytes.HasSuffix(email, []byte("\r\n\r\n")):
+		return email[:len(email)-2]
+	case bytes.HasSuffix(email, []byte("\n\n")):
+		return email[:len(email)-1]
+	}
+	return email
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaildirEmails(t *testing.T) {
+	var err error
+	var paths []string
+	var dir = t.TempDir()
+
+	_, err = MaildirEmails(dir)
+	assert.NotNil(t, err)
+
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		assert.Nil(t, os.Mkdir(filepath.Join(dir, sub), 0700))
+	}
+	for _, path := range []string{"cur/1700000002.M2P1.host", "new/1700000003.M3P1.host", "cur/1700000001.M1P1.host", "tmp/1700000004.M4P1.host", "cur/.hidden"} {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, path), []byte("Subject: x\r\n\r\n"), 0600))
+	}
+	paths, err = MaildirEmails(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "cur", "1700000001.M1P1.host"),
+		filepath.Join(dir, "cur", "1700000002.M2P1.host"),
+		filepath.Join(dir, "new", "1700000003.M3P1.host"),
+	}, paths)
+}
+
+func TestScanMbox(t *testing.T) {
+	var emails []string
+	var mbox = "From bill@example.com Sat Jan  6 10:00:00 2024\n" +
+		"Subject: one\n\nHello\n>From the sender\n>>From twice\nFrom inside a paragraph\n\n" +
+		"From jane@example.com Sun Jan  7 10:00:00 2024\n" +
+		"Subject: two\n\nBye\n"
+	var collect = func(email []byte) error {
+		emails = append(emails, string(email))
+		return nil
+	}
+
+	assert.Nil(t, ScanMbox(strings.NewReader(mbox), collect))
+	assert.Equal(t, []string{
+		"Subject: one\n\nHello\nFrom the sender\n>From twice\nFrom inside a paragraph\n",
+		"Subject: two\n\nBye\n",
+	}, emails)
+
+	emails = nil
+	assert.Nil(t, ScanMbox(strings.NewReader(""), collect))
+	assert.Nil(t, emails)
+	assert.NotNil(t, ScanMbox(strings.NewReader("Subject: x\n\n"), collect))
+}
@@ -0,0 +1,220 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockExtension The extension of the lock files (created next to the session files).
+const lockExtension = ".lock"
+
+// StaleLockAge The age after which a lock is considered stale, if the process that holds it cannot be checked (it runs
+// on another host). The locks are refreshed while they are held (see `lockRefreshInterval`).
+const StaleLockAge = 24 * time.Hour
+
+// lockRefreshInterval The interval at which a lock is refreshed while it is held: a lock held for a long time (by a
+// daemon, or by a command that waits between the emails) never gets stale.
+var lockRefreshInterval = time.Hour
+
+// ErrLocked Returned when a session is locked by another process.
+var ErrLocked = errors.New("the session is used by another process")
+
+// lockOwner The content of a lock file: the process that holds the lock.
+type lockOwner struct {
+	Pid     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Created time.Time `json:"created"`
+	// Refreshed The last time the lock was refreshed by the process that holds it (see `lockRefreshInterval`).
+	Refreshed time.Time `json:"refreshed,omitempty"`
+}
+
+// SessionLock A lock that prevents two processes from using the same session at the same time. The lock is a file
+// (`<session>.lock`) created within the directory of the sessions. It is refreshed until it is released.
+type SessionLock struct {
+	Path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// LockSession Locks a session. If the session is already locked by another process, then an error that wraps
+// `ErrLocked` is returned.
+// A lock is stale if the process that created it is not running anymore (on the same host), or, if the process cannot be
+// checked (it runs on another host), if it has not been refreshed for `StaleLockAge`. Stale locks are removed (see
+// `removeStaleLock`).
+func LockSession(dir string, name string) (*SessionLock, error) {
+	var err error
+	var owner *lockOwner
+	var path = filepath.Join(dir, name+lockExtension)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = createLock(path); err == nil {
+			var lock = &SessionLock{Path: path, stop: make(chan struct{}), done: make(chan struct{})}
+			go lock.keepAlive()
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf(`cannot create the lock file "%s": %s`, path, err.Error())
+		}
+		if owner, err = readLock(path); err != nil {
+			// The lock file may be incomplete (the process that creates it may not have written it yet).
+			return nil, fmt.Errorf(`%w (lock file "%s")`, ErrLocked, path)
+		}
+		if !owner.isStale() {
+			return nil, fmt.Errorf(`%w (process %d on "%s", since %s; lock file "%s")`, ErrLocked, owner.Pid, owner.Host, owner.Created.Format(time.RFC3339), path)
+		}
+		if err = removeStaleLock(path, owner); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf(`%w (lock file "%s")`, ErrLocked, path)
+}
+
+// removeStaleLock Removes a stale lock, given its owner. Several processes may find the same lock stale: the lock is
+// renamed (atomically) to a name unique to this process before it is removed, so that only one process gets it. If the
+// lock renamed is not the stale one anymore (another process replaced it with a new lock in the meantime), then it is
+// put back, and an error that wraps `ErrLocked` is returned.
+func removeStaleLock(path string, stale *lockOwner) error {
+	var err error
+	var owner *lockOwner
+	var moved = fmt.Sprintf("%s.%d.%d", path, os.Getpid(), time.Now().UnixNano())
+
+	if err = os.Rename(path, moved); err != nil {
+		if os.IsNotExist(err) {
+			// Another process removed it.
+			return nil
+		}
+		return fmt.Errorf(`cannot remove the stale lock file "%s": %s`, path, err.Error())
+	}
+	if owner, err = readLock(moved); err != nil || !owner.same(stale) {
+		// The lock is put back, unless another lock has been created since.
+		_ = os.Link(moved, path)
+		_ = os.Remove(moved)
+		return fmt.Errorf(`%w (lock file "%s")`, ErrLocked, path)
+	}
+	if err = os.Remove(moved); err != nil {
+		return fmt.Errorf(`cannot remove the stale lock file "%s": %s`, moved, err.Error())
+	}
+	return nil
+}
+
+// Held Checks that the lock is still held by this process: a session must not be saved if its lock has been lost.
+func (l *SessionLock) Held() error {
+	var err error
+	var owner *lockOwner
+	var host, _ = os.Hostname()
+
+	if owner, err = readLock(l.Path); err != nil {
+		return fmt.Errorf(`the lock file "%s" cannot be read: %s`, l.Path, err.Error())
+	}
+	if owner.Pid != os.Getpid() || owner.Host != host {
+		return fmt.Errorf(`the lock file "%s" is held by another process (%d on "%s")`, l.Path, owner.Pid, owner.Host)
+	}
+	return nil
+}
+
+// Unlock Releases the lock.
+func (l *SessionLock) Unlock() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop = nil
+	}
+	return os.Remove(l.Path)
+}
+
+// keepAlive Refreshes the lock every `lockRefreshInterval`, until it is released.
+func (l *SessionLock) keepAlive() {
+	var ticker = time.NewTicker(lockRefreshInterval)
+
+	defer close(l.done)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			_ = l.refresh()
+		}
+	}
+}
+
+// refresh Records that the lock is still held. Nothing is done if the lock is not held by this process anymore.
+func (l *SessionLock) refresh() error {
+	var err error
+	var owner *lockOwner
+	var content []byte
+
+	if err = l.Held(); err != nil {
+		return err
+	}
+	if owner, err = readLock(l.Path); err != nil {
+		return err
+	}
+	owner.Refreshed = time.Now().UTC().Truncate(time.Second)
+	if content, err = json.Marshal(owner); err != nil {
+		return err
+	}
+	return writeAtomically(l.Path, content)
+}
+
+// createLock Creates a lock file. It fails if the file already exists.
+func createLock(path string) error {
+	var err error
+	var file *os.File
+	var content []byte
+	var owner = lockOwner{Pid: os.Getpid(), Created: time.Now().UTC().Truncate(time.Second)}
+
+	owner.Host, _ = os.Hostname()
+	if content, err = json.Marshal(owner); err != nil {
+		return err
+	}
+	if file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); err != nil {
+		return err
+	}
+	if _, err = file.Write(content); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
+
+// readLock Reads the owner of a lock.
+func readLock(path string) (*lockOwner, error) {
+	var err error
+	var content []byte
+	var owner lockOwner
+
+	if content, err = os.ReadFile(path); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &owner); err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
+
+// same Tells whether two owners describe the same lock.
+func (o *lockOwner) same(other *lockOwner) bool {
+	return o.Pid == other.Pid && o.Host == other.Host && o.Created.Equal(other.Created) && o.Refreshed.Equal(other.Refreshed)
+}
+
+// isStale Tells whether the process that holds the lock has stopped without releasing it. The age of the lock only
+// matters if the process cannot be checked.
+func (o *lockOwner) isStale() bool {
+	var host string
+	var updated = o.Created
+
+	host, _ = os.Hostname()
+	if o.Host == host {
+		return o.Pid != os.Getpid() && !processIsRunning(o.Pid)
+	}
+	if o.Refreshed.After(updated) {
+		updated = o.Refreshed
+	}
+	return time.Since(updated) > StaleLockAge
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockSession(t *testing.T) {
+	var err error
+	var lock *SessionLock
+	var other *SessionLock
+	var dir = t.TempDir()
+
+	lock, err = LockSession(dir, "first")
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "first.lock"))
+	assert.Nil(t, err)
+
+	// The session is locked (by this process, which is running).
+	_, err = LockSession(dir, "first")
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	// Another session can be locked.
+	other, err = LockSession(dir, "second")
+	assert.Nil(t, err)
+	assert.Nil(t, other.Unlock())
+
+	// Once unlocked, the session can be locked again.
+	assert.Nil(t, lock.Unlock())
+	lock, err = LockSession(dir, "first")
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Unlock())
+}
+
+func TestLockSessionStale(t *testing.T) {
+	var err error
+	var lock *SessionLock
+	var content []byte
+	var host, _ = os.Hostname()
+	var dir = t.TempDir()
+	var path = filepath.Join(dir, "first.lock")
+
+	// The lock created on another host has not been refreshed for too long.
+	content, _ = json.Marshal(lockOwner{Pid: os.Getpid(), Host: "elsewhere", Created: time.Now().Add(-StaleLockAge - time.Hour)})
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	lock, err = LockSession(dir, "first")
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Unlock())
+
+	// The lock created on another host has been refreshed recently.
+	content, _ = json.Marshal(lockOwner{Pid: os.Getpid(), Host: "elsewhere", Created: time.Now().Add(-StaleLockAge - time.Hour), Refreshed: time.Now()})
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	_, err = LockSession(dir, "first")
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	// The lock is old, but the process that created it is still running.
+	content, _ = json.Marshal(lockOwner{Pid: os.Getpid(), Host: host, Created: time.Now().Add(-StaleLockAge - time.Hour)})
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	_, err = LockSession(dir, "first")
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	// The lock has been created on another host: it cannot be removed.
+	content, _ = json.Marshal(lockOwner{Pid: os.Getpid(), Host: "elsewhere", Created: time.Now()})
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	_, err = LockSession(dir, "first")
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	// The process that created the lock is not running anymore.
+	content, _ = json.Marshal(lockOwner{Pid: 1 << 30, Host: host, Created: time.Now()})
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	lock, err = LockSession(dir, "first")
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Unlock())
+}
+
+func TestLockSessionRefresh(t *testing.T) {
+	var err error
+	var lock *SessionLock
+	var owner *lockOwner
+	var dir = t.TempDir()
+	var interval = lockRefreshInterval
+
+	lockRefreshInterval = 10 * time.Millisecond
+	defer func() { lockRefreshInterval = interval }()
+
+	// The lock is refreshed while it is held.
+	lock, err = LockSession(dir, "first")
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		owner, err = readLock(lock.Path)
+		return err == nil && !owner.Refreshed.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, os.Getpid(), owner.Pid)
+	assert.Nil(t, lock.Unlock())
+	_, err = os.Stat(lock.Path)
+	assert.True(t, os.IsNotExist(err))
+
+	// A lock held by another process is not refreshed.
+	lock = &SessionLock{Path: filepath.Join(dir, "second.lock")}
+	assert.Nil(t, os.WriteFile(lock.Path, []byte(`{"pid":1,"host":"elsewhere"}`), 0644))
+	assert.NotNil(t, lock.refresh())
+	owner, err = readLock(lock.Path)
+	assert.Nil(t, err)
+	assert.True(t, owner.Refreshed.IsZero())
+}
+
+func TestRemoveStaleLock(t *testing.T) {
+	var err error
+	var content []byte
+	var owner *lockOwner
+	var entries []os.DirEntry
+	var host, _ = os.Hostname()
+	var dir = t.TempDir()
+	var path = filepath.Join(dir, "first.lock")
+	var stale = lockOwner{Pid: 1 << 30, Host: host, Created: time.Now().UTC().Truncate(time.Second)}
+	var fresh = lockOwner{Pid: os.Getpid(), Host: host, Created: time.Now().UTC().Truncate(time.Second).Add(time.Second)}
+
+	// The stale lock is removed.
+	content, _ = json.Marshal(stale)
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	assert.Nil(t, removeStaleLock(path, &stale))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// Another process removed the stale lock first.
+	assert.Nil(t, removeStaleLock(path, &stale))
+
+	// Another process removed the stale lock, and created a new one: the new lock is kept.
+	content, _ = json.Marshal(fresh)
+	assert.Nil(t, os.WriteFile(path, content, 0644))
+	err = removeStaleLock(path, &stale)
+	assert.True(t, errors.Is(err, ErrLocked))
+	owner, err = readLock(path)
+	assert.Nil(t, err)
+	assert.True(t, owner.same(&fresh))
+
+	// No renamed lock is left behind.
+	entries, err = os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSessionLockHeld(t *testing.T) {
+	var err error
+	var lock *SessionLock
+	var dir = t.TempDir()
+
+	lock, err = LockSession(dir, "first")
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Held())
+
+	// The lock has been replaced by another process.
+	assert.Nil(t, os.WriteFile(lock.Path, []byte(`{"pid":1,"host":"elsewhere"}`), 0644))
+	assert.NotNil(t, lock.Held())
+	assert.Nil(t, lock.Unlock())
+	assert.NotNil(t, lock.Held())
+}
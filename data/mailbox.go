@@ -0,0 +1,146 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MailboxEnv The environment variable that gives the mailbox the emails are received in (see "rcv"), if not "INBOX".
+const MailboxEnv = "UMAIL_MAILBOX"
+
+// DefaultMailbox Returns the mailbox the emails are received in, unless given: the value of the environment variable
+// `MailboxEnv`, or "INBOX".
+func DefaultMailbox() string {
+	if mailbox := os.Getenv(MailboxEnv); len(mailbox) > 0 {
+		return mailbox
+	}
+	return "INBOX"
+}
+
+// GraphFolder Returns the mail folder (Microsoft Graph API) the emails are received in, given the mailbox: "INBOX" is
+// the well-known name "inbox". The other folders are given by their well-known names ("archive"...) or by their IDs.
+func GraphFolder(mailbox string) string {
+	if strings.EqualFold(mailbox, "INBOX") {
+		return "inbox"
+	}
+	return mailbox
+}
+
+// MarkedAsRead Returns the UIDs of the emails fetched that are marked as read (see "rcv --mark-read"), given their
+// boundaries (nil if an email has none). The emails are left unread, unless `markRead` is set: then, only the emails
+// that have a boundary are marked.
+func MarkedAsRead(markRead bool, uids []uint32, boundaries [][]string) []uint32 {
+	var result []uint32
+
+	if !markRead {
+		return nil
+	}
+	for i, uid := range uids {
+		if i < len(boundaries) && boundaries[i] != nil {
+			result = append(result, uid)
+		}
+	}
+	return result
+}
+
+// ListedMailbox A mailbox listed by a server (IMAP "LIST").
+type ListedMailbox struct {
+	Name       string
+	Selectable bool
+}
+
+// MailboxError Returns the error reported when a mailbox cannot be selected (`cause`), given the mailboxes listed by
+// the server. The names of the mailboxes depend on the server ("[Gmail]/All Mail", "INBOX.Archive"...): if the mailbox
+// does not exist, then the error gives the mailboxes that can be selected.
+func MailboxError(mailbox string, listed []ListedMailbox, cause error) error {
+	var names []string
+
+	if len(listed) == 0 {
+		return fmt.Errorf("cannot select mailbox \"%s\": %s", mailbox, cause.Error())
+	}
+	for _, item := range listed {
+		if item.Name == mailbox {
+			return fmt.Errorf("cannot select mailbox \"%s\": %s", mailbox, cause.Error())
+		}
+		if item.Selectable {
+			names = append(names, fmt.Sprintf(`"%s"`, item.Name))
+		}
+	}
+	return fmt.Errorf("the mailbox \"%s\" does not exist (mailboxes: %s)", mailbox, strings.Join(names, ", "))
+}
+
+// MailboxState The state of a mailbox (IMAP, POP3 or JMAP), recorded once its emails have been processed: the next
+// reception only fetches the emails that arrived since (see "rcv").
+type MailboxState struct {
+	// UidValidity The UIDVALIDITY of the mailbox: if it changes, then the UIDs have been reassigned.
+	UidValidity uint32 `json:"uid_validity"`
+	// LastUid The highest UID processed.
+	LastUid uint32 `json:"last_uid"`
+	// Uidls The unique IDs of the emails processed, if the mailbox is retrieved using POP3 (UIDL) or JMAP (the IDs of
+	// the emails): these IDs do not increase.
+	Uidls []string `json:"uidls,omitempty"`
+}
+
+// FirstUid Returns the UID of the first email to fetch, given the current UIDVALIDITY of the mailbox: 1 (all the
+// emails) if the state is unknown, or if the UIDs have been reassigned since it was recorded.
+func (s MailboxState) FirstUid(uidValidity uint32) uint32 {
+	if s.UidValidity == 0 || s.UidValidity != uidValidity {
+		return 1
+	}
+	return s.LastUid + 1
+}
+
+// MailboxCache A file that records the states of the mailboxes (see `MailboxName`).
+type MailboxCache struct {
+	path   string
+	states map[string]MailboxState
+}
+
+// MailboxName Returns the name under which the state of the mailbox of an account is recorded:
+// "user@server:port/mailbox" (see `ParseSentFolder`), followed by the filter the emails are selected with, if any. The
+// emails that do not match a filter have not been processed: a reception with another filter has its own state.
+func MailboxName(user string, server string, port int, mailbox string, filter EmailFilter) string {
+	var name = fmt.Sprintf("%s@%s:%d/%s", user, server, port, mailbox)
+
+	if query := filter.String(); len(query) > 0 {
+		return name + "?" + query
+	}
+	return name
+}
+
+// LoadMailboxCache Loads the states of the mailboxes from a file. If the file does not exist, then the cache is empty.
+func LoadMailboxCache(path string) (*MailboxCache, error) {
+	var err error
+	var content []byte
+	var cache = MailboxCache{path: path, states: map[string]MailboxState{}}
+
+	if content, err = os.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			return &cache, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &cache.states); err != nil {
+		return nil, fmt.Errorf(`invalid mailbox cache "%s": %s`, path, err.Error())
+	}
+	return &cache, nil
+}
+
+// Get Returns the state of a mailbox (see `MailboxName`), or an empty state if it is unknown.
+func (c *MailboxCache) Get(name string) MailboxState {
+	return c.states[name]
+}
+
+// Put Records the state of a mailbox, and writes the cache.
+func (c *MailboxCache) Put(name string, state MailboxState) error {
+	var err error
+	var content []byte
+
+	c.states[name] = state
+	if content, err = json.MarshalIndent(c.states, "", "  "); err != nil {
+		return err
+	}
+	return writeAtomically(c.path, content)
+}
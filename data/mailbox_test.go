@@ -0,0 +1,91 @@
+package data
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestMailboxCache(t *testing.T) {
+	var err error
+	var cache *MailboxCache
+	var path = filepath.Join(t.TempDir(), "mailboxes.json")
+	var name = MailboxName("john@example.com", "imap.example.com", 993, "INBOX", EmailFilter{})
+
+	assert.Equal(t, "john@example.com@imap.example.com:993/INBOX", name)
+	assert.Equal(t, "john@example.com@imap.example.com:993/INBOX?from=bill%40example.com",
+		MailboxName("john@example.com", "imap.example.com", 993, "INBOX", EmailFilter{From: "bill@example.com"}))
+
+	// The file does not exist yet.
+	cache, err = LoadMailboxCache(path)
+	assert.Nil(t, err)
+	assert.Equal(t, MailboxState{}, cache.Get(name))
+	assert.Equal(t, uint32(1), cache.Get(name).FirstUid(42))
+
+	assert.Nil(t, cache.Put(name, MailboxState{UidValidity: 42, LastUid: 17}))
+	cache, err = LoadMailboxCache(path)
+	assert.Nil(t, err)
+	assert.Equal(t, MailboxState{UidValidity: 42, LastUid: 17}, cache.Get(name))
+	assert.Equal(t, uint32(18), cache.Get(name).FirstUid(42))
+	// The UIDs have been reassigned.
+	assert.Equal(t, uint32(1), cache.Get(name).FirstUid(43))
+
+	assert.Nil(t, cache.Put("john@pop.example.com:995/INBOX", MailboxState{Uidls: []string{"uid-a", "uid-b"}}))
+	cache, err = LoadMailboxCache(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"uid-a", "uid-b"}, cache.Get("john@pop.example.com:995/INBOX").Uidls)
+}
+
+func TestDefaultMailbox(t *testing.T) {
+	t.Setenv(MailboxEnv, "")
+	assert.Equal(t, "INBOX", DefaultMailbox())
+	t.Setenv(MailboxEnv, "[Gmail]/All Mail")
+	assert.Equal(t, "[Gmail]/All Mail", DefaultMailbox())
+}
+
+func TestGraphFolder(t *testing.T) {
+	for mailbox, expected := range map[string]string{
+		"INBOX":   "inbox",
+		"Inbox":   "inbox",
+		"archive": "archive",
+		"AAMkAGI": "AAMkAGI",
+	} {
+		assert.Equal(t, expected, GraphFolder(mailbox))
+	}
+}
+
+func TestMailboxError(t *testing.T) {
+	var cause = errors.New("NO [NONEXISTENT] Unknown Mailbox")
+	var listed = []ListedMailbox{
+		{Name: "INBOX", Selectable: true},
+		{Name: "[Gmail]", Selectable: false},
+		{Name: "[Gmail]/All Mail", Selectable: true},
+	}
+
+	for _, test := range []struct {
+		mailbox  string
+		listed   []ListedMailbox
+		expected string
+	}{
+		// The mailboxes that can be selected are given.
+		{mailbox: "All Mail", listed: listed, expected: `the mailbox "All Mail" does not exist (mailboxes: "INBOX", "[Gmail]/All Mail")`},
+		// The mailbox exists: the error of the server is given.
+		{mailbox: "[Gmail]", listed: listed, expected: `cannot select mailbox "[Gmail]": NO [NONEXISTENT] Unknown Mailbox`},
+		{mailbox: "All Mail", listed: nil, expected: `cannot select mailbox "All Mail": NO [NONEXISTENT] Unknown Mailbox`},
+	} {
+		assert.EqualError(t, MailboxError(test.mailbox, test.listed, cause), test.expected)
+	}
+}
+
+func TestMarkedAsRead(t *testing.T) {
+	var uids = []uint32{10, 11, 12}
+	var boundaries = [][]string{{"0a0b"}, nil, {"0c0d", "0e0f"}}
+
+	// By default, the emails are left unread.
+	assert.Nil(t, MarkedAsRead(false, uids, boundaries))
+	// Only the emails that have a boundary are marked.
+	assert.Equal(t, []uint32{10, 12}, MarkedAsRead(true, uids, boundaries))
+	assert.Nil(t, MarkedAsRead(true, uids, [][]string{nil, nil, nil}))
+	assert.Nil(t, MarkedAsRead(true, nil, nil))
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"umail/resource"
+)
+
+// MarkerLength The length, in bytes, of a marker.
+const MarkerLength = 4
+
+// markerKeyMaterialLength The number of key bytes (starting at the position of the message) used to derive a marker.
+const markerKeyMaterialLength = 32
+
+// NewMarker Derives the marker of a hidden message from the key material it uses (the key material that starts at
+// `position`), as a hexadecimal text. The marker is written into the message IDs of the emails (see
+// `MailClient.NewMarkedMessageID`), where it looks like random digits: the receiver, who holds the same key material,
+// asks the server for the emails whose message ID contains it, instead of examining all the multipart emails.
+//
+// Each message has its own marker: the emails of two messages cannot be linked by their markers. The marker does not
+// reveal the key material.
+func NewMarker(key resource.KeySource, position int64) (string, error) {
+	var err error
+	var digest []byte
+
+	if digest, err = deriveFromKey(key, position, "umail-marker"); err != nil {
+		return "", fmt.Errorf(`cannot derive the marker from the key material at position %d: %s`, position, err.Error())
+	}
+	return hex.EncodeToString(digest[:MarkerLength]), nil
+}
+
+// deriveFromKey Derives a value (SHA-256) from the key material that starts at `position`, for a given use (`label`):
+// the values derived for different uses are not related.
+func deriveFromKey(key resource.KeySource, position int64, label string) ([]byte, error) {
+	var err error
+	var material []byte
+	var hash = sha256.New()
+	var positionBytes = make([]byte, 8)
+
+	if material, err = key.ReadAt(position, markerKeyMaterialLength); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(positionBytes, uint64(position))
+	hash.Write([]byte(label))
+	hash.Write(positionBytes)
+	hash.Write(material)
+	return hash.Sum(nil), nil
+}
+
+// ParseMarker Checks a marker (see `NewMarker`), and returns its bytes.
+func ParseMarker(marker string) ([]byte, error) {
+	var err error
+	var value []byte
+
+	if value, err = hex.DecodeString(marker); err != nil || len(value) != MarkerLength {
+		return nil, fmt.Errorf(`invalid marker "%s" (expected %d hexadecimal digits)`, marker, 2*MarkerLength)
+	}
+	return value, nil
+}
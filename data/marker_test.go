@@ -0,0 +1,44 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"umail/resource"
+)
+
+func TestMarker(t *testing.T) {
+	var err error
+	var pad []byte
+	var key *resource.MemoryPool
+	var marker, other string
+	var value []byte
+
+	for i := 0; i < 256; i++ {
+		pad = append(pad, byte(i))
+	}
+	key, err = resource.NewMemoryPool(pad, 0)
+	assert.Nil(t, err)
+
+	marker, err = NewMarker(key, 40)
+	assert.Nil(t, err)
+	assert.Len(t, marker, 2*MarkerLength)
+	value, err = ParseMarker(marker)
+	assert.Nil(t, err)
+	assert.Len(t, value, MarkerLength)
+
+	// The marker only depends on the key material (and its position).
+	other, err = NewMarker(key, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, marker, other)
+	other, err = NewMarker(key, 41)
+	assert.Nil(t, err)
+	assert.NotEqual(t, marker, other)
+
+	// We'll get errors...
+	_, err = NewMarker(key, 250)
+	assert.NotNil(t, err)
+	for _, text := range []string{"", "1a2b3c", "1a2b3c4d5e", "1a2b3c4g"} {
+		_, err = ParseMarker(text)
+		assert.NotNil(t, err, text)
+	}
+}
@@ -2,37 +2,142 @@ package data
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"os"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Message [][]byte
 
+// Load Loads the message to hide from a file, and organizes it into chunks of `chunkSize` bytes.
 func (m *Message) Load(filePath string, chunkSize int) error {
 	var err error
 	var raw []byte
-	var rawLength int
-	var message []byte
-	var messageLength int
-	var remainder int
-	var buffer = new(bytes.Buffer)
 
 	if raw, err = os.ReadFile(filePath); err != nil {
 		return err
 	}
-	rawLength = len(raw)
+	return m.FromBytes(raw, chunkSize)
+}
 
-	// Check the length of the message.
-	if rawLength > math.MaxUint16 {
-		return fmt.Errorf(`the given message is too long (%d bytes). The maximum length is %d`, rawLength, math.MaxUint16)
+// MessageFormat The format of the envelope of the hidden message (the header that precedes the message).
+type MessageFormat byte
+
+const (
+	// MessageFormatV1 The message starts with its length (`uint16`, little endian). The message cannot be longer than
+	// 64 KB.
+	MessageFormatV1 MessageFormat = 1
+	// MessageFormatV2 The message starts with a null length (`uint16`, which is an empty message for the receivers
+	// that only know the format 1), the format (one byte) and its length (`uint32`, little endian).
+	MessageFormatV2 MessageFormat = 2
+	// MessageFormatV3 Same as the format 2, but the message is followed by a MAC (HMAC-SHA256), keyed by one-time key
+	// material: the `MacKeyLength` bytes of the key that follow the key material used by the boundaries.
+	MessageFormatV3 MessageFormat = 3
+)
+
+// ErrNotAuthentic Returned when the MAC of a message (format 3) does not match: the boundaries have been tampered with
+// (or corrupted), or the key is wrong.
+var ErrNotAuthentic = errors.New("the message is not authentic (tampered or corrupted boundaries, or wrong key)")
+
+// ErrMissingMac Returned when a message has no MAC, although the MAC is required (see `CheckAuthenticated`). It wraps
+// `ErrNotAuthentic`.
+var ErrMissingMac = fmt.Errorf("the message has no MAC, although it is required (downgraded or forged message, or wrong key): %w", ErrNotAuthentic)
+
+// MacKeyLength The size, in bytes, of the key material used to authenticate a message (format 3).
+const MacKeyLength = 32
+
+// macLength The size, in bytes, of the MAC that follows a message (format 3).
+const macLength = sha256.Size
+
+// messageV2HeaderLength The size, in bytes, of the header of a message using the format 2.
+const messageV2HeaderLength = messageLengthTypeLength + 1 + 4
+
+// MaxMessageLength The maximum length of a message (format 2).
+const MaxMessageLength = math.MaxUint32 - messageV2HeaderLength
+
+// Encoding How a message is organized into chunks.
+type Encoding struct {
+	// Authenticated The message is followed by its MAC (format 3).
+	Authenticated bool
+	// Sequenced Each chunk starts with a sequence header, so that the boundaries can be decoded in any order (see
+	// `sequenceHeaderLength`).
+	Sequenced bool
+}
+
+// FromBytes Organizes a given message to hide into chunks of `chunkSize` bytes.
+// The first chunk starts with the envelope of the message (see `MessageFormat`): the format 1 is used if the message
+// is not longer than 64 KB (so that it can be decoded by all the receivers), and the format 2 otherwise. The last chunk
+// is padded with zeros.
+func (m *Message) FromBytes(raw []byte, chunkSize int) error {
+	return m.Build(raw, chunkSize, Encoding{}, nil)
+}
+
+// Build Organizes a given message to hide into chunks of `chunkSize` bytes, using a given encoding. For an
+// authenticated message, the format 3 is used: the message is followed by its MAC, keyed by `macKey` (`MacKeyLength`
+// bytes of one-time key material).
+func (m *Message) Build(raw []byte, chunkSize int, encoding Encoding, macKey []byte) error {
+	var err error
+	var message []byte
+	var chunks [][]byte
+
+	if message, err = envelope(raw, encoding.Authenticated); err != nil {
+		return err
+	}
+	if encoding.Authenticated {
+		if len(macKey) != MacKeyLength {
+			return fmt.Errorf(`invalid MAC key length (%d bytes instead of %d)`, len(macKey), MacKeyLength)
+		}
+		message = append(message, messageMac(message, macKey)...)
+	}
+	if !encoding.Sequenced {
+		m.split(message, chunkSize)
+		return nil
 	}
-	if err = binary.Write(buffer, binary.LittleEndian, uint16(rawLength)); err != nil {
+	if chunks, err = sequenceChunks(message, chunkSize); err != nil {
 		return err
 	}
-	message = append(buffer.Bytes(), raw...)
-	messageLength = len(message)
+	*m = append(*m, chunks...)
+	return nil
+}
+
+// MaterialLength Returns the number of bytes of key material used by the boundaries of a message of a given length,
+// using the encoding. The key material used by the MAC (if any) follows.
+func (e Encoding) MaterialLength(rawLength int, chunkSize int) int64 {
+	var length = int64(envelopeLength(rawLength, e.Authenticated))
+	var payloadLength = int64(chunkSize)
+	var chunks int64
+
+	if e.Authenticated {
+		length += macLength
+	}
+	if e.Sequenced {
+		payloadLength -= sequenceHeaderLength
+	}
+	chunks = (length + payloadLength - 1) / payloadLength
+	return chunks * int64(chunkSize)
+}
+
+// KeyLength Returns the number of bytes of key material used by a message of a given length, using the encoding (the
+// key material used by the MAC included).
+func (e Encoding) KeyLength(rawLength int, chunkSize int) int64 {
+	if e.Authenticated {
+		return e.MaterialLength(rawLength, chunkSize) + MacKeyLength
+	}
+	return e.MaterialLength(rawLength, chunkSize)
+}
+
+// split Organizes a message (prefixed by its header) into chunks of `chunkSize` bytes. The last chunk is padded with
+// zeros.
+func (m *Message) split(message []byte, chunkSize int) {
+	var messageLength = len(message)
+	var remainder int
+
 	for i := 0; i < messageLength/chunkSize; i++ {
 		*m = append(*m, message[i*chunkSize:(i+1)*chunkSize])
 	}
@@ -41,9 +146,127 @@ func (m *Message) Load(filePath string, chunkSize int) error {
 		var padding = make([]byte, chunkSize-remainder)
 		*m = append(*m, append(message[chunkSize*len(*m):], padding...))
 	}
-	return nil
+}
+
+// messageMac Returns the MAC of a message (header included).
+func messageMac(message []byte, macKey []byte) []byte {
+	var mac = hmac.New(sha256.New, macKey)
+
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// envelope Returns the message prefixed by its header. The format 3 is used for an authenticated message (the MAC is
+// not added).
+func envelope(raw []byte, authenticated bool) ([]byte, error) {
+	var err error
+	var buffer = new(bytes.Buffer)
+	var rawLength = len(raw)
+	var format = MessageFormatV2
+
+	// Check the length of the message.
+	if int64(rawLength) > MaxMessageLength {
+		return nil, fmt.Errorf(`the given message is too long (%d bytes). The maximum length is %d`, rawLength, int64(MaxMessageLength))
+	}
+	if envelopeLength(rawLength, authenticated) == messageLengthTypeLength+rawLength {
+		if err = binary.Write(buffer, binary.LittleEndian, uint16(rawLength)); err != nil {
+			return nil, err
+		}
+		return append(buffer.Bytes(), raw...), nil
+	}
+	if authenticated {
+		format = MessageFormatV3
+	}
+	if err = binary.Write(buffer, binary.LittleEndian, uint16(0)); err != nil {
+		return nil, err
+	}
+	buffer.WriteByte(byte(format))
+	if err = binary.Write(buffer, binary.LittleEndian, uint32(rawLength)); err != nil {
+		return nil, err
+	}
+	return append(buffer.Bytes(), raw...), nil
+}
+
+// envelopeLength Returns the length of a message of a given length, prefixed by its header (the MAC excluded).
+func envelopeLength(rawLength int, authenticated bool) int {
+	if !authenticated && rawLength > 0 && rawLength <= math.MaxUint16 {
+		return messageLengthTypeLength + rawLength
+	}
+	return messageV2HeaderLength + rawLength
+}
+
+// openEnvelope Extracts the message from decoded data (the message prefixed by its header, followed by the padding).
+// For the format 3, the MAC is checked using `macKey` (if the key is not available, then the key material that follows
+// the boundaries is missing: `ErrNotAuthentic` is returned).
+func openEnvelope(clearMessage []byte, macKey []byte) ([]byte, MessageFormat, error) {
+	var err error
+	var format MessageFormat
+	var headerLength int
+	var end int64
+	var contentEnd int64
+
+	if format, headerLength, end, err = envelopeExtent(clearMessage); err != nil {
+		return nil, 0, err
+	}
+	contentEnd = end
+	if format == MessageFormatV3 {
+		contentEnd -= macLength
+	}
+	if end > int64(len(clearMessage)) {
+		return nil, 0, fmt.Errorf(`invalid message length (%d): only %d bytes available`, contentEnd-int64(headerLength), len(clearMessage)-headerLength)
+	}
+	if format == MessageFormatV3 {
+		if len(macKey) != MacKeyLength || !hmac.Equal(messageMac(clearMessage[:contentEnd], macKey), clearMessage[contentEnd:end]) {
+			return nil, format, ErrNotAuthentic
+		}
+	}
+	return clearMessage[headerLength:contentEnd], format, nil
+}
+
+// envelopeExtent Returns the format of an envelope (see `openEnvelope`), the length of its header, and the length of
+// the envelope declared by its header (the header and the MAC included, the padding excluded). The envelope may be
+// truncated: only its header is needed.
+func envelopeExtent(clearMessage []byte) (MessageFormat, int, int64, error) {
+	var err error
+	var shortLength uint16
+	var length uint32
+	var format MessageFormat
+	var end int64
+
+	// Please, keep in mind that the message starts with an `uint16` which represents the length of the message.
+	if err = binary.Read(bytes.NewReader(clearMessage), binary.LittleEndian, &shortLength); err != nil {
+		return 0, 0, 0, err
+	}
+	if len(clearMessage) >= messageV2HeaderLength {
+		format = MessageFormat(clearMessage[messageLengthTypeLength])
+	}
+	if shortLength > 0 || (format != MessageFormatV2 && format != MessageFormatV3) {
+		return MessageFormatV1, messageLengthTypeLength, int64(messageLengthTypeLength) + int64(shortLength), nil
+	}
+	if err = binary.Read(bytes.NewReader(clearMessage[messageLengthTypeLength+1:]), binary.LittleEndian, &length); err != nil {
+		return 0, 0, 0, err
+	}
+	end = int64(messageV2HeaderLength) + int64(length)
+	if format == MessageFormatV3 {
+		end += macLength
+	}
+	return format, messageV2HeaderLength, end, nil
 }
 
 func (m *Message) BoundariesCount() int {
 	return len(*m)
 }
+
+// IsPrintableText Tells whether a content is a text (UTF-8) that can be printed: it contains no control characters,
+// except for the tabulations and the line breaks.
+func IsPrintableText(content []byte) bool {
+	if !utf8.Valid(content) {
+		return false
+	}
+	for _, c := range string(content) {
+		if unicode.IsControl(c) && c != '\t' && c != '\n' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
@@ -56,3 +56,69 @@ func TestMessageLoad(t *testing.T) {
 	}
 	assert.Equal(t, chunk, m[2])
 }
+
+func TestMessageFormats(t *testing.T) {
+	var m Message
+	var err error
+	var clear []byte
+	var decoded []byte
+	var format MessageFormat
+	var large = bytes.Repeat([]byte("0123456789"), 7000)
+
+	// A message longer than 64 KB uses the format 2.
+	err = m.FromBytes(large, chunkSize)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 0, byte(MessageFormatV2), 0x70, 0x11, 0x01, 0x00}, m[0][:7])
+	for _, chunk := range m {
+		clear = append(clear, chunk...)
+	}
+	decoded, format, err = openEnvelope(clear, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, MessageFormatV2, format)
+	assert.Equal(t, large, decoded)
+
+	// A message that is not longer than 64 KB uses the format 1.
+	m = nil
+	clear = nil
+	err = m.FromBytes([]byte("secret"), chunkSize)
+	assert.Nil(t, err)
+	for _, chunk := range m {
+		clear = append(clear, chunk...)
+	}
+	decoded, format, err = openEnvelope(clear, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, MessageFormatV1, format)
+	assert.Equal(t, []byte("secret"), decoded)
+
+	// Legacy (format 1) empty message.
+	decoded, format, err = openEnvelope(make([]byte, chunkSize), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, MessageFormatV1, format)
+	assert.Empty(t, decoded)
+
+	// Truncated messages.
+	_, _, err = openEnvelope(clear[:5], nil)
+	assert.NotNil(t, err)
+	_, _, err = openEnvelope([]byte{0, 0, byte(MessageFormatV2), 0xFF, 0, 0, 0, 'a'}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestIsPrintableText(t *testing.T) {
+	for _, test := range []struct {
+		content   []byte
+		printable bool
+	}{
+		{content: []byte(""), printable: true},
+		{content: []byte("Hello, world!"), printable: true},
+		{content: []byte("Line 1\r\nLine 2\n\tindented"), printable: true},
+		{content: []byte("Café, 東京 ✓"), printable: true},
+		{content: []byte("Hello\x1b[2J"), printable: false},
+		{content: []byte("Hello\x00world"), printable: false},
+		{content: []byte("Bell\a"), printable: false},
+		{content: []byte("Hello\u0085"), printable: false},
+		{content: []byte{0xff, 0xfe, 'H', 'i'}, printable: false},
+		{content: []byte{'C', 'a', 'f', 0xc3}, printable: false},
+	} {
+		assert.Equal(t, test.printable, IsPrintableText(test.content), "%q", test.content)
+	}
+}
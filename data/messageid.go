@@ -0,0 +1,72 @@
+package data
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// messageIDCarrierLength The number of bytes hidden by a message ID, by default: the message IDs of all the mail
+// clients can hide them.
+const messageIDCarrierLength = 6
+
+// messageIDCarrierMaxLength The maximum number of bytes hidden by a message ID (see `MailClient.MessageIDCapacity`).
+const messageIDCarrierMaxLength = 10
+
+// messageIDPayloadPositions The positions, among the random bytes of a message ID, of the bytes hidden by the message
+// ID. The first bytes hold the marker (see `NewMarker`). The bytes altered by the format of the UUIDs (the version and
+// the variant) are skipped.
+var messageIDPayloadPositions = []int{4, 5, 7, 9, 10, 11, 12, 13, 14, 15}
+
+var outlookMessageIDRegex = regexp.MustCompile(`^0000([0-9a-f]{8})\$([0-9a-f]{8})\$([0-9a-f]{8})\$$`)
+var uuidRegex = regexp.MustCompile(`^([0-9a-f]{8})-([0-9a-f]{4})-([0-9a-f]{4})-([0-9a-f]{4})-([0-9a-f]{12})$`)
+var hexMessageIDRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// MessageIDCapacity Returns the maximum number of bytes hidden by the message IDs of the mail client (see
+// `NewCarryingMessageID`).
+func (c MailClient) MessageIDCapacity() int {
+	var capacity int
+
+	for _, position := range messageIDPayloadPositions {
+		if position < c.profile().messageIDBytes {
+			capacity++
+		}
+	}
+	return capacity
+}
+
+// MessageIDPayload Extracts the bytes hidden by a message ID (see `NewCarryingMessageID`): `length` bytes. The format
+// of the message ID (the mail client) is detected.
+func MessageIDPayload(messageID string, length int) ([]byte, error) {
+	var err error
+	var local = strings.ToLower(strings.Trim(strings.TrimSpace(messageID), "<>"))
+	var random []byte
+	var payload []byte
+
+	if i := strings.LastIndex(local, "@"); i >= 0 {
+		local = local[:i]
+	}
+	if matches := outlookMessageIDRegex.FindStringSubmatch(local); matches != nil {
+		random, err = hex.DecodeString(strings.Join(matches[1:], ""))
+	} else if matches = uuidRegex.FindStringSubmatch(local); matches != nil {
+		random, err = hex.DecodeString(strings.Join(matches[1:], ""))
+	} else if hexMessageIDRegex.MatchString(local) {
+		random, err = hex.DecodeString(local)
+	} else {
+		return nil, fmt.Errorf(`the message ID "%s" hides no bytes (unknown format)`, messageID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if length > len(messageIDPayloadPositions) {
+		return nil, fmt.Errorf(`a message ID hides up to %d bytes (%d expected)`, len(messageIDPayloadPositions), length)
+	}
+	for _, position := range messageIDPayloadPositions[:length] {
+		if position >= len(random) {
+			return nil, fmt.Errorf(`the message ID "%s" hides less than %d bytes`, messageID, length)
+		}
+		payload = append(payload, random[position])
+	}
+	return payload, nil
+}
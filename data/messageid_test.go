@@ -0,0 +1,43 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestMessageIDPayload(t *testing.T) {
+	var err error
+	var payload = []byte{0x00, 0xff, 0x10, 0x20, 0x30, 0x40, 0x50, 0x60, 0x70, 0x80}
+
+	for client, capacity := range map[MailClient]int{
+		ClientDefault:     10,
+		ClientThunderbird: 10,
+		ClientOutlook:     6,
+		ClientAppleMail:   10,
+	} {
+		var id string
+		var extracted []byte
+
+		assert.Equal(t, capacity, client.MessageIDCapacity())
+		id, err = client.NewCarryingMessageID("john@example.com", "1a2b3c4d", payload[:capacity])
+		assert.Nil(t, err)
+		assert.True(t, strings.HasSuffix(id, "@example.com>"), id)
+		extracted, err = MessageIDPayload(id, capacity)
+		assert.Nil(t, err)
+		assert.Equal(t, payload[:capacity], extracted, id)
+		// The marker is kept.
+		assert.Contains(t, strings.ToLower(id), "1a2b3c4d")
+
+		_, err = client.NewCarryingMessageID("john@example.com", "", append(payload[:capacity:capacity], 0))
+		assert.NotNil(t, err)
+	}
+
+	// We'll get errors...
+	for _, id := range []string{"<CAF=abc@mail.gmail.com>", "<1a2b@example.com>", ""} {
+		_, err = MessageIDPayload(id, 6)
+		assert.NotNil(t, err, id)
+	}
+	_, err = MessageIDPayload("<00001a2b3c4d$00000000$00000000$@example.com>", 7)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,520 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// The encodings of the plain text part of the emails ("Content-Transfer-Encoding"). The HTML part is always encoded
+// in base64.
+const (
+	TextEncodingBase64          = "base64"
+	TextEncodingQuotedPrintable = "quoted-printable"
+)
+
+// DefaultCharset The character set of the parts of the emails, unless another one is given (see `ParseCharset`).
+const DefaultCharset = "utf-8"
+
+// base64LineLength The maximum length of the lines of base64 encoded content (RFC 2045).
+const base64LineLength = 76
+
+// NestingDepth The number of levels of a nested email (see `BuildNested`). Each level has its own boundary.
+const NestingDepth = 3
+
+// BodyPayloads The bytes of a chunk of the message hidden by the body of an email (see `Carriers.Split`). The bodies
+// that hide nothing are written as usual.
+type BodyPayloads struct {
+	// Base64Lines The bytes hidden by the lengths of the lines of the base64 encoded parts (see `CarrierBase64Lines`).
+	Base64Lines []byte
+	// SoftBreaks The bytes hidden by the soft line breaks of the quoted-printable encoded part (see
+	// `CarrierSoftBreaks`).
+	SoftBreaks []byte
+	// Whitespace The bytes hidden by the whitespaces at the end of the lines of the plain text part (see
+	// `CarrierWhitespace`).
+	Whitespace []byte
+	// Image The bytes hidden by the pixels of the cover image attached to the email (see `CarrierImage`). Only the
+	// nested emails have attachments (see `BuildNested`).
+	Image []byte
+	// Cover The file of the cover image (PNG or BMP), and its path (its name is given to the attachment).
+	Cover     []byte
+	CoverPath string
+}
+
+// bodyCarriers The parts of the body of an email that hide bytes (see `BodyPayloads`). The carriers that hide nothing
+// are nil.
+type bodyCarriers struct {
+	lines      *base64Lines
+	breaks     *softBreaks
+	whitespace *trailingWhitespace
+}
+
+// newBodyCarriers Returns the parts of the body that hide the given payloads.
+func newBodyCarriers(payloads BodyPayloads) bodyCarriers {
+	return bodyCarriers{lines: newBase64Lines(payloads.Base64Lines), breaks: newSoftBreaks(payloads.SoftBreaks),
+		whitespace: newTrailingWhitespace(payloads.Whitespace)}
+}
+
+// check Checks that all the bytes are hidden, once the body is written.
+func (c bodyCarriers) check() error {
+	if err := c.lines.check(); err != nil {
+		return err
+	}
+	return c.breaks.check()
+}
+
+// CheckTextEncoding Checks the encoding of the plain text part of the emails (an empty encoding means base64).
+func CheckTextEncoding(encoding string) error {
+	switch encoding {
+	case "", TextEncodingBase64, TextEncodingQuotedPrintable:
+		return nil
+	}
+	return fmt.Errorf(`unknown encoding "%s" (expected "%s" or "%s")`, encoding, TextEncodingBase64, TextEncodingQuotedPrintable)
+}
+
+// ParseCharset Checks the name of the character set of the parts of the emails (such as "iso-8859-1" or
+// "windows-1252"), and returns its MIME name (in lowercase). An empty name means `DefaultCharset`.
+func ParseCharset(name string) (string, error) {
+	var err error
+	var charset encoding.Encoding
+	var mimeName string
+
+	if len(name) == 0 {
+		return DefaultCharset, nil
+	}
+	if charset, err = ianaindex.MIME.Encoding(name); err != nil || charset == nil {
+		return "", fmt.Errorf(`unknown (or unsupported) character set "%s"`, name)
+	}
+	if mimeName, err = ianaindex.MIME.Name(charset); err != nil {
+		return "", fmt.Errorf(`unknown (or unsupported) character set "%s"`, name)
+	}
+	return strings.ToLower(mimeName), nil
+}
+
+// EncodeCharset Converts a text (UTF-8) into a given character set (see `ParseCharset`). It is an error if the text
+// contains characters that the character set cannot represent.
+func EncodeCharset(charset string, text []byte) ([]byte, error) {
+	var err error
+	var target encoding.Encoding
+	var result []byte
+
+	if charset, err = ParseCharset(charset); err != nil {
+		return nil, err
+	}
+	if charset == DefaultCharset {
+		return text, nil
+	}
+	if target, err = ianaindex.MIME.Encoding(charset); err != nil {
+		return nil, err
+	}
+	if result, err = target.NewEncoder().Bytes(text); err != nil {
+		return nil, fmt.Errorf(`the text cannot be written in the character set "%s": %s`, charset, err.Error())
+	}
+	return result, nil
+}
+
+// BuildAlternative Returns the body of a "multipart/alternative" email, made of a plain text part and an HTML part,
+// separated by a given boundary. The parts are written in a given character set (see `ParseCharset`), and hide the
+// given payloads. The lines are terminated by CRLF.
+func BuildAlternative(boundary string, text []byte, html []byte, textEncoding string, charset string, payloads BodyPayloads) ([]byte, error) {
+	var err error
+	var buffer bytes.Buffer
+	var writer = multipart.NewWriter(&buffer)
+	var carriers = newBodyCarriers(payloads)
+
+	if err = writer.SetBoundary(boundary); err != nil {
+		return nil, fmt.Errorf(`invalid boundary "%s": %s`, boundary, err.Error())
+	}
+	if len(payloads.Image) > 0 {
+		return nil, fmt.Errorf(`the cover image can only be attached to the nested emails`)
+	}
+	if err = CheckTextEncoding(textEncoding); err != nil {
+		return nil, err
+	}
+	if len(textEncoding) == 0 {
+		textEncoding = TextEncodingBase64
+	}
+	if text, err = carriers.whitespace.hide(text); err != nil {
+		return nil, err
+	}
+	if charset, text, html, err = encodeParts(charset, text, html); err != nil {
+		return nil, err
+	}
+	if err = writePart(writer, fmt.Sprintf(`text/plain; charset="%s"`, charset), textEncoding, text, carriers); err != nil {
+		return nil, err
+	}
+	if err = writePart(writer, fmt.Sprintf(`text/html; charset="%s"`, charset), TextEncodingBase64, html, carriers); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	if err = carriers.check(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// BuildNested Returns the body of a "multipart/mixed" email that contains a "multipart/alternative" part, made of a
+// plain text part and a "multipart/related" part (that contains the HTML part). The boundaries of the levels are given
+// in this order: "mixed", "alternative" and "related" (see `NestingDepth`). The parts are written in a given character
+// set (see `ParseCharset`), and hide the given payloads. The cover image (if any) is attached to the email: it follows
+// the "multipart/alternative" part. The lines are terminated by CRLF.
+func BuildNested(boundaries []string, text []byte, html []byte, textEncoding string, charset string, payloads BodyPayloads) ([]byte, error) {
+	var err error
+	var buffer bytes.Buffer
+	var mixed = multipart.NewWriter(&buffer)
+	var alternative *multipart.Writer
+	var related *multipart.Writer
+	var part io.Writer
+	var carriers = newBodyCarriers(payloads)
+
+	if len(boundaries) != NestingDepth {
+		return nil, fmt.Errorf(`invalid number of boundaries (%d instead of %d)`, len(boundaries), NestingDepth)
+	}
+	if err = CheckTextEncoding(textEncoding); err != nil {
+		return nil, err
+	}
+	if len(textEncoding) == 0 {
+		textEncoding = TextEncodingBase64
+	}
+	if text, err = carriers.whitespace.hide(text); err != nil {
+		return nil, err
+	}
+	if charset, text, html, err = encodeParts(charset, text, html); err != nil {
+		return nil, err
+	}
+	if err = mixed.SetBoundary(boundaries[0]); err != nil {
+		return nil, fmt.Errorf(`invalid boundary "%s": %s`, boundaries[0], err.Error())
+	}
+	if part, err = mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {fmt.Sprintf(`multipart/alternative; boundary="%s"`, boundaries[1])}}); err != nil {
+		return nil, err
+	}
+	alternative = multipart.NewWriter(part)
+	if err = alternative.SetBoundary(boundaries[1]); err != nil {
+		return nil, fmt.Errorf(`invalid boundary "%s": %s`, boundaries[1], err.Error())
+	}
+	if err = writePart(alternative, fmt.Sprintf(`text/plain; charset="%s"`, charset), textEncoding, text, carriers); err != nil {
+		return nil, err
+	}
+	if part, err = alternative.CreatePart(textproto.MIMEHeader{"Content-Type": {fmt.Sprintf(`multipart/related; boundary="%s"; type="text/html"`, boundaries[2])}}); err != nil {
+		return nil, err
+	}
+	related = multipart.NewWriter(part)
+	if err = related.SetBoundary(boundaries[2]); err != nil {
+		return nil, fmt.Errorf(`invalid boundary "%s": %s`, boundaries[2], err.Error())
+	}
+	if err = writePart(related, fmt.Sprintf(`text/html; charset="%s"`, charset), TextEncodingBase64, html, carriers); err != nil {
+		return nil, err
+	}
+	for _, writer := range []*multipart.Writer{related, alternative} {
+		if err = writer.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if len(payloads.Image) > 0 {
+		if err = writeImage(mixed, payloads, carriers); err != nil {
+			return nil, err
+		}
+	}
+	if err = mixed.Close(); err != nil {
+		return nil, err
+	}
+	if err = carriers.check(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// boundaryRegex Extracts the boundary from the value of a "Content-Type" header.
+var boundaryRegex = regexp.MustCompile(`boundary="(?P<boundary>[^"]+)"`)
+
+// HeaderBoundary Returns the boundary given by the "Content-Type" header of an email (nil if there is none).
+func HeaderBoundary(header mail.Header) (*string, error) {
+	var ok bool
+	var contentType []string
+	var matches []string
+
+	if contentType, ok = header["Content-Type"]; !ok {
+		return nil, nil
+	}
+	if len(contentType) == 0 {
+		return nil, nil
+	}
+	if len(contentType) > 1 {
+		return nil, fmt.Errorf(`unexpected "Content-Type" header value (more than one values)`)
+	}
+	matches = boundaryRegex.FindStringSubmatch(contentType[0])
+	if matches == nil {
+		return nil, nil
+	}
+	return &matches[boundaryRegex.SubexpIndex("boundary")], nil
+}
+
+// RawHeaderBoundary Returns the boundary given by the header of an email, fetched without the body (nil if there is
+// none: the email does not hide anything, and its body does not need to be fetched).
+func RawHeaderBoundary(header []byte) (*string, error) {
+	var err error
+	var message *mail.Message
+
+	if !bytes.HasSuffix(header, []byte("\r\n\r\n")) && !bytes.HasSuffix(header, []byte("\n\n")) {
+		// The blank line that ends the header may be omitted.
+		header = append(append([]byte{}, header...), "\r\n\r\n"...)
+	}
+	if message, err = mail.ReadMessage(bytes.NewReader(header)); err != nil {
+		return nil, err
+	}
+	return HeaderBoundary(message.Header)
+}
+
+// NestedBoundaries Returns the boundaries of an email, given its "Content-Type" header and its body: the boundary of
+// the email, followed by the boundaries of the nested multipart parts (for each level, the first multipart part is
+// followed), from the outermost to the innermost. At most `NestingDepth` boundaries are returned.
+func NestedBoundaries(contentType string, body io.Reader) ([]string, error) {
+	var result []string
+
+	for len(result) < NestingDepth {
+		var err error
+		var mediaType string
+		var params map[string]string
+		var reader *multipart.Reader
+		var found = false
+
+		if mediaType, params, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, fmt.Errorf(`invalid "Content-Type" header "%s": %s`, contentType, err.Error())
+		}
+		if !strings.HasPrefix(mediaType, "multipart/") || len(params["boundary"]) == 0 {
+			break
+		}
+		result = append(result, params["boundary"])
+		reader = multipart.NewReader(body, params["boundary"])
+		for {
+			var part *multipart.Part
+			if part, err = reader.NextPart(); err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(strings.ToLower(part.Header.Get("Content-Type")), "multipart/") {
+				contentType = part.Header.Get("Content-Type")
+				body = part
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return result, nil
+}
+
+// leafPart A part of an email that is not multipart: its header, and its body as written into the email (not decoded).
+type leafPart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// leafParts Returns the parts of an email (RFC 5322) that are not multipart, in the order they are written. An email
+// that is not multipart is made of a single part.
+func leafParts(content []byte) ([]leafPart, error) {
+	var err error
+	var message *mail.Message
+
+	if message, err = mail.ReadMessage(bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	return appendLeafParts(nil, textproto.MIMEHeader(message.Header), message.Body)
+}
+
+// decode Returns the body of a part, decoded as given by its "Content-Transfer-Encoding" header (it is not converted
+// from its character set).
+func (p leafPart) decode() ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(p.header.Get("Content-Transfer-Encoding"))) {
+	case TextEncodingBase64:
+		return io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(bytes.Join(bytes.Fields(p.body), nil))))
+	case TextEncodingQuotedPrintable:
+		return io.ReadAll(quotedprintable.NewReader(bytes.NewReader(p.body)))
+	}
+	return p.body, nil
+}
+
+// appendLeafParts Appends the parts of a part (given its header and its body) that are not multipart.
+func appendLeafParts(parts []leafPart, header textproto.MIMEHeader, body io.Reader) ([]leafPart, error) {
+	var err error
+	var mediaType string
+	var params map[string]string
+	var reader *multipart.Reader
+
+	if mediaType, params, err = mime.ParseMediaType(header.Get("Content-Type")); err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		var content []byte
+		if content, err = io.ReadAll(body); err != nil {
+			return nil, err
+		}
+		return append(parts, leafPart{header: header, body: content}), nil
+	}
+	reader = multipart.NewReader(body, params["boundary"])
+	for {
+		var part *multipart.Part
+		if part, err = reader.NextRawPart(); err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if parts, err = appendLeafParts(parts, part.Header, part); err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+// encodeParts Converts the plain text part and the HTML part into a given character set. It returns the MIME name of
+// the character set, and the converted parts.
+func encodeParts(charset string, text []byte, html []byte) (string, []byte, []byte, error) {
+	var err error
+
+	if charset, err = ParseCharset(charset); err != nil {
+		return "", nil, nil, err
+	}
+	if text, err = EncodeCharset(charset, text); err != nil {
+		return "", nil, nil, err
+	}
+	if html, err = EncodeCharset(charset, html); err != nil {
+		return "", nil, nil, err
+	}
+	return charset, text, html, nil
+}
+
+// writePart Writes a part of a multipart body, using a given encoding. The lines of the part hide the bytes of the
+// carriers of its encoding (if any).
+func writePart(writer *multipart.Writer, contentType string, encoding string, content []byte, carriers bodyCarriers) error {
+	var err error
+	var part io.Writer
+	var header = textproto.MIMEHeader{}
+
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", encoding)
+	if part, err = writer.CreatePart(header); err != nil {
+		return err
+	}
+	return writeContent(part, encoding, content, carriers)
+}
+
+// writeImage Writes the cover image that hides the bytes of `payloads.Image` (see `HideInImage`), as an attachment
+// encoded in base64. The lines of the part hide the bytes of the base64 encoded parts (if any).
+func writeImage(writer *multipart.Writer, payloads BodyPayloads, carriers bodyCarriers) error {
+	var err error
+	var part io.Writer
+	var content []byte
+	var format string
+	var name string
+	var header = textproto.MIMEHeader{}
+
+	if content, format, err = HideInImage(payloads.Cover, payloads.Image); err != nil {
+		return err
+	}
+	name = coverImageName(payloads.CoverPath, format)
+	header.Set("Content-Type", mime.FormatMediaType(ImageContentType(format), map[string]string{"name": name}))
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	header.Set("Content-Transfer-Encoding", TextEncodingBase64)
+	if part, err = writer.CreatePart(header); err != nil {
+		return err
+	}
+	return writeContent(part, TextEncodingBase64, content, carriers)
+}
+
+// writeContent Writes the content of a part, using a given encoding. The lines of the part hide the bytes of the
+// carriers of its encoding (if any).
+func writeContent(part io.Writer, encoding string, content []byte, carriers bodyCarriers) error {
+	var err error
+	var encoder io.WriteCloser
+
+	if encoding == TextEncodingQuotedPrintable && carriers.breaks != nil {
+		if content, err = carriers.breaks.encode(content); err != nil {
+			return err
+		}
+		_, err = part.Write(content)
+		return err
+	}
+	if encoding == TextEncodingQuotedPrintable {
+		// The line breaks are written as CRLF.
+		encoder = quotedprintable.NewWriter(part)
+	} else {
+		encoder = base64.NewEncoder(base64.StdEncoding, &lineWrapper{writer: part, length: base64LineLength, lines: carriers.lines,
+			remaining: base64.StdEncoding.EncodedLen(len(content))})
+	}
+	if _, err = encoder.Write(content); err != nil {
+		return err
+	}
+	if err = encoder.Close(); err != nil {
+		return err
+	}
+	if encoding == TextEncodingQuotedPrintable {
+		return nil
+	}
+	// Terminates the last line.
+	_, err = io.WriteString(part, "\r\n")
+	return err
+}
+
+// lineWrapper Splits the data written into lines of a given length (terminated by CRLF), or of the lengths given by
+// `lines` (if not nil).
+type lineWrapper struct {
+	writer io.Writer
+	length int
+	lines  *base64Lines
+	// column The number of bytes written on the current line.
+	column int
+	// remaining The number of bytes that remain to be written (used by `lines`).
+	remaining int
+	// started Tells whether the first line is started.
+	started bool
+}
+
+func (w *lineWrapper) Write(data []byte) (int, error) {
+	var err error
+	var written int
+
+	for len(data) > 0 {
+		var chunk = data
+		if !w.started || w.column == w.length {
+			if w.started {
+				if _, err = io.WriteString(w.writer, "\r\n"); err != nil {
+					return written, err
+				}
+			}
+			w.started = true
+			w.column = 0
+			if w.lines != nil {
+				if w.length, err = w.lines.next(w.remaining); err != nil {
+					return written, err
+				}
+			}
+		}
+		if len(chunk) > w.length-w.column {
+			chunk = chunk[:w.length-w.column]
+		}
+		var n int
+		n, err = w.writer.Write(chunk)
+		written += n
+		w.column += n
+		w.remaining -= n
+		if err != nil {
+			return written, err
+		}
+		data = data[n:]
+	}
+	return written, nil
+}
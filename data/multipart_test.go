@@ -0,0 +1,207 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+func TestBuildAlternative(t *testing.T) {
+	var boundary = strings.Repeat("0a", 35)
+	var text = []byte(strings.Repeat("Hello John, how are you? Ça va ?\n", 10))
+	var html = []byte("<p>Hello John</p>")
+
+	for _, encoding := range []string{"", TextEncodingBase64, TextEncodingQuotedPrintable} {
+		var err error
+		var content []byte
+		var reader *multipart.Reader
+		var part *multipart.Part
+		var decoded []byte
+
+		if content, err = BuildAlternative(boundary, text, html, encoding, "", BodyPayloads{}); err != nil {
+			assert.FailNow(t, err.Error())
+		}
+		// The lines are terminated by CRLF, and they are not too long.
+		for _, line := range strings.Split(string(content), "\r\n") {
+			assert.NotContains(t, line, "\n", encoding)
+			assert.LessOrEqual(t, len(line), 76, encoding)
+		}
+		assert.True(t, bytes.HasPrefix(content, []byte("--"+boundary+"\r\n")), encoding)
+		assert.True(t, bytes.HasSuffix(content, []byte("--"+boundary+"--\r\n")), encoding)
+
+		// The parts are decoded by the standard library (which handles quoted-printable).
+		reader = multipart.NewReader(bytes.NewReader(content), boundary)
+		part, err = reader.NextPart()
+		assert.Nil(t, err)
+		assert.Equal(t, `text/plain; charset="utf-8"`, part.Header.Get("Content-Type"))
+		decoded, _ = io.ReadAll(part)
+		if encoding == TextEncodingQuotedPrintable {
+			assert.Equal(t, strings.ReplaceAll(string(text), "\n", "\r\n"), string(decoded))
+		} else {
+			assert.Equal(t, "base64", part.Header.Get("Content-Transfer-Encoding"))
+			assert.Equal(t, text, decodeBase64(t, decoded))
+		}
+		part, err = reader.NextPart()
+		assert.Nil(t, err)
+		assert.Equal(t, `text/html; charset="utf-8"`, part.Header.Get("Content-Type"))
+		decoded, _ = io.ReadAll(part)
+		assert.Equal(t, html, decodeBase64(t, decoded))
+		_, err = reader.NextPart()
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestBuildAlternativeErrors(t *testing.T) {
+	var err error
+
+	_, err = BuildAlternative(strings.Repeat("0a", 36), nil, nil, "", "", BodyPayloads{})
+	assert.NotNil(t, err)
+	_, err = BuildAlternative("0a1b", nil, nil, "7bit", "", BodyPayloads{})
+	assert.NotNil(t, err)
+	_, err = BuildAlternative("0a1b", nil, nil, "", "klingon", BodyPayloads{})
+	assert.NotNil(t, err)
+	// The text cannot be written in the character set.
+	_, err = BuildAlternative("0a1b", []byte("10 €"), nil, "", "iso-8859-1", BodyPayloads{})
+	assert.NotNil(t, err)
+}
+
+func TestBuildAlternativeCharset(t *testing.T) {
+	var err error
+	var content []byte
+	var reader *multipart.Reader
+	var part *multipart.Part
+	var decoded []byte
+
+	if content, err = BuildAlternative("0a1b", []byte("Ça va ?"), []byte("<p>Ça va ?</p>"), TextEncodingQuotedPrintable, "ISO-8859-1", BodyPayloads{}); err != nil {
+		assert.FailNow(t, err.Error())
+	}
+	reader = multipart.NewReader(bytes.NewReader(content), "0a1b")
+	part, _ = reader.NextPart()
+	assert.Equal(t, `text/plain; charset="iso-8859-1"`, part.Header.Get("Content-Type"))
+	decoded, _ = io.ReadAll(part)
+	assert.Equal(t, []byte("\xc7a va ?"), decoded)
+	part, _ = reader.NextPart()
+	assert.Equal(t, `text/html; charset="iso-8859-1"`, part.Header.Get("Content-Type"))
+	decoded, _ = io.ReadAll(part)
+	assert.Equal(t, []byte("<p>\xc7a va ?</p>"), decodeBase64(t, decoded))
+}
+
+func TestParseCharset(t *testing.T) {
+	for name, expected := range map[string]string{"": "utf-8", "UTF-8": "utf-8", "latin1": "iso-8859-1", "Windows-1252": "windows-1252"} {
+		var charset, err = ParseCharset(name)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, charset, name)
+	}
+	_, err := ParseCharset("klingon")
+	assert.NotNil(t, err)
+}
+
+func TestBuildNested(t *testing.T) {
+	var err error
+	var boundaries = []string{strings.Repeat("0a", 35), "------------" + strings.Repeat("B", 48), "_000_" + strings.Repeat("C", 55) + "_"}
+	var text = []byte("Hello John")
+	var html = []byte("<p>Hello John</p>")
+	var content []byte
+	var found []string
+	var reader *multipart.Reader
+	var part *multipart.Part
+	var decoded []byte
+
+	if content, err = BuildNested(boundaries, text, html, TextEncodingQuotedPrintable, "", BodyPayloads{}); err != nil {
+		assert.FailNow(t, err.Error())
+	}
+	for _, line := range strings.Split(string(content), "\r\n") {
+		assert.NotContains(t, line, "\n")
+	}
+
+	// The boundaries are found in the level order.
+	if found, err = NestedBoundaries(`multipart/mixed; boundary="`+boundaries[0]+`"`, bytes.NewReader(content)); err != nil {
+		assert.FailNow(t, err.Error())
+	}
+	assert.Equal(t, boundaries, found)
+
+	// The parts are where the mail clients expect them.
+	reader = multipart.NewReader(bytes.NewReader(content), boundaries[0])
+	part, _ = reader.NextPart()
+	reader = multipart.NewReader(part, boundaries[1])
+	part, _ = reader.NextPart()
+	assert.Equal(t, `text/plain; charset="utf-8"`, part.Header.Get("Content-Type"))
+	decoded, _ = io.ReadAll(part)
+	assert.Equal(t, text, decoded)
+	part, _ = reader.NextPart()
+	assert.True(t, strings.HasPrefix(part.Header.Get("Content-Type"), "multipart/related;"))
+	reader = multipart.NewReader(part, boundaries[2])
+	part, _ = reader.NextPart()
+	assert.Equal(t, `text/html; charset="utf-8"`, part.Header.Get("Content-Type"))
+	decoded, _ = io.ReadAll(part)
+	assert.Equal(t, html, decodeBase64(t, decoded))
+
+	_, err = BuildNested(boundaries[:2], text, html, "", "", BodyPayloads{})
+	assert.NotNil(t, err)
+}
+
+func TestNestedBoundaries(t *testing.T) {
+	var err error
+	var boundary = strings.Repeat("0a", 35)
+	var content []byte
+	var found []string
+
+	// An email that is not nested has one boundary.
+	content, _ = BuildAlternative(boundary, []byte("Hello"), []byte("<p>Hello</p>"), "", "", BodyPayloads{})
+	found, err = NestedBoundaries(`multipart/alternative; boundary="`+boundary+`"`, bytes.NewReader(content))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{boundary}, found)
+
+	// An email that is not multipart has none.
+	found, err = NestedBoundaries(`text/plain; charset="utf-8"`, strings.NewReader("Hello"))
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+
+	_, err = NestedBoundaries(`multipart/mixed; boundary="`, strings.NewReader(""))
+	assert.NotNil(t, err)
+}
+
+func TestRawHeaderBoundary(t *testing.T) {
+	var boundary = strings.Repeat("0a", 35)
+
+	for _, test := range []struct {
+		header   string
+		expected string
+		valid    bool
+	}{
+		{header: "Subject: Hello\r\nContent-Type: multipart/alternative; boundary=\"" + boundary + "\"\r\n\r\n", expected: boundary, valid: true},
+		// The blank line that ends the header may be omitted.
+		{header: "Subject: Hello\r\nContent-Type: multipart/alternative; boundary=\"" + boundary + "\"\r\n", expected: boundary, valid: true},
+		{header: "Content-Type: multipart/mixed;\r\n boundary=\"" + boundary + "\"", expected: boundary, valid: true},
+		// No boundary: the body is not fetched.
+		{header: "Subject: Hello\r\nContent-Type: text/plain; charset=\"utf-8\"\r\n\r\n", valid: true},
+		{header: "Subject: Hello\r\n\r\n", valid: true},
+		{header: "Content-Type: multipart/mixed; boundary=\"a\"\r\nContent-Type: multipart/mixed; boundary=\"b\"\r\n\r\n", valid: false},
+		{header: "not a header\r\n\r\n", valid: false},
+	} {
+		var found, err = RawHeaderBoundary([]byte(test.header))
+		if !test.valid {
+			assert.NotNil(t, err, test.header)
+			continue
+		}
+		assert.Nil(t, err, test.header)
+		if len(test.expected) == 0 {
+			assert.Nil(t, found, test.header)
+			continue
+		}
+		if assert.NotNil(t, found, test.header) {
+			assert.Equal(t, test.expected, *found)
+		}
+	}
+}
+
+func decodeBase64(t *testing.T, encoded []byte) []byte {
+	// The decoder ignores the line breaks.
+	var decoded, err = io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(encoded)))
+	assert.Nil(t, err)
+	return decoded
+}
@@ -0,0 +1,310 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tokenExtension The extension of the files that contain the OAuth2 tokens.
+const tokenExtension = ".json"
+
+// tokenExpiryMargin An access token that expires within this delay is refreshed before being used.
+const tokenExpiryMargin = time.Minute
+
+// OAuthProvider The endpoints of an OAuth2 provider, and the scope required to send (or receive) the emails.
+type OAuthProvider struct {
+	DeviceURL string
+	TokenURL  string
+	Scope     string
+}
+
+// OAuthProviders The known OAuth2 providers.
+var OAuthProviders = map[string]OAuthProvider{
+	"gmail": {
+		DeviceURL: "https://oauth2.googleapis.com/device/code",
+		TokenURL:  "https://oauth2.googleapis.com/token",
+		Scope:     "https://mail.google.com/",
+	},
+	"office365": {
+		DeviceURL: "https://login.microsoftonline.com/common/oauth2/v2.0/devicecode",
+		TokenURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		Scope:     "https://outlook.office.com/SMTP.Send https://outlook.office.com/IMAP.AccessAsUser.All offline_access",
+	},
+	"office365-graph": {
+		DeviceURL: "https://login.microsoftonline.com/common/oauth2/v2.0/devicecode",
+		TokenURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		Scope:     "https://graph.microsoft.com/Mail.Send https://graph.microsoft.com/Mail.Read offline_access",
+	},
+}
+
+// OAuthToken The OAuth2 credentials of an account, used to authenticate on the SMTP and IMAP servers (XOAUTH2). The
+// access token is refreshed (using the refresh token) when it expires.
+type OAuthToken struct {
+	TokenURL     string    `json:"token-url"`
+	ClientID     string    `json:"client-id"`
+	ClientSecret string    `json:"client-secret,omitempty"`
+	RefreshToken string    `json:"refresh-token"`
+	AccessToken  string    `json:"access-token,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// tokenResponse The response of the token endpoint (or of the device authorization endpoint).
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// DeviceAuthorization A pending device authorization: the user must visit the verification URL and enter the user
+// code.
+type DeviceAuthorization struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_uri"`
+	Interval        int    `json:"interval"`
+	ExpiresIn       int    `json:"expires_in"`
+	// Some providers (Google) do not follow RFC 8628 for the name of the verification URL.
+	AltVerificationURL string `json:"verification_url,omitempty"`
+}
+
+// TokenStore A directory that contains the OAuth2 tokens of the accounts (one file per account).
+type TokenStore struct {
+	Dir string
+}
+
+// NewTokenStore Creates a token store. The directory is created if it does not exist.
+func NewTokenStore(dir string) (*TokenStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf(`cannot create the token directory "%s": %s`, dir, err.Error())
+	}
+	return &TokenStore{Dir: dir}, nil
+}
+
+// Path Returns the path to the file that contains the token of an account (an email address).
+func (t *TokenStore) Path(account string) string {
+	return filepath.Join(t.Dir, account+tokenExtension)
+}
+
+// Get Returns the token of an account, or an error that wraps `ErrNotFound`.
+func (t *TokenStore) Get(account string) (*OAuthToken, error) {
+	var err error
+	var content []byte
+	var token OAuthToken
+
+	if err = checkAccountName(account); err != nil {
+		return nil, err
+	}
+	if content, err = os.ReadFile(t.Path(account)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf(`token of "%s": %w`, account, ErrNotFound)
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &token); err != nil {
+		return nil, fmt.Errorf(`invalid token file "%s": %s`, t.Path(account), err.Error())
+	}
+	return &token, nil
+}
+
+// Put Writes the token of an account (only readable by the user).
+func (t *TokenStore) Put(account string, token *OAuthToken) error {
+	var err error
+	var content []byte
+
+	if err = checkAccountName(account); err != nil {
+		return err
+	}
+	if content, err = json.MarshalIndent(token, "", "  "); err != nil {
+		return err
+	}
+	return writeAtomically(t.Path(account), content)
+}
+
+// AccessToken Returns the access token of an account, or an error that wraps `ErrNotFound` if the account has no
+// token. The access token is refreshed (see `OAuthToken.Refresh`), and the token is saved, if it has expired (or if it
+// expires soon). If the refresh fails, then the token that is saved is left as is.
+func (t *TokenStore) AccessToken(account string, client *http.Client) (string, error) {
+	var err error
+	var token *OAuthToken
+
+	if token, err = t.Get(account); err != nil {
+		return "", err
+	}
+	if token.Valid() {
+		return token.AccessToken, nil
+	}
+	if err = token.Refresh(client); err != nil {
+		return "", err
+	}
+	if err = t.Put(account, token); err != nil {
+		return "", fmt.Errorf(`cannot save the OAuth2 token of "%s": %s`, account, err.Error())
+	}
+	return token.AccessToken, nil
+}
+
+// XOAuth2Response Returns the initial response of the XOAUTH2 SASL mechanism, given the user and its access token.
+func XOAuth2Response(user string, accessToken string) []byte {
+	return []byte(fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", user, accessToken))
+}
+
+// checkAccountName Checks that the name of an account can be used as a file name.
+func checkAccountName(account string) error {
+	if len(account) == 0 || strings.ContainsAny(account, `/\`) || account == "." || account == ".." {
+		return fmt.Errorf(`invalid account "%s"`, account)
+	}
+	return nil
+}
+
+// Valid Tells whether the access token can be used (it does not expire soon).
+func (o *OAuthToken) Valid() bool {
+	return len(o.AccessToken) > 0 && time.Now().Add(tokenExpiryMargin).Before(o.Expiry)
+}
+
+// Refresh Gets a new access token, using the refresh token. The provider may also return a new refresh token.
+func (o *OAuthToken) Refresh(client *http.Client) error {
+	var err error
+	var response *tokenResponse
+	var form = url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {o.ClientID},
+		"refresh_token": {o.RefreshToken},
+	}
+
+	if len(o.ClientSecret) > 0 {
+		form.Set("client_secret", o.ClientSecret)
+	}
+	if response, err = postForm(client, o.TokenURL, form, nil); err != nil {
+		return fmt.Errorf(`cannot refresh the access token: %s`, err.Error())
+	}
+	o.update(response)
+	return nil
+}
+
+// update Records the tokens returned by the token endpoint.
+func (o *OAuthToken) update(response *tokenResponse) {
+	o.AccessToken = response.AccessToken
+	o.Expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second).UTC().Truncate(time.Second)
+	if len(response.RefreshToken) > 0 {
+		o.RefreshToken = response.RefreshToken
+	}
+}
+
+// StartDeviceAuthorization Starts the device authorization flow: the returned user code must be entered by the user
+// at the returned verification URL (see `WaitDeviceAuthorization`).
+func StartDeviceAuthorization(client *http.Client, provider OAuthProvider, clientID string) (*DeviceAuthorization, error) {
+	var err error
+	var authorization DeviceAuthorization
+	var form = url.Values{"client_id": {clientID}, "scope": {provider.Scope}}
+
+	if _, err = postForm(client, provider.DeviceURL, form, &authorization); err != nil {
+		return nil, fmt.Errorf(`cannot start the device authorization: %s`, err.Error())
+	}
+	if len(authorization.DeviceCode) == 0 || len(authorization.UserCode) == 0 {
+		return nil, fmt.Errorf(`cannot start the device authorization: incomplete response`)
+	}
+	if len(authorization.VerificationURL) == 0 {
+		authorization.VerificationURL = authorization.AltVerificationURL
+	}
+	if authorization.Interval <= 0 {
+		authorization.Interval = 5
+	}
+	return &authorization, nil
+}
+
+// WaitDeviceAuthorization Polls the token endpoint until the user has granted the authorization (or until the
+// authorization expires), and returns the token. `sleep` waits between two requests.
+func WaitDeviceAuthorization(client *http.Client, provider OAuthProvider, clientID string, clientSecret string, authorization *DeviceAuthorization, sleep func(time.Duration)) (*OAuthToken, error) {
+	var interval = time.Duration(authorization.Interval) * time.Second
+	var deadline = time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+	var token = OAuthToken{TokenURL: provider.TokenURL, ClientID: clientID, ClientSecret: clientSecret}
+	var form = url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"client_id":   {clientID},
+		"device_code": {authorization.DeviceCode},
+	}
+
+	if len(clientSecret) > 0 {
+		form.Set("client_secret", clientSecret)
+	}
+	for authorization.ExpiresIn <= 0 || time.Now().Before(deadline) {
+		var err error
+		var response *tokenResponse
+		var oauthErr *oauthError
+
+		sleep(interval)
+		if response, err = postForm(client, provider.TokenURL, form, nil); err == nil {
+			if len(response.RefreshToken) == 0 {
+				return nil, fmt.Errorf(`the provider did not return a refresh token (check the scope)`)
+			}
+			token.update(response)
+			return &token, nil
+		}
+		if !errors.As(err, &oauthErr) {
+			return nil, err
+		}
+		switch oauthErr.code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf(`the device authorization has expired`)
+}
+
+// oauthError An error returned by an OAuth2 endpoint.
+type oauthError struct {
+	code        string
+	description string
+}
+
+func (e *oauthError) Error() string {
+	if len(e.description) > 0 {
+		return fmt.Sprintf(`%s (%s)`, e.code, e.description)
+	}
+	return e.code
+}
+
+// postForm Posts a form to an OAuth2 endpoint. The response is decoded into `result`, if given (otherwise, it is a
+// token response).
+func postForm(client *http.Client, endpoint string, form url.Values, result interface{}) (*tokenResponse, error) {
+	var err error
+	var response *http.Response
+	var body []byte
+	var token tokenResponse
+
+	if response, err = client.PostForm(endpoint, form); err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if body, err = io.ReadAll(io.LimitReader(response.Body, 1<<20)); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf(`invalid response from "%s" (status %d)`, endpoint, response.StatusCode)
+	}
+	if len(token.Error) > 0 {
+		return nil, &oauthError{code: token.Error, description: token.ErrorDescription}
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(`unexpected status from "%s" (%d)`, endpoint, response.StatusCode)
+	}
+	if result != nil {
+		return nil, json.Unmarshal(body, result)
+	}
+	if len(token.AccessToken) == 0 {
+		return nil, fmt.Errorf(`no access token returned by "%s"`, endpoint)
+	}
+	return &token, nil
+}
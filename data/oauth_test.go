@@ -0,0 +1,224 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTokenStore(t *testing.T) {
+	var err error
+	var store *TokenStore
+	var token *OAuthToken
+	var expiry = time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	store, err = NewTokenStore(t.TempDir())
+	assert.Nil(t, err)
+
+	_, err = store.Get("me@example.com")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	err = store.Put("me@example.com", &OAuthToken{TokenURL: "https://t", ClientID: "id", RefreshToken: "r", AccessToken: "a", Expiry: expiry})
+	assert.Nil(t, err)
+	token, err = store.Get("me@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "r", token.RefreshToken)
+	assert.True(t, expiry.Equal(token.Expiry))
+	assert.True(t, token.Valid())
+
+	// The account is used as a file name.
+	err = store.Put("../me@example.com", token)
+	assert.NotNil(t, err)
+	_, err = store.Get("")
+	assert.NotNil(t, err)
+}
+
+func TestOAuthTokenValid(t *testing.T) {
+	assert.False(t, (&OAuthToken{AccessToken: "a", Expiry: time.Now().Add(30 * time.Second)}).Valid())
+	assert.False(t, (&OAuthToken{Expiry: time.Now().Add(time.Hour)}).Valid())
+	assert.True(t, (&OAuthToken{AccessToken: "a", Expiry: time.Now().Add(time.Hour)}).Valid())
+}
+
+func TestOAuthTokenRefresh(t *testing.T) {
+	var err error
+	var server *httptest.Server
+	var token OAuthToken
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "good" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"invalid_grant","error_description":"bad token"}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"access_token":"new","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	token = OAuthToken{TokenURL: server.URL, ClientID: "id", RefreshToken: "good"}
+	err = token.Refresh(server.Client())
+	assert.Nil(t, err)
+	assert.Equal(t, "new", token.AccessToken)
+	assert.Equal(t, "good", token.RefreshToken)
+	assert.True(t, token.Valid())
+
+	token = OAuthToken{TokenURL: server.URL, ClientID: "id", RefreshToken: "bad"}
+	err = token.Refresh(server.Client())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid_grant")
+	assert.False(t, token.Valid())
+}
+
+func TestDeviceAuthorization(t *testing.T) {
+	var err error
+	var server *httptest.Server
+	var provider OAuthProvider
+	var authorization *DeviceAuthorization
+	var token *OAuthToken
+	var polls = 0
+	var waited time.Duration
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		switch r.URL.Path {
+		case "/device":
+			_, _ = fmt.Fprint(w, `{"device_code":"dc","user_code":"UC","verification_url":"https://v","interval":1,"expires_in":600}`)
+		case "/token":
+			polls++
+			switch polls {
+			case 1:
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = fmt.Fprint(w, `{"error":"authorization_pending"}`)
+			case 2:
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = fmt.Fprint(w, `{"error":"slow_down"}`)
+			default:
+				if r.Form.Get("device_code") != "dc" {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = fmt.Fprint(w, `{"error":"invalid_grant"}`)
+					return
+				}
+				_, _ = fmt.Fprint(w, `{"access_token":"a","refresh_token":"r","expires_in":3600}`)
+			}
+		}
+	}))
+	defer server.Close()
+	provider = OAuthProvider{DeviceURL: server.URL + "/device", TokenURL: server.URL + "/token", Scope: "s"}
+
+	authorization, err = StartDeviceAuthorization(server.Client(), provider, "id")
+	assert.Nil(t, err)
+	assert.Equal(t, "UC", authorization.UserCode)
+	assert.Equal(t, "https://v", authorization.VerificationURL)
+
+	token, err = WaitDeviceAuthorization(server.Client(), provider, "id", "", authorization, func(d time.Duration) { waited += d })
+	assert.Nil(t, err)
+	assert.Equal(t, 3, polls)
+	assert.Equal(t, 8*time.Second, waited) // 1s, 1s, then 6s after "slow_down".
+	assert.Equal(t, "r", token.RefreshToken)
+	assert.Equal(t, server.URL+"/token", token.TokenURL)
+
+	// The user declined.
+	polls = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, `{"error":"access_denied"}`)
+	})
+	_, err = WaitDeviceAuthorization(server.Client(), provider, "id", "", authorization, func(time.Duration) {})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "access_denied")
+}
+
+func TestTokenStoreAccessToken(t *testing.T) {
+	var err error
+	var store *TokenStore
+	var server *httptest.Server
+	var token *OAuthToken
+	var accessToken string
+	var refreshed = 0
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		refreshed++
+		if r.Form.Get("refresh_token") != "good" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"access_token":"new","refresh_token":"rotated","expires_in":3600}`)
+	}))
+	defer server.Close()
+	store, err = NewTokenStore(t.TempDir())
+	assert.Nil(t, err)
+
+	// No token.
+	_, err = store.AccessToken("me@example.com", server.Client())
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// The access token is valid: it is not refreshed.
+	assert.Nil(t, store.Put("me@example.com", &OAuthToken{TokenURL: server.URL, ClientID: "id", RefreshToken: "good", AccessToken: "old", Expiry: time.Now().Add(time.Hour)}))
+	accessToken, err = store.AccessToken("me@example.com", server.Client())
+	assert.Nil(t, err)
+	assert.Equal(t, "old", accessToken)
+	assert.Equal(t, 0, refreshed)
+
+	// The access token expires soon: it is refreshed, and the new tokens are saved.
+	assert.Nil(t, store.Put("me@example.com", &OAuthToken{TokenURL: server.URL, ClientID: "id", RefreshToken: "good", AccessToken: "old", Expiry: time.Now().Add(tokenExpiryMargin / 2)}))
+	accessToken, err = store.AccessToken("me@example.com", server.Client())
+	assert.Nil(t, err)
+	assert.Equal(t, "new", accessToken)
+	assert.Equal(t, 1, refreshed)
+	token, err = store.Get("me@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "new", token.AccessToken)
+	assert.Equal(t, "rotated", token.RefreshToken)
+	assert.True(t, token.Valid())
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, 5*time.Second)
+
+	// The refresh fails: the saved token is left as is.
+	assert.Nil(t, store.Put("other@example.com", &OAuthToken{TokenURL: server.URL, ClientID: "id", RefreshToken: "revoked", AccessToken: "old", Expiry: time.Now().Add(-time.Hour)}))
+	_, err = store.AccessToken("other@example.com", server.Client())
+	assert.ErrorContains(t, err, "invalid_grant")
+	token, err = store.Get("other@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "old", token.AccessToken)
+	assert.Equal(t, "revoked", token.RefreshToken)
+}
+
+func TestTokenStoreInvalidFile(t *testing.T) {
+	var err error
+	var store *TokenStore
+
+	store, err = NewTokenStore(t.TempDir())
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(store.Path("me@example.com"), []byte("{"), 0600))
+	_, err = store.Get("me@example.com")
+	assert.ErrorContains(t, err, "invalid token file")
+	_, err = store.AccessToken("me@example.com", http.DefaultClient)
+	assert.False(t, errors.Is(err, ErrNotFound))
+}
+
+func TestOAuthTokenExpiry(t *testing.T) {
+	var token = OAuthToken{RefreshToken: "r"}
+
+	// Without an expiry, the access token is not valid.
+	token.update(&tokenResponse{AccessToken: "a"})
+	assert.False(t, token.Valid())
+	assert.Equal(t, "r", token.RefreshToken)
+
+	token.update(&tokenResponse{AccessToken: "a", ExpiresIn: 3600})
+	assert.True(t, token.Valid())
+	assert.Equal(t, token.Expiry, token.Expiry.UTC().Truncate(time.Second))
+
+	// The access token is refreshed before it expires.
+	token.update(&tokenResponse{AccessToken: "a", ExpiresIn: int(tokenExpiryMargin/time.Second) - 1})
+	assert.False(t, token.Valid())
+}
+
+func TestXOAuth2Response(t *testing.T) {
+	assert.Equal(t, []byte("user=me@example.com\x01auth=Bearer token\x01\x01"), XOAuth2Response("me@example.com", "token"))
+}
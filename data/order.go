@@ -0,0 +1,36 @@
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+// SentOrder Returns the order in which emails were sent, given the dates they were sent (the "Date" headers): the
+// positions of the emails in `dates`, the oldest first. The emails sent at the same date keep their relative order:
+// their order cannot be inferred, so they are also returned as groups of positions (in the order of `dates`). If the
+// date of an email is unknown (zero), then no order can be inferred: nil is returned.
+func SentOrder(dates []time.Time) ([]int, [][]int) {
+	var order = make([]int, len(dates))
+	var ties [][]int
+
+	for i, date := range dates {
+		if date.IsZero() {
+			return nil, nil
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return dates[order[i]].Before(dates[order[j]])
+	})
+	for start := 0; start < len(order); {
+		var end = start + 1
+		for end < len(order) && dates[order[end]].Equal(dates[order[start]]) {
+			end++
+		}
+		if end-start > 1 {
+			ties = append(ties, append([]int{}, order[start:end]...))
+		}
+		start = end
+	}
+	return order, ties
+}
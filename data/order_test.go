@@ -0,0 +1,70 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSentOrder(t *testing.T) {
+	var order []int
+	var ties [][]int
+	var base = time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	order, ties = SentOrder([]time.Time{base.Add(2 * time.Minute), base, base.Add(time.Minute)})
+	assert.Equal(t, []int{1, 2, 0}, order)
+	assert.Nil(t, ties)
+
+	// The dates of different time zones are compared as instants.
+	order, ties = SentOrder([]time.Time{base.Add(time.Minute), base.In(time.FixedZone("CET", 3600))})
+	assert.Equal(t, []int{1, 0}, order)
+	assert.Nil(t, ties)
+
+	// The emails sent at the same date keep their relative order.
+	order, ties = SentOrder([]time.Time{base.Add(time.Minute), base, base.Add(time.Minute), base.Add(time.Hour), base})
+	assert.Equal(t, []int{1, 4, 0, 2, 3}, order)
+	assert.Equal(t, [][]int{{1, 4}, {0, 2}}, ties)
+
+	order, ties = SentOrder([]time.Time{base, {}})
+	assert.Nil(t, order)
+	assert.Nil(t, ties)
+
+	order, ties = SentOrder(nil)
+	assert.Equal(t, []int{}, order)
+	assert.Nil(t, ties)
+}
+
+func TestSentOrderCarryingDates(t *testing.T) {
+	var err error
+	var message = []byte("Hello world!")
+	var base = time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+	var carriers = Carriers{{Name: CarrierBoundary, Length: 35}, {Name: CarrierDate, Length: dateCarrierLength}}
+	var dates []time.Time
+	var order []int
+	var received []byte
+
+	assert.True(t, Carriers{}.KeepsDates())
+	assert.True(t, carriers[:1].KeepsDates())
+	assert.False(t, carriers.KeepsDates())
+
+	// Each email hides a byte of the message in its date: the emails are sent (and arrive) 5 seconds apart.
+	for i, value := range message {
+		var date time.Time
+		date, err = CarryingDate(base.Add(time.Duration(5*i)*time.Second), []byte{value})
+		assert.Nil(t, err)
+		dates = append(dates, date)
+	}
+
+	// The dates do not give the order the emails were sent.
+	order, _ = SentOrder(dates)
+	assert.NotEqual(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, order)
+
+	// In the order of their arrival, the emails give the message back.
+	for _, date := range dates {
+		var payload []byte
+		payload, err = DatePayload(date.Format(dateFormat), dateCarrierLength)
+		assert.Nil(t, err)
+		received = append(received, payload...)
+	}
+	assert.Equal(t, message, received)
+}
@@ -0,0 +1,147 @@
+package data
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// TransportPop3 The transport that retrieves the emails from a POP3 server (see "rcv").
+const TransportPop3 = "pop3"
+
+// DefaultPop3Port The port of the POP3 servers (TLS, RFC 8314).
+const DefaultPop3Port = 995
+
+// The status indicators of the replies of a POP3 server (RFC 1939).
+const (
+	pop3Ok  = "+OK"
+	pop3Err = "-ERR"
+)
+
+// Pop3Message An email of a POP3 mailbox: its number (valid for the session only), and its unique ID (UIDL, kept
+// across the sessions).
+type Pop3Message struct {
+	Number int
+	Uid    string
+}
+
+// Pop3Client A client of a POP3 server (RFC 1939), limited to the retrieval of the emails: the emails are never
+// deleted.
+type Pop3Client struct {
+	text *textproto.Conn
+}
+
+// NewPop3Client Creates a client that uses an open connection to a POP3 server (the server greets the client).
+func NewPop3Client(conn net.Conn) (*Pop3Client, error) {
+	var err error
+	var client = Pop3Client{text: textproto.NewConn(conn)}
+
+	if _, err = client.reply(); err != nil {
+		return nil, fmt.Errorf(`unexpected greeting from the POP3 server: %s`, err.Error())
+	}
+	return &client, nil
+}
+
+// Login Authenticates (USER and PASS).
+func (c *Pop3Client) Login(user string, password string) error {
+	var err error
+
+	if _, err = c.command("USER %s", user); err == nil {
+		_, err = c.command("PASS %s", password)
+	}
+	if err != nil {
+		return fmt.Errorf(`cannot authenticate as "%s": %s`, user, err.Error())
+	}
+	return nil
+}
+
+// Uidl Returns the emails of the mailbox (UIDL), from the oldest to the most recent.
+func (c *Pop3Client) Uidl() ([]Pop3Message, error) {
+	var err error
+	var lines []string
+	var messages []Pop3Message
+
+	if _, err = c.command("UIDL"); err != nil {
+		return nil, err
+	}
+	if lines, err = c.text.ReadDotLines(); err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		var message Pop3Message
+		var fields = strings.Fields(line)
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf(`invalid UIDL line "%s"`, line)
+		}
+		if message.Number, err = strconv.Atoi(fields[0]); err != nil || message.Number < 1 {
+			return nil, fmt.Errorf(`invalid UIDL line "%s": invalid message number`, line)
+		}
+		message.Uid = fields[1]
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// Top Returns the header of an email (TOP), without its body.
+func (c *Pop3Client) Top(number int) ([]byte, error) {
+	var err error
+
+	if _, err = c.command("TOP %d 0", number); err != nil {
+		return nil, err
+	}
+	return c.text.ReadDotBytes()
+}
+
+// Retr Returns an email (RETR).
+func (c *Pop3Client) Retr(number int) ([]byte, error) {
+	var err error
+
+	if _, err = c.command("RETR %d", number); err != nil {
+		return nil, err
+	}
+	return c.text.ReadDotBytes()
+}
+
+// Quit Ends the session (QUIT), and closes the connection.
+func (c *Pop3Client) Quit() error {
+	var err error
+
+	_, err = c.command("QUIT")
+	if closeErr := c.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close Closes the connection (without ending the session).
+func (c *Pop3Client) Close() error {
+	return c.text.Close()
+}
+
+// command Sends a command, and returns the text of the reply (after "+OK").
+func (c *Pop3Client) command(format string, args ...interface{}) (string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+	return c.reply()
+}
+
+// reply Reads a reply: a positive reply ("+OK text") gives its text, a negative one ("-ERR text") gives an error.
+func (c *Pop3Client) reply() (string, error) {
+	var err error
+	var line string
+
+	if line, err = c.text.ReadLine(); err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(line, pop3Ok):
+		return strings.TrimSpace(line[len(pop3Ok):]), nil
+	case strings.HasPrefix(line, pop3Err):
+		return "", fmt.Errorf(`the POP3 server replied: %s`, strings.TrimSpace(line[len(pop3Err):]))
+	}
+	return "", fmt.Errorf(`invalid reply from the POP3 server: "%s"`, line)
+}
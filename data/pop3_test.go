@@ -0,0 +1,95 @@
+package data
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakePop3Server Serves a POP3 session on a connection: it holds two emails, and records the commands received.
+func fakePop3Server(connection net.Conn, commands chan string) {
+	var reader = bufio.NewReader(connection)
+	var emails = []string{
+		"From: bill@example.com\r\nSubject: One\r\n\r\nHello\r\n.dot-stuffed line\r\n",
+		"From: jane@example.com\r\nSubject: Two\r\n\r\nBye\r\n",
+	}
+
+	defer close(commands)
+	defer connection.Close()
+	_, _ = connection.Write([]byte("+OK POP3 ready\r\n"))
+	for {
+		var line, err = reader.ReadString('\n')
+		var fields []string
+
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		commands <- line
+		fields = strings.Fields(line)
+		switch fields[0] {
+		case "USER":
+			_, _ = connection.Write([]byte("+OK\r\n"))
+		case "PASS":
+			if fields[1] != "secret" {
+				_, _ = connection.Write([]byte("-ERR invalid password\r\n"))
+				continue
+			}
+			_, _ = connection.Write([]byte("+OK logged in\r\n"))
+		case "UIDL":
+			_, _ = connection.Write([]byte("+OK\r\n1 uid-a\r\n2 uid-b\r\n.\r\n"))
+		case "TOP":
+			_, _ = connection.Write([]byte("+OK\r\nFrom: bill@example.com\r\nSubject: One\r\n\r\n.\r\n"))
+		case "RETR":
+			var email = emails[0]
+			if fields[1] == "2" {
+				email = emails[1]
+			}
+			email = strings.ReplaceAll(email, "\r\n.", "\r\n..")
+			_, _ = connection.Write([]byte("+OK\r\n" + email + ".\r\n"))
+		case "QUIT":
+			_, _ = connection.Write([]byte("+OK bye\r\n"))
+			return
+		default:
+			_, _ = connection.Write([]byte("-ERR unknown command\r\n"))
+		}
+	}
+}
+
+func TestPop3Client(t *testing.T) {
+	var err error
+	var client *Pop3Client
+	var messages []Pop3Message
+	var content []byte
+	var clientConnection, serverConnection = net.Pipe()
+	var commands = make(chan string, 20)
+	var received []string
+
+	go fakePop3Server(serverConnection, commands)
+	client, err = NewPop3Client(clientConnection)
+	assert.Nil(t, err)
+
+	assert.NotNil(t, client.Login("john", "wrong"))
+	assert.Nil(t, client.Login("john", "secret"))
+
+	messages, err = client.Uidl()
+	assert.Nil(t, err)
+	assert.Equal(t, []Pop3Message{{Number: 1, Uid: "uid-a"}, {Number: 2, Uid: "uid-b"}}, messages)
+
+	content, err = client.Top(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "From: bill@example.com\nSubject: One\n\n", string(content))
+
+	// The lines that start with a dot are unstuffed.
+	content, err = client.Retr(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "From: bill@example.com\nSubject: One\n\nHello\n.dot-stuffed line\n", string(content))
+
+	assert.Nil(t, client.Quit())
+	for command := range commands {
+		received = append(received, command)
+	}
+	assert.Equal(t, []string{"USER john", "PASS wrong", "USER john", "PASS secret", "UIDL", "TOP 1 0", "RETR 1", "QUIT"}, received)
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package data
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processIsRunning Tells whether a process is running.
+func processIsRunning(pid int) bool {
+	var err error
+	var process *os.Process
+
+	if process, err = os.FindProcess(pid); err != nil {
+		return false
+	}
+	// The signal 0 only checks that the process exists. The process may exist, but belong to another user.
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package data
+
+import (
+	"os"
+)
+
+// processIsRunning Tells whether a process is running.
+func processIsRunning(pid int) bool {
+	var err error
+	var process *os.Process
+
+	// On Windows, the process is opened: this fails if the process does not exist.
+	if process, err = os.FindProcess(pid); err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keywordSpecials The characters a keyword (IMAP) cannot contain (besides the spaces and the control characters).
+const keywordSpecials = `(){%*"\]`
+
+// ProcessedAction What is done with the emails of a hidden message (IMAP), once the message has been shown (see
+// "rcv"): they are marked with a keyword, and/or moved to another mailbox, so that the next receptions skip them. Or
+// they are deleted from the server.
+type ProcessedAction struct {
+	// Mailbox The mailbox the emails are moved to.
+	Mailbox string
+	// Keyword The keyword the emails are marked with (for example "$Decoded").
+	Keyword string
+	// Delete The emails are deleted (expunged).
+	Delete bool
+}
+
+// IsEmpty Tells whether the emails are left as they are.
+func (a ProcessedAction) IsEmpty() bool {
+	return len(a.Mailbox) == 0 && len(a.Keyword) == 0 && !a.Delete
+}
+
+// Validate Checks the action: a keyword is an atom, and it cannot be a system flag (such as "\Seen"). The emails
+// deleted cannot be moved.
+func (a ProcessedAction) Validate() error {
+	if a.Delete && len(a.Mailbox) > 0 {
+		return fmt.Errorf(`the emails cannot be both moved to "%s" and deleted`, a.Mailbox)
+	}
+	for _, c := range a.Keyword {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(keywordSpecials, c) {
+			return fmt.Errorf(`invalid keyword "%s": it cannot contain spaces, control characters, non-ASCII characters or any of %s`, a.Keyword, keywordSpecials)
+		}
+	}
+	return nil
+}
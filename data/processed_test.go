@@ -0,0 +1,21 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProcessedAction(t *testing.T) {
+	assert.True(t, ProcessedAction{}.IsEmpty())
+	assert.False(t, ProcessedAction{Mailbox: "Archive"}.IsEmpty())
+	assert.False(t, ProcessedAction{Keyword: "$Decoded"}.IsEmpty())
+	assert.False(t, ProcessedAction{Delete: true}.IsEmpty())
+
+	assert.Nil(t, ProcessedAction{}.Validate())
+	assert.Nil(t, ProcessedAction{Mailbox: "[Gmail]/All Mail", Keyword: "$Decoded"}.Validate())
+	assert.Nil(t, ProcessedAction{Keyword: "$Decoded", Delete: true}.Validate())
+	assert.NotNil(t, ProcessedAction{Mailbox: "Archive", Delete: true}.Validate())
+	for _, keyword := range []string{"two words", `\Seen`, "(x)", "dé", "a\tb", "x*"} {
+		assert.NotNil(t, ProcessedAction{Keyword: keyword}.Validate(), keyword)
+	}
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ReceiveProfile How the emails of an account are received (see "rcv --save-profile"). The values that are not given
+// are the ones of the command line.
+type ReceiveProfile struct {
+	// Transport How the emails are retrieved: "imap", `TransportPop3`, `TransportJmap`, `TransportGmail` or
+	// `TransportGraph`.
+	Transport string `json:"transport"`
+	// Server and Port The address and the port of the IMAP (or POP3) server.
+	Server string `json:"server,omitempty"`
+	Port   int    `json:"port,omitempty"`
+	// Jmap The URL of the JMAP session resource (see `TransportJmap`).
+	Jmap string `json:"jmap,omitempty"`
+	// Mailbox The mailbox the emails are received in.
+	Mailbox string `json:"mailbox,omitempty"`
+	// Proxy The URL of the SOCKS5 proxy the connections to the IMAP (or POP3) server go through (see `ParseProxy`), if
+	// any.
+	Proxy string `json:"proxy,omitempty"`
+}
+
+// ProfileStore A file that records the receive profiles, by account (the user given to "rcv").
+type ProfileStore struct {
+	path     string
+	profiles map[string]ReceiveProfile
+}
+
+// LoadProfileStore Loads the receive profiles from a file. If the file does not exist, then no profile is recorded.
+func LoadProfileStore(path string) (*ProfileStore, error) {
+	var err error
+	var content []byte
+	var store = ProfileStore{path: path, profiles: map[string]ReceiveProfile{}}
+
+	if content, err = os.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			return &store, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &store.profiles); err != nil {
+		return nil, fmt.Errorf(`invalid profile file "%s": %s`, path, err.Error())
+	}
+	return &store, nil
+}
+
+// Get Returns the receive profile of an account, and whether it is recorded.
+func (s *ProfileStore) Get(account string) (ReceiveProfile, bool) {
+	var profile, ok = s.profiles[account]
+	return profile, ok
+}
+
+// Accounts Returns the accounts whose receive profiles are recorded, in alphabetical order.
+func (s *ProfileStore) Accounts() []string {
+	var accounts []string
+
+	for account := range s.profiles {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// Put Records the receive profile of an account, and writes the file.
+func (s *ProfileStore) Put(account string, profile ReceiveProfile) error {
+	var err error
+	var content []byte
+
+	s.profiles[account] = profile
+	if content, err = json.MarshalIndent(s.profiles, "", "  "); err != nil {
+		return err
+	}
+	return writeAtomically(s.path, content)
+}
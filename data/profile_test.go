@@ -0,0 +1,35 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileStore(t *testing.T) {
+	var err error
+	var store *ProfileStore
+	var profile ReceiveProfile
+	var ok bool
+	var path = filepath.Join(t.TempDir(), "profiles.json")
+	var fastmail = ReceiveProfile{Transport: TransportJmap, Jmap: DefaultJmapSessionURL}
+
+	// The file does not exist yet.
+	store, err = LoadProfileStore(path)
+	assert.Nil(t, err)
+	_, ok = store.Get("john@fastmail.com")
+	assert.False(t, ok)
+	assert.Empty(t, store.Accounts())
+
+	assert.Nil(t, store.Put("john@fastmail.com", fastmail))
+	assert.Nil(t, store.Put("john@posteo.net", ReceiveProfile{Transport: TransportPop3, Server: "posteo.de", Port: 995, Proxy: "socks5h://127.0.0.1:9050"}))
+	store, err = LoadProfileStore(path)
+	assert.Nil(t, err)
+	profile, ok = store.Get("john@fastmail.com")
+	assert.True(t, ok)
+	assert.Equal(t, fastmail, profile)
+	profile, _ = store.Get("john@posteo.net")
+	assert.Equal(t, "posteo.de", profile.Server)
+	assert.Equal(t, "socks5h://127.0.0.1:9050", profile.Proxy)
+	assert.Equal(t, []string{"john@fastmail.com", "john@posteo.net"}, store.Accounts())
+}
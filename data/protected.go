@@ -0,0 +1,173 @@
+package data
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"os"
+)
+
+// protectedMagic The first bytes of a protected (encrypted) session file.
+// Please note that these bytes cannot be confused with a JSON document.
+const protectedMagic = "UMAILSES"
+
+const protectedSaltLength = 16
+const protectedKeyLength = chacha20poly1305.KeySize
+
+// Parameters used to derive the encryption key from the secret (Argon2id).
+const argon2Time = 3
+const argon2Memory = 64 * 1024 // KiB
+const argon2Threads = 4
+
+// The bounds of the parameters read from the header of a protected session file: the header is only authenticated
+// once the key is derived, so a corrupted (or crafted) header must not make the derivation fail, or exhaust the memory.
+const argon2MaxTime = 64
+const argon2MaxMemory = 1024 * 1024 // KiB
+
+// SecretProvider Called when a protected session is loaded to get the secret (a passphrase or the content of a key
+// file).
+// If not set, protected sessions cannot be loaded.
+var SecretProvider func(path string) ([]byte, error)
+
+// protectedHeader The header of a protected session file. It is authenticated (but not encrypted).
+//
+//	magic (8 bytes) | time (uint32) | memory (uint32) | threads (uint8) | salt (16 bytes) | nonce (12 bytes)
+type protectedHeader struct {
+	Magic   [len(protectedMagic)]byte
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	Salt    [protectedSaltLength]byte
+	Nonce   [chacha20poly1305.NonceSize]byte
+}
+
+// protection The parameters used to encrypt a session. The key is derived once, when the session is protected (or
+// loaded).
+type protection struct {
+	header protectedHeader
+	key    []byte
+}
+
+// IsProtected Tells whether a session file is protected.
+func IsProtected(path string) (bool, error) {
+	var err error
+	var content []byte
+
+	if content, err = os.ReadFile(path); err != nil {
+		return false, err
+	}
+	return IsProtectedContent(content), nil
+}
+
+// IsProtectedContent Tells whether the serialized representation of a session (see `Session.Serialize`) is protected.
+func IsProtectedContent(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(protectedMagic))
+}
+
+// newProtection Creates the parameters used to encrypt a session, using a new salt.
+func newProtection(secret []byte) (*protection, error) {
+	var err error
+	var p protection
+
+	copy(p.header.Magic[:], protectedMagic)
+	p.header.Time = argon2Time
+	p.header.Memory = argon2Memory
+	p.header.Threads = argon2Threads
+	if _, err = rand.Read(p.header.Salt[:]); err != nil {
+		return nil, err
+	}
+	p.key = deriveKey(secret, &p.header)
+	return &p, nil
+}
+
+// deriveKey Derives the encryption key from the secret and the parameters stored into the header.
+func deriveKey(secret []byte, header *protectedHeader) []byte {
+	return argon2.IDKey(secret, header.Salt[:], header.Time, header.Memory, header.Threads, protectedKeyLength)
+}
+
+// check Checks the parameters of the key derivation (see `deriveKey`), which are read from the file before they can
+// be authenticated.
+func (h *protectedHeader) check() error {
+	if h.Time < 1 || h.Time > argon2MaxTime {
+		return fmt.Errorf(`invalid header: invalid number of passes (%d, expected 1 to %d)`, h.Time, argon2MaxTime)
+	}
+	if h.Threads < 1 {
+		return fmt.Errorf(`invalid header: invalid number of threads (%d)`, h.Threads)
+	}
+	if h.Memory < 8*uint32(h.Threads) || h.Memory > argon2MaxMemory {
+		return fmt.Errorf(`invalid header: invalid amount of memory (%d KiB, expected %d to %d KiB)`, h.Memory, 8*uint32(h.Threads), argon2MaxMemory)
+	}
+	return nil
+}
+
+// seal Encrypts `plain` (with a new nonce). The returned content starts with the header.
+func (p *protection) seal(plain []byte) ([]byte, error) {
+	var err error
+	var headerBuffer = new(bytes.Buffer)
+	var aead cipher.AEAD
+
+	if _, err = rand.Read(p.header.Nonce[:]); err != nil {
+		return nil, err
+	}
+	if err = binary.Write(headerBuffer, binary.LittleEndian, &p.header); err != nil {
+		return nil, err
+	}
+	if aead, err = chacha20poly1305.New(p.key); err != nil {
+		return nil, err
+	}
+	return aead.Seal(headerBuffer.Bytes(), p.header.Nonce[:], plain, headerBuffer.Bytes()), nil
+}
+
+// openProtected Decrypts the content of a protected session file.
+func openProtected(path string, content []byte, secret []byte) (*protection, []byte, error) {
+	var err error
+	var p protection
+	var headerLength = binary.Size(p.header)
+	var plain []byte
+	var aead cipher.AEAD
+
+	if len(content) < headerLength || string(content[:len(protectedMagic)]) != protectedMagic {
+		return nil, nil, fmt.Errorf(`the session "%s" is not protected`, path)
+	}
+	if err = binary.Read(bytes.NewReader(content[:headerLength]), binary.LittleEndian, &p.header); err != nil {
+		return nil, nil, err
+	}
+	if err = p.header.check(); err != nil {
+		return nil, nil, fmt.Errorf(`cannot decrypt the session "%s": %s`, path, err.Error())
+	}
+	p.key = deriveKey(secret, &p.header)
+	if aead, err = chacha20poly1305.New(p.key); err != nil {
+		return nil, nil, err
+	}
+	if plain, err = aead.Open(nil, p.header.Nonce[:], content[headerLength:], content[:headerLength]); err != nil {
+		return nil, nil, fmt.Errorf(`cannot decrypt the session "%s": wrong secret (or corrupted file)`, path)
+	}
+	return &p, plain, nil
+}
+
+// writeAtomically Writes a file by creating a temporary file and renaming it.
+func writeAtomically(path string, content []byte) error {
+	var err error
+	var fd *os.File
+	var temporaryPath = path + ".tmp"
+
+	if fd, err = os.OpenFile(temporaryPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+		return err
+	}
+	if _, err = fd.Write(content); err != nil {
+		fd.Close()
+		return err
+	}
+	if err = fd.Sync(); err != nil {
+		fd.Close()
+		return err
+	}
+	if err = fd.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, path)
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSessionProtect(t *testing.T) {
+	var err error
+	var session Session
+	var loaded Session
+	var protected bool
+	var content []byte
+	var secret = []byte("correct horse battery staple")
+
+	session.Init("key", 10)
+	session.AddBoundary([]byte{1, 2})
+	err = session.Protect(secret)
+	assert.Nil(t, err)
+	assert.True(t, session.IsProtected())
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+
+	// The file does not reveal the session.
+	protected, err = IsProtected(sessionFile)
+	assert.Nil(t, err)
+	assert.True(t, protected)
+	content, err = os.ReadFile(sessionFile)
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(content), "pool-name"))
+
+	// No secret.
+	err = loaded.Load(sessionFile)
+	assert.NotNil(t, err)
+
+	// Wrong secret.
+	SecretProvider = func(path string) ([]byte, error) {
+		return []byte("wrong secret"), nil
+	}
+	defer func() { SecretProvider = nil }()
+	err = loaded.Load(sessionFile)
+	assert.NotNil(t, err)
+
+	// Good secret: the session stays protected when saved again.
+	SecretProvider = func(path string) ([]byte, error) {
+		return secret, nil
+	}
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.True(t, loaded.IsProtected())
+	assert.Equal(t, "key", loaded.PoolName)
+	assert.Equal(t, int64(10), loaded.PoolPointerPosition)
+	assert.Equal(t, [][]uint8{{1, 2}}, loaded.Boundaries)
+	assert.Nil(t, loaded.Deliveries.SetSent(0, "<1@example.com>"))
+	err = loaded.Save(sessionFile)
+	assert.Nil(t, err)
+	protected, err = IsProtected(sessionFile)
+	assert.Nil(t, err)
+	assert.True(t, protected)
+
+	// Back to plain JSON.
+	loaded = Session{}
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, DeliverySent, loaded.Deliveries[0].Status)
+	loaded.Unprotect()
+	err = loaded.Save(sessionFile)
+	assert.Nil(t, err)
+	protected, err = IsProtected(sessionFile)
+	assert.Nil(t, err)
+	assert.False(t, protected)
+
+	// An empty secret is rejected.
+	err = session.Protect([]byte{})
+	assert.NotNil(t, err)
+}
+
+func TestSessionProtectInvalidHeader(t *testing.T) {
+	var err error
+	var session Session
+	var content []byte
+	var secret = []byte("correct horse battery staple")
+
+	session.Init("key", 10)
+	session.AddBoundary([]byte{1, 2})
+	assert.Nil(t, session.Protect(secret))
+	assert.Nil(t, session.Save(sessionFile))
+	content, err = os.ReadFile(sessionFile)
+	assert.Nil(t, err)
+	SecretProvider = func(path string) ([]byte, error) {
+		return secret, nil
+	}
+	defer func() { SecretProvider = nil }()
+
+	// The parameters of the key derivation are checked before the key is derived (no panic, no memory exhaustion).
+	for _, test := range []struct {
+		name   string
+		offset int
+		value  []byte
+	}{
+		{name: "no pass", offset: 8, value: []byte{0, 0, 0, 0}},
+		{name: "too many passes", offset: 8, value: []byte{0xff, 0xff, 0, 0}},
+		{name: "no memory", offset: 12, value: []byte{0, 0, 0, 0}},
+		{name: "too much memory", offset: 12, value: []byte{0xff, 0xff, 0xff, 0xff}},
+		{name: "no thread", offset: 16, value: []byte{0}},
+	} {
+		var loaded Session
+		var corrupted = append([]byte{}, content...)
+
+		copy(corrupted[test.offset:], test.value)
+		assert.Nil(t, os.WriteFile(sessionFile, corrupted, 0600))
+		assert.NotPanics(t, func() {
+			err = loaded.Load(sessionFile)
+		}, test.name)
+		assert.NotNil(t, err, test.name)
+	}
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// queueExtension The extension of the files that contain the queued emails.
+const queueExtension = ".json"
+
+// QueuedEmail An email that has been rendered (with its boundary), and that waits to be sent by the daemon.
+type QueuedEmail struct {
+	// Id The identifier of the email within the queue (the name of its file, without extension).
+	Id string `json:"-"`
+	// Session The name of the session the email belongs to.
+	Session   string `json:"session"`
+	Recipient string `json:"recipient"`
+	// Copies The recipients of the copies of the email, if any.
+	Copies
+	// Index The index of the boundary of the email within the session.
+	Index int `json:"index"`
+	// Account The account used to send the email.
+	Account  Account `json:"account"`
+	OAuth    bool    `json:"oauth,omitempty"`
+	Insecure bool    `json:"insecure,omitempty"`
+	// MessageID The value of the "Message-ID" header of the email.
+	MessageID string `json:"message-id"`
+	// BodyFile The file that contains the body of the email (recorded into the journal of the session once sent).
+	BodyFile string `json:"body-file,omitempty"`
+	// Message The email (RFC 5322), as it will be sent.
+	Message  string    `json:"message"`
+	Enqueued time.Time `json:"enqueued"`
+	// NotBefore The email must not be sent before this date (set after a transient failure).
+	NotBefore time.Time `json:"not-before"`
+	// Attempts The number of attempts made so far.
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last-error,omitempty"`
+}
+
+// Queue A directory that contains the emails waiting to be sent (one file per email). The emails are sent in the order
+// they have been queued.
+type Queue struct {
+	Dir string
+}
+
+// NewQueue Creates a queue. The directory is created if it does not exist.
+func NewQueue(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf(`cannot create the queue directory "%s": %s`, dir, err.Error())
+	}
+	return &Queue{Dir: dir}, nil
+}
+
+// Add Adds an email to the queue, and sets its identifier.
+func (q *Queue) Add(email *QueuedEmail) error {
+	var err error
+	var random = make([]byte, 4)
+
+	if _, err = rand.Read(random); err != nil {
+		return err
+	}
+	email.Enqueued = time.Now().UTC()
+	// The identifiers are sorted in the order the emails are queued.
+	email.Id = fmt.Sprintf("%020d-%s", email.Enqueued.UnixNano(), hex.EncodeToString(random))
+	return q.Update(email)
+}
+
+// Update Writes the state of a queued email.
+func (q *Queue) Update(email *QueuedEmail) error {
+	var err error
+	var content []byte
+
+	if content, err = json.MarshalIndent(email, "", "  "); err != nil {
+		return err
+	}
+	return writeAtomically(q.path(email.Id), content)
+}
+
+// Remove Removes an email from the queue.
+func (q *Queue) Remove(id string) error {
+	return os.Remove(q.path(id))
+}
+
+// List Returns the queued emails, in the order they have been queued.
+func (q *Queue) List() ([]*QueuedEmail, error) {
+	var err error
+	var entries []os.DirEntry
+	var names []string
+	var result []*QueuedEmail
+
+	if entries, err = os.ReadDir(q.Dir); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), queueExtension) {
+			names = append(names, strings.TrimSuffix(entry.Name(), queueExtension))
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var content []byte
+		var email QueuedEmail
+
+		if content, err = os.ReadFile(q.path(name)); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(content, &email); err != nil {
+			return nil, fmt.Errorf(`invalid queued email "%s": %s`, q.path(name), err.Error())
+		}
+		email.Id = name
+		result = append(result, &email)
+	}
+	return result, nil
+}
+
+// path Returns the path to the file that contains a queued email.
+func (q *Queue) path(id string) string {
+	return filepath.Join(q.Dir, id+queueExtension)
+}
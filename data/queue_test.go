@@ -0,0 +1,65 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	var err error
+	var queue *Queue
+	var emails []*QueuedEmail
+	var info os.FileInfo
+	var dir = filepath.Join(t.TempDir(), "queue")
+	var first = QueuedEmail{Session: "s", Recipient: "a@x.com", Index: 0, Message: "To: a@x.com\r\n\r\nA"}
+	var second = QueuedEmail{Session: "s", Recipient: "b@x.com", Index: 1, Message: "To: b@x.com\r\n\r\nB"}
+
+	if queue, err = NewQueue(dir); err != nil {
+		assert.FailNow(t, err.Error())
+	}
+	emails, err = queue.List()
+	assert.Nil(t, err)
+	assert.Empty(t, emails)
+
+	assert.Nil(t, queue.Add(&first))
+	assert.Nil(t, queue.Add(&second))
+	assert.NotEqual(t, first.Id, second.Id)
+	assert.False(t, first.Enqueued.IsZero())
+	if info, err = os.Stat(filepath.Join(dir, first.Id+queueExtension)); err != nil {
+		assert.FailNow(t, err.Error())
+	}
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The emails are listed in the order they have been queued.
+	emails, err = queue.List()
+	assert.Nil(t, err)
+	if assert.Len(t, emails, 2) {
+		assert.Equal(t, first.Id, emails[0].Id)
+		assert.Equal(t, "a@x.com", emails[0].Recipient)
+		assert.Equal(t, first.Message, emails[0].Message)
+		assert.Equal(t, second.Id, emails[1].Id)
+	}
+
+	// Update.
+	emails[0].Attempts = 1
+	emails[0].LastError = "451 try again later"
+	emails[0].NotBefore = time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	assert.Nil(t, queue.Update(emails[0]))
+	emails, err = queue.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, emails[0].Attempts)
+	assert.Equal(t, "451 try again later", emails[0].LastError)
+	assert.False(t, emails[0].NotBefore.IsZero())
+
+	// Remove.
+	assert.Nil(t, queue.Remove(first.Id))
+	emails, err = queue.List()
+	assert.Nil(t, err)
+	if assert.Len(t, emails, 1) {
+		assert.Equal(t, second.Id, emails[0].Id)
+	}
+	assert.NotNil(t, queue.Remove(first.Id))
+}
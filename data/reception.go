@@ -0,0 +1,76 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Reception The chunks of a hidden message received from a correspondent, accumulated as the emails arrive, until the
+// message is complete (see "rcv --watch"). A watch that is interrupted resumes the reception where it stopped.
+type Reception struct {
+	// Mailbox The state of the mailbox once the emails of the reception have been processed.
+	Mailbox MailboxState `json:"mailbox"`
+	// Preamble The synchronization preamble (see "send --sync"), if the first email is expected to carry one.
+	Preamble []byte `json:"preamble,omitempty"`
+	// Chunks The boundaries of the emails (converted into bytes), in the order of their arrival.
+	Chunks [][]byte `json:"chunks"`
+	// Uids The UIDs of the emails (the preamble included), so that they can be processed once the message is complete
+	// (see `ProcessedAction`).
+	Uids []uint32 `json:"uids,omitempty"`
+}
+
+// ReceptionStore A file that records the receptions in progress, by mailbox (see `MailboxName`).
+type ReceptionStore struct {
+	path       string
+	receptions map[string]*Reception
+}
+
+// LoadReceptionStore Loads the receptions in progress from a file. If the file does not exist, then no reception is in
+// progress.
+func LoadReceptionStore(path string) (*ReceptionStore, error) {
+	var err error
+	var content []byte
+	var store = ReceptionStore{path: path, receptions: map[string]*Reception{}}
+
+	if content, err = os.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			return &store, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &store.receptions); err != nil {
+		return nil, fmt.Errorf(`invalid reception file "%s": %s`, path, err.Error())
+	}
+	return &store, nil
+}
+
+// Get Returns the reception in progress for a mailbox, or nil if none is in progress.
+func (s *ReceptionStore) Get(name string) *Reception {
+	return s.receptions[name]
+}
+
+// Put Records the reception in progress for a mailbox, and writes the file.
+func (s *ReceptionStore) Put(name string, reception *Reception) error {
+	s.receptions[name] = reception
+	return s.write()
+}
+
+// Remove Forgets the reception for a mailbox (the message is complete), and writes the file.
+func (s *ReceptionStore) Remove(name string) error {
+	if _, ok := s.receptions[name]; !ok {
+		return nil
+	}
+	delete(s.receptions, name)
+	return s.write()
+}
+
+func (s *ReceptionStore) write() error {
+	var err error
+	var content []byte
+
+	if content, err = json.MarshalIndent(s.receptions, "", "  "); err != nil {
+		return err
+	}
+	return writeAtomically(s.path, content)
+}
@@ -0,0 +1,36 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestReceptionStore(t *testing.T) {
+	var err error
+	var store *ReceptionStore
+	var path = filepath.Join(t.TempDir(), "receptions.json")
+	var name = MailboxName("john@example.com", "imap.example.com", 993, "INBOX", EmailFilter{From: "bill@example.com"})
+	var reception = Reception{
+		Mailbox:  MailboxState{UidValidity: 42, LastUid: 17},
+		Preamble: []byte{1, 2, 3},
+		Chunks:   [][]byte{{4, 5}, {6, 7, 8}},
+		Uids:     []uint32{3, 9, 12},
+	}
+
+	// The file does not exist yet.
+	store, err = LoadReceptionStore(path)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Get(name))
+	assert.Nil(t, store.Remove(name))
+
+	assert.Nil(t, store.Put(name, &reception))
+	store, err = LoadReceptionStore(path)
+	assert.Nil(t, err)
+	assert.Equal(t, &reception, store.Get(name))
+
+	assert.Nil(t, store.Remove(name))
+	store, err = LoadReceptionStore(path)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Get(name))
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"syscall"
+	"time"
+)
+
+// maxBackoffDelay The maximum time to wait before an attempt to send an email (without the jitter): the delay stops
+// doubling once it is reached.
+const maxBackoffDelay = time.Hour
+
+// IsTransient Tells whether an error that occurred while sending an email may not happen again: a 4xx reply from the
+// SMTP server, or a network error (timeout, connexion reset...).
+func IsTransient(err error) bool {
+	var protocolErr *textproto.Error
+	var dnsErr *net.DNSError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &protocolErr):
+		return protocolErr.Code >= 400 && protocolErr.Code < 500
+	case errors.As(err, &dnsErr):
+		return !dnsErr.IsNotFound
+	case errors.As(err, &netErr):
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// BackoffDelay Returns the time to wait before the next attempt (`attempt` starts at 1): the delay is doubled after
+// each attempt, up to `maxBackoffDelay`, and a random jitter (up to half the delay) is added, so that the attempts do
+// not follow a recognizable pattern. The function `random` returns a random number in [0, n).
+func BackoffDelay(delay time.Duration, attempt int, random func(n int) int) time.Duration {
+	var base = delay
+
+	for i := 1; i < attempt && base < maxBackoffDelay; i++ {
+		base *= 2
+	}
+	if base > maxBackoffDelay {
+		base = maxBackoffDelay
+	}
+	if base <= 0 {
+		return 0
+	}
+	return base + time.Duration(random(int(base/2)+1))
+}
@@ -0,0 +1,68 @@
+package data
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	var tests = []struct {
+		err       error
+		transient bool
+	}{
+		{&textproto.Error{Code: 421, Msg: "Service not available"}, true},
+		{&textproto.Error{Code: 451, Msg: "Try again later"}, true},
+		{&textproto.Error{Code: 550, Msg: "Mailbox unavailable"}, false},
+		{fmt.Errorf(`cannot send the email: %w`, &textproto.Error{Code: 452, Msg: "Insufficient storage"}), true},
+		{&net.DNSError{Err: "no such host", Name: "smtp.example.com", IsNotFound: true}, false},
+		{&net.DNSError{Err: "server misbehaving", Name: "smtp.example.com", IsTemporary: true}, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+		{io.EOF, true},
+		{fmt.Errorf(`cannot read the reply: %w`, io.ErrUnexpectedEOF), true},
+		{net.ErrClosed, true},
+		{syscall.ECONNRESET, true},
+		{syscall.EPIPE, true},
+		{fmt.Errorf(`invalid recipient`), false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.transient, IsTransient(test.err), test.err.Error())
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	var none = func(n int) int {
+		return 0
+	}
+	var highest = func(n int) int {
+		assert.Greater(t, n, 0)
+		return n - 1
+	}
+	var tests = []struct {
+		delay    time.Duration
+		attempt  int
+		expected time.Duration
+	}{
+		{10 * time.Second, 1, 10 * time.Second},
+		{10 * time.Second, 2, 20 * time.Second},
+		{10 * time.Second, 4, 80 * time.Second},
+		{0, 5, 0},
+		// The delay stops doubling once it reaches the maximum.
+		{10 * time.Second, 12, maxBackoffDelay},
+		{10 * time.Second, 1000, maxBackoffDelay},
+		{3 * time.Hour, 1, maxBackoffDelay},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, BackoffDelay(test.delay, test.attempt, none), test)
+		// The jitter is up to half the delay.
+		assert.Equal(t, test.expected+test.expected/2, BackoffDelay(test.delay, test.attempt, highest), test)
+	}
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// KeyRange A range of key material used by a hidden message that has been decoded: from `Start` (included) to `End`
+// (excluded).
+type KeyRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// Message The SHA-256 of the hidden message (see `MessageHash`).
+	Message string `json:"message"`
+}
+
+// Overlaps Tells whether two ranges of key material have bytes in common.
+func (r KeyRange) Overlaps(other KeyRange) bool {
+	return r.Start < other.End && other.Start < r.End
+}
+
+// ReuseIndex A file that records the boundaries received and the ranges of key material used by the hidden messages
+// decoded, so that a reuse of the key material by the sender is detected (see "rcv"): two emails that carry the same
+// boundary, or two different messages decoded from overlapping ranges of the same key. Either way, the one-time pad is
+// compromised.
+type ReuseIndex struct {
+	path    string
+	content reuseContent
+}
+
+type reuseContent struct {
+	// Boundaries The emails seen, by boundary (hexadecimal): the date the email was sent (see `EmailIdentity`).
+	Boundaries map[string]string `json:"boundaries"`
+	// Ranges The ranges of key material used by the messages decoded, by key name.
+	Ranges map[string][]KeyRange `json:"ranges"`
+}
+
+// LoadReuseIndex Loads the index from a file. If the file does not exist, then the index is empty.
+func LoadReuseIndex(path string) (*ReuseIndex, error) {
+	var err error
+	var content []byte
+	var index = ReuseIndex{path: path}
+
+	if content, err = os.ReadFile(path); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else if err = json.Unmarshal(content, &index.content); err != nil {
+		return nil, fmt.Errorf(`invalid reuse index "%s": %s`, path, err.Error())
+	}
+	if index.content.Boundaries == nil {
+		index.content.Boundaries = map[string]string{}
+	}
+	if index.content.Ranges == nil {
+		index.content.Ranges = map[string][]KeyRange{}
+	}
+	return &index, nil
+}
+
+// RecordBoundary Records the boundary (bytes) of an email, identified by `email` (see `EmailIdentity`). If another
+// email already carried the same boundary, then its identity is returned, and true. The same email seen again (for
+// example, a copy received by another account, or an email listed again) is not a reuse.
+func (x *ReuseIndex) RecordBoundary(boundary []byte, email string) (string, bool) {
+	var name = hex.EncodeToString(boundary)
+
+	if other, ok := x.content.Boundaries[name]; ok {
+		return other, other != email
+	}
+	x.content.Boundaries[name] = email
+	return "", false
+}
+
+// RecordRange Records the range of key material used by a message decoded with a key, and returns the ranges of the
+// other messages (decoded before) it overlaps, if any. The same message decoded again is not a reuse.
+func (x *ReuseIndex) RecordRange(keyName string, keyRange KeyRange) []KeyRange {
+	var overlaps []KeyRange
+	var known bool
+
+	for _, other := range x.content.Ranges[keyName] {
+		if other.Message == keyRange.Message {
+			known = known || other == keyRange
+			continue
+		}
+		if other.Overlaps(keyRange) {
+			overlaps = append(overlaps, other)
+		}
+	}
+	if known {
+		return overlaps
+	}
+	x.content.Ranges[keyName] = append(x.content.Ranges[keyName], keyRange)
+	sort.Slice(x.content.Ranges[keyName], func(i, j int) bool {
+		return x.content.Ranges[keyName][i].Start < x.content.Ranges[keyName][j].Start
+	})
+	return overlaps
+}
+
+// Save Writes the index.
+func (x *ReuseIndex) Save() error {
+	var err error
+	var content []byte
+
+	if content, err = json.MarshalIndent(x.content, "", "  "); err != nil {
+		return err
+	}
+	return writeAtomically(x.path, content)
+}
+
+// EmailIdentity Returns the identity of an email, as recorded by the index: the date it was sent, or "unknown" (zero).
+// The copies of an email share its identity.
+func EmailIdentity(sent time.Time) string {
+	if sent.IsZero() {
+		return "unknown"
+	}
+	return sent.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReuseIndex(t *testing.T) {
+	var err error
+	var index *ReuseIndex
+	var path = filepath.Join(t.TempDir(), "reuse.json")
+	var sent = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	var other string
+	var reused bool
+	var overlaps []KeyRange
+
+	assert.Equal(t, "unknown", EmailIdentity(time.Time{}))
+	assert.Equal(t, "2024-03-01T10:00:00Z", EmailIdentity(sent.In(time.FixedZone("CET", 3600))))
+
+	// The file does not exist yet.
+	index, err = LoadReuseIndex(path)
+	assert.Nil(t, err)
+	_, reused = index.RecordBoundary([]byte{1, 2, 3}, EmailIdentity(sent))
+	assert.False(t, reused)
+	// The same email (or a copy of it) is seen again.
+	_, reused = index.RecordBoundary([]byte{1, 2, 3}, EmailIdentity(sent))
+	assert.False(t, reused)
+	assert.Empty(t, index.RecordRange("test", KeyRange{Start: 10, End: 50, Message: "m1"}))
+	assert.Empty(t, index.RecordRange("test", KeyRange{Start: 10, End: 50, Message: "m1"}))
+	assert.Empty(t, index.RecordRange("test", KeyRange{Start: 50, End: 90, Message: "m2"}))
+	assert.Empty(t, index.RecordRange("other", KeyRange{Start: 10, End: 50, Message: "m3"}))
+	assert.Nil(t, index.Save())
+
+	index, err = LoadReuseIndex(path)
+	assert.Nil(t, err)
+	// Another email carries the same boundary.
+	other, reused = index.RecordBoundary([]byte{1, 2, 3}, EmailIdentity(sent.Add(time.Minute)))
+	assert.True(t, reused)
+	assert.Equal(t, EmailIdentity(sent), other)
+	_, reused = index.RecordBoundary([]byte{1, 2, 4}, EmailIdentity(sent.Add(time.Minute)))
+	assert.False(t, reused)
+	// Another message uses key material already used.
+	overlaps = index.RecordRange("test", KeyRange{Start: 40, End: 60, Message: "m4"})
+	assert.Equal(t, []KeyRange{{Start: 10, End: 50, Message: "m1"}, {Start: 50, End: 90, Message: "m2"}}, overlaps)
+	assert.Empty(t, index.RecordRange("test", KeyRange{Start: 90, End: 100, Message: "m5"}))
+	// The reuse is reported again when one of the messages is decoded again.
+	overlaps = index.RecordRange("test", KeyRange{Start: 10, End: 50, Message: "m1"})
+	assert.Equal(t, []KeyRange{{Start: 40, End: 60, Message: "m4"}}, overlaps)
+
+	// We'll get errors...
+	assert.Nil(t, writeAtomically(path, []byte("{")))
+	_, err = LoadReuseIndex(path)
+	assert.NotNil(t, err)
+}
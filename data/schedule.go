@@ -0,0 +1,157 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window A daily time window (local time), such as "08:00-20:00". If the end precedes the start, then the window
+// spans midnight (for example, "22:00-06:00"). The zero value represents the whole day.
+type Window struct {
+	// Start The start of the window, relatively to midnight.
+	Start time.Duration
+	// End The end of the window (excluded), relatively to midnight.
+	End time.Duration
+}
+
+// ParseWindow Parses a time window ("HH:MM-HH:MM"). An empty string represents the whole day.
+func ParseWindow(spec string) (Window, error) {
+	var err error
+	var window Window
+	var bounds []string
+
+	if len(spec) == 0 {
+		return window, nil
+	}
+	if bounds = strings.Split(spec, "-"); len(bounds) != 2 {
+		return window, fmt.Errorf(`invalid time window "%s" (expected "HH:MM-HH:MM")`, spec)
+	}
+	if window.Start, err = parseTimeOfDay(bounds[0]); err != nil {
+		return window, fmt.Errorf(`invalid time window "%s": %s`, spec, err.Error())
+	}
+	if window.End, err = parseTimeOfDay(bounds[1]); err != nil {
+		return window, fmt.Errorf(`invalid time window "%s": %s`, spec, err.Error())
+	}
+	if window.Start == window.End {
+		return window, fmt.Errorf(`invalid time window "%s": the window is empty`, spec)
+	}
+	return window, nil
+}
+
+// parseTimeOfDay Parses a time of the day ("HH:MM"), and returns its offset relatively to midnight.
+func parseTimeOfDay(spec string) (time.Duration, error) {
+	var err error
+	var value time.Time
+
+	if value, err = time.Parse("15:04", strings.TrimSpace(spec)); err != nil {
+		return 0, fmt.Errorf(`invalid time "%s" (expected "HH:MM")`, spec)
+	}
+	return time.Duration(value.Hour())*time.Hour + time.Duration(value.Minute())*time.Minute, nil
+}
+
+// Contains Tells whether a date is within the window.
+func (w Window) Contains(date time.Time) bool {
+	var offset = date.Sub(midnight(date))
+
+	switch {
+	case w.Start == w.End:
+		return true
+	case w.Start < w.End:
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// NextStart Returns the first date, after a given date, at which the window opens (the date itself if it is within
+// the window).
+func (w Window) NextStart(date time.Time) time.Time {
+	var start time.Time
+
+	if w.Contains(date) {
+		return date
+	}
+	start = midnight(date).Add(w.Start)
+	if start.Before(date) {
+		start = midnight(date).AddDate(0, 0, 1).Add(w.Start)
+	}
+	return start
+}
+
+// String Returns the representation of the window ("HH:MM-HH:MM", or "always").
+func (w Window) String() string {
+	if w.Start == w.End {
+		return "always"
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", int(w.Start.Hours()), int(w.Start.Minutes())%60, int(w.End.Hours()), int(w.End.Minutes())%60)
+}
+
+// midnight Returns the beginning of the day of a date (local time of the date).
+func midnight(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+}
+
+// Schedule The dates at which the emails of a session are due. The command "send --due" only sends the emails whose
+// date has passed, so that a periodic job (such as a cron job) produces a natural looking traffic.
+type Schedule struct {
+	// Every The number of days between two emails.
+	Every int `json:"every"`
+	// Window The daily time window the emails are due within ("HH:MM-HH:MM"), or empty for the whole day.
+	Window string `json:"window,omitempty"`
+	// Due The due dates of the emails, one per boundary. The date is zero for the emails that had already been sent
+	// when the schedule was drawn.
+	Due []time.Time `json:"due"`
+}
+
+// NewSchedule Draws the due dates of the emails of a session that contains `count` boundaries: the email at index
+// `first` is due on the day of `start`, and the following ones every `every` days, at random times within a window.
+// The function `random` returns a random number in [0, n).
+func NewSchedule(start time.Time, every int, window Window, first int, count int, random func(n int) int) (*Schedule, error) {
+	var schedule = Schedule{Every: every, Due: make([]time.Time, count)}
+
+	if every < 1 {
+		return nil, fmt.Errorf(`invalid schedule: the number of days between two emails must be at least 1 (%d)`, every)
+	}
+	if first < 0 || first > count {
+		return nil, fmt.Errorf(`invalid schedule: invalid index of the first email (%d)`, first)
+	}
+	if window.Start != window.End {
+		schedule.Window = window.String()
+	}
+	for i := first; i < count; i++ {
+		schedule.Due[i] = window.Draw(midnight(start).AddDate(0, 0, (i-first)*every), random)
+	}
+	return &schedule, nil
+}
+
+// IsDue Tells whether the email that carries the boundary at a given index is due at a given date.
+func (s *Schedule) IsDue(index int, date time.Time) bool {
+	return index >= 0 && index < len(s.Due) && !date.Before(s.Due[index])
+}
+
+// validate Checks the schedule of a session that contains a given number of boundaries.
+func (s *Schedule) validate(count int) error {
+	var err error
+
+	if s.Every < 1 {
+		return fmt.Errorf(`invalid number of days between two emails (%d)`, s.Every)
+	}
+	if _, err = ParseWindow(s.Window); err != nil {
+		return err
+	}
+	if len(s.Due) != count {
+		return fmt.Errorf(`%d due dates for %d boundaries`, len(s.Due), count)
+	}
+	return nil
+}
+
+// Draw Returns a random date within the window, on a given day. If the window spans midnight, then the date may be on
+// the next day.
+func (w Window) Draw(day time.Time, random func(n int) int) time.Time {
+	var length = w.End - w.Start
+
+	if length <= 0 {
+		length += 24 * time.Hour
+	}
+	return midnight(day).Add(w.Start + time.Duration(random(int(length/time.Second)))*time.Second)
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	var err error
+	var window Window
+
+	window, err = ParseWindow("")
+	assert.Nil(t, err)
+	assert.Equal(t, "always", window.String())
+
+	window, err = ParseWindow("08:30-20:00")
+	assert.Nil(t, err)
+	assert.Equal(t, 8*time.Hour+30*time.Minute, window.Start)
+	assert.Equal(t, 20*time.Hour, window.End)
+	assert.Equal(t, "08:30-20:00", window.String())
+
+	for _, spec := range []string{"08:00", "8h-20h", "08:00-25:00", "08:00-08:00", "08:00-10:00-12:00"} {
+		_, err = ParseWindow(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	var window Window
+	var day = func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 12, hour, minute, 0, 0, time.UTC)
+	}
+
+	// The whole day.
+	assert.True(t, window.Contains(day(3, 0)))
+	assert.Equal(t, day(3, 0), window.NextStart(day(3, 0)))
+
+	window, _ = ParseWindow("08:00-20:00")
+	assert.False(t, window.Contains(day(7, 59)))
+	assert.True(t, window.Contains(day(8, 0)))
+	assert.True(t, window.Contains(day(19, 59)))
+	assert.False(t, window.Contains(day(20, 0)))
+	assert.Equal(t, day(8, 0), window.NextStart(day(3, 0)))
+	assert.Equal(t, day(12, 0), window.NextStart(day(12, 0)))
+	assert.Equal(t, day(8, 0).AddDate(0, 0, 1), window.NextStart(day(21, 0)))
+
+	// A window that spans midnight.
+	window, _ = ParseWindow("22:00-06:00")
+	assert.True(t, window.Contains(day(23, 0)))
+	assert.True(t, window.Contains(day(1, 0)))
+	assert.False(t, window.Contains(day(6, 0)))
+	assert.False(t, window.Contains(day(12, 0)))
+	assert.Equal(t, day(22, 0), window.NextStart(day(12, 0)))
+}
+
+func TestNewSchedule(t *testing.T) {
+	var err error
+	var schedule *Schedule
+	var window, _ = ParseWindow("09:00-18:00")
+	var start = time.Date(2024, 3, 12, 15, 30, 0, 0, time.UTC)
+	var lowest = func(n int) int { return 0 }
+	var highest = func(n int) int { return n - 1 }
+
+	// One email every 2 days, the first email has already been sent.
+	schedule, err = NewSchedule(start, 2, window, 1, 4, lowest)
+	assert.Nil(t, err)
+	assert.Equal(t, "09:00-18:00", schedule.Window)
+	assert.True(t, schedule.Due[0].IsZero())
+	assert.Equal(t, time.Date(2024, 3, 12, 9, 0, 0, 0, time.UTC), schedule.Due[1])
+	assert.Equal(t, time.Date(2024, 3, 14, 9, 0, 0, 0, time.UTC), schedule.Due[2])
+	assert.Equal(t, time.Date(2024, 3, 16, 9, 0, 0, 0, time.UTC), schedule.Due[3])
+	assert.Nil(t, schedule.validate(4))
+	assert.NotNil(t, schedule.validate(5))
+
+	assert.True(t, schedule.IsDue(0, start))
+	assert.True(t, schedule.IsDue(1, start))
+	assert.False(t, schedule.IsDue(2, start))
+	assert.True(t, schedule.IsDue(2, start.AddDate(0, 0, 2)))
+	assert.False(t, schedule.IsDue(4, start))
+
+	// The last second of the window.
+	schedule, err = NewSchedule(start, 1, window, 0, 1, highest)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2024, 3, 12, 17, 59, 59, 0, time.UTC), schedule.Due[0])
+
+	// A window that spans midnight, and the whole day.
+	window, _ = ParseWindow("22:00-06:00")
+	assert.Equal(t, time.Date(2024, 3, 13, 5, 59, 59, 0, time.UTC), window.Draw(start, highest))
+	schedule, err = NewSchedule(start, 1, Window{}, 0, 1, highest)
+	assert.Nil(t, err)
+	assert.Equal(t, "", schedule.Window)
+	assert.Equal(t, time.Date(2024, 3, 12, 23, 59, 59, 0, time.UTC), schedule.Due[0])
+
+	_, err = NewSchedule(start, 0, window, 0, 1, lowest)
+	assert.NotNil(t, err)
+	_, err = NewSchedule(start, 1, window, 2, 1, lowest)
+	assert.NotNil(t, err)
+}
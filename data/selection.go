@@ -0,0 +1,90 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// selectAll The selection of all the emails listed.
+const selectAll = "all"
+
+// ParseEmailSelection Parses the emails selected by the user among the emails listed (given by their indexes): a list
+// of indexes and ranges of indexes, separated by commas or spaces ("1 3 7-9", "1,3,7-9"), or "all". An index given
+// alone must be listed; a range selects the emails listed within it (the indexes listed are not contiguous), and at
+// least one. The indexes selected are returned in increasing order, without duplicates.
+func ParseEmailSelection(text string, listed []uint32) ([]uint32, error) {
+	var err error
+	var selected = map[uint32]bool{}
+	var known = map[uint32]bool{}
+	var indexes []uint32
+	var items []string
+
+	for _, index := range listed {
+		known[index] = true
+	}
+	items = strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c)
+	})
+	if len(items) == 0 {
+		return nil, fmt.Errorf(`no email selected`)
+	}
+	for _, item := range items {
+		var first, last uint32
+		var count int
+
+		if item == selectAll {
+			for _, index := range listed {
+				selected[index] = true
+			}
+			continue
+		}
+		if bounds := strings.SplitN(item, "-", 2); len(bounds) == 2 {
+			if first, err = parseEmailIndex(bounds[0]); err != nil {
+				return nil, err
+			}
+			if last, err = parseEmailIndex(bounds[1]); err != nil {
+				return nil, err
+			}
+			if first > last {
+				return nil, fmt.Errorf(`invalid range of emails (%s): the first index is greater than the last one`, item)
+			}
+			for _, index := range listed {
+				if index >= first && index <= last {
+					selected[index] = true
+					count++
+				}
+			}
+			if count == 0 {
+				return nil, fmt.Errorf(`no email listed in the range %s`, item)
+			}
+			continue
+		}
+		if first, err = parseEmailIndex(item); err != nil {
+			return nil, err
+		}
+		if !known[first] {
+			return nil, fmt.Errorf(`unexpected email index (%d): it is not listed`, first)
+		}
+		selected[first] = true
+	}
+	for index := range selected {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i] < indexes[j]
+	})
+	return indexes, nil
+}
+
+func parseEmailIndex(text string) (uint32, error) {
+	var err error
+	var index uint64
+
+	if index, err = strconv.ParseUint(text, 10, 32); err != nil {
+		return 0, fmt.Errorf(`invalid email index (%s). It should be an integer`, text)
+	}
+	return uint32(index), nil
+}
@@ -0,0 +1,34 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseEmailSelection(t *testing.T) {
+	var err error
+	var selected []uint32
+	var listed = []uint32{1, 2, 3, 5, 7, 8, 9, 12}
+
+	for text, expected := range map[string][]uint32{
+		"3 1 2":         {1, 2, 3},
+		"1-5":           {1, 2, 3, 5},
+		"1,3,7-9":       {1, 3, 7, 8, 9},
+		" 1 , 3  7-9\n": {1, 3, 7, 8, 9},
+		"ALL":           listed,
+		"all 3":         listed,
+		"2-3 3 3-5 5":   {2, 3, 5},
+		"10-20":         {12},
+		"7-7":           {7},
+	} {
+		selected, err = ParseEmailSelection(text, listed)
+		assert.Nil(t, err, text)
+		assert.Equal(t, expected, selected, text)
+	}
+
+	// We'll get errors...
+	for _, text := range []string{"", " , ", "4", "1 x", "1-", "-3", "5-1", "13-20", "1-2-3", "-1"} {
+		_, err = ParseEmailSelection(text, listed)
+		assert.NotNil(t, err, text)
+	}
+}
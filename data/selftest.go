@@ -0,0 +1,44 @@
+package data
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"umail/resource"
+)
+
+// ReceivedBoundary Returns the bytes of the boundary of an email sent to oneself (see "selftest"), given the boundaries
+// found at the levels of the email once received (see `NestedBoundaries`). They must match the boundary sent.
+func ReceivedBoundary(sent []byte, levels []string) ([]byte, error) {
+	var err error
+	var boundary []byte
+
+	for _, level := range levels {
+		var levelBytes []byte
+		if levelBytes, err = ParseBoundary(level); err != nil {
+			return nil, fmt.Errorf(`the boundary has been altered (invalid boundary "%s": %s)`, level, err.Error())
+		}
+		boundary = append(boundary, levelBytes...)
+	}
+	if !bytes.Equal(boundary, sent) {
+		return nil, fmt.Errorf(`the boundary has been altered (sent "%s", received "%s")`, hex.EncodeToString(sent), strings.Join(levels, " "))
+	}
+	return boundary, nil
+}
+
+// CheckDecoded Decodes the boundaries of the emails sent to oneself (see "selftest"), and checks that the result is
+// the original message, authenticated.
+func CheckDecoded(boundaries [][]byte, key resource.KeySource, message []byte) error {
+	var err error
+	var decoded []byte
+	var authenticated bool
+
+	if decoded, authenticated, err = DecodeAuthenticated(boundaries, key); err != nil {
+		return fmt.Errorf(`cannot decode the boundaries: %s`, err.Error())
+	}
+	if !authenticated || !bytes.Equal(decoded, message) {
+		return fmt.Errorf(`the decoded message does not match the original message`)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"umail/resource"
+)
+
+func TestReceivedBoundary(t *testing.T) {
+	var sent = []byte{0x01, 0x02, 0x03, 0x04}
+	var thunderbird string
+	var err error
+	var boundary []byte
+
+	thunderbird, err = FormatBoundary(BoundaryThunderbird, sent[2:])
+	assert.Nil(t, err)
+	for _, test := range []struct {
+		levels []string
+		valid  bool
+	}{
+		{levels: []string{"01020304"}, valid: true},
+		// The levels of a nested email are joined, whatever their style.
+		{levels: []string{"0102", thunderbird}, valid: true},
+		{levels: []string{"01020305"}, valid: false},
+		{levels: []string{"0102"}, valid: false},
+		{levels: []string{"not a boundary"}, valid: false},
+		{levels: nil, valid: false},
+	} {
+		boundary, err = ReceivedBoundary(sent, test.levels)
+		if test.valid {
+			assert.Nil(t, err, test.levels)
+			assert.Equal(t, sent, boundary)
+		} else {
+			assert.NotNil(t, err, test.levels)
+		}
+	}
+}
+
+func TestCheckDecoded(t *testing.T) {
+	var err error
+	var pad = make([]byte, 256)
+	var key resource.KeySource
+	var boundaries [][]byte
+	var message = []byte("umail self-test")
+
+	for i := range pad {
+		pad[i] = byte(i * 7)
+	}
+	key, err = resource.NewMemoryPool(pad, 0)
+	assert.Nil(t, err)
+	boundaries, err = EncodeMessage(message, 35, key, Encoding{Authenticated: true})
+	assert.Nil(t, err)
+
+	key, err = resource.NewMemoryPool(pad, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, CheckDecoded(boundaries, key, message))
+
+	// Another message.
+	key, err = resource.NewMemoryPool(pad, 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, CheckDecoded(boundaries, key, []byte("umail self-test!")))
+
+	// An altered boundary.
+	boundaries[0][0] ^= 0x01
+	key, err = resource.NewMemoryPool(pad, 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, CheckDecoded(boundaries, key, message))
+}
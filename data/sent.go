@@ -0,0 +1,69 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultSentPort The port of the IMAP server (TLS), if the location of the mailbox of the sent emails does not give
+// it.
+const DefaultSentPort = 993
+
+// SentFolder The IMAP mailbox the emails sent are appended to, so that they appear in the mailbox of the sender: the
+// SMTP servers do not keep a copy of the emails they relay.
+type SentFolder struct {
+	// Server The address of the IMAP server.
+	Server string
+	// Port The port of the IMAP server (TLS).
+	Port int
+	// Mailbox The name of the mailbox ("Sent", "[Gmail]/Sent Mail"...).
+	Mailbox string
+	// User The IMAP user. If empty, then the address of the sender is used.
+	User string
+}
+
+// ParseSentFolder Parses the location of the mailbox of the sent emails: "[user@]server[:port]/mailbox" (for example,
+// "imap.example.com/Sent" or "john@example.com@imap.example.com:993/[Gmail]/Sent Mail").
+func ParseSentFolder(spec string) (*SentFolder, error) {
+	var err error
+	var folder = SentFolder{Port: DefaultSentPort}
+	var server string
+	var slash = strings.Index(spec, "/")
+
+	if slash < 0 || len(strings.TrimSpace(spec[slash+1:])) == 0 {
+		return nil, fmt.Errorf(`invalid mailbox "%s" (expected "[user@]server[:port]/mailbox")`, spec)
+	}
+	server, folder.Mailbox = spec[:slash], spec[slash+1:]
+	if at := strings.LastIndex(server, "@"); at >= 0 {
+		folder.User, server = server[:at], server[at+1:]
+	}
+	if colon := strings.LastIndex(server, ":"); colon >= 0 {
+		if folder.Port, err = strconv.Atoi(server[colon+1:]); err != nil || folder.Port <= 0 || folder.Port > 65535 {
+			return nil, fmt.Errorf(`invalid mailbox "%s": invalid port "%s"`, spec, server[colon+1:])
+		}
+		server = server[:colon]
+	}
+	if folder.Server = server; len(folder.Server) == 0 {
+		return nil, fmt.Errorf(`invalid mailbox "%s": the IMAP server must be given`, spec)
+	}
+	return &folder, nil
+}
+
+// Address Returns the address of the IMAP server ("server:port").
+func (f *SentFolder) Address() string {
+	return fmt.Sprintf("%s:%d", f.Server, f.Port)
+}
+
+// CheckSent Checks the mailbox of the sent emails of the account, if any: the emails sent through the APIs are already
+// kept by the servers.
+func (a *Account) CheckSent() error {
+	if len(a.Sent) == 0 {
+		return nil
+	}
+	if a.TransportName() != TransportSmtp {
+		return fmt.Errorf(`the mailbox of the sent emails can only be used with the transport "%s" (the APIs keep a copy of the emails sent)`, TransportSmtp)
+	}
+	_, err := ParseSentFolder(a.Sent)
+	return err
+}
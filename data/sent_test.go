@@ -0,0 +1,29 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseSentFolder(t *testing.T) {
+	var err error
+	var folder *SentFolder
+
+	folder, err = ParseSentFolder("imap.example.com/Sent")
+	assert.Nil(t, err)
+	assert.Equal(t, &SentFolder{Server: "imap.example.com", Port: DefaultSentPort, Mailbox: "Sent"}, folder)
+	assert.Equal(t, "imap.example.com:993", folder.Address())
+
+	folder, err = ParseSentFolder("john@example.com@imap.gmail.com:1993/[Gmail]/Sent Mail")
+	assert.Nil(t, err)
+	assert.Equal(t, &SentFolder{Server: "imap.gmail.com", Port: 1993, Mailbox: "[Gmail]/Sent Mail", User: "john@example.com"}, folder)
+
+	for _, spec := range []string{"", "imap.example.com", "imap.example.com/", "/Sent", "imap.example.com:0/Sent", "imap.example.com:x/Sent"} {
+		_, err = ParseSentFolder(spec)
+		assert.NotNil(t, err, spec)
+	}
+
+	assert.Nil(t, (&Account{SmtpServer: "smtp.example.com", SmtpPort: 465, From: "john@example.com", Sent: "imap.example.com/Sent"}).Validate())
+	assert.NotNil(t, (&Account{SmtpServer: "smtp.example.com", SmtpPort: 465, From: "john@example.com", Sent: "imap.example.com"}).Validate())
+	assert.NotNil(t, (&Account{From: "john@example.com", Transport: TransportGmail, Sent: "imap.example.com/Sent"}).Validate())
+}
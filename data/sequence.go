@@ -0,0 +1,145 @@
+package data
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"umail/resource"
+)
+
+// sequenceHeaderLength The size, in bytes, of the header that starts each chunk of a sequenced message: a magic number
+// (`uint16`), the index of the chunk (`uint16`) and the number of chunks (`uint16`), little endian.
+const sequenceHeaderLength = 6
+
+// sequenceMagic The magic number that starts the header of each chunk of a sequenced message. Decoded using the wrong
+// key material, the header is random: the magic number (and the index of the chunk) will not match.
+const sequenceMagic = 0x5e9a
+
+// sequenceChunks Organizes a message (prefixed by its header) into chunks of `chunkSize` bytes, each chunk starting
+// with a sequence header. The last chunk is padded with zeros.
+func sequenceChunks(message []byte, chunkSize int) ([][]byte, error) {
+	var payloadLength = chunkSize - sequenceHeaderLength
+	var count int
+	var chunks [][]byte
+
+	if payloadLength <= 0 {
+		return nil, fmt.Errorf(`the chunks (%d bytes) are too short to contain a sequence header (%d bytes)`, chunkSize, sequenceHeaderLength)
+	}
+	count = (len(message) + payloadLength - 1) / payloadLength
+	if count > math.MaxUint16 {
+		return nil, fmt.Errorf(`the message is too long to be sequenced (%d chunks, the maximum is %d)`, count, math.MaxUint16)
+	}
+	for i := 0; i < count; i++ {
+		var chunk = make([]byte, chunkSize)
+		var end = (i + 1) * payloadLength
+		if end > len(message) {
+			end = len(message)
+		}
+		binary.LittleEndian.PutUint16(chunk[0:], sequenceMagic)
+		binary.LittleEndian.PutUint16(chunk[2:], uint16(i))
+		binary.LittleEndian.PutUint16(chunk[4:], uint16(count))
+		copy(chunk[sequenceHeaderLength:], message[i*payloadLength:end])
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// decodeSequenced Decrypts the boundaries of a sequenced message, given in any order, using key material read from a
+// given key source (from its current position). The index of each boundary is found by trying the key material of
+// each chunk: the decoded header must match. It returns the decoded chunks (in order, without their headers, as a
+// single list of bytes), and the position of the key material that follows the message.
+// If no boundary is a chunk of a sequenced message, then nil is returned (and no error): the message is not sequenced.
+func decodeSequenced(boundaries [][]byte, key resource.KeySource) ([]byte, int64, error) {
+	var err error
+	var keyLength int64
+	var material []byte
+	var chunkSize int
+	var count = -1
+	var chunks = make(map[int][]byte)
+	var unknown []string
+	var missing []int
+	var clearMessage []byte
+
+	if len(boundaries) == 0 || len(boundaries[0]) <= sequenceHeaderLength {
+		return nil, 0, nil
+	}
+	chunkSize = len(boundaries[0])
+
+	// Read the key material of all the possible chunks, at once.
+	if keyLength, err = key.Length(); err != nil {
+		return nil, 0, err
+	}
+	keyLength -= key.Position()
+	if keyLength > int64(math.MaxUint16)*int64(chunkSize) {
+		keyLength = int64(math.MaxUint16) * int64(chunkSize)
+	}
+	keyLength -= keyLength % int64(chunkSize)
+	if keyLength <= 0 {
+		return nil, 0, nil
+	}
+	if material, err = key.ReadAt(key.Position(), keyLength); err != nil {
+		return nil, 0, err
+	}
+
+	for b, boundary := range boundaries {
+		var found = false
+		for i := 0; len(boundary) == chunkSize && (i+1)*chunkSize <= len(material) && (count < 0 || i < count); i++ {
+			var chunk []byte
+			var total int
+			if chunk, err = Cypher(boundary, material[i*chunkSize:(i+1)*chunkSize]); err != nil {
+				return nil, 0, err
+			}
+			total = int(binary.LittleEndian.Uint16(chunk[4:]))
+			if binary.LittleEndian.Uint16(chunk[0:]) != sequenceMagic || int(binary.LittleEndian.Uint16(chunk[2:])) != i || total <= i {
+				continue
+			}
+			if count >= 0 && total != count {
+				continue
+			}
+			count = total
+			chunks[i] = chunk[sequenceHeaderLength:]
+			found = true
+			break
+		}
+		if !found {
+			unknown = append(unknown, strconv.Itoa(b))
+		}
+	}
+	if count < 0 {
+		// The message is not sequenced.
+		return nil, 0, nil
+	}
+	if len(unknown) > 0 {
+		return nil, 0, fmt.Errorf(`the boundaries %s are not part of the message (wrong emails, or corrupted boundaries)`, strings.Join(unknown, ", "))
+	}
+	for i := 0; i < count; i++ {
+		if _, ok := chunks[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) > 0 {
+		// The chunks that precede the first missing one can be decoded.
+		for i := 0; i < missing[0]; i++ {
+			clearMessage = append(clearMessage, chunks[i]...)
+		}
+		return nil, 0, &IncompleteError{Sequenced: true, Chunks: count, Missing: missing, Partial: partialContent(clearMessage)}
+	}
+	for _, i := range sortedKeys(chunks) {
+		clearMessage = append(clearMessage, chunks[i]...)
+	}
+	return clearMessage, key.Position() + int64(count*chunkSize), nil
+}
+
+// sortedKeys Returns the (sorted) indexes of the chunks.
+func sortedKeys(chunks map[int][]byte) []int {
+	var keys []int
+
+	for k := range chunks {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
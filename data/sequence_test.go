@@ -0,0 +1,64 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"umail/resource"
+)
+
+func TestSequencedMessage(t *testing.T) {
+	var err error
+	var pad = make([]byte, 1024)
+	var key *resource.MemoryPool
+	var boundaries [][]byte
+	var shuffled [][]byte
+	var message []byte
+	var authenticated bool
+	var secret = []byte("This is the secret message!\nYou cannot detect it.\nYou cannot read it!")
+	var encoding = Encoding{Authenticated: true, Sequenced: true}
+
+	for i := range pad {
+		pad[i] = byte(i * 13)
+	}
+
+	// Encode the message: each chunk starts with a sequence header.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	boundaries, err = EncodeMessage(secret, chunkSize, key, encoding)
+	assert.Nil(t, err)
+	assert.Len(t, boundaries, 4)
+	assert.Equal(t, encoding.MaterialLength(len(secret), chunkSize), int64(len(boundaries)*chunkSize))
+	assert.Equal(t, int64(10)+encoding.KeyLength(len(secret), chunkSize), key.Position())
+
+	// The boundaries are decoded in any order.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	shuffled = [][]byte{boundaries[2], boundaries[0], boundaries[3], boundaries[1]}
+	message, authenticated, err = DecodeAuthenticated(shuffled, key)
+	assert.Nil(t, err)
+	assert.True(t, authenticated)
+	assert.Equal(t, secret, message)
+
+	// A missing email is detected.
+	_, err = Decode([][]byte{boundaries[2], boundaries[0], boundaries[1]}, key)
+	assert.ErrorContains(t, err, "chunks 3 have not been given")
+
+	// An email that does not belong to the message is detected.
+	_, err = Decode(append(shuffled, pad[500:500+chunkSize]), key)
+	assert.ErrorContains(t, err, "boundaries 4 are not part of the message")
+
+	// The messages that are not sequenced are still decoded.
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	boundaries, err = EncodeMessage(secret, chunkSize, key, Encoding{})
+	assert.Nil(t, err)
+	key, err = resource.NewMemoryPool(pad, 10)
+	assert.Nil(t, err)
+	message, err = Decode(boundaries, key)
+	assert.Nil(t, err)
+	assert.Equal(t, secret, message)
+
+	// The chunks are too short.
+	_, err = sequenceChunks(secret, sequenceHeaderLength)
+	assert.NotNil(t, err)
+}
@@ -1,45 +1,295 @@
 package data
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+	"umail/resource"
 )
 
+// SessionVersion The current version of the session file format.
+// Version 0 represents the legacy files, which have no "version" field. The version only changes when the layout of the
+// file becomes incompatible: a new optional field (omitted when not used) keeps the version as is.
+const SessionVersion = 30
+
+// ErrNoMessageHash Returned when a session created by a previous version (without hash of the message) is verified.
+var ErrNoMessageHash = errors.New("the session does not contain the hash of the message")
+
+// ErrProtectedSession Returned when the content of a protected (encrypted) session is read without its secret.
+var ErrProtectedSession = errors.New("the session is protected")
+
+// Recipient A recipient of a multi-recipient session. The progress of each recipient is tracked independently.
+type Recipient struct {
+	Address    string     `json:"address"`
+	Deliveries Deliveries `json:"deliveries"`
+}
+
+// Account The account used to send the emails of a session.
+type Account struct {
+	SmtpServer string `json:"smtp-server"`
+	SmtpPort   int    `json:"smtp-port"`
+	From       string `json:"from"`
+	// Pin The SHA-256 of the public key of the SMTP server (hexadecimal), if the public key of the server is pinned.
+	Pin string `json:"pin,omitempty"`
+	// Transport How the emails are sent (see `TransportSmtp`, `TransportGmail` and `TransportGraph`). If empty, then
+	// the emails are sent through the SMTP server.
+	Transport string `json:"transport,omitempty"`
+	// Proxy The URL of the SOCKS5 proxy the connections to the SMTP server go through (see `ParseProxy`), if any.
+	Proxy string `json:"proxy,omitempty"`
+	// Sent The location of the IMAP mailbox the emails sent are appended to (see `ParseSentFolder`), if any.
+	Sent string `json:"sent,omitempty"`
+}
+
+// The transports used to send the emails of an account.
+const (
+	TransportSmtp  = "smtp"
+	TransportGmail = "gmail"
+	TransportGraph = "graph"
+)
+
+// legacyProgress The progress of a session, as recorded by the versions prior to 4 (the index of the next email to
+// send).
+type legacyProgress struct {
+	EmailIndex int `json:"email-index"`
+	Recipients []struct {
+		EmailIndex int `json:"email-index"`
+	} `json:"recipients"`
+}
+
 type Session struct {
+	Version             int       `json:"version"`
 	PoolPointerPosition int64     `json:"pool-position"`
 	PoolName            string    `json:"pool-name"`
-	EmailIndex          int       `json:"email-index"`
 	Boundaries          [][]uint8 `json:"boundaries"`
+	// Deliveries The delivery states of the boundaries, for a single-recipient session.
+	Deliveries Deliveries `json:"deliveries"`
+	// Recipients The recipients of a multi-recipient session. If empty, then the progress is given by `Deliveries`.
+	Recipients []Recipient `json:"recipients"`
+	// Created The creation date of the session.
+	Created time.Time `json:"created"`
+	// Updated The date of the last update of the session (set when the session is saved).
+	Updated time.Time `json:"updated"`
+	// IntendedRecipient The intended recipient of a single-recipient session (used if no recipient is given).
+	IntendedRecipient string `json:"recipient"`
+	// Subject The default subject of the emails.
+	Subject string `json:"subject"`
+	// Note A free text note.
+	Note string `json:"note"`
+	// MessageHash The SHA-256 of the hidden message (hexadecimal).
+	MessageHash string `json:"message-hash"`
+	// Journal The records of the emails sent (in chronological order).
+	Journal []JournalEntry `json:"journal"`
+	// Bodies The paths to the files that contain the bodies (the visible content) of the emails. If empty, then the
+	// body is given when the emails are sent.
+	Bodies []string `json:"bodies"`
+	// Rotation How the bodies are assigned to the emails.
+	Rotation BodyRotation `json:"rotation"`
+	// Corpus The path to the text from which the bodies of the emails are generated (see `Corpus`), if no bodies are
+	// attached to the session.
+	Corpus string `json:"corpus"`
+	// Templated Tells whether the bodies of the emails are templates, rendered for each email (see `RenderBody`).
+	Templated bool `json:"templated"`
+	// Variables The variables of the templates of the bodies.
+	Variables map[string]string `json:"variables"`
+	// HtmlLayout The path to the layout of the HTML part of the emails (see `BuildHtml`). If empty, then
+	// `DefaultHtmlLayout` is used.
+	HtmlLayout string `json:"html-layout"`
+	// InlineCss Tells whether the CSS rules of the layout are moved to the elements (see `InlineCss`).
+	InlineCss bool `json:"inline-css"`
+	// Lazy Tells whether the key material is consumed when the emails are sent (instead of when the session is
+	// created). For a lazy session, the boundaries are empty until they are allocated.
+	Lazy bool `json:"lazy"`
+	// Message The (plain) message to hide, for a lazy session.
+	Message []byte `json:"message"`
+	// BoundaryLength The length of the boundaries, for a lazy session.
+	BoundaryLength int `json:"boundary-length"`
+	// Positions The positions of the key material used by the boundaries (-1 if not allocated), for a lazy session.
+	Positions []int64 `json:"positions"`
+	// Account The account used to send the emails (if the session is bound to an account).
+	Account *Account `json:"account"`
+	// Authenticated Tells whether the hidden message is followed by its MAC (message format 3). The key material used
+	// by the MAC follows the key material used by the boundaries.
+	Authenticated bool `json:"authenticated"`
+	// Sequenced Tells whether each chunk of the message starts with a sequence header, so that the receiver can decode
+	// the boundaries in any order.
+	Sequenced bool `json:"sequenced"`
+	// Threaded Tells whether the emails sent to a recipient look like a conversation: each email replies to the
+	// previous one ("In-Reply-To" and "References" headers, "Re:" subject).
+	Threaded bool `json:"threaded"`
+	// Client The mail client whose headers are mimicked by the emails (see `MailClient`).
+	Client MailClient `json:"client"`
+	// Marker The marker written into the message IDs of the emails (see `NewMarker`), empty if the emails are not
+	// marked.
+	Marker string `json:"marker"`
+	// TextEncoding The encoding of the plain text part of the emails (see `TextEncodingBase64`). If empty, then the
+	// part is encoded in base64.
+	TextEncoding string `json:"text-encoding"`
+	// Charset The character set of the parts of the emails (see `ParseCharset`). If empty, then the parts are written
+	// in `DefaultCharset`.
+	Charset string `json:"charset"`
+	// BoundaryStyle How the boundaries are written into the emails (see `BoundaryStyle`).
+	BoundaryStyle BoundaryStyle `json:"boundary-style"`
+	// Nested Tells whether each email is made of nested multipart parts (see `BuildNested`). Each boundary of the
+	// session is then split into `NestingDepth` boundaries, one per level.
+	Nested bool `json:"nested"`
+	// Schedule The dates at which the emails are due (see `Schedule`), if the session is scheduled.
+	Schedule *Schedule `json:"schedule"`
+	// Carriers The parts of the emails that hide the chunks of the message (see `Carriers`): each boundary of the
+	// session is then a chunk, split across the carriers. If empty, then the chunks are hidden by the boundaries only.
+	Carriers Carriers `json:"carriers"`
+	// loadedVersion The version of the file the session has been loaded from.
+	loadedVersion int
+	// protection Set if the session file is protected (encrypted).
+	protection *protection
+}
+
+// sessionJSON The JSON representation of a session.
+// The optional fields are omitted when not set, so that the files written for sessions that do not use them stay
+// compact.
+type sessionJSON struct {
+	Version             int               `json:"version"`
+	PoolName            string            `json:"pool-name"`
+	PoolPointerPosition int64             `json:"pool-position"`
+	Boundaries          []boundaryJSON    `json:"boundaries"`
+	Deliveries          Deliveries        `json:"deliveries"`
+	Recipients          []Recipient       `json:"recipients,omitempty"`
+	Created             *time.Time        `json:"created,omitempty"`
+	Updated             *time.Time        `json:"updated,omitempty"`
+	IntendedRecipient   string            `json:"recipient,omitempty"`
+	Subject             string            `json:"subject,omitempty"`
+	Note                string            `json:"note,omitempty"`
+	MessageHash         string            `json:"message-hash,omitempty"`
+	Journal             []JournalEntry    `json:"journal,omitempty"`
+	Bodies              []string          `json:"bodies,omitempty"`
+	Rotation            BodyRotation      `json:"rotation,omitempty"`
+	Corpus              string            `json:"corpus,omitempty"`
+	Templated           bool              `json:"templated,omitempty"`
+	Variables           map[string]string `json:"variables,omitempty"`
+	HtmlLayout          string            `json:"html-layout,omitempty"`
+	InlineCss           bool              `json:"inline-css,omitempty"`
+	Lazy                bool              `json:"lazy,omitempty"`
+	Message             []byte            `json:"message,omitempty"`
+	BoundaryLength      int               `json:"boundary-length,omitempty"`
+	Positions           []int64           `json:"positions,omitempty"`
+	Account             *Account          `json:"account,omitempty"`
+	Authenticated       bool              `json:"authenticated,omitempty"`
+	Sequenced           bool              `json:"sequenced,omitempty"`
+	Threaded            bool              `json:"threaded,omitempty"`
+	Client              MailClient        `json:"client,omitempty"`
+	Marker              string            `json:"marker,omitempty"`
+	TextEncoding        string            `json:"text-encoding,omitempty"`
+	Charset             string            `json:"charset,omitempty"`
+	BoundaryStyle       BoundaryStyle     `json:"boundary-style,omitempty"`
+	Nested              bool              `json:"nested,omitempty"`
+	Schedule            *Schedule         `json:"schedule,omitempty"`
+	Carriers            Carriers          `json:"carriers,omitempty"`
+}
+
+// boundaryJSON A boundary, represented as an array of numbers (instead of a base64 string, which is the default
+// representation of a list of bytes).
+type boundaryJSON []uint8
+
+func (b boundaryJSON) MarshalJSON() ([]byte, error) {
+	var elements = make([]string, len(b))
+
+	for i, v := range b {
+		elements[i] = strconv.Itoa(int(v))
+	}
+	return []byte("[" + strings.Join(elements, ",") + "]"), nil
 }
 
 func (s *Session) MarshalJSON() ([]byte, error) {
-	var boundaries string
+	var representation = sessionJSON{
+		Version:             s.Version,
+		PoolName:            s.PoolName,
+		PoolPointerPosition: s.PoolPointerPosition,
+		Deliveries:          s.Deliveries,
+		Recipients:          s.Recipients,
+		IntendedRecipient:   s.IntendedRecipient,
+		Subject:             s.Subject,
+		Note:                s.Note,
+		MessageHash:         s.MessageHash,
+		Journal:             s.Journal,
+		Bodies:              s.Bodies,
+		Rotation:            s.Rotation,
+		Corpus:              s.Corpus,
+		Templated:           s.Templated,
+		Variables:           s.Variables,
+		HtmlLayout:          s.HtmlLayout,
+		InlineCss:           s.InlineCss,
+		Lazy:                s.Lazy,
+		Message:             s.Message,
+		BoundaryLength:      s.BoundaryLength,
+		Positions:           s.Positions,
+		Account:             s.Account,
+		Authenticated:       s.Authenticated,
+		Sequenced:           s.Sequenced,
+		Threaded:            s.Threaded,
+		Client:              s.Client,
+		Marker:              s.Marker,
+		TextEncoding:        s.TextEncoding,
+		Charset:             s.Charset,
+		BoundaryStyle:       s.BoundaryStyle,
+		Nested:              s.Nested,
+		Schedule:            s.Schedule,
+		Carriers:            s.Carriers,
+	}
 
-	if s.Boundaries == nil {
-		boundaries = "null"
-	} else {
-		var arrays []string
-		for _, array := range s.Boundaries {
-			var elements []string
-			for _, v := range array {
-				elements = append(elements, fmt.Sprintf("%d", v))
-			}
-			arrays = append(arrays, "["+strings.Join(elements, ",")+"]")
+	if s.Boundaries != nil {
+		representation.Boundaries = make([]boundaryJSON, len(s.Boundaries))
+		for i, boundary := range s.Boundaries {
+			representation.Boundaries[i] = boundary
 		}
-		boundaries = "[" + strings.Join(arrays, ",") + "]"
 	}
-
-	jsonResult := fmt.Sprintf(`{"email-index":%d,"pool-name":"%s","pool-position":%d,"boundaries":%s}`, s.EmailIndex, s.PoolName, s.PoolPointerPosition, boundaries)
-	return []byte(jsonResult), nil
+	if !s.Created.IsZero() {
+		representation.Created = &s.Created
+	}
+	if !s.Updated.IsZero() {
+		representation.Updated = &s.Updated
+	}
+	return json.Marshal(representation)
 }
 
 func (s *Session) Init(poolName string, poolPointerPosition int64) {
+	s.Version = SessionVersion
+	s.loadedVersion = SessionVersion
 	s.PoolName = poolName
 	s.PoolPointerPosition = poolPointerPosition
-	s.EmailIndex = 0
 	s.Boundaries = make([][]uint8, 0)
+	s.Deliveries = NewDeliveries(0)
+	s.Recipients = nil
+	s.Journal = nil
+	s.Bodies = nil
+	s.Rotation = ""
+	s.Corpus = ""
+	s.Templated = false
+	s.Variables = nil
+	s.HtmlLayout = ""
+	s.InlineCss = false
+	s.Lazy = false
+	s.Message = nil
+	s.BoundaryLength = 0
+	s.Positions = nil
+	s.Account = nil
+	s.Authenticated = false
+	s.Sequenced = false
+	s.Threaded = false
+	s.Client = ClientDefault
+	s.Marker = ""
+	s.TextEncoding = ""
+	s.Charset = ""
+	s.BoundaryStyle = BoundaryHex
+	s.Nested = false
+	s.Schedule = nil
+	s.Carriers = nil
+	s.Created = time.Now().UTC().Truncate(time.Second)
 }
 
 func (s *Session) Reset(path string) error {
@@ -48,36 +298,503 @@ func (s *Session) Reset(path string) error {
 	if err = s.Load(path); err != nil {
 		return err
 	}
-	s.EmailIndex = 0
+	s.Rewind()
 	return s.Save(path)
 }
 
+// Rewind Sets all the emails of the session as not sent (for all the recipients).
+func (s *Session) Rewind() {
+	s.Deliveries.Reset()
+	for i := range s.Recipients {
+		s.Recipients[i].Deliveries.Reset()
+	}
+}
+
+// AddBoundary Adds a boundary to the session. The boundary has not been sent yet.
 func (s *Session) AddBoundary(boundary []byte) {
 	s.Boundaries = append(s.Boundaries, boundary)
+	s.Deliveries = append(s.Deliveries, Delivery{Status: DeliveryPending})
+	for i := range s.Recipients {
+		s.Recipients[i].Deliveries = append(s.Recipients[i].Deliveries, Delivery{Status: DeliveryPending})
+	}
+}
+
+// AddRecipient Adds a recipient to the session. The recipient has not received any email yet.
+func (s *Session) AddRecipient(address string) error {
+	if len(address) == 0 {
+		return fmt.Errorf(`invalid recipient: empty address`)
+	}
+	if s.Recipient(address) != nil {
+		return fmt.Errorf(`duplicated recipient "%s"`, address)
+	}
+	s.Recipients = append(s.Recipients, Recipient{Address: address, Deliveries: NewDeliveries(len(s.Boundaries))})
+	return nil
+}
+
+// Recipient Returns the recipient identified by its address, or nil if the address is not a recipient of the session.
+func (s *Session) Recipient(address string) *Recipient {
+	for i := range s.Recipients {
+		if s.Recipients[i].Address == address {
+			return &s.Recipients[i]
+		}
+	}
+	return nil
+}
+
+// PendingRecipients Returns the recipients that have not received all the emails of the session yet.
+func (s *Session) PendingRecipients() []*Recipient {
+	var result []*Recipient
+
+	for i := range s.Recipients {
+		if !s.Recipients[i].Deliveries.Done() {
+			result = append(result, &s.Recipients[i])
+		}
+	}
+	return result
+}
+
+// IsProcessed Tells whether all the emails of the session have been sent (to all the recipients, if any).
+func (s *Session) IsProcessed() bool {
+	if len(s.Recipients) > 0 {
+		return len(s.PendingRecipients()) == 0
+	}
+	return s.Deliveries.Done()
+}
+
+// Progress Returns the number of emails sent (or confirmed), and the total number of emails to send (for all the
+// recipients, if any).
+func (s *Session) Progress() (int, int) {
+	var done int
+
+	if len(s.Recipients) == 0 {
+		done = s.Deliveries.Count(DeliverySent) + s.Deliveries.Count(DeliveryConfirmed)
+		return done, len(s.Deliveries)
+	}
+	for _, recipient := range s.Recipients {
+		done += recipient.Deliveries.Count(DeliverySent) + recipient.Deliveries.Count(DeliveryConfirmed)
+	}
+	return done, len(s.Boundaries) * len(s.Recipients)
 }
 
+// Load Loads a session from a file. If the file is protected, then the secret is requested from `SecretProvider`.
 func (s *Session) Load(path string) error {
 	var err error
-	var jsonBytes []byte
+	var content []byte
 
-	if jsonBytes, err = os.ReadFile(path); err != nil {
+	if content, err = os.ReadFile(path); err != nil {
 		return err
 	}
+	return s.Deserialize(path, content)
+}
+
+// Deserialize Loads a session from its serialized representation (see `Serialize`). The origin of the representation
+// (a file path, or a session name) is used to request the secret (if the session is protected) and to report errors.
+func (s *Session) Deserialize(origin string, content []byte) error {
+	var err error
+	var jsonBytes = content
+	var secret []byte
+
+	s.protection = nil
+	if bytes.HasPrefix(jsonBytes, []byte(protectedMagic)) {
+		if SecretProvider == nil {
+			return fmt.Errorf(`the session "%s" is protected, and no secret is available`, origin)
+		}
+		if secret, err = SecretProvider(origin); err != nil {
+			return err
+		}
+		if s.protection, jsonBytes, err = openProtected(origin, jsonBytes, secret); err != nil {
+			return err
+		}
+	}
 	if err = json.Unmarshal(jsonBytes, s); nil != err {
+		return fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	if err = s.migrate(jsonBytes); err != nil {
 		return err
 	}
+	return s.validate()
+}
+
+// LoadedVersion Returns the version of the file the session has been loaded from.
+// If it differs from `SessionVersion`, then the session has been upgraded while loaded (and the file should be saved).
+func (s *Session) LoadedVersion() int {
+	return s.loadedVersion
+}
+
+// migrate Upgrades a session loaded from a file written using a previous version of the format.
+// The content of the file (`jsonBytes`) is used to retrieve the data that cannot be represented by the current version.
+func (s *Session) migrate(jsonBytes []byte) error {
+	var err error
+
+	s.loadedVersion = s.Version
+	if s.Version > SessionVersion {
+		return fmt.Errorf(`unsupported session version (%d): the latest supported version is %d`, s.Version, SessionVersion)
+	}
+	if s.Version < 0 {
+		return fmt.Errorf(`invalid session version (%d)`, s.Version)
+	}
+	if s.Version < 4 {
+		// Version 4 replaces the index of the next email to send by the delivery states of the boundaries.
+		var legacy legacyProgress
+		if err = json.Unmarshal(jsonBytes, &legacy); err != nil {
+			return err
+		}
+		s.Deliveries = legacyDeliveries(len(s.Boundaries), legacy.EmailIndex)
+		for i := range s.Recipients {
+			var index int
+			if i < len(legacy.Recipients) {
+				index = legacy.Recipients[i].EmailIndex
+			}
+			s.Recipients[i].Deliveries = legacyDeliveries(len(s.Boundaries), index)
+		}
+	}
+	// The other versions (up to 30) only add optional fields, which are left empty.
+	s.Version = SessionVersion
 	return nil
 }
 
+// EmlFileName Returns the name of the file that contains an email of the session (RFC 5322, ".eml"), given the name of
+// the session, the recipient and the index of the boundary. The name of the recipient is added for a multi-recipient
+// session.
+func (s *Session) EmlFileName(sessionName string, recipient string, index int) string {
+	if len(s.Recipients) > 0 {
+		return fmt.Sprintf("%s-%s-%03d.eml", sessionName, recipient, index)
+	}
+	return fmt.Sprintf("%s-%03d.eml", sessionName, index)
+}
+
+// SessionPoolName Returns the name of the key used by a session, given the content of its file. Only this field is
+// decoded: the boundaries are not checked. `ErrProtectedSession` is returned if the session is protected.
+func SessionPoolName(content []byte) (string, error) {
+	var err error
+	var header struct {
+		PoolName string `json:"pool-name"`
+	}
+
+	if IsProtectedContent(content) {
+		return "", ErrProtectedSession
+	}
+	if err = json.Unmarshal(content, &header); err != nil {
+		return "", fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	return header.PoolName, nil
+}
+
+// MessageHash Returns the hash of a (hidden) message, as stored into a session.
+func MessageHash(message []byte) string {
+	var hash = sha256.Sum256(message)
+	return hex.EncodeToString(hash[:])
+}
+
+// DecodeMessage Decodes the boundaries using the key material from the session's position, and returns the hidden
+// message. For a lazy session, the message kept by the session is returned.
+// Please note that the key material is *NOT* consumed.
+func (s *Session) DecodeMessage(key resource.KeySource) ([]byte, error) {
+	var err error
+	var length int64
+	var material []byte
+	var memory *resource.MemoryPool
+	var message []byte
+
+	if s.Lazy {
+		// The message is kept by the session.
+		return s.Message, nil
+	}
+	if len(s.Boundaries) == 0 {
+		return nil, fmt.Errorf(`the session does not contain any boundary`)
+	}
+	for _, boundary := range s.Boundaries {
+		length += int64(len(boundary))
+	}
+	if s.Authenticated {
+		// The key material used by the MAC follows the one used by the boundaries.
+		length += MacKeyLength
+	}
+	if material, err = key.ReadAt(s.PoolPointerPosition, length); err != nil {
+		return nil, fmt.Errorf(`cannot read the key material used by the session (%d bytes from position %d): %s`, length, s.PoolPointerPosition, err.Error())
+	}
+	if memory, err = resource.NewMemoryPool(material, 0); err != nil {
+		return nil, err
+	}
+	if message, err = Decode(s.Boundaries, memory); err != nil {
+		return nil, fmt.Errorf(`cannot decode the boundaries (wrong key or corrupted session): %s`, err.Error())
+	}
+	return message, nil
+}
+
+// Verify Decodes the boundaries using the key material from the session's position, and checks that the hidden
+// message matches the hash of the message. Thus, a drift of the key (or a corrupted session) is detected before any
+// email is sent.
+// Please note that the key material is *NOT* consumed.
+// If the session does not contain the hash of the message, then `ErrNoMessageHash` is returned (after decoding).
+// For a lazy session, the boundaries allocated so far are checked.
+func (s *Session) Verify(key resource.KeySource) error {
+	var err error
+	var message []byte
+
+	if s.Lazy {
+		return s.verifyLazy(key)
+	}
+	if message, err = s.DecodeMessage(key); err != nil {
+		return err
+	}
+	if len(s.MessageHash) == 0 {
+		return ErrNoMessageHash
+	}
+	if MessageHash(message) != s.MessageHash {
+		return fmt.Errorf(`the decoded message does not match the hash of the message (wrong key or corrupted session)`)
+	}
+	return nil
+}
+
+// InitEncoded Initializes a session: the message is organized into chunks of `boundaryLength` bytes (using a given
+// encoding), which are encrypted using key material extracted from the key (from its current position).
+func (s *Session) InitEncoded(poolName string, key resource.KeySource, plainMessage []byte, boundaryLength int, encoding Encoding) error {
+	var err error
+	var boundaries [][]byte
+	var position = key.Position()
+
+	if boundaries, err = EncodeMessage(plainMessage, boundaryLength, key, encoding); err != nil {
+		return err
+	}
+	s.Init(poolName, position)
+	for _, boundary := range boundaries {
+		s.AddBoundary(boundary)
+	}
+	s.MessageHash = MessageHash(plainMessage)
+	s.Authenticated = encoding.Authenticated
+	s.Sequenced = encoding.Sequenced
+	return nil
+}
+
+// Encoding Returns how the message of the session is organized into chunks.
+func (s *Session) Encoding() Encoding {
+	return Encoding{Authenticated: s.Authenticated, Sequenced: s.Sequenced}
+}
+
+// Validate Checks that an account is complete.
+func (a *Account) Validate() error {
+	switch a.TransportName() {
+	case TransportSmtp:
+		if len(a.SmtpServer) == 0 {
+			return fmt.Errorf(`the account has no SMTP server`)
+		}
+		if a.SmtpPort <= 0 || a.SmtpPort > 65535 {
+			return fmt.Errorf(`invalid SMTP port (%d)`, a.SmtpPort)
+		}
+	case TransportGmail, TransportGraph:
+	default:
+		return fmt.Errorf(`unknown transport "%s" (expected "%s", "%s" or "%s")`, a.Transport, TransportSmtp, TransportGmail, TransportGraph)
+	}
+	if len(a.From) == 0 {
+		return fmt.Errorf(`the account has no sender address`)
+	}
+	if hash, err := hex.DecodeString(a.Pin); len(a.Pin) > 0 && (err != nil || len(hash) != sha256.Size) {
+		return fmt.Errorf(`invalid pin "%s" (expected the SHA-256 of the public key of the server, in hexadecimal)`, a.Pin)
+	}
+	if err := a.CheckSent(); err != nil {
+		return err
+	}
+	return a.CheckProxy()
+}
+
+// CheckProxy Checks the proxy of the account, if any: only the connections to an SMTP server can go through a proxy.
+func (a *Account) CheckProxy() error {
+	if len(a.Proxy) == 0 {
+		return nil
+	}
+	if a.TransportName() != TransportSmtp {
+		return fmt.Errorf(`the proxy can only be used with the transport "%s"`, TransportSmtp)
+	}
+	_, err := ParseProxy(a.Proxy)
+	return err
+}
+
+// TransportName Returns the transport used to send the emails of the account.
+func (a *Account) TransportName() string {
+	if len(a.Transport) == 0 {
+		return TransportSmtp
+	}
+	return a.Transport
+}
+
+// legacyDeliveries Creates the delivery states that represent the progress recorded by the versions prior to 4: the
+// boundaries before `emailIndex` have been sent.
+func legacyDeliveries(count int, emailIndex int) Deliveries {
+	var result = NewDeliveries(count)
+
+	for i := 0; i < emailIndex && i < count; i++ {
+		result[i].Status = DeliverySent
+	}
+	return result
+}
+
+// validate Checks the consistency of the session:
+// - the name of the key is a file name (not a path).
+// - the position within the key is not negative.
+// - all the boundaries have the same (non-zero) length, or, for a lazy session, the allocated boundaries have the
+// expected length and position.
+// - there is one (valid) delivery state per boundary (for each recipient).
+// - the addresses of the recipients are set, and unique.
+// - the account (if any) is complete.
+// - the carriers (if any) hide the chunks of the message (the boundaries).
+// - the rotation of the bodies is known.
+// - the journal entries refer to existing boundaries.
+// - the hash of the message (if any) is a SHA-256 (hexadecimal).
+func (s *Session) validate() error {
+	var err error
+	var addresses = make(map[string]bool)
+
+	if strings.ContainsAny(s.PoolName, `/\`) || s.PoolName == "." || s.PoolName == ".." {
+		return fmt.Errorf(`invalid session: invalid key name "%s"`, s.PoolName)
+	}
+	if s.PoolPointerPosition < 0 {
+		return fmt.Errorf(`invalid session: negative key position (%d)`, s.PoolPointerPosition)
+	}
+	if s.Lazy {
+		if s.Authenticated || s.Sequenced {
+			return fmt.Errorf(`invalid session: a lazy session cannot be authenticated, or sequenced`)
+		}
+		if err = s.validateLazy(); err != nil {
+			return err
+		}
+	} else {
+		for i, boundary := range s.Boundaries {
+			if len(boundary) == 0 {
+				return fmt.Errorf(`invalid session: boundary %d is empty`, i)
+			}
+			if len(boundary) != len(s.Boundaries[0]) {
+				return fmt.Errorf(`invalid session: boundary %d contains %d bytes (expected %d, as boundary 0)`, i, len(boundary), len(s.Boundaries[0]))
+			}
+		}
+	}
+	if len(s.Deliveries) != len(s.Boundaries) {
+		return fmt.Errorf(`invalid session: %d delivery states for %d boundaries`, len(s.Deliveries), len(s.Boundaries))
+	}
+	if len(s.Carriers) > 0 {
+		if err = s.validateCarriers(); err != nil {
+			return err
+		}
+	} else if s.Nested {
+		var length = s.chunkLength()
+		if length%NestingDepth != 0 {
+			return fmt.Errorf(`invalid session: the boundaries of a nested session cannot be split into %d levels (%d bytes)`, NestingDepth, length)
+		}
+	}
+	if _, ok := clientProfiles[s.Client]; !ok {
+		return fmt.Errorf(`invalid session: unknown mail client "%s"`, s.Client)
+	}
+	if err = CheckTextEncoding(s.TextEncoding); err != nil {
+		return fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	if _, err = ParseCharset(s.Charset); err != nil {
+		return fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	if _, ok := boundaryLayouts[s.BoundaryStyle]; !ok && s.BoundaryStyle != BoundaryHex {
+		return fmt.Errorf(`invalid session: unknown boundary style "%s"`, s.BoundaryStyle)
+	}
+	if err = s.Deliveries.validate(); err != nil {
+		return fmt.Errorf(`invalid session: %s`, err.Error())
+	}
+	for i, recipient := range s.Recipients {
+		if len(recipient.Address) == 0 {
+			return fmt.Errorf(`invalid session: recipient %d has no address`, i)
+		}
+		if addresses[recipient.Address] {
+			return fmt.Errorf(`invalid session: duplicated recipient "%s"`, recipient.Address)
+		}
+		addresses[recipient.Address] = true
+		if len(recipient.Deliveries) != len(s.Boundaries) {
+			return fmt.Errorf(`invalid session: %d delivery states for %d boundaries (recipient "%s")`, len(recipient.Deliveries), len(s.Boundaries), recipient.Address)
+		}
+		if err = recipient.Deliveries.validate(); err != nil {
+			return fmt.Errorf(`invalid session: %s (recipient "%s")`, err.Error(), recipient.Address)
+		}
+	}
+	if s.Account != nil {
+		if err = s.Account.Validate(); err != nil {
+			return fmt.Errorf(`invalid session: %s`, err.Error())
+		}
+	}
+	if s.Schedule != nil {
+		if err = s.Schedule.validate(len(s.Boundaries)); err != nil {
+			return fmt.Errorf(`invalid session: invalid schedule: %s`, err.Error())
+		}
+	}
+	if _, ok := bodyRotations[s.Rotation]; !ok {
+		return fmt.Errorf(`invalid session: invalid rotation of the bodies "%s"`, s.Rotation)
+	}
+	for name := range s.Variables {
+		if err = CheckVariable(name); err != nil {
+			return fmt.Errorf(`invalid session: %s`, err.Error())
+		}
+	}
+	for i, entry := range s.Journal {
+		if entry.Boundary < 0 || entry.Boundary >= len(s.Boundaries) {
+			return fmt.Errorf(`invalid session: invalid boundary index (%d) for journal entry %d`, entry.Boundary, i)
+		}
+	}
+	if len(s.MessageHash) > 0 {
+		if hash, err := hex.DecodeString(s.MessageHash); err != nil || len(hash) != sha256.Size {
+			return fmt.Errorf(`invalid session: invalid message hash "%s"`, s.MessageHash)
+		}
+	}
+	return nil
+}
+
+// Protect Makes the session protected: from now on, the session is encrypted (using a key derived from `secret`) when
+// saved.
+func (s *Session) Protect(secret []byte) error {
+	var err error
+
+	if len(secret) == 0 {
+		return fmt.Errorf(`the secret must not be empty`)
+	}
+	s.protection, err = newProtection(secret)
+	return err
+}
+
+// Unprotect Makes the session unprotected: from now on, the session is saved in plain JSON.
+func (s *Session) Unprotect() {
+	s.protection = nil
+}
+
+// IsProtected Tells whether the session is encrypted when saved.
+func (s *Session) IsProtected() bool {
+	return s.protection != nil
+}
+
+// Save Saves the session into a file. If the session is protected, then it is encrypted (and the file is atomically
+// replaced).
+// Please note that the date of the last update is set.
 func (s *Session) Save(path string) error {
 	var err error
-	var jsonBytes []byte
+	var content []byte
 
-	if jsonBytes, err = json.Marshal(s); nil != err {
+	if content, err = s.Serialize(); err != nil {
 		return err
 	}
-	if err = os.WriteFile(path, jsonBytes, 0644); err != nil {
+	if s.protection != nil {
+		return writeAtomically(path, content)
+	}
+	if err = os.WriteFile(path, content, 0644); err != nil {
 		return err
 	}
 	return nil
 }
+
+// Serialize Returns the representation of the session, as stored: JSON, or encrypted JSON if the session is protected.
+// Please note that the date of the last update is set.
+func (s *Session) Serialize() ([]byte, error) {
+	var err error
+	var jsonBytes []byte
+
+	s.Updated = time.Now().UTC().Truncate(time.Second)
+	if jsonBytes, err = json.Marshal(s); nil != err {
+		return nil, err
+	}
+	if s.protection != nil {
+		return s.protection.seal(jsonBytes)
+	}
+	return jsonBytes, nil
+}
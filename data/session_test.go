@@ -1,9 +1,14 @@
 package data
 
 import (
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"strings"
 	"testing"
+	"time"
+	"umail/resource"
 )
 
 func TestSessionLoad(t *testing.T) {
@@ -19,7 +24,7 @@ func TestSessionLoad(t *testing.T) {
 	err = session.Load(sessionFile)
 	assert.Nil(t, err)
 
-	assert.Equal(t, 0, session.EmailIndex)
+	assert.Equal(t, 0, session.Deliveries.Next())
 	assert.Len(t, session.Boundaries, 2)
 	assert.Len(t, session.Boundaries[0], 2)
 	assert.Len(t, session.Boundaries[1], 2)
@@ -29,12 +34,13 @@ func TestSessionLoad(t *testing.T) {
 
 func TestSessionSave(t *testing.T) {
 	var err error
-	var session = Session{EmailIndex: 0, Boundaries: [][]uint8{{0x01, 0x02}, {0x03, 0x04}}}
-	var expected = `{"email-index":0,"boundaries":[[1,2],[3,4]]}`
+	var session = Session{Version: SessionVersion, PoolName: "key", PoolPointerPosition: 10, Boundaries: [][]uint8{{0x01, 0x02}, {0x03, 0x04}}, Deliveries: NewDeliveries(2)}
+	var expected string
 	var content []byte
 
 	err = session.Save(sessionFile)
 	assert.Nil(t, err)
+	expected = `{"version":30,"pool-name":"key","pool-position":10,"boundaries":[[1,2],[3,4]],"deliveries":[{"status":"pending"},{"status":"pending"}],"updated":"` + session.Updated.Format(time.RFC3339) + `"}`
 
 	// Check that the file has been created.
 	_, err = os.Stat(sessionFile)
@@ -45,3 +51,356 @@ func TestSessionSave(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, expected, string(content))
 }
+
+func TestSessionLoadLegacy(t *testing.T) {
+	var err error
+	var session Session
+	var jsonText = `{"email-index":1,"pool-name":"key","pool-position":10,"boundaries":[[1,2],[3,4]]}`
+
+	// Create the file to load (no version).
+	err = os.WriteFile(sessionFile, []byte(jsonText), 0644)
+	assert.Nil(t, err)
+
+	// Load the file: the session is upgraded.
+	err = session.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, session.LoadedVersion())
+	assert.Equal(t, SessionVersion, session.Version)
+	assert.Equal(t, DeliverySent, session.Deliveries[0].Status)
+	assert.Equal(t, DeliveryPending, session.Deliveries[1].Status)
+	assert.Equal(t, "key", session.PoolName)
+	assert.Equal(t, int64(10), session.PoolPointerPosition)
+
+	// Save the session, and load it again.
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	session = Session{}
+	err = session.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, SessionVersion, session.LoadedVersion())
+}
+
+func TestSessionLoadOptionalFields(t *testing.T) {
+	// The versions from 4 only add optional fields: the deliveries are kept as is.
+	for _, version := range []int{4, 5, 17, 29} {
+		var err error
+		var session Session
+		var jsonText = fmt.Sprintf(`{"version":%d,"pool-name":"key","pool-position":10,"boundaries":[[1,2],[3,4]],"deliveries":[{"status":"sent"},{"status":"pending"}]}`, version)
+
+		err = os.WriteFile(sessionFile, []byte(jsonText), 0644)
+		assert.Nil(t, err)
+		err = session.Load(sessionFile)
+		assert.Nil(t, err)
+		assert.Equal(t, version, session.LoadedVersion())
+		assert.Equal(t, SessionVersion, session.Version)
+		assert.Equal(t, DeliverySent, session.Deliveries[0].Status)
+		assert.Equal(t, DeliveryPending, session.Deliveries[1].Status)
+	}
+}
+
+func TestSessionLoadUnsupportedVersion(t *testing.T) {
+	var err error
+	var session Session
+
+	err = os.WriteFile(sessionFile, []byte(`{"version":1000,"email-index":0,"boundaries":[]}`), 0644)
+	assert.Nil(t, err)
+	err = session.Load(sessionFile)
+	assert.NotNil(t, err)
+}
+
+func TestSessionRecipients(t *testing.T) {
+	var err error
+	var session Session
+	var loaded Session
+	var pending []*Recipient
+	var done int
+	var total int
+
+	session.Init("key", 0)
+	session.AddBoundary([]byte{1, 2})
+	session.AddBoundary([]byte{3, 4})
+	assert.Nil(t, session.AddRecipient("alice@example.com"))
+	assert.Nil(t, session.AddRecipient("bob@example.com"))
+	assert.NotNil(t, session.AddRecipient("bob@example.com"))
+	assert.NotNil(t, session.AddRecipient(""))
+	assert.Nil(t, session.Recipient("carol@example.com"))
+
+	// Each recipient progresses independently.
+	assert.Nil(t, session.Recipient("alice@example.com").Deliveries.SetSent(0, "<1@example.com>"))
+	assert.Nil(t, session.Recipient("alice@example.com").Deliveries.SetSent(1, "<2@example.com>"))
+	assert.Nil(t, session.Recipient("bob@example.com").Deliveries.SetSent(0, "<3@example.com>"))
+	pending = session.PendingRecipients()
+	assert.Len(t, pending, 1)
+	done, total = session.Progress()
+	assert.Equal(t, 3, done)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, "bob@example.com", pending[0].Address)
+	assert.False(t, session.IsProcessed())
+
+	// Save and load.
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, session.Recipients, loaded.Recipients)
+	assert.Nil(t, loaded.Recipient("bob@example.com").Deliveries.SetSent(1, "<4@example.com>"))
+	assert.True(t, loaded.IsProcessed())
+
+	// Reset all recipients.
+	err = loaded.Reset(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, loaded.Recipient("alice@example.com").Deliveries.Next())
+	assert.Equal(t, 0, loaded.Recipient("bob@example.com").Deliveries.Next())
+}
+
+func TestSessionMetadata(t *testing.T) {
+	var err error
+	var session Session
+	var loaded Session
+
+	session.Init("key", 0)
+	assert.False(t, session.Created.IsZero())
+	session.IntendedRecipient = "john@example.com"
+	session.Subject = "Holidays \"2024\""
+	session.Note = "first try\nsecond line"
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	assert.False(t, session.Updated.IsZero())
+
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.True(t, session.Created.Equal(loaded.Created))
+	assert.True(t, session.Updated.Equal(loaded.Updated))
+	assert.Equal(t, "john@example.com", loaded.IntendedRecipient)
+	assert.Equal(t, "Holidays \"2024\"", loaded.Subject)
+	assert.Equal(t, "first try\nsecond line", loaded.Note)
+}
+
+func TestSessionLoadLegacyRecipients(t *testing.T) {
+	var err error
+	var session Session
+	var jsonText = `{"version":3,"email-index":0,"pool-name":"key","pool-position":0,"boundaries":[[1,2],[3,4]],"recipients":[{"address":"alice@example.com","email-index":2},{"address":"bob@example.com","email-index":1}]}`
+
+	err = os.WriteFile(sessionFile, []byte(jsonText), 0644)
+	assert.Nil(t, err)
+	err = session.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, session.Recipient("alice@example.com").Deliveries.Next())
+	assert.Equal(t, 1, session.Recipient("bob@example.com").Deliveries.Next())
+}
+
+func TestSessionLoadInvalidDeliveries(t *testing.T) {
+	var err error
+	var session Session
+
+	// Missing delivery state.
+	err = os.WriteFile(sessionFile, []byte(`{"version":5,"pool-name":"key","pool-position":0,"boundaries":[[1,2],[3,4]],"deliveries":[{"status":"sent"}]}`), 0644)
+	assert.Nil(t, err)
+	err = session.Load(sessionFile)
+	assert.NotNil(t, err)
+
+	// Unknown status.
+	session = Session{}
+	err = os.WriteFile(sessionFile, []byte(`{"version":5,"pool-name":"key","pool-position":0,"boundaries":[[1,2]],"deliveries":[{"status":"lost"}]}`), 0644)
+	assert.Nil(t, err)
+	err = session.Load(sessionFile)
+	assert.NotNil(t, err)
+}
+
+func TestSessionLoadInvalid(t *testing.T) {
+	var err error
+	var session Session
+
+	for _, jsonText := range []string{
+		// Not JSON.
+		`{"version":5,`,
+		// Value out of range for a byte.
+		`{"version":5,"pool-name":"key","pool-position":0,"boundaries":[[1,256]],"deliveries":[{"status":"pending"}]}`,
+		// Negative position.
+		`{"version":5,"pool-name":"key","pool-position":-1,"boundaries":[[1,2]],"deliveries":[{"status":"pending"}]}`,
+		// The name of the key is a path.
+		`{"version":5,"pool-name":"../key","pool-position":0,"boundaries":[[1,2]],"deliveries":[{"status":"pending"}]}`,
+		// Boundaries of different lengths.
+		`{"version":5,"pool-name":"key","pool-position":0,"boundaries":[[1,2],[3]],"deliveries":[{"status":"pending"},{"status":"pending"}]}`,
+		// Empty boundary.
+		`{"version":5,"pool-name":"key","pool-position":0,"boundaries":[[]],"deliveries":[{"status":"pending"}]}`,
+		// Duplicated recipient.
+		`{"version":5,"pool-name":"key","pool-position":0,"boundaries":[[1,2]],"deliveries":[{"status":"pending"}],"recipients":[{"address":"a@b.c","deliveries":[{"status":"pending"}]},{"address":"a@b.c","deliveries":[{"status":"pending"}]}]}`,
+		// Journal entry that refers to a missing boundary.
+		`{"version":6,"pool-name":"key","pool-position":0,"boundaries":[[1,2]],"deliveries":[{"status":"sent"}],"journal":[{"date":"2024-01-02T03:04:05Z","recipient":"a@b.c","boundary":1,"message-id":"<1@b.c>"}]}`,
+		// Invalid hash.
+		`{"version":5,"pool-name":"key","pool-position":0,"boundaries":[[1,2]],"deliveries":[{"status":"pending"}],"message-hash":"1234"}`,
+		// Nested session whose boundaries cannot be split into levels.
+		`{"version":21,"pool-name":"key","pool-position":0,"boundaries":[[1,2]],"deliveries":[{"status":"pending"}],"nested":true}`,
+	} {
+		session = Session{}
+		err = os.WriteFile(sessionFile, []byte(jsonText), 0644)
+		assert.Nil(t, err)
+		err = session.Load(sessionFile)
+		assert.NotNil(t, err, jsonText)
+	}
+}
+
+func TestSessionSaveEscaping(t *testing.T) {
+	var err error
+	var session Session
+	var loaded Session
+
+	session.Init(`key "1"`, 0)
+	session.AddBoundary([]byte{0, 255})
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, `key "1"`, loaded.PoolName)
+	assert.Equal(t, [][]uint8{{0, 255}}, loaded.Boundaries)
+}
+
+func TestSessionVerify(t *testing.T) {
+	var err error
+	var session Session
+	var message Message
+	var key *resource.MemoryPool
+	var other *resource.MemoryPool
+	var boundaries [][]byte
+	var decoded []byte
+	var plain = []byte("the message to hide")
+	var material = make([]byte, 256)
+
+	for i := range material {
+		material[i] = byte(i)
+	}
+
+	// Create a session at position 10.
+	key, err = resource.NewMemoryPool(material, 10)
+	assert.Nil(t, err)
+	err = message.FromBytes(plain, 35)
+	assert.Nil(t, err)
+	boundaries, err = message.Encode(key)
+	assert.Nil(t, err)
+	session.Init("key", 10)
+	for _, boundary := range boundaries {
+		session.AddBoundary(boundary)
+	}
+	session.MessageHash = MessageHash(plain)
+
+	// The key has been consumed: the verification does not depend on the current position.
+	err = session.Verify(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(45), key.Position())
+	decoded, err = session.DecodeMessage(key)
+	assert.Nil(t, err)
+	assert.Equal(t, plain, decoded)
+
+	// Wrong key.
+	other, err = resource.NewMemoryPool(make([]byte, 256), 0)
+	assert.Nil(t, err)
+	err = session.Verify(other)
+	assert.NotNil(t, err)
+
+	// Corrupted boundary.
+	session.Boundaries[0][5] ^= 0xff
+	err = session.Verify(key)
+	assert.NotNil(t, err)
+	session.Boundaries[0][5] ^= 0xff
+
+	// Not enough key material.
+	session.PoolPointerPosition = 240
+	err = session.Verify(key)
+	assert.NotNil(t, err)
+	session.PoolPointerPosition = 10
+
+	// No hash.
+	session.MessageHash = ""
+	err = session.Verify(key)
+	assert.True(t, errors.Is(err, ErrNoMessageHash))
+}
+
+func TestSessionAccount(t *testing.T) {
+	var err error
+	var session Session
+	var loaded Session
+
+	session.Init("key", 0)
+	session.Account = &Account{SmtpServer: "smtp.example.com", SmtpPort: 465, From: "john@example.com"}
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, session.Account, loaded.Account)
+
+	// Invalid pin.
+	session.Account.Pin = "abcd"
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Load(sessionFile)
+	assert.NotNil(t, err)
+	session.Account.Pin = strings.Repeat("ab", 32)
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, session.Account.Pin, loaded.Account.Pin)
+
+	// Transport: the SMTP server is only required for SMTP.
+	assert.Equal(t, TransportSmtp, session.Account.TransportName())
+	assert.Nil(t, (&Account{From: "john@example.com", Transport: TransportGraph}).Validate())
+	assert.NotNil(t, (&Account{From: "john@example.com", Transport: TransportSmtp}).Validate())
+	assert.NotNil(t, (&Account{From: "john@example.com", Transport: "pigeon"}).Validate())
+	assert.Nil(t, (&Account{SmtpServer: "smtp.example.com", SmtpPort: 465, From: "john@example.com", Proxy: "socks5://127.0.0.1:9050"}).Validate())
+	assert.NotNil(t, (&Account{SmtpServer: "smtp.example.com", SmtpPort: 465, From: "john@example.com", Proxy: "http://127.0.0.1:8080"}).Validate())
+	assert.NotNil(t, (&Account{From: "john@example.com", Transport: TransportGmail, Proxy: "socks5://127.0.0.1:9050"}).Validate())
+	session.Account.Transport = TransportGmail
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Load(sessionFile)
+	assert.Nil(t, err)
+	assert.Equal(t, TransportGmail, loaded.Account.Transport)
+
+	// Incomplete account.
+	session.Account.From = ""
+	err = session.Save(sessionFile)
+	assert.Nil(t, err)
+	err = loaded.Load(sessionFile)
+	assert.NotNil(t, err)
+}
+
+func TestSessionPoolName(t *testing.T) {
+	var err error
+	var session Session
+	var content []byte
+	var poolName string
+
+	// Only the name of the key is read: the boundaries are not checked.
+	poolName, err = SessionPoolName([]byte(`{"version":30,"pool-name":"key","boundaries":[[1,256]]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "key", poolName)
+	poolName, err = SessionPoolName([]byte(`{"email-index":0,"boundaries":[]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "", poolName)
+	_, err = SessionPoolName([]byte(`{"version":30,`))
+	assert.NotNil(t, err)
+
+	// The name of the key of a protected session is encrypted.
+	session.Init("key", 0)
+	session.AddBoundary([]byte{1, 2})
+	assert.Nil(t, session.Protect([]byte("secret")))
+	assert.Nil(t, session.Save(sessionFile))
+	content, err = os.ReadFile(sessionFile)
+	assert.Nil(t, err)
+	_, err = SessionPoolName(content)
+	assert.ErrorIs(t, err, ErrProtectedSession)
+}
+
+func TestSessionEmlFileName(t *testing.T) {
+	var session Session
+
+	session.Init("key", 0)
+	session.AddBoundary([]byte{1, 2})
+	assert.Equal(t, "holidays-000.eml", session.EmlFileName("holidays", "john@example.com", 0))
+	assert.Equal(t, "holidays-1234.eml", session.EmlFileName("holidays", "john@example.com", 1234))
+
+	// The name of the recipient is added for a multi-recipient session.
+	assert.Nil(t, session.AddRecipient("john@example.com"))
+	assert.Equal(t, "holidays-john@example.com-007.eml", session.EmlFileName("holidays", "john@example.com", 7))
+}
@@ -0,0 +1,174 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// softBreaksCarrierLength The number of bytes hidden by the soft line breaks of the quoted-printable encoded part of an
+// email, by default.
+const softBreaksCarrierLength = 2
+
+// softBreaksCarrierMaxLength The maximum number of bytes hidden by the soft line breaks (the lines of the text must be
+// long enough, see `softBreaks`).
+const softBreaksCarrierMaxLength = 32
+
+// softBreakBits The number of bits hidden by a soft line break: the number of characters (once decoded) of the line it
+// terminates, modulo 4.
+const softBreakBits = 2
+
+// qpLineLength The maximum length of the lines of quoted-printable encoded content, including the "=" of the soft line
+// breaks (RFC 2045).
+const qpLineLength = 76
+
+// softBreaks The positions of the soft line breaks ("=" at the end of a line) of the quoted-printable encoded part of
+// an email, that hide bytes of a chunk of the message (see `CarrierSoftBreaks`). The lines of the text longer than 76
+// characters are split by soft line breaks: each soft line break terminates a line whose number of characters (once
+// decoded) hides 2 bits. The soft line breaks that follow the hidden bytes are placed at random.
+type softBreaks struct {
+	payload []byte
+	// position The number of bits hidden so far.
+	position int
+}
+
+// newSoftBreaks Returns the positions of the soft line breaks that hide a given payload, or nil if the payload is
+// empty (the text is then encoded by `quotedprintable.Writer`).
+func newSoftBreaks(payload []byte) *softBreaks {
+	if len(payload) == 0 {
+		return nil
+	}
+	return &softBreaks{payload: payload}
+}
+
+// next Returns the value hidden by the next soft line break.
+func (b *softBreaks) next() (int, error) {
+	var value [1]byte
+
+	if b.position >= 8*len(b.payload) {
+		if _, err := rand.Read(value[:]); err != nil {
+			return 0, err
+		}
+		return int(value[0] & (1<<softBreakBits - 1)), nil
+	}
+	value[0] = b.payload[b.position/8] >> (8 - softBreakBits - b.position%8) & (1<<softBreakBits - 1)
+	b.position += softBreakBits
+	return int(value[0]), nil
+}
+
+// check Checks that all the bytes are hidden, once the part is written.
+func (b *softBreaks) check() error {
+	if b != nil && b.position < 8*len(b.payload) {
+		return fmt.Errorf(`the lines of the quoted-printable encoded part of the email are too short to hide %d bytes (%d bits hidden)`, len(b.payload), b.position)
+	}
+	return nil
+}
+
+// encode Encodes a text in quoted-printable (RFC 2045), placing the soft line breaks so that they hide the payload.
+// The decoded text is the same as the one encoded by `quotedprintable.Writer`: the line breaks are written as CRLF.
+func (b *softBreaks) encode(text []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	var lines [][]byte
+
+	// As `quotedprintable.Writer`, CR and LF are line breaks as well as CRLF.
+	text = bytes.ReplaceAll(bytes.ReplaceAll(text, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))
+	lines = bytes.Split(text, []byte("\n"))
+
+	for i, line := range lines {
+		var tokens = qpTokens(line)
+
+		for qpLength(tokens) > qpLineLength {
+			var value int
+			var count int
+			var err error
+
+			// The longest line that hides the value, and leaves room for the "=".
+			for count < len(tokens) && qpLength(tokens[:count+1]) < qpLineLength {
+				count++
+			}
+			if value, err = b.next(); err != nil {
+				return nil, err
+			}
+			count -= (count - value + 1<<softBreakBits) % (1 << softBreakBits)
+			buffer.WriteString(strings.Join(tokens[:count], ""))
+			buffer.WriteString("=\r\n")
+			tokens = tokens[count:]
+		}
+		buffer.WriteString(strings.Join(tokens, ""))
+		if i < len(lines)-1 {
+			buffer.WriteString("\r\n")
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// SoftBreaksPayload Extracts the bytes hidden by the soft line breaks of the quoted-printable encoded parts of an email
+// (RFC 5322): `length` bytes.
+func SoftBreaksPayload(content []byte, length int) ([]byte, error) {
+	var err error
+	var parts []leafPart
+	var payload = make([]byte, length)
+	var position int
+
+	if parts, err = leafParts(content); err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		if !strings.EqualFold(strings.TrimSpace(part.header.Get("Content-Transfer-Encoding")), TextEncodingQuotedPrintable) {
+			continue
+		}
+		for _, line := range strings.Split(string(part.body), "\n") {
+			// The transport may add whitespaces at the end of the lines.
+			line = strings.TrimRight(line, " \t\r")
+			if !strings.HasSuffix(line, "=") || position >= 8*length {
+				continue
+			}
+			payload[position/8] |= byte(qpCount(line[:len(line)-1])%(1<<softBreakBits)) << (8 - softBreakBits - position%8)
+			position += softBreakBits
+		}
+	}
+	if position < 8*length {
+		return nil, fmt.Errorf(`the quoted-printable encoded parts of the email hide less than %d bytes`, length)
+	}
+	return payload, nil
+}
+
+// qpTokens Returns the characters of a line of text, encoded in quoted-printable: each character is written as is, or
+// as "=XX". The spaces and the tabs at the end of the line are encoded.
+func qpTokens(line []byte) []string {
+	var tokens []string
+	var end = len(bytes.TrimRight(line, " \t"))
+
+	for i, c := range line {
+		if (c >= '!' && c <= '~' && c != '=') || ((c == ' ' || c == '\t') && i < end) {
+			tokens = append(tokens, string(c))
+		} else {
+			tokens = append(tokens, fmt.Sprintf("=%02X", c))
+		}
+	}
+	return tokens
+}
+
+// qpLength Returns the length of encoded characters (see `qpTokens`).
+func qpLength(tokens []string) int {
+	var length int
+
+	for _, token := range tokens {
+		length += len(token)
+	}
+	return length
+}
+
+// qpCount Returns the number of characters of a line of quoted-printable encoded content, once decoded.
+func qpCount(line string) int {
+	var count int
+
+	for i := 0; i < len(line); i++ {
+		if line[i] == '=' {
+			i += 2
+		}
+		count++
+	}
+	return count
+}
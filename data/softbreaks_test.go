@@ -0,0 +1,65 @@
+package data
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+)
+
+func TestSoftBreaks(t *testing.T) {
+	var paragraph = "Hello John, how are you? Ça va ? I have looked at the photos = great, especially the lake. \t"
+	var text = []byte(strings.Repeat(strings.Repeat(paragraph, 3)+"\n\n", 5) + "Bye\r\n")
+	var boundary = strings.Repeat("0a", 35)
+	var payload = []byte{0x00, 0xFF, 0xA5, 0x3C}
+	var err error
+	var content []byte
+	var email []byte
+	var extracted []byte
+	var reader *multipart.Reader
+	var part *multipart.Part
+	var decoded []byte
+	var expected bytes.Buffer
+	var writer *quotedprintable.Writer
+	var expectedText []byte
+
+	content, err = BuildAlternative(boundary, text, []byte("<p>Hello</p>"), TextEncodingQuotedPrintable, "", BodyPayloads{SoftBreaks: payload})
+	assert.Nil(t, err)
+	for _, line := range strings.Split(string(content), "\r\n") {
+		assert.LessOrEqual(t, len(line), 76)
+	}
+	email = append([]byte("From: a@example.com\r\nContent-Type: multipart/alternative; boundary=\""+boundary+"\"\r\n\r\n"), content...)
+	extracted, err = SoftBreaksPayload(email, len(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, payload, extracted)
+
+	// The text is the one written by the standard library.
+	writer = quotedprintable.NewWriter(&expected)
+	_, _ = writer.Write(text)
+	_ = writer.Close()
+	reader = multipart.NewReader(bytes.NewReader(content), boundary)
+	part, err = reader.NextPart()
+	assert.Nil(t, err)
+	decoded, _ = io.ReadAll(part)
+	assert.Equal(t, strings.ReplaceAll(string(text), "\r\n", "\n"), strings.ReplaceAll(string(decoded), "\r\n", "\n"))
+	expectedText, _ = io.ReadAll(quotedprintable.NewReader(&expected))
+	assert.Equal(t, expectedText, decoded)
+
+	// We'll get errors...
+	_, err = BuildAlternative(boundary, []byte(paragraph), nil, TextEncodingQuotedPrintable, "", BodyPayloads{SoftBreaks: payload})
+	assert.NotNil(t, err)
+	_, err = SoftBreaksPayload([]byte("Content-Transfer-Encoding: quoted-printable\r\n\r\nHello=\r\nJohn\r\n"), 1)
+	assert.NotNil(t, err)
+}
+
+func TestCarriersCheckTextEncoding(t *testing.T) {
+	var carriers = Carriers{{Name: CarrierBoundary, Length: 35}, {Name: CarrierSoftBreaks, Length: 2}}
+
+	assert.Nil(t, carriers.CheckTextEncoding(TextEncodingQuotedPrintable))
+	assert.NotNil(t, carriers.CheckTextEncoding(""))
+	assert.NotNil(t, carriers.CheckTextEncoding(TextEncodingBase64))
+	assert.Nil(t, carriers[:1].CheckTextEncoding(""))
+}
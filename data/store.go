@@ -0,0 +1,193 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrNotFound Returned when a session (or the metadata of a key) does not exist into a store.
+var ErrNotFound = errors.New("not found")
+
+// KeyInfo The metadata of a key.
+type KeyInfo struct {
+	Name string `json:"name"`
+	// Created The creation date of the key.
+	Created time.Time `json:"created"`
+	// Origin How the key has been created (for example: the command and the source files).
+	Origin string `json:"origin"`
+}
+
+// Store A storage for sessions and keys metadata.
+// Sessions are stored as given by `Session.Serialize`: the store does not need to decrypt protected sessions.
+type Store interface {
+	// ReadSession Returns the serialized representation of a session, or an error that wraps `ErrNotFound`.
+	ReadSession(name string) ([]byte, error)
+	// WriteSession Stores the serialized representation of a session.
+	WriteSession(name string, content []byte) error
+	// DeleteSession Removes a session. It returns an error that wraps `ErrNotFound` if the session does not exist.
+	DeleteSession(name string) error
+	// ListSessions Returns the names of all the sessions (sorted).
+	ListSessions() ([]string, error)
+	// ReadKeyInfo Returns the metadata of a key, or an error that wraps `ErrNotFound`.
+	ReadKeyInfo(name string) (*KeyInfo, error)
+	// WriteKeyInfo Stores the metadata of a key.
+	WriteKeyInfo(info *KeyInfo) error
+	// DeleteKeyInfo Removes the metadata of a key (if any).
+	DeleteKeyInfo(name string) error
+	Close() error
+}
+
+// LoadSession Loads a session from a store.
+func LoadSession(store Store, name string, session *Session) error {
+	var err error
+	var content []byte
+
+	if content, err = store.ReadSession(name); err != nil {
+		return err
+	}
+	return session.Deserialize(name, content)
+}
+
+// SaveSession Saves a session into a store.
+func SaveSession(store Store, name string, session *Session) error {
+	var err error
+	var content []byte
+
+	if content, err = session.Serialize(); err != nil {
+		return err
+	}
+	return store.WriteSession(name, content)
+}
+
+// FileStore A store that keeps each session into a file (within a directory), and the metadata of all the keys into a
+// single JSON file.
+type FileStore struct {
+	SessionDir  string
+	KeyInfoPath string
+}
+
+// NewFileStore Creates a store backed by files.
+func NewFileStore(sessionDir string, keyInfoPath string) *FileStore {
+	return &FileStore{SessionDir: sessionDir, KeyInfoPath: keyInfoPath}
+}
+
+func (f *FileStore) ReadSession(name string) ([]byte, error) {
+	var err error
+	var content []byte
+
+	if content, err = os.ReadFile(filepath.Join(f.SessionDir, name)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf(`session "%s": %w`, name, ErrNotFound)
+		}
+		return nil, err
+	}
+	return content, nil
+}
+
+func (f *FileStore) WriteSession(name string, content []byte) error {
+	return writeAtomically(filepath.Join(f.SessionDir, name), content)
+}
+
+func (f *FileStore) DeleteSession(name string) error {
+	var err error
+
+	if err = os.Remove(filepath.Join(f.SessionDir, name)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf(`session "%s": %w`, name, ErrNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+func (f *FileStore) ListSessions() ([]string, error) {
+	var err error
+	var entries []os.DirEntry
+	var names []string
+
+	if entries, err = os.ReadDir(f.SessionDir); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		// Skip the temporary files left by an interrupted write, and the lock files.
+		if entry.IsDir() || filepath.Ext(entry.Name()) == ".tmp" || filepath.Ext(entry.Name()) == lockExtension {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *FileStore) ReadKeyInfo(name string) (*KeyInfo, error) {
+	var err error
+	var infos map[string]*KeyInfo
+
+	if infos, err = f.readKeyInfos(); err != nil {
+		return nil, err
+	}
+	if info, ok := infos[name]; ok {
+		return info, nil
+	}
+	return nil, fmt.Errorf(`key "%s": %w`, name, ErrNotFound)
+}
+
+func (f *FileStore) WriteKeyInfo(info *KeyInfo) error {
+	var err error
+	var infos map[string]*KeyInfo
+
+	if infos, err = f.readKeyInfos(); err != nil {
+		return err
+	}
+	infos[info.Name] = info
+	return f.writeKeyInfos(infos)
+}
+
+func (f *FileStore) DeleteKeyInfo(name string) error {
+	var err error
+	var infos map[string]*KeyInfo
+
+	if infos, err = f.readKeyInfos(); err != nil {
+		return err
+	}
+	delete(infos, name)
+	return f.writeKeyInfos(infos)
+}
+
+func (f *FileStore) Close() error {
+	return nil
+}
+
+// readKeyInfos Loads the metadata of all the keys.
+func (f *FileStore) readKeyInfos() (map[string]*KeyInfo, error) {
+	var err error
+	var content []byte
+	var infos = make(map[string]*KeyInfo)
+
+	if content, err = os.ReadFile(f.KeyInfoPath); err != nil {
+		if os.IsNotExist(err) {
+			return infos, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &infos); err != nil {
+		return nil, fmt.Errorf(`invalid keys metadata file "%s": %s`, f.KeyInfoPath, err.Error())
+	}
+	return infos, nil
+}
+
+// writeKeyInfos Saves the metadata of all the keys.
+func (f *FileStore) writeKeyInfos(infos map[string]*KeyInfo) error {
+	var err error
+	var content []byte
+
+	if content, err = json.MarshalIndent(infos, "", "  "); err != nil {
+		return err
+	}
+	return writeAtomically(f.KeyInfoPath, content)
+}
@@ -0,0 +1,143 @@
+package data
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStore Checks the behavior common to all the stores.
+func testStore(t *testing.T, store Store) {
+	var err error
+	var session Session
+	var loaded Session
+	var names []string
+	var info *KeyInfo
+	var created = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Sessions.
+	_, err = store.ReadSession("first")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	session.Init("key", 10)
+	session.AddBoundary([]byte{1, 2})
+	err = SaveSession(store, "first", &session)
+	assert.Nil(t, err)
+	err = SaveSession(store, "second", &session)
+	assert.Nil(t, err)
+	err = LoadSession(store, "first", &loaded)
+	assert.Nil(t, err)
+	assert.Equal(t, "key", loaded.PoolName)
+	assert.Equal(t, [][]uint8{{1, 2}}, loaded.Boundaries)
+	names, err = store.ListSessions()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first", "second"}, names)
+	err = store.DeleteSession("second")
+	assert.Nil(t, err)
+	err = store.DeleteSession("second")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	names, err = store.ListSessions()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first"}, names)
+
+	// Keys metadata.
+	_, err = store.ReadKeyInfo("key")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	err = store.WriteKeyInfo(&KeyInfo{Name: "key", Created: created, Origin: "create-key"})
+	assert.Nil(t, err)
+	info, err = store.ReadKeyInfo("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "create-key", info.Origin)
+	assert.True(t, created.Equal(info.Created))
+	err = store.DeleteKeyInfo("key")
+	assert.Nil(t, err)
+	_, err = store.ReadKeyInfo("key")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestFileStore(t *testing.T) {
+	var dir = t.TempDir()
+	var store = NewFileStore(dir, filepath.Join(t.TempDir(), "keys.json"))
+
+	testStore(t, store)
+	// The sessions are stored as files.
+	_, err := os.Stat(filepath.Join(dir, "first"))
+	assert.Nil(t, err)
+}
+
+func TestBoltStore(t *testing.T) {
+	var err error
+	var store *BoltStore
+
+	store, err = BoltOpen(filepath.Join(t.TempDir(), "umail.db"), nil)
+	assert.Nil(t, err)
+	defer store.Close()
+	testStore(t, store)
+}
+
+func TestBoltStoreShared(t *testing.T) {
+	var err error
+	var path = filepath.Join(t.TempDir(), "umail.db")
+	var first, second *BoltStore
+	var db *bolt.DB
+	var content []byte
+
+	first, err = BoltOpen(path, nil)
+	assert.Nil(t, err)
+	defer first.Close()
+	assert.Nil(t, first.WriteSession("session", []byte("first")))
+
+	// The database is not held between the operations: another process can lock it without waiting.
+	db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: 100 * time.Millisecond})
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	second, err = BoltOpen(path, nil)
+	assert.Nil(t, err)
+	defer second.Close()
+	content, err = second.ReadSession("session")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("first"), content)
+	assert.Nil(t, second.WriteSession("session", []byte("second")))
+	content, err = first.ReadSession("session")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("second"), content)
+}
+
+func TestBoltStoreFallback(t *testing.T) {
+	var err error
+	var files = NewFileStore(t.TempDir(), filepath.Join(t.TempDir(), "keys.json"))
+	var store *BoltStore
+	var session Session
+	var names []string
+	var imported []string
+
+	session.Init("key", 0)
+	assert.Nil(t, SaveSession(files, "legacy", &session))
+	assert.Nil(t, SaveSession(files, "other", &session))
+	store, err = BoltOpen(filepath.Join(t.TempDir(), "umail.db"), files)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	// The sessions stored as files are still available.
+	assert.Nil(t, LoadSession(store, "legacy", &session))
+	assert.Nil(t, SaveSession(store, "new", &session))
+	names, err = store.ListSessions()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"legacy", "new", "other"}, names)
+
+	// Import the sessions into the database.
+	session.Note = "modified"
+	assert.Nil(t, SaveSession(store, "other", &session))
+	imported, err = store.Import(files)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"legacy"}, imported)
+	assert.Nil(t, files.DeleteSession("legacy"))
+	assert.Nil(t, files.DeleteSession("other"))
+	assert.Nil(t, LoadSession(store, "legacy", &session))
+	assert.Nil(t, LoadSession(store, "other", &session))
+	assert.Equal(t, "modified", session.Note)
+}
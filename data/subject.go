@@ -0,0 +1,166 @@
+package data
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+	"umail/resource"
+)
+
+// subjectCarrierLength The number of bytes hidden by the subject of an email: 4 bits per fragment.
+const subjectCarrierLength = 2
+
+// subjectBits The number of bits hidden by a fragment of a subject.
+const subjectBits = 4
+
+// CodebookKeyLength The length, in bytes, of the key of a codebook (see `NewCodebook`).
+const CodebookKeyLength = 32
+
+// subjectFragments The fragments of the subjects, per position: each value of 4 bits selects one of the 16 fragments.
+// No fragment is the first words of another fragment of the same position.
+var subjectFragments = [][]string{
+	{"Quick", "Short", "Small", "Brief", "Friendly", "Gentle", "Final", "Urgent", "Important", "Little", "Another",
+		"One more", "Latest", "New", "Updated", "Simple"},
+	{"question", "update", "note", "reminder", "request", "thought", "idea", "follow-up", "check-in", "heads-up",
+		"point", "detail", "change", "suggestion", "message", "remark"},
+	{"the meeting", "the project", "the report", "the trip", "the plan", "the budget", "the schedule", "the draft",
+		"the invoice", "the weekend", "the dinner", "the contract", "the order", "the presentation", "the review",
+		"the photos"},
+	{"for today", "for tomorrow", "for Monday", "this week", "next week", "before Friday", "(again)", "- thanks",
+		"when you can", "asap", "tonight", "this morning", "this afternoon", "for later", "for the weekend",
+		"if possible"},
+}
+
+// subjectSeparators The texts written between the fragments of the subjects.
+var subjectSeparators = []string{" ", " about ", " "}
+
+// subjectReplyPrefixes The prefixes of the subjects of the replies and forwarded emails, ignored when the subject is
+// read.
+var subjectReplyPrefixes = []string{"re:", "aw:", "sv:", "fw:", "fwd:", "tr:"}
+
+// Codebook The fragments of the subjects, in an order given by a key (see `NewCodebook`). The subjects written by
+// two codebooks that have different keys cannot be read by each other.
+type Codebook [][]string
+
+// NewCodebookKey Derives the key of the codebook of a hidden message from the key material it uses (the key material
+// that starts at `position`), as a hexadecimal text. Each message has its own codebook.
+func NewCodebookKey(key resource.KeySource, position int64) (string, error) {
+	var err error
+	var digest []byte
+
+	if digest, err = deriveFromKey(key, position, "umail-codebook"); err != nil {
+		return "", fmt.Errorf(`cannot derive the codebook from the key material at position %d: %s`, position, err.Error())
+	}
+	return hex.EncodeToString(digest[:CodebookKeyLength]), nil
+}
+
+// NewCodebook Creates the codebook given by a key (see `NewCodebookKey`): the fragments of each position are sorted by
+// their HMAC.
+func NewCodebook(key string) (Codebook, error) {
+	var err error
+	var secret []byte
+	var codebook Codebook
+
+	if secret, err = hex.DecodeString(key); err != nil || len(secret) != CodebookKeyLength {
+		return nil, fmt.Errorf(`invalid codebook key (expected %d hexadecimal digits)`, 2*CodebookKeyLength)
+	}
+	for position, fragments := range subjectFragments {
+		var sorted = make([]string, len(fragments))
+		var macs = map[string][]byte{}
+
+		for _, fragment := range fragments {
+			var mac = hmac.New(sha256.New, secret)
+			mac.Write([]byte{byte(position)})
+			mac.Write([]byte(fragment))
+			macs[fragment] = mac.Sum(nil)
+		}
+		copy(sorted, fragments)
+		sort.Slice(sorted, func(i, j int) bool {
+			return bytes.Compare(macs[sorted[i]], macs[sorted[j]]) < 0
+		})
+		codebook = append(codebook, sorted)
+	}
+	return codebook, nil
+}
+
+// Subject Returns the subject that hides bytes of a chunk of the message (see `CarrierSubject`).
+func (c Codebook) Subject(payload []byte) (string, error) {
+	var subject strings.Builder
+
+	if len(payload) != subjectCarrierLength {
+		return "", fmt.Errorf(`a subject hides %d bytes (%d given)`, subjectCarrierLength, len(payload))
+	}
+	for position, fragments := range c {
+		var value = payload[position/2]
+		if position%2 == 0 {
+			value >>= subjectBits
+		}
+		if position > 0 {
+			subject.WriteString(subjectSeparators[position-1])
+		}
+		subject.WriteString(fragments[value&(1<<subjectBits-1)])
+	}
+	return subject.String(), nil
+}
+
+// Payload Extracts the bytes hidden by the subject of an email (see `Subject`): `length` bytes. The prefixes of the
+// replies ("Re:") are ignored, as well as the case of the letters.
+func (c Codebook) Payload(subject string, length int) ([]byte, error) {
+	var payload = make([]byte, subjectCarrierLength)
+	var text string
+
+	if length != subjectCarrierLength {
+		return nil, fmt.Errorf(`a subject hides %d bytes (%d expected)`, subjectCarrierLength, length)
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	text = trimReplyPrefixes(strings.ToLower(strings.TrimSpace(subject)))
+	for position, fragments := range c {
+		var value = -1
+		var size int
+
+		if position > 0 {
+			if !strings.HasPrefix(text, subjectSeparators[position-1]) {
+				return nil, fmt.Errorf(`the subject "%s" hides no bytes`, subject)
+			}
+			text = text[len(subjectSeparators[position-1]):]
+		}
+		for i, fragment := range fragments {
+			if fragment = strings.ToLower(fragment); strings.HasPrefix(text, fragment) && len(fragment) > size {
+				value, size = i, len(fragment)
+			}
+		}
+		if value < 0 {
+			return nil, fmt.Errorf(`the subject "%s" hides no bytes`, subject)
+		}
+		text = text[size:]
+		if position%2 == 0 {
+			value <<= subjectBits
+		}
+		payload[position/2] |= byte(value)
+	}
+	if len(text) > 0 {
+		return nil, fmt.Errorf(`the subject "%s" hides no bytes`, subject)
+	}
+	return payload, nil
+}
+
+// trimReplyPrefixes Removes the prefixes of the replies and forwarded emails from a subject (in lower case).
+func trimReplyPrefixes(subject string) string {
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, prefix := range subjectReplyPrefixes {
+			if strings.HasPrefix(subject, prefix) {
+				subject = strings.TrimSpace(subject[len(prefix):])
+				trimmed = true
+			}
+		}
+	}
+	return subject
+}
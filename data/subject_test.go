@@ -0,0 +1,63 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"umail/resource"
+)
+
+func TestCodebook(t *testing.T) {
+	var err error
+	var pad []byte
+	var key *resource.MemoryPool
+	var codebookKey, otherKey string
+	var codebook, other Codebook
+	var subject string
+	var payload []byte
+
+	for i := 0; i < 256; i++ {
+		pad = append(pad, byte(i))
+	}
+	key, err = resource.NewMemoryPool(pad, 0)
+	assert.Nil(t, err)
+	codebookKey, err = NewCodebookKey(key, 40)
+	assert.Nil(t, err)
+	assert.Len(t, codebookKey, 2*CodebookKeyLength)
+	otherKey, err = NewCodebookKey(key, 41)
+	assert.Nil(t, err)
+	codebook, err = NewCodebook(codebookKey)
+	assert.Nil(t, err)
+	other, err = NewCodebook(otherKey)
+	assert.Nil(t, err)
+	assert.NotEqual(t, codebook, other)
+
+	for value := 0; value < 65536; value += 257 {
+		var hidden = []byte{byte(value >> 8), byte(value)}
+		subject, err = codebook.Subject(hidden)
+		assert.Nil(t, err)
+		assert.Contains(t, subject, " about the ")
+		payload, err = codebook.Payload(subject, 2)
+		assert.Nil(t, err)
+		assert.Equal(t, hidden, payload, subject)
+		// The replies, and the case of the letters, are ignored.
+		payload, err = codebook.Payload("RE: Fwd: "+strings.ToUpper(subject), 2)
+		assert.Nil(t, err)
+		assert.Equal(t, hidden, payload, subject)
+	}
+	subject, _ = codebook.Subject([]byte{0x12, 0x34})
+	payload, _ = other.Payload(subject, 2)
+	assert.NotEqual(t, []byte{0x12, 0x34}, payload)
+
+	// We'll get errors...
+	_, err = NewCodebook("1234")
+	assert.NotNil(t, err)
+	_, err = codebook.Subject([]byte{1})
+	assert.NotNil(t, err)
+	for _, text := range []string{"Hello", "", subject + " !", "Quick question on the meeting today"} {
+		_, err = codebook.Payload(text, 2)
+		assert.NotNil(t, err, text)
+	}
+	_, err = codebook.Payload(subject, 1)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"umail/resource"
+)
+
+// SyncPreambleLength The length, in bytes, of a synchronization preamble (the length of a boundary).
+const SyncPreambleLength = 35
+
+// syncFingerprintLength The length, in bytes, of the key fingerprint embedded into the preamble.
+const syncFingerprintLength = 12
+
+// syncKeyMaterialLength The number of key bytes dedicated to the fingerprint (see `SyncPoint`).
+const syncKeyMaterialLength = 32
+
+// syncNonceLength The length, in bytes, of the random nonce that starts the preamble.
+const syncNonceLength = SyncPreambleLength - 8 - 8 - syncFingerprintLength
+
+// SyncPoint The positions given by a synchronization preamble.
+type SyncPoint struct {
+	// Position The position of the key material used by the message.
+	Position int64
+	// Material The position of the key material dedicated to the fingerprint of the preamble. This key material is
+	// consumed by the sender, and never used to encrypt anything: the fingerprint tells nothing about the message.
+	Material int64
+}
+
+// Start Returns the position of the first key material used by the sender: the position the receiver's key must be
+// at.
+func (p SyncPoint) Start() int64 {
+	if p.Material < p.Position {
+		return p.Material
+	}
+	return p.Position
+}
+
+// Next Returns the position of the key material of the next message, given the end of the key material used by the
+// message (see `DecodeExtent`): the key material dedicated to the fingerprint is skipped if it follows the message.
+func (p SyncPoint) Next(end int64) int64 {
+	if p.Material >= p.Position && end == p.Material {
+		return end + syncKeyMaterialLength
+	}
+	return end
+}
+
+// SyncPreamble Creates a synchronization preamble that tells the receiver the position of the key material used by
+// the sender (`position`), and a fingerprint of the key. The preamble is sent as a boundary (before the boundaries of a
+// session), so that the receiver can check that its copy of the key is synchronized with the sender's one.
+//
+//	nonce (7 bytes) | position XOR mask (8 bytes) | material position XOR mask (8 bytes) | fingerprint (12 bytes)
+//
+// The fingerprint is computed over key material dedicated to it, which is consumed (at the current position of the
+// key): the key material used by the message must not be fingerprinted, or else anyone could check guesses of the
+// message against the preamble. If the message uses the key material at the current position of the key (lazy
+// session), then it uses the key material that follows the dedicated one.
+// Please note that the positions are only masked (not encrypted): the preamble looks random, but anyone who knows the
+// format can retrieve the positions.
+func SyncPreamble(key resource.KeySource, position int64) ([]byte, SyncPoint, error) {
+	var err error
+	var preamble = make([]byte, SyncPreambleLength)
+	var point = SyncPoint{Position: position, Material: key.Position()}
+	var material []byte
+	var positionMask, materialMask uint64
+
+	if position > point.Material {
+		return nil, SyncPoint{}, fmt.Errorf(`the key material at %d has not been consumed yet (the position of the key is %d)`, position, point.Material)
+	}
+	if position == point.Material {
+		point.Position += syncKeyMaterialLength
+	}
+	if _, err = rand.Read(preamble[:syncNonceLength]); err != nil {
+		return nil, SyncPoint{}, err
+	}
+	if material, err = key.Read(syncKeyMaterialLength); err != nil {
+		return nil, SyncPoint{}, fmt.Errorf(`not enough key material left for the fingerprint: %s`, err.Error())
+	}
+	positionMask, materialMask = syncMasks(preamble[:syncNonceLength])
+	binary.LittleEndian.PutUint64(preamble[syncNonceLength:], uint64(point.Position)^positionMask)
+	binary.LittleEndian.PutUint64(preamble[syncNonceLength+8:], uint64(point.Material)^materialMask)
+	copy(preamble[syncNonceLength+16:], syncFingerprint(preamble[:syncNonceLength], point, material))
+	return preamble, point, nil
+}
+
+// SyncVerify Checks a synchronization preamble against the local copy of the key. It returns the positions given by
+// the sender. An error is returned if the local copy of the key is not synchronized with the sender's one (or if the
+// key material is different).
+func SyncVerify(preamble []byte, key resource.KeySource) (SyncPoint, error) {
+	var err error
+	var point SyncPoint
+	var material []byte
+	var positionMask, materialMask uint64
+
+	if len(preamble) != SyncPreambleLength {
+		return point, fmt.Errorf(`invalid synchronization preamble: invalid length (%d bytes instead of %d)`, len(preamble), SyncPreambleLength)
+	}
+	positionMask, materialMask = syncMasks(preamble[:syncNonceLength])
+	point.Position = int64(binary.LittleEndian.Uint64(preamble[syncNonceLength:]) ^ positionMask)
+	point.Material = int64(binary.LittleEndian.Uint64(preamble[syncNonceLength+8:]) ^ materialMask)
+	if point.Position < 0 || point.Material < 0 {
+		return point, fmt.Errorf(`invalid synchronization preamble: invalid positions (%d, %d)`, point.Position, point.Material)
+	}
+	if material, err = key.ReadAt(point.Material, syncKeyMaterialLength); err != nil {
+		return point, fmt.Errorf(`pools are out of sync: the sender expects the position %d, which does not exist into the local key (%s)`, point.Material, err.Error())
+	}
+	if !bytes.Equal(syncFingerprint(preamble[:syncNonceLength], point, material), preamble[syncNonceLength+16:]) {
+		return point, fmt.Errorf(`pools are out of sync: the key material at position %d is not the one used by the sender (wrong key?)`, point.Material)
+	}
+	if point.Start() != key.Position() {
+		return point, fmt.Errorf(`pools are out of sync: the sender expects the position %d, but the local position is %d`, point.Start(), key.Position())
+	}
+	return point, nil
+}
+
+// syncMasks Returns the values used to mask the positions (the position of the message, and the one of the key
+// material dedicated to the fingerprint).
+func syncMasks(nonce []byte) (uint64, uint64) {
+	var sum = sha256.Sum256(nonce)
+	return binary.LittleEndian.Uint64(sum[:8]), binary.LittleEndian.Uint64(sum[8:16])
+}
+
+// syncFingerprint Computes the fingerprint of the key material dedicated to a preamble.
+func syncFingerprint(nonce []byte, point SyncPoint, material []byte) []byte {
+	var hash = sha256.New()
+	var positions = make([]byte, 16)
+
+	binary.LittleEndian.PutUint64(positions, uint64(point.Position))
+	binary.LittleEndian.PutUint64(positions[8:], uint64(point.Material))
+	hash.Write([]byte("umail-sync"))
+	hash.Write(nonce)
+	hash.Write(positions)
+	hash.Write(material)
+	return hash.Sum(nil)[:syncFingerprintLength]
+}
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"umail/resource"
+)
+
+func TestSync(t *testing.T) {
+	var err error
+	var pad []byte
+	var other []byte
+	var key *resource.MemoryPool
+	var preamble []byte
+	var point SyncPoint
+	var verified SyncPoint
+
+	for i := 0; i < 256; i++ {
+		pad = append(pad, byte(i))
+		other = append(other, byte(255-i))
+	}
+
+	// The session uses the key material from 40 to 100: the fingerprint uses the key material that follows.
+	key, err = resource.NewMemoryPool(pad, 100)
+	assert.Nil(t, err)
+	preamble, point, err = SyncPreamble(key, 40)
+	assert.Nil(t, err)
+	assert.Len(t, preamble, SyncPreambleLength)
+	assert.Equal(t, SyncPoint{Position: 40, Material: 100}, point)
+	assert.Equal(t, int64(100+syncKeyMaterialLength), key.Position())
+
+	// The receiver is synchronized. Once the message is decoded, the key material of the fingerprint is skipped.
+	key, err = resource.NewMemoryPool(pad, 40)
+	assert.Nil(t, err)
+	verified, err = SyncVerify(preamble, key)
+	assert.Nil(t, err)
+	assert.Equal(t, point, verified)
+	assert.Equal(t, int64(40), verified.Start())
+	assert.Equal(t, int64(100+syncKeyMaterialLength), verified.Next(100))
+	assert.Equal(t, int64(90), verified.Next(90))
+
+	// The receiver is not synchronized.
+	key, err = resource.NewMemoryPool(pad, 75)
+	assert.Nil(t, err)
+	verified, err = SyncVerify(preamble, key)
+	assert.NotNil(t, err)
+	assert.Equal(t, point, verified)
+
+	// The receiver does not have the right key.
+	key, err = resource.NewMemoryPool(other, 40)
+	assert.Nil(t, err)
+	_, err = SyncVerify(preamble, key)
+	assert.NotNil(t, err)
+
+	// The position does not exist.
+	key, err = resource.NewMemoryPool(pad[:120], 40)
+	assert.Nil(t, err)
+	_, err = SyncVerify(preamble, key)
+	assert.NotNil(t, err)
+
+	// We'll get errors...
+	key, err = resource.NewMemoryPool(pad, 30)
+	assert.Nil(t, err)
+	_, _, err = SyncPreamble(key, 40)
+	assert.NotNil(t, err)
+	key, err = resource.NewMemoryPool(pad, 240)
+	assert.Nil(t, err)
+	_, _, err = SyncPreamble(key, 240)
+	assert.NotNil(t, err)
+	_, err = SyncVerify(preamble[:20], key)
+	assert.NotNil(t, err)
+}
+
+func TestSyncLazy(t *testing.T) {
+	var err error
+	var pad []byte
+	var key *resource.MemoryPool
+	var preamble []byte
+	var point SyncPoint
+	var verified SyncPoint
+	var boundaries [][]byte
+	var message []byte
+	var end int64
+	var secret = []byte("This is the secret message!")
+
+	for i := 0; i < 256; i++ {
+		pad = append(pad, byte(i))
+	}
+
+	// The message uses the key material that follows the key material of the fingerprint.
+	key, err = resource.NewMemoryPool(pad, 40)
+	assert.Nil(t, err)
+	preamble, point, err = SyncPreamble(key, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, SyncPoint{Position: 40 + syncKeyMaterialLength, Material: 40}, point)
+	boundaries, err = EncodeMessage(secret, chunkSize, key, Encoding{})
+	assert.Nil(t, err)
+
+	// The receiver's key is at the key material of the fingerprint: the message is decoded from the position given.
+	key, err = resource.NewMemoryPool(pad, 40)
+	assert.Nil(t, err)
+	verified, err = SyncVerify(preamble, key)
+	assert.Nil(t, err)
+	assert.Equal(t, point, verified)
+	assert.Nil(t, key.Consume(verified.Position-key.Position()))
+	message, _, end, err = DecodeExtent(boundaries, key)
+	assert.Nil(t, err)
+	assert.Equal(t, secret, message)
+	assert.Equal(t, end, verified.Next(end))
+}
+
+func TestSyncFingerprintedBytes(t *testing.T) {
+	// The fingerprint does not depend on the key material used by the message: the preamble cannot be used to check
+	// guesses of the message.
+	for _, test := range []struct {
+		keyPosition int64
+		position    int64
+		end         int64
+	}{
+		{keyPosition: 100, position: 40, end: 100},
+		{keyPosition: 160, position: 40, end: 100},
+		{keyPosition: 40, position: 40, end: 40 + syncKeyMaterialLength + 70},
+		{keyPosition: 0, position: 0, end: syncKeyMaterialLength + 35},
+	} {
+		var err error
+		var pad = make([]byte, 256)
+		var key *resource.MemoryPool
+		var preamble []byte
+		var point SyncPoint
+
+		key, err = resource.NewMemoryPool(pad, test.keyPosition)
+		assert.Nil(t, err)
+		preamble, point, err = SyncPreamble(key, test.position)
+		assert.Nil(t, err)
+		assert.True(t, point.Material+syncKeyMaterialLength <= point.Position || point.Material >= test.end, "%+v", test)
+
+		// The key material of the message is changed: the preamble is still valid.
+		for i := point.Position; i < test.end; i++ {
+			pad[i] = 0xff
+		}
+		key, err = resource.NewMemoryPool(pad, point.Start())
+		assert.Nil(t, err)
+		_, err = SyncVerify(preamble, key)
+		assert.Nil(t, err, "%+v", test)
+
+		// The key material of the fingerprint is changed: the preamble is not valid anymore.
+		pad[point.Material] ^= 0x01
+		key, err = resource.NewMemoryPool(pad, point.Start())
+		assert.Nil(t, err)
+		_, err = SyncVerify(preamble, key)
+		assert.NotNil(t, err, "%+v", test)
+	}
+}
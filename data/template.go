@@ -0,0 +1,138 @@
+package data
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// BodyData The values available to the template of a body (see `RenderBody`). For example:
+//
+//	{{pick "Hi" "Hello" "Dear"}} {{.Name}},
+//	I hope you had a nice {{.Date.Weekday}}. {{if .Last}}See you soon!{{end}} {{.Vars.signature}}
+type BodyData struct {
+	// Recipient The address of the recipient.
+	Recipient string
+	// Name The name of the recipient (see `Session.BodyData`).
+	Name string
+	// Date The date the email is composed.
+	Date time.Time
+	// Number The number of the email (1 for the first email of the session).
+	Number int
+	// Count The number of emails of the session.
+	Count int
+	// First Tells whether the email is the first email of the session.
+	First bool
+	// Last Tells whether the email is the last email of the session.
+	Last bool
+	// Vars The variables of the session.
+	Vars map[string]string
+}
+
+// nameVariable The name of the variable that gives the name of the recipients. The name of a given recipient is given
+// by the variable "name:<address>".
+const nameVariable = "name"
+
+// BodyData Returns the values available to the template of the body of the email that carries the boundary at a given
+// index, sent to a given recipient. The name of the recipient is given by the variable "name:<address>" or, for all
+// the recipients, "name". Otherwise, it is the display name of the address ("John Smith <john@example.com>"), or it is
+// guessed from the address ("john.smith@example.com" gives "John Smith").
+func (s *Session) BodyData(recipient string, index int, date time.Time) BodyData {
+	var vars = make(map[string]string, len(s.Variables))
+	var name string
+	var ok bool
+
+	for key, value := range s.Variables {
+		vars[key] = value
+	}
+	if name, ok = vars[nameVariable+":"+recipient]; !ok {
+		if name, ok = vars[nameVariable]; !ok {
+			name = addressName(recipient)
+		}
+	}
+	return BodyData{
+		Recipient: recipient,
+		Name:      name,
+		Date:      date,
+		Number:    index + 1,
+		Count:     len(s.Boundaries),
+		First:     index == 0,
+		Last:      index == len(s.Boundaries)-1,
+		Vars:      vars,
+	}
+}
+
+// CheckVariable Checks the name of a variable of the templates of the bodies.
+func CheckVariable(name string) error {
+	if len(name) == 0 || strings.ContainsAny(name, "= \t\r\n") {
+		return fmt.Errorf(`invalid variable name "%s"`, name)
+	}
+	return nil
+}
+
+// ParseBodyTemplate Checks the syntax of the template of a body.
+func ParseBodyTemplate(body []byte) error {
+	_, err := newBodyTemplate(nil).Parse(string(body))
+	return err
+}
+
+// RenderBody Renders the template of a body (see `text/template`), using given values (see `BodyData`). The function
+// `pick` returns one of its arguments, depending on the number of the email: the first email gets the first argument,
+// the second email gets the second argument... Referring to a variable that is not defined is an error.
+func RenderBody(body []byte, data BodyData) ([]byte, error) {
+	var err error
+	var tmpl *template.Template
+	var buffer bytes.Buffer
+
+	if tmpl, err = newBodyTemplate(&data).Parse(string(body)); err != nil {
+		return nil, err
+	}
+	if err = tmpl.Execute(&buffer, data); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// newBodyTemplate Creates a template for a body, given the values it is rendered with (nil if it is only parsed).
+func newBodyTemplate(data *BodyData) *template.Template {
+	return template.New("body").Option("missingkey=error").Funcs(template.FuncMap{
+		"pick": func(phrases ...string) (string, error) {
+			if len(phrases) == 0 {
+				return "", fmt.Errorf(`pick: no phrase given`)
+			}
+			return phrases[(data.Number-1)%len(phrases)], nil
+		},
+	})
+}
+
+// addressName Returns the display name of an address, if any. Otherwise, the name is guessed from the address.
+func addressName(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		if len(parsed.Name) > 0 {
+			return parsed.Name
+		}
+		address = parsed.Address
+	}
+	return guessName(address)
+}
+
+// guessName Returns the name of the owner of an address, guessed from the address: the words of the local part,
+// capitalized ("john.smith@example.com" gives "John Smith").
+func guessName(address string) string {
+	var words []string
+	var local = address
+
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		local = address[:i]
+	}
+	for _, word := range strings.FieldsFunc(local, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		var runes = []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		words = append(words, string(runes))
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRenderBody(t *testing.T) {
+	var err error
+	var session Session
+	var date = time.Date(2024, 3, 8, 10, 0, 0, 0, time.UTC)
+	var body = []byte(`{{pick "Hi" "Hello" "Dear"}} {{.Name}}, how was your {{.Date.Weekday}}?{{if .Last}} Bye!{{end}} {{.Vars.signature}} ({{.Number}}/{{.Count}})`)
+	var rendered []byte
+
+	session.Init("key", 0)
+	session.AddBoundary([]byte{1})
+	session.AddBoundary([]byte{2})
+	session.Variables = map[string]string{"signature": "Paul"}
+
+	rendered, err = RenderBody(body, session.BodyData("john.smith@example.com", 0, date))
+	assert.Nil(t, err)
+	assert.Equal(t, "Hi John Smith, how was your Friday? Paul (1/2)", string(rendered))
+	rendered, err = RenderBody(body, session.BodyData("john.smith@example.com", 1, date))
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello John Smith, how was your Friday? Bye! Paul (2/2)", string(rendered))
+
+	// The name is given by the variables.
+	session.Variables["name"] = "Johnny"
+	session.Variables["name:jane@example.com"] = "Janie"
+	assert.Equal(t, "Johnny", session.BodyData("john.smith@example.com", 0, date).Name)
+	assert.Equal(t, "Janie", session.BodyData("jane@example.com", 0, date).Name)
+
+	// A body that is not a template is unchanged.
+	rendered, err = RenderBody([]byte("Hello John,\nbye."), session.BodyData("john@example.com", 0, date))
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello John,\nbye.", string(rendered))
+
+	// Errors: undefined variable, invalid syntax, pick without phrases.
+	for _, invalid := range []string{"{{.Vars.missing}}", "{{.Name", "{{pick}}", "{{.Unknown}}"} {
+		_, err = RenderBody([]byte(invalid), session.BodyData("john@example.com", 0, date))
+		assert.NotNil(t, err, invalid)
+	}
+	assert.Nil(t, ParseBodyTemplate(body))
+	assert.NotNil(t, ParseBodyTemplate([]byte("{{if .First}}")))
+}
+
+func TestGuessName(t *testing.T) {
+	assert.Equal(t, "John Smith", guessName("john.smith@example.com"))
+	assert.Equal(t, "Jane", guessName("JANE_42@example.com"))
+	assert.Equal(t, "", guessName("1234@example.com"))
+	assert.Equal(t, "Jérôme Dupont", addressName("Jérôme Dupont <jd@example.com>"))
+	assert.Equal(t, "John Smith", addressName("<john.smith@example.com>"))
+}
+
+func TestCheckVariable(t *testing.T) {
+	assert.Nil(t, CheckVariable("signature"))
+	assert.Nil(t, CheckVariable("name:john@example.com"))
+	assert.NotNil(t, CheckVariable(""))
+	assert.NotNil(t, CheckVariable("a=b"))
+	assert.NotNil(t, CheckVariable("a b"))
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// keepAlivePeriod The interval between the TCP keep-alive probes: a connection to a server that vanished (or that is
+// dropped by a firewall) is detected, even if no data is exchanged.
+const keepAlivePeriod = 30 * time.Second
+
+// Timeouts The timeouts of the connections to the SMTP and IMAP servers. A zero timeout disables the limit.
+type Timeouts struct {
+	// Dial The maximum time to open a connection: the name resolution, the TCP connection and the TLS handshake.
+	Dial time.Duration
+	// Command The maximum time the server may stay silent while a reply is expected (see `TimeoutConn`).
+	Command time.Duration
+	// Data The maximum time the SMTP server may stay silent while an email is transferred (from the "DATA" command
+	// until the server accepts the email, which may take a while if the server scans it).
+	Data time.Duration
+}
+
+// DefaultTimeouts The default timeouts (the ones recommended by RFC 5321 for the commands and the data).
+var DefaultTimeouts = Timeouts{Dial: 30 * time.Second, Command: 5 * time.Minute, Data: 10 * time.Minute}
+
+// Validate Checks the timeouts.
+func (t Timeouts) Validate() error {
+	for _, timeout := range []time.Duration{t.Dial, t.Command, t.Data} {
+		if timeout < 0 {
+			return fmt.Errorf(`invalid timeout "%s" (expected a positive duration, or 0 to disable it)`, timeout)
+		}
+	}
+	return nil
+}
+
+// DialContext Returns the context the connections are opened within: it is cancelled once the dial timeout expires.
+func (t Timeouts) DialContext() (context.Context, context.CancelFunc) {
+	if t.Dial > 0 {
+		return context.WithTimeout(context.Background(), t.Dial)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Connect Opens a TCP connection to an address ("host:port"), with keep-alive probes. The opening is abandoned as soon
+// as the context is cancelled (see `DialContext`). The connection applies the command timeout (see `TimeoutConn`).
+func (t Timeouts) Connect(ctx context.Context, address string) (*TimeoutConn, error) {
+	var dialer = net.Dialer{KeepAlive: keepAlivePeriod}
+
+	connection, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewTimeoutConn(connection, t.Command), nil
+}
+
+// TimeoutConn A connection that fails if the peer stays silent for too long: before each read or write, the deadline
+// is pushed back by the timeout. A write also pushes back the deadline of the reads, so that the reply to a command is
+// expected within the timeout.
+type TimeoutConn struct {
+	net.Conn
+	timeout atomic.Int64
+}
+
+// NewTimeoutConn Wraps a connection, given its timeout (0 for no timeout).
+func NewTimeoutConn(connection net.Conn, timeout time.Duration) *TimeoutConn {
+	var result = TimeoutConn{Conn: connection}
+
+	result.SetTimeout(timeout)
+	return &result
+}
+
+// SetTimeout Changes the timeout of the connection (for example, while an email is transferred).
+func (c *TimeoutConn) SetTimeout(timeout time.Duration) {
+	c.timeout.Store(int64(timeout))
+}
+
+// Read Reads data from the connection (see `net.Conn`).
+func (c *TimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(c.deadline()); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// Write Writes data to the connection (see `net.Conn`).
+func (c *TimeoutConn) Write(b []byte) (int, error) {
+	var deadline = c.deadline()
+
+	if err := c.Conn.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// deadline Returns the deadline of the next operation (the zero time if there is no timeout).
+func (c *TimeoutConn) deadline() time.Time {
+	if timeout := time.Duration(c.timeout.Load()); timeout > 0 {
+		return time.Now().Add(timeout)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,68 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTimeoutConn(t *testing.T) {
+	var err error
+	var client, server = net.Pipe()
+	var connection = NewTimeoutConn(client, 50*time.Millisecond)
+	var buffer = make([]byte, 4)
+
+	defer server.Close()
+	defer connection.Close()
+
+	// The peer answers within the timeout.
+	go server.Write([]byte("220 "))
+	_, err = connection.Read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, "220 ", string(buffer))
+
+	// The peer stays silent.
+	_, err = connection.Read(buffer)
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+
+	// No timeout: the read waits for the peer.
+	connection.SetTimeout(0)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		server.Write([]byte("250 "))
+	}()
+	_, err = connection.Read(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, "250 ", string(buffer))
+}
+
+func TestTimeoutsConnect(t *testing.T) {
+	var err error
+	var listener net.Listener
+	var connection *TimeoutConn
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	listener, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	ctx, cancel = DefaultTimeouts.DialContext()
+	connection, err = DefaultTimeouts.Connect(ctx, listener.Addr().String())
+	cancel()
+	assert.Nil(t, err)
+	connection.Close()
+
+	// The context is cancelled: the connection is not opened.
+	ctx, cancel = DefaultTimeouts.DialContext()
+	cancel()
+	_, err = DefaultTimeouts.Connect(ctx, listener.Addr().String())
+	assert.NotNil(t, err)
+
+	assert.Nil(t, Timeouts{}.Validate())
+	assert.NotNil(t, Timeouts{Command: -time.Second}.Validate())
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// NewTlsConfig Returns the TLS configuration used to connect to a server. By default, the certificate of the server is
+// verified, using the certificates of the authorities given by `roots` (the ones of the system if nil). If a pin is
+// given (the SHA-256 of the public key of the server, see `PublicKeyPin`), then the public key of the server must match
+// it, and the certificate is not verified (it may be self-signed). The verification can be disabled (`insecure`).
+func NewTlsConfig(serverName string, pin string, insecure bool, roots *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		ServerName: serverName,
+		RootCAs:    roots,
+		// The verification is performed by `VerifyConnection`, so that the pin of the server can be given to the user.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			var err error
+			var certificate *x509.Certificate
+			var options = x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: x509.NewCertPool()}
+
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf(`the server did not send any certificate`)
+			}
+			certificate = state.PeerCertificates[0]
+			if len(pin) > 0 {
+				if !strings.EqualFold(PublicKeyPin(certificate), pin) {
+					return fmt.Errorf(`the public key of the server does not match the pin (the pin of the server is %s)`, PublicKeyPin(certificate))
+				}
+				return nil
+			}
+			if insecure {
+				return nil
+			}
+			for _, intermediate := range state.PeerCertificates[1:] {
+				options.Intermediates.AddCert(intermediate)
+			}
+			if _, err = certificate.Verify(options); err != nil {
+				return fmt.Errorf(`cannot verify the certificate of the server: %s (if you trust the server, you can pin its public key: --pin=%s)`, err.Error(), PublicKeyPin(certificate))
+			}
+			return nil
+		},
+	}
+}
+
+// LoadCaFile Loads the certificates of authorities from a file (PEM).
+func LoadCaFile(path string) (*x509.CertPool, error) {
+	var err error
+	var content []byte
+	var roots = x509.NewCertPool()
+
+	if content, err = os.ReadFile(path); err != nil {
+		return nil, err
+	}
+	if !roots.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf(`the file "%s" does not contain any certificate (PEM)`, path)
+	}
+	return roots, nil
+}
+
+// PublicKeyPin Returns the pin of a certificate: the SHA-256 of its public key (SubjectPublicKeyInfo), in hexadecimal.
+func PublicKeyPin(certificate *x509.Certificate) string {
+	var hash = sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewTlsConfig(t *testing.T) {
+	var authority, authorityKey = newTestCertificate(t, "Test CA", nil, nil)
+	var server, _ = newTestCertificate(t, "imap.example.com", authority, authorityKey)
+	var other, _ = newTestCertificate(t, "Other CA", nil, nil)
+	var roots = x509.NewCertPool()
+	var state = tls.ConnectionState{PeerCertificates: []*x509.Certificate{server}}
+
+	roots.AddCert(authority)
+	for _, test := range []struct {
+		name     string
+		server   string
+		pin      string
+		insecure bool
+		roots    *x509.CertPool
+		valid    bool
+	}{
+		{name: "trusted authority", server: "imap.example.com", roots: roots, valid: true},
+		{name: "wrong name", server: "pop.example.com", roots: roots, valid: false},
+		{name: "untrusted authority", server: "imap.example.com", roots: x509.NewCertPool(), valid: false},
+		{name: "pin", server: "imap.example.com", pin: PublicKeyPin(server), roots: x509.NewCertPool(), valid: true},
+		{name: "wrong pin", server: "imap.example.com", pin: PublicKeyPin(other), roots: roots, valid: false},
+		{name: "insecure", server: "pop.example.com", insecure: true, roots: x509.NewCertPool(), valid: true},
+	} {
+		var config = NewTlsConfig(test.server, test.pin, test.insecure, test.roots)
+		assert.Equal(t, test.valid, config.VerifyConnection(state) == nil, test.name)
+		assert.Equal(t, test.roots, config.RootCAs)
+	}
+	assert.NotNil(t, NewTlsConfig("imap.example.com", "", true, nil).VerifyConnection(tls.ConnectionState{}))
+}
+
+func TestLoadCaFile(t *testing.T) {
+	var err error
+	var dir = t.TempDir()
+	var authority, _ = newTestCertificate(t, "Test CA", nil, nil)
+	var path = filepath.Join(dir, "ca.pem")
+	var roots *x509.CertPool
+	var expected = x509.NewCertPool()
+
+	expected.AddCert(authority)
+	assert.Nil(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: authority.Raw}), 0644))
+	roots, err = LoadCaFile(path)
+	assert.Nil(t, err)
+	assert.True(t, roots.Equal(expected))
+
+	// We'll get errors...
+	assert.Nil(t, os.WriteFile(path, []byte("not a certificate"), 0644))
+	_, err = LoadCaFile(path)
+	assert.NotNil(t, err)
+	_, err = LoadCaFile(filepath.Join(dir, "missing.pem"))
+	assert.NotNil(t, err)
+}
+
+// newTestCertificate Returns a certificate for a given name, signed by a given authority (self-signed, and an
+// authority itself, if nil), and its private key.
+func newTestCertificate(t *testing.T, name string, authority *x509.Certificate, authorityKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	var err error
+	var key *ecdsa.PrivateKey
+	var raw []byte
+	var certificate *x509.Certificate
+	var template = x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	if authority == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		authority = &template
+		authorityKey = key
+	} else {
+		template.DNSNames = []string{name}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	raw, err = x509.CreateCertificate(rand.Reader, &template, authority, &key.PublicKey, authorityKey)
+	assert.Nil(t, err)
+	certificate, err = x509.ParseCertificate(raw)
+	assert.Nil(t, err)
+	return certificate, key
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// whitespaceCarrierLength The number of bytes hidden by the trailing whitespaces of the plain text part of an email,
+// by default.
+const whitespaceCarrierLength = 2
+
+// whitespaceCarrierMaxLength The maximum number of bytes hidden by the trailing whitespaces (the text must have enough
+// lines, see `WhitespaceCapacity`).
+const whitespaceCarrierMaxLength = 32
+
+// whitespaceBits The number of bits hidden by the whitespaces at the end of a line: up to 3 spaces (2 bits), followed
+// or not by a tab (1 bit).
+const whitespaceBits = 3
+
+// trailingWhitespace The whitespaces written at the end of the lines of the plain text part of an email, that hide
+// bytes of a chunk of the message (see `CarrierWhitespace`), as SNOW does. Each line terminated by a line break hides 3
+// bits. The whitespaces of the lines that follow the hidden bytes are random.
+type trailingWhitespace struct {
+	payload []byte
+}
+
+// newTrailingWhitespace Returns the whitespaces that hide a given payload, or nil if the payload is empty (the text is
+// then left as is).
+func newTrailingWhitespace(payload []byte) *trailingWhitespace {
+	if len(payload) == 0 {
+		return nil
+	}
+	return &trailingWhitespace{payload: payload}
+}
+
+// hide Returns a text whose lines end with the whitespaces that hide the payload. The whitespaces that end the lines of
+// the text are replaced. The text is left as is if the receiver is nil.
+func (w *trailingWhitespace) hide(text []byte) ([]byte, error) {
+	var lines []string
+	var random []byte
+	var position int
+
+	if w == nil {
+		return text, nil
+	}
+	if capacity := WhitespaceCapacity(text); capacity < len(w.payload) {
+		return nil, fmt.Errorf(`the plain text part of the email is too short to hide %d bytes in the whitespaces of its lines (%d bytes hidden)`, len(w.payload), capacity)
+	}
+	lines = strings.Split(string(text), "\n")
+	random = make([]byte, len(lines))
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	// The last line is not terminated by a line break.
+	for i := range lines[:len(lines)-1] {
+		var value = int(random[i])
+		var line = strings.TrimRight(strings.TrimSuffix(lines[i], "\r"), " \t")
+
+		for bit := 0; bit < whitespaceBits; bit++ {
+			if position < 8*len(w.payload) {
+				value = value&^(1<<(whitespaceBits-1-bit)) | int(w.payload[position/8]>>(7-position%8)&1)<<(whitespaceBits-1-bit)
+				position++
+			}
+		}
+		line += strings.Repeat(" ", value&3)
+		if value&4 != 0 {
+			line += "\t"
+		}
+		if strings.HasSuffix(lines[i], "\r") {
+			line += "\r"
+		}
+		lines[i] = line
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// WhitespaceCapacity Returns the number of bytes that the whitespaces at the end of the lines of a text (the body of an
+// email) can hide (see `CarrierWhitespace`).
+func WhitespaceCapacity(text []byte) int {
+	return bytes.Count(text, []byte("\n")) * whitespaceBits / 8
+}
+
+// WhitespacePayload Extracts the bytes hidden by the whitespaces at the end of the lines of the plain text part of an
+// email (RFC 5322): `length` bytes.
+func WhitespacePayload(content []byte, length int) ([]byte, error) {
+	var err error
+	var parts []leafPart
+	var payload = make([]byte, length)
+	var position int
+
+	if parts, err = leafParts(content); err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		var mediaType string
+		var text []byte
+		var lines []string
+
+		if mediaType, _, err = mime.ParseMediaType(part.header.Get("Content-Type")); err != nil || mediaType != "text/plain" {
+			continue
+		}
+		if text, err = part.decode(); err != nil {
+			return nil, err
+		}
+		lines = strings.Split(string(text), "\n")
+		for _, line := range lines[:len(lines)-1] {
+			var value int
+			var trimmed = strings.TrimSuffix(line, "\r")
+
+			if strings.HasSuffix(trimmed, "\t") {
+				value |= 4
+				trimmed = trimmed[:len(trimmed)-1]
+			}
+			if spaces := len(trimmed) - len(strings.TrimRight(trimmed, " ")); spaces <= 3 {
+				value |= spaces
+			} else {
+				return nil, fmt.Errorf(`the plain text part of the email hides no bytes (%d spaces at the end of a line)`, spaces)
+			}
+			for bit := 0; bit < whitespaceBits && position < 8*length; bit++ {
+				payload[position/8] |= byte(value>>(whitespaceBits-1-bit)&1) << (7 - position%8)
+				position++
+			}
+		}
+		break
+	}
+	if position < 8*length {
+		return nil, fmt.Errorf(`the plain text part of the email hides less than %d bytes in the whitespaces of its lines`, length)
+	}
+	return payload, nil
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+func TestTrailingWhitespace(t *testing.T) {
+	var text = []byte(strings.Repeat("Hello John,  \r\n\r\nHow are you? Ça va ?\t\n", 6) + "Bye")
+	var boundary = strings.Repeat("0a", 35)
+	var payload = []byte{0x00, 0xFF, 0xA5, 0x3C}
+
+	assert.Equal(t, 6, WhitespaceCapacity(text))
+	for _, encoding := range []string{TextEncodingBase64, TextEncodingQuotedPrintable} {
+		for _, breaks := range [][]byte{nil, {0x12}} {
+			var err error
+			var content []byte
+			var email []byte
+			var extracted []byte
+			var reader *multipart.Reader
+			var part *multipart.Part
+			var decoded []byte
+			var long = []byte(strings.Repeat("A long line that is split by the soft line breaks. ", 8) + "\n")
+
+			content, err = BuildAlternative(boundary, append(long, text...), []byte("<p>Hello</p>"), encoding, "", BodyPayloads{Whitespace: payload, SoftBreaks: breaks})
+			if encoding == TextEncodingBase64 && breaks != nil {
+				// The text encoded in base64 has no soft line breaks.
+				assert.NotNil(t, err)
+				continue
+			}
+			assert.Nil(t, err)
+			email = append([]byte("From: a@example.com\r\nContent-Type: multipart/alternative; boundary=\""+boundary+"\"\r\n\r\n"), content...)
+			extracted, err = WhitespacePayload(email, len(payload))
+			assert.Nil(t, err)
+			assert.Equal(t, payload, extracted, encoding)
+
+			// Only the whitespaces at the end of the lines change.
+			reader = multipart.NewReader(bytes.NewReader(content), boundary)
+			part, err = reader.NextPart()
+			assert.Nil(t, err)
+			decoded, _ = io.ReadAll(part)
+			if encoding == TextEncodingBase64 {
+				decoded = decodeBase64(t, decoded)
+			}
+			assert.Equal(t, trimLines(string(long)+string(text)), trimLines(string(decoded)))
+			assert.True(t, strings.HasSuffix(string(decoded), "Bye"))
+		}
+	}
+
+	// We'll get errors...
+	_, err := BuildAlternative(boundary, text, nil, "", "", BodyPayloads{Whitespace: make([]byte, 7)})
+	assert.NotNil(t, err)
+	_, err = WhitespacePayload([]byte("Content-Type: text/plain\r\n\r\nHello    \r\nJohn\r\n"), 1)
+	assert.NotNil(t, err)
+	_, err = WhitespacePayload([]byte("Content-Type: text/plain\r\n\r\nHello\r\nJohn\r\n"), 1)
+	assert.NotNil(t, err)
+}
+
+// trimLines Removes the whitespaces at the end of the lines of a text, and its carriage returns.
+func trimLines(text string) string {
+	var lines = strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	return strings.Join(lines, "\n")
+}
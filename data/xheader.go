@@ -0,0 +1,182 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// HeaderPersona The sender mimicked by the custom headers ("X-") that hide bytes of the chunks of the message (see
+// `CarrierXHeader`): the headers added by a marketing platform, for example.
+type HeaderPersona string
+
+// The personas.
+const (
+	// PersonaCampaign The headers of a newsletter campaign ("X-Campaign" and "X-MC-User").
+	PersonaCampaign HeaderPersona = "campaign"
+	// PersonaTransactional The headers of a transactional email ("X-Entity-Ref-ID" and "X-Feedback-ID").
+	PersonaTransactional HeaderPersona = "transactional"
+	// PersonaNewsletter The headers of an email relayed by a delivery platform ("X-SG-EID" and "X-Entity-ID").
+	PersonaNewsletter HeaderPersona = "newsletter"
+)
+
+// xHeaderCarrierLength The number of bytes hidden by the custom headers, by default: the headers of all the personas
+// can hide them.
+const xHeaderCarrierLength = 16
+
+// xHeaderCarrierMaxLength The maximum number of bytes hidden by the custom headers (see `HeaderPersona.Capacity`).
+const xHeaderCarrierMaxLength = 40
+
+// xHeader A custom header: its value is made of `size` bytes.
+type xHeader struct {
+	name   string
+	size   int
+	format func(value []byte) string
+	parse  func(text string) ([]byte, error)
+}
+
+var xCampaignRegex = regexp.MustCompile(`^mailchimp([0-9a-f]{10})\.([0-9a-f]{10})$`)
+var xEntityRefRegex = regexp.MustCompile(`^([0-9a-f]{8})-([0-9a-f]{4})-([0-9a-f]{4})-([0-9a-f]{4})-([0-9a-f]{12})$`)
+var xFeedbackRegex = regexp.MustCompile(`^([0-9a-f]{8}):([0-9a-f]{8}):transactional$`)
+
+// headerPersonas The custom headers of the personas, in the order they hide the bytes.
+var headerPersonas = map[HeaderPersona][]xHeader{
+	PersonaCampaign: {
+		{name: "X-Campaign", size: 10, format: func(value []byte) string {
+			return fmt.Sprintf("mailchimp%x.%x", value[:5], value[5:])
+		}, parse: func(text string) ([]byte, error) {
+			return parseHexGroups(xCampaignRegex, text)
+		}},
+		{name: "X-MC-User", size: 12, format: hex.EncodeToString, parse: func(text string) ([]byte, error) {
+			return parseHexValue(text, 12)
+		}},
+	},
+	PersonaTransactional: {
+		{name: "X-Entity-Ref-ID", size: 16, format: func(value []byte) string {
+			return fmt.Sprintf("%x-%x-%x-%x-%x", value[0:4], value[4:6], value[6:8], value[8:10], value[10:16])
+		}, parse: func(text string) ([]byte, error) {
+			return parseHexGroups(xEntityRefRegex, text)
+		}},
+		{name: "X-Feedback-ID", size: 8, format: func(value []byte) string {
+			return fmt.Sprintf("%x:%x:transactional", value[:4], value[4:])
+		}, parse: func(text string) ([]byte, error) {
+			return parseHexGroups(xFeedbackRegex, text)
+		}},
+	},
+	PersonaNewsletter: {
+		{name: "X-SG-EID", size: 24, format: base64.StdEncoding.EncodeToString, parse: func(text string) ([]byte, error) {
+			return parseBase64Value(text, 24)
+		}},
+		{name: "X-Entity-ID", size: 16, format: base64.StdEncoding.EncodeToString, parse: func(text string) ([]byte, error) {
+			return parseBase64Value(text, 16)
+		}},
+	},
+}
+
+// ParseHeaderPersona Checks the name of a persona. The empty name designates `PersonaCampaign`.
+func ParseHeaderPersona(name string) (HeaderPersona, error) {
+	var persona = HeaderPersona(strings.ToLower(name))
+
+	if len(persona) == 0 {
+		return PersonaCampaign, nil
+	}
+	if _, ok := headerPersonas[persona]; !ok {
+		return persona, fmt.Errorf(`unknown persona "%s" (expected "%s", "%s" or "%s")`, name, PersonaCampaign, PersonaTransactional, PersonaNewsletter)
+	}
+	return persona, nil
+}
+
+// Capacity Returns the maximum number of bytes hidden by the custom headers of the persona.
+func (p HeaderPersona) Capacity() int {
+	var capacity int
+
+	for _, header := range headerPersonas[p] {
+		capacity += header.size
+	}
+	return capacity
+}
+
+// Headers Returns the custom headers of the persona that hide bytes of a chunk of the message. The bytes of the
+// headers that do not hide the chunk are random.
+func (p HeaderPersona) Headers(payload []byte) (Headers, error) {
+	var err error
+	var headers Headers
+	var values []byte
+
+	if _, ok := headerPersonas[p]; !ok {
+		return nil, fmt.Errorf(`unknown persona "%s"`, p)
+	}
+	if len(payload) > p.Capacity() {
+		return nil, fmt.Errorf(`the headers of the persona "%s" hide up to %d bytes (%d given)`, p, p.Capacity(), len(payload))
+	}
+	values = make([]byte, p.Capacity())
+	if _, err = rand.Read(values); err != nil {
+		return nil, err
+	}
+	copy(values, payload)
+	for _, header := range headerPersonas[p] {
+		headers = append(headers, Header{Name: header.name, Value: header.format(values[:header.size])})
+		values = values[header.size:]
+	}
+	return headers, nil
+}
+
+// XHeaderPayload Extracts the bytes hidden by the custom headers of an email (see `HeaderPersona.Headers`): `length`
+// bytes. The persona is the one whose headers are found.
+func XHeaderPayload(header mail.Header, length int) ([]byte, error) {
+	for _, persona := range []HeaderPersona{PersonaCampaign, PersonaTransactional, PersonaNewsletter} {
+		var err error
+		var payload []byte
+
+		if len(header.Get(headerPersonas[persona][0].name)) == 0 {
+			continue
+		}
+		if length > persona.Capacity() {
+			return nil, fmt.Errorf(`the headers of the persona "%s" hide up to %d bytes (%d expected)`, persona, persona.Capacity(), length)
+		}
+		for _, field := range headerPersonas[persona] {
+			var value []byte
+			if value, err = field.parse(strings.TrimSpace(header.Get(field.name))); err != nil {
+				return nil, fmt.Errorf(`invalid header "%s": %s`, field.name, err.Error())
+			}
+			payload = append(payload, value...)
+		}
+		return payload[:length], nil
+	}
+	return nil, fmt.Errorf(`the email has no custom header that hides bytes`)
+}
+
+// parseHexGroups Extracts the bytes written as groups of hexadecimal digits (the groups captured by a regular
+// expression).
+func parseHexGroups(regex *regexp.Regexp, text string) ([]byte, error) {
+	var matches = regex.FindStringSubmatch(strings.ToLower(text))
+
+	if matches == nil {
+		return nil, fmt.Errorf(`unexpected value "%s"`, text)
+	}
+	return hex.DecodeString(strings.Join(matches[1:], ""))
+}
+
+// parseHexValue Extracts `size` bytes written in hexadecimal.
+func parseHexValue(text string, size int) ([]byte, error) {
+	var value, err = hex.DecodeString(text)
+
+	if err != nil || len(value) != size {
+		return nil, fmt.Errorf(`unexpected value "%s"`, text)
+	}
+	return value, nil
+}
+
+// parseBase64Value Extracts `size` bytes written in base64.
+func parseBase64Value(text string, size int) ([]byte, error) {
+	var value, err = base64.StdEncoding.DecodeString(text)
+
+	if err != nil || len(value) != size {
+		return nil, fmt.Errorf(`unexpected value "%s"`, text)
+	}
+	return value, nil
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestHeaderPersona(t *testing.T) {
+	var err error
+	var persona HeaderPersona
+	var payload = []byte("0123456789abcdefghijklmnopqrstuvwxyz!?#@")
+
+	persona, err = ParseHeaderPersona("")
+	assert.Nil(t, err)
+	assert.Equal(t, PersonaCampaign, persona)
+	for name, capacity := range map[HeaderPersona]int{PersonaCampaign: 22, PersonaTransactional: 24, PersonaNewsletter: 40} {
+		var headers Headers
+		var extracted []byte
+		var header = mail.Header{}
+
+		persona, err = ParseHeaderPersona(strings.ToUpper(string(name)))
+		assert.Nil(t, err)
+		assert.Equal(t, capacity, persona.Capacity())
+		headers, err = persona.Headers(payload[:16])
+		assert.Nil(t, err)
+		assert.Len(t, headers, 2)
+		for _, h := range headers {
+			assert.True(t, strings.HasPrefix(h.Name, "X-"))
+			header[textproto.CanonicalMIMEHeaderKey(h.Name)] = []string{h.Value}
+		}
+		extracted, err = XHeaderPayload(header, 16)
+		assert.Nil(t, err)
+		assert.Equal(t, payload[:16], extracted, name)
+
+		headers, err = persona.Headers(payload[:capacity])
+		assert.Nil(t, err)
+		header = mail.Header{}
+		for _, h := range headers {
+			header[textproto.CanonicalMIMEHeaderKey(h.Name)] = []string{h.Value}
+		}
+		extracted, err = XHeaderPayload(header, capacity)
+		assert.Nil(t, err)
+		assert.Equal(t, payload[:capacity], extracted, name)
+
+		// We'll get errors...
+		_, err = persona.Headers(append(payload[:capacity:capacity], 0))
+		assert.NotNil(t, err)
+		_, err = XHeaderPayload(header, capacity+1)
+		assert.NotNil(t, err)
+	}
+
+	// We'll get errors...
+	_, err = ParseHeaderPersona("marketing")
+	assert.NotNil(t, err)
+	_, err = XHeaderPayload(mail.Header{"Subject": {"Hello"}}, 16)
+	assert.NotNil(t, err)
+	_, err = XHeaderPayload(mail.Header{"X-Campaign": {"mailchimp0123"}, "X-Mc-User": {"00"}}, 16)
+	assert.NotNil(t, err)
+}
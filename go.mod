@@ -2,12 +2,20 @@ module umail
 
 go 1.20
 
+require (
+	github.com/emersion/go-imap/v2 v2.0.0-alpha.6
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	github.com/stretchr/testify v1.8.4
+	go.etcd.io/bbolt v1.3.8
+	golang.org/x/crypto v0.15.0
+	golang.org/x/term v0.14.0
+	golang.org/x/text v0.14.0
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/emersion/go-imap/v2 v2.0.0-alpha.6 // indirect
 	github.com/emersion/go-sasl v0.0.0-20220912192320-0145f2c60ead // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.8.4 // indirect
-	golang.org/x/text v0.8.0 // indirect
+	golang.org/x/sys v0.14.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -3,6 +3,7 @@
 //     $out = new-object byte[] 1048576; (new-object Random).NextBytes($out); [IO.File]::WriteAllBytes('random-data.bin', $out)
 //
 //     umail.exe create-key test random-data.bin
+//     umail.exe create-key --xor test random-data.bin onerng-data.bin urandom
 //     dir "%HOMEDRIVE%%HOMEPATH%\.smailer\keys"
 //     dir "%HOMEDRIVE%%HOMEPATH%\.smailer\sessions"
 //
@@ -10,37 +11,150 @@
 //     dir "%HOMEDRIVE%%HOMEPATH%\.smailer\sessions"
 //     type "%HOMEDRIVE%%HOMEPATH%\.smailer\sessions\first-session"
 //
+//     umail.exe add-body body1.txt body2.txt body3.txt
+//     umail.exe body-capacity body1.txt body2.txt
+//     umail.exe image-capacity photo.png photo.bmp
+//     umail.exe generate-body --count=3 corpus.txt
+//     umail.exe create-session --key=test --message=message.txt --corpus=corpus.txt first-session
+//     umail.exe create-session --key=test --message=message.txt --bodies=bodies --template --var=signature=Paul first-session
+//     umail.exe create-session --key=test --message=message.txt --rotation=random first-session
 //     umail.exe reset-session first-session
+//     umail.exe clone-session --recipient=jane@example.com first-session session-for-jane
 //     umail.exe info-session first-session
+//     umail.exe create-session --key=test --message=message.txt --to=john@example.com,jane@example.com shared-session
+//     umail.exe create-session --mac --sequence --key=test --message=message.txt authenticated-session
+//     umail.exe create-session --thread --key=test --message=message.txt --subject=Hello threaded-session
+//     umail.exe create-session --nested --key=test --message=message.txt nested-session
+//     umail.exe create-session --carriers=boundary,message-id:6 --key=test --message=message.txt carried-session
+//     umail.exe create-session --carriers=date --key=test --message=ack.txt ack-session
+//     umail.exe create-session --carriers=subject,date --key=test --message=ack.txt ack-session
+//     umail.exe create-session --carriers=boundary,x-header:40 --persona=newsletter --key=test --message=message.txt first-session
+//     umail.exe create-session --nested --carriers=boundary,image:4096 --cover-image=photo.png --key=test --message=message.txt first-session
+//     umail.exe create-session --carriers=boundary,header-order --key=test --message=message.txt first-session
+//     umail.exe create-session --carriers=boundary,base64-lines:4 --key=test --message=message.txt first-session
+//     umail.exe create-session --text-encoding=quoted-printable --carriers=boundary,soft-breaks --key=test --message=message.txt first-session
+//     umail.exe create-session --carriers=boundary,whitespace:4 --key=test --message=message.txt first-session
+//     umail.exe create-session --carriers=boundary,html-attributes:16 --key=test --message=message.txt first-session
+//     umail.exe create-session --html-layout=layout.html --inline-css --key=test --message=message.txt first-session
+//     umail.exe create-session --client=thunderbird --key=test --message=message.txt first-session
+//     umail.exe create-session --marker --key=test --message=message.txt marked-session
+//     umail.exe create-session --client=outlook --boundary-style=outlook --key=test --message=message.txt first-session
+//     umail.exe create-session --charset=iso-8859-1 --key=test --message=message.txt first-session
+//     umail.exe send --out=email.eml first-session "Jérôme Dupont <sender@example.com>" john@example.com Hello
+//     umail.exe create-session --key=test --message=message.txt --from=sender@example.com --smtp=smtp.example.com --port=465 bound-session
+//     umail.exe create-session --key=test --message=message.txt --recipient=john@example.com --subject=Hello --note="holidays" second-session
+//     umail.exe edit-session --note="holidays 2024" second-session
+//     umail.exe confirm-session first-session 0 1
+//     umail.exe verify-session first-session
+//     umail.exe verify-session --message=message.txt first-session
+//     umail.exe send --out=email.eml first-session sender@example.com john@example.com Hello
+//     umail.exe send --cc=jane@example.com --bcc=archive@example.com first-session sender@example.com john@example.com,paul@example.com Hello
+//     umail.exe export-session --eml --out=outbox first-session sender@example.com john@example.com Hello
+//     umail.exe oauth-login --provider=gmail --client-id=1234.apps.googleusercontent.com sender@gmail.com
+//     umail.exe send --oauth --smtp=smtp.gmail.com first-session sender@gmail.com john@example.com Hello
+//     umail.exe create-session --key=test --message=message.txt --from=sender@example.com --transport=graph graph-session
+//     umail.exe create-session --key=test --message=message.txt --from=sender@example.com --smtp=smtp.example.com --proxy=socks5://127.0.0.1:9050 tor-session
+//     umail.exe send --sent=imap.example.com/Sent --password=secret first-session sender@example.com john@example.com Hello
+//     umail.exe rcv --transport=gmail --from=bill@posteo.net --user=john@gmail.com
+//     umail.exe rcv --transport=graph --user=john@example.com
+//     umail.exe send --transport=gmail first-session sender@gmail.com john@example.com Hello
+//     umail.exe resume-session --retries=5 --delay=10s --password=secret first-session sender@example.com
+//     umail.exe send-all --min-interval=5m --max-interval=40m --password=secret first-session sender@example.com
+//     umail.exe send --queue first-session sender@example.com john@example.com Hello
+//     umail.exe selftest --smtp=smtp.example.com --imap=imap.example.com --password=secret sender@example.com
+//     umail.exe check-bounces --imap=imap.example.com --user=sender@example.com --password=secret --repair first-session
+//     umail.exe daemon --password=secret --window=08:00-20:00 --min-interval=5m --max-interval=40m
+//     umail.exe schedule-session --every=1 --window=09:00-18:00 --start=2024-03-10 bound-session
+//     umail.exe send --due --password=secret bound-session
+//     umail.exe send --dial-timeout=1m --command-timeout=2m --data-timeout=15m --password=secret first-session sender@example.com
+//     umail.exe rcv --from=bill@posteo.net --since=2023-08-23 --subject=hello --user=john --password=secret
+//     umail.exe rcv --rescan --user=john --password=secret
+//     umail.exe rcv --range=2024-01-01..2024-02-01 --last=100 --user=john --password=secret
+//     umail.exe rcv --watch --from=bill@posteo.net --user=john --password=secret
+//     umail.exe rcv --batch-size=500 --workers=8 --user=john --password=secret
+//     umail.exe rcv --protocol=pop3 --imap=pop.example.com --from=bill@posteo.net --user=john --password=secret
+//     umail.exe rcv --save-profile --protocol=jmap --from=bill@posteo.net --user=john@fastmail.com --password=token
+//     umail.exe rcv --account=john@fastmail.com --account=john@posteo.net --from=bill@posteo.net
+//     umail.exe rcv --mark-read --from=bill@posteo.net --user=john --password=secret
+//     umail.exe rcv --marker=test --user=john --password=secret
+//     umail.exe rcv --list --json --from=bill@posteo.net --user=john --password=secret
+//     umail.exe rcv --select=1,3,7-9 --from=bill@posteo.net --user=john --password=secret
+//     umail.exe rcv --carriers=subject,date --codebook=test --from=bill@posteo.net --user=john --password=secret
+//     umail.exe rcv --watch --exec="notify-send umail" --webhook=https://hooks.example.com/umail --from=bill@posteo.net --user=john --password=secret
+//     umail.exe rcv --oauth --imap=imap.gmail.com --from=bill@posteo.net --user=john@gmail.com
+//     umail.exe rcv --starttls --ca-file=company-ca.pem --imap=imap.example.com --user=john --password=secret
+//     umail.exe rcv --proxy=socks5h://127.0.0.1:9050 --from=bill@posteo.net --user=john --password=secret
+//     umail.exe rcv --mailbox="[Gmail]/All Mail" --user=john@gmail.com --password=secret
+//     umail.exe rcv --move-to=Stegano --keyword=$Decoded --from=bill@posteo.net --user=john --password=secret
+//     umail.exe rcv --delete-after-decode --dry-run --from=bill@posteo.net --user=john --password=secret
+//     umail.exe decode --maildir=Mail/INBOX --from=bill@posteo.net
+//     umail.exe decode --mbox=Inbox.mbox --sync-check
+//     umail.exe decode-eml email-1.eml email-2.eml email-3.eml
+//     umail.exe decode-eml --position-from=first-session.json email-1.eml email-2.eml email-3.eml
+//     umail.exe decode-eml --output=message.bin email-1.eml email-2.eml email-3.eml
+//     umail.exe decode-eml --carriers=boundary,message-id:6 email-1.eml email-2.eml
+//     umail.exe create-session --protect --key=test --message=message.txt first-session
+//     umail.exe protect-session --key-file=secret.bin first-session
+//     umail.exe unprotect-session first-session
+//     umail.exe migrate-session
+//     umail.exe migrate-session first-session
+//     umail.exe import-sessions
+//     umail.exe list-sessions --completed
+//     umail.exe archive-session first-session
+//     umail.exe purge-sessions --completed --older-than=30d
 //
 //     umail.exe reset-key test 0
+//     umail.exe reset-key --receiver test 0
 //     umail.exe info-key test
+//
+//     umail.exe protect-key test
+//     umail.exe unprotect-key test
+//
+//     umail.exe append-key test more-random-data.bin
+//     umail.exe append-key --random=1048576 test
+//
+//     umail.exe shred-key --passes=3 test
+//
+//     umail.exe bench-key --size=1048576 --chunk=35 --iterations=100
+//
+//     umail.exe clone-key --from-position=1024 --zero test test-for-john
+//
+//     umail.exe export-key --format=paper --from=0 --count=4096 test backup
+//     umail.exe import-key test-copy backup\page-0001.txt backup\page-0002.txt
 
 package main
 
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
-	b64 "encoding/base64"
-	"encoding/binary"
+	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/term"
 	"io"
 	"log"
+	"math/big"
 	"mime"
+	"net"
+	"net/http"
 	"net/mail"
 	"net/smtp"
+	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
-	"text/template"
+	"time"
 	umailData "umail/data"
 	"umail/resource"
 )
@@ -48,37 +162,72 @@ import (
 const defaultAppDataBaseName = ".smailer"
 const sessionSubDir = "sessions"
 const keySubDir = "keys"
+const archiveSubDir = "archive"
+const bodySubDir = "bodies"
+const tokenSubDir = "tokens"
+const queueSubDir = "queue"
 const defaultMessagePath = "message.txt"
 const defaultKeyName = "key"
 
-const DefaultSmtpServerAddress = "localhost"
-const DefaultSmtpPort = 465
-const DefaultImapServerAddress = "localhost"
-const DefaultImapServerPort = 993
-const DefaultBodyFile = "body1.txt"
+// sessionKeyFileEnv The environment variable that gives the path to the key file used to decrypt protected sessions.
+// If it is not set, then the passphrase is requested.
+const sessionKeyFileEnv = "UMAIL_SESSION_KEY_FILE"
 
-// See https://gist.github.com/tylermakin/d820f65eb3c9dd98d58721c7fb1939a8
+// storeEnv The environment variable that selects the store used to keep the sessions: "file" (default) or "bolt".
+const storeEnv = "UMAIL_STORE"
+const databaseFileName = "umail.db"
+const keyInfoFileName = "keys.json"
 
-const emailTemplate = `--{{.Boundary}}
-Content-Type: text/plain; charset="utf-8"
-Content-Transfer-Encoding: base64
+// processedMailboxEnv and processedKeywordEnv The environment variables that give the mailbox the emails of a hidden
+// message are moved to, and the keyword they are marked with, once the message has been shown (see "rcv").
+const processedMailboxEnv = "UMAIL_PROCESSED_MAILBOX"
+const processedKeywordEnv = "UMAIL_PROCESSED_KEYWORD"
 
-{{.MessageText}}
+// decodeExecEnv and decodeWebhookEnv The environment variables that give the command executed, and the URL notified,
+// once a hidden message has been decoded (see "rcv --exec" and "--webhook").
+const decodeExecEnv = "UMAIL_DECODE_EXEC"
+const decodeWebhookEnv = "UMAIL_DECODE_WEBHOOK"
 
---{{.Boundary}}
-Content-Type: text/html; charset="utf-8"
-Content-Transfer-Encoding: base64
+// mailboxCacheFileName The file that records the states of the mailboxes, so that "rcv" only fetches the new emails.
+const mailboxCacheFileName = "mailboxes.json"
 
-{{.MessageHtml}}
+// receptionFileName The file that records the receptions in progress (see "rcv --watch").
+const receptionFileName = "receptions.json"
 
---{{.Boundary}}--`
+// profileFileName The file that records how the emails of the accounts are received (see "rcv --save-profile").
+const profileFileName = "profiles.json"
 
-// See https://pkg.go.dev/text/template
-type emailContent struct {
-	Boundary    string
-	MessageText string
-	MessageHtml string
-}
+// reuseIndexFileName The file that records the boundaries received and the ranges of key material used by the hidden
+// messages decoded, so that a reuse of the key material by the sender is detected (see "rcv").
+const reuseIndexFileName = "reuse.json"
+
+// watchIdlePeriod The maximum duration of an IDLE command: the servers may end the ones that last more than 30 minutes
+// (RFC 2177).
+const watchIdlePeriod = 25 * time.Minute
+
+// oauthTimeout The timeout of the requests sent to the OAuth2 providers.
+const oauthTimeout = 30 * time.Second
+
+// transportImap The transport used to retrieve the emails, unless the Microsoft Graph API is used.
+const transportImap = "imap"
+
+// apiTimeout The timeout of the requests sent to the HTTP APIs used to send the emails.
+const apiTimeout = 2 * time.Minute
+
+// proxyTimeout The timeout of the connection to the SMTP server through a SOCKS5 proxy (Tor may take a while to build
+// a circuit).
+const proxyTimeout = time.Minute
+
+// daemonPollInterval The interval at which the daemon checks the queue when no email is due.
+const daemonPollInterval = time.Minute
+
+const DefaultSmtpServerAddress = "localhost"
+const DefaultSmtpPort = 465
+const DefaultImapServerAddress = "localhost"
+const DefaultImapServerPort = 993
+const DefaultImapStartTlsPort = 143
+const DefaultBodyFile = "body1.txt"
+const DefaultPageLength = 512
 
 // boundaryLength The length, in bytes, of a boundary. Do not modify this value.
 // Please note that 35 bytes can be used to represent 70 hexadecimal characters.
@@ -87,8 +236,12 @@ const boundaryLength = 35
 var appDir string
 var sessionDir string
 var keyDir string
-var boundaryRegex = regexp.MustCompile(`boundary="(?P<boundary>[^"]+)"`)
-var trimmerRegex = regexp.MustCompile(`\s+`)
+var bodyDir string
+var sessionStore umailData.Store
+
+// receiveCarriers The parts of the emails received that hide the chunks of the message (see "rcv --carriers"). If
+// empty, then the chunks are hidden by the boundaries only.
+var receiveCarriers umailData.Carriers
 
 type ActionData struct {
 	Description string
@@ -102,6 +255,18 @@ type Email struct {
 
 type emailIndex = uint32
 
+// emailCandidate An email that has a boundary (a candidate for a hidden message): its boundaries, the date it was sent
+// (zero if unknown), its sender and its subject.
+// The body of a pending email has not been fetched yet (IMAP, see `fetchImapHeaders`): its boundaries are unknown
+// until it is selected (see `fetchSelectedEmails`).
+type emailCandidate struct {
+	boundaries []string
+	sent       time.Time
+	from       string
+	subject    string
+	pending    bool
+}
+
 func logError(messages []string) {
 	for _, message := range messages {
 		fmt.Printf("%s\n", message)
@@ -113,763 +278,7661 @@ func boundaryAsString(inBytes []byte) string {
 	return hex.EncodeToString(inBytes)
 }
 
-func cypher(b1 []byte, b2 []byte) []byte {
-	var result []byte
-	if len(b1) != len(b2) {
-		panic("cannot cypher `b1` with `b2`: different lengths")
-	}
-	for i, v := range b1 {
-		result = append(result, v^b2[i])
-	}
-	return result
-}
-
 func processCreateKey() error {
 	var err error
-	var cliPoolName = os.Args[1]
-	var cliSourcePath = os.Args[2]
-	var poolPath = filepath.Join(keyDir, cliPoolName)
-
-	if _, err = resource.PoolCreate(poolPath, cliSourcePath); err != nil {
-		return fmt.Errorf(`cannot create the pool "%s" (%s) from file "%s": %s`, cliPoolName, poolPath, cliSourcePath, err.Error())
-	}
-	return nil
-}
-
-func processCreateSession() error {
-	var err error
-	var message *umailData.Message = &umailData.Message{}
+	var cliPoolName string
+	var cliXor bool
+	var cliConcat bool
+	var cliLength int64
+	var poolPath string
 	var pool *resource.Pool
-	var poolPointerPosition int64
-	var session umailData.Session
-	var key *[][]byte
-	var cliSessionName string
-	var cliSessionPath string
-	var cliKeyName *string
-	var cliKeyPath string
-	var cliMessagePath *string
+	var sources []*resource.EntropySource
+	var data []byte
 
-	// Parse the command line: smail [--pool=</path/to/pool/file>] [--message=</path/to/message/file>] <session name>
-	cliKeyName = flag.String("key", defaultKeyName, "name of the key")
-	cliMessagePath = flag.String("message", defaultMessagePath, "path to the message file")
+	// Parse the command line: create-key [--xor|--concat] [--length=<bytes>] <key name> <source>...
+	flag.BoolVar(&cliXor, "xor", false, "combine the sources by XORing them (default)")
+	flag.BoolVar(&cliConcat, "concat", false, "combine the sources by concatenating them")
+	flag.Int64Var(&cliLength, "length", 0, fmt.Sprintf(`number of bytes to read from endless sources ("%s" or devices)`, resource.EntropyCsprng))
 	flag.Parse()
-	if len(flag.Args()) != 1 {
-		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
+	if len(flag.Args()) < 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of at least 2)`, len(flag.Args()))
 	}
-	cliSessionName = flag.Arg(0)
-	cliSessionPath = filepath.Join(sessionDir, cliSessionName)
-	cliKeyPath = filepath.Join(keyDir, *cliKeyName)
-
-	// Open the key and retrieve the current position of the position pointer.
-	if pool, err = resource.PoolOpen(cliKeyPath); err != nil {
-		return fmt.Errorf(`cannot open key file "%s": %s`, cliKeyPath, err)
+	if cliXor && cliConcat {
+		return fmt.Errorf(`invalid command line: "--xor" and "--concat" are mutually exclusive`)
 	}
-	defer pool.Close()
-	poolPointerPosition = pool.Position
-
-	// Load the message. The message is organized into chunks of data.
-	if err = message.Load(*cliMessagePath, boundaryLength); err != nil {
-		return fmt.Errorf(`cannot load the message from the file "%s": %s`, *message, err)
+	if cliLength < 0 {
+		return fmt.Errorf(`invalid length (%d)`, cliLength)
 	}
+	cliPoolName = flag.Arg(0)
+	poolPath = filepath.Join(keyDir, cliPoolName)
 
-	// Extract the required number of bytes from the pool.
-	// Note: since the length of the message is limited to 65535 bytes, it is possible to convert the length into
-	//       `uint64`.
-	if key, err = pool.GetBytesAsChunks(int64(message.BoundariesCount()), boundaryLength); err != nil {
-		return fmt.Errorf(`not enough bytes left into the key file "%s" (needed %d bytes)`, cliKeyPath, message.BoundariesCount()*boundaryLength)
+	for _, name := range flag.Args()[1:] {
+		var source *resource.EntropySource
+		if source, err = resource.EntropyOpen(name); err != nil {
+			return fmt.Errorf(`cannot open the entropy source "%s": %s`, name, err.Error())
+		}
+		defer source.Close()
+		sources = append(sources, source)
 	}
-
-	// Create the session.
-	// `message XOR key` for each `message`
-	// m: a chunk of the message (to hide)
-	// k: a chunk of the key
-	session.Init(*cliKeyName, poolPointerPosition)
-	for i, m := range *message {
-		k := (*key)[i]
-		session.AddBoundary(cypher(m, k))
+	if cliConcat {
+		data, err = resource.EntropyConcat(sources, cliLength)
+	} else {
+		data, err = resource.EntropyXor(sources, cliLength)
 	}
-	if err = session.Save(cliSessionPath); err != nil {
-		return fmt.Errorf(`cannot create the session file "%s": %s`, cliKeyPath, err)
+	if err != nil {
+		return fmt.Errorf(`cannot create the pool "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
 	}
 
+	if pool, err = resource.PoolCreateFromBytes(poolPath, data, 0); err != nil {
+		return fmt.Errorf(`cannot create the pool "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
+	}
+	defer pool.Close()
+	if cliConcat {
+		err = recordKeyInfo(cliPoolName, "create-key (concatenation of: "+strings.Join(flag.Args()[1:], ", ")+")")
+	} else {
+		err = recordKeyInfo(cliPoolName, "create-key (XOR of: "+strings.Join(flag.Args()[1:], ", ")+")")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("file: \"%s\"\n", poolPath)
+	fmt.Printf("key length: %d\n", len(data))
 	return nil
 }
 
-func processInfo() error {
-	fmt.Printf("Application directory: \"%s\"\n", appDir)
-	fmt.Printf("Session directory: \"%s\"\n", sessionDir)
-	fmt.Printf("Key directory: \"%s\"\n", keyDir)
-	return nil
-}
-
-func initEnv() error {
+func processAppendKey() error {
 	var err error
-	var homeDir string
-	var info os.FileInfo
+	var cliPoolName string
+	var cliSourcePath string
+	var cliRandomCount int64
+	var poolPath string
+	var pool resource.KeySource
+	var editor resource.KeyEditor
+	var count int64
+	var length int64
 
-	if homeDir, err = os.UserHomeDir(); err != nil {
-		log.Fatal(err)
+	// Parse the command line: append-key [--random=<count>] <key name> [</path/to/source/file>]
+	flag.Int64Var(&cliRandomCount, "random", 0, "number of bytes to generate using a CSPRNG (instead of reading them from a file)")
+	flag.Parse()
+	if cliRandomCount < 0 {
+		return fmt.Errorf(`invalid number of random bytes (%d)`, cliRandomCount)
 	}
-	appDir = filepath.Join(homeDir, defaultAppDataBaseName)
-	sessionDir = filepath.Join(appDir, sessionSubDir)
-	keyDir = filepath.Join(appDir, keySubDir)
+	if cliRandomCount > 0 && len(flag.Args()) != 1 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(flag.Args()))
+	}
+	if cliRandomCount == 0 && len(flag.Args()) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 2)`, len(flag.Args()))
+	}
+	cliPoolName = flag.Arg(0)
+	poolPath = filepath.Join(keyDir, cliPoolName)
 
-	if info, err = os.Stat(appDir); err != nil {
-		if os.IsNotExist(err) {
-			// The entry does not exist. We create it.
-			if err = os.MkdirAll(sessionDir, 0644); err != nil {
-				return fmt.Errorf(`cannot create the directory used to store sessions "%s": %s`, sessionDir, err)
-			}
-			if err = os.MkdirAll(keyDir, 0644); err != nil {
-				return fmt.Errorf(`cannot create the directory used to store keys "%s": %s`, keyDir, err)
-			}
-			return nil
-		}
-		return fmt.Errorf(`unexpected error while checking for the existence of the application directory "%s": %s`, appDir, err.Error())
+	if pool, editor, err = openKeyEditor(poolPath); err != nil {
+		return err
 	}
+	defer pool.Close()
 
-	// The entry exists. Make sure that it is a directory.
-	if !info.IsDir() {
-		return fmt.Errorf(`unexpected error while checking for the existence of the application directory. The entry "%s" exists but is not a directory`, appDir)
+	if cliRandomCount > 0 {
+		var buffer = make([]byte, cliRandomCount)
+		if _, err = rand.Read(buffer); err != nil {
+			return fmt.Errorf(`cannot generate %d random bytes: %s`, cliRandomCount, err.Error())
+		}
+		if err = editor.AppendBytes(buffer); err != nil {
+			return fmt.Errorf(`cannot append bytes to the key "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
+		}
+		count = cliRandomCount
+	} else {
+		cliSourcePath = flag.Arg(1)
+		if count, err = editor.Append(cliSourcePath); err != nil {
+			return fmt.Errorf(`cannot append the file "%s" to the key "%s" (%s): %s`, cliSourcePath, cliPoolName, poolPath, err.Error())
+		}
 	}
 
-	// At this point, we consider that the directory is well-structured.
+	if length, err = pool.Length(); err != nil {
+		return fmt.Errorf(`cannot get the length of the key "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
+	}
+	fmt.Printf("bytes appended: %d\n", count)
+	fmt.Printf("key length: %d (current read position: %d)\n", length, pool.Position())
 	return nil
 }
 
-func buildMessage(headers map[string]string, body string) string {
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
-	}
-	message += "\r\n" + body
-	return message
-}
+func processCloneKey() error {
+	var err error
+	var cliSourceName string
+	var cliTargetName string
+	var cliPosition int64
+	var cliZero bool
+	var cliPlain bool
+	var sourcePath string
+	var targetPath string
+	var source resource.KeySource
+	var target resource.KeySource
+	var passphrase []byte
 
-func createHtmlBody(body []byte) []byte {
-	var lines = strings.Split(string(body), "\n")
-	var htmlLines = []string{`<div style="font-family: Arial, sans-serif; font-size: 14px;">`}
-	var html string
+	// Parse the command line: clone-key [--from-position=<position>] [--zero] [--plain] <source key name> <new key name>
+	flag.Int64Var(&cliPosition, "from-position", -1, "position of the position pointer in the new key (default: the current position of the source key)")
+	flag.BoolVar(&cliZero, "zero", false, "set the bytes that precede the position pointer to zero in the new key")
+	flag.BoolVar(&cliPlain, "plain", false, "write a plain copy of a protected key (by default, the copy is protected by a new passphrase)")
+	flag.Parse()
+	if len(flag.Args()) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 2)`, len(flag.Args()))
+	}
+	cliSourceName = flag.Arg(0)
+	cliTargetName = flag.Arg(1)
+	sourcePath = filepath.Join(keyDir, cliSourceName)
+	targetPath = filepath.Join(keyDir, cliTargetName)
+	if _, err = os.Stat(targetPath); err == nil {
+		return fmt.Errorf(`the key "%s" (%s) already exists`, cliTargetName, targetPath)
+	}
 
-	for _, line := range lines {
-		htmlLines = append(htmlLines, "<p>"+line+"</p>")
+	if source, err = resource.Open(sourcePath); err != nil {
+		return fmt.Errorf(`cannot open key file "%s": %s`, sourcePath, err)
 	}
-	htmlLines = append(htmlLines, "</div>")
-	html = strings.Join(htmlLines, "\n")
-	return []byte(html)
+	defer source.Close()
+	// The copy of a protected key is protected too, unless a plain copy is explicitly asked for.
+	if _, protected := source.(*resource.ProtectedPool); protected && !cliPlain {
+		fmt.Printf("The key \"%s\" is protected: enter the passphrase of the new key (see \"--plain\").\n", cliSourceName)
+		if passphrase, err = readNewPassphrase(); err != nil {
+			return err
+		}
+		target, err = resource.ProtectedClone(source, targetPath, cliPosition, cliZero, passphrase)
+	} else {
+		target, err = resource.Clone(source, targetPath, cliPosition, cliZero)
+	}
+	if err != nil {
+		return fmt.Errorf(`cannot create the key "%s" (%s): %s`, cliTargetName, targetPath, err.Error())
+	}
+	defer target.Close()
+	if err = recordKeyInfo(cliTargetName, fmt.Sprintf(`clone-key (copy of "%s", from position %d)`, cliSourceName, target.Position())); err != nil {
+		return err
+	}
+	fmt.Printf("file: \"%s\"\n", targetPath)
+	fmt.Printf("current read position: %d\n", target.Position())
+	return nil
 }
 
-func processSend() error {
+func processExportKey() error {
 	var err error
-	var keyName string
-	var sessionName string
-	var sessionPath string
-	var to string
-	var from string
-	var password string
-	var subject string
-	var bodyPath string
-	var body []byte
-	var htmlBody []byte
-	var smtpServerAddress string
-	var smtpServerPort int
-	var auth smtp.Auth
-	var connection *tls.Conn
-	var smtpClient *smtp.Client
-	var smtpUri string
-	var tlsConfig *tls.Config
-	var writer io.WriteCloser
-	var session umailData.Session
-	var headers map[string]string
-	var message string
-	var messageBuffer bytes.Buffer
-	var boundary string
-	var tpl *template.Template
-
-	if tpl, err = template.New("email").Parse(emailTemplate); err != nil {
-		return fmt.Errorf(`unexpected error while generating the email body: %s`, err)
-	}
+	var cliPoolName string
+	var cliOutputDir string
+	var cliFormat string
+	var cliFrom int64
+	var cliCount int64
+	var cliPageLength int
+	var poolPath string
+	var pool resource.KeySource
+	var length int64
+	var data []byte
+	var pages []resource.Page
 
-	// Parse the command line.
-	flag.StringVar(&smtpServerAddress, "smtp", DefaultSmtpServerAddress, fmt.Sprintf("address of the SMTP server (default: %s)", DefaultSmtpServerAddress))
-	flag.IntVar(&smtpServerPort, "port", DefaultSmtpPort, fmt.Sprintf("SMTP server port number (default: %d)", DefaultSmtpPort))
-	flag.StringVar(&password, "password", "", "sender password used for authentication")
-	flag.StringVar(&bodyPath, "body", DefaultBodyFile, fmt.Sprintf("path to the file that contains the email's body (default: %s)", DefaultBodyFile))
-	flag.StringVar(&keyName, "key", defaultKeyName, fmt.Sprintf("name of the key (default: %s)", defaultKeyName))
+	// Parse the command line: export-key [--format=paper|qr] [--from=<position>] [--count=<bytes>] [--page-length=<bytes>] <key name> <output directory>
+	flag.StringVar(&cliFormat, "format", "paper", `output format: "paper" (text pages) or "qr" (PNG QR codes)`)
+	flag.Int64Var(&cliFrom, "from", 0, "position of the first byte to export")
+	flag.Int64Var(&cliCount, "count", 0, "number of bytes to export (default: up to the end of the key)")
+	flag.IntVar(&cliPageLength, "page-length", DefaultPageLength, fmt.Sprintf("number of bytes per page (default: %d)", DefaultPageLength))
 	flag.Parse()
-
-	if len(flag.Args()) != 4 {
-		return fmt.Errorf(`invalid number of arguments (%d instead of 4)`, len(flag.Args()))
+	if len(flag.Args()) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 2)`, len(flag.Args()))
 	}
-	sessionName = flag.Arg(0)
-	from = flag.Arg(1)
-	to = flag.Arg(2)
-	subject = mime.QEncoding.Encode("utf-8", flag.Arg(3))
+	if cliFormat != "paper" && cliFormat != "qr" {
+		return fmt.Errorf(`invalid format "%s" (valid formats are "paper" and "qr")`, cliFormat)
+	}
+	cliPoolName = flag.Arg(0)
+	cliOutputDir = flag.Arg(1)
+	poolPath = filepath.Join(keyDir, cliPoolName)
 
-	// Load all data from files.
-	sessionPath = filepath.Join(sessionDir, sessionName)
-	if body, err = os.ReadFile(bodyPath); err != nil {
-		return fmt.Errorf(`cannot load the email body from file "%s": %s`, bodyPath, err.Error())
+	if pool, err = resource.Open(poolPath); err != nil {
+		return fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
 	}
-	htmlBody = createHtmlBody(body)
-	if err = session.Load(sessionPath); err != nil {
-		return fmt.Errorf(`cannot load the session (%s) data from file "%s": %s`, sessionName, sessionPath, err.Error())
+	defer pool.Close()
+	if length, err = pool.Length(); err != nil {
+		return fmt.Errorf(`cannot get the length of the key "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
 	}
-
-	// Make sure that the session has not already been processed.
-	if session.EmailIndex >= len(session.Boundaries) {
-		return fmt.Errorf(`the session "%s" has already been processed`, sessionName)
+	if cliCount == 0 {
+		cliCount = length - cliFrom
+	}
+	if cliFrom < 0 || cliCount <= 0 || cliFrom+cliCount > length {
+		return fmt.Errorf(`invalid range (from %d, %d bytes): the key contains %d bytes`, cliFrom, cliCount, length)
+	}
+	if data, err = pool.ReadAt(cliFrom, cliCount); err != nil {
+		return err
+	}
+	if pages, err = resource.PagesCreate(data, cliFrom, cliPageLength); err != nil {
+		return err
 	}
 
-	// Open connexion to the SMTP server.
-	auth = smtp.PlainAuth("", from, password, smtpServerAddress)
-	smtpUri = fmt.Sprintf("%s:%d", smtpServerAddress, smtpServerPort)
-	tlsConfig = &tls.Config{
-		InsecureSkipVerify: true,
-		ServerName:         smtpServerAddress,
+	if err = os.MkdirAll(cliOutputDir, 0755); err != nil {
+		return fmt.Errorf(`cannot create the output directory "%s": %s`, cliOutputDir, err.Error())
 	}
-	if connection, err = tls.Dial("tcp", smtpUri, tlsConfig); err != nil {
-		return fmt.Errorf(`cannot connect to SMTPS server on "%s" (TLS enabled): %s`, smtpUri, err.Error())
+	for _, page := range pages {
+		var pagePath = filepath.Join(cliOutputDir, fmt.Sprintf("page-%04d", page.Number))
+		if cliFormat == "qr" {
+			pagePath += ".png"
+			err = qrcode.WriteFile(page.String(), qrcode.Medium, 1024, pagePath)
+		} else {
+			pagePath += ".txt"
+			err = os.WriteFile(pagePath, []byte(page.String()), 0644)
+		}
+		if err != nil {
+			return fmt.Errorf(`cannot write the page %d/%d into file "%s": %s`, page.Number, page.Count, pagePath, err.Error())
+		}
+		fmt.Printf("%s\n", pagePath)
 	}
-	if smtpClient, err = smtp.NewClient(connection, smtpServerAddress); err != nil {
-		return fmt.Errorf(`cannot connect to SMTPS server on "%s" (TLS enabled): %s`, smtpUri, err.Error())
+	fmt.Printf("pages: %d (bytes %d to %d)\n", len(pages), cliFrom, cliFrom+cliCount-1)
+	return nil
+}
+
+func processImportKey() error {
+	var err error
+	var cliPoolName string
+	var poolPath string
+	var pool *resource.Pool
+	var pages []resource.Page
+	var position int64
+	var data []byte
+
+	// Parse the command line: import-key <key name> <page file>...
+	if len(os.Args) < 3 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of at least 2)`, len(os.Args)-1)
 	}
-	if err = smtpClient.Auth(auth); err != nil {
-		return fmt.Errorf(`cannot authenticate on SMTPS server on "%s" (TLS enabled): %s`, smtpUri, err.Error())
+	cliPoolName = os.Args[1]
+	poolPath = filepath.Join(keyDir, cliPoolName)
+	if _, err = os.Stat(poolPath); err == nil {
+		return fmt.Errorf(`the key "%s" (%s) already exists`, cliPoolName, poolPath)
 	}
 
-	// Send the email.
-	boundary = boundaryAsString(session.Boundaries[session.EmailIndex])
-	headers = map[string]string{
-		"From":         from,
-		"To":           to,
-		"Subject":      subject,
-		"Content-Type": fmt.Sprintf(`multipart/alternative;  boundary="%s"`, boundary),
+	for _, pagePath := range os.Args[2:] {
+		var text []byte
+		var page *resource.Page
+		if text, err = os.ReadFile(pagePath); err != nil {
+			return fmt.Errorf(`cannot load the page from file "%s": %s`, pagePath, err.Error())
+		}
+		if page, err = resource.PageParse(string(text)); err != nil {
+			return fmt.Errorf(`file "%s": %s`, pagePath, err.Error())
+		}
+		pages = append(pages, *page)
 	}
-	if err = tpl.Execute(&messageBuffer,
-		emailContent{
-			Boundary:    boundary,
-			MessageText: b64.StdEncoding.EncodeToString(body),
-			MessageHtml: b64.StdEncoding.EncodeToString(htmlBody)}); err != nil {
-		return fmt.Errorf(`unexpected error while generating the email body: %s`, err)
+	if position, data, err = resource.PagesAssemble(pages); err != nil {
+		return err
 	}
-	message = buildMessage(headers, messageBuffer.String())
 
-	if err = smtpClient.Mail(from); err != nil {
-		return fmt.Errorf(`error while sending "MAIL FROM:%s<CRLF>" command: %s`, from, err.Error())
+	// The bytes that precede the imported range are unknown: they are set to zero, and the position pointer is set
+	// to the first imported byte. Thus, positions are the same in the exported key and in the imported one.
+	if pool, err = resource.PoolCreateFromBytes(poolPath, append(make([]byte, position), data...), position); err != nil {
+		return fmt.Errorf(`cannot create the key "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
+	}
+	defer pool.Close()
+	if err = recordKeyInfo(cliPoolName, fmt.Sprintf("import-key (%d pages)", len(pages))); err != nil {
+		return err
 	}
-	if err = smtpClient.Rcpt(to); err != nil {
-		return fmt.Errorf(`error while sending "MAIL TO:%s<CRLF>" command: %s`, to, err.Error())
+	fmt.Printf("file: \"%s\"\n", poolPath)
+	fmt.Printf("current read position: %d (%d bytes imported)\n", pool.Position(), len(data))
+	return nil
+}
+
+func processBenchKey() error {
+	var err error
+	var cliSize int64
+	var cliChunkLength int64
+	var cliIterations int
+	var tempDir string
+	var poolPath string
+	var pool *resource.Pool
+	var source resource.KeySource
+	var editor resource.KeyEditor
+	var data []byte
+	var start time.Time
+	var elapsed time.Duration
+	var chunkCount int
+
+	// Parse the command line: bench-key [--size=<bytes>] [--chunk=<bytes>] [--iterations=<count>]
+	flag.Int64Var(&cliSize, "size", 1024*1024, "size of the pool used for the benchmark, in bytes")
+	flag.Int64Var(&cliChunkLength, "chunk", boundaryLength, "length of the chunks extracted from the pool, in bytes")
+	flag.IntVar(&cliIterations, "iterations", 100, "number of iterations for the open/close and position update measurements")
+	flag.Parse()
+	if cliSize <= 0 || cliChunkLength <= 0 || cliChunkLength > cliSize || cliIterations <= 0 {
+		return fmt.Errorf(`invalid parameters (size: %d, chunk: %d, iterations: %d)`, cliSize, cliChunkLength, cliIterations)
 	}
-	if writer, err = smtpClient.Data(); err != nil {
-		return fmt.Errorf(`error while sending "DATA<CRLF>" command: %s`, err.Error())
+
+	// The benchmark uses a temporary pool: real keys must not be consumed.
+	if tempDir, err = os.MkdirTemp("", "umail-bench-"); err != nil {
+		return fmt.Errorf(`cannot create a temporary directory: %s`, err.Error())
 	}
-	if _, err = writer.Write([]byte(message)); err != nil {
-		return fmt.Errorf(`error while sending sending the message to send: %s`, err.Error())
+	defer os.RemoveAll(tempDir)
+	poolPath = filepath.Join(tempDir, "pool")
+	data = make([]byte, cliSize)
+	if _, err = rand.Read(data); err != nil {
+		return fmt.Errorf(`cannot generate %d random bytes: %s`, cliSize, err.Error())
 	}
-	if err = writer.Close(); err != nil {
-		return fmt.Errorf(`error while closing SMTP writer: %s`, err.Error())
+	start = time.Now()
+	if pool, err = resource.PoolCreateFromBytes(poolPath, data, 0); err != nil {
+		return fmt.Errorf(`cannot create the pool "%s": %s`, poolPath, err.Error())
 	}
-	if err = smtpClient.Quit(); err != nil {
-		return fmt.Errorf(`error while sending "QUIT<CRLF>" command: %s`, err.Error())
+	pool.Close()
+	fmt.Printf("create: %s (%d bytes)\n", time.Since(start), cliSize)
+
+	// Open/close latency.
+	start = time.Now()
+	for i := 0; i < cliIterations; i++ {
+		if source, err = resource.Open(poolPath); err != nil {
+			return err
+		}
+		source.Close()
 	}
+	elapsed = time.Since(start)
+	fmt.Printf("open/close: %s per open/close (%d iterations)\n", elapsed/time.Duration(cliIterations), cliIterations)
 
-	session.EmailIndex += 1
-	if err = session.Save(sessionPath); err != nil {
-		return fmt.Errorf(`cannot update session "%s" (path: %s): %s`, sessionName, sessionPath, err.Error())
+	if source, editor, err = openKeyEditor(poolPath); err != nil {
+		return err
 	}
+	defer source.Close()
 
-	fmt.Printf("Number of emails sent: %d (over %d)\n", session.EmailIndex, len(session.Boundaries))
-	if session.EmailIndex >= len(session.Boundaries) {
-		fmt.Printf("The session has been entirely processes.\n")
+	// Position update overhead.
+	start = time.Now()
+	for i := 0; i < cliIterations; i++ {
+		if err = editor.SetPositionToFile(0); err != nil {
+			return err
+		}
 	}
+	elapsed = time.Since(start)
+	fmt.Printf("position update: %s per update (%d iterations)\n", elapsed/time.Duration(cliIterations), cliIterations)
 
+	// Sequential chunk extraction.
+	start = time.Now()
+	for source.Position()+cliChunkLength <= cliSize {
+		if _, err = source.Read(cliChunkLength); err != nil {
+			return err
+		}
+		chunkCount++
+	}
+	elapsed = time.Since(start)
+	fmt.Printf("chunk extraction: %d chunks of %d bytes in %s (%s per chunk, %.2f KB/s)\n",
+		chunkCount, cliChunkLength, elapsed, elapsed/time.Duration(chunkCount),
+		resource.Throughput(int64(chunkCount)*cliChunkLength, elapsed))
 	return nil
 }
 
-func processSessionInfo() error {
+// openKeyEditor Opens a key whose key material or position is modified (see `resource.KeyEditor`), protected or not.
+func openKeyEditor(poolPath string) (resource.KeySource, resource.KeyEditor, error) {
 	var err error
-	var sessionName string
-	var sessionPath string
-	var session umailData.Session
-	var b2l = func(b []uint8) string {
-		var result []string
-		for _, v := range b {
-			result = append(result, fmt.Sprintf("%d", v))
-		}
-		return strings.Join(result, ", ")
-	}
+	var pool resource.KeySource
 
-	if len(os.Args) != 2 {
-		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(os.Args))
+	if pool, err = resource.Open(poolPath); err != nil {
+		return nil, nil, fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
 	}
-	sessionName = os.Args[1]
-	sessionPath = filepath.Join(sessionDir, sessionName)
-	if err = session.Load(sessionPath); err != nil {
-		return fmt.Errorf(`cannot load the session (%s) data from file "%s": %s`, sessionName, sessionPath, err.Error())
-	}
-	fmt.Printf("name: \"%s\" (%s)\n", sessionName, sessionPath)
-	fmt.Printf("pool: \"%s\" (%s) at %d\n", session.PoolName, filepath.Join(keyDir, session.PoolName), session.PoolPointerPosition)
-	fmt.Printf("email sent: %d\n", session.EmailIndex)
-	fmt.Printf("boundaries (%d):\n", len(session.Boundaries))
-	for i := 0; i < len(session.Boundaries); i++ {
-		fmt.Printf("[%3d]  [%s] (len: %d)\n", i, b2l(session.Boundaries[i]), len(session.Boundaries[i]))
-		fmt.Printf("       => \"%s\"\n", boundaryAsString(session.Boundaries[i]))
-
+	if editor, ok := pool.(resource.KeyEditor); ok {
+		return pool, editor, nil
 	}
-	fmt.Printf("number of emails to send: %d\n", len(session.Boundaries)-session.EmailIndex)
-	return nil
+	pool.Close()
+	return nil, nil, fmt.Errorf(`the key file "%s" cannot be modified`, poolPath)
 }
 
-func procesSessionReset() error {
+// sessionsUsingKey Returns the names of the sessions that use a given key. Only the name of the key is read from the
+// session files (see `umailData.SessionPoolName`): the sessions are not decrypted. A warning is printed for the sessions
+// that cannot be read (or that are protected): they are skipped.
+func sessionsUsingKey(keyName string) ([]string, error) {
 	var err error
-	var sessionName string
-	var sessionPath string
-	var session umailData.Session
+	var sessionNames []string
+	var names []string
 
-	if len(os.Args) != 2 {
-		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(os.Args))
+	if sessionNames, err = sessionStore.ListSessions(); err != nil {
+		return nil, fmt.Errorf(`cannot list the sessions: %s`, err.Error())
 	}
-	sessionName = os.Args[1]
-	sessionPath = filepath.Join(sessionDir, sessionName)
-	if err = session.Load(sessionPath); err != nil {
-		return fmt.Errorf(`cannot load the session (%s) data from file "%s": %s`, sessionName, sessionPath, err.Error())
+	for _, sessionName := range sessionNames {
+		var content []byte
+		var poolName string
+
+		if content, err = sessionStore.ReadSession(sessionName); err == nil {
+			poolName, err = umailData.SessionPoolName(content)
+		}
+		if err != nil {
+			fmt.Printf("Warning: cannot tell whether the session \"%s\" uses the key \"%s\": %s\n", sessionName, keyName, err.Error())
+			continue
+		}
+		if poolName == keyName {
+			names = append(names, sessionName)
+		}
 	}
-	return session.Reset(sessionPath)
+	return names, nil
 }
 
-func processPoolReset() error {
+func processShredKey() error {
 	var err error
 	var cliPoolName string
-	var cliPoolPointerPosition int64
+	var cliPasses int
+	var cliForce bool
 	var poolPath string
-	var pool *resource.Pool
+	var sessions []string
 
-	if len(os.Args) != 3 {
-		return fmt.Errorf(`invalid number of arguments (%d instead of 3)`, len(os.Args))
-	}
-	cliPoolName = os.Args[1]
-	if cliPoolPointerPosition, err = strconv.ParseInt(os.Args[2], 10, 64); err != nil {
-		return fmt.Errorf(`invalid position (%s)`, os.Args[2])
+	// Parse the command line: shred-key [--passes=<count>] [--force] <key name>
+	flag.IntVar(&cliPasses, "passes", 3, "number of times the key is overwritten with random data")
+	flag.BoolVar(&cliForce, "force", false, "destroy the key even if sessions use it")
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(flag.Args()))
 	}
+	cliPoolName = flag.Arg(0)
 	poolPath = filepath.Join(keyDir, cliPoolName)
-	if pool, err = resource.PoolOpen(poolPath); err != nil {
-		return fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
+	if _, err = os.Stat(poolPath); err != nil {
+		return fmt.Errorf(`cannot find the key "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
+	}
+
+	if sessions, err = sessionsUsingKey(cliPoolName); err != nil {
+		return err
+	}
+	if len(sessions) > 0 && !cliForce {
+		return fmt.Errorf(`the key "%s" is used by the following sessions: %s (use --force to destroy it anyway)`, cliPoolName, strings.Join(sessions, ", "))
+	}
+
+	if err = resource.Shred(poolPath, cliPasses); err != nil {
+		return fmt.Errorf(`cannot destroy the key "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
+	}
+	if err = sessionStore.DeleteKeyInfo(cliPoolName); err != nil {
+		return fmt.Errorf(`cannot remove the metadata of the key "%s": %s`, cliPoolName, err.Error())
+	}
+	fmt.Printf("The key \"%s\" has been destroyed (%d passes).\n", cliPoolName, cliPasses)
+	return nil
+}
+
+func processCreateSession() error {
+	var err error
+	var pool resource.KeySource
+	var poolPointerPosition int64
+	var session umailData.Session
+	var cliSessionName string
+	var cliKeyName *string
+	var cliKeyPath string
+	var cliMessagePath *string
+	var cliProtect *bool
+	var cliKeyFilePath *string
+	var plainMessage []byte
+	var cliRecipients *string
+	var cliRecipient *string
+	var cliSubject *string
+	var cliNote *string
+	var cliBodies *string
+	var cliRotation *string
+	var cliLazy *bool
+	var cliSmtpServerAddress *string
+	var cliSmtpServerPort *int
+	var cliFrom *string
+	var cliPin *string
+	var cliTransport *string
+	var cliProxy *string
+	var cliSent *string
+	var account *umailData.Account
+	var cliMac *bool
+	var cliSequence *bool
+	var cliThread *bool
+	var cliMarker *bool
+	var cliClient *string
+	var cliTextEncoding *string
+	var cliCharset *string
+	var cliBoundaryStyle *string
+	var cliNested *bool
+	var cliHtmlLayout *string
+	var cliInlineCss *bool
+	var cliCorpus *string
+	var cliTemplate *bool
+	var cliCarriers *string
+	var cliPersona *string
+	var cliCoverImage *string
+	var cliVariables = variableFlags{}
+	var chunkLength = boundaryLength
+	var encoding umailData.Encoding
+	var persona umailData.HeaderPersona
+	var carriers umailData.Carriers
+	var client umailData.MailClient
+	var codebookKey string
+	var secret []byte
+	var lock *umailData.SessionLock
+
+	// Parse the command line: smail [--pool=</path/to/pool/file>] [--message=</path/to/message/file>] <session name>
+	cliKeyName = flag.String("key", defaultKeyName, "name of the key")
+	cliMessagePath = flag.String("message", defaultMessagePath, "path to the message file")
+	cliProtect = flag.Bool("protect", false, "encrypt the session file using a passphrase")
+	cliKeyFilePath = flag.String("key-file", "", "encrypt the session file using a key file (instead of a passphrase)")
+	cliRecipients = flag.String("to", "", "comma separated list of recipients (for a multi-recipient session)")
+	cliRecipient = flag.String("recipient", "", "intended recipient (for a single-recipient session)")
+	cliSubject = flag.String("subject", "", "default subject of the emails")
+	cliNote = flag.String("note", "", "free text note")
+	cliBodies = flag.String("bodies", "", "directory, or comma separated list of files, that contain the bodies of the emails")
+	cliRotation = flag.String("rotation", string(umailData.RotationSequence), `how the bodies are assigned to the emails: "sequence" (in turn) or "random" (without repetition)`)
+	cliCorpus = flag.String("corpus", "", "path to a text from which the bodies of the emails are generated (instead of bodies)")
+	cliTemplate = flag.Bool("template", false, "the bodies of the emails are templates, rendered for each email")
+	flag.Var(cliVariables, "var", `variable of the templates of the bodies ("name=value", can be repeated)`)
+	cliLazy = flag.Bool("lazy", false, "consume the key material when the emails are sent (instead of now)")
+	cliFrom = flag.String("from", "", "bind the session to an account: address of the sender")
+	cliMac = flag.Bool("mac", false, "append a MAC to the message, so that the receiver can check its authenticity")
+	cliSequence = flag.Bool("sequence", false, "number the chunks of the message, so that the receiver can decode the emails in any order")
+	cliThread = flag.Bool("thread", false, "make the emails sent to a recipient look like a conversation (each email replies to the previous one)")
+	cliMarker = flag.Bool("marker", false, `write a marker derived from the key into the message IDs of the emails, so that the receiver only fetches them (see "rcv --marker")`)
+	cliClient = flag.String("client", "", fmt.Sprintf(`mail client whose headers are mimicked by the emails: "%s", "%s" or "%s" (default: none)`, umailData.ClientThunderbird, umailData.ClientOutlook, umailData.ClientAppleMail))
+	cliTextEncoding = flag.String("text-encoding", umailData.TextEncodingBase64, fmt.Sprintf(`encoding of the plain text part of the emails: "%s" or "%s"`, umailData.TextEncodingBase64, umailData.TextEncodingQuotedPrintable))
+	cliCharset = flag.String("charset", umailData.DefaultCharset, `character set of the parts of the emails (such as "iso-8859-1" or "windows-1252")`)
+	cliBoundaryStyle = flag.String("boundary-style", "hex", fmt.Sprintf(`how the boundaries are written: "hex", "%s", "%s" or "%s"`, umailData.BoundaryThunderbird, umailData.BoundaryOutlook, umailData.BoundaryPhpMailer))
+	cliNested = flag.Bool("nested", false, fmt.Sprintf("nest the multipart parts of the emails, so that each email hides %d boundaries (instead of one)", umailData.NestingDepth))
+	cliHtmlLayout = flag.String("html-layout", "", "path to the layout of the HTML part of the emails (default: a simple layout)")
+	cliInlineCss = flag.Bool("inline-css", false, `move the CSS rules of the HTML part of the emails to the "style" attributes of the elements`)
+	cliCarriers = flag.String("carriers", "", fmt.Sprintf(`comma separated list of the parts of the emails that hide the message (%s), with the number of bytes they hide ("boundary,message-id:6", default: the boundary only)`, strings.Join(umailData.CarrierNames(), ", ")))
+	cliPersona = flag.String("persona", "", fmt.Sprintf(`sender mimicked by the custom headers that hide the message (see --carriers=%s): "%s" (default), "%s" or "%s"`, umailData.CarrierXHeader, umailData.PersonaCampaign, umailData.PersonaTransactional, umailData.PersonaNewsletter))
+	cliCoverImage = flag.String("cover-image", "", fmt.Sprintf(`path to the image (PNG or BMP) attached to the emails, whose pixels hide the message (see --carriers=%s)`, umailData.CarrierImage))
+	cliSmtpServerAddress = flag.String("smtp", DefaultSmtpServerAddress, fmt.Sprintf("address of the SMTP server of the account (default: %s)", DefaultSmtpServerAddress))
+	cliSmtpServerPort = flag.Int("port", DefaultSmtpPort, fmt.Sprintf("SMTP server port number of the account (default: %d)", DefaultSmtpPort))
+	cliPin = flag.String("pin", "", "SHA-256 of the public key of the SMTP server of the account (hexadecimal)")
+	cliTransport = flag.String("transport", "", fmt.Sprintf(`how the emails of the account are sent: "%s" (default), "%s" (Gmail API) or "%s" (Microsoft Graph API)`, umailData.TransportSmtp, umailData.TransportGmail, umailData.TransportGraph))
+	cliProxy = flag.String("proxy", "", `URL of a SOCKS5 proxy the connections to the SMTP server of the account go through ("socks5://[user:password@]host:port")`)
+	cliSent = flag.String("sent", "", `IMAP mailbox the emails sent are appended to ("[user@]server[:port]/mailbox", for example "imap.example.com/Sent")`)
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
+	}
+	cliSessionName = flag.Arg(0)
+	cliKeyPath = filepath.Join(keyDir, *cliKeyName)
+	if len(*cliFrom) > 0 {
+		account = &umailData.Account{SmtpServer: *cliSmtpServerAddress, SmtpPort: *cliSmtpServerPort, From: *cliFrom, Pin: strings.ToLower(*cliPin), Transport: *cliTransport, Proxy: *cliProxy, Sent: *cliSent}
+		if err = account.Validate(); err != nil {
+			return err
+		}
+	}
+	if lock, err = lockSession(cliSessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Open the key and retrieve the current position of the position pointer.
+	if pool, err = resource.Open(cliKeyPath); err != nil {
+		return fmt.Errorf(`cannot open key file "%s": %s`, cliKeyPath, err)
 	}
 	defer pool.Close()
-	if err = pool.SetPositionToFile(cliPoolPointerPosition); err != nil {
-		return fmt.Errorf(`cannot set the value of the position pointer's position: %s`, err.Error())
+	poolPointerPosition = pool.Position()
+
+	// Load the message. The message is organized into chunks of data.
+	if plainMessage, err = os.ReadFile(*cliMessagePath); err != nil {
+		return fmt.Errorf(`cannot load the message from the file "%s": %s`, *cliMessagePath, err)
+	}
+
+	// Create the session. For a lazy session, the key material is consumed when the emails are sent. The chunks of a
+	// nested session are split into one boundary per level.
+	encoding = umailData.Encoding{Authenticated: *cliMac, Sequenced: *cliSequence}
+	if *cliNested {
+		chunkLength = boundaryLength * umailData.NestingDepth
+	}
+	// The chunks may be split across other parts of the emails: they are as long as the carriers can hide.
+	if len(*cliCarriers) > 0 {
+		if carriers, err = umailData.ParseCarriers(*cliCarriers, *cliNested); err != nil {
+			return err
+		}
+		if client, err = umailData.ParseMailClient(*cliClient); err != nil {
+			return err
+		}
+		if err = carriers.CheckClient(client); err != nil {
+			return err
+		}
+		if err = carriers.CheckTextEncoding(*cliTextEncoding); err != nil {
+			return err
+		}
+		if persona, err = umailData.ParseHeaderPersona(*cliPersona); err != nil {
+			return err
+		}
+		carriers.SetPersona(persona)
+		if err = carriers.CheckPersona(); err != nil {
+			return err
+		}
+		if err = setCoverImage(carriers, *cliCoverImage, *cliNested); err != nil {
+			return err
+		}
+		if carriers.IsKeyed() {
+			// The codebook is derived from the key material used by the session.
+			if *cliLazy {
+				return fmt.Errorf(`the emails of a lazy session cannot hide the message in their subjects: the key material they use is not known yet`)
+			}
+			if codebookKey, err = umailData.NewCodebookKey(pool, poolPointerPosition); err != nil {
+				return err
+			}
+			carriers.SetKey(codebookKey)
+		}
+		chunkLength = carriers.Length()
+	}
+	if _, ok := carriers.Get(umailData.CarrierImage); !ok && len(*cliCoverImage) > 0 {
+		return fmt.Errorf(`the cover image (--cover-image) is only attached to the emails that hide the message in its pixels (--carriers=%s)`, umailData.CarrierImage)
 	}
+	if *cliLazy {
+		if encoding != (umailData.Encoding{}) {
+			return fmt.Errorf(`a lazy session cannot be authenticated (--mac), or sequenced (--sequence)`)
+		}
+		if err = session.InitLazy(*cliKeyName, poolPointerPosition, plainMessage, chunkLength); err != nil {
+			return fmt.Errorf(`cannot load the message from the file "%s": %s`, *cliMessagePath, err)
+		}
+	} else {
+		// Extract the required number of bytes from the pool and encrypt the message.
+		if err = session.InitEncoded(*cliKeyName, pool, plainMessage, chunkLength, encoding); err != nil {
+			return fmt.Errorf(`cannot encode the message from the file "%s" (needed %d bytes from the key file "%s"): %s`, *cliMessagePath, encoding.KeyLength(len(plainMessage), chunkLength), cliKeyPath, err)
+		}
+	}
+	session.Nested = *cliNested
+	session.Carriers = carriers
+	session.IntendedRecipient = *cliRecipient
+	session.Subject = *cliSubject
+	session.Note = *cliNote
+	session.Threaded = *cliThread
+	if *cliMarker {
+		if session.Lazy {
+			return fmt.Errorf(`the emails of a lazy session cannot be marked (--marker): the key material they use is not known yet`)
+		}
+		if session.Marker, err = umailData.NewMarker(pool, poolPointerPosition); err != nil {
+			return err
+		}
+	}
+	if session.Client, err = umailData.ParseMailClient(*cliClient); err != nil {
+		return err
+	}
+	if err = umailData.CheckTextEncoding(*cliTextEncoding); err != nil {
+		return err
+	}
+	if *cliTextEncoding != umailData.TextEncodingBase64 {
+		session.TextEncoding = *cliTextEncoding
+	}
+	if session.Charset, err = sessionCharset(*cliCharset); err != nil {
+		return err
+	}
+	if session.BoundaryStyle, err = umailData.ParseBoundaryStyle(*cliBoundaryStyle); err != nil {
+		return err
+	}
+	session.Account = account
+	if session.Bodies, session.Rotation, err = sessionBodies(*cliBodies, *cliRotation); err != nil {
+		return err
+	}
+	if len(*cliCorpus) > 0 {
+		if len(session.Bodies) > 0 {
+			return fmt.Errorf(`the bodies cannot be generated from a corpus (--corpus) if bodies are given (--bodies, or --rotation=random)`)
+		}
+		if session.Corpus, err = filepath.Abs(*cliCorpus); err != nil {
+			return err
+		}
+		if _, err = loadCorpus(session.Corpus); err != nil {
+			return err
+		}
+	}
+	if len(*cliHtmlLayout) > 0 {
+		if session.HtmlLayout, err = filepath.Abs(*cliHtmlLayout); err != nil {
+			return err
+		}
+		if err = checkHtmlLayout(session.HtmlLayout); err != nil {
+			return err
+		}
+	}
+	session.InlineCss = *cliInlineCss
+	session.Templated = *cliTemplate
+	setVariables(&session, cliVariables)
+	if err = checkBodyTemplates(&session); err != nil {
+		return err
+	}
+	if len(*cliRecipients) > 0 {
+		for _, recipient := range strings.Split(*cliRecipients, ",") {
+			if err = session.AddRecipient(strings.TrimSpace(recipient)); err != nil {
+				return err
+			}
+		}
+	}
+	if *cliProtect || len(*cliKeyFilePath) > 0 {
+		if secret, err = readSessionSecret(*cliKeyFilePath); err != nil {
+			return err
+		}
+		if err = session.Protect(secret); err != nil {
+			return err
+		}
+	}
+	if err = saveSession(cliSessionName, &session); err != nil {
+		return err
+	}
+	if session.Lazy && !session.IsProtected() {
+		fmt.Printf("Warning: the session \"%s\" contains the message in clear. You should protect it (see \"protect-session\").\n", cliSessionName)
+	}
+
 	return nil
 }
 
-func processPoolInfo() error {
+// processCloneSession Creates a new session that hides the same message as a given session, using fresh key material
+// (from the current position of the key). The message is decoded from the given session (using the key material it
+// used), unless a copy of the message is given.
+func processCloneSession() error {
 	var err error
-	var cliPoolName string
+	var source umailData.Session
+	var session umailData.Session
+	var pool resource.KeySource
 	var poolPath string
-	var pool *resource.Pool
+	var plainMessage []byte
+	var sourceName string
+	var targetName string
+	var cliKeyName *string
+	var cliMessagePath *string
+	var cliProtect *bool
+	var cliKeyFilePath *string
+	var cliRecipients *string
+	var cliRecipient *string
+	var cliSubject *string
+	var cliNote *string
+	var cliThread *bool
+	var cliMarker *bool
+	var cliClient *string
+	var cliTextEncoding *string
+	var cliCharset *string
+	var cliBoundaryStyle *string
+	var cliNested *bool
+	var cliHtmlLayout *string
+	var cliInlineCss *bool
+	var cliTemplate *bool
+	var cliCarriers *string
+	var cliPersona *string
+	var cliCoverImage *string
+	var cliVariables = variableFlags{}
+	var nested bool
+	var persona umailData.HeaderPersona
+	var carriers umailData.Carriers
+	var codebookKey string
+	var marked bool
+	var chunkLength = boundaryLength
+	var secret []byte
+	var lock *umailData.SessionLock
+	var cliLazy *bool
+	var cliMac *bool
+	var cliSequence *bool
+	var encoding umailData.Encoding
 
-	if len(os.Args) != 2 {
-		return fmt.Errorf(`invalid number of arguments (%d instead of 2)`, len(os.Args))
+	// Parse the command line: clone-session [--key=<name>] [--message=<path>] [...] <source session> <new session>
+	cliKeyName = flag.String("key", "", "name of the key used by the new session (default: the key of the source session)")
+	cliMessagePath = flag.String("message", "", "path to a copy of the message (default: the message is decoded from the source session)")
+	cliProtect = flag.Bool("protect", false, "encrypt the session file using a passphrase")
+	cliKeyFilePath = flag.String("key-file", "", "encrypt the session file using a key file (instead of a passphrase)")
+	cliRecipients = flag.String("to", "", "comma separated list of recipients (for a multi-recipient session)")
+	cliRecipient = flag.String("recipient", "", "intended recipient (default: the recipient of the source session)")
+	cliSubject = flag.String("subject", "", "default subject of the emails (default: the subject of the source session)")
+	cliNote = flag.String("note", "", "free text note (default: the note of the source session)")
+	cliThread = flag.Bool("thread", false, "make the emails sent to a recipient look like a conversation (default: as the source session)")
+	cliMarker = flag.Bool("marker", false, "write a marker derived from the key into the message IDs of the emails (default: if the source session does)")
+	cliClient = flag.String("client", "", "mail client whose headers are mimicked by the emails (default: the client of the source session)")
+	cliTextEncoding = flag.String("text-encoding", "", "encoding of the plain text part of the emails (default: the encoding of the source session)")
+	cliCharset = flag.String("charset", "", "character set of the parts of the emails (default: the character set of the source session)")
+	cliBoundaryStyle = flag.String("boundary-style", "", "how the boundaries are written (default: the style of the source session)")
+	cliNested = flag.Bool("nested", false, "nest the multipart parts of the emails (default: if the source session does)")
+	cliHtmlLayout = flag.String("html-layout", "", `path to the layout of the HTML part of the emails ("" for the default layout, default: the layout of the source session)`)
+	cliInlineCss = flag.Bool("inline-css", false, "move the CSS rules of the HTML part of the emails to the elements (default: if the source session does)")
+	cliTemplate = flag.Bool("template", false, "the bodies of the emails are templates (default: if the bodies of the source session are)")
+	flag.Var(cliVariables, "var", `variable of the templates of the bodies ("name=value", can be repeated, added to the variables of the source session)`)
+	cliLazy = flag.Bool("lazy", false, "consume the key material when the emails are sent (instead of now)")
+	cliMac = flag.Bool("mac", false, "append a MAC to the message (default: if the source session does)")
+	cliSequence = flag.Bool("sequence", false, "number the chunks of the message (default: if the source session does)")
+	cliCarriers = flag.String("carriers", "", `parts of the emails that hide the message ("boundary" for the boundary only, default: the carriers of the source session)`)
+	cliPersona = flag.String("persona", "", "sender mimicked by the custom headers that hide the message (default: the persona of the source session)")
+	cliCoverImage = flag.String("cover-image", "", "path to the image attached to the emails, whose pixels hide the message (default: the cover image of the source session)")
+	flag.Parse()
+	if len(flag.Args()) != 2 {
+		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
 	}
-	cliPoolName = os.Args[1]
-	poolPath = filepath.Join(keyDir, cliPoolName)
-	if pool, err = resource.PoolOpen(poolPath); err != nil {
+	sourceName = flag.Arg(0)
+	targetName = flag.Arg(1)
+
+	if lock, err = lockSession(targetName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if _, err = sessionStore.ReadSession(targetName); !errors.Is(err, umailData.ErrNotFound) {
+		if err != nil {
+			return fmt.Errorf(`cannot check the existence of the session "%s": %s`, targetName, err.Error())
+		}
+		return fmt.Errorf(`the session "%s" already exists`, targetName)
+	}
+	if err = loadSession(sourceName, &source); err != nil {
+		return err
+	}
+
+	// Retrieve the message.
+	if len(*cliMessagePath) > 0 {
+		if plainMessage, err = os.ReadFile(*cliMessagePath); err != nil {
+			return fmt.Errorf(`cannot load the message from the file "%s": %s`, *cliMessagePath, err)
+		}
+		if len(source.MessageHash) > 0 && umailData.MessageHash(plainMessage) != source.MessageHash {
+			return fmt.Errorf(`the message "%s" is not the message hidden by the session "%s"`, *cliMessagePath, sourceName)
+		}
+	} else {
+		poolPath = filepath.Join(keyDir, source.PoolName)
+		if pool, err = resource.Open(poolPath); err != nil {
+			return fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
+		}
+		plainMessage, err = source.DecodeMessage(pool)
+		pool.Close()
+		if err != nil {
+			return fmt.Errorf(`cannot retrieve the message hidden by the session "%s": %s`, sourceName, err.Error())
+		}
+		if len(source.MessageHash) > 0 && umailData.MessageHash(plainMessage) != source.MessageHash {
+			return fmt.Errorf(`cannot retrieve the message hidden by the session "%s": the decoded message does not match the hash of the message (wrong key or corrupted session)`, sourceName)
+		}
+	}
+
+	// Encode the message using fresh key material (or, for a lazy session, keep the message).
+	if len(*cliKeyName) == 0 {
+		*cliKeyName = source.PoolName
+	}
+	poolPath = filepath.Join(keyDir, *cliKeyName)
+	if pool, err = resource.Open(poolPath); err != nil {
 		return fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
 	}
 	defer pool.Close()
-	fmt.Printf("file: \"%s\"\n", poolPath)
-	fmt.Printf("current read position: %d\n", pool.Position)
+	encoding = source.Encoding()
+	nested = source.Nested
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "mac":
+			encoding.Authenticated = *cliMac
+		case "sequence":
+			encoding.Sequenced = *cliSequence
+		case "nested":
+			nested = *cliNested
+		}
+	})
+	if nested {
+		chunkLength = boundaryLength * umailData.NestingDepth
+	}
+	carriers = source.Carriers
+	if len(*cliCarriers) > 0 {
+		if carriers, err = umailData.ParseCarriers(*cliCarriers, nested); err != nil {
+			return err
+		}
+	}
+	if len(carriers) > 0 {
+		carriers = carriers.ForNesting(nested)
+		if carrier, ok := carriers.Get(umailData.CarrierXHeader); ok && (len(*cliPersona) > 0 || len(carrier.Persona) == 0) {
+			if persona, err = umailData.ParseHeaderPersona(*cliPersona); err != nil {
+				return err
+			}
+			carriers.SetPersona(persona)
+		}
+		if err = carriers.CheckPersona(); err != nil {
+			return err
+		}
+		if carrier, ok := source.Carriers.Get(umailData.CarrierImage); ok && len(*cliCoverImage) == 0 {
+			*cliCoverImage = carrier.Cover
+		}
+		if err = setCoverImage(carriers, *cliCoverImage, nested); err != nil {
+			return err
+		}
+		chunkLength = carriers.Length()
+	}
+	if *cliLazy {
+		if encoding != (umailData.Encoding{}) {
+			return fmt.Errorf(`a lazy session cannot be authenticated (--mac), or sequenced (--sequence)`)
+		}
+		if err = session.InitLazy(*cliKeyName, pool.Position(), plainMessage, chunkLength); err != nil {
+			return err
+		}
+	} else if err = session.InitEncoded(*cliKeyName, pool, plainMessage, chunkLength, encoding); err != nil {
+		return fmt.Errorf(`cannot encode the message (needed %d bytes from the key file "%s"): %s`, encoding.KeyLength(len(plainMessage), chunkLength), poolPath, err)
+	}
+	session.Nested = nested
+	if carriers.IsKeyed() {
+		// The codebook is derived from the key material used by the new session.
+		if session.Lazy {
+			return fmt.Errorf(`the emails of a lazy session cannot hide the message in their subjects: the key material they use is not known yet`)
+		}
+		if codebookKey, err = umailData.NewCodebookKey(pool, session.PoolPointerPosition); err != nil {
+			return err
+		}
+		carriers.SetKey(codebookKey)
+	}
+	session.Carriers = carriers
+
+	// The metadata are copied from the source session, unless given.
+	session.MessageHash = umailData.MessageHash(plainMessage)
+	session.IntendedRecipient = source.IntendedRecipient
+	session.Subject = source.Subject
+	session.Note = source.Note
+	session.Bodies = source.Bodies
+	session.Rotation = source.Rotation
+	session.Corpus = source.Corpus
+	session.Templated = source.Templated
+	setVariables(&session, variableFlags(source.Variables))
+	session.Account = source.Account
+	session.Threaded = source.Threaded
+	session.Client = source.Client
+	session.TextEncoding = source.TextEncoding
+	session.Charset = source.Charset
+	session.BoundaryStyle = source.BoundaryStyle
+	session.HtmlLayout = source.HtmlLayout
+	session.InlineCss = source.InlineCss
+	marked = len(source.Marker) > 0
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "thread":
+			session.Threaded = *cliThread
+		case "marker":
+			marked = *cliMarker
+		case "client":
+			session.Client = umailData.MailClient(*cliClient)
+		case "text-encoding":
+			session.TextEncoding = *cliTextEncoding
+		case "charset":
+			session.Charset = *cliCharset
+		case "boundary-style":
+			session.BoundaryStyle = umailData.BoundaryStyle(*cliBoundaryStyle)
+		case "html-layout":
+			session.HtmlLayout = *cliHtmlLayout
+		case "inline-css":
+			session.InlineCss = *cliInlineCss
+		case "template":
+			session.Templated = *cliTemplate
+		case "recipient":
+			session.IntendedRecipient = *cliRecipient
+		case "subject":
+			session.Subject = *cliSubject
+		case "note":
+			session.Note = *cliNote
+		}
+	})
+	if marked {
+		// The marker is derived from the key material used by the new session.
+		if session.Lazy {
+			return fmt.Errorf(`the emails of a lazy session cannot be marked (--marker): the key material they use is not known yet`)
+		}
+		if session.Marker, err = umailData.NewMarker(pool, session.PoolPointerPosition); err != nil {
+			return err
+		}
+	}
+	if session.Client, err = umailData.ParseMailClient(string(session.Client)); err != nil {
+		return err
+	}
+	if err = umailData.CheckTextEncoding(session.TextEncoding); err != nil {
+		return err
+	}
+	if err = session.Carriers.CheckTextEncoding(session.TextEncoding); err != nil {
+		return err
+	}
+	if session.Charset, err = sessionCharset(session.Charset); err != nil {
+		return err
+	}
+	if session.BoundaryStyle, err = umailData.ParseBoundaryStyle(string(session.BoundaryStyle)); err != nil {
+		return err
+	}
+	if len(session.HtmlLayout) > 0 {
+		if session.HtmlLayout, err = filepath.Abs(session.HtmlLayout); err != nil {
+			return err
+		}
+		if err = checkHtmlLayout(session.HtmlLayout); err != nil {
+			return err
+		}
+	}
+	setVariables(&session, cliVariables)
+	if err = checkBodyTemplates(&session); err != nil {
+		return err
+	}
+	if len(*cliRecipients) > 0 {
+		for _, recipient := range strings.Split(*cliRecipients, ",") {
+			if err = session.AddRecipient(strings.TrimSpace(recipient)); err != nil {
+				return err
+			}
+		}
+	}
+	if *cliProtect || len(*cliKeyFilePath) > 0 {
+		if secret, err = readSessionSecret(*cliKeyFilePath); err != nil {
+			return err
+		}
+		if err = session.Protect(secret); err != nil {
+			return err
+		}
+	}
+	if err = saveSession(targetName, &session); err != nil {
+		return err
+	}
+	fmt.Printf("The session \"%s\" has been created (key \"%s\" at %d, %d boundaries).\n", targetName, *cliKeyName, session.PoolPointerPosition, len(session.Boundaries))
 	return nil
 }
 
-func retrieveEmailMessages(imapClient *imapclient.Client, seqSet imap.SeqSet) ([]*imapclient.FetchMessageBuffer, error) {
+func processArchiveSession() error {
 	var err error
-	var fetchOptions *imap.FetchOptions
-	var messages []*imapclient.FetchMessageBuffer
+	var archive *umailData.Archive
 
-	fetchOptions = &imap.FetchOptions{
-		Flags:    true,
-		Envelope: true,
-		UID:      true,
-		BodySection: []*imap.FetchItemBodySection{
-			{Specifier: imap.PartSpecifierHeader},
-			{Specifier: imap.PartSpecifierText},
-			{Specifier: imap.PartSpecifierNone},
-		},
+	if len(os.Args) < 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of at least 1)`, len(os.Args)-1)
 	}
-	if messages, err = imapClient.Fetch(seqSet, fetchOptions).Collect(); nil != err {
-		return nil, err
+	if archive, err = umailData.NewArchive(filepath.Join(appDir, archiveSubDir)); err != nil {
+		return err
 	}
-	return messages, nil
+	for _, sessionName := range os.Args[1:] {
+		if err = archiveSession(archive, sessionName); err != nil {
+			return err
+		}
+		fmt.Printf("%s: archived (%s)\n", sessionName, archive.Path(sessionName))
+	}
+	return nil
 }
 
-// parseMessage Parse a given message and return a data structure that represents the message: header and body.
-func parseMessage(message *imapclient.FetchMessageBuffer) (*mail.Message, error) {
+// archiveSession Moves a session into the archive.
+func archiveSession(archive *umailData.Archive, sessionName string) error {
 	var err error
-	var email = Email{Body: "", Header: ""}
-	var m *mail.Message
-	var r io.Reader
-	var emailText string
+	var lock *umailData.SessionLock
 
-	for data, buf := range message.BodySection {
-		if "HEADER" == data.Specifier {
-			email.Header = string(buf)
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = umailData.ArchiveSession(sessionStore, archive, sessionName); err != nil {
+		return fmt.Errorf(`cannot archive the session (%s): %s`, sessionName, err.Error())
+	}
+	return nil
+}
+
+// sessionFilter The criteria used to select sessions (by `list-sessions` and `purge-sessions`).
+type sessionFilter struct {
+	completed bool
+	pending   bool
+	olderThan time.Duration
+}
+
+// match Tells whether a session matches the criteria. Protected sessions (which are not decrypted) only match if no
+// criteria is given.
+func (f *sessionFilter) match(session *umailData.Session) bool {
+	var age time.Duration
+	var dated bool
+
+	if session == nil {
+		return !f.completed && !f.pending && f.olderThan == 0
+	}
+	if f.completed && !session.IsProcessed() {
+		return false
+	}
+	if f.pending && session.IsProcessed() {
+		return false
+	}
+	if f.olderThan > 0 {
+		if age, dated = sessionAge(session); !dated || age < f.olderThan {
+			return false
+		}
+	}
+	return true
+}
+
+// peekSession Loads a session from its serialized representation, without decrypting it: nil is returned if the session
+// is protected.
+func peekSession(sessionName string, content []byte) (*umailData.Session, error) {
+	var session umailData.Session
+
+	if umailData.IsProtectedContent(content) {
+		return nil, nil
+	}
+	if err := session.Deserialize(sessionName, content); err != nil {
+		return nil, fmt.Errorf(`cannot load the session (%s): %s`, sessionName, err.Error())
+	}
+	return &session, nil
+}
+
+// sessionAge Returns the time elapsed since the last update of a session (or since its creation). The age is unknown
+// for the sessions created by the versions that did not record dates.
+func sessionAge(session *umailData.Session) (time.Duration, bool) {
+	switch {
+	case !session.Updated.IsZero():
+		return time.Since(session.Updated), true
+	case !session.Created.IsZero():
+		return time.Since(session.Created), true
+	}
+	return 0, false
+}
+
+// sessionStatus Returns the status of a session, for the user.
+func sessionStatus(session *umailData.Session) string {
+	var sent int
+
+	if session == nil {
+		return "protected"
+	}
+	if session.IsProcessed() {
+		return "completed"
+	}
+	sent = session.Deliveries.Count(umailData.DeliverySent) + session.Deliveries.Count(umailData.DeliveryConfirmed)
+	for _, recipient := range session.Recipients {
+		sent += recipient.Deliveries.Count(umailData.DeliverySent) + recipient.Deliveries.Count(umailData.DeliveryConfirmed)
+	}
+	if sent > 0 {
+		return "in progress"
+	}
+	return "new"
+}
+
+// parseAge Parses an age given in the command line: a number of days ("30d"), or a Go duration ("12h").
+func parseAge(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		var days int
+		var err error
+		if days, err = strconv.Atoi(strings.TrimSuffix(value, "d")); err != nil || days < 0 {
+			return 0, fmt.Errorf(`invalid age "%s"`, value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return age, nil
+	}
+	return 0, fmt.Errorf(`invalid age "%s" (expected a number of days, such as "30d", or a duration, such as "12h")`, value)
+}
+
+func processListSessions() error {
+	var err error
+	var filter sessionFilter
+	var cliOlderThan string
+	var cliArchived bool
+	var archive *umailData.Archive
+	var sessionNames []string
+	var read func(name string) ([]byte, error)
+
+	flag.BoolVar(&filter.completed, "completed", false, "only list the sessions that have been entirely sent")
+	flag.BoolVar(&filter.pending, "pending", false, "only list the sessions that have not been entirely sent")
+	flag.StringVar(&cliOlderThan, "older-than", "", `only list the sessions not updated since a given age (for example: "30d")`)
+	flag.BoolVar(&cliArchived, "archived", false, "list the archived sessions")
+	flag.Parse()
+	if len(flag.Args()) != 0 {
+		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
+	}
+	if len(cliOlderThan) > 0 {
+		if filter.olderThan, err = parseAge(cliOlderThan); err != nil {
+			return err
+		}
+	}
+
+	if cliArchived {
+		if archive, err = umailData.NewArchive(filepath.Join(appDir, archiveSubDir)); err != nil {
+			return err
+		}
+		sessionNames, err = archive.List()
+		read = archive.Get
+	} else {
+		sessionNames, err = sessionStore.ListSessions()
+		read = sessionStore.ReadSession
+	}
+	if err != nil {
+		return fmt.Errorf(`cannot list the sessions: %s`, err.Error())
+	}
+
+	for _, sessionName := range sessionNames {
+		var content []byte
+		var session *umailData.Session
+		var updated string
+
+		if content, err = read(sessionName); err != nil {
+			return fmt.Errorf(`cannot load the session (%s): %s`, sessionName, err.Error())
+		}
+		if session, err = peekSession(sessionName, content); err != nil {
+			return err
+		}
+		if !filter.match(session) {
+			continue
+		}
+		if session != nil {
+			updated = formatDate(session.Updated)
+		}
+		fmt.Println(strings.TrimSpace(fmt.Sprintf("%-30s %-12s %s", sessionName, sessionStatus(session), updated)))
+	}
+	return nil
+}
+
+func processPurgeSessions() error {
+	var err error
+	var filter sessionFilter
+	var cliOlderThan string
+	var cliArchive bool
+	var cliDryRun bool
+	var archive *umailData.Archive
+	var sessionNames []string
+	var count int
+
+	flag.BoolVar(&filter.completed, "completed", false, "only remove the sessions that have been entirely sent")
+	flag.StringVar(&cliOlderThan, "older-than", "", `only remove the sessions not updated since a given age (for example: "30d")`)
+	flag.BoolVar(&cliArchive, "archive", false, "archive the sessions instead of removing them")
+	flag.BoolVar(&cliDryRun, "dry-run", false, "only print the sessions that would be removed")
+	flag.Parse()
+	if len(flag.Args()) != 0 {
+		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
+	}
+	if len(cliOlderThan) > 0 {
+		if filter.olderThan, err = parseAge(cliOlderThan); err != nil {
+			return err
+		}
+	}
+	if !filter.completed && filter.olderThan == 0 {
+		return fmt.Errorf(`at least one criteria must be given (--completed or --older-than)`)
+	}
+	if cliArchive {
+		if archive, err = umailData.NewArchive(filepath.Join(appDir, archiveSubDir)); err != nil {
+			return err
+		}
+	}
+	if sessionNames, err = sessionStore.ListSessions(); err != nil {
+		return fmt.Errorf(`cannot list the sessions: %s`, err.Error())
+	}
+
+	for _, sessionName := range sessionNames {
+		var content []byte
+		var session *umailData.Session
+
+		if content, err = sessionStore.ReadSession(sessionName); err != nil {
+			return fmt.Errorf(`cannot load the session (%s): %s`, sessionName, err.Error())
+		}
+		if session, err = peekSession(sessionName, content); err != nil {
+			return err
+		}
+		if session == nil {
+			fmt.Printf("%s: skipped (protected)\n", sessionName)
+			continue
+		}
+		if !filter.match(session) {
+			continue
+		}
+		count++
+		switch {
+		case cliDryRun:
+			fmt.Printf("%s: would be removed\n", sessionName)
+		case cliArchive:
+			if err = archiveSession(archive, sessionName); err != nil {
+				return err
+			}
+			fmt.Printf("%s: archived\n", sessionName)
+		default:
+			if err = removeSession(sessionName); err != nil {
+				return err
+			}
+			fmt.Printf("%s: removed\n", sessionName)
+		}
+	}
+	fmt.Printf("Number of sessions: %d\n", count)
+	return nil
+}
+
+// removeSession Removes a session from the store.
+func removeSession(sessionName string) error {
+	var err error
+	var lock *umailData.SessionLock
+
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = sessionStore.DeleteSession(sessionName); err != nil {
+		return fmt.Errorf(`cannot remove the session (%s): %s`, sessionName, err.Error())
+	}
+	return nil
+}
+
+func processAddBody() error {
+	var err error
+
+	if len(os.Args) < 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of at least 1)`, len(os.Args)-1)
+	}
+	if err = os.MkdirAll(bodyDir, 0755); err != nil {
+		return fmt.Errorf(`cannot create the directory used to store bodies "%s": %s`, bodyDir, err.Error())
+	}
+	for _, path := range os.Args[1:] {
+		var content []byte
+		var target = filepath.Join(bodyDir, filepath.Base(path))
+
+		if _, err = os.Stat(target); err == nil {
+			return fmt.Errorf(`the body "%s" already exists (%s)`, filepath.Base(path), target)
+		}
+		if content, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf(`cannot load the email body from file "%s": %s`, path, err.Error())
+		}
+		if err = os.WriteFile(target, content, 0644); err != nil {
+			return fmt.Errorf(`cannot add the body "%s": %s`, target, err.Error())
+		}
+		fmt.Printf("%s: added (%s)\n", path, target)
+	}
+	return nil
+}
+
+func processListBodies() error {
+	var err error
+	var entries []os.DirEntry
+
+	if len(os.Args) != 1 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 0)`, len(os.Args)-1)
+	}
+	if entries, err = os.ReadDir(bodyDir); err != nil {
+		if os.IsNotExist(err) {
+			fmt.Printf("No body (add bodies using \"add-body\").\n")
+			return nil
+		}
+		return fmt.Errorf(`cannot list the bodies in "%s": %s`, bodyDir, err.Error())
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			fmt.Printf("%s\n", entry.Name())
+		}
+	}
+	return nil
+}
+
+// processGenerateBody Prints bodies generated from a corpus, so that the corpus can be checked before it is given to
+// a session (see "create-session --corpus").
+func processGenerateBody() error {
+	var err error
+	var corpus *umailData.Corpus
+	var count int
+
+	// Parse the command line: generate-body [--count=<count>] <path to the corpus>
+	flag.IntVar(&count, "count", 1, "number of bodies to generate")
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
+	}
+	if count <= 0 {
+		return fmt.Errorf(`invalid number of bodies (%d)`, count)
+	}
+	if corpus, err = loadCorpus(flag.Arg(0)); err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			fmt.Printf("----\n")
+		}
+		fmt.Print(corpus.Generate(randomIndex))
+	}
+	return nil
+}
+
+// processBodyCapacity Prints the number of bytes hidden by the whitespaces at the end of the lines of bodies (see
+// "create-session --carriers=whitespace"), so that the bodies can be checked before they are given to a session.
+func processBodyCapacity() error {
+	var err error
+
+	// Parse the command line: body-capacity <path to a body>...
+	flag.Parse()
+	if len(flag.Args()) == 0 {
+		return fmt.Errorf("invalid command line: no body given")
+	}
+	for _, path := range flag.Args() {
+		var body []byte
+		if body, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf(`cannot load the body from file "%s": %s`, path, err.Error())
+		}
+		fmt.Printf("%s: %d lines, %d bytes hidden per email (%s)\n", path, bytes.Count(body, []byte("\n")), umailData.WhitespaceCapacity(body), umailData.CarrierWhitespace)
+	}
+	return nil
+}
+
+// processImageCapacity Prints the number of bytes hidden by the pixels of cover images (see "create-session
+// --carriers=image"), so that the images can be checked before they are given to a session.
+func processImageCapacity() error {
+	var err error
+
+	// Parse the command line: image-capacity <path to an image>...
+	flag.Parse()
+	if len(flag.Args()) == 0 {
+		return fmt.Errorf("invalid command line: no image given")
+	}
+	for _, path := range flag.Args() {
+		var content []byte
+		var format string
+		var capacity int
+		if content, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf(`cannot load the image from file "%s": %s`, path, err.Error())
+		}
+		if format, capacity, err = umailData.ImageCapacity(content); err != nil {
+			return fmt.Errorf(`invalid image "%s": %s`, path, err.Error())
+		}
+		fmt.Printf("%s: %s, %d bytes hidden per email (%s)\n", path, strings.ToUpper(format), capacity, umailData.CarrierImage)
+	}
+	return nil
+}
+
+func processInfo() error {
+	fmt.Printf("Application directory: \"%s\"\n", appDir)
+	fmt.Printf("Session directory: \"%s\"\n", sessionDir)
+	fmt.Printf("Key directory: \"%s\"\n", keyDir)
+	fmt.Printf("Body directory: \"%s\"\n", bodyDir)
+	if db, ok := sessionStore.(*umailData.BoltStore); ok {
+		fmt.Printf("Store: database \"%s\"\n", db.Path)
+	} else {
+		fmt.Printf("Store: files\n")
+	}
+	return nil
+}
+
+// initStore Opens the store used to keep the sessions and the metadata of the keys. The store is selected by the
+// environment variable `storeEnv`: "file" (default) or "bolt" (embedded database).
+// The database falls back to the files: the sessions created before the database are still available.
+func initStore() error {
+	var err error
+	var files = umailData.NewFileStore(sessionDir, filepath.Join(appDir, keyInfoFileName))
+
+	switch os.Getenv(storeEnv) {
+	case "", "file":
+		sessionStore = files
+	case "bolt":
+		if sessionStore, err = umailData.BoltOpen(filepath.Join(appDir, databaseFileName), files); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf(`invalid store "%s" (environment variable %s): expected "file" or "bolt"`, os.Getenv(storeEnv), storeEnv)
+	}
+	return nil
+}
+
+// recordKeyInfo Records the metadata of a new key.
+func recordKeyInfo(keyName string, origin string) error {
+	var info = umailData.KeyInfo{Name: keyName, Created: time.Now().UTC().Truncate(time.Second), Origin: origin}
+
+	if err := sessionStore.WriteKeyInfo(&info); err != nil {
+		return fmt.Errorf(`cannot record the metadata of the key "%s": %s`, keyName, err.Error())
+	}
+	return nil
+}
+
+func processImportSessions() error {
+	var err error
+	var db *umailData.BoltStore
+	var imported []string
+	var ok bool
+
+	if len(os.Args) != 1 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 0)`, len(os.Args)-1)
+	}
+	if db, ok = sessionStore.(*umailData.BoltStore); !ok {
+		return fmt.Errorf(`the sessions can only be imported into the database (set %s=bolt)`, storeEnv)
+	}
+	if imported, err = db.Import(umailData.NewFileStore(sessionDir, filepath.Join(appDir, keyInfoFileName))); err != nil {
+		return fmt.Errorf(`cannot import the sessions: %s`, err.Error())
+	}
+	for _, name := range imported {
+		fmt.Printf("%s: imported\n", name)
+	}
+	fmt.Printf("Number of sessions imported: %d\n", len(imported))
+	return nil
+}
+
+func initEnv() error {
+	var err error
+	var homeDir string
+	var info os.FileInfo
+
+	if homeDir, err = os.UserHomeDir(); err != nil {
+		log.Fatal(err)
+	}
+	appDir = filepath.Join(homeDir, defaultAppDataBaseName)
+	sessionDir = filepath.Join(appDir, sessionSubDir)
+	keyDir = filepath.Join(appDir, keySubDir)
+	bodyDir = filepath.Join(appDir, bodySubDir)
+
+	if info, err = os.Stat(appDir); err != nil {
+		if os.IsNotExist(err) {
+			// The entry does not exist. We create it.
+			if err = os.MkdirAll(sessionDir, 0644); err != nil {
+				return fmt.Errorf(`cannot create the directory used to store sessions "%s": %s`, sessionDir, err)
+			}
+			if err = os.MkdirAll(keyDir, 0644); err != nil {
+				return fmt.Errorf(`cannot create the directory used to store keys "%s": %s`, keyDir, err)
+			}
+			return nil
+		}
+		return fmt.Errorf(`unexpected error while checking for the existence of the application directory "%s": %s`, appDir, err.Error())
+	}
+
+	// The entry exists. Make sure that it is a directory.
+	if !info.IsDir() {
+		return fmt.Errorf(`unexpected error while checking for the existence of the application directory. The entry "%s" exists but is not a directory`, appDir)
+	}
+
+	// At this point, we consider that the directory is well-structured.
+	return nil
+}
+
+// loadSession Loads a session from the store.
+func loadSession(sessionName string, session *umailData.Session) error {
+	if err := umailData.LoadSession(sessionStore, sessionName, session); err != nil {
+		return fmt.Errorf(`cannot load the session (%s): %s`, sessionName, err.Error())
+	}
+	return nil
+}
+
+// saveSession Saves a session into the store.
+func saveSession(sessionName string, session *umailData.Session) error {
+	if err := umailData.SaveSession(sessionStore, sessionName, session); err != nil {
+		return fmt.Errorf(`cannot save the session (%s): %s`, sessionName, err.Error())
+	}
+	return nil
+}
+
+// lockSession Locks a session, so that it cannot be used by another process. The lock must be released once the session
+// has been saved.
+func lockSession(sessionName string) (*umailData.SessionLock, error) {
+	var err error
+	var lock *umailData.SessionLock
+
+	if lock, err = umailData.LockSession(sessionDir, sessionName); err != nil {
+		return nil, fmt.Errorf(`cannot lock the session (%s): %s`, sessionName, err.Error())
+	}
+	return lock, nil
+}
+
+// sessionLocation Returns the location of a session, for the user.
+func sessionLocation(sessionName string) string {
+	if db, ok := sessionStore.(*umailData.BoltStore); ok {
+		return fmt.Sprintf("database %s", db.Path)
+	}
+	return filepath.Join(sessionDir, sessionName)
+}
+
+func buildMessage(headers umailData.Headers, body string) string {
+	return headers.String() + "\r\n" + body
+}
+
+// createHtmlBody Returns the HTML part of an email, given its body (plain text). The layout is the one given by the
+// style (or the default layout). The attributes of the elements hide the payload, if any (see
+// `umailData.HideInHtml`).
+func createHtmlBody(body []byte, style emailStyle, payload []byte) ([]byte, error) {
+	var err error
+	var layout = []byte(umailData.DefaultHtmlLayout)
+	var html []byte
+
+	if len(style.htmlLayout) > 0 {
+		if layout, err = os.ReadFile(style.htmlLayout); err != nil {
+			return nil, fmt.Errorf(`cannot load the HTML layout from file "%s": %s`, style.htmlLayout, err.Error())
+		}
+	}
+	if html, err = umailData.BuildHtml(string(layout), body, style.inlineCss); err != nil {
+		return nil, fmt.Errorf(`cannot generate the HTML part of the email: %s`, err.Error())
+	}
+	if html, err = umailData.HideInHtml(html, payload); err != nil {
+		return nil, fmt.Errorf(`cannot generate the HTML part of the email: %s`, err.Error())
+	}
+	return html, nil
+}
+
+func processSend() error {
+	var err error
+	var keyName string
+	var sessionName string
+	var to string
+	var from string
+	var password string
+	var subject string
+	var bodyPath string
+	var bodies *coverBodies
+	var smtpServerAddress string
+	var smtpServerPort int
+	var retries int
+	var delay time.Duration
+	var timeouts umailData.Timeouts
+	var sender *mailer
+	var args []string
+	var account *umailData.Account
+	var pin string
+	var proxy string
+	var sent string
+	var insecure bool
+	var oauth bool
+	var transport string
+	var session umailData.Session
+	var recipients []*umailData.Recipient
+	var sync bool
+	var preamble []byte
+	var syncPosition int64
+	var syncPoint umailData.SyncPoint
+	var lock *umailData.SessionLock
+	var key resource.KeySource
+	var out umailData.EmlOutput
+	var queued bool
+	var queue *umailData.Queue
+	var send emailSender
+	var copies umailData.Copies
+	var due bool
+
+	// Parse the command line.
+	flag.StringVar(&smtpServerAddress, "smtp", DefaultSmtpServerAddress, fmt.Sprintf("address of the SMTP server (default: %s)", DefaultSmtpServerAddress))
+	flag.IntVar(&smtpServerPort, "port", DefaultSmtpPort, fmt.Sprintf("SMTP server port number (default: %d)", DefaultSmtpPort))
+	flag.StringVar(&pin, "pin", "", "SHA-256 of the public key of the SMTP server (hexadecimal): the certificate of the server is not verified, but its public key must match")
+	flag.StringVar(&proxy, "proxy", "", `URL of a SOCKS5 proxy the connection to the SMTP server goes through ("socks5://[user:password@]host:port", default: the proxy of the account)`)
+	flag.StringVar(&sent, "sent", "", `IMAP mailbox the emails sent are appended to ("[user@]server[:port]/mailbox", default: the mailbox of the account)`)
+	flag.BoolVar(&insecure, "insecure", false, "do not verify the certificate of the SMTP server (not recommended)")
+	flag.StringVar(&password, "password", "", "sender password used for authentication")
+	flag.BoolVar(&oauth, "oauth", false, "authenticate using the OAuth2 token of the sender (see \"oauth-login\") instead of a password")
+	flag.StringVar(&transport, "transport", umailData.TransportSmtp, fmt.Sprintf(`how the emails are sent: "%s", "%s" (Gmail API) or "%s" (Microsoft Graph API), using the OAuth2 token of the sender for the APIs`, umailData.TransportSmtp, umailData.TransportGmail, umailData.TransportGraph))
+	flag.StringVar(&bodyPath, "body", DefaultBodyFile, fmt.Sprintf("path to the file that contains the email's body (default: %s)", DefaultBodyFile))
+	flag.StringVar(&keyName, "key", defaultKeyName, fmt.Sprintf("name of the key (default: %s)", defaultKeyName))
+	flag.BoolVar(&sync, "sync", false, "send a synchronization preamble (checked by \"rcv --sync-check\") instead of the next email of the session")
+	flag.IntVar(&retries, "retries", 3, "maximum number of attempts for each email (only the transient errors are retried)")
+	flag.DurationVar(&delay, "delay", 5*time.Second, "delay before the second attempt (doubled after each attempt, plus a random jitter)")
+	flag.DurationVar(&timeouts.Dial, "dial-timeout", umailData.DefaultTimeouts.Dial, "maximum time to connect to the SMTP server (0: no timeout)")
+	flag.DurationVar(&timeouts.Command, "command-timeout", umailData.DefaultTimeouts.Command, "maximum time the SMTP server may take to reply to a command (0: no timeout)")
+	flag.DurationVar(&timeouts.Data, "data-timeout", umailData.DefaultTimeouts.Data, "maximum time the SMTP server may take to receive an email (0: no timeout)")
+	flag.StringVar(&out.Path, "out", "", "write the email into a file (RFC 5322, \".eml\") instead of sending it")
+	flag.BoolVar(&out.Advance, "advance", true, "with \"--out\": mark the email as sent (\"--advance=false\" leaves the deliveries unchanged, the key material of a lazy session is consumed though)")
+	flag.BoolVar(&queued, "queue", false, "render the email and add it to the queue: it will be sent by the daemon (see \"daemon\")")
+	flag.StringVar(&copies.Cc, "cc", "", `comma separated list of the recipients of copies of the emails ("Cc" header)`)
+	flag.StringVar(&copies.Bcc, "bcc", "", "comma separated list of the recipients of hidden copies of the emails (not visible to the other recipients)")
+	flag.BoolVar(&due, "due", false, `only send the emails whose due date has passed (see "schedule-session"); nothing is sent if no email is due`)
+	flag.Parse()
+
+	if len(flag.Args()) < 1 || len(flag.Args()) > 4 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1, 2, 3 or 4)`, len(flag.Args()))
+	}
+	if retries < 1 || delay < 0 {
+		return fmt.Errorf(`invalid parameters (retries: %d, delay: %s)`, retries, delay)
+	}
+	if err = timeouts.Validate(); err != nil {
+		return err
+	}
+	sessionName = flag.Arg(0)
+	if err = out.Validate(); err != nil {
+		return err
+	}
+	if queued && (len(out.Path) > 0 || sync) {
+		return fmt.Errorf(`the option "--queue" cannot be used with "--out" or "--sync"`)
+	}
+	if due && sync {
+		return fmt.Errorf(`the option "--due" cannot be used with "--sync"`)
+	}
+	if _, err = copies.Recipients(); err != nil {
+		return err
+	}
+
+	// Load all data.
+	bodies = newCoverBodies(bodyPath)
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	if key, err = openSessionKey(&session); err != nil {
+		return err
+	}
+	if key != nil {
+		defer key.Close()
+	}
+
+	if account, args, err = sendingAccount(&session, sessionName, smtpServerAddress, smtpServerPort, pin, transport, proxy, sent, flag.Args()[1:]); err != nil {
+		return err
+	}
+	if err = checkTransport(account, password); err != nil {
+		return err
+	}
+	from = account.From
+	to, subject = sendTarget(&session, args)
+	if len(subject) == 0 {
+		return fmt.Errorf(`the session "%s" has no default subject: the subject must be given`, sessionName)
+	}
+	subject = mime.QEncoding.Encode("utf-8", subject)
+	if recipients, err = sessionRecipients(&session, sessionName, to); err != nil {
+		return err
+	}
+
+	// Make sure that the session has not already been processed.
+	if !sync {
+		var pending []*umailData.Recipient
+		for _, recipient := range recipients {
+			if recipient.Deliveries.Next() >= 0 {
+				pending = append(pending, recipient)
+			}
+		}
+		if len(pending) == 0 {
+			return fmt.Errorf(`the session "%s" has already been processed`, sessionName)
+		}
+		recipients = pending
+	}
+
+	// Only the recipients whose next email is due receive it. Nothing being due is not an error, so that the command
+	// can be run periodically.
+	if due {
+		var now = time.Now()
+		var dueRecipients []*umailData.Recipient
+		if session.Schedule == nil {
+			return fmt.Errorf(`the session "%s" has no schedule (see "schedule-session")`, sessionName)
+		}
+		for _, recipient := range recipients {
+			var index = recipient.Deliveries.Next()
+			if session.Schedule.IsDue(index, now) {
+				dueRecipients = append(dueRecipients, recipient)
+				continue
+			}
+			fmt.Printf("%s: email %d is due on %s.\n", recipient.Address, index, formatDate(session.Schedule.Due[index]))
+		}
+		if len(dueRecipients) == 0 {
+			return nil
+		}
+		recipients = dueRecipients
+	}
+
+	// The synchronization preamble tells the receiver the position of the key material used by the session.
+	// For a lazy session, the position is the one of the key material that will be used by the next email. The
+	// fingerprint of the preamble consumes key material dedicated to it.
+	if sync {
+		var pool = key
+		var poolPath = filepath.Join(keyDir, session.PoolName)
+		if pool == nil {
+			if pool, err = resource.Open(poolPath); err != nil {
+				return fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
+			}
+			defer pool.Close()
+		}
+		if session.Lazy {
+			syncPosition = pool.Position()
+		} else {
+			syncPosition = session.PoolPointerPosition
+		}
+		if preamble, syncPoint, err = umailData.SyncPreamble(pool, syncPosition); err != nil {
+			return fmt.Errorf(`cannot create the synchronization preamble: %s`, err.Error())
+		}
+	}
+
+	// Open connexion to the SMTP server (unless the email is written into a file).
+	if len(out.Path) > 0 {
+		if err = out.CheckRecipients(sessionName, len(recipients)); err != nil {
+			return err
+		}
+		send = emlSender(out.Path)
+	} else if queued {
+		if queue, err = umailData.NewQueue(filepath.Join(appDir, queueSubDir)); err != nil {
+			return err
+		}
+	} else {
+		sender = &mailer{account: account, password: password, oauth: oauth, insecure: insecure, timeouts: timeouts, retries: retries, delay: delay}
+		if err = sender.open(); err != nil {
+			return err
+		}
+		send = sender.Send
+	}
+
+	// Send the emails: each recipient receives its next email (the first one that is pending, or that failed). The
+	// session is saved after each email, so that the progress of the other recipients is kept if an email cannot be
+	// sent.
+	for _, recipient := range recipients {
+		var sent int
+
+		if sync {
+			var body []byte
+			var style = sessionStyle(&session, nil, 0)
+			if _, body, err = bodies.get(&session, recipient.Address, 0); err != nil {
+				return err
+			}
+			// The preamble is a single boundary, whatever the nesting of the emails of the session.
+			style.nested = false
+			style.carriers = nil
+			style.copies = copies
+			if _, err = send(from, recipient.Address, subject, preamble, body, style); err != nil {
+				return err
+			}
+			fmt.Printf("%s: the synchronization preamble has been sent (expected position: %d, message at %d).\n", recipient.Address, syncPoint.Start(), syncPoint.Position)
+			continue
+		}
+		if !out.Advance {
+			var index = recipient.Deliveries.Next()
+			var body []byte
+			var boundary []byte
+			var style = sessionStyle(&session, recipient.Deliveries, index)
+
+			if _, body, err = bodies.get(&session, recipient.Address, index); err != nil {
+				return err
+			}
+			// The key material of a lazy session is consumed: the email leaves the process.
+			if boundary, err = session.AllocateBoundary(index, key); err != nil {
+				_ = saveSession(sessionName, &session)
+				return err
+			}
+			if session.Lazy {
+				if err = saveSession(sessionName, &session); err != nil {
+					return err
+				}
+			}
+			style.copies = copies
+			if _, err = send(from, recipient.Address, subject, boundary, body, style); err != nil {
+				return err
+			}
+			fmt.Printf("%s: email %d has not been marked as sent.\n", recipient.Address, index)
+			continue
+		}
+		if queued {
+			var index int
+			var entry = umailData.QueuedEmail{Session: sessionName, Copies: copies, Account: *account, OAuth: oauth, Insecure: insecure}
+
+			if index, err = queueNextEmail(queue, &entry, subject, bodies, sessionName, &session, lock, key, recipient); err != nil {
+				return err
+			}
+			fmt.Printf("%s: email %d has been queued.\n", recipient.Address, index)
+			continue
+		}
+		if _, err = sendNextEmail(send, from, subject, bodies, sessionName, &session, key, recipient, copies, 0); err != nil {
+			return err
+		}
+		sent = recipient.Deliveries.Count(umailData.DeliverySent) + recipient.Deliveries.Count(umailData.DeliveryConfirmed)
+		if len(session.Recipients) == 0 {
+			fmt.Printf("Number of emails sent: %d (over %d)\n", sent, len(session.Boundaries))
+		} else {
+			fmt.Printf("%s: number of emails sent: %d (over %d)\n", recipient.Address, sent, len(session.Boundaries))
+		}
+	}
+	if sender != nil {
+		if err = sender.quit(); err != nil {
+			return err
+		}
+	}
+	if len(out.Path) > 0 {
+		fmt.Printf("The email has been written into \"%s\".\n", out.Path)
+	}
+	if queued {
+		fmt.Printf("The emails will be sent by the daemon (see \"daemon\").\n")
+	}
+
+	if !sync && session.IsProcessed() {
+		fmt.Printf("The session has been entirely processes.\n")
+	}
+
+	return nil
+}
+
+// sendNextEmail Sends the next email of a session (the first one that is pending, or that failed) to a recipient (and
+// to the recipients of the copies, if any), and saves the session. The copies and the time waited before sending the
+// email (`gap`) are recorded into the journal. It returns the index of the email sent.
+// For a lazy session, the key material is consumed before the email is sent, even if it cannot be sent (`key` is nil if
+// the session is not lazy).
+func sendNextEmail(send emailSender, from string, subject string, bodies *coverBodies, sessionName string, session *umailData.Session, key resource.KeySource, recipient *umailData.Recipient, copies umailData.Copies, gap time.Duration) (int, error) {
+	var err error
+	var messageId string
+	var bodyFile string
+	var body []byte
+	var boundary []byte
+	var index = recipient.Deliveries.Next()
+	var style = sessionStyle(session, recipient.Deliveries, index)
+
+	if bodyFile, body, err = bodies.get(session, recipient.Address, index); err != nil {
+		return index, err
+	}
+	if boundary, err = session.AllocateBoundary(index, key); err != nil {
+		_ = saveSession(sessionName, session)
+		return index, err
+	}
+	if session.Lazy {
+		if err = saveSession(sessionName, session); err != nil {
+			return index, err
+		}
+	}
+	style.copies = copies
+	if messageId, err = send(from, recipient.Address, subject, boundary, body, style); err != nil {
+		_ = recipient.Deliveries.SetFailed(index, err)
+		_ = saveSession(sessionName, session)
+		return index, err
+	}
+	if err = recipient.Deliveries.SetSent(index, messageId); err != nil {
+		return index, err
+	}
+	session.RecordSend(recipient.Address, copies, index, messageId, bodyFile, gap)
+	return index, saveSession(sessionName, session)
+}
+
+// queueNextEmail Renders the next email of a session (the first one that is pending, or that failed) for a recipient,
+// adds it to the queue and saves the session. It returns the index of the email queued. The entry gives the session,
+// the account used to send the email and the recipients of its copies (if any).
+// For a lazy session, the key material is consumed once the email has been queued (`key` is nil if the session is not
+// lazy).
+// The session must be locked (`lock`, see `lockSession`): the lock is checked before the email is queued.
+func queueNextEmail(queue *umailData.Queue, entry *umailData.QueuedEmail, subject string, bodies *coverBodies, sessionName string, session *umailData.Session, lock *umailData.SessionLock, key resource.KeySource, recipient *umailData.Recipient) (int, error) {
+	var err error
+	var body []byte
+	var boundary []byte
+	var index = recipient.Deliveries.Next()
+	var style = sessionStyle(session, recipient.Deliveries, index)
+
+	if err = lock.Held(); err != nil {
+		return index, fmt.Errorf(`cannot queue the email of the session (%s): %s`, sessionName, err.Error())
+	}
+	style.copies = entry.Copies
+	entry.Recipient = recipient.Address
+	entry.Index = index
+	if entry.BodyFile, body, err = bodies.get(session, recipient.Address, index); err != nil {
+		return index, err
+	}
+	if boundary, err = session.PrepareBoundary(index, key); err != nil {
+		return index, err
+	}
+	if entry.Message, entry.MessageID, err = composeEmail(entry.Account.From, recipient.Address, subject, boundary, body, style); err != nil {
+		return index, err
+	}
+	if err = session.CommitBoundary(index, boundary, key); err != nil {
+		_ = saveSession(sessionName, session)
+		return index, err
+	}
+	if err = queue.Add(entry); err != nil {
+		return index, fmt.Errorf(`cannot queue the email: %s`, err.Error())
+	}
+	if err = recipient.Deliveries.SetQueued(index, entry.MessageID); err != nil {
+		return index, err
+	}
+	return index, saveSession(sessionName, session)
+}
+
+// openSessionKey Opens the key used by a lazy session (the key material is consumed when the emails are sent). It
+// returns nil if the session is not lazy.
+func openSessionKey(session *umailData.Session) (resource.KeySource, error) {
+	var err error
+	var key resource.KeySource
+	var poolPath = filepath.Join(keyDir, session.PoolName)
+
+	if !session.Lazy {
+		return nil, nil
+	}
+	if key, err = resource.Open(poolPath); err != nil {
+		return nil, fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
+	}
+	return key, nil
+}
+
+// coverBodies Selects the body (the visible content) of each email: the body given in the command line or, if no body
+// is given, the body attached to the session for the email (if any), or a body generated from the corpus of the
+// session (if any).
+type coverBodies struct {
+	path     string
+	given    bool
+	contents map[string][]byte
+	corpora  map[string]*umailData.Corpus
+}
+
+// newCoverBodies Creates the selector of the bodies, given the path to the body given in the command line (or to the
+// default body). It must be called after the command line has been parsed.
+func newCoverBodies(path string) *coverBodies {
+	var bodies = coverBodies{path: path, contents: make(map[string][]byte), corpora: make(map[string]*umailData.Corpus)}
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "body" {
+			bodies.given = true
+		}
+	})
+	return &bodies
+}
+
+// get Returns the path to the file that contains the body of the email that carries the boundary at a given index, and
+// the body. For a generated body, the path is the one of the corpus. If the bodies of the session are templates, then
+// the body is rendered for the recipient.
+func (c *coverBodies) get(session *umailData.Session, recipient string, index int) (string, []byte, error) {
+	var err error
+	var body []byte
+	var ok bool
+	var corpus *umailData.Corpus
+	var path = c.path
+
+	if !c.given && len(session.Bodies) > 0 {
+		path = session.NextBody(index, randomIndex)
+	}
+	if !c.given && len(session.Bodies) == 0 && len(session.Corpus) > 0 {
+		if corpus, ok = c.corpora[session.Corpus]; !ok {
+			if corpus, err = loadCorpus(session.Corpus); err != nil {
+				return "", nil, err
+			}
+			c.corpora[session.Corpus] = corpus
+		}
+		path = session.Corpus
+		body = []byte(corpus.Generate(randomIndex))
+	} else if body, ok = c.contents[path]; !ok {
+		if body, err = os.ReadFile(path); err != nil {
+			return "", nil, fmt.Errorf(`cannot load the email body from file "%s": %s`, path, err.Error())
+		}
+		c.contents[path] = body
+	}
+	if session.Templated {
+		if body, err = umailData.RenderBody(body, session.BodyData(recipient, index, time.Now())); err != nil {
+			return "", nil, fmt.Errorf(`cannot render the email body "%s": %s`, path, err.Error())
+		}
+	}
+	return path, body, nil
+}
+
+// variableFlags The variables of the templates of the bodies, given in the command line ("--var name=value", repeated).
+type variableFlags map[string]string
+
+func (v variableFlags) String() string {
+	return ""
+}
+
+func (v variableFlags) Set(value string) error {
+	var name, text, found = strings.Cut(value, "=")
+
+	if !found {
+		return fmt.Errorf(`invalid variable "%s" (expected "name=value")`, value)
+	}
+	if err := umailData.CheckVariable(name); err != nil {
+		return err
+	}
+	v[name] = text
+	return nil
+}
+
+// setVariables Sets the variables of the templates of the bodies of a session. A variable whose value is empty is
+// removed.
+func setVariables(session *umailData.Session, variables variableFlags) {
+	for name, value := range variables {
+		if len(value) == 0 {
+			delete(session.Variables, name)
+			continue
+		}
+		if session.Variables == nil {
+			session.Variables = make(map[string]string)
+		}
+		session.Variables[name] = value
+	}
+	if len(session.Variables) == 0 {
+		session.Variables = nil
+	}
+}
+
+// checkBodyTemplates Checks the syntax of the templates of the bodies attached to a session (if its bodies are
+// templates).
+func checkBodyTemplates(session *umailData.Session) error {
+	if !session.Templated {
+		return nil
+	}
+	for _, path := range session.Bodies {
+		var err error
+		var body []byte
+		if body, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf(`cannot load the email body from file "%s": %s`, path, err.Error())
+		}
+		if err = umailData.ParseBodyTemplate(body); err != nil {
+			return fmt.Errorf(`invalid template "%s": %s`, path, err.Error())
+		}
+	}
+	return nil
+}
+
+// sessionCharset Returns the character set recorded into a session, given its name (see `umailData.ParseCharset`). The
+// default character set is not recorded.
+func sessionCharset(name string) (string, error) {
+	var err error
+	var charset string
+
+	if charset, err = umailData.ParseCharset(name); err != nil {
+		return "", err
+	}
+	if charset == umailData.DefaultCharset {
+		return "", nil
+	}
+	return charset, nil
+}
+
+// checkHtmlLayout Checks the layout of the HTML part of the emails, given the path to the file that contains it.
+func checkHtmlLayout(path string) error {
+	var err error
+	var layout []byte
+
+	if layout, err = os.ReadFile(path); err != nil {
+		return fmt.Errorf(`cannot load the HTML layout from file "%s": %s`, path, err.Error())
+	}
+	if err = umailData.ParseHtmlLayout(string(layout)); err != nil {
+		return fmt.Errorf(`invalid HTML layout "%s": %s`, path, err.Error())
+	}
+	return nil
+}
+
+// setCoverImage Sets the cover image attached to the emails that hide the message in its pixels (see
+// `umailData.CarrierImage`), given the path to its file, and checks that it can hide the bytes of the carrier. The
+// emails must be nested.
+func setCoverImage(carriers umailData.Carriers, path string, nested bool) error {
+	var err error
+	var cover []byte
+
+	if _, ok := carriers.Get(umailData.CarrierImage); !ok {
+		return nil
+	}
+	if len(path) == 0 {
+		return fmt.Errorf(`the carrier "%s" needs a cover image (--cover-image)`, umailData.CarrierImage)
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return err
+	}
+	carriers.SetCover(path)
+	if err = carriers.CheckNesting(nested); err != nil {
+		return fmt.Errorf(`%s: use --nested`, err.Error())
+	}
+	if cover, err = os.ReadFile(path); err != nil {
+		return fmt.Errorf(`cannot load the cover image from file "%s": %s`, path, err.Error())
+	}
+	return carriers.CheckCover(cover)
+}
+
+// loadCorpus Loads the text from which bodies are generated.
+func loadCorpus(path string) (*umailData.Corpus, error) {
+	var err error
+	var text []byte
+	var corpus *umailData.Corpus
+
+	if text, err = os.ReadFile(path); err != nil {
+		return nil, fmt.Errorf(`cannot load the corpus from file "%s": %s`, path, err.Error())
+	}
+	if corpus, err = umailData.NewCorpus(text); err != nil {
+		return nil, fmt.Errorf(`invalid corpus "%s": %s`, path, err.Error())
+	}
+	return corpus, nil
+}
+
+// sessionBodies Returns the bodies attached to a new session, and how they are assigned to the emails. If the
+// rotation is random and no bodies are given, then the bodies of the managed directory are used.
+func sessionBodies(spec string, rotationName string) ([]string, umailData.BodyRotation, error) {
+	var err error
+	var rotation umailData.BodyRotation
+	var bodies []string
+	var ok bool
+
+	if rotation, ok = umailData.ParseBodyRotation(rotationName); !ok {
+		return nil, "", fmt.Errorf(`invalid rotation "%s": expected "%s" or "%s"`, rotationName, umailData.RotationSequence, umailData.RotationRandom)
+	}
+	if len(spec) == 0 && rotation == umailData.RotationRandom {
+		if _, err = os.Stat(bodyDir); os.IsNotExist(err) {
+			return nil, "", fmt.Errorf(`the directory "%s" does not contain any body (add bodies using "add-body")`, bodyDir)
+		}
+		spec = bodyDir
+	}
+	if len(spec) == 0 {
+		return nil, "", nil
+	}
+	if bodies, err = readBodyFiles(spec); err != nil {
+		return nil, "", err
+	}
+	if rotation == umailData.RotationRandom && len(bodies) < 2 {
+		return nil, "", fmt.Errorf(`the random rotation requires at least 2 bodies (%d given)`, len(bodies))
+	}
+	return bodies, rotation, nil
+}
+
+// randomIndex Returns a random integer in [0, n), using a CSPRNG.
+func randomIndex(n int) int {
+	var value *big.Int
+	var err error
+
+	if value, err = rand.Int(rand.Reader, big.NewInt(int64(n))); err != nil {
+		log.Fatal(err)
+	}
+	return int(value.Int64())
+}
+
+// readBodyFiles Returns the (absolute) paths to the files that contain bodies, given a directory (all the files it
+// contains, sorted by name) or a comma separated list of files.
+func readBodyFiles(spec string) ([]string, error) {
+	var err error
+	var info os.FileInfo
+	var paths []string
+	var result []string
+
+	if info, err = os.Stat(spec); err == nil && info.IsDir() {
+		var entries []os.DirEntry
+		if entries, err = os.ReadDir(spec); err != nil {
+			return nil, fmt.Errorf(`cannot list the bodies in "%s": %s`, spec, err.Error())
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				paths = append(paths, filepath.Join(spec, entry.Name()))
+			}
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf(`the directory "%s" does not contain any body`, spec)
+		}
+	} else {
+		for _, path := range strings.Split(spec, ",") {
+			paths = append(paths, strings.TrimSpace(path))
+		}
+	}
+	for _, path := range paths {
+		if path, err = filepath.Abs(path); err != nil {
+			return nil, err
+		}
+		if _, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf(`cannot load the email body from file "%s": %s`, path, err.Error())
+		}
+		result = append(result, path)
+	}
+	return result, nil
+}
+
+// processSendAll Sends all the emails of a session that have not been sent yet, waiting a given interval between two
+// emails. The progress (and the estimated time of completion) is printed after each email.
+func processSendAll() error {
+	var err error
+	var sessionName string
+	var to string
+	var from string
+	var password string
+	var subject string
+	var bodyPath string
+	var bodies *coverBodies
+	var smtpServerAddress string
+	var smtpServerPort int
+	var retries int
+	var delay time.Duration
+	var timeouts umailData.Timeouts
+	var sender *mailer
+	var args []string
+	var account *umailData.Account
+	var pin string
+	var proxy string
+	var sent string
+	var insecure bool
+	var oauth bool
+	var transport string
+	var session umailData.Session
+	var recipients []*umailData.Recipient
+	var lock *umailData.SessionLock
+	var key resource.KeySource
+	var interval time.Duration
+	var minInterval time.Duration
+	var maxInterval time.Duration
+	var starts []time.Time
+
+	// Parse the command line.
+	flag.StringVar(&smtpServerAddress, "smtp", DefaultSmtpServerAddress, fmt.Sprintf("address of the SMTP server (default: %s)", DefaultSmtpServerAddress))
+	flag.IntVar(&smtpServerPort, "port", DefaultSmtpPort, fmt.Sprintf("SMTP server port number (default: %d)", DefaultSmtpPort))
+	flag.StringVar(&pin, "pin", "", "SHA-256 of the public key of the SMTP server (hexadecimal): the certificate of the server is not verified, but its public key must match")
+	flag.StringVar(&proxy, "proxy", "", `URL of a SOCKS5 proxy the connection to the SMTP server goes through ("socks5://[user:password@]host:port", default: the proxy of the account)`)
+	flag.StringVar(&sent, "sent", "", `IMAP mailbox the emails sent are appended to ("[user@]server[:port]/mailbox", default: the mailbox of the account)`)
+	flag.BoolVar(&insecure, "insecure", false, "do not verify the certificate of the SMTP server (not recommended)")
+	flag.StringVar(&password, "password", "", "sender password used for authentication")
+	flag.BoolVar(&oauth, "oauth", false, "authenticate using the OAuth2 token of the sender (see \"oauth-login\") instead of a password")
+	flag.StringVar(&transport, "transport", umailData.TransportSmtp, fmt.Sprintf(`how the emails are sent: "%s", "%s" (Gmail API) or "%s" (Microsoft Graph API), using the OAuth2 token of the sender for the APIs`, umailData.TransportSmtp, umailData.TransportGmail, umailData.TransportGraph))
+	flag.StringVar(&bodyPath, "body", DefaultBodyFile, fmt.Sprintf("path to the file that contains the email's body (default: %s)", DefaultBodyFile))
+	flag.DurationVar(&interval, "interval", 0, "time to wait between two emails (same as \"--min-interval\" and \"--max-interval\" with the same value)")
+	flag.DurationVar(&minInterval, "min-interval", 0, "minimum time to wait between two emails (the time is random, between the minimum and the maximum)")
+	flag.DurationVar(&maxInterval, "max-interval", 0, "maximum time to wait between two emails (default: the minimum)")
+	flag.IntVar(&retries, "retries", 3, "maximum number of attempts for each email (only the transient errors are retried)")
+	flag.DurationVar(&delay, "delay", 5*time.Second, "delay before the second attempt (doubled after each attempt, plus a random jitter)")
+	flag.DurationVar(&timeouts.Dial, "dial-timeout", umailData.DefaultTimeouts.Dial, "maximum time to connect to the SMTP server (0: no timeout)")
+	flag.DurationVar(&timeouts.Command, "command-timeout", umailData.DefaultTimeouts.Command, "maximum time the SMTP server may take to reply to a command (0: no timeout)")
+	flag.DurationVar(&timeouts.Data, "data-timeout", umailData.DefaultTimeouts.Data, "maximum time the SMTP server may take to receive an email (0: no timeout)")
+	flag.Parse()
+
+	if len(flag.Args()) < 1 || len(flag.Args()) > 4 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1, 2, 3 or 4)`, len(flag.Args()))
+	}
+	if interval != 0 {
+		if minInterval != 0 || maxInterval != 0 {
+			return fmt.Errorf(`the option "--interval" cannot be used with "--min-interval" or "--max-interval"`)
+		}
+		minInterval, maxInterval = interval, interval
+	}
+	if maxInterval == 0 {
+		maxInterval = minInterval
+	}
+	if minInterval < 0 || maxInterval < minInterval {
+		return fmt.Errorf(`invalid interval (%s to %s)`, minInterval, maxInterval)
+	}
+	if retries < 1 || delay < 0 {
+		return fmt.Errorf(`invalid parameters (retries: %d, delay: %s)`, retries, delay)
+	}
+	if err = timeouts.Validate(); err != nil {
+		return err
+	}
+	sessionName = flag.Arg(0)
+
+	// Load all data.
+	bodies = newCoverBodies(bodyPath)
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	if key, err = openSessionKey(&session); err != nil {
+		return err
+	}
+	if key != nil {
+		defer key.Close()
+	}
+	if account, args, err = sendingAccount(&session, sessionName, smtpServerAddress, smtpServerPort, pin, transport, proxy, sent, flag.Args()[1:]); err != nil {
+		return err
+	}
+	if err = checkTransport(account, password); err != nil {
+		return err
+	}
+	from = account.From
+	to, subject = sendTarget(&session, args)
+	if len(subject) == 0 {
+		return fmt.Errorf(`the session "%s" has no default subject: the subject must be given`, sessionName)
+	}
+	subject = mime.QEncoding.Encode("utf-8", subject)
+	if recipients, err = sessionRecipients(&session, sessionName, to); err != nil {
+		return err
+	}
+
+	sender = &mailer{account: account, password: password, oauth: oauth, insecure: insecure, timeouts: timeouts, retries: retries, delay: delay}
+	if err = sender.open(); err != nil {
+		return err
+	}
+
+	// Each round sends the next email to each recipient.
+	for {
+		var pending []*umailData.Recipient
+		for _, recipient := range recipients {
+			if recipient.Deliveries.Next() >= 0 {
+				pending = append(pending, recipient)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		for _, recipient := range pending {
+			var index int
+			var start time.Time
+			var gap time.Duration
+			var done int
+			var total int
+
+			// The time waited between two emails is random, so that the emails do not follow a recognizable pattern.
+			if len(starts) > 0 && maxInterval > 0 {
+				gap = randomDuration(minInterval, maxInterval)
+				time.Sleep(gap)
+			}
+			start = time.Now()
+			if index, err = sendNextEmail(sender.Send, from, subject, bodies, sessionName, &session, key, recipient, umailData.Copies{}, gap); err != nil {
+				return err
+			}
+			starts = append(starts, start)
+			done, total = sendAllProgress(recipients, len(session.Boundaries))
+			fmt.Printf("%s %s: email %d sent in %s%s\n", progressBar(done, total), recipient.Address, index,
+				time.Since(start).Round(time.Millisecond), sendAllEstimate(starts, (minInterval+maxInterval)/2, total-done))
+		}
+	}
+	if len(starts) == 0 {
+		return fmt.Errorf(`the session "%s" has already been processed`, sessionName)
+	}
+	if err = sender.quit(); err != nil {
+		return err
+	}
+	fmt.Printf("Number of emails sent: %d\n", len(starts))
+	if session.IsProcessed() {
+		fmt.Printf("The session has been entirely processes.\n")
+	}
+	return nil
+}
+
+// sendAllProgress Returns the number of emails sent (or confirmed) to a list of recipients, and the total number of
+// emails to send.
+func sendAllProgress(recipients []*umailData.Recipient, count int) (int, int) {
+	var done int
+
+	for _, recipient := range recipients {
+		done += recipient.Deliveries.Count(umailData.DeliverySent) + recipient.Deliveries.Count(umailData.DeliveryConfirmed)
+	}
+	return done, count * len(recipients)
+}
+
+// sendAllEstimate Returns the average interval between two emails, and the estimated time of completion, given the
+// dates of the emails sent so far. Before the second email, the interval is the configured one (the average of the
+// bounds).
+func sendAllEstimate(starts []time.Time, interval time.Duration, remaining int) string {
+	var average = interval
+
+	if remaining == 0 {
+		return ""
+	}
+	if len(starts) >= 2 {
+		average = starts[len(starts)-1].Sub(starts[0]) / time.Duration(len(starts)-1)
+	}
+	return fmt.Sprintf(" (average interval: %s, estimated completion: %s)", average.Round(100*time.Millisecond),
+		formatDate(time.Now().Add(average*time.Duration(remaining))))
+}
+
+// progressBar Returns a representation of a progress, for the user: "[#####-----] 5/10 (50%)".
+func progressBar(done int, total int) string {
+	const width = 20
+	var filled int
+	var percent int
+
+	if total > 0 {
+		filled = done * width / total
+		percent = done * 100 / total
+	}
+	return fmt.Sprintf("[%s%s] %d/%d (%d%%)", strings.Repeat("#", filled), strings.Repeat("-", width-filled), done, total, percent)
+}
+
+// processResumeSession Sends again the emails that could not be sent (marked as failed). The emails that have been
+// sent, and the emails that have not been sent yet, are not sent. Each email is sent up to `--retries` times (see
+// `mailer`).
+func processResumeSession() error {
+	var err error
+	var sessionName string
+	var to string
+	var from string
+	var password string
+	var subject string
+	var bodyPath string
+	var bodies *coverBodies
+	var smtpServerAddress string
+	var smtpServerPort int
+	var sender *mailer
+	var args []string
+	var account *umailData.Account
+	var pin string
+	var proxy string
+	var sent string
+	var insecure bool
+	var oauth bool
+	var transport string
+	var session umailData.Session
+	var recipients []*umailData.Recipient
+	var lock *umailData.SessionLock
+	var key resource.KeySource
+	var retries int
+	var delay time.Duration
+	var timeouts umailData.Timeouts
+	var resent int
+	var failed int
+
+	// Parse the command line.
+	flag.StringVar(&smtpServerAddress, "smtp", DefaultSmtpServerAddress, fmt.Sprintf("address of the SMTP server (default: %s)", DefaultSmtpServerAddress))
+	flag.IntVar(&smtpServerPort, "port", DefaultSmtpPort, fmt.Sprintf("SMTP server port number (default: %d)", DefaultSmtpPort))
+	flag.StringVar(&pin, "pin", "", "SHA-256 of the public key of the SMTP server (hexadecimal): the certificate of the server is not verified, but its public key must match")
+	flag.StringVar(&proxy, "proxy", "", `URL of a SOCKS5 proxy the connection to the SMTP server goes through ("socks5://[user:password@]host:port", default: the proxy of the account)`)
+	flag.StringVar(&sent, "sent", "", `IMAP mailbox the emails sent are appended to ("[user@]server[:port]/mailbox", default: the mailbox of the account)`)
+	flag.BoolVar(&insecure, "insecure", false, "do not verify the certificate of the SMTP server (not recommended)")
+	flag.StringVar(&password, "password", "", "sender password used for authentication")
+	flag.BoolVar(&oauth, "oauth", false, "authenticate using the OAuth2 token of the sender (see \"oauth-login\") instead of a password")
+	flag.StringVar(&transport, "transport", umailData.TransportSmtp, fmt.Sprintf(`how the emails are sent: "%s", "%s" (Gmail API) or "%s" (Microsoft Graph API), using the OAuth2 token of the sender for the APIs`, umailData.TransportSmtp, umailData.TransportGmail, umailData.TransportGraph))
+	flag.StringVar(&bodyPath, "body", DefaultBodyFile, fmt.Sprintf("path to the file that contains the email's body (default: %s)", DefaultBodyFile))
+	flag.IntVar(&retries, "retries", 3, "maximum number of attempts for each email (only the transient errors are retried)")
+	flag.DurationVar(&delay, "delay", 5*time.Second, "delay before the second attempt (doubled after each attempt, plus a random jitter)")
+	flag.DurationVar(&timeouts.Dial, "dial-timeout", umailData.DefaultTimeouts.Dial, "maximum time to connect to the SMTP server (0: no timeout)")
+	flag.DurationVar(&timeouts.Command, "command-timeout", umailData.DefaultTimeouts.Command, "maximum time the SMTP server may take to reply to a command (0: no timeout)")
+	flag.DurationVar(&timeouts.Data, "data-timeout", umailData.DefaultTimeouts.Data, "maximum time the SMTP server may take to receive an email (0: no timeout)")
+	flag.Parse()
+
+	if len(flag.Args()) < 1 || len(flag.Args()) > 4 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1, 2, 3 or 4)`, len(flag.Args()))
+	}
+	if retries < 1 || delay < 0 {
+		return fmt.Errorf(`invalid parameters (retries: %d, delay: %s)`, retries, delay)
+	}
+	if err = timeouts.Validate(); err != nil {
+		return err
+	}
+	sessionName = flag.Arg(0)
+
+	// Load all data.
+	bodies = newCoverBodies(bodyPath)
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	if key, err = openSessionKey(&session); err != nil {
+		return err
+	}
+	if key != nil {
+		defer key.Close()
+	}
+	if account, args, err = sendingAccount(&session, sessionName, smtpServerAddress, smtpServerPort, pin, transport, proxy, sent, flag.Args()[1:]); err != nil {
+		return err
+	}
+	if err = checkTransport(account, password); err != nil {
+		return err
+	}
+	from = account.From
+	to, subject = sendTarget(&session, args)
+	if len(subject) == 0 {
+		return fmt.Errorf(`the session "%s" has no default subject: the subject must be given`, sessionName)
+	}
+	subject = mime.QEncoding.Encode("utf-8", subject)
+	if recipients, err = sessionRecipients(&session, sessionName, to); err != nil {
+		return err
+	}
+
+	sender = &mailer{account: account, password: password, oauth: oauth, insecure: insecure, timeouts: timeouts, retries: retries, delay: delay}
+	for _, recipient := range recipients {
+		for _, index := range recipient.Deliveries.Indexes(umailData.DeliveryFailed) {
+			var messageId string
+			var bodyFile string
+			var body []byte
+			var boundary []byte
+
+			if bodyFile, body, err = bodies.get(&session, recipient.Address, index); err != nil {
+				return err
+			}
+			if boundary, err = session.AllocateBoundary(index, key); err != nil {
+				_ = saveSession(sessionName, &session)
+				return err
+			}
+			if err = saveSession(sessionName, &session); err != nil {
+				return err
+			}
+			if messageId, err = sender.Send(from, recipient.Address, subject, boundary, body, sessionStyle(&session, recipient.Deliveries, index)); err != nil {
+				failed++
+				fmt.Printf("%s: email %d: failed (%s)\n", recipient.Address, index, err.Error())
+				_ = recipient.Deliveries.SetFailed(index, err)
+			} else {
+				resent++
+				fmt.Printf("%s: email %d: sent\n", recipient.Address, index)
+				if err = recipient.Deliveries.SetSent(index, messageId); err != nil {
+					return err
+				}
+				session.RecordSend(recipient.Address, umailData.Copies{}, index, messageId, bodyFile, 0)
+			}
+			if err = saveSession(sessionName, &session); err != nil {
+				return err
+			}
+		}
+	}
+	if err = sender.quit(); err != nil {
+		return err
+	}
+
+	if resent+failed == 0 {
+		fmt.Printf("No failed email to send again.\n")
+		return nil
+	}
+	fmt.Printf("Number of emails sent again: %d (over %d)\n", resent, resent+failed)
+	if failed > 0 {
+		return fmt.Errorf(`%d email(s) could not be sent`, failed)
+	}
+	if session.IsProcessed() {
+		fmt.Printf("The session has been entirely processes.\n")
+	}
+	return nil
+}
+
+// processDaemon Sends the queued emails (see "send --queue"), one at a time, in the order they have been queued. The
+// emails are only sent within a daily time window, and a random gap separates two emails. The queue is kept on disk:
+// the emails that have not been sent are sent once the daemon is started again.
+func processDaemon() error {
+	var err error
+	var password string
+	var windowSpec string
+	var window umailData.Window
+	var minInterval time.Duration
+	var maxInterval time.Duration
+	var retries int
+	var delay time.Duration
+	var once bool
+	var timeouts umailData.Timeouts
+	var queue *umailData.Queue
+	var gap time.Duration
+
+	flag.StringVar(&password, "password", "", "sender password used for authentication (for the emails that are not sent using an OAuth2 token)")
+	flag.StringVar(&windowSpec, "window", "", "daily time window (local time) within which the emails are sent (\"HH:MM-HH:MM\", default: the whole day)")
+	flag.DurationVar(&minInterval, "min-interval", time.Minute, "minimum gap between two emails")
+	flag.DurationVar(&maxInterval, "max-interval", 10*time.Minute, "maximum gap between two emails")
+	flag.IntVar(&retries, "retries", 5, "maximum number of attempts for each email (only the transient errors are retried)")
+	flag.DurationVar(&delay, "delay", 5*time.Minute, "delay before the second attempt (doubled after each attempt, plus a random jitter)")
+	flag.DurationVar(&timeouts.Dial, "dial-timeout", umailData.DefaultTimeouts.Dial, "maximum time to connect to the SMTP servers (0: no timeout)")
+	flag.DurationVar(&timeouts.Command, "command-timeout", umailData.DefaultTimeouts.Command, "maximum time the SMTP servers may take to reply to a command (0: no timeout)")
+	flag.DurationVar(&timeouts.Data, "data-timeout", umailData.DefaultTimeouts.Data, "maximum time the SMTP servers may take to receive an email (0: no timeout)")
+	flag.BoolVar(&once, "once", false, "send the queued emails that are due, then stop (instead of waiting for new emails)")
+	flag.Parse()
+
+	if len(flag.Args()) != 0 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 0)`, len(flag.Args()))
+	}
+	if retries < 1 || delay < 0 || minInterval < 0 || maxInterval < minInterval {
+		return fmt.Errorf(`invalid parameters (retries: %d, delay: %s, interval: %s to %s)`, retries, delay, minInterval, maxInterval)
+	}
+	if err = timeouts.Validate(); err != nil {
+		return err
+	}
+	if window, err = umailData.ParseWindow(windowSpec); err != nil {
+		return err
+	}
+	if queue, err = umailData.NewQueue(filepath.Join(appDir, queueSubDir)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Sending the queued emails (window: %s, interval: %s to %s).\n", window, minInterval, maxInterval)
+	for {
+		var emails []*umailData.QueuedEmail
+		var email *umailData.QueuedEmail
+		var now = time.Now()
+
+		if !window.Contains(now) {
+			if once {
+				fmt.Printf("Outside of the time window (%s).\n", window)
+				return nil
+			}
+			fmt.Printf("Outside of the time window (%s): waiting until %s.\n", window, formatDate(window.NextStart(now)))
+			time.Sleep(window.NextStart(now).Sub(now))
+			gap = 0
+			continue
+		}
+		if emails, err = queue.List(); err != nil {
+			return fmt.Errorf(`cannot read the queue: %s`, err.Error())
+		}
+		for _, candidate := range emails {
+			if !candidate.NotBefore.After(now) {
+				email = candidate
+				break
+			}
+		}
+		if email == nil {
+			if once {
+				fmt.Printf("No queued email is due (%d queued).\n", len(emails))
+				return nil
+			}
+			time.Sleep(daemonPollInterval)
+			gap = 0
+			continue
+		}
+		if err = deliverQueuedEmail(queue, email, password, timeouts, retries, delay, gap); err != nil {
+			// The email cannot be processed for now (for example, the session is in use): it is processed later.
+			fmt.Printf("%s: %s\n", email.Id, err.Error())
+			email.NotBefore = time.Now().Add(daemonPollInterval).UTC()
+			if err = queue.Update(email); err != nil {
+				return fmt.Errorf(`cannot update the queue: %s`, err.Error())
+			}
+			continue
+		}
+		// The gap is recorded into the journal of the session of the next email.
+		gap = randomDuration(minInterval, maxInterval)
+		time.Sleep(gap)
+	}
+}
+
+// refreshEmailDate Dates an email (RFC 5322) when it is sent (see `umailData.RefreshDate`). If the date is a carrier
+// (see `umailData.CarryingDate`), then the bytes it hides are kept.
+func refreshEmailDate(message string, carriers umailData.Carriers) (string, error) {
+	var err error
+	var payload []byte
+	var date = time.Now()
+
+	if carrier, ok := carriers.Get(umailData.CarrierDate); ok {
+		if payload, err = carrier.Extract([]byte(message)); err != nil {
+			return "", err
+		}
+		if date, err = umailData.CarryingDate(date, payload); err != nil {
+			return "", err
+		}
+	}
+	return umailData.RefreshDate(message, date), nil
+}
+
+// deliverQueuedEmail Sends a queued email, and records the result into its session. After a transient error, the email
+// stays in the queue, and it is sent again later (with an exponential backoff), unless the number of attempts is
+// reached. The email is removed from the queue if it is no longer queued within its session (for example, if the
+// session has been reset).
+// The time waited before sending the email (`gap`) is recorded into the journal. An error is returned if the email
+// cannot be processed for now.
+func deliverQueuedEmail(queue *umailData.Queue, email *umailData.QueuedEmail, password string, timeouts umailData.Timeouts, retries int, delay time.Duration, gap time.Duration) error {
+	var err error
+	var recipients []string
+	var lock *umailData.SessionLock
+	var session umailData.Session
+	var deliveries umailData.Deliveries
+	var sender *mailer
+	var message string
+
+	if lock, err = lockSession(email.Session); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(email.Session, &session); err != nil {
+		return err
+	}
+	deliveries = session.Deliveries
+	if len(session.Recipients) > 0 {
+		if recipient := session.Recipient(email.Recipient); recipient != nil {
+			deliveries = recipient.Deliveries
+		} else {
+			deliveries = nil
+		}
+	}
+	if email.Index >= len(deliveries) || deliveries[email.Index].Status != umailData.DeliveryQueued {
+		fmt.Printf("%s: email %d of the session \"%s\" is no longer queued: it is removed from the queue.\n", email.Recipient, email.Index, email.Session)
+		return queue.Remove(email.Id)
+	}
+
+	if recipients, err = envelopeRecipients(email.Recipient, email.Copies); err != nil {
+		return err
+	}
+	// The retries are managed by the daemon, so that the other emails are not delayed.
+	sender = &mailer{account: &email.Account, password: password, oauth: email.OAuth, insecure: email.Insecure, timeouts: timeouts, retries: 1}
+	email.Attempts++
+	// The email is dated when it is sent (not when it has been queued).
+	if message, err = refreshEmailDate(email.Message, session.Carriers); err != nil {
+		return err
+	}
+	if err = sender.Transmit(email.Account.From, recipients, []byte(message)); err == nil {
+		_ = sender.quit()
+		if err = deliveries.SetSent(email.Index, email.MessageID); err != nil {
+			return err
+		}
+		session.RecordSend(email.Recipient, email.Copies, email.Index, email.MessageID, email.BodyFile, gap)
+		// The email is removed from the queue first, so that it cannot be sent twice.
+		if err = queue.Remove(email.Id); err != nil {
+			return err
+		}
+		fmt.Printf("%s: email %d of the session \"%s\" has been sent.\n", email.Recipient, email.Index, email.Session)
+		return saveSession(email.Session, &session)
+	}
+	if umailData.IsTransient(err) && email.Attempts < retries {
+		email.LastError = err.Error()
+		email.NotBefore = time.Now().Add(umailData.BackoffDelay(delay, email.Attempts, randomIndex)).UTC()
+		fmt.Printf("%s: attempt %d failed (%s). Next attempt on %s.\n", email.Recipient, email.Attempts, err.Error(), formatDate(email.NotBefore))
+		return queue.Update(email)
+	}
+	fmt.Printf("%s: email %d of the session \"%s\" cannot be sent: %s\n", email.Recipient, email.Index, email.Session, err.Error())
+	_ = deliveries.SetFailed(email.Index, err)
+	if err = queue.Remove(email.Id); err != nil {
+		return err
+	}
+	return saveSession(email.Session, &session)
+}
+
+// randomDuration Returns a random duration between two bounds (included).
+func randomDuration(lower time.Duration, upper time.Duration) time.Duration {
+	return lower + time.Duration(randomIndex(int(upper-lower)+1))
+}
+
+// sendingAccount Returns the account used to send the emails of a session (SMTP server, port, pin and sender), and
+// the arguments that follow the sender. If the session is bound to an account, then the sender is not given, and the
+// SMTP server cannot be changed (the options "--smtp", "--port" and "--pin" must match the account, if given).
+// Otherwise, the first argument is the sender.
+func sendingAccount(session *umailData.Session, sessionName string, smtpServerAddress string, smtpServerPort int, pin string, transport string, proxy string, sent string, args []string) (*umailData.Account, []string, error) {
+	var account = session.Account
+	var mismatch bool
+
+	if account == nil {
+		if len(args) < 1 || len(args) > 3 {
+			return nil, nil, fmt.Errorf(`the session "%s" is not bound to an account: the sender must be given`, sessionName)
+		}
+		return &umailData.Account{SmtpServer: smtpServerAddress, SmtpPort: smtpServerPort, From: args[0], Pin: pin, Transport: transport, Proxy: proxy, Sent: sent}, args[1:], nil
+	}
+	if len(args) > 2 {
+		return nil, nil, fmt.Errorf(`the session "%s" is bound to the account "%s": the sender must not be given`, sessionName, account.From)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "smtp":
+			mismatch = mismatch || smtpServerAddress != account.SmtpServer
+		case "port":
+			mismatch = mismatch || smtpServerPort != account.SmtpPort
+		case "pin":
+			mismatch = mismatch || !strings.EqualFold(pin, account.Pin)
+		case "transport":
+			mismatch = mismatch || transport != account.TransportName()
+		case "proxy":
+			// The proxy does not change the server: it replaces the proxy of the account ("--proxy=" disables it).
+			var copied = *account
+			copied.Proxy = proxy
+			account = &copied
+		case "sent":
+			// The mailbox of the sent emails replaces the one of the account ("--sent=" disables it).
+			var copied = *account
+			copied.Sent = sent
+			account = &copied
+		}
+	})
+	if mismatch {
+		return nil, nil, fmt.Errorf(`the session "%s" is bound to the account "%s" (%s): it cannot be sent through another server`, sessionName, account.From, accountServer(account))
+	}
+	return account, args, nil
+}
+
+// accountServer Returns a description of the server the emails of an account are sent through.
+func accountServer(account *umailData.Account) string {
+	switch account.TransportName() {
+	case umailData.TransportGmail:
+		return "Gmail API"
+	case umailData.TransportGraph:
+		return "Microsoft Graph API"
+	}
+	return fmt.Sprintf("%s:%d", account.SmtpServer, account.SmtpPort)
+}
+
+// sendTarget Returns the recipient and the subject of the emails, given the arguments that follow the name of the
+// session and the sender. The recipient (if not a multi-recipient session) and the subject may be omitted: in this
+// case, the session's intended recipient and default subject are used.
+// - multi-recipient session: [[<to>] <subject>]
+// - single-recipient session: [<to> [<subject>]]
+// For a multi-recipient session, an empty recipient means "all the recipients".
+func sendTarget(session *umailData.Session, args []string) (string, string) {
+	var to = session.IntendedRecipient
+	var subject = session.Subject
+
+	switch {
+	case len(args) == 2:
+		to = args[0]
+		subject = args[1]
+	case len(args) == 1 && len(session.Recipients) > 0:
+		to = ""
+		subject = args[0]
+	case len(args) == 1:
+		to = args[0]
+	case len(session.Recipients) > 0:
+		to = ""
+	}
+	return to, subject
+}
+
+// sessionRecipients Returns the recipients of the emails. For a single-recipient session, the recipient is given (`to`),
+// and the progress is given by the session's delivery states. For a multi-recipient session, all the recipients are
+// returned, unless one is given.
+func sessionRecipients(session *umailData.Session, sessionName string, to string) ([]*umailData.Recipient, error) {
+	var recipients []*umailData.Recipient
+
+	if len(session.Recipients) > 0 {
+		if len(to) > 0 {
+			var recipient = session.Recipient(to)
+			if recipient == nil {
+				return nil, fmt.Errorf(`"%s" is not a recipient of the session "%s"`, to, sessionName)
+			}
+			return []*umailData.Recipient{recipient}, nil
+		}
+		for i := range session.Recipients {
+			recipients = append(recipients, &session.Recipients[i])
+		}
+		return recipients, nil
+	}
+	if len(to) == 0 {
+		return nil, fmt.Errorf(`the session "%s" has no list of recipients: the recipient must be given`, sessionName)
+	}
+	// Please note that the recipient shares the delivery states of the session.
+	return []*umailData.Recipient{{Address: to, Deliveries: session.Deliveries}}, nil
+}
+
+// connectSmtp Opens a connexion to an SMTPS server (TLS enabled), and authenticates (using a password, or the OAuth2
+// token of the sender). The connection is returned, so that its timeout can be changed while an email is transferred.
+func connectSmtp(account *umailData.Account, password string, oauth bool, insecure bool, timeouts umailData.Timeouts) (*smtp.Client, *umailData.TimeoutConn, error) {
+	var err error
+	var auth smtp.Auth
+	var connection *tls.Conn
+	var raw *umailData.TimeoutConn
+	var smtpClient *smtp.Client
+	var smtpUri string
+
+	if auth, err = smtpAuth(account, password, oauth); err != nil {
+		return nil, nil, err
+	}
+	smtpUri = fmt.Sprintf("%s:%d", account.SmtpServer, account.SmtpPort)
+	if connection, raw, err = dialTls(smtpUri, account.Proxy, umailData.NewTlsConfig(account.SmtpServer, account.Pin, insecure, nil), timeouts); err != nil {
+		return nil, nil, fmt.Errorf(`cannot connect to SMTPS server on "%s" (TLS enabled): %w`, smtpUri, err)
+	}
+	if smtpClient, err = smtp.NewClient(connection, account.SmtpServer); err != nil {
+		connection.Close()
+		return nil, nil, fmt.Errorf(`cannot connect to SMTPS server on "%s" (TLS enabled): %w`, smtpUri, err)
+	}
+	if err = smtpClient.Auth(auth); err != nil {
+		smtpClient.Close()
+		return nil, nil, fmt.Errorf(`cannot authenticate on SMTPS server on "%s" (TLS enabled): %w`, smtpUri, err)
+	}
+	return smtpClient, raw, nil
+}
+
+// dialTls Opens a TLS connection to an address ("host:port"), directly or through a SOCKS5 proxy (see
+// `umailData.DialProxy`). Through a proxy, the TLS session is negotiated with the server, not with the proxy. The
+// connection and the TLS handshake are abandoned once the dial timeout expires (the proxy has its own timeout, as Tor
+// may take a while to build a circuit). Then, the connection applies the command timeout: it is returned (in addition
+// to the TLS connection built over it), so that the timeout can be changed.
+func dialTls(address string, proxy string, config *tls.Config, timeouts umailData.Timeouts) (*tls.Conn, *umailData.TimeoutConn, error) {
+	var err error
+	var raw net.Conn
+	var timeoutConn *umailData.TimeoutConn
+	var connection *tls.Conn
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	if len(proxy) > 0 {
+		if raw, err = umailData.DialProxy(proxy, address, proxyTimeout); err != nil {
+			return nil, nil, err
+		}
+		timeoutConn = umailData.NewTimeoutConn(raw, timeouts.Command)
+	}
+	ctx, cancel = timeouts.DialContext()
+	defer cancel()
+	if timeoutConn == nil {
+		if timeoutConn, err = timeouts.Connect(ctx, address); err != nil {
+			return nil, nil, err
+		}
+	}
+	connection = tls.Client(timeoutConn, config)
+	if err = connection.HandshakeContext(ctx); err != nil {
+		timeoutConn.Close()
+		return nil, nil, err
+	}
+	return connection, timeoutConn, nil
+}
+
+// smtpAuth Returns the authentication mechanism used on the SMTP server.
+func smtpAuth(account *umailData.Account, password string, oauth bool) (smtp.Auth, error) {
+	var err error
+	var accessToken string
+
+	if !oauth {
+		return smtp.PlainAuth("", account.From, password, account.SmtpServer), nil
+	}
+	if len(password) > 0 {
+		return nil, fmt.Errorf(`the options "--password" and "--oauth" are mutually exclusive`)
+	}
+	if accessToken, err = oauthAccessToken(account.From); err != nil {
+		return nil, err
+	}
+	return &xoauth2Auth{user: account.From, accessToken: accessToken}, nil
+}
+
+// oauthAccessToken Returns the OAuth2 access token of an account (see "oauth-login"). The token is refreshed (and
+// saved) if it has expired.
+func oauthAccessToken(address string) (string, error) {
+	var err error
+	var store *umailData.TokenStore
+	var accessToken string
+
+	if store, err = umailData.NewTokenStore(filepath.Join(appDir, tokenSubDir)); err != nil {
+		return "", err
+	}
+	if accessToken, err = store.AccessToken(address, &http.Client{Timeout: oauthTimeout}); err != nil {
+		if errors.Is(err, umailData.ErrNotFound) {
+			return "", fmt.Errorf(`no OAuth2 token for "%s" (see "oauth-login")`, address)
+		}
+		return "", err
+	}
+	return accessToken, nil
+}
+
+// xoauth2Auth The XOAUTH2 SASL mechanism (used by Gmail and Office 365).
+type xoauth2Auth struct {
+	user        string
+	accessToken string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Like PLAIN, the token must not be sent in clear.
+	if !server.TLS {
+		return "", nil, errors.New(`unencrypted connection`)
+	}
+	return "XOAUTH2", umailData.XOAuth2Response(a.user, a.accessToken), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	// On failure, the server sends an error (JSON) and expects an empty response before it rejects the authentication.
+	if more {
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+// xoauth2ImapAuth The XOAUTH2 SASL mechanism, for an IMAP server (the connection is always encrypted, see `dialImap`).
+type xoauth2ImapAuth struct {
+	user        string
+	accessToken string
+}
+
+func (a *xoauth2ImapAuth) Start() (string, []byte, error) {
+	return "XOAUTH2", umailData.XOAuth2Response(a.user, a.accessToken), nil
+}
+
+func (a *xoauth2ImapAuth) Next(challenge []byte) ([]byte, error) {
+	// On failure, the server sends an error (JSON) and expects an empty response before it rejects the authentication.
+	return []byte{}, nil
+}
+
+// connectOptions How the connection to a server (IMAP or POP3) is opened and secured.
+type connectOptions struct {
+	// proxy The URL of the SOCKS5 proxy the connection goes through (see `umailData.ParseProxy`), if any.
+	proxy string
+	// pin The SHA-256 of the public key of the server (hexadecimal), if it is pinned (see `umailData.NewTlsConfig`).
+	pin string
+	// insecure The certificate of the server is not verified.
+	insecure bool
+	// roots The certificates of the authorities trusted to sign the certificate of the server (nil: the ones of the
+	// system).
+	roots *x509.CertPool
+	// startTls The connection starts in clear, and is upgraded (STARTTLS) instead of using implicit TLS (IMAP only).
+	startTls bool
+}
+
+// config Returns the TLS configuration used to connect to a server.
+func (o connectOptions) config(serverName string) *tls.Config {
+	return umailData.NewTlsConfig(serverName, o.pin, o.insecure, o.roots)
+}
+
+// processOAuthLogin Gets the OAuth2 token of an account, and stores it. By default, the device authorization flow is
+// used: the user must visit the URL given by the provider. Alternatively, an existing refresh token can be given.
+func processOAuthLogin() error {
+	var err error
+	var address string
+	var providerName string
+	var clientId string
+	var clientSecret string
+	var refreshToken string
+	var deviceUrl string
+	var tokenUrl string
+	var scope string
+	var provider umailData.OAuthProvider
+	var found bool
+	var store *umailData.TokenStore
+	var token *umailData.OAuthToken
+	var authorization *umailData.DeviceAuthorization
+	var client = &http.Client{Timeout: oauthTimeout}
+
+	// Parse the command line.
+	flag.StringVar(&providerName, "provider", "", `OAuth2 provider ("gmail", "office365" or "office365-graph")`)
+	flag.StringVar(&clientId, "client-id", "", "identifier of the OAuth2 client (registered by the user)")
+	flag.StringVar(&clientSecret, "client-secret", "", "secret of the OAuth2 client (if any)")
+	flag.StringVar(&refreshToken, "refresh-token", "", "existing refresh token (the device authorization is skipped)")
+	flag.StringVar(&deviceUrl, "device-url", "", "URL of the device authorization endpoint (overrides the provider)")
+	flag.StringVar(&tokenUrl, "token-url", "", "URL of the token endpoint (overrides the provider)")
+	flag.StringVar(&scope, "scope", "", "requested scope (overrides the provider)")
+	flag.Parse()
+
+	if len(flag.Args()) != 1 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(flag.Args()))
+	}
+	address = flag.Arg(0)
+	if _, err = mail.ParseAddress(address); err != nil {
+		return fmt.Errorf(`invalid address "%s": %s`, address, err.Error())
+	}
+	if len(clientId) == 0 {
+		return fmt.Errorf(`the identifier of the OAuth2 client ("--client-id") is required`)
+	}
+	if len(providerName) > 0 {
+		if provider, found = umailData.OAuthProviders[providerName]; !found {
+			return fmt.Errorf(`unknown OAuth2 provider "%s"`, providerName)
+		}
+	}
+	if len(deviceUrl) > 0 {
+		provider.DeviceURL = deviceUrl
+	}
+	if len(tokenUrl) > 0 {
+		provider.TokenURL = tokenUrl
+	}
+	if len(scope) > 0 {
+		provider.Scope = scope
+	}
+	if len(provider.TokenURL) == 0 {
+		return fmt.Errorf(`the OAuth2 provider ("--provider") or the token endpoint ("--token-url") is required`)
+	}
+	if store, err = umailData.NewTokenStore(filepath.Join(appDir, tokenSubDir)); err != nil {
+		return err
+	}
+
+	if len(refreshToken) > 0 {
+		// Make sure that the refresh token is valid.
+		token = &umailData.OAuthToken{TokenURL: provider.TokenURL, ClientID: clientId, ClientSecret: clientSecret, RefreshToken: refreshToken}
+		if err = token.Refresh(client); err != nil {
+			return err
+		}
+	} else {
+		if len(provider.DeviceURL) == 0 {
+			return fmt.Errorf(`the OAuth2 provider ("--provider") or the device authorization endpoint ("--device-url") is required`)
+		}
+		if authorization, err = umailData.StartDeviceAuthorization(client, provider, clientId); err != nil {
+			return err
+		}
+		fmt.Printf("Visit %s and enter the code %s\n", authorization.VerificationURL, authorization.UserCode)
+		if token, err = umailData.WaitDeviceAuthorization(client, provider, clientId, clientSecret, authorization, time.Sleep); err != nil {
+			return err
+		}
+	}
+
+	if err = store.Put(address, token); err != nil {
+		return fmt.Errorf(`cannot save the OAuth2 token of "%s": %s`, address, err.Error())
+	}
+	fmt.Printf("The OAuth2 token of \"%s\" has been saved (use \"--oauth\" to send emails).\n", address)
+	return nil
+}
+
+// emailStyle How an email looks like: the mail client whose headers are mimicked, and the conversation the email
+// belongs to.
+type emailStyle struct {
+	client umailData.MailClient
+	// marker The marker written into the message ID (see `umailData.NewMarker`), if any.
+	marker string
+	// textEncoding The encoding of the plain text part (see `umailData.BuildAlternative`).
+	textEncoding string
+	// charset The character set of the parts (see `umailData.ParseCharset`).
+	charset string
+	// boundaryStyle How the boundary is written (see `umailData.FormatBoundary`).
+	boundaryStyle umailData.BoundaryStyle
+	// nested Tells whether the boundary is split into the levels of a nested email (see `umailData.BuildNested`).
+	nested bool
+	// carriers The parts of the email that hide the boundary (see `umailData.Carriers`). If empty, then the boundary
+	// is hidden by the boundary of the email only.
+	carriers umailData.Carriers
+	// htmlLayout The path to the file that contains the layout of the HTML part (the default layout if empty).
+	htmlLayout string
+	// inlineCss Tells whether the CSS rules of the HTML part are moved to the elements (see `umailData.InlineCss`).
+	inlineCss bool
+	// copies The recipients of the copies of the email ("Cc" and "Bcc" headers), if any.
+	copies umailData.Copies
+	// thread The message IDs of the previous emails of the conversation, from the oldest to the most recent (empty if
+	// the email does not reply to another email).
+	thread []string
+}
+
+// sessionStyle Returns the style of the email at a given index of a session. The email belongs to a thread only if
+// the emails of the session are threaded (`deliveries` gives the message IDs of the previous emails).
+func sessionStyle(session *umailData.Session, deliveries umailData.Deliveries, index int) emailStyle {
+	var style = emailStyle{
+		client:        session.Client,
+		marker:        session.Marker,
+		textEncoding:  session.TextEncoding,
+		charset:       session.Charset,
+		boundaryStyle: session.BoundaryStyle,
+		nested:        session.Nested,
+		carriers:      session.Carriers,
+		htmlLayout:    session.HtmlLayout,
+		inlineCss:     session.InlineCss,
+	}
+
+	if session.Threaded {
+		style.thread = deliveries.Thread(index)
+	}
+	return style
+}
+
+// composeEmail Creates an email (RFC 5322) that contains a given boundary. The headers are the ones of the mail client
+// given by the style and, if the thread is not empty, then the email replies to the most recent email of the thread.
+// For a nested email, the boundary is split into one boundary per level. If the style gives carriers, then the
+// boundary is split across the carriers (the boundary of the email is random if it is not a carrier).
+// It returns the email and the value of its "Message-ID" header.
+func composeEmail(from string, to string, subject string, boundary []byte, body []byte, style emailStyle) (string, string, error) {
+	var err error
+	var headers umailData.Headers
+	var content []byte
+	var messageId string
+	var levels [][]byte
+	var formatted []string
+	var htmlBody []byte
+	var fromHeader string
+	var toHeader string
+	var contentType = "multipart/alternative"
+	var carriers = style.carriers
+	var parts map[umailData.CarrierName][]byte
+	var payloads umailData.BodyPayloads
+	var date = time.Now()
+
+	if len(carriers) == 0 {
+		carriers = umailData.DefaultCarriers(style.nested)
+	}
+	if parts, err = carriers.Split(boundary); err != nil {
+		return "", "", err
+	}
+	if boundary = parts[umailData.CarrierBoundary]; boundary == nil {
+		boundary = make([]byte, umailData.DefaultCarriers(style.nested).Length())
+		if _, err = rand.Read(boundary); err != nil {
+			return "", "", err
+		}
+	}
+	levels = [][]byte{boundary}
+	if style.nested {
+		var size = len(boundary) / umailData.NestingDepth
+		if len(boundary)%umailData.NestingDepth != 0 {
+			return "", "", fmt.Errorf(`the boundary cannot be split into %d levels (%d bytes)`, umailData.NestingDepth, len(boundary))
+		}
+		levels = nil
+		for i := 0; i < umailData.NestingDepth; i++ {
+			levels = append(levels, boundary[i*size:(i+1)*size])
+		}
+		contentType = "multipart/mixed"
+	}
+	for _, level := range levels {
+		var text string
+		if text, err = umailData.FormatBoundary(style.boundaryStyle, level); err != nil {
+			return "", "", err
+		}
+		formatted = append(formatted, text)
+	}
+	if htmlBody, err = createHtmlBody(body, style, parts[umailData.CarrierHtmlAttributes]); err != nil {
+		return "", "", err
+	}
+	if fromHeader, err = umailData.FormatAddress(from); err != nil {
+		return "", "", err
+	}
+	if toHeader, err = umailData.FormatAddressList(to); err != nil {
+		return "", "", err
+	}
+	for _, header := range []*string{&style.copies.Cc, &style.copies.Bcc} {
+		if len(*header) > 0 {
+			if *header, err = umailData.FormatAddressList(*header); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	if messageId, err = style.client.NewCarryingMessageID(from, style.marker, parts[umailData.CarrierMessageID]); err != nil {
+		return "", "", fmt.Errorf(`cannot generate the message ID: %s`, err)
+	}
+	if payload, ok := parts[umailData.CarrierSubject]; ok {
+		var carrier, _ = carriers.Get(umailData.CarrierSubject)
+		var codebook umailData.Codebook
+		if codebook, err = umailData.NewCodebook(carrier.Key); err != nil {
+			return "", "", err
+		}
+		if subject, err = codebook.Subject(payload); err != nil {
+			return "", "", err
+		}
+	}
+	if payload, ok := parts[umailData.CarrierDate]; ok {
+		if date, err = umailData.CarryingDate(date, payload); err != nil {
+			return "", "", err
+		}
+	}
+	headers = style.client.Headers(umailData.EmailFields{
+		From:        fromHeader,
+		To:          toHeader,
+		Cc:          style.copies.Cc,
+		Bcc:         style.copies.Bcc,
+		Subject:     subject,
+		MessageID:   messageId,
+		Thread:      style.thread,
+		Date:        date,
+		ContentType: fmt.Sprintf(`%s; boundary="%s"`, contentType, formatted[0]),
+	})
+	if payload, ok := parts[umailData.CarrierXHeader]; ok {
+		var carrier, _ = carriers.Get(umailData.CarrierXHeader)
+		var custom umailData.Headers
+		if custom, err = carrier.Persona.Headers(payload); err != nil {
+			return "", "", err
+		}
+		headers = append(headers, custom...)
+	}
+	if payload, ok := parts[umailData.CarrierHeaderOrder]; ok {
+		if headers, err = umailData.OrderHeaders(headers, payload); err != nil {
+			return "", "", err
+		}
+	}
+	payloads.Base64Lines = parts[umailData.CarrierBase64Lines]
+	payloads.SoftBreaks = parts[umailData.CarrierSoftBreaks]
+	payloads.Whitespace = parts[umailData.CarrierWhitespace]
+	if payload, ok := parts[umailData.CarrierImage]; ok {
+		var carrier, _ = carriers.Get(umailData.CarrierImage)
+		if payloads.Cover, err = os.ReadFile(carrier.Cover); err != nil {
+			return "", "", fmt.Errorf(`cannot load the cover image from file "%s": %s`, carrier.Cover, err.Error())
+		}
+		payloads.Image = payload
+		payloads.CoverPath = carrier.Cover
+	}
+	if style.nested {
+		content, err = umailData.BuildNested(formatted, body, htmlBody, style.textEncoding, style.charset, payloads)
+	} else {
+		content, err = umailData.BuildAlternative(formatted[0], body, htmlBody, style.textEncoding, style.charset, payloads)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf(`unexpected error while generating the email body: %s`, err)
+	}
+	return buildMessage(headers, string(content)), messageId, nil
+}
+
+// transmitEmail Sends an email that has already been composed (RFC 5322), using an authenticated SMTP client. The
+// recipients are the addresses of all the mailboxes the email is delivered to ("To", "Cc" and "Bcc"): the "Bcc" header
+// is removed from the email. The email is adapted to the extensions of the server (see `umailData.SmtpLimits.Fit`):
+// it is refused before the "MAIL FROM" command if the server cannot accept it. The data timeout applies from the "DATA"
+// command until the server accepts the email (the command timeout applies otherwise).
+func transmitEmail(smtpClient *smtp.Client, connection *umailData.TimeoutConn, timeouts umailData.Timeouts, from string, recipients []string, message []byte) error {
+	var err error
+	var writer io.WriteCloser
+	var limits umailData.SmtpLimits
+	var text string
+
+	// The address of the sender may contain a display name.
+	if from, err = umailData.EnvelopeAddress(from); err != nil {
+		return err
+	}
+	if limits, err = smtpLimits(smtpClient); err != nil {
+		return err
+	}
+	if text, err = limits.Fit(umailData.StripBcc(string(message))); err != nil {
+		return err
+	}
+	if err = smtpClient.Mail(from); err != nil {
+		return fmt.Errorf(`error while sending "MAIL FROM:%s<CRLF>" command: %w`, from, err)
+	}
+	for _, to := range recipients {
+		if err = smtpClient.Rcpt(to); err != nil {
+			return fmt.Errorf(`error while sending "RCPT TO:%s<CRLF>" command: %w`, to, err)
+		}
+	}
+	connection.SetTimeout(timeouts.Data)
+	defer connection.SetTimeout(timeouts.Command)
+	if writer, err = smtpClient.Data(); err != nil {
+		return fmt.Errorf(`error while sending "DATA<CRLF>" command: %w`, err)
+	}
+	if _, err = writer.Write([]byte(text)); err != nil {
+		return fmt.Errorf(`error while sending sending the message to send: %w`, err)
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf(`error while closing SMTP writer: %w`, err)
+	}
+	return nil
+}
+
+// smtpLimits Returns the limits announced by an SMTP server in its reply to the "EHLO" command.
+func smtpLimits(smtpClient *smtp.Client) (umailData.SmtpLimits, error) {
+	var err error
+	var limits umailData.SmtpLimits
+
+	if ok, param := smtpClient.Extension("SIZE"); ok {
+		if limits.MaxSize, err = umailData.ParseSizeExtension(param); err != nil {
+			return limits, err
+		}
+	}
+	limits.EightBit, _ = smtpClient.Extension("8BITMIME")
+	return limits, nil
+}
+
+// emailSender Sends an email that contains a given boundary, and returns its message ID. The style gives the headers of
+// the email (see `composeEmail`).
+type emailSender func(from string, to string, subject string, boundary []byte, body []byte, style emailStyle) (string, error)
+
+// messageSender Sends an email that has already been composed (RFC 5322) to given recipients (the addresses of the
+// mailboxes, see `envelopeRecipients`).
+type messageSender func(from string, recipients []string, message []byte) error
+
+// smtpSender Returns a sender that sends the emails through a connexion to an SMTP server (see `connectSmtp`).
+func smtpSender(smtpClient *smtp.Client, connection *umailData.TimeoutConn, timeouts umailData.Timeouts) messageSender {
+	return func(from string, recipients []string, message []byte) error {
+		return transmitEmail(smtpClient, connection, timeouts, from, recipients, message)
+	}
+}
+
+// envelopeRecipients Returns the addresses of the mailboxes an email is delivered to: the "To" recipients (a list of
+// addresses separated by commas), followed by the recipients of the copies.
+func envelopeRecipients(to string, copies umailData.Copies) ([]string, error) {
+	var err error
+	var recipients []string
+	var others []string
+
+	if recipients, err = umailData.EnvelopeAddresses(to); err != nil {
+		return nil, err
+	}
+	if others, err = copies.Recipients(); err != nil {
+		return nil, err
+	}
+	return append(recipients, others...), nil
+}
+
+// checkTransport Checks the transport used to send the emails of an account (see `openSender`).
+func checkTransport(account *umailData.Account, password string) error {
+	if err := account.CheckProxy(); err != nil {
+		return err
+	}
+	if err := account.CheckSent(); err != nil {
+		return err
+	}
+	switch account.TransportName() {
+	case umailData.TransportSmtp:
+		return nil
+	case umailData.TransportGmail, umailData.TransportGraph:
+		if len(password) > 0 {
+			return fmt.Errorf(`the transport "%s" uses the OAuth2 token of the sender: no password can be given`, account.Transport)
+		}
+		return nil
+	}
+	return fmt.Errorf(`unknown transport "%s" ("%s", "%s" or "%s")`, account.Transport, umailData.TransportSmtp, umailData.TransportGmail, umailData.TransportGraph)
+}
+
+// openSender Opens the transport used to send the emails of an account: a connexion to the SMTP server (which is
+// returned), the Gmail API or the Microsoft Graph API.
+func openSender(account *umailData.Account, password string, oauth bool, insecure bool, timeouts umailData.Timeouts) (messageSender, *smtp.Client, error) {
+	var err error
+	var smtpClient *smtp.Client
+	var connection *umailData.TimeoutConn
+
+	switch account.TransportName() {
+	case umailData.TransportGmail:
+		return apiSender(func(client *http.Client, accessToken string, message []byte) error {
+			_, err := umailData.GmailSend(client, umailData.GmailSendURL, accessToken, message)
+			return err
+		}), nil, nil
+	case umailData.TransportGraph:
+		return apiSender(func(client *http.Client, accessToken string, message []byte) error {
+			return umailData.GraphSend(client, umailData.GraphURL, accessToken, message)
+		}), nil, nil
+	}
+	if smtpClient, connection, err = connectSmtp(account, password, oauth, insecure, timeouts); err != nil {
+		return nil, nil, err
+	}
+	return smtpSender(smtpClient, connection, timeouts), smtpClient, nil
+}
+
+// mailer Sends emails through the transport of an account. Transient errors (such as a 4xx reply from the SMTP server,
+// or a connexion reset) are retried, with an exponential backoff (and jitter): the connexion is opened again before
+// each attempt. The other errors are definitive.
+type mailer struct {
+	account    *umailData.Account
+	password   string
+	oauth      bool
+	insecure   bool
+	timeouts   umailData.Timeouts
+	retries    int
+	delay      time.Duration
+	send       messageSender
+	smtpClient *smtp.Client
+}
+
+// open Opens the transport (if not already opened).
+func (m *mailer) open() error {
+	var err error
+
+	if m.send == nil {
+		m.send, m.smtpClient, err = openSender(m.account, m.password, m.oauth, m.insecure, m.timeouts)
+	}
+	return err
+}
+
+// Send Sends an email (see `emailSender`). It fails once the number of attempts is reached, or if the error is not
+// transient.
+func (m *mailer) Send(from string, to string, subject string, boundary []byte, body []byte, style emailStyle) (string, error) {
+	var err error
+	var message string
+	var messageId string
+	var recipients []string
+
+	if recipients, err = envelopeRecipients(to, style.copies); err != nil {
+		return "", err
+	}
+	if message, messageId, err = composeEmail(from, to, subject, boundary, body, style); err != nil {
+		return "", err
+	}
+	if err = m.Transmit(from, recipients, []byte(message)); err != nil {
+		return "", err
+	}
+	return messageId, nil
+}
+
+// Transmit Sends an email that has already been composed (see `messageSender`). It fails once the number of attempts
+// is reached, or if the error is not transient.
+func (m *mailer) Transmit(from string, recipients []string, message []byte) error {
+	for attempt := 1; ; attempt++ {
+		var err error
+		var wait time.Duration
+
+		if err = m.open(); err == nil {
+			if err = m.send(from, recipients, message); err == nil {
+				m.appendSent(message)
+				return nil
+			}
+			// The state of the connexion is unknown: a new connexion is opened for the next attempt.
+			m.close()
+		}
+		if attempt >= m.retries || !umailData.IsTransient(err) {
+			return err
+		}
+		wait = umailData.BackoffDelay(m.delay, attempt, randomIndex)
+		fmt.Printf("%s: attempt %d failed (%s). Next attempt in %s.\n", strings.Join(recipients, ", "), attempt, err.Error(), wait)
+		time.Sleep(wait)
+	}
+}
+
+// appendSent Appends an email sent to the mailbox of the sent emails of the account (IMAP), if any. The email is
+// already sent: if it cannot be appended, then a warning is printed (sending it again would duplicate it).
+func (m *mailer) appendSent(message []byte) {
+	var err error
+	var folder *umailData.SentFolder
+
+	if len(m.account.Sent) == 0 {
+		return
+	}
+	if folder, err = umailData.ParseSentFolder(m.account.Sent); err == nil {
+		err = appendImapMessage(folder, m.account.From, m.password, m.oauth, m.insecure, m.timeouts, message)
+	}
+	if err != nil {
+		fmt.Printf("Warning: the email has been sent, but it cannot be appended to the mailbox \"%s\": %s\n", m.account.Sent, err.Error())
+	}
+}
+
+// quit Closes the transport normally.
+func (m *mailer) quit() error {
+	var smtpClient = m.smtpClient
+
+	m.send = nil
+	m.smtpClient = nil
+	if smtpClient != nil {
+		if err := smtpClient.Quit(); err != nil {
+			return fmt.Errorf(`error while sending "QUIT<CRLF>" command: %s`, err.Error())
+		}
+	}
+	return nil
+}
+
+// close Closes the transport (after an error).
+func (m *mailer) close() {
+	if m.smtpClient != nil {
+		m.smtpClient.Close()
+	}
+	m.send = nil
+	m.smtpClient = nil
+}
+
+// apiSender Returns a sender that submits the emails through an HTTP API (`submit`), using the OAuth2 token of the
+// sender. The email is submitted as is, so that the boundary is kept: the API takes the recipients from the headers
+// (and it removes the "Bcc" header).
+func apiSender(submit func(client *http.Client, accessToken string, message []byte) error) messageSender {
+	var client = &http.Client{Timeout: apiTimeout}
+
+	return func(from string, recipients []string, message []byte) error {
+		var err error
+		var accessToken string
+
+		if accessToken, err = oauthAccessToken(from); err != nil {
+			return err
+		}
+		return submit(client, accessToken, message)
+	}
+}
+
+// emlSender Returns a sender that writes the email into a file (RFC 5322, ".eml") instead of sending it. The file
+// must not exist.
+func emlSender(path string) emailSender {
+	return func(from string, to string, subject string, boundary []byte, body []byte, style emailStyle) (string, error) {
+		var err error
+		var message string
+		var messageId string
+
+		if message, messageId, err = composeEmail(from, to, subject, boundary, body, style); err != nil {
+			return "", err
+		}
+		if err = umailData.WriteNewFile(path, []byte(message)); err != nil {
+			return "", err
+		}
+		return messageId, nil
+	}
+}
+
+// formatDate Returns a representation of a date (in local time) for the user.
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return "unknown"
+	}
+	return date.Local().Format("2006-01-02 15:04:05")
+}
+
+// processExportSession Writes the remaining emails of a session (pending or failed) into files (RFC 5322, ".eml"),
+// so that they can be sent later, using any mail client. The session is not modified: the emails are still pending.
+func processExportSession() error {
+	var err error
+	var sessionName string
+	var to string
+	var from string
+	var subject string
+	var bodyPath string
+	var bodies *coverBodies
+	var session umailData.Session
+	var recipients []*umailData.Recipient
+	var args []string
+	var eml bool
+	var outDir string
+	var account *umailData.Account
+	var count int
+
+	// Parse the command line.
+	flag.BoolVar(&eml, "eml", false, "write the emails as \".eml\" files (RFC 5322)")
+	flag.StringVar(&outDir, "out", "", "path to the directory where to write the emails")
+	flag.StringVar(&bodyPath, "body", DefaultBodyFile, fmt.Sprintf("path to the file that contains the email's body (default: %s)", DefaultBodyFile))
+	flag.Parse()
+
+	if len(flag.Args()) < 1 || len(flag.Args()) > 4 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1, 2, 3 or 4)`, len(flag.Args()))
+	}
+	if !eml {
+		return fmt.Errorf(`the format of the export must be given (--eml)`)
+	}
+	if len(outDir) == 0 {
+		return fmt.Errorf(`the output directory must be given (--out)`)
+	}
+	sessionName = flag.Arg(0)
+
+	// Load all data.
+	bodies = newCoverBodies(bodyPath)
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	if session.Lazy {
+		return fmt.Errorf(`the session "%s" is lazy: its boundaries are computed when the emails are sent, it cannot be exported`, sessionName)
+	}
+	if account, args, err = sendingAccount(&session, sessionName, "", 0, "", "", "", "", flag.Args()[1:]); err != nil {
+		return err
+	}
+	from = account.From
+	to, subject = sendTarget(&session, args)
+	if len(subject) == 0 {
+		return fmt.Errorf(`the session "%s" has no default subject: the subject must be given`, sessionName)
+	}
+	subject = mime.QEncoding.Encode("utf-8", subject)
+	if recipients, err = sessionRecipients(&session, sessionName, to); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf(`cannot create the directory "%s": %s`, outDir, err.Error())
+	}
+
+	// Write the remaining emails of each recipient.
+	for _, recipient := range recipients {
+		for _, index := range recipient.Deliveries.Remaining() {
+			var path string
+			var bodyFile string
+			var body []byte
+			var message string
+			var messageId string
+
+			if bodyFile, body, err = bodies.get(&session, recipient.Address, index); err != nil {
+				return err
+			}
+			if message, messageId, err = composeEmail(from, recipient.Address, subject, session.Boundaries[index], body, sessionStyle(&session, recipient.Deliveries, index)); err != nil {
+				return err
+			}
+			path = filepath.Join(outDir, session.EmlFileName(sessionName, recipient.Address, index))
+			if err = umailData.WriteNewFile(path, []byte(message)); err != nil {
+				return err
+			}
+			// The journal is not saved: it only makes the random rotation of the bodies go on.
+			session.RecordSend(recipient.Address, umailData.Copies{}, index, messageId, bodyFile, 0)
+			fmt.Printf("[%3d] %s => %s\n", index, recipient.Address, path)
+			count++
+		}
+	}
+	if count == 0 {
+		return fmt.Errorf(`the session "%s" has already been processed`, sessionName)
+	}
+	fmt.Printf("Number of emails exported: %d\n", count)
+	return nil
+}
+
+// processVerifySession Cross-checks a session against its key, and reports everything that is inconsistent. If the
+// original message is given, then the boundaries are checked against the message (otherwise, they are decoded and
+// checked against the hash of the message).
+func processVerifySession() error {
+	var err error
+	var sessionName string
+	var session umailData.Session
+	var pool resource.KeySource
+	var poolPath string
+	var messagePath string
+	var plainMessage []byte
+	var issues []string
+
+	flag.StringVar(&messagePath, "message", "", "path to the file that contains the original message")
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(flag.Args()))
+	}
+	sessionName = flag.Arg(0)
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	if len(messagePath) > 0 {
+		if plainMessage, err = os.ReadFile(messagePath); err != nil {
+			return fmt.Errorf(`cannot load the message from the file "%s": %s`, messagePath, err.Error())
+		}
+	}
+	poolPath = filepath.Join(keyDir, session.PoolName)
+	if pool, err = resource.Open(poolPath); err != nil {
+		return fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
+	}
+	defer pool.Close()
+	if issues = session.Inconsistencies(pool, plainMessage); len(issues) > 0 {
+		for _, issue := range issues {
+			fmt.Printf("- %s\n", issue)
+		}
+		return fmt.Errorf(`the session "%s" is not consistent with the key "%s" (%d problem(s))`, sessionName, session.PoolName, len(issues))
+	}
+	if plainMessage == nil && len(session.MessageHash) == 0 {
+		fmt.Printf("The boundaries of the session \"%s\" can be decoded, but the session does not contain the hash of the message (it cannot be fully verified: give the message).\n", sessionName)
+		return nil
+	}
+	fmt.Printf("The session \"%s\" is consistent with the key \"%s\".\n", sessionName, session.PoolName)
+	return nil
+}
+
+func processSessionInfo() error {
+	var err error
+	var sessionName string
+	var session umailData.Session
+	var b2l = func(b []uint8) string {
+		var result []string
+		for _, v := range b {
+			result = append(result, fmt.Sprintf("%d", v))
+		}
+		return strings.Join(result, ", ")
+	}
+
+	if len(os.Args) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(os.Args))
+	}
+	sessionName = os.Args[1]
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	fmt.Printf("name: \"%s\" (%s)\n", sessionName, sessionLocation(sessionName))
+	fmt.Printf("version: %d\n", session.LoadedVersion())
+	fmt.Printf("protected: %t\n", session.IsProtected())
+	fmt.Printf("lazy: %t\n", session.Lazy)
+	fmt.Printf("authenticated: %t\n", session.Authenticated)
+	fmt.Printf("sequenced: %t\n", session.Sequenced)
+	fmt.Printf("threaded: %t\n", session.Threaded)
+	fmt.Printf("mail client: %s\n", session.Client.Name())
+	if len(session.Marker) > 0 {
+		fmt.Printf("marker: %s\n", session.Marker)
+	}
+	if len(session.TextEncoding) > 0 {
+		fmt.Printf("text encoding: %s\n", session.TextEncoding)
+	} else {
+		fmt.Printf("text encoding: %s\n", umailData.TextEncodingBase64)
+	}
+	if len(session.Charset) > 0 {
+		fmt.Printf("charset: %s\n", session.Charset)
+	} else {
+		fmt.Printf("charset: %s\n", umailData.DefaultCharset)
+	}
+	fmt.Printf("boundary style: %s\n", session.BoundaryStyle.Name())
+	fmt.Printf("nested: %t\n", session.Nested)
+	if len(session.Carriers) > 0 {
+		fmt.Printf("carriers: %s\n", session.Carriers.String())
+		if carrier, ok := session.Carriers.Get(umailData.CarrierXHeader); ok {
+			fmt.Printf("persona: %s\n", carrier.Persona)
+		}
+		if carrier, ok := session.Carriers.Get(umailData.CarrierImage); ok {
+			fmt.Printf("cover image: %s\n", carrier.Cover)
+		}
+	} else {
+		fmt.Printf("carriers: %s\n", umailData.DefaultCarriers(session.Nested).String())
+	}
+	if len(session.HtmlLayout) > 0 {
+		fmt.Printf("HTML layout: %s\n", session.HtmlLayout)
+	}
+	fmt.Printf("inline CSS: %t\n", session.InlineCss)
+	if session.Schedule != nil {
+		fmt.Printf("schedule: every %d day(s), within %s\n", session.Schedule.Every, scheduleWindow(session.Schedule))
+	}
+	fmt.Printf("created: %s\n", formatDate(session.Created))
+	fmt.Printf("updated: %s\n", formatDate(session.Updated))
+	if len(session.IntendedRecipient) > 0 {
+		fmt.Printf("recipient: %s\n", session.IntendedRecipient)
+	}
+	if len(session.Subject) > 0 {
+		fmt.Printf("subject: %s\n", session.Subject)
+	}
+	if len(session.Note) > 0 {
+		fmt.Printf("note: %s\n", session.Note)
+	}
+	fmt.Printf("pool: \"%s\" (%s) at %d\n", session.PoolName, filepath.Join(keyDir, session.PoolName), session.PoolPointerPosition)
+	if session.Account != nil {
+		fmt.Printf("account: %s (%s)\n", session.Account.From, accountServer(session.Account))
+		if len(session.Account.Pin) > 0 {
+			fmt.Printf("server pin: %s\n", session.Account.Pin)
+		}
+		// The password of the proxy (if any) is not printed.
+		if proxy, err := umailData.ParseProxy(session.Account.Proxy); err == nil {
+			fmt.Printf("proxy: %s\n", proxy.Redacted())
+		}
+		if len(session.Account.Sent) > 0 {
+			fmt.Printf("sent emails: %s\n", session.Account.Sent)
+		}
+	}
+	printProgress(&session)
+	if len(session.Bodies) > 0 {
+		fmt.Printf("bodies (%d, rotation: %s):\n", len(session.Bodies), bodyRotationName(session.Rotation))
+		for _, path := range session.Bodies {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	if len(session.Corpus) > 0 {
+		fmt.Printf("corpus: %s\n", session.Corpus)
+	}
+	fmt.Printf("templated: %t\n", session.Templated)
+	if len(session.Variables) > 0 {
+		var names []string
+		for name := range session.Variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Printf("variables:\n")
+		for _, name := range names {
+			fmt.Printf("  %s=%s\n", name, session.Variables[name])
+		}
+	}
+	if len(session.Recipients) == 0 {
+		fmt.Printf("email sent: %d\n", session.Deliveries.Count(umailData.DeliverySent)+session.Deliveries.Count(umailData.DeliveryConfirmed))
+	}
+	fmt.Printf("boundaries (%d):\n", len(session.Boundaries))
+	for i := 0; i < len(session.Boundaries); i++ {
+		if !session.IsAllocated(i) {
+			fmt.Printf("[%3d]  not allocated yet\n", i)
+		} else {
+			fmt.Printf("[%3d]  [%s] (len: %d)\n", i, b2l(session.Boundaries[i]), len(session.Boundaries[i]))
+			fmt.Printf("       => \"%s\"\n", boundaryAsString(session.Boundaries[i]))
+		}
+		if session.Lazy && session.IsAllocated(i) {
+			fmt.Printf("       key position: %d\n", session.Positions[i])
+		}
+		if len(session.Recipients) == 0 {
+			fmt.Printf("       %s\n", deliveryAsString(session.Deliveries[i]))
+		}
+		if session.Schedule != nil && !session.Schedule.Due[i].IsZero() {
+			fmt.Printf("       due on %s\n", formatDate(session.Schedule.Due[i]))
+		}
+	}
+	if len(session.Recipients) == 0 {
+		fmt.Printf("number of emails to send: %d\n", session.Deliveries.Count(umailData.DeliveryPending)+session.Deliveries.Count(umailData.DeliveryFailed))
+		if queued := session.Deliveries.Count(umailData.DeliveryQueued); queued > 0 {
+			fmt.Printf("number of emails queued: %d\n", queued)
+		}
+		printJournal(&session)
+		return nil
+	}
+	fmt.Printf("recipients (%d):\n", len(session.Recipients))
+	for _, recipient := range session.Recipients {
+		var d = recipient.Deliveries
+		fmt.Printf("  %s: %d pending, %d queued, %d sent, %d failed, %d confirmed\n", recipient.Address,
+			d.Count(umailData.DeliveryPending), d.Count(umailData.DeliveryQueued), d.Count(umailData.DeliverySent), d.Count(umailData.DeliveryFailed), d.Count(umailData.DeliveryConfirmed))
+		for i := range d {
+			fmt.Printf("    [%3d] %s\n", i, deliveryAsString(d[i]))
+		}
+	}
+	printJournal(&session)
+	return nil
+}
+
+// scheduleWindow Returns the daily time window of a schedule, for the user.
+func scheduleWindow(schedule *umailData.Schedule) string {
+	if len(schedule.Window) == 0 {
+		return "the whole day"
+	}
+	return schedule.Window
+}
+
+// printProgress Prints the progress of a session and, if the journal contains enough entries, the average interval
+// between two emails and the estimated time of completion.
+func printProgress(session *umailData.Session) {
+	var done, total = session.Progress()
+	var average time.Duration
+	var ok bool
+
+	fmt.Printf("progress: %s\n", progressBar(done, total))
+	if average, ok = session.AverageInterval(); !ok {
+		return
+	}
+	fmt.Printf("average interval: %s\n", average.Round(100*time.Millisecond))
+	if done < total {
+		fmt.Printf("estimated completion: %s\n", formatDate(session.Journal[len(session.Journal)-1].Date.Add(average*time.Duration(total-done))))
+	}
+}
+
+// bodyRotationName Returns the name of the rotation of the bodies, for the user.
+func bodyRotationName(rotation umailData.BodyRotation) string {
+	if len(rotation) == 0 {
+		return string(umailData.RotationSequence)
+	}
+	return string(rotation)
+}
+
+// printJournal Prints the records of the emails sent.
+func printJournal(session *umailData.Session) {
+	fmt.Printf("journal (%d):\n", len(session.Journal))
+	for _, entry := range session.Journal {
+		var details string
+		if len(entry.Body) > 0 {
+			details = "  " + filepath.Base(entry.Body)
+		}
+		if len(entry.Cc) > 0 {
+			details += fmt.Sprintf("  (cc: %s)", entry.Cc)
+		}
+		if len(entry.Bcc) > 0 {
+			details += fmt.Sprintf("  (bcc: %s)", entry.Bcc)
+		}
+		if entry.Gap > 0 {
+			details += fmt.Sprintf("  (gap: %s)", entry.Gap)
+		}
+		fmt.Printf("  %s  %s  [%3d]  %s%s\n", formatDate(entry.Date), entry.Recipient, entry.Boundary, entry.MessageID, details)
+	}
+}
+
+// deliveryAsString Returns a representation of the delivery state of a boundary for the user.
+func deliveryAsString(delivery umailData.Delivery) string {
+	var result = string(delivery.Status)
+
+	if delivery.Updated != nil {
+		result += " on " + formatDate(*delivery.Updated)
+	}
+	if len(delivery.MessageID) > 0 {
+		result += " (message ID: " + delivery.MessageID + ")"
+	}
+	if len(delivery.Error) > 0 {
+		result += " (error: " + delivery.Error + ")"
+	}
+	return result
+}
+
+func processEditSession() error {
+	var err error
+	var sessionName string
+	var session umailData.Session
+	var cliRecipient *string
+	var cliSubject *string
+	var cliNote *string
+	var cliTemplate *bool
+	var cliVariables = variableFlags{}
+	var lock *umailData.SessionLock
+
+	cliRecipient = flag.String("recipient", "", "intended recipient (for a single-recipient session)")
+	cliSubject = flag.String("subject", "", "default subject of the emails")
+	cliNote = flag.String("note", "", "free text note")
+	cliTemplate = flag.Bool("template", false, "the bodies of the emails are templates, rendered for each email")
+	flag.Var(cliVariables, "var", `variable of the templates of the bodies ("name=value", can be repeated; an empty value removes the variable)`)
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
+	}
+	sessionName = flag.Arg(0)
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	// Only the given options are modified.
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "recipient":
+			session.IntendedRecipient = *cliRecipient
+		case "subject":
+			session.Subject = *cliSubject
+		case "note":
+			session.Note = *cliNote
+		case "template":
+			session.Templated = *cliTemplate
+		}
+	})
+	setVariables(&session, cliVariables)
+	if err = checkBodyTemplates(&session); err != nil {
+		return err
+	}
+	if err = saveSession(sessionName, &session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func processScheduleSession() error {
+	var err error
+	var sessionName string
+	var session umailData.Session
+	var cliEvery *int
+	var cliWindow *string
+	var cliStart *string
+	var cliClear *bool
+	var window umailData.Window
+	var start = time.Now()
+	var first = -1
+	var lock *umailData.SessionLock
+
+	cliEvery = flag.Int("every", 1, "number of days between two emails")
+	cliWindow = flag.String("window", "09:00-18:00", `daily time window the emails are due within ("HH:MM-HH:MM", local time; empty for the whole day)`)
+	cliStart = flag.String("start", "", `day of the next email ("YYYY-MM-DD", default: today)`)
+	cliClear = flag.Bool("clear", false, "remove the schedule of the session")
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
+	}
+	sessionName = flag.Arg(0)
+	if window, err = umailData.ParseWindow(*cliWindow); err != nil {
+		return err
+	}
+	if len(*cliStart) > 0 {
+		if start, err = time.ParseInLocation("2006-01-02", *cliStart, time.Local); err != nil {
+			return fmt.Errorf(`invalid start day "%s" (expected "YYYY-MM-DD")`, *cliStart)
+		}
+	}
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	if *cliClear {
+		session.Schedule = nil
+		return saveSession(sessionName, &session)
+	}
+
+	// The schedule starts with the first email that has not been sent yet (to any recipient).
+	if len(session.Recipients) == 0 {
+		first = session.Deliveries.Next()
+	}
+	for _, recipient := range session.Recipients {
+		if next := recipient.Deliveries.Next(); next >= 0 && (first < 0 || next < first) {
+			first = next
+		}
+	}
+	if first < 0 {
+		return fmt.Errorf(`the session "%s" has already been processed`, sessionName)
+	}
+	if session.Schedule, err = umailData.NewSchedule(start, *cliEvery, window, first, len(session.Boundaries), randomIndex); err != nil {
+		return err
+	}
+	if err = saveSession(sessionName, &session); err != nil {
+		return err
+	}
+	for i := first; i < len(session.Boundaries); i++ {
+		fmt.Printf("[%3d]  due on %s\n", i, formatDate(session.Schedule.Due[i]))
+	}
+	return nil
+}
+
+func processConfirmSession() error {
+	var err error
+	var sessionName string
+	var session umailData.Session
+	var cliRecipient *string
+	var deliveries umailData.Deliveries
+	var indexes []int
+	var lock *umailData.SessionLock
+
+	cliRecipient = flag.String("to", "", "recipient that confirmed the reception (for a multi-recipient session)")
+	flag.Parse()
+	if len(flag.Args()) < 1 {
+		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
+	}
+	sessionName = flag.Arg(0)
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+
+	// Select the delivery states of the recipient.
+	deliveries = session.Deliveries
+	if len(session.Recipients) > 0 {
+		var recipient = session.Recipient(*cliRecipient)
+		if recipient == nil {
+			return fmt.Errorf(`"%s" is not a recipient of the session "%s" (use --to)`, *cliRecipient, sessionName)
+		}
+		deliveries = recipient.Deliveries
+	}
+
+	// By default, all the emails sent are confirmed.
+	for _, arg := range flag.Args()[1:] {
+		var index int
+		if index, err = strconv.Atoi(arg); err != nil {
+			return fmt.Errorf(`invalid boundary index "%s"`, arg)
+		}
+		indexes = append(indexes, index)
+	}
+	if len(indexes) == 0 {
+		for i := range deliveries {
+			if deliveries[i].Status == umailData.DeliverySent {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	for _, index := range indexes {
+		if err = deliveries.SetConfirmed(index); err != nil {
+			return err
+		}
+	}
+	if err = saveSession(sessionName, &session); err != nil {
+		return err
+	}
+	fmt.Printf("Number of emails confirmed: %d\n", len(indexes))
+	return nil
+}
+
+func procesSessionReset() error {
+	var err error
+	var sessionName string
+	var session umailData.Session
+	var lock *umailData.SessionLock
+
+	if len(os.Args) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(os.Args))
+	}
+	sessionName = os.Args[1]
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	session.Rewind()
+	return saveSession(sessionName, &session)
+}
+
+func processMigrateSession() error {
+	var err error
+	var sessionNames []string
+
+	if len(os.Args) > 1 {
+		sessionNames = os.Args[1:]
+	} else {
+		if sessionNames, err = sessionStore.ListSessions(); err != nil {
+			return fmt.Errorf(`cannot list the sessions: %s`, err.Error())
+		}
+	}
+
+	for _, sessionName := range sessionNames {
+		if err = migrateSession(sessionName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateSession Saves a session using the current version of the session files, unless it is up to date. The session
+// is locked while it is migrated.
+func migrateSession(sessionName string) error {
+	var err error
+	var lock *umailData.SessionLock
+	var session umailData.Session
+
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	if session.LoadedVersion() == session.Version {
+		fmt.Printf("%s: up to date (version %d)\n", sessionName, session.Version)
+		return nil
+	}
+	if err = saveSession(sessionName, &session); err != nil {
+		return err
+	}
+	fmt.Printf("%s: migrated from version %d to version %d\n", sessionName, session.LoadedVersion(), session.Version)
+	return nil
+}
+
+func processPoolReset() error {
+	var err error
+	var cliPoolName string
+	var cliPoolPointerPosition int64
+	var cliReceiver bool
+	var poolPath string
+	var pool resource.KeySource
+	var editor resource.KeyEditor
+
+	// Parse the command line: reset-key [--receiver] <key name> <position>
+	flag.BoolVar(&cliReceiver, "receiver", false, "set the receiver's cursor of the key (the position of the key material of the next message to decode), instead of the position pointer")
+	flag.Parse()
+	if len(flag.Args()) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 2)`, len(flag.Args()))
+	}
+	cliPoolName = flag.Arg(0)
+	if cliPoolPointerPosition, err = strconv.ParseInt(flag.Arg(1), 10, 64); err != nil {
+		return fmt.Errorf(`invalid position (%s)`, flag.Arg(1))
+	}
+	poolPath = filepath.Join(keyDir, cliPoolName)
+	if pool, editor, err = openKeyEditor(poolPath); err != nil {
+		return err
+	}
+	defer pool.Close()
+	if cliReceiver {
+		if cursor, ok := pool.(resource.ReceiverCursor); ok {
+			return cursor.SetReceiverPosition(cliPoolPointerPosition)
+		}
+		return fmt.Errorf(`the key "%s" has no receiver's cursor`, cliPoolName)
+	}
+	if err = editor.SetPositionToFile(cliPoolPointerPosition); err != nil {
+		return fmt.Errorf(`cannot set the value of the position pointer's position: %s`, err.Error())
+	}
+	return nil
+}
+
+func processPoolInfo() error {
+	var err error
+	var cliPoolName string
+	var poolPath string
+	var pool resource.KeySource
+	var protected bool
+	var info *umailData.KeyInfo
+
+	if len(os.Args) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 2)`, len(os.Args))
+	}
+	cliPoolName = os.Args[1]
+	poolPath = filepath.Join(keyDir, cliPoolName)
+	if protected, err = resource.IsProtected(poolPath); err != nil {
+		return fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
+	}
+	if pool, err = resource.Open(poolPath); err != nil {
+		return fmt.Errorf(`cannot open key file "%s": %s`, poolPath, err)
+	}
+	defer pool.Close()
+	fmt.Printf("file: \"%s\"\n", poolPath)
+	fmt.Printf("protected: %t\n", protected)
+	if info, err = sessionStore.ReadKeyInfo(cliPoolName); err == nil {
+		fmt.Printf("created: %s\n", formatDate(info.Created))
+		fmt.Printf("origin: %s\n", info.Origin)
+	} else if !errors.Is(err, umailData.ErrNotFound) {
+		return fmt.Errorf(`cannot read the metadata of the key "%s": %s`, cliPoolName, err.Error())
+	}
+	fmt.Printf("current read position: %d\n", pool.Position())
+	if cursor, ok := pool.(resource.ReceiverCursor); ok {
+		if receiver, set := cursor.ReceiverPosition(); set {
+			fmt.Printf("receiver's cursor: %d\n", receiver)
+		} else {
+			fmt.Printf("receiver's cursor: none (the messages are decoded from the current read position)\n")
+		}
+	}
+	return nil
+}
+
+// readPassphrase Prompts for a passphrase. The passphrase is not echoed if the standard input is a terminal.
+func readPassphrase(prompt string) ([]byte, error) {
+	var err error
+	var passphrase []byte
+	var c = make([]byte, 1)
+
+	fmt.Print(prompt + " ")
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		passphrase, err = term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Printf("\n")
+		return passphrase, err
+	}
+	// Read one byte at a time, so that the following lines are left into the standard input.
+	for {
+		if _, err = os.Stdin.Read(c); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if c[0] == '\n' {
+			break
+		}
+		passphrase = append(passphrase, c[0])
+	}
+	return bytes.TrimRight(passphrase, "\r"), nil
+}
+
+// readNewPassphrase Prompts for a new (non-empty) passphrase, twice.
+func readNewPassphrase() ([]byte, error) {
+	var err error
+	var passphrase []byte
+	var confirmation []byte
+
+	if passphrase, err = readPassphrase("Enter the passphrase:"); err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf(`the passphrase must not be empty`)
+	}
+	if confirmation, err = readPassphrase("Confirm the passphrase:"); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, confirmation) {
+		return nil, fmt.Errorf(`the passphrases do not match`)
+	}
+	return passphrase, nil
+}
+
+// readSessionSecret Returns the secret used to protect a session: the content of a key file (if a path is given), or a
+// new passphrase.
+func readSessionSecret(keyFilePath string) ([]byte, error) {
+	var err error
+	var secret []byte
+
+	if len(keyFilePath) == 0 {
+		return readNewPassphrase()
+	}
+	if secret, err = os.ReadFile(keyFilePath); err != nil {
+		return nil, fmt.Errorf(`cannot read the key file "%s": %s`, keyFilePath, err.Error())
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf(`the key file "%s" is empty`, keyFilePath)
+	}
+	return secret, nil
+}
+
+func processProtectKey() error {
+	var err error
+	var cliPoolName string
+	var poolPath string
+	var passphrase []byte
+
+	if len(os.Args) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(os.Args)-1)
+	}
+	cliPoolName = os.Args[1]
+	poolPath = filepath.Join(keyDir, cliPoolName)
+	if passphrase, err = readNewPassphrase(); err != nil {
+		return err
+	}
+	if err = resource.Protect(poolPath, passphrase); err != nil {
+		return fmt.Errorf(`cannot protect the key "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
+	}
+	fmt.Printf("The key \"%s\" is protected (the plain key file has been shredded).\n", cliPoolName)
+	return nil
+}
+
+func processUnprotectKey() error {
+	var err error
+	var cliPoolName string
+	var poolPath string
+	var passphrase []byte
+
+	if len(os.Args) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(os.Args)-1)
+	}
+	cliPoolName = os.Args[1]
+	poolPath = filepath.Join(keyDir, cliPoolName)
+	if passphrase, err = readPassphrase("Enter the passphrase:"); err != nil {
+		return err
+	}
+	if err = resource.Unprotect(poolPath, passphrase); err != nil {
+		return fmt.Errorf(`cannot unprotect the key "%s" (%s): %s`, cliPoolName, poolPath, err.Error())
+	}
+	return nil
+}
+
+func processProtectSession() error {
+	var err error
+	var cliKeyFilePath *string
+	var sessionName string
+	var session umailData.Session
+	var secret []byte
+	var lock *umailData.SessionLock
+
+	cliKeyFilePath = flag.String("key-file", "", "path to a file used as secret (instead of a passphrase)")
+	flag.Parse()
+	if len(flag.Args()) != 1 {
+		return fmt.Errorf("invalid command line: wrong number of arguments (%d)", len(flag.Args()))
+	}
+	sessionName = flag.Arg(0)
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	if secret, err = readSessionSecret(*cliKeyFilePath); err != nil {
+		return err
+	}
+	if err = session.Protect(secret); err != nil {
+		return err
+	}
+	if err = saveSession(sessionName, &session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func processUnprotectSession() error {
+	var err error
+	var sessionName string
+	var session umailData.Session
+	var lock *umailData.SessionLock
+
+	if len(os.Args) != 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1)`, len(os.Args)-1)
+	}
+	sessionName = os.Args[1]
+	if lock, err = lockSession(sessionName); err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err = loadSession(sessionName, &session); err != nil {
+		return err
+	}
+	session.Unprotect()
+	if err = saveSession(sessionName, &session); err != nil {
+		return err
+	}
+	return nil
+}
+
+// retrieveEmailMessages Retrieves the envelope, the header, the body and the whole content of the emails identified by
+// their sequence numbers. The emails are not marked as read (see `markImapEmailsRead`).
+func retrieveEmailMessages(imapClient *imapclient.Client, seqSet imap.SeqSet) ([]*imapclient.FetchMessageBuffer, error) {
+	var err error
+	var fetchOptions *imap.FetchOptions
+	var messages []*imapclient.FetchMessageBuffer
+
+	fetchOptions = &imap.FetchOptions{
+		Flags:    true,
+		Envelope: true,
+		UID:      true,
+		BodySection: []*imap.FetchItemBodySection{
+			{Specifier: imap.PartSpecifierHeader, Peek: true},
+			{Specifier: imap.PartSpecifierText, Peek: true},
+			{Specifier: imap.PartSpecifierNone, Peek: true},
+		},
+	}
+	if messages, err = imapClient.Fetch(seqSet, fetchOptions).Collect(); nil != err {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// retrieveEmailBodies Retrieves the envelope, the header and the body of the emails identified by their UIDs. The
+// emails are not marked as read (see `markImapEmailsRead`).
+func retrieveEmailBodies(imapClient *imapclient.Client, uidSet imap.SeqSet) ([]*imapclient.FetchMessageBuffer, error) {
+	var fetchOptions = &imap.FetchOptions{
+		Flags:    true,
+		Envelope: true,
+		UID:      true,
+		BodySection: []*imap.FetchItemBodySection{
+			{Specifier: imap.PartSpecifierHeader, Peek: true},
+			{Specifier: imap.PartSpecifierText, Peek: true},
+		},
+	}
+
+	return imapClient.UIDFetch(uidSet, fetchOptions).Collect()
+}
+
+// retrieveEmailHeaders Retrieves the envelope and the header of the emails identified by their sequence numbers. The
+// emails are not marked as read.
+func retrieveEmailHeaders(imapClient *imapclient.Client, seqSet imap.SeqSet) ([]*imapclient.FetchMessageBuffer, error) {
+	var fetchOptions = &imap.FetchOptions{
+		Flags:    true,
+		Envelope: true,
+		UID:      true,
+		BodySection: []*imap.FetchItemBodySection{
+			{Specifier: imap.PartSpecifierHeader, Peek: true},
+		},
+	}
+
+	return imapClient.Fetch(seqSet, fetchOptions).Collect()
+}
+
+// retrieveHeaderBoundary Returns the boundary given by the header of an email retrieved by `retrieveEmailHeaders` (nil
+// if there is none: the email does not hide anything).
+func retrieveHeaderBoundary(message *imapclient.FetchMessageBuffer) (*string, error) {
+	return umailData.RawHeaderBoundary([]byte(messageText(message)))
+}
+
+// parseMessage Parse a given message and return a data structure that represents the message: header and body.
+func parseMessage(message *imapclient.FetchMessageBuffer) (*mail.Message, error) {
+	var err error
+	var m *mail.Message
+
+	m, err = mail.ReadMessage(strings.NewReader(messageText(message)))
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// messageText Returns the text of a given message (RFC 5322): its header and its body.
+func messageText(message *imapclient.FetchMessageBuffer) string {
+	var email = Email{Body: "", Header: ""}
+
+	for data, buf := range message.BodySection {
+		if "HEADER" == data.Specifier {
+			email.Header = string(buf)
+		}
+		if "TEXT" == data.Specifier {
+			email.Body = string(buf)
+		}
+	}
+	return fmt.Sprintf("%s\r\n\r\n%s", email.Header, email.Body)
+}
+
+func retrieveBoundaries(message *imapclient.FetchMessageBuffer) ([]string, error) {
+	return receiveCarriers.EmailBoundaries([]byte(messageText(message)))
+}
+
+// setReceiveCarriers Sets the carriers of the emails received (see `receiveCarriers`), given as to "create-session
+// --carriers". The boundary only is used if none is given. The key of the keyed carriers (see
+// `umailData.Carrier.IsKeyed`) is derived from a given key (`codebookKey`), at `position` (see `keyCodebook`).
+func setReceiveCarriers(spec string, codebookKey string, position int64) error {
+	var err error
+	var key string
+
+	receiveCarriers = nil
+	if len(spec) == 0 {
+		return nil
+	}
+	if receiveCarriers, err = umailData.ParseCarriers(spec, false); err != nil {
+		return err
+	}
+	if receiveCarriers.IsKeyed() {
+		if len(codebookKey) == 0 {
+			return fmt.Errorf(`the codebook of the subjects is derived from the key of the sender: the name of the key must be given (--codebook)`)
+		}
+		if key, err = keyCodebook(codebookKey, position); err != nil {
+			return err
+		}
+		receiveCarriers.SetKey(key)
+	}
+	return nil
+}
+
+// printEmailSummary Prints the envelope of an email that has a boundary.
+func printEmailSummary(index emailIndex, date time.Time, subject string, from string, to []string, cc []string, boundaries []string) {
+	fmt.Printf("[%4d] %s (%d)\n", index, date.String(), date.Unix())
+	fmt.Printf("       Subject: %s\n", subject)
+	fmt.Printf("       From: %s\n", from)
+	fmt.Printf("       To: %s\n", strings.Join(to, ", "))
+	if len(cc) > 0 {
+		fmt.Printf("       Cc: %s\n", strings.Join(cc, ", "))
+	}
+	for _, boundary := range boundaries {
+		fmt.Printf("       Boundary: %s\n", boundary)
+	}
+	fmt.Printf("\n")
+}
+
+// retrieveFullEmail Retrieves an email identified by its sequence number.
+func retrieveFullEmail(messages []*imapclient.FetchMessageBuffer) (*string, error) {
+	var err error
+	var content []string
+	var result string
+
+	for i, message := range messages {
+		var m *mail.Message
+		var header mail.Header
+		var body []byte
+
+		if m, err = parseMessage(message); err != nil {
+			return nil, err
+		}
+
+		content = append(content, fmt.Sprintf("       [%0d] UID:%05d", i, message.UID))
+		content = append(content, []string{fmt.Sprintf("           Flags: %v", message.Flags), ""}...)
+
+		header = m.Header
+		for k, v := range header {
+			content = append(content, fmt.Sprintf("* %s: %s", k, v))
+		}
+
+		body, err = io.ReadAll(m.Body)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, string(body))
+	}
+
+	result = strings.Join(content, "\r\n")
+	return &result, nil
+}
+
+// getEmails Asks for the emails to process, among the candidates (see `umailData.ParseEmailSelection`: "1 3 7-9",
+// "1,3,7-9" or "all"). An invalid selection is asked for again. It returns nil if the user gave up.
+func getEmails(candidates map[emailIndex]emailCandidate) ([]emailIndex, error) {
+	var err error
+	var response string
+	var listed = candidateIndexes(candidates)
+	var emails []emailIndex
+	var reader = bufio.NewReader(os.Stdin)
+
+	fmt.Printf("List of emails to process (for example \"1 3 7-9\", or \"all\", type 'x' to quit):\n")
+	for {
+		response, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		response = strings.ToLower(strings.TrimSpace(response))
+		if response == "x" {
+			return nil, nil
+		}
+		if emails, err = umailData.ParseEmailSelection(response, listed); err != nil {
+			fmt.Printf("Invalid selection: %s. Try again (type 'x' to quit):\n", err.Error())
+			continue
+		}
+		return emails, nil
+	}
+}
+
+// candidateIndexes Returns the indexes of the candidates, in increasing order.
+func candidateIndexes(candidates map[emailIndex]emailCandidate) []emailIndex {
+	var indexes []emailIndex
+
+	for index := range candidates {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i] < indexes[j]
+	})
+	return indexes
+}
+
+func getYesNo(message string) (*bool, error) {
+	var err error
+	var response string
+	var reader = bufio.NewReader(os.Stdin)
+	var result bool
+
+	fmt.Print(message + " ")
+	for {
+		response, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		response = strings.ToLower(response)
+		response = strings.TrimSpace(response)
+		if response != "y" && response != "n" {
+			fmt.Printf("Invalid response (%s). Valid response: \"y\" or \"n\"\n", response)
+			continue
+		}
+		break
+	}
+	result = response == "y"
+	return &result, nil
+}
+
+func getKey(message string) (resource.KeySource, string, error) {
+	var err error
+	var reader = bufio.NewReader(os.Stdin)
+	var pool resource.KeySource
+	var poolName string
+
+	fmt.Print(message + " ")
+	for {
+		var poolPath string
+
+		poolName, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, "", err
+		}
+		poolName = strings.TrimSpace(poolName)
+		poolPath = filepath.Join(keyDir, poolName)
+		if pool, err = resource.Open(poolPath); err != nil {
+			fmt.Printf("Cannot open the key \"%s\" (path: %s): %s", poolName, poolPath, err.Error())
+			continue
+		}
+		break
+	}
+	return pool, poolName, nil
+}
+
+// decodeOptions How a hidden message is decoded and shown (see `showMessage`).
+type decodeOptions struct {
+	// syncCheck The first boundary is a synchronization preamble, which is checked against the key before the
+	// decryption.
+	syncCheck bool
+	// position The position of the key material used by the message, or -1 (see `openDecodeKey`).
+	position int64
+	// advance The receiver's cursor of the key is moved past the key material of the message, once decrypted.
+	advance bool
+	// output The file the message is written into (see `printHiddenMessage`), if any.
+	output string
+	// hooks What is done once the message has been fully decoded (see `runDecodeHooks`).
+	hooks umailData.DecodeHooks
+	// requireMac A message without MAC is rejected (see `umailData.CheckAuthenticated`).
+	requireMac bool
+}
+
+// showMessage Decrypts the boundaries and prints the hidden message. Each element of `boundaries` gives the boundaries
+// of an email: the boundaries of a nested email are joined, from the outermost to the innermost.
+func showMessage(boundaries [][]string, options decodeOptions) (*string, error) {
+	var err error
+	var key resource.KeySource
+	var pool resource.KeySource
+	var keyName string
+	var boundariesBytes [][]byte
+	var hiddenMessage []byte
+	var authenticated bool
+	var length int
+	var end int64
+	var incomplete *umailData.IncompleteError
+	var syncPoint umailData.SyncPoint
+
+	// Load the pool.
+	if key, pool, keyName, err = openDecodeKey(options.position); err != nil {
+		return nil, err
+	}
+	defer key.Close()
+
+	// Convert all boundaries into bytes.
+	for _, levels := range boundaries {
+		var boundaryBytes []byte
+		if boundaryBytes, err = parseBoundaryLevels(levels); err != nil {
+			return nil, err
+		}
+		boundariesBytes = append(boundariesBytes, boundaryBytes)
+		length += len(boundaryBytes)
+	}
+
+	// Check the synchronization of the key.
+	if options.syncCheck {
+		if len(boundariesBytes) < 2 {
+			return nil, fmt.Errorf(`the synchronization preamble must be followed by (at least) one email`)
+		}
+		if pool, syncPoint, err = syncedKey(boundariesBytes[0], pool); err != nil {
+			return nil, err
+		}
+		fmt.Printf("The key is synchronized with the sender's one (position: %d).\n", syncPoint.Position)
+		boundariesBytes = boundariesBytes[1:]
+	}
+
+	// Decrypt all boundaries.
+	if hiddenMessage, authenticated, end, err = umailData.DecodeExtent(boundariesBytes, pool); err != nil {
+		if errors.As(err, &incomplete) {
+			printPartialMessage(incomplete)
+			return nil, fmt.Errorf(`the hidden message is incomplete: %s`, err.Error())
+		}
+		return nil, decodeError(err, length)
+	}
+	if err = umailData.CheckAuthenticated(authenticated, options.requireMac); err != nil {
+		return nil, decodeError(err, length)
+	}
+	if err = recordKeyRange(keyName, pool.Position(), end, hiddenMessage); err != nil {
+		return nil, err
+	}
+	if err = printHiddenMessage(hiddenMessage, authenticated, options.output); err != nil {
+		return nil, err
+	}
+	runDecodeHooks(options.hooks, hiddenMessage, authenticated, options.output)
+	if options.advance {
+		if options.syncCheck {
+			end = syncPoint.Next(end)
+		}
+		if err = advanceReceiver(key, end); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// syncedKey Checks a synchronization preamble against a key (see `umailData.SyncVerify`), and returns the key source
+// the message is decoded from: the key material that follows the one dedicated to the preamble may be used by the
+// message.
+func syncedKey(preamble []byte, pool resource.KeySource) (resource.KeySource, umailData.SyncPoint, error) {
+	var err error
+	var point umailData.SyncPoint
+	var positioned *resource.PositionedSource
+
+	if point, err = umailData.SyncVerify(preamble, pool); err != nil {
+		return nil, point, err
+	}
+	if positioned, err = resource.AtPosition(pool, point.Position); err != nil {
+		return nil, point, err
+	}
+	return positioned, point, nil
+}
+
+// openDecodeKey Asks for the key used to decode a hidden message. It returns the key (to close), the key source the key
+// material is read from, and the name of the key. The key material is read from `position` if it is not negative, or
+// else from the receiver's cursor of the key (see `resource.ReceiverCursor`), if set. Otherwise, the key material is
+// read from the current position of the key. The position of the key is left untouched (see `resource.AtPosition`).
+func openDecodeKey(position int64) (resource.KeySource, resource.KeySource, string, error) {
+	var err error
+	var pool resource.KeySource
+	var poolName string
+	var positioned *resource.PositionedSource
+
+	if pool, poolName, err = getKey("Enter the name of the key to use:"); err != nil {
+		return nil, nil, "", err
+	}
+	if position >= 0 {
+		fmt.Printf("The key material is read from the position %d (the position of the key is %d).\n", position, pool.Position())
+	} else if cursor, ok := pool.(resource.ReceiverCursor); ok {
+		var set bool
+		if position, set = cursor.ReceiverPosition(); !set {
+			return pool, pool, poolName, nil
+		}
+		fmt.Printf("The key material is read from the receiver's cursor of the key (%d).\n", position)
+	} else {
+		return pool, pool, poolName, nil
+	}
+	if positioned, err = resource.AtPosition(pool, position); err != nil {
+		pool.Close()
+		return nil, nil, "", err
+	}
+	return pool, positioned, poolName, nil
+}
+
+// recordKeyRange Records the range of key material used by a hidden message decoded with a key (from `start` to `end`,
+// see `umailData.ReuseIndex`), and warns if another message has been decoded from the same key material: the sender
+// reused it.
+func recordKeyRange(keyName string, start int64, end int64, hiddenMessage []byte) error {
+	var err error
+	var index *umailData.ReuseIndex
+	var overlaps []umailData.KeyRange
+
+	if index, err = umailData.LoadReuseIndex(filepath.Join(appDir, reuseIndexFileName)); err != nil {
+		return err
+	}
+	overlaps = index.RecordRange(keyName, umailData.KeyRange{Start: start, End: end, Message: umailData.MessageHash(hiddenMessage)})
+	for _, other := range overlaps {
+		fmt.Printf("WARNING: KEY MATERIAL REUSED! The key material of the key \"%s\" from %d to %d has already been used by another message (from %d to %d): the messages are compromised.\n", keyName, start, end, other.Start, other.End)
+	}
+	if len(overlaps) > 0 {
+		fmt.Printf("\n")
+	}
+	return index.Save()
+}
+
+// warnBoundaryReuse Records the boundaries of an email (see `umailData.ReuseIndex`), and warns if another email
+// carried the same boundaries: the sender reused the key material.
+func warnBoundaryReuse(index *umailData.ReuseIndex, email emailIndex, boundaries []string, sent time.Time) {
+	var err error
+	var boundaryBytes []byte
+
+	// The emails whose boundaries are not generated by umail are ignored.
+	if boundaryBytes, err = parseBoundaryLevels(boundaries); err != nil {
+		return
+	}
+	if other, reused := index.RecordBoundary(boundaryBytes, umailData.EmailIdentity(sent)); reused {
+		if otherSent, err := time.Parse(time.RFC3339Nano, other); err == nil {
+			other = formatDate(otherSent)
+		}
+		fmt.Printf("WARNING: KEY MATERIAL REUSED! The email %d (sent: %s) carries the same boundary as another email (sent: %s): the messages are compromised.\n", email, formatDate(sent), other)
+	}
+}
+
+// checkBoundaryReuse Warns about the emails that carry a boundary already seen (see `warnBoundaryReuse`), in the order
+// of their indexes, and records their boundaries. The emails that are pending (see `emailCandidate`) are checked once
+// their bodies are fetched.
+func checkBoundaryReuse(candidates map[emailIndex]emailCandidate) error {
+	var err error
+	var index *umailData.ReuseIndex
+	var emails []emailIndex
+
+	if index, err = umailData.LoadReuseIndex(filepath.Join(appDir, reuseIndexFileName)); err != nil {
+		return err
+	}
+	for email, candidate := range candidates {
+		if !candidate.pending {
+			emails = append(emails, email)
+		}
+	}
+	sort.Slice(emails, func(i, j int) bool {
+		return emails[i] < emails[j]
+	})
+	for _, email := range emails {
+		warnBoundaryReuse(index, email, candidates[email].boundaries, candidates[email].sent)
+	}
+	return index.Save()
+}
+
+// advanceReceiver Moves the receiver's cursor of a key to `position` (the position of the key material that follows a
+// decrypted message), so that the next message is decrypted from there.
+func advanceReceiver(key resource.KeySource, position int64) error {
+	var err error
+	var cursor resource.ReceiverCursor
+	var ok bool
+
+	if cursor, ok = key.(resource.ReceiverCursor); !ok {
+		return fmt.Errorf(`the key has no receiver's cursor`)
+	}
+	if err = cursor.SetReceiverPosition(position); err != nil {
+		return fmt.Errorf(`cannot move the receiver's cursor of the key: %s`, err.Error())
+	}
+	fmt.Printf("The receiver's cursor of the key is now at %d.\n", position)
+	return nil
+}
+
+// decodePosition Returns the position of the key material used by a hidden message, given explicitly (`position`,
+// see "--position"), or by the session file of the sender (`sessionPath`, see "--position-from"). It returns -1 if
+// none is given: the current position of the key is used.
+func decodePosition(position int64, sessionPath string) (int64, error) {
+	var err error
+	var session umailData.Session
+
+	if len(sessionPath) == 0 {
+		if position < -1 {
+			return 0, fmt.Errorf(`invalid position (%d)`, position)
+		}
+		return position, nil
+	}
+	if position >= 0 {
+		return 0, fmt.Errorf(`a position (--position) and a session file (--position-from) cannot be given at once`)
+	}
+	if err = session.Load(sessionPath); err != nil {
+		return 0, fmt.Errorf(`cannot load the session file "%s": %s`, sessionPath, err.Error())
+	}
+	if session.Lazy {
+		return 0, fmt.Errorf(`the session file "%s" is lazy: the key material of its emails is allocated when they are sent, give the position (--position)`, sessionPath)
+	}
+	fmt.Printf("The session file gives the key \"%s\" at %d.\n", session.PoolName, session.PoolPointerPosition)
+	return session.PoolPointerPosition, nil
+}
+
+// keyMarker Returns the marker of the emails of the next hidden message that uses a given key (see
+// `umailData.NewMarker`). The marker is derived from the key material at `position`, or, if -1, at the receiver's
+// cursor of the key (if set), or at the current position of the key.
+func keyMarker(keyName string, position int64) (string, error) {
+	var err error
+	var pool resource.KeySource
+	var marker string
+
+	if pool, position, err = openReceiverKey(keyName, position); err != nil {
+		return "", err
+	}
+	defer pool.Close()
+	if marker, err = umailData.NewMarker(pool, position); err != nil {
+		return "", err
+	}
+	fmt.Printf("Only the emails marked for the key \"%s\" at %d are examined (marker: %s).\n", keyName, position, marker)
+	return marker, nil
+}
+
+// keyCodebook Returns the key of the codebook of the emails of the next hidden message that uses a given key (see
+// `umailData.NewCodebookKey`). The key of the codebook is derived from the key material at `position`, as the marker
+// (see `keyMarker`).
+func keyCodebook(keyName string, position int64) (string, error) {
+	var err error
+	var pool resource.KeySource
+
+	if pool, position, err = openReceiverKey(keyName, position); err != nil {
+		return "", err
+	}
+	defer pool.Close()
+	return umailData.NewCodebookKey(pool, position)
+}
+
+// openReceiverKey Opens a key, and returns the position of the key material of the next hidden message: `position`,
+// or, if -1, the receiver's cursor of the key (if set), or the current position of the key.
+func openReceiverKey(keyName string, position int64) (resource.KeySource, int64, error) {
+	var err error
+	var pool resource.KeySource
+	var keyPath = filepath.Join(keyDir, keyName)
+
+	if pool, err = resource.Open(keyPath); err != nil {
+		return nil, 0, fmt.Errorf(`cannot open key file "%s": %s`, keyPath, err)
+	}
+	if position < 0 {
+		position = pool.Position()
+		if cursor, ok := pool.(resource.ReceiverCursor); ok {
+			if receiver, set := cursor.ReceiverPosition(); set {
+				position = receiver
+			}
+		}
+	}
+	return pool, position, nil
+}
+
+// parseBoundaryLevels Converts the boundaries of an email into bytes: the boundaries of a nested email are joined, from
+// the outermost to the innermost.
+func parseBoundaryLevels(levels []string) ([]byte, error) {
+	var boundaryBytes []byte
+
+	for _, boundary := range levels {
+		var levelBytes []byte
+		var err error
+		if levelBytes, err = umailData.ParseBoundary(boundary); err != nil {
+			return nil, fmt.Errorf(`invalid boundary (invalid email): %s`, err.Error())
+		}
+		boundaryBytes = append(boundaryBytes, levelBytes...)
+	}
+	return boundaryBytes, nil
+}
+
+// decodeError Returns the error to report when boundaries (`length` bytes) cannot be decrypted.
+func decodeError(err error, length int) error {
+	if errors.Is(err, umailData.ErrMissingMac) {
+		return fmt.Errorf(`the hidden message is NOT authentic: %s`, err.Error())
+	}
+	if errors.Is(err, umailData.ErrNotAuthentic) {
+		return fmt.Errorf(`the hidden message is NOT authentic: the MAC does not match (tampered, corrupted or missing emails, or wrong key)`)
+	}
+	return fmt.Errorf(`cannot decrypt the boundaries (needed %d bytes from the key file): %s`, length, err.Error())
+}
+
+// printHiddenMessage Prints a decrypted hidden message, and whether it is authenticated. If `output` is not empty, then
+// the message is written (as is) into this file, which must not exist. Otherwise, a message that is not a printable
+// text (binary content, or control characters that would be interpreted by the terminal) is not printed: only its
+// SHA-256 is.
+func printHiddenMessage(hiddenMessage []byte, authenticated bool, output string) error {
+	var err error
+
+	fmt.Printf("Lenght of the (hidden) message: %d\n", len(hiddenMessage))
+	if authenticated {
+		fmt.Printf("Authenticity: the MAC matches (the message has not been tampered with).\n")
+	} else {
+		fmt.Printf("Authenticity: unknown (the message has no MAC).\n")
+	}
+
+	if len(output) > 0 {
+		if err = umailData.WriteNewFile(output, hiddenMessage); err != nil {
+			return err
+		}
+		fmt.Printf("The hidden message (SHA-256: %s) has been written into \"%s\".\n", umailData.MessageHash(hiddenMessage), output)
+		return nil
+	}
+	if !umailData.IsPrintableText(hiddenMessage) {
+		fmt.Printf("The hidden message is not a printable text (SHA-256: %s): use --output to write it into a file.\n", umailData.MessageHash(hiddenMessage))
+		return nil
+	}
+	fmt.Printf("The hidden message is:\n\n%s\n\n", hiddenMessage)
+	return nil
+}
+
+// runDecodeHooks Runs the hooks (see `umailData.DecodeHooks`) once a hidden message has been fully decoded. Unless the
+// message has been written into a file (`output`), it is written into a temporary file for the command, which is
+// destroyed once the command has been executed. A hook that fails is reported, but the reception goes on.
+func runDecodeHooks(hooks umailData.DecodeHooks, hiddenMessage []byte, authenticated bool, output string) {
+	var err error
+	var path = output
+	var event = umailData.DecodeEvent{Path: output, Length: len(hiddenMessage), Sha256: umailData.MessageHash(hiddenMessage), Authenticated: authenticated, Decoded: time.Now().UTC()}
+
+	if len(strings.TrimSpace(hooks.Command)) > 0 {
+		if len(path) == 0 {
+			if path, err = writeTemporaryMessage(hiddenMessage); err != nil {
+				fmt.Printf("Warning: the command \"%s\" is not executed: %s\n", hooks.Command, err.Error())
+			} else {
+				defer resource.Shred(path, 1)
+			}
+		}
+		if err == nil {
+			if err = hooks.RunCommand(path); err != nil {
+				fmt.Printf("Warning: %s\n", err.Error())
+			}
+		}
+	}
+	if err = hooks.Notify(&http.Client{Timeout: apiTimeout}, event); err != nil {
+		fmt.Printf("Warning: %s\n", err.Error())
+	}
+}
+
+// writeTemporaryMessage Writes a hidden message into a temporary file (only readable by the user), and returns its
+// path.
+func writeTemporaryMessage(hiddenMessage []byte) (string, error) {
+	var err error
+	var fd *os.File
+
+	if fd, err = os.CreateTemp("", "umail-message-*"); err != nil {
+		return "", fmt.Errorf(`cannot create a temporary file: %s`, err.Error())
+	}
+	if _, err = fd.Write(hiddenMessage); err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+		return "", fmt.Errorf(`cannot write the temporary file "%s": %s`, fd.Name(), err.Error())
+	}
+	if err = fd.Close(); err != nil {
+		os.Remove(fd.Name())
+		return "", err
+	}
+	return fd.Name(), nil
+}
+
+// printPartialMessage Prints the part of an incomplete hidden message that could be decoded (the chunks that precede
+// the first missing one), if it is a printable text.
+func printPartialMessage(incomplete *umailData.IncompleteError) {
+	if !incomplete.Sequenced {
+		fmt.Printf("The message is not sequenced: the emails given are assumed to be its first ones, in the order they were sent.\n")
+	}
+	if len(incomplete.Partial) == 0 {
+		fmt.Printf("No part of the hidden message can be decoded (its first email is missing).\n")
+		return
+	}
+	fmt.Printf("Lenght of the part of the (hidden) message decoded: %d\n", len(incomplete.Partial))
+	fmt.Printf("Authenticity: unknown (the message is incomplete).\n")
+	if !umailData.IsPrintableText(incomplete.Partial) {
+		fmt.Printf("The part of the hidden message decoded is not a printable text (SHA-256: %s).\n", umailData.MessageHash(incomplete.Partial))
+		return
+	}
+	fmt.Printf("The part of the hidden message decoded is:\n\n%s\n\n", incomplete.Partial)
+}
+
+func processGetFullEmails() error {
+	var err error
+	var user string
+	var password string
+	var imapServerAddress string
+	var imapServerPort int
+	var from string
+	var full bool
+	var markRead bool
+	var showMailboxes bool
+	var decoding = decodeOptions{position: -1}
+	var positionFrom string
+	var connect connectOptions
+	var caFile string
+	var transport string
+	var timeouts umailData.Timeouts
+	var batching umailData.Batching
+	var since string
+	var dayRange string
+	var header string
+	var markerKey string
+	var filter umailData.EmailFilter
+	var window umailData.EmailWindow
+	var action umailData.ProcessedAction
+	var dryRun bool
+	var rescan bool
+	var watch bool
+	var oauth bool
+	var jmapSessionURL string
+	var saveProfile bool
+	var profiles *umailData.ProfileStore
+	var given = map[string]bool{}
+	var mailbox string
+	var accountNames accountFlags
+	var allAccounts bool
+	var explicitAccounts bool
+	var accounts []receiveAccount
+	var options receiveOptions
+	var cache *umailData.MailboxCache
+	var receptions []*receivedEmails
+	var candidates map[emailIndex]emailCandidate
+	var origins map[emailIndex]emailOrigin
+	var fetch func([]emailIndex) error
+	var emails []emailIndex
+	var listing umailData.EmailListing
+	var carriers string
+	var codebookKey string
+	var stdout = os.Stdout
+
+	// Parse the command line.
+	flag.StringVar(&imapServerAddress, "imap", DefaultImapServerAddress, fmt.Sprintf("address of the IMAP server, or of the POP3 server (default: %s)", DefaultImapServerAddress))
+	flag.IntVar(&imapServerPort, "port", DefaultImapServerPort, fmt.Sprintf("server port number (default: %d, or %d for POP3)", DefaultImapServerPort, umailData.DefaultPop3Port))
+	flag.StringVar(&user, "user", "", "IMAP or POP3 user (or, for the Gmail and Microsoft Graph APIs, the address whose OAuth2 token is used)")
+	flag.StringVar(&password, "password", "", "password used for authentication (JMAP: the API token)")
+	flag.BoolVar(&oauth, "oauth", false, "authenticate using the OAuth2 token of the user (see \"oauth-login\") instead of a password (IMAP XOAUTH2)")
+	flag.StringVar(&from, "from", "", "sender email address")
+	flag.StringVar(&since, "since", "", "only the emails received since a given day (YYYY-MM-DD)")
+	flag.StringVar(&dayRange, "range", "", "only the emails received from a day (included) to another one (excluded): YYYY-MM-DD..YYYY-MM-DD (one of the days may be omitted)")
+	flag.IntVar(&window.Last, "last", 0, "only examine the given number of most recent emails (among the ones that match the criteria)")
+	flag.IntVar(&window.Page, "page", 0, "only examine a page of emails (among the ones that match the criteria): 1 for the most recent ones, 2 for the previous ones...")
+	flag.IntVar(&window.PageSize, "page-size", 50, "number of emails per page (see --page)")
+	flag.StringVar(&filter.Subject, "subject", "", "only the emails whose subject contains a given text")
+	flag.StringVar(&header, "header", "", `only the emails that have a given header, whose value contains a given text ("Name: text")`)
+	flag.StringVar(&markerKey, "marker", "", `name of a key: only the emails marked for the next hidden message that uses the key (see "create-session --marker")`)
+	flag.BoolVar(&full, "full", false, "print all the email (not only the envelope)")
+	flag.BoolVar(&markRead, "mark-read", false, "mark the emails examined that have a boundary as read (IMAP: by default, the emails are left unread)")
+	flag.BoolVar(&showMailboxes, "show-mailboxes", false, "list the mailboxes")
+	flag.StringVar(&mailbox, "mailbox", umailData.DefaultMailbox(), fmt.Sprintf(`mailbox the emails are received in (for example "[Gmail]/All Mail", default: "INBOX", or the value of the environment variable %s)`, umailData.MailboxEnv))
+	flag.StringVar(&action.Mailbox, "move-to", os.Getenv(processedMailboxEnv), fmt.Sprintf(`once the hidden message has been shown, move its emails to a mailbox (IMAP, default: the value of the environment variable %s)`, processedMailboxEnv))
+	flag.StringVar(&action.Keyword, "keyword", os.Getenv(processedKeywordEnv), fmt.Sprintf(`once the hidden message has been shown, mark its emails with a keyword, and skip the emails marked with it (IMAP, for example "$Decoded", default: the value of the environment variable %s)`, processedKeywordEnv))
+	flag.BoolVar(&action.Delete, "delete-after-decode", false, "once the hidden message has been shown, delete its emails from the server (IMAP, after confirmation)")
+	flag.BoolVar(&dryRun, "dry-run", false, "only print the emails that would be deleted (see --delete-after-decode)")
+	flag.BoolVar(&rescan, "rescan", false, "fetch all the emails of the inbox, not only the ones received since the last reception (IMAP)")
+	flag.BoolVar(&watch, "watch", false, "wait for the emails of the sender (IMAP IDLE), and print the hidden message once all its emails have arrived")
+	flag.BoolVar(&decoding.syncCheck, "sync-check", false, "the first selected email is a synchronization preamble (see \"send --sync\")")
+	flag.Int64Var(&decoding.position, "position", -1, "position of the key material used by the hidden message, instead of the current position of the key (which is left untouched)")
+	flag.StringVar(&positionFrom, "position-from", "", "session file shared by the sender: the position of the key material used by the hidden message is the one of the session (see --position)")
+	flag.BoolVar(&decoding.advance, "advance", false, "once the hidden message is shown, move the receiver's cursor of the key past the key material of the message: the next message is decoded from there")
+	flag.BoolVar(&decoding.requireMac, "require-mac", false, "reject a hidden message that has no MAC (see \"create-session --mac\"): without it, a message whose MAC has been stripped is only reported as not authenticated")
+	flag.StringVar(&decoding.output, "output", "", "write the hidden message (as is) into a file, which must not exist, instead of printing it")
+	flag.StringVar(&decoding.hooks.Command, "exec", os.Getenv(decodeExecEnv), fmt.Sprintf(`once the hidden message is decoded, execute a command, given the path of a file that contains the message as its last argument (default: the value of the environment variable %s)`, decodeExecEnv))
+	flag.StringVar(&decoding.hooks.Webhook, "webhook", os.Getenv(decodeWebhookEnv), fmt.Sprintf(`once the hidden message is decoded, post its description (JSON, without the message) to a URL (default: the value of the environment variable %s)`, decodeWebhookEnv))
+	flag.StringVar(&connect.pin, "pin", "", "SHA-256 of the public key of the IMAP server (hexadecimal): the certificate of the server is not verified, but its public key must match")
+	flag.BoolVar(&connect.insecure, "insecure", false, "do not verify the certificate of the IMAP server (not recommended)")
+	flag.StringVar(&caFile, "ca-file", "", "file that contains the certificates (PEM) of the authorities trusted to sign the certificate of the server, instead of the ones of the system")
+	flag.StringVar(&connect.proxy, "proxy", "", `URL of a SOCKS5 proxy the connection to the IMAP (or POP3) server goes through ("socks5://[user:password@]host:port", for example Tor)`)
+	flag.BoolVar(&connect.startTls, "starttls", false, fmt.Sprintf("connect to the IMAP server in clear, and upgrade the connection using STARTTLS (default port: %d) instead of using implicit TLS", DefaultImapStartTlsPort))
+	flag.DurationVar(&timeouts.Dial, "dial-timeout", umailData.DefaultTimeouts.Dial, "maximum time to connect to the IMAP server (0: no timeout)")
+	flag.DurationVar(&timeouts.Command, "command-timeout", umailData.DefaultTimeouts.Command, "maximum time the IMAP server may stay silent while a reply is expected (0: no timeout)")
+	flag.IntVar(&batching.Size, "batch-size", umailData.DefaultBatching.Size, "maximum number of emails fetched by a single IMAP request")
+	flag.IntVar(&batching.Workers, "workers", umailData.DefaultBatching.Workers, "maximum number of fetched emails processed at the same time")
+	flag.StringVar(&transport, "transport", transportImap, fmt.Sprintf(`how the emails are retrieved: "%s", "%s", "%s", "%s" (Gmail API) or "%s" (Microsoft Graph API), using the OAuth2 token of the user for the APIs`, transportImap, umailData.TransportPop3, umailData.TransportJmap, umailData.TransportGmail, umailData.TransportGraph))
+	flag.StringVar(&transport, "protocol", transportImap, "same as --transport")
+	flag.StringVar(&jmapSessionURL, "jmap", umailData.DefaultJmapSessionURL, fmt.Sprintf("URL of the JMAP session resource (default: %s)", umailData.DefaultJmapSessionURL))
+	flag.BoolVar(&saveProfile, "save-profile", false, "record the transport, the server and the mailbox given for the user: the next receptions for this user use them by default")
+	flag.Var(&accountNames, "account", `user of an account the emails are received from, instead of --user (can be repeated): the emails of all the accounts are examined at once, using their profiles (see --save-profile)`)
+	flag.BoolVar(&allAccounts, "all-accounts", false, "receive the emails of all the accounts whose profiles are recorded (see --account)")
+	flag.BoolVar(&listing.List, "list", false, "only list the emails that have a boundary, without asking for the emails to process (the state of the mailbox is not recorded)")
+	flag.BoolVar(&listing.Json, "json", false, "print the emails listed (see --list) as JSON, on the standard output (the other messages are printed on the standard error)")
+	flag.StringVar(&listing.Selection, "select", "", `emails to process, instead of asking for them (for example "1 3 7-9", "1,3,7-9" or "all", see --list): the selection is not confirmed`)
+	flag.StringVar(&carriers, "carriers", "", `parts of the emails that hide the message, as given to the sender (see "create-session --carriers", default: the boundary only)`)
+	flag.StringVar(&codebookKey, "codebook", "", `name of a key: the subjects of the emails are read using the codebook of the next hidden message that uses the key (see "--carriers=subject")`)
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	if decoding.position, err = decodePosition(decoding.position, positionFrom); err != nil {
+		return err
+	}
+	if err = setReceiveCarriers(carriers, codebookKey, decoding.position); err != nil {
+		return err
+	}
+	if err = listing.Validate(watch); err != nil {
+		return err
+	}
+
+	// The profile of each account gives the values of the options that are not given.
+	if profiles, err = umailData.LoadProfileStore(filepath.Join(appDir, profileFileName)); err != nil {
+		return err
+	}
+	if saveProfile {
+		if len(accountNames) > 0 || allAccounts {
+			return fmt.Errorf(`a profile is recorded for a single user (--user): "--account" and "--all-accounts" cannot be given`)
+		}
+		if err = saveReceiveProfile(profiles, user, transport, imapServerAddress, imapServerPort, jmapSessionURL, mailbox, connect.proxy, given); err != nil {
+			return err
+		}
+	}
+	if allAccounts {
+		if len(accountNames) > 0 {
+			return fmt.Errorf(`the options "--account" and "--all-accounts" are mutually exclusive`)
+		}
+		if accountNames = profiles.Accounts(); len(accountNames) == 0 {
+			return fmt.Errorf(`no profile is recorded (see "--save-profile")`)
+		}
+	}
+	if explicitAccounts = len(accountNames) > 0; explicitAccounts {
+		if len(user) > 0 || len(password) > 0 {
+			return fmt.Errorf(`the accounts are given by "--account" (or "--all-accounts"): "--user" and "--password" cannot be given`)
+		}
+		if watch || showMailboxes {
+			return fmt.Errorf(`the emails of several accounts cannot be waited for (--watch), nor their mailboxes listed (--show-mailboxes)`)
+		}
+	} else {
+		accountNames = []string{user}
+	}
+	for _, name := range accountNames {
+		var account = receiveAccount{user: name, password: password, transport: transport, server: imapServerAddress, port: imapServerPort, portGiven: given["port"], jmap: jmapSessionURL, mailbox: mailbox, connect: connect}
+		if profile, ok := profiles.Get(name); ok {
+			account.applyProfile(profile, given)
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err = timeouts.Validate(); err != nil {
+		return err
+	}
+	if err = batching.Validate(); err != nil {
+		return err
+	}
+	filter.From = from
+	if len(since) > 0 && len(dayRange) > 0 {
+		return fmt.Errorf(`a day and a range of days cannot be given at once: use "--range=%s.."`, since)
+	}
+	if len(since) > 0 {
+		if filter.Since, err = umailData.ParseDay(since); err != nil {
+			return err
+		}
+	}
+	if len(dayRange) > 0 {
+		if filter.Since, filter.Before, err = umailData.ParseDayRange(dayRange); err != nil {
+			return err
+		}
+	}
+	if err = window.Validate(); err != nil {
+		return err
+	}
+	if err = action.Validate(); err != nil {
+		return err
+	}
+	if err = decoding.hooks.Validate(); err != nil {
+		return err
+	}
+	if dryRun && !action.Delete {
+		return fmt.Errorf(`a dry run only applies to the deletion of the emails (--delete-after-decode)`)
+	}
+	if len(caFile) > 0 {
+		if connect.roots, err = umailData.LoadCaFile(caFile); err != nil {
+			return err
+		}
+		for i := range accounts {
+			accounts[i].connect.roots = connect.roots
+		}
+	}
+	if oauth && len(password) > 0 {
+		return fmt.Errorf(`the options "--password" and "--oauth" are mutually exclusive`)
+	}
+	filter.SkipKeyword = action.Keyword
+	if len(header) > 0 {
+		if filter.HeaderName, filter.HeaderValue, err = umailData.ParseHeaderCriterion(header); err != nil {
+			return err
+		}
+	}
+	if len(markerKey) > 0 {
+		if filter.Marker, err = keyMarker(markerKey, decoding.position); err != nil {
+			return err
+		}
+	}
+	if cache, err = umailData.LoadMailboxCache(filepath.Join(appDir, mailboxCacheFileName)); err != nil {
+		return err
+	}
+	options = receiveOptions{timeouts: timeouts, batching: batching, oauth: oauth, filter: filter, window: window, action: action, dryRun: dryRun, full: full, markRead: markRead, showMailboxes: showMailboxes, rescan: rescan, watch: watch, decoding: decoding, cache: cache}
+
+	// The JSON is the only content of the standard output.
+	if listing.Json {
+		os.Stdout = os.Stderr
+		defer func() {
+			os.Stdout = stdout
+		}()
+	}
+
+	// The passwords of the accounts given by "--account" (or "--all-accounts") are asked for.
+	if explicitAccounts {
+		for i := range accounts {
+			if err = accounts[i].askPassword(oauth); err != nil {
+				return err
+			}
+		}
+	}
+	for _, account := range accounts {
+		var received *receivedEmails
+
+		if len(accounts) > 1 {
+			fmt.Printf("ACCOUNT \"%s\":\n\n", account.user)
+		}
+		// The watch only returns when it is interrupted.
+		if received, err = listAccountEmails(account, options); err != nil || watch {
+			return err
+		}
+		receptions = append(receptions, received)
+	}
+	candidates, origins = mergeCandidates(receptions)
+	if len(candidates) > 0 {
+		if err = checkBoundaryReuse(candidates); err != nil {
+			return err
+		}
+	}
+	if listing.List {
+		if listing.Json {
+			return printCandidatesJson(stdout, candidates, origins, receptions)
+		}
+		return nil
+	}
+	if len(candidates) == 0 {
+		fmt.Printf("No new email has a boundary.\n")
+		return recordMailboxStates(cache, receptions, window)
+	}
+	fetch = func(emails []emailIndex) error {
+		return fetchSelectedEmails(emails, candidates, origins, receptions, options)
+	}
+	if emails, err = selectHiddenMessage(candidates, decoding, listing.Selection, fetch); err != nil || emails == nil {
+		return err
+	}
+	if !action.IsEmpty() {
+		for r, received := range receptions {
+			var uids []uint32
+			for _, index := range emails {
+				if origins[index].reception == r {
+					uids = append(uids, received.uids[origins[index].index])
+				}
+			}
+			if len(uids) == 0 {
+				continue
+			}
+			if err = processImapEmails(received.account.server, received.account.port, received.account.connect, timeouts, received.account.user, received.account.password, oauth, received.account.mailbox, uids, action, dryRun); err != nil {
+				return err
+			}
+		}
+	}
+	return recordMailboxStates(cache, receptions, window)
+}
+
+// accountFlags The accounts the emails are received from, given in the command line ("--account user", repeated).
+type accountFlags []string
+
+func (a *accountFlags) String() string {
+	return strings.Join(*a, ",")
+}
+
+func (a *accountFlags) Set(value string) error {
+	if len(value) == 0 {
+		return fmt.Errorf(`invalid account: empty user`)
+	}
+	*a = append(*a, value)
+	return nil
+}
+
+// receiveAccount An account the emails are received from (see "rcv"): the user, and how its emails are retrieved (the
+// options given by the command line, completed by the profile of the account).
+type receiveAccount struct {
+	user      string
+	password  string
+	transport string
+	// server and port The address and the port of the IMAP (or POP3) server.
+	server string
+	port   int
+	// portGiven Tells whether the port is given (by the command line or by the profile): otherwise, the default port
+	// of the transport is used.
+	portGiven bool
+	// jmap The URL of the JMAP session resource.
+	jmap    string
+	mailbox string
+	connect connectOptions
+}
+
+// applyProfile Sets the options of the account that are not given by the command line (`given` tells which ones are
+// given) to the values of its profile.
+func (a *receiveAccount) applyProfile(profile umailData.ReceiveProfile, given map[string]bool) {
+	if !given["transport"] && !given["protocol"] {
+		a.transport = profile.Transport
+	}
+	if !given["imap"] && len(profile.Server) > 0 {
+		a.server = profile.Server
+	}
+	if !given["port"] && profile.Port > 0 {
+		a.port = profile.Port
+		a.portGiven = true
+	}
+	if !given["jmap"] && len(profile.Jmap) > 0 {
+		a.jmap = profile.Jmap
+	}
+	if !given["mailbox"] && len(profile.Mailbox) > 0 {
+		a.mailbox = profile.Mailbox
+	}
+	if !given["proxy"] {
+		a.connect.proxy = profile.Proxy
+	}
+}
+
+// askPassword Asks for the password of the account, unless its transport (or `oauth`) authenticates using the OAuth2
+// token of the user. For JMAP, an empty password designates the OAuth2 token of the user.
+func (a *receiveAccount) askPassword(oauth bool) error {
+	var err error
+	var password []byte
+
+	if oauth || a.transport == umailData.TransportGmail || a.transport == umailData.TransportGraph {
+		return nil
+	}
+	if password, err = readPassphrase(fmt.Sprintf(`Enter the password of "%s":`, a.user)); err != nil {
+		return err
+	}
+	a.password = string(password)
+	return nil
+}
+
+// receiveOptions The options of "rcv" that apply to all the accounts.
+type receiveOptions struct {
+	timeouts      umailData.Timeouts
+	batching      umailData.Batching
+	oauth         bool
+	filter        umailData.EmailFilter
+	window        umailData.EmailWindow
+	action        umailData.ProcessedAction
+	dryRun        bool
+	full          bool
+	markRead      bool
+	showMailboxes bool
+	rescan        bool
+	watch         bool
+	decoding      decodeOptions
+	cache         *umailData.MailboxCache
+}
+
+// receivedEmails The emails of an account that have a boundary (see `listAccountEmails`), and the state of its mailbox,
+// recorded once the emails are processed.
+type receivedEmails struct {
+	account    receiveAccount
+	candidates map[emailIndex]emailCandidate
+	// uids The UIDs of the emails (IMAP only).
+	uids map[emailIndex]uint32
+	// mailboxName The name of the mailbox into the cache of the states (empty if its state is not recorded).
+	mailboxName string
+	state       umailData.MailboxState
+}
+
+// listAccountEmails Lists the emails of an account that match the criteria and that have a boundary, using the
+// transport of the account. If the emails are waited for (IMAP IDLE), then it only returns once the watch is over.
+func listAccountEmails(account receiveAccount, options receiveOptions) (*receivedEmails, error) {
+	var err error
+	var jmapURL *url.URL
+	var jmapPort int
+	var received = receivedEmails{account: account}
+	var transport = account.transport
+	var action = options.action
+
+	if len(account.connect.proxy) > 0 {
+		if _, err = umailData.ParseProxy(account.connect.proxy); err != nil {
+			return nil, err
+		}
+		if transport == umailData.TransportJmap || transport == umailData.TransportGmail || transport == umailData.TransportGraph {
+			return nil, fmt.Errorf(`the transport "%s" cannot go through a proxy: use "%s" or "%s"`, transport, transportImap, umailData.TransportPop3)
+		}
+	}
+	if account.connect.startTls && !account.portGiven {
+		account.port = DefaultImapStartTlsPort
+	}
+	switch transport {
+	case transportImap:
+		received.mailboxName = umailData.MailboxName(account.user, account.server, account.port, account.mailbox, options.filter)
+		if !options.rescan {
+			received.state = options.cache.Get(received.mailboxName)
+		}
+		if options.watch {
+			if len(options.filter.From) == 0 {
+				return nil, fmt.Errorf(`the sender of the emails to wait for must be given (--from)`)
+			}
+			if !options.window.IsEmpty() {
+				return nil, fmt.Errorf(`the emails to wait for cannot be limited (--last, --page)`)
+			}
+			return nil, watchImapEmails(account.server, account.port, account.connect, options.timeouts, options.batching, options.markRead, account.user, account.password, options.oauth, account.mailbox, options.filter, action, options.dryRun, options.cache, received.mailboxName, options.rescan, options.decoding)
+		}
+		received.candidates, received.uids, received.state, err = listImapEmails(account.server, account.port, account.connect, options.timeouts, options.batching, account.user, account.password, options.oauth, account.mailbox, options.filter, options.window, received.state, options.full, options.markRead, options.showMailboxes)
+	case umailData.TransportGraph:
+		if len(account.password) > 0 {
+			return nil, fmt.Errorf(`the transport "%s" uses the OAuth2 token of the user: no password can be given`, transport)
+		}
+		if options.watch {
+			return nil, fmt.Errorf(`the transport "%s" cannot wait for the emails (--watch): use "%s"`, transport, transportImap)
+		}
+		if !action.IsEmpty() {
+			return nil, fmt.Errorf(`the transport "%s" cannot move, mark or delete the emails (--move-to, --keyword, --delete-after-decode): use "%s"`, transport, transportImap)
+		}
+		received.candidates, err = listGraphEmails(account.user, account.mailbox, options.filter, options.window, options.full)
+	case umailData.TransportPop3:
+		if options.oauth || account.connect.startTls {
+			return nil, fmt.Errorf(`the transport "%s" cannot authenticate using an OAuth2 token, nor use STARTTLS: use "%s"`, transport, transportImap)
+		}
+		if options.watch || !action.IsEmpty() || options.markRead {
+			return nil, fmt.Errorf(`the transport "%s" cannot wait for the emails, nor move, mark or delete them: use "%s"`, transport, transportImap)
+		}
+		if !strings.EqualFold(account.mailbox, "INBOX") {
+			return nil, fmt.Errorf(`the transport "%s" only gives access to the inbox (not to "%s")`, transport, account.mailbox)
+		}
+		if !account.portGiven {
+			account.port = umailData.DefaultPop3Port
+		}
+		received.mailboxName = umailData.MailboxName(account.user, account.server, account.port, "INBOX", options.filter)
+		if !options.rescan {
+			received.state = options.cache.Get(received.mailboxName)
+		}
+		received.candidates, received.state, err = listPop3Emails(account.server, account.port, account.connect, options.timeouts, account.user, account.password, options.filter, options.window, received.state, options.full)
+	case umailData.TransportJmap:
+		if options.watch || !action.IsEmpty() || options.markRead {
+			return nil, fmt.Errorf(`the transport "%s" cannot wait for the emails, nor move, mark or delete them: use "%s"`, transport, transportImap)
+		}
+		if jmapURL, err = url.Parse(account.jmap); err != nil || jmapURL.Scheme != "https" && jmapURL.Scheme != "http" {
+			return nil, fmt.Errorf(`invalid JMAP session URL "%s"`, account.jmap)
+		}
+		if jmapPort, err = strconv.Atoi(jmapURL.Port()); err != nil {
+			jmapPort = 443
+		}
+		received.mailboxName = umailData.MailboxName(account.user, jmapURL.Hostname(), jmapPort, account.mailbox, options.filter)
+		if !options.rescan {
+			received.state = options.cache.Get(received.mailboxName)
+		}
+		received.candidates, received.state, err = listJmapEmails(account.jmap, account.user, account.password, account.mailbox, options.filter, options.window, received.state, options.full)
+	case umailData.TransportGmail:
+		if len(account.password) > 0 {
+			return nil, fmt.Errorf(`the transport "%s" uses the OAuth2 token of the user: no password can be given`, transport)
+		}
+		if options.watch || !action.IsEmpty() || options.markRead {
+			return nil, fmt.Errorf(`the transport "%s" cannot wait for the emails, nor move, mark or delete them: use "%s"`, transport, transportImap)
+		}
+		received.mailboxName = umailData.MailboxName(account.user, "gmail.googleapis.com", 443, account.mailbox, options.filter)
+		if !options.rescan {
+			received.state = options.cache.Get(received.mailboxName)
+		}
+		received.candidates, received.state, err = listGmailEmails(account.user, account.mailbox, options.filter, options.window, received.state, options.full)
+	default:
+		return nil, fmt.Errorf(`unknown transport "%s" ("%s", "%s", "%s", "%s" or "%s")`, transport, transportImap, umailData.TransportPop3, umailData.TransportJmap, umailData.TransportGmail, umailData.TransportGraph)
+	}
+	if err != nil {
+		return nil, err
+	}
+	received.account = account
+	return &received, nil
+}
+
+// emailOrigin The account an email was received by (an index into the list of the receptions), and the index of the
+// email into the mailbox of the account.
+type emailOrigin struct {
+	reception int
+	index     emailIndex
+}
+
+// mergeCandidates Gathers the emails of several accounts that have a boundary, so that the emails of a message spread
+// across several accounts can be selected at once. The emails of a single account keep their indexes. Otherwise, they
+// are numbered again (the emails of the first account first), and the new indexes are printed.
+func mergeCandidates(receptions []*receivedEmails) (map[emailIndex]emailCandidate, map[emailIndex]emailOrigin) {
+	var candidates = map[emailIndex]emailCandidate{}
+	var origins = map[emailIndex]emailOrigin{}
+	var next = emailIndex(1)
+
+	if len(receptions) == 1 {
+		for index, candidate := range receptions[0].candidates {
+			candidates[index] = candidate
+			origins[index] = emailOrigin{reception: 0, index: index}
+		}
+		return candidates, origins
+	}
+	fmt.Printf("EMAILS OF ALL THE ACCOUNTS:\n\n")
+	for r, received := range receptions {
+		var indexes []emailIndex
+
+		for index := range received.candidates {
+			indexes = append(indexes, index)
+		}
+		sort.Slice(indexes, func(i, j int) bool {
+			return indexes[i] < indexes[j]
+		})
+		for _, index := range indexes {
+			var candidate = received.candidates[index]
+			candidates[next] = candidate
+			origins[next] = emailOrigin{reception: r, index: index}
+			fmt.Printf("[%4d] %s, email %d (sent: %s)\n", next, received.account.user, index, formatDate(candidate.sent))
+			next++
+		}
+	}
+	fmt.Printf("\n")
+	return candidates, origins
+}
+
+// printCandidatesJson Writes the emails that have a boundary (see `mergeCandidates`) as a JSON array, in the order of
+// their indexes: the indexes are the ones to select (see "rcv --select").
+func printCandidatesJson(w io.Writer, candidates map[emailIndex]emailCandidate, origins map[emailIndex]emailOrigin, receptions []*receivedEmails) error {
+	var emails []umailData.ListedEmail
+
+	for _, index := range candidateIndexes(candidates) {
+		var candidate = candidates[index]
+		var origin = origins[index]
+		var email = umailData.ListedEmail{Index: index, Uid: receptions[origin.reception].uids[origin.index], From: candidate.from, Subject: candidate.subject, Boundaries: candidate.boundaries, Pending: candidate.pending}
+
+		if len(receptions) > 1 {
+			email.Account = receptions[origin.reception].account.user
+		}
+		email.SetSent(candidate.sent)
+		emails = append(emails, email)
+	}
+	return umailData.WriteListedEmails(w, emails)
+}
+
+// fetchSelectedEmails Fetches the bodies of the selected emails that are pending (see `emailCandidate`), and sets their
+// boundaries. The emails are fetched by their UIDs, account by account (IMAP). The selected emails are marked as read
+// if `options.markRead` is true. The boundaries already seen are reported (see `checkBoundaryReuse`).
+func fetchSelectedEmails(emails []emailIndex, candidates map[emailIndex]emailCandidate, origins map[emailIndex]emailOrigin, receptions []*receivedEmails, options receiveOptions) error {
+	var err error
+	var fetched = map[emailIndex]emailCandidate{}
+
+	for r, received := range receptions {
+		var imapClient *imapclient.Client
+		var selectedMbox *imap.SelectData
+		var headers []*imapEmail
+		var bodies []*imapEmail
+		var indexes = map[uint32]emailIndex{}
+		var account = received.account
+
+		for _, index := range emails {
+			if origins[index].reception != r || !candidates[index].pending {
+				continue
+			}
+			var uid = received.uids[origins[index].index]
+			indexes[uid] = index
+			headers = append(headers, &imapEmail{seqNum: index, message: &imapclient.FetchMessageBuffer{UID: uid}})
+		}
+		if len(headers) == 0 {
+			continue
+		}
+		if imapClient, err = openImap(account.server, account.port, account.connect, options.timeouts, account.user, account.password, options.oauth); err != nil {
+			return err
+		}
+		defer imapClient.Close()
+		if selectedMbox, err = selectImapMailbox(imapClient, account.mailbox); err != nil {
+			return err
+		}
+		// The UIDs are only valid as long as the validity of the mailbox does not change.
+		if selectedMbox.UIDValidity != received.state.UidValidity {
+			return fmt.Errorf(`the emails of "%s" have been renumbered by the server since they were listed: receive them again`, account.mailbox)
+		}
+		if bodies, err = fetchImapBodies(imapClient, account.mailbox, headers, options.batching, options.markRead); err != nil {
+			return err
+		}
+		for _, email := range bodies {
+			var candidate = candidates[indexes[email.message.UID]]
+			candidate.boundaries = email.boundaries
+			candidate.pending = false
+			fetched[indexes[email.message.UID]] = candidate
+		}
+		if err = imapClient.Logout().Wait(); err != nil {
+			return fmt.Errorf("cannot logout: %s", err.Error())
+		}
+	}
+	for _, index := range emails {
+		if _, ok := fetched[index]; ok {
+			candidates[index] = fetched[index]
+		} else if candidates[index].pending {
+			return fmt.Errorf(`the email %d has no boundary (or it has been deleted since it was listed)`, index)
+		}
+	}
+	if len(fetched) > 0 {
+		return checkBoundaryReuse(fetched)
+	}
+	return nil
+}
+
+// recordMailboxStates Records the states of the mailboxes of the accounts (see `recordMailboxState`), unless the
+// emails examined are limited (the emails out of the window have not been examined: they are not recorded as
+// processed).
+func recordMailboxStates(cache *umailData.MailboxCache, receptions []*receivedEmails, window umailData.EmailWindow) error {
+	var err error
+
+	if !window.IsEmpty() {
+		return nil
+	}
+	for _, received := range receptions {
+		if len(received.mailboxName) == 0 {
+			continue
+		}
+		if err = recordMailboxState(cache, received.mailboxName, received.state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectHiddenMessage Asks for the emails that carry the hidden message (among the emails that have boundaries, by
+// index), unless they are given by `selection` (see `umailData.ParseEmailSelection`), and shows the message (see
+// `showMessage`). The bodies of the selected emails that are pending are fetched by `fetch` (nil if no email is
+// pending). It returns the emails selected, or nil if the user gave up.
+func selectHiddenMessage(candidates map[emailIndex]emailCandidate, options decodeOptions, selection string, fetch func([]emailIndex) error) ([]emailIndex, error) {
+	var err error
+	var emails []emailIndex
+	var proceed *bool
+	var boundaries [][]string
+
+	// Ask for the list of emails to process.
+	if len(selection) > 0 {
+		if emails, err = umailData.ParseEmailSelection(selection, candidateIndexes(candidates)); err != nil {
+			return nil, fmt.Errorf(`invalid selection (--select): %s`, err.Error())
+		}
+	} else if emails, err = getEmails(candidates); err != nil {
+		return nil, err
+	}
+	if emails == nil {
+		return nil, nil
+	}
+	sort.SliceStable(emails, func(i, j int) bool {
+		return emails[i] < emails[j]
+	})
+	emails = orderBySentDate(emails, candidates)
+	fmt.Printf("You selected: %s\n", joinEmailIndexes(emails))
+
+	// Ask for confirmation (the emails given on the command line are not confirmed).
+	if len(selection) == 0 {
+		if proceed, err = getYesNo("Proceed ? (y/n)"); err != nil {
+			return nil, fmt.Errorf("unexpected error: %s", err)
+		}
+		if *proceed == false {
+			return nil, nil
+		}
+	}
+
+	if fetch != nil {
+		if err = fetch(emails); err != nil {
+			return nil, err
+		}
+	}
+
+	// Show the hidden message.
+	for _, emailIndex := range emails {
+		fmt.Printf("[%4d] %s\n", emailIndex, strings.Join(candidates[emailIndex].boundaries, " "))
+		boundaries = append(boundaries, candidates[emailIndex].boundaries)
+	}
+
+	if _, err = showMessage(boundaries, options); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// orderBySentDate Orders emails (given in the order of their arrival) by the dates they were sent: the boundaries of a
+// hidden message must be decoded in the order the emails were sent, which may differ from the order of their arrival.
+// The emails whose order cannot be inferred (sent at the same date) are reported, and left in the order of their
+// arrival. If the date of an email is unknown, or if the dates hide bytes of the message (see
+// `umailData.Carriers.KeepsDates`), then the emails are not reordered.
+func orderBySentDate(emails []emailIndex, candidates map[emailIndex]emailCandidate) []emailIndex {
+	var dates []time.Time
+	var order []int
+	var ties [][]int
+	var ordered []emailIndex
+
+	if !receiveCarriers.KeepsDates() {
+		fmt.Printf("The dates of the emails hide bytes of the message: the emails are processed in the order of their arrival.\n")
+		return emails
+	}
+	for _, email := range emails {
+		dates = append(dates, candidates[email].sent)
+	}
+	if order, ties = umailData.SentOrder(dates); order == nil {
+		fmt.Printf("Warning: the date some emails were sent is unknown: they are processed in the order of their arrival.\n")
+		return emails
+	}
+	for _, position := range order {
+		ordered = append(ordered, emails[position])
+	}
+	if joinEmailIndexes(ordered) != joinEmailIndexes(emails) {
+		fmt.Printf("The emails did not arrive in the order they were sent: they are processed in the order they were sent.\n")
+	}
+	for _, tie := range ties {
+		var tied []emailIndex
+		for _, position := range tie {
+			tied = append(tied, emails[position])
+		}
+		fmt.Printf("Warning: the emails %s were sent at the same date (%s): their order cannot be inferred, they are processed in the order of their arrival.\n", joinEmailIndexes(tied), dates[tie[0]].String())
+	}
+	return ordered
+}
+
+// joinEmailIndexes Returns a list of emails (given by their indexes), separated by commas.
+func joinEmailIndexes(emails []emailIndex) string {
+	var indexes []string
+
+	for _, email := range emails {
+		indexes = append(indexes, fmt.Sprintf("%d", email))
+	}
+	return strings.Join(indexes, ", ")
+}
+
+// processDecode Shows a hidden message whose emails are stored locally, in a Maildir or in a mbox file (for example,
+// synchronized by offlineimap or mbsync): no connection to a server is needed.
+func processDecode() error {
+	var err error
+	var maildir string
+	var mbox string
+	var from string
+	var since string
+	var dayRange string
+	var header string
+	var markerKey string
+	var full bool
+	var decoding = decodeOptions{position: -1}
+	var positionFrom string
+	var filter umailData.EmailFilter
+	var index emailIndex
+	var candidates = map[emailIndex]emailCandidate{}
+	var carriers string
+	var codebookKey string
+	var examine = func(content []byte) error {
+		index++
+		return examineLocalEmail(index, content, filter, full, candidates)
+	}
+
+	// Parse the command line.
+	flag.StringVar(&maildir, "maildir", "", "directory of a Maildir (the one that contains \"cur\" and \"new\")")
+	flag.StringVar(&mbox, "mbox", "", "path to a mbox file")
+	flag.StringVar(&from, "from", "", "sender email address")
+	flag.StringVar(&since, "since", "", "only the emails received since a given day (YYYY-MM-DD)")
+	flag.StringVar(&dayRange, "range", "", "only the emails received from a day (included) to another one (excluded): YYYY-MM-DD..YYYY-MM-DD (one of the days may be omitted)")
+	flag.StringVar(&filter.Subject, "subject", "", "only the emails whose subject contains a given text")
+	flag.StringVar(&header, "header", "", `only the emails that have a given header, whose value contains a given text ("Name: text")`)
+	flag.StringVar(&markerKey, "marker", "", `name of a key: only the emails marked for the next hidden message that uses the key (see "create-session --marker")`)
+	flag.BoolVar(&full, "full", false, "print all the email (not only the envelope)")
+	flag.BoolVar(&decoding.syncCheck, "sync-check", false, "the first selected email is a synchronization preamble (see \"send --sync\")")
+	flag.Int64Var(&decoding.position, "position", -1, "position of the key material used by the hidden message, instead of the current position of the key (which is left untouched)")
+	flag.StringVar(&positionFrom, "position-from", "", "session file shared by the sender: the position of the key material used by the hidden message is the one of the session (see --position)")
+	flag.BoolVar(&decoding.advance, "advance", false, "once the hidden message is shown, move the receiver's cursor of the key past the key material of the message: the next message is decoded from there")
+	flag.BoolVar(&decoding.requireMac, "require-mac", false, "reject a hidden message that has no MAC (see \"create-session --mac\"): without it, a message whose MAC has been stripped is only reported as not authenticated")
+	flag.StringVar(&decoding.output, "output", "", "write the hidden message (as is) into a file, which must not exist, instead of printing it")
+	flag.StringVar(&carriers, "carriers", "", `parts of the emails that hide the message, as given to the sender (see "create-session --carriers", default: the boundary only)`)
+	flag.StringVar(&codebookKey, "codebook", "", `name of a key: the subjects of the emails are read using the codebook of the next hidden message that uses the key (see "--carriers=subject")`)
+	flag.Parse()
+
+	if (len(maildir) > 0) == (len(mbox) > 0) {
+		return fmt.Errorf(`either a Maildir (--maildir) or a mbox file (--mbox) must be given`)
+	}
+	if decoding.position, err = decodePosition(decoding.position, positionFrom); err != nil {
+		return err
+	}
+	if err = setReceiveCarriers(carriers, codebookKey, decoding.position); err != nil {
+		return err
+	}
+	filter.From = from
+	if len(since) > 0 && len(dayRange) > 0 {
+		return fmt.Errorf(`a day and a range of days cannot be given at once: use "--range=%s.."`, since)
+	}
+	if len(since) > 0 {
+		if filter.Since, err = umailData.ParseDay(since); err != nil {
+			return err
+		}
+	}
+	if len(dayRange) > 0 {
+		if filter.Since, filter.Before, err = umailData.ParseDayRange(dayRange); err != nil {
+			return err
+		}
+	}
+	if len(header) > 0 {
+		if filter.HeaderName, filter.HeaderValue, err = umailData.ParseHeaderCriterion(header); err != nil {
+			return err
+		}
+	}
+	if len(markerKey) > 0 {
+		if filter.Marker, err = keyMarker(markerKey, decoding.position); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("EMAILS:\n\n")
+
+	if len(maildir) > 0 {
+		var paths []string
+
+		if paths, err = umailData.MaildirEmails(maildir); err != nil {
+			return err
+		}
+		for _, path := range paths {
+			var content []byte
+
+			if content, err = os.ReadFile(path); err != nil {
+				return err
+			}
+			if err = examine(content); err != nil {
+				return fmt.Errorf(`invalid email "%s": %s`, path, err.Error())
+			}
+		}
+	} else {
+		var file *os.File
+
+		if file, err = os.Open(mbox); err != nil {
+			return err
+		}
+		defer file.Close()
+		if err = umailData.ScanMbox(file, examine); err != nil {
+			return fmt.Errorf(`cannot read the mbox file "%s" (email %d): %s`, mbox, index, err.Error())
+		}
+	}
+
+	if len(candidates) == 0 {
+		fmt.Printf("No email has a boundary.\n")
+		return nil
+	}
+	_, err = selectHiddenMessage(candidates, decoding, "", nil)
+	return err
+}
+
+// processDecodeEml Shows a hidden message whose emails are saved as raw messages (".eml" files), given in the order
+// they were sent. The chunks of a sequenced message are put back in order, whatever the order of the files.
+func processDecodeEml() error {
+	var err error
+	var decoding = decodeOptions{position: -1}
+	var positionFrom string
+	var full bool
+	var paths []string
+	var candidates = map[emailIndex]emailCandidate{}
+	var boundaries [][]string
+	var carriers string
+	var codebookKey string
+
+	// Parse the command line.
+	flag.BoolVar(&decoding.syncCheck, "sync-check", false, "the first file is a synchronization preamble (see \"send --sync\")")
+	flag.Int64Var(&decoding.position, "position", -1, "position of the key material used by the hidden message, instead of the current position of the key (which is left untouched)")
+	flag.StringVar(&positionFrom, "position-from", "", "session file shared by the sender: the position of the key material used by the hidden message is the one of the session (see --position)")
+	flag.BoolVar(&decoding.advance, "advance", false, "once the hidden message is shown, move the receiver's cursor of the key past the key material of the message: the next message is decoded from there")
+	flag.BoolVar(&decoding.requireMac, "require-mac", false, "reject a hidden message that has no MAC (see \"create-session --mac\"): without it, a message whose MAC has been stripped is only reported as not authenticated")
+	flag.StringVar(&decoding.output, "output", "", "write the hidden message (as is) into a file, which must not exist, instead of printing it")
+	flag.BoolVar(&full, "full", false, "print all the email (not only the envelope)")
+	flag.StringVar(&carriers, "carriers", "", `parts of the emails that hide the message, as given to the sender (see "create-session --carriers", default: the boundary only)`)
+	flag.StringVar(&codebookKey, "codebook", "", `name of a key: the subjects of the emails are read using the codebook of the next hidden message that uses the key (see "--carriers=subject")`)
+	flag.Parse()
+	if paths = flag.Args(); len(paths) == 0 {
+		return fmt.Errorf(`the files that contain the emails must be given`)
+	}
+	if decoding.position, err = decodePosition(decoding.position, positionFrom); err != nil {
+		return err
+	}
+	if err = setReceiveCarriers(carriers, codebookKey, decoding.position); err != nil {
+		return err
+	}
+
+	fmt.Printf("EMAILS:\n\n")
+
+	for i, path := range paths {
+		var index = emailIndex(i + 1)
+		var content []byte
+
+		if content, err = os.ReadFile(path); err != nil {
+			return err
+		}
+		if err = examineLocalEmail(index, content, umailData.EmailFilter{}, full, candidates); err != nil {
+			return fmt.Errorf(`invalid email "%s": %s`, path, err.Error())
+		}
+		if _, ok := candidates[index]; !ok {
+			return fmt.Errorf(`the file "%s" is not an email that has a boundary`, path)
+		}
+		boundaries = append(boundaries, candidates[index].boundaries)
+	}
+
+	_, err = showMessage(boundaries, decoding)
+	return err
+}
+
+// examineLocalEmail Parses an email (RFC 5322) read from a local store, and, if it matches a filter and if it has a
+// boundary, records its boundaries under its index, and prints its envelope (or, if `full` is true, the whole email).
+// The emails that cannot be parsed are skipped.
+func examineLocalEmail(index emailIndex, content []byte, filter umailData.EmailFilter, full bool, candidates map[emailIndex]emailCandidate) error {
+	var err error
+	var m *mail.Message
+	var body []byte
+	var boundaries []string
+	var date time.Time
+	var subject, from string
+	var to, cc []string
+
+	if m, err = mail.ReadMessage(bytes.NewReader(content)); err != nil {
+		return nil
+	}
+	date, subject, from, to, cc = headerEnvelope(m.Header)
+	if !filter.MatchEnvelope(from, subject, date) || !filter.MatchHeader(textproto.MIMEHeader(m.Header)) {
+		return nil
+	}
+	if body, err = io.ReadAll(m.Body); err != nil {
+		return err
+	}
+	if boundaries, err = receiveCarriers.EmailBoundaries(content); err != nil || boundaries == nil {
+		return err
+	}
+	candidates[index] = emailCandidate{boundaries: boundaries, sent: date, from: from, subject: subject}
+	printEmailSummary(index, date, subject, from, to, cc, boundaries)
+
+	if full {
+		for k, v := range m.Header {
+			fmt.Printf("* %s: %s\r\n", k, v)
+		}
+		fmt.Printf("%s\n\n", body)
+	}
+	return nil
+}
+
+// saveReceiveProfile Records how the emails of an account are received: the transport, and the options given on the
+// command line among the server (address and port), the JMAP session resource, the mailbox and the proxy.
+func saveReceiveProfile(profiles *umailData.ProfileStore, user string, transport string, server string, port int, jmapSessionURL string, mailbox string, proxy string, given map[string]bool) error {
+	var err error
+	var profile = umailData.ReceiveProfile{Transport: transport}
+
+	if len(user) == 0 {
+		return fmt.Errorf(`the user whose profile is recorded must be given (--user)`)
+	}
+	if given["imap"] {
+		profile.Server = server
+	}
+	if given["port"] {
+		profile.Port = port
+	}
+	if given["jmap"] {
+		profile.Jmap = jmapSessionURL
+	}
+	if given["mailbox"] {
+		profile.Mailbox = mailbox
+	}
+	if given["proxy"] {
+		profile.Proxy = proxy
+	}
+	if err = profiles.Put(user, profile); err != nil {
+		return err
+	}
+	fmt.Printf("The profile of \"%s\" is recorded (transport \"%s\").\n\n", user, transport)
+	return nil
+}
+
+// confirmDeletion Prints the emails of a mailbox (given by their UIDs) that are about to be deleted from the server,
+// and asks for a confirmation. If `dryRun` is true, then the emails are only printed: they are not deleted.
+func confirmDeletion(mailbox string, uids []uint32, dryRun bool) (bool, error) {
+	var err error
+	var proceed *bool
+
+	if dryRun {
+		fmt.Printf("Dry run: the following emails of \"%s\" would be deleted from the server:\n", mailbox)
+	} else {
+		fmt.Printf("The following emails of \"%s\" are about to be deleted from the server:\n", mailbox)
+	}
+	for _, uid := range uids {
+		fmt.Printf("  UID %d\n", uid)
+	}
+	if dryRun {
+		return false, nil
+	}
+	if proceed, err = getYesNo("Delete them ? (y/n)"); err != nil {
+		return false, fmt.Errorf("unexpected error: %s", err)
+	}
+	return *proceed, nil
+}
+
+// processImapEmails Marks the emails of a mailbox (IMAP), given by their UIDs, with the keyword of an action, and/or
+// moves them to the mailbox of the action, or deletes them (see `markImapEmails`). The deletion must be confirmed
+// first (see `confirmDeletion`).
+func processImapEmails(imapServerAddress string, imapServerPort int, connect connectOptions, timeouts umailData.Timeouts, user string, password string, oauth bool, mailbox string, uids []uint32, action umailData.ProcessedAction, dryRun bool) error {
+	var err error
+	var imapClient *imapclient.Client
+
+	if action.Delete {
+		if action.Delete, err = confirmDeletion(mailbox, uids, dryRun); err != nil {
+			return err
+		}
+	}
+	if action.IsEmpty() || len(uids) == 0 {
+		return nil
+	}
+	if imapClient, err = openImap(imapServerAddress, imapServerPort, connect, timeouts, user, password, oauth); err != nil {
+		return err
+	}
+	defer imapClient.Close()
+	if _, err = selectImapMailbox(imapClient, mailbox); err != nil {
+		return err
+	}
+	if err = markImapEmails(imapClient, mailbox, uids, action); err != nil {
+		return err
+	}
+	return imapClient.Logout().Wait()
+}
+
+// markImapEmails Marks the emails of the selected mailbox, given by their UIDs, with the keyword of an action, and/or
+// moves them to the mailbox of the action (the keyword is set first: it is kept by the emails moved). If the server
+// does not support MOVE, then the emails are copied, and deleted from the selected mailbox. Or, the emails are deleted
+// (see `deleteImapEmails`).
+func markImapEmails(imapClient *imapclient.Client, mailbox string, uids []uint32, action umailData.ProcessedAction) error {
+	var err error
+	var uidSet = imap.SeqSetNum(uids...)
+
+	if len(uids) == 0 {
+		return nil
+	}
+	if len(action.Keyword) > 0 {
+		var store = imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.Flag(action.Keyword)}}
+		if err = imapClient.UIDStore(uidSet, &store, nil).Close(); err != nil {
+			return fmt.Errorf("cannot mark the emails of \"%s\" with the keyword \"%s\": %s", mailbox, action.Keyword, err.Error())
+		}
+		fmt.Printf("%d email(s) marked with the keyword \"%s\".\n", len(uids), action.Keyword)
+	}
+	if len(action.Mailbox) > 0 {
+		if _, err = imapClient.UIDMove(uidSet, action.Mailbox).Wait(); err != nil {
+			return fmt.Errorf("cannot move the emails of \"%s\" to \"%s\": %s", mailbox, action.Mailbox, err.Error())
+		}
+		fmt.Printf("%d email(s) moved to \"%s\".\n", len(uids), action.Mailbox)
+	}
+	if action.Delete {
+		if err = deleteImapEmails(imapClient, uidSet); err != nil {
+			return fmt.Errorf("cannot delete the emails of \"%s\": %s", mailbox, err.Error())
+		}
+		fmt.Printf("%d email(s) deleted from \"%s\".\n", len(uids), mailbox)
+	}
+	return nil
+}
+
+// deleteImapEmails Deletes the emails of the selected mailbox, given by their UIDs: they are flagged as deleted, and
+// expunged. Only these emails are expunged (UIDPLUS): the server must support it.
+func deleteImapEmails(imapClient *imapclient.Client, uidSet imap.SeqSet) error {
+	var err error
+	var store = imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagDeleted}}
+
+	if !imapClient.Caps().Has(imap.CapUIDPlus) {
+		return fmt.Errorf(`the IMAP server cannot expunge given emails (no UIDPLUS support): expunging would also remove the other emails flagged as deleted`)
+	}
+	if err = imapClient.UIDStore(uidSet, &store, nil).Close(); err != nil {
+		return err
+	}
+	return imapClient.UIDExpunge(uidSet).Close()
+}
+
+// recordMailboxState Records the state of a mailbox once its emails have been processed (if the emails are retrieved
+// using IMAP): the next reception only fetches the emails that arrived since.
+func recordMailboxState(cache *umailData.MailboxCache, mailboxName string, state umailData.MailboxState) error {
+	if cache == nil {
+		return nil
+	}
+	return cache.Put(mailboxName, state)
+}
+
+// openImap Opens a connection to an IMAP server (TLS), and authenticates: using the password, or the OAuth2 token of
+// the user (XOAUTH2, see "oauth-login").
+func openImap(imapServerAddress string, imapServerPort int, connect connectOptions, timeouts umailData.Timeouts, user string, password string, oauth bool) (*imapclient.Client, error) {
+	return openImapWithOptions(imapServerAddress, imapServerPort, connect, timeouts, user, password, oauth, nil)
+}
+
+// openImapWithOptions Same as `openImap`, but the options of the client are given (the handler of the unilateral data
+// sent by the server, for example).
+func openImapWithOptions(imapServerAddress string, imapServerPort int, connect connectOptions, timeouts umailData.Timeouts, user string, password string, oauth bool, options *imapclient.Options) (*imapclient.Client, error) {
+	var err error
+	var imapClient *imapclient.Client
+	var accessToken string
+
+	if oauth {
+		// The token is refreshed (if it has expired) before the connection is opened.
+		if accessToken, err = oauthAccessToken(user); err != nil {
+			return nil, err
+		}
+	}
+	if imapClient, err = dialImap(imapServerAddress, imapServerPort, connect, timeouts, options); err != nil {
+		return nil, err
+	}
+	if oauth {
+		if err = imapClient.Authenticate(&xoauth2ImapAuth{user: user, accessToken: accessToken}); err != nil {
+			imapClient.Close()
+			return nil, fmt.Errorf("cannot authenticate as \"%s\" (OAuth2): %s", user, err.Error())
+		}
+		return imapClient, nil
+	}
+	if err = imapClient.Login(user, password).Wait(); nil != err {
+		imapClient.Close()
+		return nil, fmt.Errorf("annot authenticate as \"%s\" (password: %s): %s", user, password, err.Error())
+	}
+	return imapClient, nil
+}
+
+// dialImap Opens a connection to an IMAP server (implicit TLS, or STARTTLS), through a SOCKS5 proxy if given, without
+// authenticating. The server must reply to each command
+// within the command timeout (the emails are fetched as a stream: the timeout applies to each read).
+func dialImap(imapServerAddress string, imapServerPort int, connect connectOptions, timeouts umailData.Timeouts, options *imapclient.Options) (*imapclient.Client, error) {
+	var err error
+	var imapUri string
+	var imapTlsConfig *tls.Config
+	var connection *tls.Conn
+
+	imapUri = fmt.Sprintf("%s:%d", imapServerAddress, imapServerPort)
+	imapTlsConfig = connect.config(imapServerAddress)
+	imapTlsConfig.NextProtos = []string{"imap"}
+	if connect.startTls {
+		return dialImapStartTls(imapUri, connect.proxy, imapTlsConfig, timeouts, options)
+	}
+	if connection, _, err = dialTls(imapUri, connect.proxy, imapTlsConfig, timeouts); nil != err {
+		return nil, fmt.Errorf("cannot open connection to IMAP server at \"%s\": %s", imapUri, err.Error())
+	}
+	return imapclient.New(connection, options), nil
+}
+
+// dialImapStartTls Opens a connection to an IMAP server in clear (through a SOCKS5 proxy, if given), and upgrades it
+// (STARTTLS), without authenticating. The server must not authenticate the client before the upgrade (PREAUTH, RFC 9051
+// section 7.1.4).
+func dialImapStartTls(imapUri string, proxy string, imapTlsConfig *tls.Config, timeouts umailData.Timeouts, options *imapclient.Options) (*imapclient.Client, error) {
+	var err error
+	var raw net.Conn
+	var connection *umailData.TimeoutConn
+	var imapClient *imapclient.Client
+	var ctx, cancel = timeouts.DialContext()
+
+	defer cancel()
+	if len(proxy) > 0 {
+		if raw, err = umailData.DialProxy(proxy, imapUri, proxyTimeout); err == nil {
+			connection = umailData.NewTimeoutConn(raw, timeouts.Command)
+		}
+	} else {
+		connection, err = timeouts.Connect(ctx, imapUri)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open connection to IMAP server at \"%s\": %s", imapUri, err.Error())
+	}
+	imapClient = imapclient.New(connection, options)
+	if err = imapClient.StartTLS(imapTlsConfig); err == nil {
+		// The TLS handshake is performed by the first command.
+		_, err = imapClient.Capability().Wait()
+	}
+	if err != nil {
+		imapClient.Close()
+		return nil, fmt.Errorf("cannot upgrade the connection to IMAP server at \"%s\" (STARTTLS): %s", imapUri, err.Error())
+	}
+	if imapClient.State() != imap.ConnStateNotAuthenticated {
+		imapClient.Close()
+		return nil, fmt.Errorf("the IMAP server at \"%s\" authenticated the client before STARTTLS (PREAUTH)", imapUri)
+	}
+	return imapClient, nil
+}
+
+// appendImapMessage Appends an email sent by `from` to a mailbox (IMAP), marked as read. The IMAP user is the one
+// given by the location of the mailbox, or the address of the sender. The user authenticates using the password, or
+// its OAuth2 token (see "oauth-login").
+func appendImapMessage(folder *umailData.SentFolder, from string, password string, oauth bool, insecure bool, timeouts umailData.Timeouts, message []byte) error {
+	var err error
+	var imapClient *imapclient.Client
+	var command *imapclient.AppendCommand
+	var user = folder.User
+	var accessToken string
+
+	if len(user) == 0 {
+		if user, err = umailData.EnvelopeAddress(from); err != nil {
+			return err
+		}
+	}
+	if imapClient, err = dialImap(folder.Server, folder.Port, connectOptions{insecure: insecure}, timeouts, nil); err != nil {
+		return err
+	}
+	defer imapClient.Close()
+	if oauth {
+		if accessToken, err = oauthAccessToken(from); err == nil {
+			err = imapClient.Authenticate(&xoauth2ImapAuth{user: user, accessToken: accessToken})
+		}
+	} else {
+		err = imapClient.Login(user, password).Wait()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot authenticate as \"%s\": %s", user, err.Error())
+	}
+	command = imapClient.Append(folder.Mailbox, int64(len(message)), &imap.AppendOptions{Flags: []imap.Flag{imap.FlagSeen}, Time: time.Now()})
+	if _, err = command.Write(message); err == nil {
+		err = command.Close()
+	}
+	if err == nil {
+		_, err = command.Wait()
+	}
+	if err != nil {
+		return err
+	}
+	return imapClient.Logout().Wait()
+}
+
+// listImapEmails Lists the emails of a mailbox (IMAP) that match a filter and that have a boundary, and returns their
+// boundaries (indexed by their sequence numbers). The server selects the emails that match the filter (see
+// `searchImapEmails`): the other emails are not fetched. Only the emails that arrived since the state of the mailbox
+// was recorded are listed (all the emails if the state is empty). The current state of the mailbox is returned. The
+// headers of the emails are fetched by batches (see `fetchImapHeaders`): the emails are pending, and their bodies are
+// only fetched once selected (see `fetchSelectedEmails`), unless `full` is true (then, the emails are printed, and
+// fetched at once). Only the emails within the window are examined. The UIDs of the emails are also returned (indexed
+// by their sequence numbers).
+func listImapEmails(imapServerAddress string, imapServerPort int, connect connectOptions, timeouts umailData.Timeouts, batching umailData.Batching, user string, password string, oauth bool, mailbox string, filter umailData.EmailFilter, window umailData.EmailWindow, state umailData.MailboxState, full bool, markRead bool, showMailboxes bool) (map[emailIndex]emailCandidate, map[emailIndex]uint32, umailData.MailboxState, error) {
+	var err error
+	var imapClient *imapclient.Client
+	var selectedMbox *imap.SelectData
+	var seqNums []uint32
+	var firstUid uint32
+	var emails []*imapEmail
+	var lastUid uint32
+	var candidates = map[emailIndex]emailCandidate{}
+	var indexUids = map[emailIndex]uint32{}
+
+	if imapClient, err = openImap(imapServerAddress, imapServerPort, connect, timeouts, user, password, oauth); err != nil {
+		return nil, nil, state, err
+	}
+	defer imapClient.Close()
+
+	if showMailboxes {
+		var mailboxes []*imap.ListData
+
+		fmt.Printf("MAILBOXES:\n\n")
+		if mailboxes, err = imapClient.List("", "*", nil).Collect(); nil != err {
+			return nil, nil, state, fmt.Errorf("cannot get the list of mailboxes: %s", err.Error())
+		}
+		for _, mbox := range mailboxes {
+			fmt.Printf("  [%s]\n", mbox.Mailbox)
+		}
+		fmt.Printf("\n")
+	}
+
+	if selectedMbox, err = selectImapMailbox(imapClient, mailbox); err != nil {
+		return nil, nil, state, err
+	}
+
+	if firstUid = state.FirstUid(selectedMbox.UIDValidity); firstUid > 1 {
+		fmt.Printf("Only the emails received since the last reception are listed (see \"--rescan\").\n\n")
+	}
+	if seqNums, err = searchImapEmails(imapClient, mailbox, selectedMbox.NumMessages, filter, firstUid); err != nil {
+		return nil, nil, state, err
+	}
+	seqNums = applyEmailWindow(window, seqNums)
+	state = umailData.MailboxState{UidValidity: selectedMbox.UIDValidity, LastUid: firstUid - 1}
+
+	// Only the headers are fetched: the bodies of the emails are fetched once selected, unless they are printed.
+	if full {
+		emails, lastUid, err = fetchImapEmails(imapClient, mailbox, seqNums, firstUid, filter.From, batching, markRead)
+	} else {
+		emails, lastUid, err = fetchImapHeaders(imapClient, mailbox, seqNums, firstUid, filter.From, batching)
+	}
+	if err != nil {
+		return nil, nil, state, err
+	}
+	if lastUid > state.LastUid {
+		state.LastUid = lastUid
+	}
+
+	fmt.Printf("EMAILS:\n\n")
+
+	for _, email := range emails {
+		var addresses []string
+		var ccs []string
+		var content *string
+		var envelope = email.message.Envelope
+
+		for _, a := range envelope.Cc {
+			ccs = append(ccs, a.Addr())
+		}
+		for _, a := range envelope.To {
+			addresses = append(addresses, a.Addr())
+		}
+		if full {
+			candidates[email.seqNum] = emailCandidate{boundaries: email.boundaries, sent: envelope.Date, from: envelope.From[0].Addr(), subject: envelope.Subject}
+		} else {
+			candidates[email.seqNum] = emailCandidate{sent: envelope.Date, from: envelope.From[0].Addr(), subject: envelope.Subject, pending: true}
+		}
+		indexUids[email.seqNum] = email.message.UID
+		printEmailSummary(email.seqNum, envelope.Date, envelope.Subject, envelope.From[0].Addr(), addresses, ccs, email.boundaries)
+
+		if full {
+			if content, err = retrieveFullEmail([]*imapclient.FetchMessageBuffer{email.message}); err != nil {
+				return nil, nil, state, err
+			}
+			fmt.Printf("%s\n\n", *content)
+		}
+	}
+
+	// The emails that do not match the filter are not processed again with the same filter.
+	if selectedMbox.UIDNext > state.LastUid+1 {
+		state.LastUid = selectedMbox.UIDNext - 1
+	}
+	if err := imapClient.Logout().Wait(); nil != err {
+		return nil, nil, state, fmt.Errorf("cannot logout: %s", err.Error())
+	}
+
+	return candidates, indexUids, state, nil
+}
+
+// watchImapEmails Waits for the emails of a sender (IMAP IDLE), and prints the hidden message once all its emails have
+// arrived. The boundaries of the emails are recorded as they arrive (see `umailData.Reception`): an interrupted watch
+// resumes the reception, unless `rescan` is true. Once the message is printed, the state of the mailbox is recorded,
+// and the emails of the message are processed (see `processImapEmails`).
+func watchImapEmails(imapServerAddress string, imapServerPort int, connect connectOptions, timeouts umailData.Timeouts, batching umailData.Batching, markRead bool, user string, password string, oauth bool, mailbox string, filter umailData.EmailFilter, action umailData.ProcessedAction, dryRun bool, cache *umailData.MailboxCache, mailboxName string, rescan bool, decoding decodeOptions) error {
+	var err error
+	var store *umailData.ReceptionStore
+	var reception *umailData.Reception
+	var reuse *umailData.ReuseIndex
+	var key resource.KeySource
+	var pool resource.KeySource
+	var keyName string
+	var imapClient *imapclient.Client
+	var selectedMbox *imap.SelectData
+	var period = watchIdlePeriod
+	var arrived = make(chan struct{}, 1)
+	var options = imapclient.Options{UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+		// The server notifies the number of emails of the mailbox when new ones arrive (EXISTS).
+		Mailbox: func(data *imapclient.UnilateralDataMailbox) {
+			if data.NumMessages == nil {
+				return
+			}
+			select {
+			case arrived <- struct{}{}:
+			default:
+			}
+		},
+	}}
+
+	if store, err = umailData.LoadReceptionStore(filepath.Join(appDir, receptionFileName)); err != nil {
+		return err
+	}
+	if reception = store.Get(mailboxName); reception == nil || rescan {
+		reception = &umailData.Reception{}
+		if !rescan {
+			reception.Mailbox = cache.Get(mailboxName)
+		}
+	} else {
+		fmt.Printf("The reception in progress is resumed (%d email(s) already received).\n", len(reception.Chunks))
+	}
+
+	if reuse, err = umailData.LoadReuseIndex(filepath.Join(appDir, reuseIndexFileName)); err != nil {
+		return err
+	}
+	if key, pool, keyName, err = openDecodeKey(decoding.position); err != nil {
+		return err
+	}
+	defer key.Close()
+
+	if imapClient, err = openImapWithOptions(imapServerAddress, imapServerPort, connect, timeouts, user, password, oauth, &options); err != nil {
+		return err
+	}
+	defer imapClient.Close()
+	if !imapClient.Caps().Has(imap.CapIdle) {
+		return fmt.Errorf(`the IMAP server cannot notify the arrival of the emails (no IDLE support)`)
+	}
+	if selectedMbox, err = selectImapMailbox(imapClient, mailbox); err != nil {
+		return err
+	}
+	// The server must not stay silent for longer than the command timeout.
+	if timeouts.Command > 0 && timeouts.Command/2 < period {
+		period = timeouts.Command / 2
+	}
+
+	fmt.Printf("Waiting for the emails of \"%s\" (press Ctrl-C to stop)...\n\n", filter.From)
+	for {
+		var received int
+		var hiddenMessage []byte
+		var authenticated bool
+		var end int64
+		var incomplete *umailData.IncompleteError
+
+		if received, err = receiveImapEmails(imapClient, mailbox, selectedMbox.UIDValidity, batching, markRead, filter, reception, decoding.syncCheck, pool, reuse); err != nil {
+			return err
+		}
+		if received > 0 {
+			if err = store.Put(mailboxName, reception); err != nil {
+				return err
+			}
+			if err = reuse.Save(); err != nil {
+				return err
+			}
+		}
+		if received > 0 && len(reception.Chunks) > 0 {
+			var source = pool
+			var point umailData.SyncPoint
+
+			// The message follows the key material dedicated to the synchronization preamble, if any.
+			if reception.Preamble != nil {
+				if source, point, err = syncedKey(reception.Preamble, pool); err != nil {
+					return err
+				}
+			}
+			// The message is complete once its boundaries can be decrypted.
+			hiddenMessage, authenticated, end, err = umailData.DecodeExtent(reception.Chunks, source)
+			if err == nil {
+				err = umailData.CheckAuthenticated(authenticated, decoding.requireMac)
+			}
+			if err == nil {
+				if err = recordKeyRange(keyName, source.Position(), end, hiddenMessage); err != nil {
+					return err
+				}
+				if err = printHiddenMessage(hiddenMessage, authenticated, decoding.output); err != nil {
+					return err
+				}
+				runDecodeHooks(decoding.hooks, hiddenMessage, authenticated, decoding.output)
+				if decoding.advance {
+					if reception.Preamble != nil {
+						end = point.Next(end)
+					}
+					if err = advanceReceiver(key, end); err != nil {
+						return err
+					}
+				}
+				if err = recordMailboxState(cache, mailboxName, reception.Mailbox); err != nil {
+					return err
+				}
+				if err = store.Remove(mailboxName); err != nil {
+					return err
+				}
+				if err = imapClient.Logout().Wait(); err != nil {
+					return err
+				}
+				// The deletion is confirmed once disconnected: the server may not wait for the answer.
+				if action.IsEmpty() {
+					return nil
+				}
+				return processImapEmails(imapServerAddress, imapServerPort, connect, timeouts, user, password, oauth, mailbox, reception.Uids, action, dryRun)
+			}
+			// More emails would not make the MAC match.
+			if errors.Is(err, umailData.ErrNotAuthentic) {
+				return decodeError(err, len(bytes.Join(reception.Chunks, nil)))
+			}
+			if errors.As(err, &incomplete) {
+				fmt.Printf("%d email(s) received, the message is not complete yet: %s.\n\n", len(reception.Chunks), incomplete.Error())
+			} else {
+				fmt.Printf("%d email(s) received, the message is not complete yet.\n\n", len(reception.Chunks))
+			}
+		}
+		if err = idleImap(imapClient, arrived, period); err != nil {
+			return err
+		}
+	}
+}
+
+// receiveImapEmails Adds the boundaries of the emails of the sender that arrived in the selected mailbox since the last
+// ones received to a reception, and returns the number of emails added. If `syncCheck` is true, then the first email
+// is a synchronization preamble, which is checked against the key. The boundaries are recorded into the reuse index
+// (see `warnBoundaryReuse`).
+func receiveImapEmails(imapClient *imapclient.Client, mailbox string, uidValidity uint32, batching umailData.Batching, markRead bool, filter umailData.EmailFilter, reception *umailData.Reception, syncCheck bool, pool resource.KeySource, reuse *umailData.ReuseIndex) (int, error) {
+	var err error
+	var seqNums []uint32
+	var emails []*imapEmail
+	var lastUid uint32
+	var firstUid = reception.Mailbox.FirstUid(uidValidity)
+	var received int
+
+	if seqNums, err = searchImapEmails(imapClient, mailbox, 0, filter, firstUid); err != nil {
+		return 0, err
+	}
+	reception.Mailbox = umailData.MailboxState{UidValidity: uidValidity, LastUid: firstUid - 1}
+	if emails, lastUid, err = fetchImapEmails(imapClient, mailbox, seqNums, firstUid, filter.From, batching, markRead); err != nil {
+		return 0, err
+	}
+	if lastUid > reception.Mailbox.LastUid {
+		reception.Mailbox.LastUid = lastUid
+	}
+
+	for _, email := range emails {
+		var boundaryBytes []byte
+
+		if boundaryBytes, err = parseBoundaryLevels(email.boundaries); err != nil {
+			return received, err
+		}
+		fmt.Printf("[%4d] %s %s\n", email.seqNum, formatDate(email.message.Envelope.Date), strings.Join(email.boundaries, " "))
+		warnBoundaryReuse(reuse, email.seqNum, email.boundaries, email.message.Envelope.Date)
+		if syncCheck && reception.Preamble == nil {
+			var point umailData.SyncPoint
+			if point, err = umailData.SyncVerify(boundaryBytes, pool); err != nil {
+				return received, err
+			}
+			fmt.Printf("The key is synchronized with the sender's one (position: %d).\n", point.Position)
+			reception.Preamble = boundaryBytes
+		} else {
+			reception.Chunks = append(reception.Chunks, boundaryBytes)
+		}
+		reception.Uids = append(reception.Uids, email.message.UID)
+		received++
+	}
+	return received, nil
+}
+
+// idleImap Waits (IMAP IDLE) until the server notifies that emails arrived in the selected mailbox, or until a period
+// elapsed.
+func idleImap(imapClient *imapclient.Client, arrived chan struct{}, period time.Duration) error {
+	var err error
+	var command *imapclient.IdleCommand
+	var timer = time.NewTimer(period)
+
+	defer timer.Stop()
+	if command, err = imapClient.Idle(); err != nil {
+		return fmt.Errorf("cannot wait for the emails (IDLE): %s", err.Error())
+	}
+	select {
+	case <-arrived:
+	case <-timer.C:
+	}
+	if err = command.Close(); err == nil {
+		err = command.Wait()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot wait for the emails (IDLE): %s", err.Error())
+	}
+	return nil
+}
+
+// applyEmailWindow Returns the emails examined, given the ones that match the criteria (from the oldest to the most
+// recent), and tells which ones they are.
+func applyEmailWindow(window umailData.EmailWindow, nums []uint32) []uint32 {
+	var examined = window.Apply(nums)
+
+	switch {
+	case window.Last > 0:
+		fmt.Printf("The %d most recent email(s) are examined (%d email(s) match the criteria).\n\n", len(examined), len(nums))
+	case window.Page > 0:
+		fmt.Printf("Page %d of %d: %d email(s) examined (%d email(s) match the criteria, %d per page).\n\n", window.Page, window.Pages(len(nums)), len(examined), len(nums), window.PageSize)
+	}
+	return examined
+}
+
+// imapEmail An email of a mailbox (IMAP) that has a boundary.
+type imapEmail struct {
+	seqNum     uint32
+	message    *imapclient.FetchMessageBuffer
+	boundaries []string
+}
+
+// fetchImapEmails Fetches the emails of the selected mailbox (given by their sequence numbers) that have a boundary,
+// and returns them in the order of their sequence numbers, along with the highest UID seen: the headers of the emails
+// first (see `fetchImapHeaders`), then the bodies of the emails whose header gives a boundary (see `fetchImapBodies`).
+func fetchImapEmails(imapClient *imapclient.Client, mailbox string, seqNums []uint32, firstUid uint32, from string, batching umailData.Batching, markRead bool) ([]*imapEmail, uint32, error) {
+	var err error
+	var headers []*imapEmail
+	var emails []*imapEmail
+	var lastUid uint32
+
+	if headers, lastUid, err = fetchImapHeaders(imapClient, mailbox, seqNums, firstUid, from, batching); err != nil {
+		return nil, lastUid, err
+	}
+	if emails, err = fetchImapBodies(imapClient, mailbox, headers, batching, markRead); err != nil {
+		return nil, lastUid, err
+	}
+	return emails, lastUid, nil
+}
+
+// fetchImapHeaders Fetches the headers of the emails of the selected mailbox (given by their sequence numbers), and
+// returns the emails whose header gives a boundary, in the order of their sequence numbers, along with the highest UID
+// seen. The boundaries of the returned emails are the boundary given by their header only. The emails whose UID is
+// lower than `firstUid`, and the ones not sent by `from` (if given), are ignored. The headers are fetched by batches,
+// and parsed by a pool of workers. The emails are not marked as read.
+func fetchImapHeaders(imapClient *imapclient.Client, mailbox string, seqNums []uint32, firstUid uint32, from string, batching umailData.Batching) ([]*imapEmail, uint32, error) {
+	var err error
+	var emails []*imapEmail
+	var lastUid uint32
+
+	for _, batch := range batching.Split(seqNums) {
+		var headers []*imapclient.FetchMessageBuffer
+		var boundaries []*string
+
+		if headers, err = retrieveEmailHeaders(imapClient, imap.SeqSetNum(batch...)); err != nil {
+			return nil, lastUid, fmt.Errorf("cannot fetch messages from \"%s\": %s", mailbox, err.Error())
+		}
+		boundaries = make([]*string, len(headers))
+		err = batching.Run(len(headers), func(index int) error {
+			var err error
+			var header = headers[index]
+
+			// The range "n:*" always contains the most recent email, even if it was already processed.
+			if header.UID < firstUid {
+				return nil
+			}
+			// The server selects the emails whose sender contains the address: the whole address must match.
+			if len(from) > 0 && !strings.EqualFold(from, header.Envelope.From[0].Addr()) {
+				return nil
+			}
+			boundaries[index], err = retrieveHeaderBoundary(header)
+			return err
+		})
+		if err != nil {
+			return nil, lastUid, err
+		}
+		for index, header := range headers {
+			if header.UID > lastUid {
+				lastUid = header.UID
+			}
+			if boundaries[index] != nil {
+				emails = append(emails, &imapEmail{seqNum: header.SeqNum, message: header, boundaries: []string{*boundaries[index]}})
+			}
+		}
+	}
+
+	// The server may return the emails of a batch in any order.
+	sort.SliceStable(emails, func(i, j int) bool {
+		return emails[i].seqNum < emails[j].seqNum
+	})
+	return emails, lastUid, nil
+}
+
+// fetchImapBodies Fetches the whole content of emails of the selected mailbox, given by their headers (see
+// `fetchImapHeaders`), and returns the ones that have a boundary along with all their boundaries (see
+// `retrieveBoundaries`), in the order of the given emails. The emails are fetched by their UIDs, by batches, and parsed
+// by a pool of workers. The emails are not marked as read, unless `markRead` is true (only the ones that have a
+// boundary).
+func fetchImapBodies(imapClient *imapclient.Client, mailbox string, headers []*imapEmail, batching umailData.Batching, markRead bool) ([]*imapEmail, error) {
+	var err error
+	var uids []uint32
+	var found = make(map[uint32]*imapEmail)
+	var emails []*imapEmail
+
+	for _, header := range headers {
+		uids = append(uids, header.message.UID)
+	}
+	for _, batch := range batching.Split(uids) {
+		var messages []*imapclient.FetchMessageBuffer
+		var boundaries [][]string
+		var fetched []uint32
+
+		if messages, err = retrieveEmailBodies(imapClient, imap.SeqSetNum(batch...)); err != nil {
+			return nil, fmt.Errorf("cannot fetch messages from \"%s\": %s", mailbox, err.Error())
+		}
+		boundaries = make([][]string, len(messages))
+		err = batching.Run(len(messages), func(index int) error {
+			var err error
+			boundaries[index], err = retrieveBoundaries(messages[index])
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for index, message := range messages {
+			if boundaries[index] != nil {
+				found[message.UID] = &imapEmail{message: message, boundaries: boundaries[index]}
+			}
+			fetched = append(fetched, message.UID)
+		}
+		if err = markImapEmailsRead(imapClient, mailbox, umailData.MarkedAsRead(markRead, fetched, boundaries)); err != nil {
+			return nil, err
+		}
+	}
+
+	// The sequence numbers are the ones the emails were listed with.
+	for _, header := range headers {
+		if email, ok := found[header.message.UID]; ok {
+			email.seqNum = header.seqNum
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
+}
+
+// markImapEmailsRead Marks the emails of the selected mailbox, given by their UIDs, as read.
+func markImapEmailsRead(imapClient *imapclient.Client, mailbox string, uids []uint32) error {
+	var store = imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagSeen}}
+
+	if len(uids) == 0 {
+		return nil
+	}
+	if err := imapClient.UIDStore(imap.SeqSetNum(uids...), &store, nil).Close(); err != nil {
+		return fmt.Errorf("cannot mark the emails of \"%s\" as read: %s", mailbox, err.Error())
+	}
+	return nil
+}
+
+// selectImapMailbox Selects a mailbox (IMAP). The names of the mailboxes depend on the server ("[Gmail]/All Mail",
+// "INBOX.Archive"...): if the mailbox does not exist, then the error gives the mailboxes that can be selected.
+func selectImapMailbox(imapClient *imapclient.Client, mailbox string) (*imap.SelectData, error) {
+	var err error
+	var selected *imap.SelectData
+	var mailboxes []*imap.ListData
+	var listed []umailData.ListedMailbox
+
+	if selected, err = imapClient.Select(mailbox, nil).Wait(); err == nil {
+		return selected, nil
+	}
+	mailboxes, _ = imapClient.List("", "*", nil).Collect()
+	for _, data := range mailboxes {
+		var item = umailData.ListedMailbox{Name: data.Mailbox, Selectable: true}
+		for _, attr := range data.Attrs {
+			if attr == imap.MailboxAttrNoSelect {
+				item.Selectable = false
+			}
+		}
+		listed = append(listed, item)
+	}
+	return nil, umailData.MailboxError(mailbox, listed, err)
+}
+
+// searchImapEmails Returns the sequence numbers of the emails of the selected mailbox (that contains a given number of
+// emails) that match a filter, from a given UID. The server evaluates the criteria (SEARCH), unless no criterion is
+// given.
+func searchImapEmails(imapClient *imapclient.Client, mailbox string, count uint32, filter umailData.EmailFilter, firstUid uint32) ([]uint32, error) {
+	var err error
+	var criteria imap.SearchCriteria
+	var data *imap.SearchData
+	var seqNums []uint32
+
+	if filter.IsEmpty() && firstUid <= 1 {
+		for i := uint32(1); i <= count; i++ {
+			seqNums = append(seqNums, i)
+		}
+		return seqNums, nil
+	}
+	for _, field := range []imap.SearchCriteriaHeaderField{
+		{Key: "From", Value: filter.From},
+		{Key: "Subject", Value: filter.Subject},
+	} {
+		if len(field.Value) > 0 {
+			criteria.Header = append(criteria.Header, field)
+		}
+	}
+	if len(filter.HeaderName) > 0 {
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: filter.HeaderName, Value: filter.HeaderValue})
+	}
+	if len(filter.Marker) > 0 {
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "Message-ID", Value: filter.Marker})
+	}
+	criteria.Since = filter.Since
+	criteria.Before = filter.Before
+	if len(filter.SkipKeyword) > 0 {
+		criteria.NotFlag = []imap.Flag{imap.Flag(filter.SkipKeyword)}
+	}
+	if firstUid > 1 {
+		criteria.UID = []imap.SeqSet{imap.SeqSetRange(firstUid, 0)}
+	}
+	if data, err = imapClient.Search(&criteria, nil).Wait(); err != nil {
+		return nil, fmt.Errorf("cannot search the emails of \"%s\": %s", mailbox, err.Error())
+	}
+	return data.AllNums(), nil
+}
+
+func processCheckBounces() error {
+	var err error
+	var user string
+	var password string
+	var imapServerAddress string
+	var imapServerPort int
+	var pin string
+	var insecure bool
+	var mailbox string
+	var repair bool
+	var sessionNames []string
+	var owners = map[string]string{}
+	var messageIDs []string
+	var imapClient *imapclient.Client
+	var bounces []*umailData.Bounce
+	var bySession = map[string][]*umailData.Bounce{}
+	var repaired int
+
+	// Parse the command line.
+	flag.StringVar(&imapServerAddress, "imap", DefaultImapServerAddress, fmt.Sprintf("address of the IMAP server (default: %s)", DefaultImapServerAddress))
+	flag.IntVar(&imapServerPort, "port", DefaultImapServerPort, fmt.Sprintf("IMAP server port number (default: %d)", DefaultImapServerPort))
+	flag.StringVar(&user, "user", "", "IMAP user (the sender)")
+	flag.StringVar(&password, "password", "", "IMAP password")
+	flag.StringVar(&pin, "pin", "", "SHA-256 of the public key of the IMAP server (hexadecimal): the certificate of the server is not verified, but its public key must match")
+	flag.BoolVar(&insecure, "insecure", false, "do not verify the certificate of the IMAP server (not recommended)")
+	flag.StringVar(&mailbox, "mailbox", "INBOX", "mailbox that receives the delivery status notifications")
+	flag.BoolVar(&repair, "repair", false, `mark the emails that bounced as failed, so that they can be sent again (see "resume-session")`)
+	flag.Parse()
+
+	// Collect the message IDs of the emails sent (all the sessions, by default).
+	if sessionNames = flag.Args(); len(sessionNames) == 0 {
+		if sessionNames, err = sessionStore.ListSessions(); err != nil {
+			return err
+		}
+	}
+	for _, sessionName := range sessionNames {
+		var session umailData.Session
+		if err = loadSession(sessionName, &session); err != nil {
+			return err
+		}
+		for _, messageID := range session.SentMessageIDs() {
+			owners[messageID] = sessionName
+			messageIDs = append(messageIDs, messageID)
+		}
+	}
+	if len(messageIDs) == 0 {
+		fmt.Printf("No email to check.\n")
+		return nil
+	}
+
+	// Search for the notifications.
+	if imapClient, err = openImap(imapServerAddress, imapServerPort, connectOptions{pin: pin, insecure: insecure}, umailData.DefaultTimeouts, user, password, false); err != nil {
+		return err
+	}
+	defer imapClient.Close()
+	if bounces, err = searchImapBounces(imapClient, mailbox, messageIDs); err != nil {
+		return err
+	}
+	if err = imapClient.Logout().Wait(); nil != err {
+		return fmt.Errorf("cannot logout: %s", err.Error())
+	}
+	for _, bounce := range bounces {
+		bySession[owners[bounce.MessageID]] = append(bySession[owners[bounce.MessageID]], bounce)
+	}
+
+	// Report (and repair) the emails that bounced, session by session.
+	for _, sessionName := range sessionNames {
+		var session umailData.Session
+		var lock *umailData.SessionLock
+		var changed bool
+
+		if len(bySession[sessionName]) == 0 {
+			continue
+		}
+		if repair {
+			if lock, err = lockSession(sessionName); err != nil {
+				return err
+			}
+		}
+		if err = loadSession(sessionName, &session); err == nil {
+			for _, bounce := range bySession[sessionName] {
+				var email = session.FindBounced(bounce)
+				if email == nil {
+					continue
+				}
+				if email.Copy {
+					fmt.Printf("%s: %s: email %d: a copy bounced (%s): %s\n", sessionName, email.Recipient, email.Index, strings.Join(bounce.Recipients, ", "), bounce.Reason)
+					continue
+				}
+				fmt.Printf("%s: %s: email %d: bounced: %s\n", sessionName, email.Recipient, email.Index, bounce.Reason)
+				if repair {
+					if err = session.SetBounced(email, bounce.Reason); err != nil {
+						break
+					}
+					changed = true
+					repaired++
+				}
+			}
+			if err == nil && changed {
+				err = saveSession(sessionName, &session)
+			}
+		}
+		if lock != nil {
+			lock.Unlock()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Number of emails checked: %d, bounces found: %d\n", len(messageIDs), len(bounces))
+	if repaired > 0 {
+		fmt.Printf("Number of emails marked as failed: %d (see \"resume-session\")\n", repaired)
+	}
+	return nil
+}
+
+// searchImapBounces Searches a mailbox (IMAP) for the delivery status notifications that refer to given message IDs,
+// and returns the failures they report.
+func searchImapBounces(imapClient *imapclient.Client, mailbox string, messageIDs []string) ([]*umailData.Bounce, error) {
+	var err error
+	var known = map[string]bool{}
+	var found = map[uint32]bool{}
+	var numbers []uint32
+	var bounces []*umailData.Bounce
+
+	if _, err = selectImapMailbox(imapClient, mailbox); err != nil {
+		return nil, err
+	}
+	for _, messageID := range messageIDs {
+		var data *imap.SearchData
+		var criteria = imap.SearchCriteria{Text: []string{strings.Trim(messageID, "<>")}}
+
+		known[messageID] = true
+		if data, err = imapClient.Search(&criteria, nil).Wait(); err != nil {
+			return nil, fmt.Errorf("cannot search mailbox \"%s\": %s", mailbox, err.Error())
+		}
+		for _, number := range data.AllNums() {
+			if !found[number] {
+				found[number] = true
+				numbers = append(numbers, number)
+			}
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	// Only the notifications are kept (the replies of the recipients may also refer to the message IDs).
+	for _, number := range numbers {
+		var messages []*imapclient.FetchMessageBuffer
+		var bounce *umailData.Bounce
+
+		if messages, err = retrieveEmailMessages(imapClient, imap.SeqSetNum(number)); err != nil {
+			return nil, fmt.Errorf("cannot fetch messages from \"%s\": %s", mailbox, err.Error())
+		}
+		for _, message := range messages {
+			for section, content := range message.BodySection {
+				if section.Specifier != imap.PartSpecifierNone {
+					continue
+				}
+				if bounce, err = umailData.ParseBounce(content); err != nil || bounce == nil {
+					continue
+				}
+				if known[bounce.MessageID] {
+					bounces = append(bounces, bounce)
+				}
+			}
+		}
+	}
+	return bounces, nil
+}
+
+func processSelfTest() error {
+	var err error
+	var from string
+	var to string
+	var password string
+	var user string
+	var smtpServerAddress string
+	var smtpServerPort int
+	var imapServerAddress string
+	var imapServerPort int
+	var pin string
+	var proxy string
+	var insecure bool
+	var oauth bool
+	var transport string
+	var bodyPath string
+	var messagePath string
+	var timeout time.Duration
+	var poll time.Duration
+	var args []string
+	var account *umailData.Account
+	var message = make([]byte, 8)
+	var keyMaterial []byte
+	var key resource.KeySource
+	var session umailData.Session
+	var bodies *coverBodies
+	var sender *mailer
+	var messageIDs []string
+	var received [][]string
+	var imapClient *imapclient.Client
+	var boundaries [][]byte
+
+	// Parse the command line.
+	flag.StringVar(&smtpServerAddress, "smtp", DefaultSmtpServerAddress, fmt.Sprintf("address of the SMTP server (default: %s)", DefaultSmtpServerAddress))
+	flag.IntVar(&smtpServerPort, "port", DefaultSmtpPort, fmt.Sprintf("SMTP server port number (default: %d)", DefaultSmtpPort))
+	flag.StringVar(&pin, "pin", "", "SHA-256 of the public key of the SMTP server (hexadecimal): the certificate of the server is not verified, but its public key must match")
+	flag.StringVar(&proxy, "proxy", "", `URL of a SOCKS5 proxy the connection to the SMTP server goes through ("socks5://[user:password@]host:port")`)
+	flag.StringVar(&transport, "transport", umailData.TransportSmtp, fmt.Sprintf(`how the emails are sent: "%s", "%s" (Gmail API) or "%s" (Microsoft Graph API)`, umailData.TransportSmtp, umailData.TransportGmail, umailData.TransportGraph))
+	flag.BoolVar(&oauth, "oauth", false, "authenticate using the OAuth2 token of the sender (see \"oauth-login\") instead of a password (SMTP only)")
+	flag.StringVar(&imapServerAddress, "imap", DefaultImapServerAddress, fmt.Sprintf("address of the IMAP server (default: %s)", DefaultImapServerAddress))
+	flag.IntVar(&imapServerPort, "imap-port", DefaultImapServerPort, fmt.Sprintf("IMAP server port number (default: %d)", DefaultImapServerPort))
+	flag.StringVar(&user, "user", "", "IMAP user (default: the recipient)")
+	flag.StringVar(&password, "password", "", "password used for authentication (SMTP and IMAP)")
+	flag.BoolVar(&insecure, "insecure", false, "do not verify the certificates of the servers (not recommended)")
+	flag.StringVar(&bodyPath, "body", DefaultBodyFile, fmt.Sprintf("path to the file that contains the email's body (default: %s)", DefaultBodyFile))
+	flag.StringVar(&messagePath, "message", "", "path to the file that contains the message to hide (default: a random message)")
+	flag.DurationVar(&timeout, "timeout", 5*time.Minute, "maximum time waited for the emails")
+	flag.DurationVar(&poll, "poll", 15*time.Second, "time waited between two searches of the mailbox")
+	flag.Parse()
+
+	if len(flag.Args()) < 1 || len(flag.Args()) > 2 {
+		return fmt.Errorf(`invalid number of arguments (%d instead of 1 or 2)`, len(flag.Args()))
+	}
+	if timeout <= 0 || poll <= 0 {
+		return fmt.Errorf(`invalid parameters (timeout: %s, poll: %s)`, timeout, poll)
+	}
+	if account, args, err = sendingAccount(&session, "selftest", smtpServerAddress, smtpServerPort, pin, transport, proxy, "", flag.Args()); err != nil {
+		return err
+	}
+	if err = checkTransport(account, password); err != nil {
+		return err
+	}
+	from = account.From
+	if to = from; len(args) > 0 {
+		to = args[0]
+	}
+	if len(user) == 0 {
+		if user, err = umailData.EnvelopeAddress(to); err != nil {
+			return err
+		}
+	}
+
+	// The message, the key and the session only exist in memory: they are lost once the test is done.
+	if len(messagePath) > 0 {
+		if message, err = os.ReadFile(messagePath); err != nil {
+			return fmt.Errorf(`cannot load the message from file "%s": %s`, messagePath, err.Error())
+		}
+	} else {
+		if _, err = rand.Read(message); err != nil {
+			return err
+		}
+		message = []byte(fmt.Sprintf("umail self-test %x", message))
+	}
+	keyMaterial = make([]byte, 2*len(message)+4096)
+	if _, err = rand.Read(keyMaterial); err != nil {
+		return err
+	}
+	if key, err = resource.NewMemoryPool(keyMaterial, 0); err != nil {
+		return err
+	}
+	if err = session.InitEncoded("selftest", key, message, boundaryLength, umailData.Encoding{Authenticated: true}); err != nil {
+		return err
+	}
+
+	// Send the emails.
+	bodies = newCoverBodies(bodyPath)
+	sender = &mailer{account: account, password: password, oauth: oauth, insecure: insecure, timeouts: umailData.DefaultTimeouts, retries: 3, delay: 5 * time.Second}
+	if err = sender.open(); err != nil {
+		return err
+	}
+	for i, boundary := range session.Boundaries {
+		var messageId string
+		var body []byte
+
+		if _, body, err = bodies.get(&session, to, i); err != nil {
+			return err
+		}
+		if messageId, err = sender.Send(from, to, mime.QEncoding.Encode("utf-8", fmt.Sprintf("Test %d/%d", i+1, len(session.Boundaries))), boundary, body, sessionStyle(&session, session.Deliveries, i)); err != nil {
+			return fmt.Errorf(`cannot send email %d: %s`, i, err.Error())
+		}
+		fmt.Printf("Email %d sent (message ID: %s).\n", i, messageId)
+		messageIDs = append(messageIDs, messageId)
+	}
+	if err = sender.quit(); err != nil {
+		return err
+	}
+
+	// Retrieve the emails.
+	fmt.Printf("Waiting for the emails (%s)...\n", user)
+	if imapClient, err = openImap(imapServerAddress, imapServerPort, connectOptions{insecure: insecure}, umailData.DefaultTimeouts, user, password, false); err != nil {
+		return err
+	}
+	defer imapClient.Close()
+	if received, err = waitImapEmails(imapClient, "INBOX", messageIDs, timeout, poll); err != nil {
+		return err
+	}
+	if err = imapClient.Logout().Wait(); nil != err {
+		return fmt.Errorf("cannot logout: %s", err.Error())
+	}
+
+	// Check the boundaries, then decode them using a fresh copy of the key.
+	for i, levels := range received {
+		var boundary []byte
+		if boundary, err = umailData.ReceivedBoundary(session.Boundaries[i], levels); err != nil {
+			return fmt.Errorf(`email %d: %s`, i, err.Error())
+		}
+		fmt.Printf("Email %d received: the boundary is intact.\n", i)
+		boundaries = append(boundaries, boundary)
+	}
+	if key, err = resource.NewMemoryPool(keyMaterial, 0); err != nil {
+		return err
+	}
+	if err = umailData.CheckDecoded(boundaries, key, message); err != nil {
+		return err
+	}
+	fmt.Printf("Success: the hidden message (%d bytes) has been decoded, and it matches the original message.\n", len(message))
+	return nil
+}
+
+// waitImapEmails Waits for emails, identified by their message IDs, to arrive into a mailbox (IMAP), and returns their
+// boundaries (see `umailData.Carriers.EmailBoundaries`), in the order of the message IDs. The mailbox is searched every `poll`, until all
+// the emails are found or until the timeout expires.
+func waitImapEmails(imapClient *imapclient.Client, mailbox string, messageIDs []string, timeout time.Duration, poll time.Duration) ([][]string, error) {
+	var err error
+	var result = make([][]string, len(messageIDs))
+	var missing = len(messageIDs)
+	var deadline = time.Now().Add(timeout)
+
+	for {
+		if _, err = selectImapMailbox(imapClient, mailbox); err != nil {
+			return nil, err
+		}
+		for i, messageID := range messageIDs {
+			var data *imap.SearchData
+			var criteria = imap.SearchCriteria{Header: []imap.SearchCriteriaHeaderField{{Key: "Message-ID", Value: strings.Trim(messageID, "<>")}}}
+			var messages []*imapclient.FetchMessageBuffer
+
+			if result[i] != nil {
+				continue
+			}
+			if data, err = imapClient.Search(&criteria, nil).Wait(); err != nil {
+				return nil, fmt.Errorf("cannot search mailbox \"%s\": %s", mailbox, err.Error())
+			}
+			if len(data.AllNums()) == 0 {
+				continue
+			}
+			if messages, err = retrieveEmailMessages(imapClient, imap.SeqSetNum(data.AllNums()[0])); err != nil {
+				return nil, fmt.Errorf("cannot fetch messages from \"%s\": %s", mailbox, err.Error())
+			}
+			if len(messages) == 0 {
+				continue
+			}
+			if result[i], err = retrieveBoundaries(messages[0]); err != nil {
+				return nil, fmt.Errorf(`email %d: %s`, i, err.Error())
+			}
+			if result[i] == nil {
+				return nil, fmt.Errorf(`email %d: the boundary has been removed`, i)
+			}
+			missing--
 		}
-		if "TEXT" == data.Specifier {
-			email.Body = string(buf)
+		if missing == 0 {
+			return result, nil
 		}
+		if time.Now().Add(poll).After(deadline) {
+			return nil, fmt.Errorf(`%d email(s) not received after %s (see the spam folder)`, missing, timeout)
+		}
+		time.Sleep(poll)
 	}
-	emailText = fmt.Sprintf("%s\r\n\r\n%s", email.Header, email.Body)
-	r = strings.NewReader(emailText)
-	m, err = mail.ReadMessage(r)
-	if err != nil {
+}
+
+// openPop3 Opens a connection to a POP3 server (TLS), and authenticates.
+func openPop3(pop3ServerAddress string, pop3ServerPort int, connect connectOptions, timeouts umailData.Timeouts, user string, password string) (*umailData.Pop3Client, error) {
+	var err error
+	var pop3Uri = fmt.Sprintf("%s:%d", pop3ServerAddress, pop3ServerPort)
+	var pop3TlsConfig = connect.config(pop3ServerAddress)
+	var connection *tls.Conn
+	var pop3Client *umailData.Pop3Client
+
+	pop3TlsConfig.NextProtos = []string{"pop3"}
+	if connection, _, err = dialTls(pop3Uri, connect.proxy, pop3TlsConfig, timeouts); err != nil {
+		return nil, fmt.Errorf("cannot open connection to POP3 server at \"%s\": %s", pop3Uri, err.Error())
+	}
+	if pop3Client, err = umailData.NewPop3Client(connection); err != nil {
+		connection.Close()
 		return nil, err
 	}
-	return m, nil
+	if err = pop3Client.Login(user, password); err != nil {
+		pop3Client.Close()
+		return nil, err
+	}
+	return pop3Client, nil
 }
 
-func retrieveBoundary(message *imapclient.FetchMessageBuffer) (*string, error) {
+// listPop3Emails Lists the emails of a POP3 mailbox that match a filter and that have a boundary, and returns their
+// boundaries (indexed by their numbers). The header of an email is retrieved first (TOP): the email is only retrieved
+// if its header matches the filter and gives a boundary. Only the emails that were not in the mailbox when its state
+// was recorded are listed (see `umailData.MailboxState`). The current state of the mailbox is returned. The emails are
+// left on the server.
+func listPop3Emails(pop3ServerAddress string, pop3ServerPort int, connect connectOptions, timeouts umailData.Timeouts, user string, password string, filter umailData.EmailFilter, window umailData.EmailWindow, state umailData.MailboxState, full bool) (map[emailIndex]emailCandidate, umailData.MailboxState, error) {
 	var err error
-	var m *mail.Message
-	var header mail.Header
-	var ok bool
-	var contentType []string
-	var matches []string
+	var pop3Client *umailData.Pop3Client
+	var messages []umailData.Pop3Message
+	var processed = map[string]bool{}
+	var numbers []emailIndex
+	var uids []string
+	var candidates = map[emailIndex]emailCandidate{}
 
-	if m, err = parseMessage(message); err != nil {
-		return nil, err
+	if pop3Client, err = openPop3(pop3ServerAddress, pop3ServerPort, connect, timeouts, user, password); err != nil {
+		return nil, state, err
 	}
-	header = m.Header
-	if contentType, ok = header["Content-Type"]; !ok {
-		return nil, nil
+	defer pop3Client.Close()
+
+	if messages, err = pop3Client.Uidl(); err != nil {
+		return nil, state, fmt.Errorf("cannot list the emails: %s", err.Error())
 	}
-	if len(contentType) == 0 {
-		return nil, nil
+	if len(state.Uidls) > 0 {
+		fmt.Printf("Only the emails received since the last reception are listed (see \"--rescan\").\n\n")
 	}
-	if len(contentType) > 1 {
-		return nil, fmt.Errorf(`unexpected "Content-Type" header value (more than one values)`)
+	for _, uid := range state.Uidls {
+		processed[uid] = true
 	}
-	matches = boundaryRegex.FindStringSubmatch(contentType[0])
-	if matches == nil {
-		return nil, nil
+	for _, message := range messages {
+		uids = append(uids, message.Uid)
+		if !processed[message.Uid] {
+			numbers = append(numbers, emailIndex(message.Number))
+		}
 	}
-	return &matches[boundaryRegex.SubexpIndex("boundary")], nil
-}
+	numbers = applyEmailWindow(window, numbers)
+	state = umailData.MailboxState{Uidls: uids}
 
-// retrieveFullEmail Retrieves an email identified by its sequence number.
-func retrieveFullEmail(messages []*imapclient.FetchMessageBuffer) (*string, error) {
-	var err error
-	var content []string
-	var result string
+	fmt.Printf("EMAILS:\n\n")
 
-	for i, message := range messages {
+	for _, number := range numbers {
+		var content []byte
 		var m *mail.Message
-		var header mail.Header
+		var boundary *string
+		var boundaries []string
 		var body []byte
+		var date time.Time
+		var subject, from string
+		var to, cc []string
 
-		if m, err = parseMessage(message); err != nil {
-			return nil, err
+		// First, the header: only the emails whose "Content-Type" header gives a boundary are retrieved.
+		if content, err = pop3Client.Top(int(number)); err != nil {
+			return nil, state, fmt.Errorf("cannot retrieve the header of the email %d: %s", number, err.Error())
+		}
+		if m, err = mail.ReadMessage(bytes.NewReader(content)); err != nil {
+			return nil, state, err
+		}
+		if boundary, err = umailData.HeaderBoundary(m.Header); err != nil {
+			return nil, state, err
+		}
+		if boundary == nil {
+			continue
+		}
+		date, subject, from, to, cc = headerEnvelope(m.Header)
+		if !filter.MatchEnvelope(from, subject, date) || !filter.MatchHeader(textproto.MIMEHeader(m.Header)) {
+			continue
 		}
 
-		content = append(content, fmt.Sprintf("       [%0d] UID:%05d", i, message.UID))
-		content = append(content, []string{fmt.Sprintf("           Flags: %v", message.Flags), ""}...)
-
-		header = m.Header
-		for k, v := range header {
-			content = append(content, fmt.Sprintf("* %s: %s", k, v))
+		if content, err = pop3Client.Retr(int(number)); err != nil {
+			return nil, state, fmt.Errorf("cannot retrieve the email %d: %s", number, err.Error())
 		}
+		if m, err = mail.ReadMessage(bytes.NewReader(content)); err != nil {
+			return nil, state, err
+		}
+		if body, err = io.ReadAll(m.Body); err != nil {
+			return nil, state, err
+		}
+		if boundaries, err = receiveCarriers.EmailBoundaries(content); err != nil {
+			return nil, state, err
+		}
+		if boundaries == nil {
+			continue
+		}
+		candidates[number] = emailCandidate{boundaries: boundaries, sent: date, from: from, subject: subject}
+		printEmailSummary(number, date, subject, from, to, cc, boundaries)
 
-		body, err = io.ReadAll(m.Body)
-		if err != nil {
-			return nil, err
+		if full {
+			for k, v := range m.Header {
+				fmt.Printf("* %s: %s\r\n", k, v)
+			}
+			fmt.Printf("%s\n\n", body)
 		}
-		content = append(content, string(body))
 	}
 
-	result = strings.Join(content, "\r\n")
-	return &result, nil
+	if err = pop3Client.Quit(); err != nil {
+		return nil, state, fmt.Errorf("cannot quit: %s", err.Error())
+	}
+	return candidates, state, nil
 }
 
-func getEmails(indexBoundary map[emailIndex]string) ([]emailIndex, error) {
+// listJmapEmails Lists the emails of a mailbox that match a filter and that have a boundary, using JMAP, and returns
+// their boundaries (indexed by their positions in the mailbox, the oldest first). The server is given by the URL of its
+// session resource. The token of the account is the password, or the OAuth2 token of the user if no password is
+// given. Only the emails whose "Content-Type" header gives a boundary are downloaded. Only the emails that were not in
+// the mailbox when its state was recorded are listed (see `umailData.MailboxState`): the current state of the mailbox
+// is returned.
+func listJmapEmails(sessionURL string, user string, password string, mailbox string, filter umailData.EmailFilter, window umailData.EmailWindow, state umailData.MailboxState, full bool) (map[emailIndex]emailCandidate, umailData.MailboxState, error) {
 	var err error
-	var response string
-	var emailsText []string
-	var emails []emailIndex
-	var reader = bufio.NewReader(os.Stdin)
+	var token = password
+	var jmapClient *umailData.JmapClient
+	var mailboxId string
+	var ids []string
+	var emails []umailData.JmapEmail
+	var processed = map[string]bool{}
+	var indexes []emailIndex
+	var candidates = map[emailIndex]emailCandidate{}
 
-	fmt.Printf("List of emails to process (type 'x' to quit):\n")
-	response, err = reader.ReadString('\n')
-	if err != nil {
-		return nil, err
+	if len(token) == 0 {
+		if token, err = oauthAccessToken(user); err != nil {
+			return nil, state, err
+		}
 	}
-	response = strings.ToLower(response)
-	response = strings.TrimSpace(response)
-	response = trimmerRegex.ReplaceAllString(response, " ")
-	if response == "x" {
-		return nil, nil
+	if jmapClient, err = umailData.NewJmapClient(&http.Client{Timeout: apiTimeout}, sessionURL, token); err != nil {
+		return nil, state, err
 	}
-	emailsText = strings.Split(response, " ")
-
-	for _, v := range emailsText {
-		index, err := strconv.ParseUint(v, 10, 32)
-		if err != nil {
-			return nil, fmt.Errorf(`invalid email index (%s). It should be an integer`, v)
-		}
-		_, ok := indexBoundary[uint32(index)]
-		if !ok {
-			return nil, fmt.Errorf(`unexpecter email index (%d)`, index)
+	if mailboxId, err = jmapClient.MailboxId(mailbox); err != nil {
+		return nil, state, err
+	}
+	if ids, err = jmapClient.QueryEmails(mailboxId, filter); err != nil {
+		return nil, state, fmt.Errorf("cannot list the emails of the mailbox \"%s\": %s", mailbox, err.Error())
+	}
+	if emails, err = jmapClient.GetEmails(ids); err != nil {
+		return nil, state, fmt.Errorf("cannot list the emails of the mailbox \"%s\": %s", mailbox, err.Error())
+	}
+	if len(state.Uidls) > 0 {
+		fmt.Printf("Only the emails received since the last reception are listed (see \"--rescan\").\n\n")
+	}
+	for _, id := range state.Uidls {
+		processed[id] = true
+	}
+	state = umailData.MailboxState{}
+	for i, email := range emails {
+		state.Uidls = append(state.Uidls, email.Id)
+		if !processed[email.Id] && filter.MatchEnvelope(email.From, email.Subject, email.Received) {
+			indexes = append(indexes, emailIndex(i+1))
 		}
-		emails = append(emails, uint32(index))
 	}
-	return emails, nil
-}
+	indexes = applyEmailWindow(window, indexes)
 
-func getYesNo(message string) (*bool, error) {
-	var err error
-	var response string
-	var reader = bufio.NewReader(os.Stdin)
-	var result bool
+	fmt.Printf("EMAILS:\n\n")
 
-	fmt.Print(message + " ")
-	for {
-		response, err = reader.ReadString('\n')
-		if err != nil {
-			return nil, err
+	for _, index := range indexes {
+		var email = emails[index-1]
+		var boundary *string
+		var content []byte
+		var m *mail.Message
+		var boundaries []string
+		var body []byte
+
+		// Only the emails whose "Content-Type" header gives a boundary are downloaded.
+		if boundary, err = umailData.HeaderBoundary(mail.Header{"Content-Type": {email.ContentType}}); err != nil {
+			return nil, state, err
 		}
-		response = strings.ToLower(response)
-		response = strings.TrimSpace(response)
-		if response != "y" && response != "n" {
-			fmt.Printf("Invalid response (%s). Valid response: \"y\" or \"n\"\n", response)
+		if boundary == nil {
 			continue
 		}
-		break
-	}
-	result = response == "y"
-	return &result, nil
-}
-
-func getKey(message string) (*resource.Pool, error) {
-	var err error
-	var reader = bufio.NewReader(os.Stdin)
-	var pool *resource.Pool
-
-	fmt.Print(message + " ")
-	for {
-		var poolName string
-		var poolPath string
-
-		poolName, err = reader.ReadString('\n')
-		if err != nil {
-			return nil, err
+		if content, err = jmapClient.Download(email.BlobId); err != nil {
+			return nil, state, fmt.Errorf("cannot download the email %d: %s", index, err.Error())
 		}
-		poolName = strings.TrimSpace(poolName)
-		poolPath = filepath.Join(keyDir, poolName)
-		if pool, err = resource.PoolOpen(poolPath); err != nil {
-			fmt.Printf("Cannot open the key \"%s\" (path: %s): %s", poolName, poolPath, err.Error())
+		if m, err = mail.ReadMessage(bytes.NewReader(content)); err != nil {
+			return nil, state, err
+		}
+		if !filter.MatchHeader(textproto.MIMEHeader(m.Header)) {
 			continue
 		}
-		break
+		if body, err = io.ReadAll(m.Body); err != nil {
+			return nil, state, err
+		}
+		if boundaries, err = receiveCarriers.EmailBoundaries(content); err != nil {
+			return nil, state, err
+		}
+		if boundaries == nil {
+			continue
+		}
+		candidates[index] = emailCandidate{boundaries: boundaries, sent: email.Sent, from: email.From, subject: email.Subject}
+		printEmailSummary(index, email.Received, email.Subject, email.From, email.To, email.Cc, boundaries)
+
+		if full {
+			for k, v := range m.Header {
+				fmt.Printf("* %s: %s\r\n", k, v)
+			}
+			fmt.Printf("%s\n\n", body)
+		}
 	}
-	return pool, nil
+	return candidates, state, nil
 }
 
-func showMessage(boundaries []string) (*string, error) {
+// listGmailEmails Lists the emails of a label (the Gmail equivalent of a mailbox) that match a filter and that have a
+// boundary, using the Gmail API and the OAuth2 token of the user, and returns their boundaries (indexed by their
+// positions in the label, the oldest first). Only the emails whose "Content-Type" header gives a boundary are
+// downloaded. Only the emails that were not in the label when its state was recorded are listed (see
+// `umailData.MailboxState`): the current state of the label is returned.
+func listGmailEmails(user string, mailbox string, filter umailData.EmailFilter, window umailData.EmailWindow, state umailData.MailboxState, full bool) (map[emailIndex]emailCandidate, umailData.MailboxState, error) {
 	var err error
-	var pool *resource.Pool
-	var key *[][]byte
-	var clearMessage []byte
-	var messageLength uint16
-	var hiddenMessage []byte
-
-	// Load the pool.
-	if pool, err = getKey("Enter the name of the key to use:"); err != nil {
-		return nil, err
-	}
-	defer pool.Close()
+	var accessToken string
+	var gmailClient *umailData.GmailClient
+	var labelId string
+	var ids []string
+	var processed = map[string]bool{}
+	var indexes []emailIndex
+	var candidates = map[emailIndex]emailCandidate{}
 
-	// Extract the required number of bytes from the pool.
-	if key, err = pool.GetBytesAsChunks(int64(len(boundaries)), boundaryLength); err != nil {
-		return nil, fmt.Errorf(`not enough bytes left into the key file (needed %d bytes)`, len(boundaries)*boundaryLength)
+	if accessToken, err = oauthAccessToken(user); err != nil {
+		return nil, state, err
 	}
-
-	// Decrypt all boundaries.
-	for i, boundary := range boundaries {
-		var boundaryBytes []byte
-		if boundaryBytes, err = hex.DecodeString(boundary); err != nil {
-			return nil, fmt.Errorf(`invalid boundary (invalid email): does not represent a hexadecimal string`)
-		}
-		clearMessage = append(clearMessage, cypher((*key)[i], boundaryBytes)...)
+	gmailClient = umailData.NewGmailClient(&http.Client{Timeout: apiTimeout}, umailData.GmailURL, accessToken)
+	if labelId, err = gmailClient.LabelId(mailbox); err != nil {
+		return nil, state, err
 	}
-
-	// Please, keep in mind that the message starts with an `uint16` which represents the length of the message.
-	if err = binary.Read(bytes.NewReader(clearMessage), binary.LittleEndian, &messageLength); err != nil {
-		return nil, err
+	if ids, err = gmailClient.QueryMessages(labelId, filter); err != nil {
+		return nil, state, fmt.Errorf("cannot list the emails of the label \"%s\": %s", mailbox, err.Error())
 	}
-	fmt.Printf("Lenght of the (hidden) message: %d\n", messageLength)
-
-	hiddenMessage = clearMessage[2 : 2+messageLength]
-	fmt.Printf("The hidden message is:\n\n%s\n\n", hiddenMessage)
-	return nil, nil
-}
-
-func processGetFullEmails() error {
-	var err error
-	var user string
-	var password string
-	var imapServerAddress string
-	var imapServerPort int
-	var from string
-	var full bool
-	var showMailboxes bool
-	var imapClient *imapclient.Client
-	var imapUri string
-	var selectedMbox *imap.SelectData
-	var indexBoundary = map[emailIndex]string{}
-	var boundaries []string
-	var emails []emailIndex
-	var proceed *bool
-
-	// Parse the command line.
-	flag.StringVar(&imapServerAddress, "imap", DefaultImapServerAddress, fmt.Sprintf("address of the IMAP server (default: %s)", DefaultImapServerAddress))
-	flag.IntVar(&imapServerPort, "port", DefaultImapServerPort, fmt.Sprintf("SMTP server port number (default: %d)", DefaultImapServerPort))
-	flag.StringVar(&user, "user", "", fmt.Sprintf("imap user"))
-	flag.StringVar(&password, "password", "", "sender password used for authentication")
-	flag.StringVar(&from, "from", "", "sender email address")
-	flag.BoolVar(&full, "full", false, "print all the email (not only the envelope)")
-	flag.BoolVar(&showMailboxes, "show-mailboxes", false, "list the mailboxes")
-	flag.Parse()
-
-	imapUri = fmt.Sprintf("%s:%d", imapServerAddress, imapServerPort)
-	if imapClient, err = imapclient.DialTLS(imapUri, nil); nil != err {
-		return fmt.Errorf("cannot open connection to IMAP server at \"%s\": %s", imapUri, err.Error())
+	if len(state.Uidls) > 0 {
+		fmt.Printf("Only the emails received since the last reception are listed (see \"--rescan\").\n\n")
 	}
-	defer imapClient.Close()
-	if err = imapClient.Login(user, password).Wait(); nil != err {
-		return fmt.Errorf("annot authenticate as \"%s\" (password: %s): %s", user, password, err.Error())
+	for _, id := range state.Uidls {
+		processed[id] = true
 	}
-
-	if showMailboxes {
-		var mailboxes []*imap.ListData
-
-		fmt.Printf("MAILBOXES:\n\n")
-		if mailboxes, err = imapClient.List("", "%", nil).Collect(); nil != err {
-			return fmt.Errorf("cannot get the list of mailboxes: %s", err.Error())
-		}
-		for _, mbox := range mailboxes {
-			fmt.Printf("  [%s]\n", mbox.Mailbox)
+	state = umailData.MailboxState{Uidls: ids}
+	for i, id := range ids {
+		if !processed[id] {
+			indexes = append(indexes, emailIndex(i+1))
 		}
-		fmt.Printf("\n")
-	}
-
-	if selectedMbox, err = imapClient.Select("INBOX", nil).Wait(); err != nil {
-		fmt.Printf("Cannot select mailbox \"INBOX\": %s", err.Error())
 	}
+	indexes = applyEmailWindow(window, indexes)
 
 	fmt.Printf("EMAILS:\n\n")
 
-	var i uint32
-	for i = 1; i <= selectedMbox.NumMessages; i++ {
-		var addresses []string
-		var ccs []string
-		var seqSet imap.SeqSet
-		var messages []*imapclient.FetchMessageBuffer
-		var content *string
+	for _, index := range indexes {
+		var message umailData.GmailMessage
 		var boundary *string
+		var content []byte
+		var m *mail.Message
+		var boundaries []string
+		var body []byte
+		var date time.Time
+		var subject, from string
+		var to, cc []string
 
-		seqSet = imap.SeqSetNum(i)
-
-		if messages, err = retrieveEmailMessages(imapClient, seqSet); err != nil {
-			return fmt.Errorf("cannot fetch messages from \"INBOX\": %s", err.Error())
+		// First, the headers: only the emails whose "Content-Type" header gives a boundary are downloaded.
+		if message, err = gmailClient.GetMessage(ids[index-1]); err != nil {
+			return nil, state, fmt.Errorf("cannot retrieve the header of the email %d: %s", index, err.Error())
 		}
-		if from != "" && from != messages[0].Envelope.From[0].Addr() {
-			continue
+		if boundary, err = umailData.HeaderBoundary(message.Header); err != nil {
+			return nil, state, err
 		}
-		for _, a := range messages[0].Envelope.Cc {
-			ccs = append(ccs, a.Addr())
+		if boundary == nil {
+			continue
 		}
-		for _, a := range messages[0].Envelope.To {
-			addresses = append(addresses, a.Addr())
+		date, subject, from, to, cc = headerEnvelope(message.Header)
+		if !filter.MatchEnvelope(from, subject, message.Received) || !filter.MatchHeader(textproto.MIMEHeader(message.Header)) {
+			continue
 		}
 
-		if boundary, err = retrieveBoundary(messages[0]); err != nil {
-			return err
+		if content, err = gmailClient.Download(message.Id); err != nil {
+			return nil, state, fmt.Errorf("cannot download the email %d: %s", index, err.Error())
 		}
-		if boundary != nil {
-			indexBoundary[i] = *boundary
-
-			fmt.Printf("[%4d] %s (%d)\n", i, messages[0].Envelope.Date.String(), messages[0].Envelope.Date.Unix())
-			fmt.Printf("       Subject: %s\n", messages[0].Envelope.Subject)
-			fmt.Printf("       From: %s\n", messages[0].Envelope.From[0].Addr())
-			fmt.Printf("       To: %s\n", strings.Join(addresses, ", "))
-			if len(ccs) > 0 {
-				fmt.Printf("       Cc: %s\n", strings.Join(ccs, ", "))
-			}
-			fmt.Printf("       Boundary: %s\n", *boundary)
-			fmt.Printf("\n")
-		} else {
+		if m, err = mail.ReadMessage(bytes.NewReader(content)); err != nil {
+			return nil, state, err
+		}
+		if body, err = io.ReadAll(m.Body); err != nil {
+			return nil, state, err
+		}
+		if boundaries, err = receiveCarriers.EmailBoundaries(content); err != nil {
+			return nil, state, err
+		}
+		if boundaries == nil {
 			continue
 		}
+		candidates[index] = emailCandidate{boundaries: boundaries, sent: date, from: from, subject: subject}
+		printEmailSummary(index, message.Received, subject, from, to, cc, boundaries)
 
 		if full {
-			if content, err = retrieveFullEmail(messages); err != nil {
-				return err
+			for k, v := range m.Header {
+				fmt.Printf("* %s: %s\r\n", k, v)
 			}
-			fmt.Printf("%s\n\n", *content)
+			fmt.Printf("%s\n\n", body)
 		}
 	}
+	return candidates, state, nil
+}
 
-	if err := imapClient.Logout().Wait(); nil != err {
-		return fmt.Errorf("cannot logout: %s", err.Error())
-	}
+// headerEnvelope Returns the envelope of an email, given by its header: the date, the subject (decoded), and the
+// addresses of the sender and of the recipients. The values that cannot be parsed are left empty.
+func headerEnvelope(header mail.Header) (time.Time, string, string, []string, []string) {
+	var date, _ = header.Date()
+	var subject = header.Get("Subject")
+	var from string
+	var recipients = map[string][]string{}
 
-	// Ask for the list of emails to process.
-	if emails, err = getEmails(indexBoundary); err != nil {
-		return err
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
 	}
-	if emails == nil {
-		return nil
+	if addresses, err := header.AddressList("From"); err == nil && len(addresses) > 0 {
+		from = addresses[0].Address
 	}
-	sort.SliceStable(emails, func(i, j int) bool {
-		return emails[i] < emails[j]
-	})
-	fmt.Printf("You selected: %s\n", strings.Join(func(p []emailIndex) []string {
-		var r []string
-		for _, v := range p {
-			r = append(r, fmt.Sprintf("%d", v))
+	for _, name := range []string{"To", "Cc"} {
+		var addresses, _ = header.AddressList(name)
+		for _, address := range addresses {
+			recipients[name] = append(recipients[name], address.Address)
 		}
-		return r
-	}(emails), ", "))
+	}
+	return date, subject, from, recipients["To"], recipients["Cc"]
+}
 
-	// Ask for confirmation.
-	if proceed, err = getYesNo("Proceed ? (y/n)"); err != nil {
-		return fmt.Errorf("unexpected error: %s", err)
+// listGraphEmails Lists the emails of a mail folder (Microsoft Graph API) that match a filter and that have a boundary,
+// and returns their boundaries (indexed by their positions in the folder, starting at 1). The folder is given by its
+// well-known name ("inbox", "archive"...) or by its ID. The content of an email is only fetched if its envelope
+// matches the filter, and if it is within the window.
+func listGraphEmails(user string, folder string, filter umailData.EmailFilter, window umailData.EmailWindow, full bool) (map[emailIndex]emailCandidate, error) {
+	var err error
+	var accessToken string
+	var messages []umailData.GraphMessage
+	var indexes []emailIndex
+	var client = &http.Client{Timeout: apiTimeout}
+	var candidates = map[emailIndex]emailCandidate{}
+
+	if accessToken, err = oauthAccessToken(user); err != nil {
+		return nil, err
 	}
-	if *proceed == false {
-		return nil
+	folder = umailData.GraphFolder(folder)
+	if messages, err = umailData.GraphListMessages(client, umailData.GraphURL, accessToken, folder); err != nil {
+		return nil, fmt.Errorf("cannot list the messages of the folder \"%s\": %s", folder, err.Error())
 	}
 
-	// Show the hidden message.
-	for _, emailIndex := range emails {
-		fmt.Printf("[%4d] %s\n", emailIndex, indexBoundary[emailIndex])
-		boundaries = append(boundaries, indexBoundary[emailIndex])
+	for i, message := range messages {
+		if filter.MatchEnvelope(message.From, message.Subject, message.Received) {
+			indexes = append(indexes, emailIndex(i+1))
+		}
 	}
+	indexes = applyEmailWindow(window, indexes)
 
-	_, _ = showMessage(boundaries)
+	fmt.Printf("EMAILS:\n\n")
 
-	return nil
+	for _, index := range indexes {
+		var message = messages[index-1]
+		var content []byte
+		var m *mail.Message
+		var boundaries []string
+		var body []byte
+
+		if content, err = umailData.GraphMessageContent(client, umailData.GraphURL, accessToken, message.Id); err != nil {
+			return nil, fmt.Errorf("cannot fetch the message %d: %s", index, err.Error())
+		}
+		if m, err = mail.ReadMessage(bytes.NewReader(content)); err != nil {
+			return nil, err
+		}
+		if !filter.MatchHeader(textproto.MIMEHeader(m.Header)) {
+			continue
+		}
+		if body, err = io.ReadAll(m.Body); err != nil {
+			return nil, err
+		}
+		if boundaries, err = receiveCarriers.EmailBoundaries(content); err != nil {
+			return nil, err
+		}
+		if boundaries == nil {
+			continue
+		}
+		candidates[index] = emailCandidate{boundaries: boundaries, sent: message.Sent, from: message.From, subject: message.Subject}
+		printEmailSummary(index, message.Received, message.Subject, message.From, message.To, message.Cc, boundaries)
+
+		if full {
+			for k, v := range m.Header {
+				fmt.Printf("* %s: %s\r\n", k, v)
+			}
+			fmt.Printf("%s\n\n", body)
+		}
+	}
+	return candidates, nil
 }
 
 var Actions = map[string]ActionData{
-	"info":           {Description: `print information about the application`, Handler: processInfo},
-	"info-session":   {Description: `print information about a session`, Handler: processSessionInfo},
-	"create-session": {Description: `create a mailing session`, Handler: processCreateSession},
-	"reset-session":  {Description: `reset the session`, Handler: procesSessionReset},
-	"create-key":     {Description: `create an "encryption/decryption" key (from a given file)`, Handler: processCreateKey},
-	"reset-key":      {Description: `rester the pool's pointer position'`, Handler: processPoolReset},
-	"info-key":       {Description: `print information about an "encryption/decryption" key`, Handler: processPoolInfo},
-	"send":           {Description: `send a message`, Handler: processSend},
-	"rcv":            {Description: `retrieve emails`, Handler: processGetFullEmails},
+	"info":              {Description: `print information about the application`, Handler: processInfo},
+	"info-session":      {Description: `print information about a session`, Handler: processSessionInfo},
+	"create-session":    {Description: `create a mailing session`, Handler: processCreateSession},
+	"clone-session":     {Description: `create a new session that hides the message of a given session (using fresh key material)`, Handler: processCloneSession},
+	"reset-session":     {Description: `reset the session`, Handler: procesSessionReset},
+	"protect-session":   {Description: `encrypt a session file using a passphrase (or a key file)`, Handler: processProtectSession},
+	"unprotect-session": {Description: `decrypt a protected session file`, Handler: processUnprotectSession},
+	"verify-session":    {Description: `cross-check a session against its key (and against the original message, if given)`, Handler: processVerifySession},
+	"export-session":    {Description: `write the remaining emails of a session into ".eml" files (to send them using a mail client)`, Handler: processExportSession},
+	"resume-session":    {Description: `send again the emails that could not be sent (marked as failed)`, Handler: processResumeSession},
+	"confirm-session":   {Description: `record that the recipient received the emails sent (all, or a given list)`, Handler: processConfirmSession},
+	"edit-session":      {Description: `modify the metadata of a session (recipient, subject, note)`, Handler: processEditSession},
+	"schedule-session":  {Description: `draw the dates at which the emails of a session are due (see "send --due")`, Handler: processScheduleSession},
+	"import-sessions":   {Description: `import the session files into the database (store "bolt")`, Handler: processImportSessions},
+	"archive-session":   {Description: `move sessions into the archive (compressed)`, Handler: processArchiveSession},
+	"list-sessions":     {Description: `list the sessions (all, or the ones that match given criteria)`, Handler: processListSessions},
+	"purge-sessions":    {Description: `remove (or archive) the sessions that match given criteria`, Handler: processPurgeSessions},
+	"migrate-session":   {Description: `upgrade sessions (all sessions, by default) to the current file format`, Handler: processMigrateSession},
+	"add-body":          {Description: `add bodies (the visible content of the emails) to the managed directory`, Handler: processAddBody},
+	"list-bodies":       {Description: `list the bodies of the managed directory`, Handler: processListBodies},
+	"generate-body":     {Description: `print bodies generated from a corpus`, Handler: processGenerateBody},
+	"body-capacity":     {Description: `print the number of bytes hidden by the trailing whitespaces of bodies (see "--carriers=whitespace")`, Handler: processBodyCapacity},
+	"image-capacity":    {Description: `print the number of bytes hidden by the pixels of cover images (see "--carriers=image")`, Handler: processImageCapacity},
+	"create-key":        {Description: `create an "encryption/decryption" key (from a given file)`, Handler: processCreateKey},
+	"reset-key":         {Description: `rester the pool's pointer position'`, Handler: processPoolReset},
+	"info-key":          {Description: `print information about an "encryption/decryption" key`, Handler: processPoolInfo},
+	"clone-key":         {Description: `copy an "encryption/decryption" key, with the pointer's position preset (for the receiver)`, Handler: processCloneKey},
+	"export-key":        {Description: `export an "encryption/decryption" key as text pages or QR codes`, Handler: processExportKey},
+	"import-key":        {Description: `import an "encryption/decryption" key from text pages`, Handler: processImportKey},
+	"protect-key":       {Description: `encrypt an "encryption/decryption" key using a passphrase`, Handler: processProtectKey},
+	"unprotect-key":     {Description: `decrypt an "encryption/decryption" key protected by a passphrase`, Handler: processUnprotectKey},
+	"shred-key":         {Description: `securely destroy an "encryption/decryption" key`, Handler: processShredKey},
+	"bench-key":         {Description: `measure the performance of "encryption/decryption" keys (on a temporary key)`, Handler: processBenchKey},
+	"append-key":        {Description: `append bytes (from a given file or from a CSPRNG) to an "encryption/decryption" key`, Handler: processAppendKey},
+	"send-all":          {Description: `send all the emails of a session (waiting a given, or random, interval between two emails)`, Handler: processSendAll},
+	"send":              {Description: `send a message`, Handler: processSend},
+	"daemon":            {Description: `send the queued emails (see "send --queue"), within a time window and with random gaps`, Handler: processDaemon},
+	"rcv":               {Description: `retrieve emails`, Handler: processGetFullEmails},
+	"decode":            {Description: `show a hidden message whose emails are stored locally (Maildir or mbox file)`, Handler: processDecode},
+	"decode-eml":        {Description: `show a hidden message whose emails are saved into files (".eml", in the order they were sent)`, Handler: processDecodeEml},
+	"selftest":          {Description: `send a hidden message to yourself, retrieve it (IMAP) and decode it, using a temporary key and session`, Handler: processSelfTest},
+	"check-bounces":     {Description: `search the mailbox of the sender (IMAP) for the emails that bounced (and mark them as failed)`, Handler: processCheckBounces},
+	"oauth-login":       {Description: `get the OAuth2 token used to send (or receive) the emails of an account (XOAUTH2)`, Handler: processOAuthLogin},
 }
 
 func main() {
@@ -880,6 +7943,19 @@ func main() {
 	if err = initEnv(); err != nil {
 		logError([]string{err.Error()})
 	}
+	resource.PassphraseProvider = func(path string) ([]byte, error) {
+		return readPassphrase(fmt.Sprintf("Enter the passphrase for the key \"%s\":", filepath.Base(path)))
+	}
+	umailData.SecretProvider = func(path string) ([]byte, error) {
+		if keyFilePath, ok := os.LookupEnv(sessionKeyFileEnv); ok {
+			return os.ReadFile(keyFilePath)
+		}
+		return readPassphrase(fmt.Sprintf("Enter the passphrase for the session \"%s\":", filepath.Base(path)))
+	}
+
+	if err = initStore(); err != nil {
+		logError([]string{err.Error()})
+	}
 
 	// Check the number of arguments in the command line.
 	if len(os.Args) < 2 {
@@ -896,7 +7972,9 @@ func main() {
 	}
 
 	// Process the action.
-	if err := Actions[action].Handler(); err != nil {
+	err = Actions[action].Handler()
+	sessionStore.Close()
+	if err != nil {
 		logError([]string{err.Error()})
 	}
 }
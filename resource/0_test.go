@@ -19,6 +19,8 @@ func TestMain(m *testing.M) {
 func cleanUp() {
 	_ = os.Remove(sourcePath)
 	_ = os.Remove(poolPath)
+	_ = os.Remove(poolPath + JournalSuffix)
+	_ = os.Remove(poolPath + ReceiverJournalSuffix)
 }
 
 func setup() {
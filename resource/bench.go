@@ -0,0 +1,13 @@
+package resource
+
+import "time"
+
+// Throughput Returns the number of kilobytes (1024 bytes) extracted per second from a pool, given the number of bytes
+// extracted and the time spent. The time is at least one nanosecond (the clock may not move for a short extraction),
+// so that the result is always finite.
+func Throughput(count int64, elapsed time.Duration) float64 {
+	if elapsed < time.Nanosecond {
+		elapsed = time.Nanosecond
+	}
+	return float64(count) / 1024 / elapsed.Seconds()
+}
@@ -0,0 +1,28 @@
+package resource
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestThroughput(t *testing.T) {
+	for _, test := range []struct {
+		count    int64
+		elapsed  time.Duration
+		expected float64
+	}{
+		{count: 2048, elapsed: time.Second, expected: 2},
+		{count: 1024, elapsed: 500 * time.Millisecond, expected: 2},
+		{count: 0, elapsed: time.Second, expected: 0},
+		// The clock did not move.
+		{count: 1024, elapsed: 0, expected: 1e9},
+		{count: 0, elapsed: 0, expected: 0},
+		{count: 1024, elapsed: -time.Second, expected: 1e9},
+	} {
+		var rate = Throughput(test.count, test.elapsed)
+		assert.False(t, math.IsInf(rate, 0) || math.IsNaN(rate))
+		assert.InDelta(t, test.expected, rate, 1e-6)
+	}
+}
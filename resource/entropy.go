@@ -0,0 +1,123 @@
+package resource
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+)
+
+// EntropyCsprng The name of the entropy source that represents the operating system CSPRNG.
+const EntropyCsprng = "urandom"
+
+// EntropySource A source of random bytes used to create a pool.
+type EntropySource struct {
+	Name   string
+	reader io.Reader
+	closer io.Closer
+	// Size The number of bytes provided by the source, or -1 if the source is endless (a CSPRNG or a device).
+	Size int64
+}
+
+// EntropyOpen Opens an entropy source. `name` is the path to a file (or to a device such as "/dev/hwrng"), or
+// `EntropyCsprng`.
+func EntropyOpen(name string) (*EntropySource, error) {
+	var err error
+	var fd *os.File
+	var info os.FileInfo
+
+	if name == EntropyCsprng {
+		return &EntropySource{Name: name, reader: rand.Reader, Size: -1}, nil
+	}
+	if fd, err = os.Open(name); err != nil {
+		return nil, err
+	}
+	if info, err = fd.Stat(); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	if info.Mode().IsRegular() {
+		return &EntropySource{Name: name, reader: fd, closer: fd, Size: info.Size()}, nil
+	}
+	return &EntropySource{Name: name, reader: fd, closer: fd, Size: -1}, nil
+}
+
+// Close Closes the entropy source.
+func (e *EntropySource) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+// read Reads exactly `count` bytes from the entropy source.
+func (e *EntropySource) read(count int64) ([]byte, error) {
+	var err error
+	var buffer = make([]byte, count)
+
+	if _, err = io.ReadFull(e.reader, buffer); err != nil {
+		return nil, fmt.Errorf(`cannot read %d bytes from entropy source "%s": %s`, count, e.Name, err.Error())
+	}
+	return buffer, nil
+}
+
+// EntropyXor Combines entropy sources by XORing them, so that the result is at least as random as the best source.
+// If `length` is 0, then the length of the result is the size of the smallest (finite) source.
+func EntropyXor(sources []*EntropySource, length int64) ([]byte, error) {
+	var err error
+	var result []byte
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf(`no entropy source given`)
+	}
+	if length == 0 {
+		for _, source := range sources {
+			if source.Size >= 0 && (length == 0 || source.Size < length) {
+				length = source.Size
+			}
+		}
+		if length == 0 {
+			return nil, fmt.Errorf(`cannot determine the number of bytes to generate: please specify it`)
+		}
+	}
+	result = make([]byte, length)
+	for _, source := range sources {
+		var buffer []byte
+		if buffer, err = source.read(length); err != nil {
+			return nil, err
+		}
+		for i, b := range buffer {
+			result[i] ^= b
+		}
+	}
+	return result, nil
+}
+
+// EntropyConcat Combines entropy sources by concatenating them.
+// Finite sources are read entirely. `length` bytes are read from endless sources.
+func EntropyConcat(sources []*EntropySource, length int64) ([]byte, error) {
+	var err error
+	var result []byte
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf(`no entropy source given`)
+	}
+	for _, source := range sources {
+		var buffer []byte
+		var count = source.Size
+		if count < 0 {
+			if length <= 0 {
+				return nil, fmt.Errorf(`cannot determine the number of bytes to read from entropy source "%s": please specify it`, source.Name)
+			}
+			count = length
+		}
+		if count == 0 {
+			continue
+		}
+		if buffer, err = source.read(count); err != nil {
+			return nil, err
+		}
+		result = append(result, buffer...)
+	}
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package resource
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEntropyXor(t *testing.T) {
+	var err error
+	var sources []*EntropySource
+	var result []byte
+
+	for _, name := range []string{sourcePath, sourcePath, EntropyCsprng} {
+		var source *EntropySource
+		source, err = EntropyOpen(name)
+		assert.Nil(t, err)
+		defer source.Close()
+		sources = append(sources, source)
+	}
+	assert.Equal(t, int64(poolLength), sources[0].Size)
+	assert.Equal(t, int64(-1), sources[2].Size)
+
+	// The two files cancel each other: the result is the output of the CSPRNG.
+	result, err = EntropyXor(sources, 0)
+	assert.Nil(t, err)
+	assert.Len(t, result, poolLength)
+
+	// The files are exhausted.
+	_, err = EntropyXor(sources, 0)
+	assert.NotNil(t, err)
+}
+
+func TestEntropyXorFiles(t *testing.T) {
+	var err error
+	var first *EntropySource
+	var second *EntropySource
+	var result []byte
+
+	first, err = EntropyOpen(sourcePath)
+	assert.Nil(t, err)
+	defer first.Close()
+	second, err = EntropyOpen(sourcePath)
+	assert.Nil(t, err)
+	defer second.Close()
+
+	result, err = EntropyXor([]*EntropySource{first, second}, 16)
+	assert.Nil(t, err)
+	assert.Equal(t, make([]byte, 16), result)
+}
+
+func TestEntropyConcat(t *testing.T) {
+	var err error
+	var file *EntropySource
+	var csprng *EntropySource
+	var result []byte
+
+	file, err = EntropyOpen(sourcePath)
+	assert.Nil(t, err)
+	defer file.Close()
+	csprng, err = EntropyOpen(EntropyCsprng)
+	assert.Nil(t, err)
+
+	// The length of the CSPRNG output is required.
+	_, err = EntropyConcat([]*EntropySource{csprng}, 0)
+	assert.NotNil(t, err)
+
+	result, err = EntropyConcat([]*EntropySource{file, csprng}, 10)
+	assert.Nil(t, err)
+	assert.Len(t, result, poolLength+10)
+	for i := 0; i < poolLength; i++ {
+		assert.Equal(t, byte(i), result[i])
+	}
+}
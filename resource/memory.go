@@ -0,0 +1,81 @@
+package resource
+
+import "fmt"
+
+// MemoryPool A key source that holds the key material in memory (see `KeySource`).
+// Please note that the position pointer's position is not persisted.
+type MemoryPool struct {
+	data     []byte
+	position int64
+}
+
+// NewMemoryPool Creates a new in-memory pool from a list of bytes, with the position pointer set to `position`.
+func NewMemoryPool(data []byte, position int64) (*MemoryPool, error) {
+	if position < 0 || position > int64(len(data)) {
+		return nil, fmt.Errorf(`invalid pool position (%d)`, position)
+	}
+	return &MemoryPool{data: data, position: position}, nil
+}
+
+// Position Returns the current position of the position pointer.
+func (p *MemoryPool) Position() int64 {
+	return p.position
+}
+
+// Length Returns the number of bytes stored into the pool.
+func (p *MemoryPool) Length() (int64, error) {
+	return int64(len(p.data)), nil
+}
+
+// Read Retrieves `count` bytes from the pool, starting at the current position pointer's position, and moves the
+// position pointer forward.
+func (p *MemoryPool) Read(count int64) ([]byte, error) {
+	var err error
+	var start = p.position
+	var buffer []byte
+
+	if err = p.Consume(count); err != nil {
+		return nil, err
+	}
+	buffer = make([]byte, count)
+	copy(buffer, p.data[start:p.position])
+	return buffer, nil
+}
+
+// Consume Moves the position pointer `count` bytes forward, without retrieving the bytes.
+func (p *MemoryPool) Consume(count int64) error {
+	if count <= 0 {
+		return fmt.Errorf(`invalid number of bytes (%d)`, count)
+	}
+	if p.position+count > int64(len(p.data)) {
+		return fmt.Errorf(`cannot consume %d bytes from Position %d: only %d bytes left`, count, p.position, int64(len(p.data))-p.position)
+	}
+	p.position += count
+	return nil
+}
+
+// ReadAt Retrieves `count` bytes from the pool, starting at a given position, without moving the position pointer.
+func (p *MemoryPool) ReadAt(position int64, count int64) ([]byte, error) {
+	var buffer []byte
+
+	if count <= 0 {
+		return nil, fmt.Errorf(`invalid number of bytes (%d)`, count)
+	}
+	if position < 0 || position+count > int64(len(p.data)) {
+		return nil, fmt.Errorf(`cannot read %d bytes from Position %d: the pool contains %d bytes`, count, position, len(p.data))
+	}
+	buffer = make([]byte, count)
+	copy(buffer, p.data[position:position+count])
+	return buffer, nil
+}
+
+// Peek Retrieves `count` bytes from the pool, starting at the current position pointer's position, without moving
+// the position pointer.
+func (p *MemoryPool) Peek(count int64) ([]byte, error) {
+	return p.ReadAt(p.position, count)
+}
+
+// Close Does nothing: there is no resource to release.
+func (p *MemoryPool) Close() error {
+	return nil
+}
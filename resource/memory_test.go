@@ -0,0 +1,126 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryPoolRead(t *testing.T) {
+	var err error
+	var p *MemoryPool
+	var content []byte
+	var length int64
+
+	_, err = NewMemoryPool([]byte{0, 1, 2, 3}, 5)
+	assert.NotNil(t, err)
+
+	p, err = NewMemoryPool([]byte{0, 1, 2, 3, 4, 5}, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), p.Position())
+	length, err = p.Length()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), length)
+
+	content, err = p.Read(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1, 2}, content)
+	assert.Equal(t, int64(3), p.Position())
+
+	err = p.Consume(1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), p.Position())
+
+	// We'll get errors...
+	_, err = p.Read(3)
+	assert.NotNil(t, err)
+	err = p.Consume(0)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(4), p.Position())
+
+	content, err = p.Read(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4, 5}, content)
+}
+
+func TestMemoryPoolPeek(t *testing.T) {
+	var err error
+	var p *MemoryPool
+	var content []byte
+
+	p, err = NewMemoryPool([]byte{0, 1, 2, 3, 4, 5}, 2)
+	assert.Nil(t, err)
+
+	content, err = p.Peek(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2, 3}, content)
+	content, err = p.ReadAt(0, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5}, content)
+	assert.Equal(t, int64(2), p.Position())
+
+	// We'll get errors...
+	_, err = p.Peek(5)
+	assert.NotNil(t, err)
+	_, err = p.ReadAt(-1, 1)
+	assert.NotNil(t, err)
+}
+
+func TestReadChunks(t *testing.T) {
+	var err error
+	var source KeySource
+	var chunks [][]byte
+
+	source, err = NewMemoryPool([]byte{0, 1, 2, 3, 4, 5, 6}, 1)
+	assert.Nil(t, err)
+
+	chunks, err = ReadChunks(source, 3, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{{1, 2}, {3, 4}, {5, 6}}, chunks)
+	assert.Equal(t, int64(7), source.Position())
+
+	// We'll get an error...
+	_, err = ReadChunks(source, 1, 1)
+	assert.NotNil(t, err)
+}
+
+func TestClone(t *testing.T) {
+	var source KeySource
+	var err error
+	var dir = t.TempDir()
+
+	source, err = NewMemoryPool([]byte{1, 2, 3, 4, 5, 6}, 2)
+	assert.Nil(t, err)
+
+	for i, test := range []struct {
+		position         int64
+		zero             bool
+		expectedPosition int64
+		expectedData     []byte
+	}{
+		// The position of the source is kept.
+		{position: -1, zero: false, expectedPosition: 2, expectedData: []byte{1, 2, 3, 4, 5, 6}},
+		{position: 4, zero: false, expectedPosition: 4, expectedData: []byte{1, 2, 3, 4, 5, 6}},
+		{position: 4, zero: true, expectedPosition: 4, expectedData: []byte{0, 0, 0, 0, 5, 6}},
+		{position: 6, zero: true, expectedPosition: 6, expectedData: []byte{0, 0, 0, 0, 0, 0}},
+	} {
+		var pool *Pool
+		var data []byte
+
+		pool, err = Clone(source, filepath.Join(dir, fmt.Sprintf("clone-%d", i)), test.position, test.zero)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expectedPosition, pool.Position())
+		data, err = pool.ReadAt(0, 6)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expectedData, data)
+		assert.Nil(t, pool.Close())
+	}
+
+	// The source is left as is.
+	assert.Equal(t, int64(2), source.Position())
+
+	// We'll get an error...
+	_, err = Clone(source, filepath.Join(dir, "invalid"), 7, false)
+	assert.NotNil(t, err)
+}
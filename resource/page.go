@@ -0,0 +1,175 @@
+package resource
+
+import (
+	"encoding/base32"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pageMagic The first word of a page. It identifies the type of the document.
+const pageMagic = "UMAIL-KEY-PAGE"
+
+// pageGroupLength The number of base32 characters per group (groups are separated by spaces).
+const pageGroupLength = 8
+
+// pageGroupsPerLine The number of groups per line.
+const pageGroupsPerLine = 8
+
+// Page A page of key material, used to back up (or distribute) a key on paper or as a QR code.
+// The text representation of a page is:
+//
+//	UMAIL-KEY-PAGE <number>/<count>
+//	position: <position of the first byte>
+//	length: <number of bytes>
+//	checksum: <CRC32 of the bytes, in hexadecimal>
+//	<bytes encoded in base32, organized into groups of 8 characters>
+type Page struct {
+	Number   int
+	Count    int
+	Position int64
+	Data     []byte
+}
+
+// PagesCreate Splits a list of bytes into pages of (at most) `pageLength` bytes.
+// `position` is the position of the first byte, relatively to the beginning of the key material.
+func PagesCreate(data []byte, position int64, pageLength int) ([]Page, error) {
+	var pages []Page
+	var count int
+
+	if pageLength <= 0 {
+		return nil, fmt.Errorf(`invalid page length (%d)`, pageLength)
+	}
+	count = (len(data) + pageLength - 1) / pageLength
+	for i := 0; i < count; i++ {
+		var end = (i + 1) * pageLength
+		if end > len(data) {
+			end = len(data)
+		}
+		pages = append(pages, Page{
+			Number:   i + 1,
+			Count:    count,
+			Position: position + int64(i*pageLength),
+			Data:     data[i*pageLength : end]})
+	}
+	return pages, nil
+}
+
+// PagesAssemble Reassembles a (complete) list of pages, given in any order.
+// It returns the position of the first byte and the list of bytes.
+func PagesAssemble(pages []Page) (int64, []byte, error) {
+	var data []byte
+	var sorted = make([]Page, len(pages))
+
+	if len(pages) == 0 {
+		return 0, nil, fmt.Errorf(`no page given`)
+	}
+	copy(sorted, pages)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Number < sorted[j].Number
+	})
+	if len(sorted) != sorted[0].Count {
+		return 0, nil, fmt.Errorf(`invalid number of pages (%d instead of %d)`, len(sorted), sorted[0].Count)
+	}
+	for i, page := range sorted {
+		if page.Number != i+1 || page.Count != sorted[0].Count {
+			return 0, nil, fmt.Errorf(`page %d/%d is missing (or duplicated)`, i+1, sorted[0].Count)
+		}
+		if page.Position != sorted[0].Position+int64(len(data)) {
+			return 0, nil, fmt.Errorf(`page %d/%d does not follow the previous one (position %d instead of %d)`, page.Number, page.Count, page.Position, sorted[0].Position+int64(len(data)))
+		}
+		data = append(data, page.Data...)
+	}
+	return sorted[0].Position, data, nil
+}
+
+// PageParse Parses the text representation of a page, and verifies its checksum.
+func PageParse(text string) (*Page, error) {
+	var err error
+	var page Page
+	var lines []string
+	var header []string
+	var length int
+	var checksum uint64
+	var encoded strings.Builder
+	var fields = map[string]string{}
+
+	lines = strings.Split(strings.ReplaceAll(strings.TrimSpace(text), "\r\n", "\n"), "\n")
+	if len(lines) < 4 {
+		return nil, fmt.Errorf(`invalid page: not enough lines (%d)`, len(lines))
+	}
+
+	// Parse the first line: "UMAIL-KEY-PAGE <number>/<count>".
+	header = strings.Fields(lines[0])
+	if len(header) != 2 || header[0] != pageMagic {
+		return nil, fmt.Errorf(`invalid page: unexpected first line "%s"`, lines[0])
+	}
+	if _, err = fmt.Sscanf(header[1], "%d/%d", &page.Number, &page.Count); err != nil {
+		return nil, fmt.Errorf(`invalid page: invalid page number "%s"`, header[1])
+	}
+	if page.Number < 1 || page.Number > page.Count {
+		return nil, fmt.Errorf(`invalid page: invalid page number "%s"`, header[1])
+	}
+
+	// Parse the fields.
+	for _, line := range lines[1:4] {
+		var parts = strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf(`invalid page: unexpected line "%s"`, line)
+		}
+		fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	if page.Position, err = strconv.ParseInt(fields["position"], 10, 64); err != nil || page.Position < 0 {
+		return nil, fmt.Errorf(`invalid page: invalid position "%s"`, fields["position"])
+	}
+	if length, err = strconv.Atoi(fields["length"]); err != nil || length < 0 {
+		return nil, fmt.Errorf(`invalid page: invalid length "%s"`, fields["length"])
+	}
+	if checksum, err = strconv.ParseUint(fields["checksum"], 16, 32); err != nil {
+		return nil, fmt.Errorf(`invalid page: invalid checksum "%s"`, fields["checksum"])
+	}
+
+	// Decode the data.
+	for _, line := range lines[4:] {
+		encoded.WriteString(strings.Join(strings.Fields(strings.ToUpper(line)), ""))
+	}
+	if page.Data, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(encoded.String()); err != nil {
+		return nil, fmt.Errorf(`invalid page %d/%d: invalid data: %s`, page.Number, page.Count, err.Error())
+	}
+	if len(page.Data) != length {
+		return nil, fmt.Errorf(`invalid page %d/%d: invalid length (%d bytes instead of %d)`, page.Number, page.Count, len(page.Data), length)
+	}
+	if crc32.ChecksumIEEE(page.Data) != uint32(checksum) {
+		return nil, fmt.Errorf(`invalid page %d/%d: checksum mismatch (please check the data)`, page.Number, page.Count)
+	}
+	return &page, nil
+}
+
+// String Returns the text representation of the page.
+func (p *Page) String() string {
+	var lines []string
+	var groups []string
+	var encoded = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(p.Data)
+
+	lines = append(lines, fmt.Sprintf("%s %d/%d", pageMagic, p.Number, p.Count))
+	lines = append(lines, fmt.Sprintf("position: %d", p.Position))
+	lines = append(lines, fmt.Sprintf("length: %d", len(p.Data)))
+	lines = append(lines, fmt.Sprintf("checksum: %08x", crc32.ChecksumIEEE(p.Data)))
+	for i := 0; i < len(encoded); i += pageGroupLength {
+		var end = i + pageGroupLength
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		groups = append(groups, encoded[i:end])
+		if len(groups) == pageGroupsPerLine {
+			lines = append(lines, strings.Join(groups, " "))
+			groups = nil
+		}
+	}
+	if len(groups) > 0 {
+		lines = append(lines, strings.Join(groups, " "))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
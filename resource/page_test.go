@@ -0,0 +1,70 @@
+package resource
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestPages(t *testing.T) {
+	var err error
+	var data []byte
+	var pages []Page
+	var parsed []Page
+	var position int64
+	var assembled []byte
+
+	for i := 0; i < 100; i++ {
+		data = append(data, byte(i))
+	}
+
+	pages, err = PagesCreate(data, 10, 40)
+	assert.Nil(t, err)
+	assert.Len(t, pages, 3)
+	assert.Equal(t, int64(50), pages[1].Position)
+	assert.Len(t, pages[2].Data, 20)
+
+	// Convert the pages into text, parse them (in reverse order) and reassemble them.
+	for i := len(pages) - 1; i >= 0; i-- {
+		var page *Page
+		page, err = PageParse(pages[i].String())
+		assert.Nil(t, err)
+		parsed = append(parsed, *page)
+	}
+	position, assembled, err = PagesAssemble(parsed)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), position)
+	assert.Equal(t, data, assembled)
+
+	// A missing page.
+	_, _, err = PagesAssemble(parsed[1:])
+	assert.NotNil(t, err)
+}
+
+func TestPageParseInvalid(t *testing.T) {
+	var err error
+	var pages []Page
+	var lines []string
+	var typo = "A"
+
+	pages, err = PagesCreate([]byte("some key material"), 0, 512)
+	assert.Nil(t, err)
+	lines = strings.Split(pages[0].String(), "\n")
+
+	// Lower case data is accepted.
+	lines[4] = strings.ToLower(lines[4])
+	_, err = PageParse(strings.Join(lines, "\n"))
+	assert.Nil(t, err)
+
+	// A typo in the data is detected by the checksum.
+	if strings.HasPrefix(strings.ToUpper(lines[4]), "A") {
+		typo = "B"
+	}
+	lines[4] = typo + lines[4][1:]
+	_, err = PageParse(strings.Join(lines, "\n"))
+	assert.NotNil(t, err)
+
+	// Not a page.
+	_, err = PageParse("hello")
+	assert.NotNil(t, err)
+}
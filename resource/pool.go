@@ -4,16 +4,42 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 )
 
 const positionTypeLength = 8 // the size, in bytes, of "int64"
+const checksumTypeLength = 4 // the size, in bytes, of "uint32"
 
+// JournalSuffix The suffix of the file used to journal the updates of the position pointer's position.
+// The journal contains the new position (int64) followed by its CRC32 checksum (uint32), both in little endian.
+const JournalSuffix = ".journal"
+
+// ReceiverJournalSuffix The suffix of the file used to journal the updates of the receiver's cursor (same format as
+// the journal of the position pointer's position).
+const ReceiverJournalSuffix = ".receiver" + JournalSuffix
+
+// receiverMagic The first bytes of a pool whose header also contains the receiver's cursor (see `ReceiverCursor`):
+//
+//	magic (8 bytes) | position (int64) | receiver's cursor (int64)
+//
+// The header of the other pools only contains the position (int64). Please note that these bytes cannot be confused
+// with a position (they represent a huge number).
+const receiverMagic = "UMAILRCV"
+
+// receiverHeaderLength The length, in bytes, of the header of a pool that contains the receiver's cursor.
+const receiverHeaderLength = len(receiverMagic) + 2*positionTypeLength
+
+// Pool A key source backed by a file (see `KeySource`).
 type Pool struct {
 	Path     string
 	fd       *os.File
-	Position int64
+	position int64
+	// receiver The position of the receiver's cursor, or -1 if the pool has no receiver's cursor.
+	receiver int64
+	// offset The length of the header (the position of the key material within the file).
+	offset int64
 }
 
 // PoolOpen Opens an existing pool identified by its Path.
@@ -26,13 +52,23 @@ func PoolOpen(filePath string) (*Pool, error) {
 	if fd, err = os.OpenFile(filePath, os.O_RDWR, 0644); err != nil {
 		return nil, err
 	}
-	p = Pool{Path: filePath, fd: fd, Position: 0}
+	p = Pool{Path: filePath, fd: fd, position: 0, receiver: -1}
+	if err = p.readHeader(); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	// Apply (or discard) a pending update of the position pointer's position, left by an interrupted process.
+	if err = p.recoverPosition(); err != nil {
+		fd.Close()
+		return nil, err
+	}
 	// Retrieve the Position of the Position pointer from the underlying file.
 	if position, err = p.GetPositionFromFile(true); err != nil {
+		fd.Close()
 		return nil, err
 	}
-	p.Position = *position
-	return &Pool{Path: filePath, fd: fd, Position: *position}, nil
+	p.position = *position
+	return &p, nil
 }
 
 // PoolCreate Creates a new pool from the content of a file.
@@ -48,7 +84,7 @@ func PoolCreate(poolPath string, filePath string) (*Pool, error) {
 		return nil, err
 	}
 	defer fdFile.Close()
-	if fdPool, err = os.OpenFile(poolPath, os.O_CREATE, 0644); err != nil {
+	if fdPool, err = os.OpenFile(poolPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
 		return nil, err
 	}
 
@@ -75,31 +111,199 @@ func PoolCreate(poolPath string, filePath string) (*Pool, error) {
 	}
 
 	// Create the new pool.
-	pool := Pool{Path: poolPath, fd: fdPool, Position: 0}
-	if err = pool.seek(pool.Position); err != nil {
+	pool := Pool{Path: poolPath, fd: fdPool, position: 0, receiver: -1, offset: positionTypeLength}
+	if err = pool.seek(pool.position); err != nil {
 		return nil, err
 	}
 	return &pool, nil
 }
 
+// PoolCreateFromBytes Creates a new pool from a list of bytes, with the position pointer set to `position`.
+func PoolCreateFromBytes(poolPath string, data []byte, position int64) (*Pool, error) {
+	var err error
+	var content = new(bytes.Buffer)
+
+	if position < 0 || position > int64(len(data)) {
+		return nil, fmt.Errorf(`invalid pool position (%d)`, position)
+	}
+	if err = binary.Write(content, binary.LittleEndian, position); err != nil {
+		return nil, err
+	}
+	content.Write(data)
+	if err = os.WriteFile(poolPath, content.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	return PoolOpen(poolPath)
+}
+
 func (p *Pool) Close() error {
 	return p.fd.Close()
 }
 
+// Position Returns the current position of the position pointer.
+func (p *Pool) Position() int64 {
+	return p.position
+}
+
+// Read Retrieves `count` bytes from the pool, starting at the current position pointer's position, and moves the
+// position pointer forward.
+func (p *Pool) Read(count int64) ([]byte, error) {
+	var err error
+	var buffer *[]byte
+
+	if buffer, err = p.GetBytes(count); err != nil {
+		return nil, err
+	}
+	return *buffer, nil
+}
+
+// ReadAt Retrieves `count` bytes from the pool, starting at a given position (relatively to the beginning of the key
+// material), without moving (nor persisting) the position pointer.
+func (p *Pool) ReadAt(position int64, count int64) ([]byte, error) {
+	var err error
+	var buffer []byte
+
+	if count <= 0 {
+		return nil, fmt.Errorf(`invalid number of bytes (%d)`, count)
+	}
+	if position < 0 {
+		return nil, fmt.Errorf(`invalid position (%d)`, position)
+	}
+	buffer = make([]byte, count)
+	if _, err = p.fd.ReadAt(buffer, position+p.offset); err != nil {
+		return nil, fmt.Errorf(`cannot read %d bytes from pool "%s", from Position %d: %s`, count, p.Path, position, err.Error())
+	}
+	return buffer, nil
+}
+
+// Peek Retrieves `count` bytes from the pool, starting at the current position pointer's position, without moving
+// (nor persisting) the position pointer.
+func (p *Pool) Peek(count int64) ([]byte, error) {
+	return p.ReadAt(p.position, count)
+}
+
+// Consume Moves the position pointer `count` bytes forward, without retrieving the bytes.
+func (p *Pool) Consume(count int64) error {
+	var err error
+	var length int64
+	var newPosition = p.position + count
+
+	if count <= 0 {
+		return fmt.Errorf(`invalid number of bytes (%d)`, count)
+	}
+	if length, err = p.Length(); err != nil {
+		return err
+	}
+	if newPosition > length {
+		return fmt.Errorf(`cannot consume %d bytes from pool "%s", from Position %d: only %d bytes left`, count, p.Path, p.position, length-p.position)
+	}
+	if err = p.SetPositionToFile(newPosition); err != nil {
+		return err
+	}
+	if err = p.seek(newPosition); err != nil {
+		return err
+	}
+	p.position = newPosition
+	return nil
+}
+
+// Length Returns the number of bytes stored into the pool (the header excluded).
+func (p *Pool) Length() (int64, error) {
+	var err error
+	var info os.FileInfo
+
+	if info, err = p.fd.Stat(); err != nil {
+		return 0, err
+	}
+	return info.Size() - p.offset, nil
+}
+
+// ReceiverPosition Returns the position of the receiver's cursor, and false if the pool has no receiver's cursor.
+func (p *Pool) ReceiverPosition() (int64, bool) {
+	return p.receiver, p.receiver >= 0
+}
+
+// SetReceiverPosition Sets the position of the receiver's cursor (see `ReceiverCursor`), and saves it into the file.
+// If the pool has no receiver's cursor yet, then its header is extended: the file is replaced.
+// Please note that a call to this method does *NOT* modify the position of the position pointer.
+func (p *Pool) SetReceiverPosition(position int64) error {
+	var err error
+	var length int64
+
+	if length, err = p.Length(); err != nil {
+		return err
+	}
+	if position < 0 || position > length {
+		return fmt.Errorf(`invalid receiver position (%d): the pool "%s" contains %d bytes`, position, p.Path, length)
+	}
+	if p.receiver < 0 {
+		if err = p.extendHeader(position); err != nil {
+			return fmt.Errorf(`cannot add the receiver's cursor to pool "%s": %s`, p.Path, err.Error())
+		}
+		p.receiver = position
+		return nil
+	}
+	if err = writeJournal(p.Path+ReceiverJournalSuffix, position); err != nil {
+		return fmt.Errorf(`cannot journal the new receiver position (%d) of pool "%s": %s`, position, p.Path, err.Error())
+	}
+	if err = p.writeReceiverPosition(position); err != nil {
+		return err
+	}
+	p.receiver = position
+	return os.Remove(p.Path + ReceiverJournalSuffix)
+}
+
+// Append Appends the content of a file to the end of the pool.
+// Please note that a call to this method does *NOT* modify the position of the position pointer.
+func (p *Pool) Append(filePath string) (int64, error) {
+	var err error
+	var fd *os.File
+	var count int64
+
+	if fd, err = os.Open(filePath); err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+	if _, err = p.fd.Seek(0, io.SeekEnd); err != nil {
+		return 0, err
+	}
+	count, err = io.Copy(p.fd, fd)
+	if seekErr := p.seek(p.position); seekErr != nil && err == nil {
+		err = seekErr
+	}
+	return count, err
+}
+
+// AppendBytes Appends a given list of bytes to the end of the pool.
+// Please note that a call to this method does *NOT* modify the position of the position pointer.
+func (p *Pool) AppendBytes(data []byte) error {
+	var err error
+
+	if _, err = p.fd.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	_, err = p.fd.Write(data)
+	if seekErr := p.seek(p.position); seekErr != nil && err == nil {
+		err = seekErr
+	}
+	return err
+}
+
 // GetBytes Retrieves `count` bytes from the pool, starting as the current position pointer's position.
 // Please note that this method does *NOT* set the position of the position pointer prior retrieving bytes.
 // The position pointer should have been moved to its current position while the pool has been opened (by calling
 // `PoolOpen`)
 func (p *Pool) GetBytes(count int64) (*[]byte, error) {
 	var err error
-	var buffer = make([]byte, count)
-	var newPosition = p.Position + count
+	var buffer []byte
+	var newPosition = p.position + count
 
 	if count <= 0 {
-		panic(fmt.Errorf(`invalid number of bytes (%d)`, count))
+		return nil, fmt.Errorf(`invalid number of bytes (%d)`, count)
 	}
+	buffer = make([]byte, count)
 	if _, err = io.ReadFull(p.fd, buffer); err != nil {
-		return nil, fmt.Errorf(`cannot extract %d bytes from pool "%s", from Position %d: %s`, count, p.Path, p.Position, err.Error())
+		return nil, fmt.Errorf(`cannot extract %d bytes from pool "%s", from Position %d: %s`, count, p.Path, p.position, err.Error())
 	}
 	if err = p.SetPositionToFile(newPosition); err != nil {
 		return nil, err
@@ -107,11 +311,32 @@ func (p *Pool) GetBytes(count int64) (*[]byte, error) {
 	if err = p.seek(newPosition); err != nil {
 		return nil, err
 	}
-	p.Position = newPosition
+	p.position = newPosition
 	return &buffer, nil
 }
 
+// NextChunk Retrieves the next chunk of `chunkLength` bytes from the pool, and moves the position pointer forward.
+// The new position is saved before the chunk is returned. Thus, chunks can be extracted lazily, one at a time: only
+// one chunk is held in memory, and a failure does not affect the chunks already extracted.
+// It returns `io.EOF` when less than `chunkLength` bytes are left into the pool.
+func (p *Pool) NextChunk(chunkLength int64) ([]byte, error) {
+	var err error
+	var length int64
+
+	if chunkLength <= 0 {
+		return nil, fmt.Errorf(`invalid chunk length (%d)`, chunkLength)
+	}
+	if length, err = p.Length(); err != nil {
+		return nil, err
+	}
+	if p.position+chunkLength > length {
+		return nil, io.EOF
+	}
+	return p.Read(chunkLength)
+}
+
 // GetBytesAsChunks Extract a given number of chunks from the pool.
+// Please note that all the chunks are allocated at once. To extract chunks lazily, use `NextChunk`.
 func (p *Pool) GetBytesAsChunks(chunkCount int64, chunkLength int64) (*[][]byte, error) {
 	var err error
 	var buffer *[]byte
@@ -131,14 +356,14 @@ func (p *Pool) GetBytesAsChunks(chunkCount int64, chunkLength int64) (*[][]byte,
 // GetPositionFromFile Retrieves the value of position pointer's position from the underlying file.
 // Please note that a call to this method:
 // - does *NOT* (re)Position the Position pointer, unless `seek` is set to `true`.
-// - does *NOT* modify the value of `p.Position`.
+// - does *NOT* modify the value of `p.position`.
 func (p *Pool) GetPositionFromFile(seek bool) (*int64, error) {
 	var err error
 	var buffer = make([]byte, positionTypeLength)
 	var n int
 	var position int64
 
-	if _, err = p.fd.Seek(0, io.SeekStart); err != nil {
+	if _, err = p.fd.Seek(p.positionOffset(), io.SeekStart); err != nil {
 		return nil, err
 	}
 	if n, err = p.fd.Read(buffer); err != nil && err != io.EOF {
@@ -147,6 +372,9 @@ func (p *Pool) GetPositionFromFile(seek bool) (*int64, error) {
 	if n != positionTypeLength {
 		return nil, fmt.Errorf(`invalid pool "%s": no Position found`, p.Path)
 	}
+	if string(buffer) == protectedMagic {
+		return nil, fmt.Errorf(`pool "%s": %w`, p.Path, ErrProtected)
+	}
 	if err = binary.Read(bytes.NewReader(buffer), binary.LittleEndian, &position); err != nil {
 		return nil, err
 	}
@@ -163,26 +391,230 @@ func (p *Pool) GetPositionFromFile(seek bool) (*int64, error) {
 }
 
 // SetPositionToFile Sets the value of the position pointer's position to `Position` within the underlying file.
+// The update is journaled: the new position is first written (and synced) into a journal file, then written into the
+// pool, and finally the journal is removed. If the process is interrupted, the next call to `PoolOpen` completes (or
+// discards) the update. Thus, the pool never contains a partially written position.
 // Please note that a call to this method:
 // - does *NOT* (re)Position the Position pointer. To (re)Position the Position pointer, you must use `seek()`.
-// - does *NOT* modify the value of `p.Position`.
+// - does *NOT* modify the value of `p.position`.
 func (p *Pool) SetPositionToFile(position int64) error {
 	var err error
+
+	if err = writeJournal(p.Path+JournalSuffix, position); err != nil {
+		return fmt.Errorf(`cannot journal the new position (%d) of pool "%s": %s`, position, p.Path, err.Error())
+	}
+	if err = p.writePosition(position); err != nil {
+		return err
+	}
+	return os.Remove(p.Path + JournalSuffix)
+}
+
+// writePosition Writes the value of the position pointer's position into the underlying file, and syncs it.
+func (p *Pool) writePosition(position int64) error {
+	var err error
 	var positionBuffer = new(bytes.Buffer)
 
 	if err = binary.Write(positionBuffer, binary.LittleEndian, position); err != nil {
 		return err
 	}
-	if _, err = p.fd.Seek(0, io.SeekStart); err != nil {
+	if _, err = p.fd.Seek(p.positionOffset(), io.SeekStart); err != nil {
 		return err
 	}
-	_, err = p.fd.Write(positionBuffer.Bytes())
-	return err
+	if _, err = p.fd.Write(positionBuffer.Bytes()); err != nil {
+		return err
+	}
+	return p.fd.Sync()
+}
+
+// writeReceiverPosition Writes the position of the receiver's cursor into the underlying file (whose header contains
+// the receiver's cursor), and syncs it.
+func (p *Pool) writeReceiverPosition(position int64) error {
+	var err error
+	var positionBuffer = make([]byte, positionTypeLength)
+
+	binary.LittleEndian.PutUint64(positionBuffer, uint64(position))
+	if _, err = p.fd.WriteAt(positionBuffer, int64(len(receiverMagic)+positionTypeLength)); err != nil {
+		return err
+	}
+	return p.fd.Sync()
+}
+
+// positionOffset Returns the position of the position pointer's position within the underlying file.
+func (p *Pool) positionOffset() int64 {
+	if p.offset == int64(receiverHeaderLength) {
+		return int64(len(receiverMagic))
+	}
+	return 0
+}
+
+// readHeader Finds the kind of header of the underlying file: if the header contains the receiver's cursor, then the
+// position of the receiver's cursor is retrieved.
+func (p *Pool) readHeader() error {
+	var err error
+	var header = make([]byte, receiverHeaderLength)
+	var n int
+
+	p.offset = positionTypeLength
+	if n, err = p.fd.ReadAt(header, 0); err != nil && err != io.EOF {
+		return err
+	}
+	if n < len(receiverMagic) || string(header[:len(receiverMagic)]) != receiverMagic {
+		return nil
+	}
+	if n != receiverHeaderLength {
+		return fmt.Errorf(`invalid pool "%s": truncated header`, p.Path)
+	}
+	p.offset = int64(receiverHeaderLength)
+	p.receiver = int64(binary.LittleEndian.Uint64(header[len(receiverMagic)+positionTypeLength:]))
+	if p.receiver < 0 {
+		return fmt.Errorf(`invalid pool "%s": invalid receiver position (%d)`, p.Path, p.receiver)
+	}
+	return nil
+}
+
+// extendHeader Replaces the underlying file by a file whose header contains the receiver's cursor (set to
+// `receiver`). The key material is moved: the file is written atomically, and then reopened.
+func (p *Pool) extendHeader(receiver int64) error {
+	var err error
+	var content []byte
+
+	if content, err = os.ReadFile(p.Path); err != nil {
+		return err
+	}
+	if err = p.fd.Close(); err != nil {
+		return err
+	}
+	content = joinHeader(p.position, receiver, content[p.offset:])
+	err = writeAtomically(p.Path, content)
+	// The file is reopened, even if it could not be replaced.
+	if fd, openErr := os.OpenFile(p.Path, os.O_RDWR, 0644); openErr == nil {
+		p.fd = fd
+	} else if err == nil {
+		err = openErr
+	}
+	if err != nil {
+		return err
+	}
+	p.offset = int64(receiverHeaderLength)
+	return p.seek(p.position)
+}
+
+// joinHeader Returns the content of a pool whose header contains the receiver's cursor.
+func joinHeader(position int64, receiver int64, data []byte) []byte {
+	var content = make([]byte, receiverHeaderLength, receiverHeaderLength+len(data))
+
+	copy(content, receiverMagic)
+	binary.LittleEndian.PutUint64(content[len(receiverMagic):], uint64(position))
+	binary.LittleEndian.PutUint64(content[len(receiverMagic)+positionTypeLength:], uint64(receiver))
+	return append(content, data...)
+}
+
+// splitHeader Splits the content of a pool into its header (the position, and the position of the receiver's cursor,
+// or -1 if the header does not contain it) and its key material.
+func splitHeader(path string, content []byte) (int64, int64, []byte, error) {
+	var position int64
+	var receiver int64 = -1
+	var offset = positionTypeLength
+
+	if len(content) >= len(receiverMagic) && string(content[:len(receiverMagic)]) == receiverMagic {
+		if len(content) < receiverHeaderLength {
+			return 0, 0, nil, fmt.Errorf(`invalid pool "%s": truncated header`, path)
+		}
+		position = int64(binary.LittleEndian.Uint64(content[len(receiverMagic):]))
+		receiver = int64(binary.LittleEndian.Uint64(content[len(receiverMagic)+positionTypeLength:]))
+		offset = receiverHeaderLength
+	} else {
+		if len(content) < positionTypeLength {
+			return 0, 0, nil, fmt.Errorf(`invalid pool "%s": no Position found`, path)
+		}
+		position = int64(binary.LittleEndian.Uint64(content[:positionTypeLength]))
+	}
+	if position < 0 || position > int64(len(content)-offset) {
+		return 0, 0, nil, fmt.Errorf(`invalid pool "%s": invalid pool Position (%d)`, path, position)
+	}
+	if offset == receiverHeaderLength && (receiver < 0 || receiver > int64(len(content)-offset)) {
+		return 0, 0, nil, fmt.Errorf(`invalid pool "%s": invalid receiver position (%d)`, path, receiver)
+	}
+	return position, receiver, content[offset:], nil
+}
+
+// writeJournal Writes a new position, followed by its checksum, into a journal.
+func writeJournal(journalPath string, position int64) error {
+	var err error
+	var fd *os.File
+	var record = new(bytes.Buffer)
+
+	if err = binary.Write(record, binary.LittleEndian, position); err != nil {
+		return err
+	}
+	if err = binary.Write(record, binary.LittleEndian, crc32.ChecksumIEEE(record.Bytes())); err != nil {
+		return err
+	}
+	if fd, err = os.OpenFile(journalPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		return err
+	}
+	if _, err = fd.Write(record.Bytes()); err != nil {
+		fd.Close()
+		return err
+	}
+	if err = fd.Sync(); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// recoverPosition Looks for the journals left by interrupted updates of the position pointer's position and of the
+// receiver's cursor. If a journal is complete, then the update is (re)applied. Otherwise, the update never took place
+// (the pool has not been modified), and the journal is discarded.
+func (p *Pool) recoverPosition() error {
+	var err error
+
+	if err = p.recoverJournal(p.Path+JournalSuffix, p.writePosition); err != nil {
+		return err
+	}
+	if p.receiver < 0 {
+		// The receiver's cursor is added by replacing the file: it is never journaled.
+		return p.recoverJournal(p.Path+ReceiverJournalSuffix, nil)
+	}
+	return p.recoverJournal(p.Path+ReceiverJournalSuffix, func(position int64) error {
+		if err := p.writeReceiverPosition(position); err != nil {
+			return err
+		}
+		p.receiver = position
+		return nil
+	})
+}
+
+// recoverJournal Applies (through `apply`, if not nil) the update recorded into a journal if it is complete, and
+// removes the journal.
+func (p *Pool) recoverJournal(journalPath string, apply func(position int64) error) error {
+	var err error
+	var record []byte
+	var position int64
+	var checksum uint32
+
+	if record, err = os.ReadFile(journalPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(record) == positionTypeLength+checksumTypeLength {
+		checksum = binary.LittleEndian.Uint32(record[positionTypeLength:])
+		position = int64(binary.LittleEndian.Uint64(record[:positionTypeLength]))
+		if checksum == crc32.ChecksumIEEE(record[:positionTypeLength]) && position >= 0 && apply != nil {
+			if err = apply(position); err != nil {
+				return fmt.Errorf(`cannot recover the position of pool "%s" from journal "%s": %s`, p.Path, journalPath, err.Error())
+			}
+		}
+	}
+	return os.Remove(journalPath)
 }
 
 // seek Sets the Position pointer to `Position`.
-// Please keep in mind that this method does not modify the value of `p.Position`.
+// Please keep in mind that this method does not modify the value of `p.position`.
 func (p *Pool) seek(position int64) error {
-	_, err := p.fd.Seek(position+positionTypeLength, io.SeekStart)
+	_, err := p.fd.Seek(position+p.offset, io.SeekStart)
 	return err
 }
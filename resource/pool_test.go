@@ -2,6 +2,7 @@ package resource
 
 import (
 	"github.com/stretchr/testify/assert"
+	"io"
 	"os"
 	"testing"
 )
@@ -111,3 +112,348 @@ func TestPoolGetBytesAsChunks(t *testing.T) {
 	_, err = p.GetBytes(sliceLength)
 	assert.NotNil(t, err)
 }
+
+func TestPoolAppend(t *testing.T) {
+	const sliceLength = 2
+	var err error
+	var p *Pool
+	var content *[]byte
+	var length int64
+	var count int64
+
+	// PoolCreate a pool.
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	p.Close()
+
+	p, err = PoolOpen(poolPath)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	// Consume 2 bytes, then append the source file and some extra bytes.
+	_, err = p.GetBytes(sliceLength)
+	assert.Nil(t, err)
+	count, err = p.Append(sourcePath)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(poolLength), count)
+	err = p.AppendBytes([]byte{0xAA, 0xBB})
+	assert.Nil(t, err)
+
+	length, err = p.Length()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2*poolLength+2), length)
+
+	// The position pointer must not have moved.
+	assert.Equal(t, int64(sliceLength), p.Position())
+	content, err = p.GetBytes(sliceLength)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2, 3}, *content)
+
+	// Consume the remaining bytes.
+	content, err = p.GetBytes(2*poolLength - 2*sliceLength)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(0), (*content)[poolLength-2*sliceLength])
+	content, err = p.GetBytes(sliceLength)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xAA, 0xBB}, *content)
+}
+
+func TestPoolRecoverPosition(t *testing.T) {
+	var err error
+	var p *Pool
+	var content *[]byte
+
+	// PoolCreate a pool.
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+
+	// Simulate a crash that occurred after the journal has been written.
+	err = writeJournal(poolPath+JournalSuffix, 10)
+	assert.Nil(t, err)
+	p.Close()
+
+	p, err = PoolOpen(poolPath)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), p.Position())
+	_, err = os.Stat(poolPath + JournalSuffix)
+	assert.True(t, os.IsNotExist(err))
+	content, err = p.GetBytes(1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(10), (*content)[0])
+	p.Close()
+
+	// Simulate a crash that occurred while the journal was being written.
+	err = os.WriteFile(poolPath+JournalSuffix, []byte{0x01, 0x02, 0x03}, 0644)
+	assert.Nil(t, err)
+
+	p, err = PoolOpen(poolPath)
+	assert.Nil(t, err)
+	defer p.Close()
+	assert.Equal(t, int64(11), p.Position())
+	_, err = os.Stat(poolPath + JournalSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPoolReceiverPosition(t *testing.T) {
+	var err error
+	var p *Pool
+	var receiver int64
+	var set bool
+	var content []byte
+	var length int64
+
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Consume(5))
+	_, set = p.ReceiverPosition()
+	assert.False(t, set)
+
+	// The header is extended: the key material and the position are kept.
+	assert.NotNil(t, p.SetReceiverPosition(poolLength+1))
+	assert.Nil(t, p.SetReceiverPosition(3))
+	receiver, set = p.ReceiverPosition()
+	assert.True(t, set)
+	assert.Equal(t, int64(3), receiver)
+	assert.Equal(t, int64(5), p.Position())
+	length, err = p.Length()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(poolLength), length)
+	content, err = p.Read(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{5, 6}, content)
+	content, err = p.ReadAt(3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{3}, content)
+	p.Close()
+
+	p, err = PoolOpen(poolPath)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), p.Position())
+	receiver, _ = p.ReceiverPosition()
+	assert.Equal(t, int64(3), receiver)
+	assert.Nil(t, p.SetReceiverPosition(9))
+	assert.Nil(t, p.Consume(1))
+	p.Close()
+
+	// Simulate a crash that occurred after the journal of the receiver's cursor has been written.
+	err = writeJournal(poolPath+ReceiverJournalSuffix, 20)
+	assert.Nil(t, err)
+	p, err = PoolOpen(poolPath)
+	assert.Nil(t, err)
+	defer p.Close()
+	assert.Equal(t, int64(8), p.Position())
+	receiver, _ = p.ReceiverPosition()
+	assert.Equal(t, int64(20), receiver)
+	_, err = os.Stat(poolPath + ReceiverJournalSuffix)
+	assert.True(t, os.IsNotExist(err))
+	content, err = p.Peek(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{8}, content)
+}
+
+func TestPoolReadConsume(t *testing.T) {
+	var err error
+	var p *Pool
+	var source KeySource
+	var content []byte
+
+	// PoolCreate a pool.
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	p.Close()
+
+	source, err = Open(poolPath)
+	assert.Nil(t, err)
+
+	content, err = source.Read(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1}, content)
+	err = source.Consume(2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), source.Position())
+	content, err = source.Read(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4}, content)
+
+	// We'll get an error...
+	err = source.Consume(poolLength)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(5), source.Position())
+	source.Close()
+
+	// The position must have been persisted.
+	source, err = Open(poolPath)
+	assert.Nil(t, err)
+	defer source.Close()
+	assert.Equal(t, int64(5), source.Position())
+}
+
+func TestPoolPeek(t *testing.T) {
+	var err error
+	var p *Pool
+	var content []byte
+
+	// PoolCreate a pool.
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	p.Close()
+
+	p, err = PoolOpen(poolPath)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	err = p.Consume(4)
+	assert.Nil(t, err)
+
+	content, err = p.Peek(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4, 5}, content)
+	content, err = p.ReadAt(1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1, 2}, content)
+
+	// The position pointer must not have moved.
+	assert.Equal(t, int64(4), p.Position())
+	content, err = p.Read(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4}, content)
+
+	// We'll get an error...
+	_, err = p.ReadAt(poolLength-1, 2)
+	assert.NotNil(t, err)
+}
+
+func TestPoolCreateFromBytes(t *testing.T) {
+	var err error
+	var p *Pool
+	var content []byte
+
+	_, err = PoolCreateFromBytes(poolPath, []byte{0, 1, 2}, 4)
+	assert.NotNil(t, err)
+
+	p, err = PoolCreateFromBytes(poolPath, []byte{0, 1, 2, 3}, 2)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	assert.Equal(t, int64(2), p.Position())
+	content, err = p.Read(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2, 3}, content)
+}
+
+func TestPoolNextChunk(t *testing.T) {
+	const chunkLength = 100
+	var err error
+	var p *Pool
+	var chunk []byte
+	var count int
+
+	// PoolCreate a pool.
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	p.Close()
+
+	p, err = PoolOpen(poolPath)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	for {
+		if chunk, err = p.NextChunk(chunkLength); err != nil {
+			break
+		}
+		assert.Len(t, chunk, chunkLength)
+		assert.Equal(t, byte(count*chunkLength), chunk[0])
+		count++
+		// The position is committed for each chunk.
+		content, _ := os.ReadFile(poolPath)
+		assert.Equal(t, uint8(count*chunkLength), content[0])
+	}
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, poolLength/chunkLength, count)
+
+	// The remaining bytes are still available.
+	chunk, err = p.NextChunk(poolLength % chunkLength)
+	assert.Nil(t, err)
+	assert.Len(t, chunk, poolLength%chunkLength)
+}
+
+func TestPoolGetBytesInvalid(t *testing.T) {
+	var err error
+	var p *Pool
+
+	// PoolCreate a pool.
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	// We'll get errors (and no panic)...
+	_, err = p.GetBytes(0)
+	assert.NotNil(t, err)
+	_, err = p.GetBytes(-1)
+	assert.NotNil(t, err)
+	_, err = p.GetBytesAsChunks(2, 0)
+	assert.NotNil(t, err)
+	err = p.Consume(0)
+	assert.NotNil(t, err)
+	_, err = p.NextChunk(0)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), p.Position())
+}
+
+func BenchmarkPoolOpen(b *testing.B) {
+	var p *Pool
+	var err error
+
+	if p, err = PoolCreate(poolPath, sourcePath); err != nil {
+		b.Fatal(err)
+	}
+	p.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if p, err = PoolOpen(poolPath); err != nil {
+			b.Fatal(err)
+		}
+		p.Close()
+	}
+}
+
+func BenchmarkPoolSetPositionToFile(b *testing.B) {
+	var p *Pool
+	var err error
+
+	if p, err = PoolCreate(poolPath, sourcePath); err != nil {
+		b.Fatal(err)
+	}
+	defer p.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = p.SetPositionToFile(int64(i % poolLength)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPoolNextChunk(b *testing.B) {
+	const chunkLength = 2
+	var p *Pool
+	var err error
+
+	for i := 0; i < b.N; i++ {
+		if i%(poolLength/chunkLength) == 0 {
+			b.StopTimer()
+			if p != nil {
+				p.Close()
+			}
+			if p, err = PoolCreate(poolPath, sourcePath); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+		}
+		if _, err = p.NextChunk(chunkLength); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if p != nil {
+		p.Close()
+	}
+}
@@ -0,0 +1,83 @@
+package resource
+
+import "fmt"
+
+// PositionedSource A key source whose position pointer is independent of the one of another key source: it starts at
+// a given position, and it is never persisted. The key material is read from the other key source, whose position
+// pointer is left untouched.
+type PositionedSource struct {
+	source   KeySource
+	position int64
+}
+
+// AtPosition Creates a key source that reads the key material of `source`, with its own position pointer set to
+// `position`. Closing the key source closes `source`.
+func AtPosition(source KeySource, position int64) (*PositionedSource, error) {
+	var err error
+	var length int64
+
+	if length, err = source.Length(); err != nil {
+		return nil, err
+	}
+	if position < 0 || position > length {
+		return nil, fmt.Errorf(`invalid pool position (%d): the pool contains %d bytes`, position, length)
+	}
+	return &PositionedSource{source: source, position: position}, nil
+}
+
+// Position Returns the current position of the position pointer.
+func (p *PositionedSource) Position() int64 {
+	return p.position
+}
+
+// Length Returns the number of bytes of key material.
+func (p *PositionedSource) Length() (int64, error) {
+	return p.source.Length()
+}
+
+// Read Retrieves `count` bytes, starting at the current position pointer's position, and moves the position pointer
+// forward.
+func (p *PositionedSource) Read(count int64) ([]byte, error) {
+	var err error
+	var buffer []byte
+
+	if buffer, err = p.source.ReadAt(p.position, count); err != nil {
+		return nil, err
+	}
+	p.position += count
+	return buffer, nil
+}
+
+// Consume Moves the position pointer `count` bytes forward, without retrieving the bytes.
+func (p *PositionedSource) Consume(count int64) error {
+	var err error
+	var length int64
+
+	if count <= 0 {
+		return fmt.Errorf(`invalid number of bytes (%d)`, count)
+	}
+	if length, err = p.source.Length(); err != nil {
+		return err
+	}
+	if p.position+count > length {
+		return fmt.Errorf(`cannot consume %d bytes from Position %d: only %d bytes left`, count, p.position, length-p.position)
+	}
+	p.position += count
+	return nil
+}
+
+// ReadAt Retrieves `count` bytes, starting at a given position, without moving the position pointer.
+func (p *PositionedSource) ReadAt(position int64, count int64) ([]byte, error) {
+	return p.source.ReadAt(position, count)
+}
+
+// Peek Retrieves `count` bytes, starting at the current position pointer's position, without moving the position
+// pointer.
+func (p *PositionedSource) Peek(count int64) ([]byte, error) {
+	return p.source.ReadAt(p.position, count)
+}
+
+// Close Closes the key source the key material is read from.
+func (p *PositionedSource) Close() error {
+	return p.source.Close()
+}
@@ -0,0 +1,48 @@
+package resource
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAtPosition(t *testing.T) {
+	var err error
+	var source *MemoryPool
+	var p *PositionedSource
+	var content []byte
+
+	source, err = NewMemoryPool([]byte{0, 1, 2, 3, 4, 5}, 1)
+	assert.Nil(t, err)
+
+	_, err = AtPosition(source, 7)
+	assert.NotNil(t, err)
+	_, err = AtPosition(source, -1)
+	assert.NotNil(t, err)
+
+	p, err = AtPosition(source, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), p.Position())
+
+	content, err = p.Peek(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{3, 4}, content)
+	content, err = p.Read(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{3, 4}, content)
+	assert.Equal(t, int64(5), p.Position())
+	content, err = p.ReadAt(0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1}, content)
+
+	// We'll get errors...
+	_, err = p.Read(2)
+	assert.NotNil(t, err)
+	assert.NotNil(t, p.Consume(2))
+	assert.NotNil(t, p.Consume(0))
+	assert.Equal(t, int64(5), p.Position())
+	assert.Nil(t, p.Consume(1))
+	assert.Equal(t, int64(6), p.Position())
+
+	// The position pointer of the source is left untouched.
+	assert.Equal(t, int64(1), source.Position())
+}
@@ -0,0 +1,417 @@
+package resource
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"io"
+	"os"
+)
+
+// protectedMagic The first bytes of a protected (encrypted) pool.
+// Please note that these bytes cannot be confused with a position (they represent a huge number).
+const protectedMagic = "UMAILENC"
+
+const protectedSaltLength = 16
+const protectedKeyLength = chacha20poly1305.KeySize
+
+// Parameters used to derive the encryption key from the passphrase (Argon2id).
+const argon2Time = 3
+const argon2Memory = 64 * 1024 // KiB
+const argon2Threads = 4
+
+// The bounds of the parameters read from the header of a protected pool: the header is only authenticated once the key
+// is derived, so a corrupted (or crafted) header must not make the derivation fail, or exhaust the memory.
+const argon2MaxTime = 64
+const argon2MaxMemory = 1024 * 1024 // KiB
+
+// ErrProtected Returned when a protected pool is opened as a plain pool.
+var ErrProtected = errors.New("the pool is protected by a passphrase")
+
+// PassphraseProvider Called when a protected pool is opened (through `Open`) to get the passphrase.
+// If not set, protected pools cannot be opened.
+var PassphraseProvider func(path string) ([]byte, error)
+
+// protectedHeader The header of a protected pool. It is authenticated (but not encrypted).
+//
+//	magic (8 bytes) | time (uint32) | memory (uint32) | threads (uint8) | salt (16 bytes) | nonce (12 bytes)
+type protectedHeader struct {
+	Magic   [len(protectedMagic)]byte
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	Salt    [protectedSaltLength]byte
+	Nonce   [chacha20poly1305.NonceSize]byte
+}
+
+// ProtectedPool A key source backed by a file encrypted using ChaCha20-Poly1305 with an Argon2id-derived key
+// (see `KeySource`).
+// The whole pool is decrypted in memory. Each time the position pointer is moved, the pool is encrypted again (with
+// a new nonce) and the file is atomically replaced.
+type ProtectedPool struct {
+	MemoryPool
+	Path   string
+	header protectedHeader
+	key    []byte
+	// receiver The position of the receiver's cursor, or -1 if the pool has no receiver's cursor.
+	receiver int64
+}
+
+// IsProtected Tells whether a pool file is protected by a passphrase.
+func IsProtected(path string) (bool, error) {
+	var err error
+	var fd *os.File
+	var magic = make([]byte, len(protectedMagic))
+
+	if fd, err = os.Open(path); err != nil {
+		return false, err
+	}
+	defer fd.Close()
+	if _, err = io.ReadFull(fd, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return string(magic) == protectedMagic, nil
+}
+
+// protectShredPasses The number of times the plain pool is overwritten with random data, once it is encrypted.
+const protectShredPasses = 1
+
+// Protect Encrypts a (plain) pool file using a passphrase. The plain pool (and its journals, if any) is shredded (see
+// `Shred`) before it is replaced by the encrypted pool: the key material cannot be recovered from the plain file.
+// Please note that if the process is interrupted between the shredding and the replacement, the encrypted pool is left
+// into the temporary file ("<path>.tmp").
+func Protect(path string, passphrase []byte) error {
+	var err error
+	var pool *Pool
+	var plain []byte
+	var header protectedHeader
+	var sealed []byte
+	var temporaryPath string
+
+	// Open the pool first, so that an interrupted update of the position is recovered.
+	if pool, err = PoolOpen(path); err != nil {
+		return err
+	}
+	pool.Close()
+	if plain, err = os.ReadFile(path); err != nil {
+		return err
+	}
+
+	if header, err = newProtectedHeader(); err != nil {
+		return err
+	}
+	if sealed, err = sealProtected(&header, deriveKey(passphrase, &header), plain); err != nil {
+		return err
+	}
+	if temporaryPath, err = writeTemporary(path, sealed); err != nil {
+		return err
+	}
+	if err = Shred(path, protectShredPasses); err != nil {
+		_ = os.Remove(temporaryPath)
+		return fmt.Errorf(`cannot shred the plain pool "%s": %s`, path, err.Error())
+	}
+	return os.Rename(temporaryPath, path)
+}
+
+// ProtectedClone Creates a protected pool, encrypted using a passphrase, that contains all the key material of a key
+// source (see `Clone`). The key material is never written in plain.
+func ProtectedClone(source KeySource, path string, position int64, zero bool, passphrase []byte) (*ProtectedPool, error) {
+	var err error
+	var data []byte
+	var pool = ProtectedPool{Path: path, receiver: -1}
+
+	if data, position, err = cloneData(source, position, zero); err != nil {
+		return nil, err
+	}
+	if pool.header, err = newProtectedHeader(); err != nil {
+		return nil, err
+	}
+	pool.key = deriveKey(passphrase, &pool.header)
+	pool.MemoryPool = MemoryPool{data: data, position: position}
+	if err = pool.save(); err != nil {
+		return nil, err
+	}
+	return &pool, nil
+}
+
+// newProtectedHeader Returns the header of a new protected pool: the default parameters of the key derivation, and a
+// random salt.
+func newProtectedHeader() (protectedHeader, error) {
+	var header protectedHeader
+
+	copy(header.Magic[:], protectedMagic)
+	header.Time = argon2Time
+	header.Memory = argon2Memory
+	header.Threads = argon2Threads
+	if _, err := rand.Read(header.Salt[:]); err != nil {
+		return header, err
+	}
+	return header, nil
+}
+
+// Unprotect Decrypts a protected pool file, using its passphrase.
+func Unprotect(path string, passphrase []byte) error {
+	var err error
+	var plain []byte
+
+	if _, _, plain, err = readProtected(path, passphrase); err != nil {
+		return err
+	}
+	return writeAtomically(path, plain)
+}
+
+// ProtectedOpen Opens a protected pool, using its passphrase.
+func ProtectedOpen(path string, passphrase []byte) (*ProtectedPool, error) {
+	var err error
+	var header *protectedHeader
+	var key []byte
+	var plain []byte
+	var position int64
+	var data []byte
+	var pool = ProtectedPool{Path: path}
+
+	if header, key, plain, err = readProtected(path, passphrase); err != nil {
+		return nil, err
+	}
+	if position, pool.receiver, data, err = splitHeader(path, plain); err != nil {
+		return nil, err
+	}
+	pool.MemoryPool = MemoryPool{data: data, position: position}
+	pool.header = *header
+	pool.key = key
+	return &pool, nil
+}
+
+// Read Retrieves `count` bytes from the pool, starting at the current position pointer's position, and moves the
+// position pointer forward (the new position is saved into the file).
+func (p *ProtectedPool) Read(count int64) ([]byte, error) {
+	var err error
+	var buffer []byte
+
+	if buffer, err = p.MemoryPool.Read(count); err != nil {
+		return nil, err
+	}
+	if err = p.save(); err != nil {
+		p.position -= count
+		return nil, err
+	}
+	return buffer, nil
+}
+
+// Consume Moves the position pointer `count` bytes forward, without retrieving the bytes (the new position is saved
+// into the file).
+func (p *ProtectedPool) Consume(count int64) error {
+	var err error
+
+	if err = p.MemoryPool.Consume(count); err != nil {
+		return err
+	}
+	if err = p.save(); err != nil {
+		p.position -= count
+		return err
+	}
+	return nil
+}
+
+// ReceiverPosition Returns the position of the receiver's cursor, and false if the pool has no receiver's cursor.
+func (p *ProtectedPool) ReceiverPosition() (int64, bool) {
+	return p.receiver, p.receiver >= 0
+}
+
+// SetReceiverPosition Sets the position of the receiver's cursor (see `ReceiverCursor`), and saves it into the file.
+func (p *ProtectedPool) SetReceiverPosition(position int64) error {
+	var err error
+	var previous = p.receiver
+
+	if position < 0 || position > int64(len(p.data)) {
+		return fmt.Errorf(`invalid receiver position (%d): the pool "%s" contains %d bytes`, position, p.Path, len(p.data))
+	}
+	p.receiver = position
+	if err = p.save(); err != nil {
+		p.receiver = previous
+		return err
+	}
+	return nil
+}
+
+// Append Appends the content of a file to the end of the pool (see `AppendBytes`).
+func (p *ProtectedPool) Append(filePath string) (int64, error) {
+	var err error
+	var data []byte
+
+	if data, err = os.ReadFile(filePath); err != nil {
+		return 0, err
+	}
+	if err = p.AppendBytes(data); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// AppendBytes Appends a given list of bytes to the end of the pool (the pool is saved into the file).
+// Please note that a call to this method does *NOT* modify the position of the position pointer.
+func (p *ProtectedPool) AppendBytes(data []byte) error {
+	var err error
+	var length = len(p.data)
+
+	p.data = append(p.data, data...)
+	if err = p.save(); err != nil {
+		p.data = p.data[:length]
+		return err
+	}
+	return nil
+}
+
+// SetPositionToFile Sets the position of the position pointer, and saves it into the file.
+func (p *ProtectedPool) SetPositionToFile(position int64) error {
+	var err error
+	var previous = p.position
+
+	if position < 0 || position > int64(len(p.data)) {
+		return fmt.Errorf(`invalid position (%d): the pool "%s" contains %d bytes`, position, p.Path, len(p.data))
+	}
+	p.position = position
+	if err = p.save(); err != nil {
+		p.position = previous
+		return err
+	}
+	return nil
+}
+
+// save Encrypts the pool (with a new nonce) and replaces the file.
+func (p *ProtectedPool) save() error {
+	var plain []byte
+
+	if p.receiver >= 0 {
+		return writeProtected(p.Path, &p.header, p.key, joinHeader(p.position, p.receiver, p.data))
+	}
+	plain = make([]byte, positionTypeLength, positionTypeLength+len(p.data))
+	binary.LittleEndian.PutUint64(plain, uint64(p.position))
+	plain = append(plain, p.data...)
+	return writeProtected(p.Path, &p.header, p.key, plain)
+}
+
+// deriveKey Derives the encryption key from the passphrase and the parameters stored into the header.
+func deriveKey(passphrase []byte, header *protectedHeader) []byte {
+	return argon2.IDKey(passphrase, header.Salt[:], header.Time, header.Memory, header.Threads, protectedKeyLength)
+}
+
+// writeProtected Encrypts `plain` (with a new nonce) and atomically writes the result into a file.
+func writeProtected(path string, header *protectedHeader, key []byte, plain []byte) error {
+	var err error
+	var sealed []byte
+
+	if sealed, err = sealProtected(header, key, plain); err != nil {
+		return err
+	}
+	return writeAtomically(path, sealed)
+}
+
+// sealProtected Encrypts a pool (its header and its content), using a new nonce. It returns the content of the file.
+func sealProtected(header *protectedHeader, key []byte, plain []byte) ([]byte, error) {
+	var err error
+	var headerBuffer = new(bytes.Buffer)
+	var aead cipher.AEAD
+
+	if _, err = rand.Read(header.Nonce[:]); err != nil {
+		return nil, err
+	}
+	if err = binary.Write(headerBuffer, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	if aead, err = chacha20poly1305.New(key); err != nil {
+		return nil, err
+	}
+	return aead.Seal(headerBuffer.Bytes(), header.Nonce[:], plain, headerBuffer.Bytes()), nil
+}
+
+// readProtected Reads and decrypts a protected pool file. It returns the header of the file, the encryption key derived
+// from the passphrase, and the content of the pool.
+func readProtected(path string, passphrase []byte) (*protectedHeader, []byte, []byte, error) {
+	var err error
+	var content []byte
+	var header protectedHeader
+	var headerLength = binary.Size(header)
+	var key []byte
+	var plain []byte
+	var aead cipher.AEAD
+
+	if content, err = os.ReadFile(path); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(content) < headerLength || string(content[:len(protectedMagic)]) != protectedMagic {
+		return nil, nil, nil, fmt.Errorf(`the pool "%s" is not protected`, path)
+	}
+	if err = binary.Read(bytes.NewReader(content[:headerLength]), binary.LittleEndian, &header); err != nil {
+		return nil, nil, nil, err
+	}
+	if err = header.check(); err != nil {
+		return nil, nil, nil, fmt.Errorf(`cannot decrypt the pool "%s": %s`, path, err.Error())
+	}
+	key = deriveKey(passphrase, &header)
+	if aead, err = chacha20poly1305.New(key); err != nil {
+		return nil, nil, nil, err
+	}
+	if plain, err = aead.Open(nil, header.Nonce[:], content[headerLength:], content[:headerLength]); err != nil {
+		return nil, nil, nil, fmt.Errorf(`cannot decrypt the pool "%s": wrong passphrase (or corrupted file)`, path)
+	}
+	return &header, key, plain, nil
+}
+
+// check Checks the parameters of the key derivation (see `deriveKey`), which are read from the file before they can
+// be authenticated.
+func (h *protectedHeader) check() error {
+	if h.Time < 1 || h.Time > argon2MaxTime {
+		return fmt.Errorf(`invalid header: invalid number of passes (%d, expected 1 to %d)`, h.Time, argon2MaxTime)
+	}
+	if h.Threads < 1 {
+		return fmt.Errorf(`invalid header: invalid number of threads (%d)`, h.Threads)
+	}
+	if h.Memory < 8*uint32(h.Threads) || h.Memory > argon2MaxMemory {
+		return fmt.Errorf(`invalid header: invalid amount of memory (%d KiB, expected %d to %d KiB)`, h.Memory, 8*uint32(h.Threads), argon2MaxMemory)
+	}
+	return nil
+}
+
+// writeAtomically Writes a file by creating a temporary file and renaming it.
+func writeAtomically(path string, content []byte) error {
+	var err error
+	var temporaryPath string
+
+	if temporaryPath, err = writeTemporary(path, content); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, path)
+}
+
+// writeTemporary Writes (and syncs) the temporary file that replaces a file (see `writeAtomically`). It returns the
+// path to the temporary file.
+func writeTemporary(path string, content []byte) (string, error) {
+	var err error
+	var fd *os.File
+	var temporaryPath = path + ".tmp"
+
+	if fd, err = os.OpenFile(temporaryPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+		return "", err
+	}
+	if _, err = fd.Write(content); err != nil {
+		fd.Close()
+		return "", err
+	}
+	if err = fd.Sync(); err != nil {
+		fd.Close()
+		return "", err
+	}
+	if err = fd.Close(); err != nil {
+		return "", err
+	}
+	return temporaryPath, nil
+}
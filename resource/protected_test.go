@@ -0,0 +1,265 @@
+package resource
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProtect(t *testing.T) {
+	var err error
+	var p *Pool
+	var pp *ProtectedPool
+	var source KeySource
+	var protected bool
+	var content []byte
+	var plain []byte
+	var shredded []byte
+	var former *os.File
+	var passphrase = []byte("correct horse battery staple")
+
+	// PoolCreate a pool, and consume some bytes.
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	err = p.Consume(3)
+	assert.Nil(t, err)
+	p.Close()
+
+	// The plain pool is shredded: its content cannot be read from its former file, and no journal is left.
+	plain, err = os.ReadFile(poolPath)
+	assert.Nil(t, err)
+	former, err = os.Open(poolPath)
+	assert.Nil(t, err)
+	defer former.Close()
+	err = Protect(poolPath, passphrase)
+	assert.Nil(t, err)
+	shredded, err = io.ReadAll(former)
+	assert.Nil(t, err)
+	assert.Len(t, shredded, len(plain))
+	assert.NotEqual(t, plain, shredded)
+	for _, suffix := range []string{JournalSuffix, ReceiverJournalSuffix, ".tmp"} {
+		_, err = os.Stat(poolPath + suffix)
+		assert.True(t, os.IsNotExist(err))
+	}
+	protected, err = IsProtected(poolPath)
+	assert.Nil(t, err)
+	assert.True(t, protected)
+
+	// A protected pool cannot be opened as a plain pool.
+	_, err = PoolOpen(poolPath)
+	assert.True(t, errors.Is(err, ErrProtected))
+	_, err = ProtectedOpen(poolPath, []byte("wrong passphrase"))
+	assert.NotNil(t, err)
+
+	pp, err = ProtectedOpen(poolPath, passphrase)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), pp.Position())
+	content, err = pp.Read(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{3, 4}, content)
+	pp.Close()
+
+	// The position has been saved. Open the pool through the passphrase provider.
+	PassphraseProvider = func(path string) ([]byte, error) {
+		return passphrase, nil
+	}
+	defer func() { PassphraseProvider = nil }()
+	source, err = Open(poolPath)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), source.Position())
+	source.Close()
+
+	// Back to a plain pool.
+	err = Unprotect(poolPath, passphrase)
+	assert.Nil(t, err)
+	p, err = PoolOpen(poolPath)
+	assert.Nil(t, err)
+	defer p.Close()
+	assert.Equal(t, int64(5), p.Position())
+	content, err = os.ReadFile(poolPath)
+	assert.Nil(t, err)
+	assert.Len(t, content, poolLength+positionTypeLength)
+}
+
+func TestProtectedReceiverPosition(t *testing.T) {
+	var err error
+	var p *Pool
+	var pp *ProtectedPool
+	var receiver int64
+	var set bool
+	var content []byte
+	var passphrase = []byte("correct horse battery staple")
+
+	// The receiver's cursor of a plain pool is kept once the pool is protected.
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	assert.Nil(t, p.SetReceiverPosition(4))
+	p.Close()
+	assert.Nil(t, Protect(poolPath, passphrase))
+
+	pp, err = ProtectedOpen(poolPath, passphrase)
+	assert.Nil(t, err)
+	receiver, set = pp.ReceiverPosition()
+	assert.True(t, set)
+	assert.Equal(t, int64(4), receiver)
+	assert.Nil(t, pp.SetReceiverPosition(6))
+	assert.NotNil(t, pp.SetReceiverPosition(poolLength+1))
+	content, err = pp.Read(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0}, content)
+	pp.Close()
+
+	pp, err = ProtectedOpen(poolPath, passphrase)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), pp.Position())
+	receiver, _ = pp.ReceiverPosition()
+	assert.Equal(t, int64(6), receiver)
+	pp.Close()
+
+	// Back to a plain pool.
+	assert.Nil(t, Unprotect(poolPath, passphrase))
+	p, err = PoolOpen(poolPath)
+	assert.Nil(t, err)
+	defer p.Close()
+	assert.Equal(t, int64(1), p.Position())
+	receiver, _ = p.ReceiverPosition()
+	assert.Equal(t, int64(6), receiver)
+}
+
+func TestProtectedEditor(t *testing.T) {
+	var err error
+	var p *Pool
+	var pp *ProtectedPool
+	var editor KeyEditor
+	var count int64
+	var length int64
+	var content []byte
+	var passphrase = []byte("correct horse battery staple")
+
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	p.Close()
+	assert.Nil(t, Protect(poolPath, passphrase))
+	pp, err = ProtectedOpen(poolPath, passphrase)
+	assert.Nil(t, err)
+	editor = pp
+
+	// The key material is extended, and the position pointer is set.
+	assert.Nil(t, editor.AppendBytes([]byte{0xAA, 0xBB}))
+	count, err = editor.Append(sourcePath)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(poolLength), count)
+	assert.Nil(t, editor.SetPositionToFile(poolLength))
+	assert.NotNil(t, editor.SetPositionToFile(3*poolLength))
+	pp.Close()
+
+	pp, err = ProtectedOpen(poolPath, passphrase)
+	assert.Nil(t, err)
+	defer pp.Close()
+	length, err = pp.Length()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2*poolLength+2), length)
+	assert.Equal(t, int64(poolLength), pp.Position())
+	content, err = pp.Read(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xAA, 0xBB}, content)
+}
+
+func TestProtectedInvalidHeader(t *testing.T) {
+	var err error
+	var p *Pool
+	var pp *ProtectedPool
+	var content []byte
+	var passphrase = []byte("correct horse battery staple")
+
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	p.Close()
+	assert.Nil(t, Protect(poolPath, passphrase))
+	content, err = os.ReadFile(poolPath)
+	assert.Nil(t, err)
+
+	// The parameters of the key derivation are checked before the key is derived (no panic, no memory exhaustion).
+	for _, test := range []struct {
+		name   string
+		offset int
+		value  []byte
+	}{
+		{name: "no pass", offset: 8, value: []byte{0, 0, 0, 0}},
+		{name: "too many passes", offset: 8, value: []byte{0xff, 0xff, 0, 0}},
+		{name: "no memory", offset: 12, value: []byte{0, 0, 0, 0}},
+		{name: "too much memory", offset: 12, value: []byte{0xff, 0xff, 0xff, 0xff}},
+		{name: "no thread", offset: 16, value: []byte{0}},
+	} {
+		var corrupted = append([]byte{}, content...)
+
+		copy(corrupted[test.offset:], test.value)
+		assert.Nil(t, os.WriteFile(poolPath, corrupted, 0600))
+		assert.NotPanics(t, func() {
+			_, err = ProtectedOpen(poolPath, passphrase)
+		}, test.name)
+		assert.NotNil(t, err, test.name)
+		assert.NotNil(t, Unprotect(poolPath, passphrase), test.name)
+	}
+
+	// The key is derived once, when the pool is opened.
+	assert.Nil(t, os.WriteFile(poolPath, content, 0600))
+	pp, err = ProtectedOpen(poolPath, passphrase)
+	assert.Nil(t, err)
+	assert.Equal(t, deriveKey(passphrase, &pp.header), pp.key)
+	assert.Nil(t, pp.Consume(1))
+	pp.Close()
+	pp, err = ProtectedOpen(poolPath, passphrase)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), pp.Position())
+	pp.Close()
+}
+
+func TestProtectedClone(t *testing.T) {
+	var err error
+	var source KeySource
+	var clone *ProtectedPool
+	var pp *ProtectedPool
+	var protected bool
+	var content []byte
+	var data []byte
+	var path = filepath.Join(t.TempDir(), "clone")
+	var material = []byte("this key material must never be written in plain")
+	var passphrase = []byte("correct horse battery staple")
+
+	source, err = NewMemoryPool(material, 5)
+	assert.Nil(t, err)
+	clone, err = ProtectedClone(source, path, 10, true, passphrase)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), clone.Position())
+	assert.Nil(t, clone.Close())
+
+	// The key material is encrypted.
+	protected, err = IsProtected(path)
+	assert.Nil(t, err)
+	assert.True(t, protected)
+	content, err = os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(content, material[10:]))
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = ProtectedOpen(path, []byte("wrong passphrase"))
+	assert.NotNil(t, err)
+	pp, err = ProtectedOpen(path, passphrase)
+	assert.Nil(t, err)
+	defer pp.Close()
+	assert.Equal(t, int64(10), pp.Position())
+	data, err = pp.ReadAt(0, int64(len(material)))
+	assert.Nil(t, err)
+	assert.Equal(t, append(make([]byte, 10), material[10:]...), data)
+
+	// The source is left as is.
+	assert.Equal(t, int64(5), source.Position())
+	_, err = ProtectedClone(source, filepath.Join(t.TempDir(), "invalid"), int64(len(material))+1, false, passphrase)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,66 @@
+package resource
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+)
+
+// shredBufferLength The size of the buffer used to overwrite a file.
+const shredBufferLength = 64 * 1024
+
+// Shred Overwrites a pool file with random data (`passes` times), and then removes it.
+// Please note that the journal (if any) is also removed.
+// Keep in mind that, depending on the file system (journaling, copy-on-write...) and on the storage device (SSD wear
+// levelling...), the original data may still be recoverable.
+func Shred(path string, passes int) error {
+	var err error
+	var fd *os.File
+	var info os.FileInfo
+	var buffer = make([]byte, shredBufferLength)
+
+	if passes <= 0 {
+		return fmt.Errorf(`invalid number of passes (%d)`, passes)
+	}
+	if fd, err = os.OpenFile(path, os.O_RDWR, 0644); err != nil {
+		return err
+	}
+	if info, err = fd.Stat(); err != nil {
+		fd.Close()
+		return err
+	}
+	for pass := 0; pass < passes; pass++ {
+		var remaining = info.Size()
+		var offset int64
+		for remaining > 0 {
+			var count = int64(len(buffer))
+			if remaining < count {
+				count = remaining
+			}
+			if _, err = rand.Read(buffer[:count]); err != nil {
+				fd.Close()
+				return err
+			}
+			if _, err = fd.WriteAt(buffer[:count], offset); err != nil {
+				fd.Close()
+				return err
+			}
+			offset += count
+			remaining -= count
+		}
+		if err = fd.Sync(); err != nil {
+			fd.Close()
+			return err
+		}
+	}
+	if err = fd.Close(); err != nil {
+		return err
+	}
+	if err = os.Remove(path + JournalSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = os.Remove(path + ReceiverJournalSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(path)
+}
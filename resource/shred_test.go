@@ -0,0 +1,29 @@
+package resource
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestShred(t *testing.T) {
+	var err error
+	var p *Pool
+
+	// PoolCreate a pool.
+	p, err = PoolCreate(poolPath, sourcePath)
+	assert.Nil(t, err)
+	p.Close()
+
+	err = Shred(poolPath, 0)
+	assert.NotNil(t, err)
+
+	err = Shred(poolPath, 3)
+	assert.Nil(t, err)
+	_, err = os.Stat(poolPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// The pool does not exist anymore.
+	err = Shred(poolPath, 1)
+	assert.NotNil(t, err)
+}
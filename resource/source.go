@@ -0,0 +1,134 @@
+package resource
+
+import "fmt"
+
+// KeySource Represents a source of key material.
+// Bytes are extracted sequentially, starting at the current position of the position pointer. Once extracted, bytes
+// must never be used again (that's the point of the one-time pad).
+type KeySource interface {
+	// Read Retrieves `count` bytes, starting at the current position pointer's position, and moves the position
+	// pointer forward.
+	Read(count int64) ([]byte, error)
+	// Consume Moves the position pointer `count` bytes forward, without retrieving the bytes.
+	Consume(count int64) error
+	// ReadAt Retrieves `count` bytes, starting at a given position, without moving the position pointer.
+	ReadAt(position int64, count int64) ([]byte, error)
+	// Peek Retrieves `count` bytes, starting at the current position pointer's position, without moving the position
+	// pointer.
+	Peek(count int64) ([]byte, error)
+	// Position Returns the current position of the position pointer.
+	Position() int64
+	// Length Returns the number of bytes of key material (used, or not).
+	Length() (int64, error)
+	// Close Releases the resources associated with the key source.
+	Close() error
+}
+
+// ReceiverCursor A key source that also tracks the position of the key material of the next hidden message to decode
+// (the receiver's cursor), independently of its position pointer (used to encode). Thus, the same key can be used to
+// send and to receive.
+type ReceiverCursor interface {
+	// ReceiverPosition Returns the position of the receiver's cursor, and false if it has never been set.
+	ReceiverPosition() (int64, bool)
+	// SetReceiverPosition Sets the position of the receiver's cursor, and saves it.
+	SetReceiverPosition(position int64) error
+}
+
+// KeyEditor A (file based) key source whose key material can be extended, and whose position pointer can be set
+// (see `Pool` and `ProtectedPool`).
+type KeyEditor interface {
+	// Append Appends the content of a file to the end of the key material, and returns the number of bytes appended.
+	Append(filePath string) (int64, error)
+	// AppendBytes Appends bytes to the end of the key material.
+	AppendBytes(data []byte) error
+	// SetPositionToFile Saves a new position of the position pointer into the file.
+	SetPositionToFile(position int64) error
+}
+
+// Open Opens the (file based) key source identified by its path.
+// If the pool is protected by a passphrase, then the passphrase is retrieved by calling `PassphraseProvider`.
+func Open(path string) (KeySource, error) {
+	var err error
+	var pool *Pool
+	var protectedPool *ProtectedPool
+	var protected bool
+	var passphrase []byte
+
+	if protected, err = IsProtected(path); err != nil {
+		return nil, err
+	}
+	if protected {
+		if PassphraseProvider == nil {
+			return nil, fmt.Errorf(`pool "%s": %w`, path, ErrProtected)
+		}
+		if passphrase, err = PassphraseProvider(path); err != nil {
+			return nil, err
+		}
+		if protectedPool, err = ProtectedOpen(path, passphrase); err != nil {
+			return nil, err
+		}
+		return protectedPool, nil
+	}
+	if pool, err = PoolOpen(path); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// ReadChunks Extracts a given number of chunks from a key source.
+func ReadChunks(source KeySource, chunkCount int64, chunkLength int64) ([][]byte, error) {
+	var err error
+	var buffer []byte
+	var result [][]byte
+
+	if buffer, err = source.Read(chunkCount * chunkLength); err != nil {
+		return nil, err
+	}
+	for i := int64(0); i < chunkCount; i++ {
+		result = append(result, buffer[i*chunkLength:(i+1)*chunkLength])
+	}
+	return result, nil
+}
+
+// Clone Creates a plain pool (see `PoolCreateFromBytes`) that contains all the key material of a key source, with the
+// position pointer set to a given position (the current position of the source if negative). If `zero` is set, then
+// the bytes that precede the position pointer are set to zero in the new pool.
+// Please note that the key material is written in plain: see `ProtectedClone` to clone a protected pool.
+func Clone(source KeySource, path string, position int64, zero bool) (*Pool, error) {
+	var err error
+	var data []byte
+
+	if data, position, err = cloneData(source, position, zero); err != nil {
+		return nil, err
+	}
+	return PoolCreateFromBytes(path, data, position)
+}
+
+// cloneData Returns all the key material of a key source, and the position of the position pointer of its clone (see
+// `Clone`).
+func cloneData(source KeySource, position int64, zero bool) ([]byte, int64, error) {
+	var err error
+	var length int64
+	var data []byte
+
+	if length, err = source.Length(); err != nil {
+		return nil, 0, err
+	}
+	if position < 0 {
+		position = source.Position()
+	}
+	if position > length {
+		return nil, 0, fmt.Errorf(`invalid position (%d): the key contains %d bytes`, position, length)
+	}
+	if length > 0 {
+		if data, err = source.ReadAt(0, length); err != nil {
+			return nil, 0, err
+		}
+	}
+	if zero {
+		for i := int64(0); i < position; i++ {
+			data[i] = 0
+		}
+	}
+	return data, position, nil
+}